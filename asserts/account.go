@@ -30,6 +30,11 @@ var (
 	validAccountID = regexp.MustCompile("^(?:[a-z0-9A-Z]{32}|[-a-z0-9]{2,28})$")
 )
 
+// IsValidAccountID returns whether the given account ID is valid.
+func IsValidAccountID(accountID string) bool {
+	return validAccountID.MatchString(accountID)
+}
+
 // Account holds an account assertion, which ties a name for an account
 // to its identifier and provides the authority's confidence in the name's validity.
 type Account struct {
@@ -172,3 +172,12 @@ func (s *accountSuite) TestCheckUntrustedAuthority(c *C) {
 	err = db.Check(account)
 	c.Assert(err, ErrorMatches, `account assertion for "abc-123" is not signed by a directly trusted authority:.*`)
 }
+
+func (s *accountSuite) TestIsValidAccountID(c *C) {
+	for _, id := range []string{"canonical", "my-brand", "abcdefghijklmnopqrstuvwxyzABCDEF"} {
+		c.Check(asserts.IsValidAccountID(id), Equals, true, Commentf("%q", id))
+	}
+	for _, id := range []string{"", "a", "My-Brand", "foo/bar", "abcdefghijklmnopqrstuvwxyz0123456789"} {
+		c.Check(asserts.IsValidAccountID(id), Equals, false, Commentf("%q", id))
+	}
+}
@@ -34,7 +34,8 @@ import (
 type typeFlags int
 
 const (
-	noAuthority typeFlags = iota + 1
+	noAuthority typeFlags = 1 << iota
+	sequenceForming
 )
 
 // MetaHeaders is a list of headers in assertions which are about the assertion
@@ -60,6 +61,13 @@ type AssertionType struct {
 	flags     typeFlags
 }
 
+// SequenceForming returns true if the assertions of the type form
+// sequences, the last primary key header being the sequence number
+// and the other ones identifying the sequence.
+func (at *AssertionType) SequenceForming() bool {
+	return at.flags&sequenceForming != 0
+}
+
 // MaxSupportedFormat returns the maximum supported format iteration for the type.
 func (at *AssertionType) MaxSupportedFormat() int {
 	return maxSupportedFormat[at.Name]
@@ -80,6 +88,7 @@ var (
 	SystemUserType      = &AssertionType{"system-user", []string{"brand-id", "email"}, assembleSystemUser, 0}
 	ValidationType      = &AssertionType{"validation", []string{"series", "snap-id", "approved-snap-id", "approved-snap-revision"}, assembleValidation, 0}
 	StoreType           = &AssertionType{"store", []string{"store"}, assembleStore, 0}
+	ValidationSetType   = &AssertionType{"validation-set", []string{"series", "account-id", "name", "sequence"}, assembleValidationSet, sequenceForming}
 
 // ...
 )
@@ -105,6 +114,7 @@ var typeRegistry = map[string]*AssertionType{
 	ValidationType.Name:      ValidationType,
 	RepairType.Name:          RepairType,
 	StoreType.Name:           StoreType,
+	ValidationSetType.Name:   ValidationSetType,
 	// no authority
 	DeviceSessionRequestType.Name: DeviceSessionRequestType,
 	SerialRequestType.Name:        SerialRequestType,
@@ -183,6 +193,27 @@ func HeadersFromPrimaryKey(assertType *AssertionType, primaryKey []string) (head
 	return headers, nil
 }
 
+// HeadersFromSequenceKey constructs a headers mapping from the
+// sequenceKey values and the sequence forming assertion type, it
+// errors if sequenceKey has the wrong length.
+func HeadersFromSequenceKey(assertType *AssertionType, sequenceKey []string) (headers map[string]string, err error) {
+	if !assertType.SequenceForming() {
+		return nil, fmt.Errorf("%q assertions do not form sequences", assertType.Name)
+	}
+	if len(sequenceKey) != len(assertType.PrimaryKey)-1 {
+		return nil, fmt.Errorf("sequence key has wrong length for %q assertion", assertType.Name)
+	}
+	headers = make(map[string]string, len(sequenceKey))
+	for i, keyVal := range sequenceKey {
+		name := assertType.PrimaryKey[i]
+		if keyVal == "" {
+			return nil, fmt.Errorf("sequence key %q header cannot be empty", name)
+		}
+		headers[name] = keyVal
+	}
+	return headers, nil
+}
+
 // PrimaryKeyFromHeaders extracts the tuple of values from headers
 // corresponding to a primary key under the assertion type, it errors
 // if there are missing primary key headers.
@@ -276,6 +307,14 @@ type Assertion interface {
 	Ref() *Ref
 }
 
+// SequenceMember is implemented by assertions of sequence forming types.
+type SequenceMember interface {
+	Assertion
+
+	// Sequence returns the sequence number of this assertion.
+	Sequence() int
+}
+
 // customSigner represents an assertion with special arrangements for its signing key (e.g. self-signed), rather than the usual case where an assertion is signed by its authority.
 type customSigner interface {
 	// signKey returns the public key material for the key that signed this assertion.  See also SignKeyID.
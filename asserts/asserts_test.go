@@ -68,6 +68,7 @@ func (as *assertsSuite) TestTypeNames(c *C) {
 		"test-only-no-authority",
 		"test-only-no-authority-pk",
 		"validation",
+		"validation-set",
 	})
 }
 
@@ -97,6 +98,25 @@ func (as *assertsSuite) TestPrimaryKeyHelpers(c *C) {
 	_, err = asserts.HeadersFromPrimaryKey(asserts.TestOnly2Type, []string{"", "baz"})
 	c.Check(err, ErrorMatches, `primary key "pk1" header cannot be empty`)
 
+	headers, err = asserts.HeadersFromSequenceKey(asserts.ValidationSetType, []string{"16", "acc", "myset"})
+	c.Assert(err, IsNil)
+	c.Check(headers, DeepEquals, map[string]string{
+		"series":     "16",
+		"account-id": "acc",
+		"name":       "myset",
+	})
+
+	_, err = asserts.HeadersFromSequenceKey(asserts.ValidationSetType, []string{"16", "acc", "myset", "1"})
+	c.Check(err, ErrorMatches, `sequence key has wrong length for "validation-set" assertion`)
+
+	_, err = asserts.HeadersFromSequenceKey(asserts.ValidationSetType, []string{"16", "", "myset"})
+	c.Check(err, ErrorMatches, `sequence key "account-id" header cannot be empty`)
+
+	_, err = asserts.HeadersFromSequenceKey(asserts.TestOnly2Type, []string{"bar"})
+	c.Check(err, ErrorMatches, `"test-only-2" assertions do not form sequences`)
+
+	headers, err = asserts.HeadersFromPrimaryKey(asserts.TestOnly2Type, []string{"bar", "baz"})
+	c.Assert(err, IsNil)
 	pk, err := asserts.PrimaryKeyFromHeaders(asserts.TestOnly2Type, headers)
 	c.Assert(err, IsNil)
 	c.Check(pk, DeepEquals, []string{"bar", "baz"})
@@ -888,6 +908,7 @@ func (as *assertsSuite) TestWithAuthority(c *C) {
 		"serial",
 		"system-user",
 		"validation",
+		"validation-set",
 		"repair",
 	}
 	c.Check(withAuthority, HasLen, asserts.NumAssertionType-3) // excluding device-session-request, serial-request, account-key-request
@@ -181,6 +181,10 @@ type RODatabase interface {
 	// (trusted or not) based on arbitrary headers.  It returns a
 	// NotFoundError if no assertion can be found.
 	FindManyPredefined(assertionType *AssertionType, headers map[string]string) ([]Assertion, error)
+	// FindSequence finds the assertion with the highest sequence
+	// number in the sequence identified by the given headers. It
+	// returns a NotFoundError if the sequence has no assertions.
+	FindSequence(assertionType *AssertionType, sequenceHeaders map[string]string) (SequenceMember, error)
 	// Check tests whether the assertion is properly signed and consistent with all the stored knowledge.
 	Check(assert Assertion) error
 }
@@ -567,6 +571,43 @@ func (db *Database) FindMany(assertionType *AssertionType, headers map[string]st
 	return db.findMany(db.backstores, assertionType, headers)
 }
 
+// FindSequence finds the assertion with the highest sequence number
+// in the sequence identified by the given headers, which must contain
+// the primary key of the sequence forming type except for the
+// sequence number. It returns a NotFoundError if the sequence has no
+// assertions.
+func (db *Database) FindSequence(assertionType *AssertionType, sequenceHeaders map[string]string) (SequenceMember, error) {
+	err := checkAssertType(assertionType)
+	if err != nil {
+		return nil, err
+	}
+	if !assertionType.SequenceForming() {
+		return nil, fmt.Errorf("cannot find %q assertions by sequence: type does not form sequences", assertionType.Name)
+	}
+	seqKey := assertionType.PrimaryKey[len(assertionType.PrimaryKey)-1]
+	if _, ok := sequenceHeaders[seqKey]; ok {
+		return nil, fmt.Errorf("cannot find %q assertions by sequence: sequence headers must not include %q", assertionType.Name, seqKey)
+	}
+	for _, k := range assertionType.PrimaryKey[:len(assertionType.PrimaryKey)-1] {
+		if _, ok := sequenceHeaders[k]; !ok {
+			return nil, fmt.Errorf("cannot find %q assertions by sequence: sequence headers must include %q", assertionType.Name, k)
+		}
+	}
+
+	as, err := db.findMany(db.backstores, assertionType, sequenceHeaders)
+	if err != nil {
+		return nil, err
+	}
+	var latest SequenceMember
+	for _, a := range as {
+		member := a.(SequenceMember)
+		if latest == nil || member.Sequence() > latest.Sequence() {
+			latest = member
+		}
+	}
+	return latest, nil
+}
+
 // FindManyPrefined finds assertions in the predefined sets (trusted
 // or not) based on arbitrary headers.  It returns a NotFoundError if
 // no assertion can be found.
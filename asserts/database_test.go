@@ -1287,3 +1287,77 @@ func (s *isUnacceptedUpdateSuite) TestIsUnacceptedUpdate(c *C) {
 		c.Check(asserts.IsUnaccceptedUpdate(t.err), Equals, t.keptCurrent, Commentf("%v", t.err))
 	}
 }
+
+type findSequenceSuite struct {
+	storeSigning *assertstest.StoreStack
+}
+
+var _ = Suite(&findSequenceSuite{})
+
+func (s *findSequenceSuite) SetUpTest(c *C) {
+	s.storeSigning = assertstest.NewStoreStack("can0nical", nil)
+}
+
+func (s *findSequenceSuite) addValidationSet(c *C, name, sequence string) {
+	a, err := s.storeSigning.Sign(asserts.ValidationSetType, map[string]interface{}{
+		"account-id": "can0nical",
+		"series":     "16",
+		"name":       name,
+		"sequence":   sequence,
+		"snaps": []interface{}{
+			map[string]interface{}{
+				"name": "foo",
+				"id":   "fooidididididididididididididid1",
+			},
+		},
+		"timestamp": time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	c.Assert(s.storeSigning.Add(a), IsNil)
+}
+
+func (s *findSequenceSuite) TestFindSequence(c *C) {
+	c.Check(asserts.ValidationSetType.SequenceForming(), Equals, true)
+
+	s.addValidationSet(c, "myset", "1")
+	s.addValidationSet(c, "myset", "3")
+	s.addValidationSet(c, "myset", "2")
+	s.addValidationSet(c, "other", "4")
+
+	a, err := s.storeSigning.FindSequence(asserts.ValidationSetType, map[string]string{
+		"series":     "16",
+		"account-id": "can0nical",
+		"name":       "myset",
+	})
+	c.Assert(err, IsNil)
+	c.Check(a.Type(), Equals, asserts.ValidationSetType)
+	c.Check(a.Sequence(), Equals, 3)
+
+	_, err = s.storeSigning.FindSequence(asserts.ValidationSetType, map[string]string{
+		"series":     "16",
+		"account-id": "can0nical",
+		"name":       "missing",
+	})
+	c.Check(asserts.IsNotFound(err), Equals, true)
+}
+
+func (s *findSequenceSuite) TestFindSequenceErrors(c *C) {
+	c.Check(asserts.AccountType.SequenceForming(), Equals, false)
+
+	_, err := s.storeSigning.FindSequence(asserts.AccountType, map[string]string{"account-id": "can0nical"})
+	c.Check(err, ErrorMatches, `cannot find "account" assertions by sequence: type does not form sequences`)
+
+	_, err = s.storeSigning.FindSequence(asserts.ValidationSetType, map[string]string{
+		"series":     "16",
+		"account-id": "can0nical",
+		"name":       "myset",
+		"sequence":   "1",
+	})
+	c.Check(err, ErrorMatches, `cannot find "validation-set" assertions by sequence: sequence headers must not include "sequence"`)
+
+	_, err = s.storeSigning.FindSequence(asserts.ValidationSetType, map[string]string{
+		"series":     "16",
+		"account-id": "can0nical",
+	})
+	c.Check(err, ErrorMatches, `cannot find "validation-set" assertions by sequence: sequence headers must include "name"`)
+}
@@ -124,13 +124,17 @@ func checkIntWithDefault(headers map[string]interface{}, name string, defl int)
 }
 
 func checkInt(headers map[string]interface{}, name string) (int, error) {
-	valueStr, err := checkNotEmptyString(headers, name)
+	return checkIntWhat(headers, name, "header")
+}
+
+func checkIntWhat(headers map[string]interface{}, name, what string) (int, error) {
+	valueStr, err := checkNotEmptyStringWhat(headers, name, what)
 	if err != nil {
 		return -1, err
 	}
 	value, err := strconv.Atoi(valueStr)
 	if err != nil {
-		return -1, fmt.Errorf("%q header is not an integer: %v", name, valueStr)
+		return -1, fmt.Errorf("%q %s is not an integer: %v", name, what, valueStr)
 	}
 	return value, nil
 }
@@ -0,0 +1,354 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapasserts
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/naming"
+)
+
+// ValidationSetKey returns the account-id/name key used to identify
+// a validation-set assertion independently of its sequence.
+func ValidationSetKey(vs *asserts.ValidationSet) string {
+	return vs.AccountID() + "/" + vs.Name()
+}
+
+// InstalledSnap holds the minimal details about an installed snap
+// required to check it against validation sets.
+type InstalledSnap struct {
+	naming.SnapRef
+	Revision snap.Revision
+}
+
+// NewInstalledSnap creates InstalledSnap.
+func NewInstalledSnap(name, snapID string, revision snap.Revision) *InstalledSnap {
+	return &InstalledSnap{
+		SnapRef:  naming.NewSnapRef(name, snapID),
+		Revision: revision,
+	}
+}
+
+// ValidationSetsConflictError describes an error where multiple
+// validation sets are in conflict about snaps.
+type ValidationSetsConflictError struct {
+	Sets  map[string]*asserts.ValidationSet
+	Snaps map[string]error
+}
+
+func (e *ValidationSetsConflictError) Error() string {
+	buf := bytes.NewBufferString("validation sets are in conflict:")
+	ids := make([]string, 0, len(e.Snaps))
+	for id := range e.Snaps {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Fprintf(buf, "\n- %v", e.Snaps[id])
+	}
+	return buf.String()
+}
+
+// ValidationSetsValidationError describes an error arising from
+// validation of installed snaps against a set of validation sets.
+type ValidationSetsValidationError struct {
+	// MissingSnaps maps missing snap names to the validation sets
+	// requiring them.
+	MissingSnaps map[string][]string
+	// InvalidSnaps maps snap names to the validation sets declaring
+	// them invalid.
+	InvalidSnaps map[string][]string
+	// WrongRevisionSnaps maps snap names to the expected revisions
+	// and respective validation sets that require them.
+	WrongRevisionSnaps map[string]map[snap.Revision][]string
+	// Sets maps validation set keys to the validation sets
+	// involved in the failure.
+	Sets map[string]*asserts.ValidationSet
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (e *ValidationSetsValidationError) Error() string {
+	buf := bytes.NewBufferString("validation sets assertions are not met:")
+	if len(e.MissingSnaps) != 0 {
+		buf.WriteString("\n- missing required snaps:")
+		for _, name := range sortedKeys(e.MissingSnaps) {
+			fmt.Fprintf(buf, "\n  - %s (required by sets %s)", name, strings.Join(e.MissingSnaps[name], ","))
+		}
+	}
+	if len(e.InvalidSnaps) != 0 {
+		buf.WriteString("\n- invalid snaps:")
+		for _, name := range sortedKeys(e.InvalidSnaps) {
+			fmt.Fprintf(buf, "\n  - %s (invalid for sets %s)", name, strings.Join(e.InvalidSnaps[name], ","))
+		}
+	}
+	if len(e.WrongRevisionSnaps) != 0 {
+		buf.WriteString("\n- snaps at wrong revisions:")
+		names := make([]string, 0, len(e.WrongRevisionSnaps))
+		for name := range e.WrongRevisionSnaps {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			revs := e.WrongRevisionSnaps[name]
+			revStrs := make([]string, 0, len(revs))
+			for rev, sets := range revs {
+				revStrs = append(revStrs, fmt.Sprintf("at revision %s by sets %s", rev, strings.Join(sets, ",")))
+			}
+			sort.Strings(revStrs)
+			fmt.Fprintf(buf, "\n  - %s (required %s)", name, strings.Join(revStrs, ", "))
+		}
+	}
+	return buf.String()
+}
+
+// setSnap is a snap constraint from a given validation set.
+type setSnap struct {
+	setKey string
+	*asserts.ValidationSetSnap
+}
+
+// ValidationSets can hold a combination of validation-set assertions
+// and can check for conflicts or help applying them.
+type ValidationSets struct {
+	// sets maps account-id/name to validation sets
+	sets map[string]*asserts.ValidationSet
+	// snaps maps snap-ids to the constraints from the sets
+	snaps map[string][]setSnap
+}
+
+// NewValidationSets returns a new ValidationSets.
+func NewValidationSets() *ValidationSets {
+	return &ValidationSets{
+		sets:  map[string]*asserts.ValidationSet{},
+		snaps: map[string][]setSnap{},
+	}
+}
+
+// Add adds the given asserts.ValidationSet to the combination.
+// It errors if a validation-set with the same account-id and name
+// was already added.
+func (v *ValidationSets) Add(valset *asserts.ValidationSet) error {
+	k := ValidationSetKey(valset)
+	if _, ok := v.sets[k]; ok {
+		return fmt.Errorf("cannot add a second validation-set under %q", k)
+	}
+	v.sets[k] = valset
+	for _, sn := range valset.Snaps() {
+		v.snaps[sn.SnapID] = append(v.snaps[sn.SnapID], setSnap{setKey: k, ValidationSetSnap: sn})
+	}
+	return nil
+}
+
+// Keys returns the sorted account-id/name keys of the added
+// validation sets.
+func (v *ValidationSets) Keys() []string {
+	keys := make([]string, 0, len(v.sets))
+	for k := range v.sets {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Conflict returns a non-nil error if the combination is in conflict,
+// nil otherwise.
+func (v *ValidationSets) Conflict() error {
+	sets := make(map[string]*asserts.ValidationSet)
+	snaps := make(map[string]error)
+
+	for snapID, constraints := range v.snaps {
+		var invalid, required []string
+		revs := make(map[int][]string)
+		for _, c := range constraints {
+			switch c.Presence {
+			case asserts.PresenceInvalid:
+				invalid = append(invalid, c.setKey)
+				continue
+			case asserts.PresenceRequired:
+				required = append(required, c.setKey)
+			}
+			if c.Revision != 0 {
+				revs[c.Revision] = append(revs[c.Revision], c.setKey)
+			}
+		}
+
+		name := constraints[0].Name
+		var err error
+		switch {
+		case len(invalid) != 0 && len(required) != 0:
+			err = fmt.Errorf("cannot constrain snap %q as both invalid (%s) and required (%s)", name, strings.Join(invalid, ","), strings.Join(required, ","))
+		case len(revs) > 1:
+			revStrs := make([]string, 0, len(revs))
+			for rev, keys := range revs {
+				revStrs = append(revStrs, fmt.Sprintf("%d (%s)", rev, strings.Join(keys, ",")))
+			}
+			sort.Strings(revStrs)
+			err = fmt.Errorf("cannot constrain snap %q at different revisions %s", name, strings.Join(revStrs, ", "))
+		}
+		if err != nil {
+			snaps[snapID] = err
+			for _, c := range constraints {
+				sets[c.setKey] = v.sets[c.setKey]
+			}
+		}
+	}
+
+	if len(snaps) != 0 {
+		return &ValidationSetsConflictError{
+			Sets:  sets,
+			Snaps: snaps,
+		}
+	}
+	return nil
+}
+
+func (v *ValidationSets) constraintsFor(snapRef naming.SnapRef) []setSnap {
+	if snapID := snapRef.ID(); snapID != "" {
+		return v.snaps[snapID]
+	}
+	// unasserted snap, match by name
+	for _, constraints := range v.snaps {
+		if constraints[0].Name == snapRef.SnapName() {
+			return constraints
+		}
+	}
+	return nil
+}
+
+// CheckInstalledSnaps checks installed snaps against the validation
+// sets. It returns a *ValidationSetsValidationError if the snaps do
+// not satisfy the validation sets.
+func (v *ValidationSets) CheckInstalledSnaps(snaps []*InstalledSnap) error {
+	installed := naming.NewSnapSet(nil)
+	for _, sn := range snaps {
+		installed.Add(sn)
+	}
+
+	missing := make(map[string][]string)
+	invalid := make(map[string][]string)
+	wrongRev := make(map[string]map[snap.Revision][]string)
+	sets := make(map[string]*asserts.ValidationSet)
+
+	for _, constraints := range v.snaps {
+		for _, c := range constraints {
+			ref := installed.Lookup(c)
+			var isnap *InstalledSnap
+			if ref != nil {
+				isnap = ref.(*InstalledSnap)
+			}
+			switch {
+			case isnap == nil && c.Presence == asserts.PresenceRequired:
+				missing[c.Name] = append(missing[c.Name], c.setKey)
+			case isnap != nil && c.Presence == asserts.PresenceInvalid:
+				invalid[c.Name] = append(invalid[c.Name], c.setKey)
+			case isnap != nil && c.Revision != 0 && isnap.Revision.N != c.Revision:
+				rev := snap.R(c.Revision)
+				if wrongRev[c.Name] == nil {
+					wrongRev[c.Name] = make(map[snap.Revision][]string)
+				}
+				wrongRev[c.Name][rev] = append(wrongRev[c.Name][rev], c.setKey)
+			default:
+				continue
+			}
+			sets[c.setKey] = v.sets[c.setKey]
+		}
+	}
+
+	if len(missing) == 0 && len(invalid) == 0 && len(wrongRev) == 0 {
+		return nil
+	}
+	for _, m := range []map[string][]string{missing, invalid} {
+		for _, keys := range m {
+			sort.Strings(keys)
+		}
+	}
+	for _, revs := range wrongRev {
+		for _, keys := range revs {
+			sort.Strings(keys)
+		}
+	}
+	return &ValidationSetsValidationError{
+		MissingSnaps:       missing,
+		InvalidSnaps:       invalid,
+		WrongRevisionSnaps: wrongRev,
+		Sets:               sets,
+	}
+}
+
+// CheckPresenceRequired returns the sorted keys of the validation
+// sets that require the given snap, if any.
+func (v *ValidationSets) CheckPresenceRequired(snapRef naming.SnapRef) []string {
+	var keys []string
+	for _, c := range v.constraintsFor(snapRef) {
+		if c.Presence == asserts.PresenceRequired {
+			keys = append(keys, c.setKey)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CheckPresenceInvalid returns the sorted keys of the validation
+// sets that declare the given snap invalid, if any.
+func (v *ValidationSets) CheckPresenceInvalid(snapRef naming.SnapRef) []string {
+	var keys []string
+	for _, c := range v.constraintsFor(snapRef) {
+		if c.Presence == asserts.PresenceInvalid {
+			keys = append(keys, c.setKey)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// RequiredRevision returns the revision the given snap is pinned to
+// by the validation sets, together with the sorted keys of the sets
+// pinning it. It returns an unset revision if the snap is not
+// pinned. The combination is expected not to be in conflict.
+func (v *ValidationSets) RequiredRevision(snapRef naming.SnapRef) (snap.Revision, []string) {
+	var rev snap.Revision
+	var keys []string
+	for _, c := range v.constraintsFor(snapRef) {
+		if c.Presence == asserts.PresenceInvalid || c.Revision == 0 {
+			continue
+		}
+		if rev.Unset() {
+			rev = snap.R(c.Revision)
+		}
+		if c.Revision == rev.N {
+			keys = append(keys, c.setKey)
+		}
+	}
+	sort.Strings(keys)
+	return rev, keys
+}
@@ -0,0 +1,280 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapasserts_test
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/asserts/snapasserts"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/naming"
+)
+
+type validationSetsSuite struct {
+	storeSigning *assertstest.StoreStack
+}
+
+var _ = Suite(&validationSetsSuite{})
+
+func (s *validationSetsSuite) SetUpTest(c *C) {
+	s.storeSigning = assertstest.NewStoreStack("canonical", nil)
+}
+
+func (s *validationSetsSuite) mockValidationSet(c *C, name string, snaps ...interface{}) *asserts.ValidationSet {
+	a, err := s.storeSigning.Sign(asserts.ValidationSetType, map[string]interface{}{
+		"type":         "validation-set",
+		"authority-id": "canonical",
+		"series":       "16",
+		"account-id":   "canonical",
+		"name":         name,
+		"sequence":     "1",
+		"snaps":        snaps,
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	return a.(*asserts.ValidationSet)
+}
+
+func (s *validationSetsSuite) TestAddAndKeys(c *C) {
+	valset1 := s.mockValidationSet(c, "one", map[string]interface{}{
+		"name": "foo",
+		"id":   "fooidididididididididididididid1",
+	})
+	valset2 := s.mockValidationSet(c, "two", map[string]interface{}{
+		"name": "bar",
+		"id":   "baridididididididididididididid1",
+	})
+
+	valsets := snapasserts.NewValidationSets()
+	c.Assert(valsets.Add(valset2), IsNil)
+	c.Assert(valsets.Add(valset1), IsNil)
+	c.Check(valsets.Keys(), DeepEquals, []string{"canonical/one", "canonical/two"})
+
+	err := valsets.Add(valset1)
+	c.Check(err, ErrorMatches, `cannot add a second validation-set under "canonical/one"`)
+}
+
+func (s *validationSetsSuite) TestConflict(c *C) {
+	valset1 := s.mockValidationSet(c, "one",
+		map[string]interface{}{
+			"name":     "foo",
+			"id":       "fooidididididididididididididid1",
+			"revision": "1",
+		},
+		map[string]interface{}{
+			"name":     "bar",
+			"id":       "baridididididididididididididid1",
+			"presence": "invalid",
+		},
+		map[string]interface{}{
+			"name": "baz",
+			"id":   "bazidididididididididididididid1",
+		})
+	valset2 := s.mockValidationSet(c, "two",
+		map[string]interface{}{
+			"name":     "foo",
+			"id":       "fooidididididididididididididid1",
+			"presence": "optional",
+			"revision": "1",
+		},
+		map[string]interface{}{
+			"name":     "baz",
+			"id":       "bazidididididididididididididid1",
+			"presence": "invalid",
+		})
+	valset3 := s.mockValidationSet(c, "three",
+		map[string]interface{}{
+			"name":     "foo",
+			"id":       "fooidididididididididididididid1",
+			"presence": "optional",
+			"revision": "3",
+		},
+		map[string]interface{}{
+			"name": "bar",
+			"id":   "baridididididididididididididid1",
+		})
+
+	valsets := snapasserts.NewValidationSets()
+	c.Assert(valsets.Add(valset1), IsNil)
+	c.Assert(valsets.Add(valset2), IsNil)
+	c.Check(valsets.Conflict(), ErrorMatches, `validation sets are in conflict:
+- cannot constrain snap "baz" as both invalid \(canonical/two\) and required \(canonical/one\)`)
+
+	valsets = snapasserts.NewValidationSets()
+	c.Assert(valsets.Add(valset1), IsNil)
+	c.Assert(valsets.Add(valset3), IsNil)
+	err := valsets.Conflict()
+	c.Check(err, ErrorMatches, `validation sets are in conflict:
+- cannot constrain snap "bar" as both invalid \(canonical/one\) and required \(canonical/three\)
+- cannot constrain snap "foo" at different revisions 1 \(canonical/one\), 3 \(canonical/three\)`)
+	conflictErr, ok := err.(*snapasserts.ValidationSetsConflictError)
+	c.Assert(ok, Equals, true)
+	c.Check(conflictErr.Sets, HasLen, 2)
+	c.Check(conflictErr.Snaps, HasLen, 2)
+}
+
+func (s *validationSetsSuite) TestNoConflict(c *C) {
+	valset1 := s.mockValidationSet(c, "one",
+		map[string]interface{}{
+			"name":     "foo",
+			"id":       "fooidididididididididididididid1",
+			"revision": "1",
+		},
+		map[string]interface{}{
+			"name":     "bar",
+			"id":       "baridididididididididididididid1",
+			"presence": "invalid",
+		})
+	valset2 := s.mockValidationSet(c, "two",
+		map[string]interface{}{
+			"name": "foo",
+			"id":   "fooidididididididididididididid1",
+		},
+		map[string]interface{}{
+			"name":     "bar",
+			"id":       "baridididididididididididididid1",
+			"presence": "optional",
+			"revision": "2",
+		})
+
+	valsets := snapasserts.NewValidationSets()
+	c.Assert(valsets.Add(valset1), IsNil)
+	c.Assert(valsets.Add(valset2), IsNil)
+	c.Check(valsets.Conflict(), IsNil)
+}
+
+func (s *validationSetsSuite) TestCheckInstalledSnaps(c *C) {
+	valset1 := s.mockValidationSet(c, "one",
+		map[string]interface{}{
+			"name":     "foo",
+			"id":       "fooidididididididididididididid1",
+			"revision": "1",
+		},
+		map[string]interface{}{
+			"name":     "bar",
+			"id":       "baridididididididididididididid1",
+			"presence": "invalid",
+		},
+		map[string]interface{}{
+			"name":     "baz",
+			"id":       "bazidididididididididididididid1",
+			"presence": "optional",
+			"revision": "5",
+		})
+	valset2 := s.mockValidationSet(c, "two",
+		map[string]interface{}{
+			"name":     "foo",
+			"id":       "fooidididididididididididididid1",
+			"revision": "1",
+		},
+		map[string]interface{}{
+			"name": "qux",
+			"id":   "quxidididididididididididididid1",
+		})
+
+	valsets := snapasserts.NewValidationSets()
+	c.Assert(valsets.Add(valset1), IsNil)
+	c.Assert(valsets.Add(valset2), IsNil)
+
+	// all good
+	err := valsets.CheckInstalledSnaps([]*snapasserts.InstalledSnap{
+		snapasserts.NewInstalledSnap("foo", "fooidididididididididididididid1", snap.R(1)),
+		snapasserts.NewInstalledSnap("qux", "quxidididididididididididididid1", snap.R(7)),
+		snapasserts.NewInstalledSnap("other", "otheridididididididididididididi", snap.R(2)),
+	})
+	c.Check(err, IsNil)
+
+	err = valsets.CheckInstalledSnaps([]*snapasserts.InstalledSnap{
+		snapasserts.NewInstalledSnap("foo", "fooidididididididididididididid1", snap.R(2)),
+		snapasserts.NewInstalledSnap("bar", "baridididididididididididididid1", snap.R(1)),
+		snapasserts.NewInstalledSnap("baz", "bazidididididididididididididid1", snap.R(5)),
+	})
+	c.Check(err, ErrorMatches, `validation sets assertions are not met:
+- missing required snaps:
+  - qux \(required by sets canonical/two\)
+- invalid snaps:
+  - bar \(invalid for sets canonical/one\)
+- snaps at wrong revisions:
+  - foo \(required at revision 1 by sets canonical/one,canonical/two\)`)
+	verr, ok := err.(*snapasserts.ValidationSetsValidationError)
+	c.Assert(ok, Equals, true)
+	c.Check(verr.MissingSnaps, DeepEquals, map[string][]string{
+		"qux": {"canonical/two"},
+	})
+	c.Check(verr.InvalidSnaps, DeepEquals, map[string][]string{
+		"bar": {"canonical/one"},
+	})
+	c.Check(verr.WrongRevisionSnaps, DeepEquals, map[string]map[snap.Revision][]string{
+		"foo": {snap.R(1): {"canonical/one", "canonical/two"}},
+	})
+	c.Check(verr.Sets, HasLen, 2)
+}
+
+func (s *validationSetsSuite) TestChecksForSnap(c *C) {
+	valset1 := s.mockValidationSet(c, "one",
+		map[string]interface{}{
+			"name":     "foo",
+			"id":       "fooidididididididididididididid1",
+			"revision": "3",
+		},
+		map[string]interface{}{
+			"name":     "bar",
+			"id":       "baridididididididididididididid1",
+			"presence": "invalid",
+		})
+	valset2 := s.mockValidationSet(c, "two",
+		map[string]interface{}{
+			"name":     "foo",
+			"id":       "fooidididididididididididididid1",
+			"presence": "optional",
+			"revision": "3",
+		},
+		map[string]interface{}{
+			"name":     "baz",
+			"id":       "bazidididididididididididididid1",
+			"presence": "optional",
+		})
+
+	valsets := snapasserts.NewValidationSets()
+	c.Assert(valsets.Add(valset1), IsNil)
+	c.Assert(valsets.Add(valset2), IsNil)
+
+	foo := naming.NewSnapRef("foo", "fooidididididididididididididid1")
+	bar := naming.NewSnapRef("bar", "baridididididididididididididid1")
+	baz := naming.NewSnapRef("baz", "bazidididididididididididididid1")
+	unassertedBar := naming.Snap("bar")
+
+	c.Check(valsets.CheckPresenceRequired(foo), DeepEquals, []string{"canonical/one"})
+	c.Check(valsets.CheckPresenceRequired(baz), HasLen, 0)
+	c.Check(valsets.CheckPresenceInvalid(bar), DeepEquals, []string{"canonical/one"})
+	c.Check(valsets.CheckPresenceInvalid(unassertedBar), DeepEquals, []string{"canonical/one"})
+	c.Check(valsets.CheckPresenceInvalid(foo), HasLen, 0)
+
+	rev, keys := valsets.RequiredRevision(foo)
+	c.Check(rev, Equals, snap.R(3))
+	c.Check(keys, DeepEquals, []string{"canonical/one", "canonical/two"})
+	rev, keys = valsets.RequiredRevision(baz)
+	c.Check(rev.Unset(), Equals, true)
+	c.Check(keys, HasLen, 0)
+}
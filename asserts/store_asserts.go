@@ -22,6 +22,7 @@ package asserts
 import (
 	"fmt"
 	"net/url"
+	"path"
 	"time"
 )
 
@@ -44,7 +45,8 @@ func (store *Store) OperatorID() string {
 	return store.HeaderString("operator-id")
 }
 
-// URL returns the URL of the store's API.
+// URL returns the URL of the store's API, or a file URL pointing to
+// a local directory of snaps and assertions.
 func (store *Store) URL() *url.URL {
 	return store.url
 }
@@ -111,12 +113,20 @@ func checkStoreURL(headers map[string]interface{}) (*url.URL, error) {
 	if err != nil {
 		return nil, fmt.Errorf("%s must be a valid URL: %s", errWhat, s)
 	}
-	if u.Scheme != "http" && u.Scheme != "https" {
+	switch u.Scheme {
+	case "http", "https":
+		if u.Host == "" {
+			return nil, fmt.Errorf(`%s must have a host: %s`, errWhat, s)
+		}
+	case "file":
+		// a local directory of snaps and assertions, as
+		// created by snap download
+		if u.Host != "" || !path.IsAbs(u.Path) {
+			return nil, fmt.Errorf(`%s with "file" scheme must be an absolute path without host: %s`, errWhat, s)
+		}
+	default:
 		return nil, fmt.Errorf(`%s scheme must be "https" or "http": %s`, errWhat, s)
 	}
-	if u.Host == "" {
-		return nil, fmt.Errorf(`%s must have a host: %s`, errWhat, s)
-	}
 	if u.RawQuery != "" {
 		return nil, fmt.Errorf(`%s must not have a query: %s`, errWhat, s)
 	}
@@ -0,0 +1,270 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package asserts
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/snapcore/snapd/snap/naming"
+)
+
+// Presence represents a presence constraint for a snap in a
+// validation-set assertion.
+type Presence string
+
+const (
+	PresenceRequired Presence = "required"
+	PresenceOptional Presence = "optional"
+	PresenceInvalid  Presence = "invalid"
+)
+
+var validPresences = []Presence{PresenceRequired, PresenceOptional, PresenceInvalid}
+
+// ValidationSetSnap holds the details about a snap constrained by a
+// validation-set assertion.
+type ValidationSetSnap struct {
+	Name   string
+	SnapID string
+
+	// Presence is one of: required|optional|invalid, default is required
+	Presence Presence
+
+	// Revision is the pinned revision of the snap, 0 if the snap
+	// can be at any revision
+	Revision int
+}
+
+// SnapName implements naming.SnapRef.
+func (s *ValidationSetSnap) SnapName() string {
+	return s.Name
+}
+
+// ID implements naming.SnapRef.
+func (s *ValidationSetSnap) ID() string {
+	return s.SnapID
+}
+
+var validValidationSetName = regexp.MustCompile("^[a-z0-9](?:-?[a-z0-9])*$")
+
+// IsValidValidationSetName returns whether the given name is a valid
+// name for a validation set.
+func IsValidValidationSetName(name string) bool {
+	return validValidationSetName.MatchString(name)
+}
+
+func checkValidationSetSnap(snap map[string]interface{}) (*ValidationSetSnap, error) {
+	name, err := checkNotEmptyStringWhat(snap, "name", "of snap")
+	if err != nil {
+		return nil, err
+	}
+	if err := naming.ValidateSnap(name); err != nil {
+		return nil, fmt.Errorf("invalid snap name %q", name)
+	}
+
+	what := fmt.Sprintf("of snap %q", name)
+
+	snapID, err := checkStringMatchesWhat(snap, "id", what, validSnapID)
+	if err != nil {
+		return nil, err
+	}
+
+	presence, err := checkOptionalStringWhat(snap, "presence", what)
+	if err != nil {
+		return nil, err
+	}
+	if presence == "" {
+		presence = string(PresenceRequired)
+	}
+	valid := false
+	for _, p := range validPresences {
+		if Presence(presence) == p {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, fmt.Errorf(`"presence" of snap %q must be one of required|optional|invalid`, name)
+	}
+
+	var revision int
+	if _, ok := snap["revision"]; ok {
+		revision, err = checkIntWhat(snap, "revision", what)
+		if err != nil {
+			return nil, err
+		}
+		if revision < 1 {
+			return nil, fmt.Errorf(`"revision" %s must be >=1: %d`, what, revision)
+		}
+		if Presence(presence) == PresenceInvalid {
+			return nil, fmt.Errorf("cannot specify revision of snap %q at the same time as stating its presence is invalid", name)
+		}
+	}
+
+	return &ValidationSetSnap{
+		Name:     name,
+		SnapID:   snapID,
+		Presence: Presence(presence),
+		Revision: revision,
+	}, nil
+}
+
+func checkValidationSetSnaps(snapList interface{}) ([]*ValidationSetSnap, error) {
+	const wrongHeaderType = `"snaps" header must be a list of maps`
+
+	entries, ok := snapList.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf(wrongHeaderType)
+	}
+
+	seen := make(map[string]bool, len(entries))
+	seenIDs := make(map[string]string, len(entries))
+	snaps := make([]*ValidationSetSnap, 0, len(entries))
+	for _, entry := range entries {
+		snap, ok := entry.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf(wrongHeaderType)
+		}
+		valSetSnap, err := checkValidationSetSnap(snap)
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[valSetSnap.Name] {
+			return nil, fmt.Errorf("cannot list the same snap %q multiple times", valSetSnap.Name)
+		}
+		if underName := seenIDs[valSetSnap.SnapID]; underName != "" {
+			return nil, fmt.Errorf("cannot specify the same snap id %q multiple times, specified for snaps %q and %q", valSetSnap.SnapID, underName, valSetSnap.Name)
+		}
+		seen[valSetSnap.Name] = true
+		seenIDs[valSetSnap.SnapID] = valSetSnap.Name
+		snaps = append(snaps, valSetSnap)
+	}
+
+	return snaps, nil
+}
+
+// ValidationSet holds a validation-set assertion, which is a
+// statement by an account about a set of snaps and possibly revisions
+// for which an extrinsic/implied property is valid (e.g. they work
+// well together). validation-sets are organized in sequences under a
+// name.
+type ValidationSet struct {
+	assertionBase
+
+	seq   int
+	snaps []*ValidationSetSnap
+
+	timestamp time.Time
+}
+
+// Series returns the series for which the snap in the set are declared.
+func (vs *ValidationSet) Series() string {
+	return vs.HeaderString("series")
+}
+
+// AccountID returns the identifier of the account that signed this assertion.
+func (vs *ValidationSet) AccountID() string {
+	return vs.HeaderString("account-id")
+}
+
+// Name returns the name under which the validation-set is organized.
+func (vs *ValidationSet) Name() string {
+	return vs.HeaderString("name")
+}
+
+// Sequence returns the sequential number of the validation-set in its
+// named sequence.
+func (vs *ValidationSet) Sequence() int {
+	return vs.seq
+}
+
+// Snaps returns the constrained snaps by the validation-set.
+func (vs *ValidationSet) Snaps() []*ValidationSetSnap {
+	return vs.snaps
+}
+
+// Timestamp returns the time when the validation-set was issued.
+func (vs *ValidationSet) Timestamp() time.Time {
+	return vs.timestamp
+}
+
+// Implement further consistency checks.
+func (vs *ValidationSet) checkConsistency(db RODatabase, acck *AccountKey) error {
+	_, err := db.Find(AccountType, map[string]string{
+		"account-id": vs.AccountID(),
+	})
+	if IsNotFound(err) {
+		return fmt.Errorf("validation-set assertion %q does not have a matching account assertion for %q", vs.Name(), vs.AccountID())
+	}
+	return err
+}
+
+// sanity
+var _ consistencyChecker = (*ValidationSet)(nil)
+
+// Prerequisites returns references to this validation-set's prerequisite assertions.
+func (vs *ValidationSet) Prerequisites() []*Ref {
+	return []*Ref{
+		{Type: AccountType, PrimaryKey: []string{vs.AccountID()}},
+	}
+}
+
+func assembleValidationSet(assert assertionBase) (Assertion, error) {
+	authorityID := assert.AuthorityID()
+	accountID := assert.HeaderString("account-id")
+	if authorityID != accountID {
+		return nil, fmt.Errorf("authority-id and account-id must match, validation-set assertions are expected to be signed by the issuer account: %q != %q", authorityID, accountID)
+	}
+
+	if _, err := checkStringMatches(assert.headers, "name", validValidationSetName); err != nil {
+		return nil, err
+	}
+
+	seq, err := checkInt(assert.headers, "sequence")
+	if err != nil {
+		return nil, err
+	}
+	if seq < 1 {
+		return nil, fmt.Errorf(`"sequence" header must be >=1: %d`, seq)
+	}
+
+	snapList, ok := assert.headers["snaps"]
+	if !ok {
+		return nil, fmt.Errorf(`"snaps" header is mandatory`)
+	}
+	snaps, err := checkValidationSetSnaps(snapList)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp, err := checkRFC3339Date(assert.headers, "timestamp")
+	if err != nil {
+		return nil, err
+	}
+
+	return &ValidationSet{
+		assertionBase: assert,
+		seq:           seq,
+		snaps:         snaps,
+		timestamp:     timestamp,
+	}, nil
+}
@@ -0,0 +1,214 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package asserts_test
+
+import (
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+)
+
+type validationSetSuite struct {
+	ts     time.Time
+	tsLine string
+}
+
+var _ = Suite(&validationSetSuite{})
+
+func (vss *validationSetSuite) SetUpSuite(c *C) {
+	vss.ts = time.Now().Truncate(time.Second).UTC()
+	vss.tsLine = "timestamp: " + vss.ts.Format(time.RFC3339) + "\n"
+}
+
+const (
+	validationSetExample = `type: validation-set
+authority-id: brand-id1
+series: 16
+account-id: brand-id1
+name: baz-3000-good
+sequence: 2
+snaps:
+  -
+    name: baz-linux
+    id: bazlinuxidididididididididididid
+    presence: optional
+    revision: 9
+  -
+    name: foo
+    id: fooidididididididididididididid1
+  -
+    name: bar
+    id: baridididididididididididididid1
+    presence: invalid
+OTHER` + "TSLINE" +
+		"body-length: 0\n" +
+		"sign-key-sha3-384: Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij" +
+		"\n\n" +
+		"AXNpZw=="
+)
+
+func (vss *validationSetSuite) TestDecodeOK(c *C) {
+	encoded := strings.Replace(validationSetExample, "TSLINE", vss.tsLine, 1)
+	encoded = strings.Replace(encoded, "OTHER", "", 1)
+
+	a, err := asserts.Decode([]byte(encoded))
+	c.Assert(err, IsNil)
+	c.Check(a.Type(), Equals, asserts.ValidationSetType)
+	valset := a.(*asserts.ValidationSet)
+	c.Check(valset.AuthorityID(), Equals, "brand-id1")
+	c.Check(valset.Timestamp(), Equals, vss.ts)
+	c.Check(valset.Series(), Equals, "16")
+	c.Check(valset.AccountID(), Equals, "brand-id1")
+	c.Check(valset.Name(), Equals, "baz-3000-good")
+	c.Check(valset.Sequence(), Equals, 2)
+	snaps := valset.Snaps()
+	c.Assert(snaps, DeepEquals, []*asserts.ValidationSetSnap{
+		{
+			Name:     "baz-linux",
+			SnapID:   "bazlinuxidididididididididididid",
+			Presence: asserts.PresenceOptional,
+			Revision: 9,
+		},
+		{
+			Name:     "foo",
+			SnapID:   "fooidididididididididididididid1",
+			Presence: asserts.PresenceRequired,
+		},
+		{
+			Name:     "bar",
+			SnapID:   "baridididididididididididididid1",
+			Presence: asserts.PresenceInvalid,
+		},
+	})
+	c.Check(snaps[0].SnapName(), Equals, "baz-linux")
+	c.Check(snaps[0].ID(), Equals, "bazlinuxidididididididididididid")
+}
+
+const (
+	validationSetErrPrefix = "assertion validation-set: "
+)
+
+func (vss *validationSetSuite) TestDecodeInvalid(c *C) {
+	encoded := strings.Replace(validationSetExample, "TSLINE", vss.tsLine, 1)
+
+	snapsStanza := encoded[strings.Index(encoded, "snaps:"):strings.Index(encoded, "OTHER")]
+
+	invalidTests := []struct{ original, invalid, expectedErr string }{
+		{"series: 16\n", "", `"series" header is mandatory`},
+		{"series: 16\n", "series: \n", `"series" header should not be empty`},
+		{"account-id: brand-id1\n", "", `"account-id" header is mandatory`},
+		{"account-id: brand-id1\n", "account-id: \n", `"account-id" header should not be empty`},
+		{"account-id: brand-id1\n", "account-id: random\n", `authority-id and account-id must match, validation-set assertions are expected to be signed by the issuer account: "brand-id1" != "random"`},
+		{"name: baz-3000-good\n", "", `"name" header is mandatory`},
+		{"name: baz-3000-good\n", "name: \n", `"name" header should not be empty`},
+		{"name: baz-3000-good\n", "name: baz/3000\n", `"name" primary key header cannot contain '/'`},
+		{"name: baz-3000-good\n", "name: baz+3000\n", `"name" header contains invalid characters: "baz\+3000"`},
+		{"sequence: 2\n", "", `"sequence" header is mandatory`},
+		{"sequence: 2\n", "sequence: \n", `"sequence" header should not be empty`},
+		{"sequence: 2\n", "sequence: one\n", `"sequence" header is not an integer: one`},
+		{"sequence: 2\n", "sequence: 0\n", `"sequence" header must be >=1: 0`},
+		{"sequence: 2\n", "sequence: -1\n", `"sequence" header must be >=1: -1`},
+		{snapsStanza, "", `"snaps" header is mandatory`},
+		{snapsStanza, "snaps: snap\n", `"snaps" header must be a list of maps`},
+		{snapsStanza, "snaps:\n  - snap\n", `"snaps" header must be a list of maps`},
+		{"name: foo\n", "other: 1\n", `"name" of snap is mandatory`},
+		{"name: foo\n", "name: foo_2\n", `invalid snap name "foo_2"`},
+		{"id: fooidididididididididididididid1\n", "id: 2\n", `"id" of snap "foo" contains invalid characters: "2"`},
+		{"    id: fooidididididididididididididid1\n", "", `"id" of snap "foo" is mandatory`},
+		{"OTHER", "  -\n    name: foo\n    id: fooidididididididididididididid1\n", `cannot list the same snap "foo" multiple times`},
+		{"OTHER", "  -\n    name: foo2\n    id: fooidididididididididididididid1\n", `cannot specify the same snap id "fooidididididididididididididid1" multiple times, specified for snaps "foo" and "foo2"`},
+		{"presence: optional\n", "presence:\n      - opt\n", `"presence" of snap "baz-linux" must be a string`},
+		{"presence: optional\n", "presence: no\n", `"presence" of snap "baz-linux" must be one of required\|optional\|invalid`},
+		{"revision: 9\n", "revision: z\n", `"revision" of snap "baz-linux" is not an integer: z`},
+		{"revision: 9\n", "revision: 0\n", `"revision" of snap "baz-linux" must be >=1: 0`},
+		{"presence: invalid\n", "presence: invalid\n    revision: 1\n", `cannot specify revision of snap "bar" at the same time as stating its presence is invalid`},
+		{vss.tsLine, "", `"timestamp" header is mandatory`},
+		{vss.tsLine, "timestamp: \n", `"timestamp" header should not be empty`},
+		{vss.tsLine, "timestamp: 12:30\n", `"timestamp" header is not a RFC3339 date: .*`},
+	}
+
+	for _, test := range invalidTests {
+		invalid := strings.Replace(encoded, test.original, test.invalid, 1)
+		invalid = strings.Replace(invalid, "OTHER", "", 1)
+		_, err := asserts.Decode([]byte(invalid))
+		c.Check(err, ErrorMatches, validationSetErrPrefix+test.expectedErr)
+	}
+}
+
+func (vss *validationSetSuite) TestIsValidValidationSetName(c *C) {
+	for _, name := range []string{"a", "baz-3000-good", "set1", "0x"} {
+		c.Check(asserts.IsValidValidationSetName(name), Equals, true, Commentf("%q", name))
+	}
+	for _, name := range []string{"", "-a", "a-", "a--b", "Set", "a_b", "a/b"} {
+		c.Check(asserts.IsValidValidationSetName(name), Equals, false, Commentf("%q", name))
+	}
+}
+
+func (vss *validationSetSuite) makeHeaders(overrides map[string]interface{}) map[string]interface{} {
+	headers := map[string]interface{}{
+		"authority-id": "brand-id1",
+		"series":       "16",
+		"account-id":   "brand-id1",
+		"name":         "baz-3000-good",
+		"sequence":     "2",
+		"snaps": []interface{}{
+			map[string]interface{}{
+				"name":     "foo",
+				"id":       "fooidididididididididididididid1",
+				"revision": "1",
+			},
+		},
+		"timestamp": time.Now().Format(time.RFC3339),
+	}
+	for k, v := range overrides {
+		headers[k] = v
+	}
+	return headers
+}
+
+func (vss *validationSetSuite) TestValidationSetCheck(c *C) {
+	storeDB, db := makeStoreAndCheckDB(c)
+	brandDB := setup3rdPartySigning(c, "brand-id1", storeDB, db)
+
+	headers := vss.makeHeaders(nil)
+	valset, err := brandDB.Sign(asserts.ValidationSetType, headers, nil, "")
+	c.Assert(err, IsNil)
+
+	err = db.Check(valset)
+	c.Assert(err, IsNil)
+}
+
+func (vss *validationSetSuite) TestPrerequisites(c *C) {
+	encoded := strings.Replace(validationSetExample, "TSLINE", vss.tsLine, 1)
+	encoded = strings.Replace(encoded, "OTHER", "", 1)
+
+	a, err := asserts.Decode([]byte(encoded))
+	c.Assert(err, IsNil)
+
+	prereqs := a.Prerequisites()
+	c.Assert(prereqs, HasLen, 1)
+	c.Check(prereqs[0], DeepEquals, &asserts.Ref{
+		Type:       asserts.AccountType,
+		PrimaryKey: []string{"brand-id1"},
+	})
+}
@@ -0,0 +1,229 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package boot
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/bootloader"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+)
+
+// AssetsUpdateStatus is the status of a tracked update of the boot
+// assets of the gadget.
+type AssetsUpdateStatus string
+
+const (
+	// AssetsUpdatePending is the status of an update waiting for the
+	// reboot that will put the updated assets in use.
+	AssetsUpdatePending AssetsUpdateStatus = "pending"
+	// AssetsUpdateSucceeded is the status of an update with which
+	// the system booted successfully.
+	AssetsUpdateSucceeded AssetsUpdateStatus = "succeeded"
+	// AssetsUpdateFailed is the status of an update with which the
+	// system did not boot successfully, the bootloader fell back to
+	// the previous boot instead.
+	AssetsUpdateFailed AssetsUpdateStatus = "failed"
+)
+
+// AssetsUpdate describes an update of the boot assets of the gadget,
+// which is tracked across the reboot needed to use them so that it can
+// be rolled back if the system cannot boot with them.
+type AssetsUpdate struct {
+	// Gadget is the name of the gadget snap.
+	Gadget string `json:"gadget"`
+	// FromRevision and ToRevision are the revisions of the gadget
+	// before and after the update.
+	FromRevision snap.Revision `json:"from-revision"`
+	ToRevision   snap.Revision `json:"to-revision"`
+	// RollbackDir holds the backup of the assets before the update.
+	RollbackDir string `json:"rollback-dir"`
+	// Hashes are the SHA3-384 hashes of the files in the rollback
+	// directory, by path relative to it.
+	Hashes map[string]string `json:"hashes,omitempty"`
+	// BootID is the ID of the boot during which the update was done.
+	BootID string `json:"boot-id"`
+
+	Status AssetsUpdateStatus `json:"status"`
+}
+
+func assetsUpdateFile() string {
+	return filepath.Join(dirs.SnapBootAssetsDir, "update.json")
+}
+
+func hashRollbackDir(rollbackDir string) (map[string]string, error) {
+	hashes := make(map[string]string)
+	err := filepath.Walk(rollbackDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		digest, _, err := osutil.FileDigest(path, crypto.SHA3_384)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(rollbackDir, path)
+		if err != nil {
+			return err
+		}
+		hashes[rel] = fmt.Sprintf("%x", digest)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+func writeAssetsUpdate(upd *AssetsUpdate) error {
+	if err := os.MkdirAll(dirs.SnapBootAssetsDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(upd)
+	if err != nil {
+		return err
+	}
+	return osutil.AtomicWriteFile(assetsUpdateFile(), data, 0644, 0)
+}
+
+// TrackAssetsUpdate starts tracking the update of the boot assets of
+// the given gadget, whose previous assets were backed up in the given
+// rollback directory. The hashes of the backed up assets are recorded
+// and the bootloader is set up to try the next boot, so that a failure
+// to boot with the updated assets can be detected by
+// MarkBootSuccessful.
+func TrackAssetsUpdate(gadget string, fromRev, toRev snap.Revision, rollbackDir string) error {
+	hashes, err := hashRollbackDir(rollbackDir)
+	if err != nil {
+		return fmt.Errorf("cannot hash boot assets backup: %v", err)
+	}
+	bootID, err := osutil.BootID()
+	if err != nil {
+		return err
+	}
+
+	bl, err := bootloader.Find("", nil)
+	if err != nil {
+		return fmt.Errorf("cannot track boot assets update: %s", err)
+	}
+	m, err := bl.GetBootVars("snap_mode")
+	if err != nil {
+		return err
+	}
+	// the mode may already be set for trying a new kernel or base
+	if m["snap_mode"] == "" {
+		if err := bl.SetBootVars(map[string]string{"snap_mode": "try"}); err != nil {
+			return err
+		}
+	}
+
+	return writeAssetsUpdate(&AssetsUpdate{
+		Gadget:       gadget,
+		FromRevision: fromRev,
+		ToRevision:   toRev,
+		RollbackDir:  rollbackDir,
+		Hashes:       hashes,
+		BootID:       bootID,
+		Status:       AssetsUpdatePending,
+	})
+}
+
+// TrackedAssetsUpdate returns the tracked update of the boot assets of
+// the gadget, or nil if there is none.
+func TrackedAssetsUpdate() (*AssetsUpdate, error) {
+	data, err := ioutil.ReadFile(assetsUpdateFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var upd AssetsUpdate
+	if err := json.Unmarshal(data, &upd); err != nil {
+		return nil, fmt.Errorf("cannot decode boot assets update: %v", err)
+	}
+	return &upd, nil
+}
+
+// ClearAssetsUpdate stops tracking the update of the boot assets of the
+// gadget.
+func ClearAssetsUpdate() error {
+	if err := os.Remove(assetsUpdateFile()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// VerifyBackup checks that the backed up assets in the rollback
+// directory still match the hashes recorded when the update was done.
+func (upd *AssetsUpdate) VerifyBackup() error {
+	hashes, err := hashRollbackDir(upd.RollbackDir)
+	if err != nil {
+		return fmt.Errorf("cannot hash boot assets backup: %v", err)
+	}
+	for path, hash := range upd.Hashes {
+		if hashes[path] != hash {
+			return fmt.Errorf("boot assets backup file %q has changed", path)
+		}
+	}
+	for path := range hashes {
+		if _, ok := upd.Hashes[path]; !ok {
+			return fmt.Errorf("unexpected boot assets backup file %q", path)
+		}
+	}
+	return nil
+}
+
+// markAssetsUpdate settles the status of a pending update of the boot
+// assets once the system rebooted, given the snap_mode seen by
+// MarkBootSuccessful: the bootloader only leaves it as "trying" when
+// booting with the updated assets worked.
+func markAssetsUpdate(mode string) error {
+	upd, err := TrackedAssetsUpdate()
+	if err != nil {
+		return err
+	}
+	if upd == nil || upd.Status != AssetsUpdatePending {
+		return nil
+	}
+	bootID, err := osutil.BootID()
+	if err != nil {
+		return err
+	}
+	if upd.BootID == bootID {
+		// not rebooted yet
+		return nil
+	}
+	if mode == "trying" {
+		upd.Status = AssetsUpdateSucceeded
+	} else {
+		upd.Status = AssetsUpdateFailed
+	}
+	return writeAssetsUpdate(upd)
+}
@@ -0,0 +1,167 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package boot_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+)
+
+func (s *bootSetSuite) makeRollbackDir(c *C) string {
+	rollbackDir := filepath.Join(dirs.SnapRollbackDir, "pc_2")
+	c.Assert(os.MkdirAll(filepath.Join(rollbackDir, "EFI"), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(rollbackDir, "EFI", "grubx64.efi.backup"), []byte("old grub"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(rollbackDir, "mbr.img.backup"), []byte("old mbr"), 0644), IsNil)
+	return rollbackDir
+}
+
+func (s *bootSetSuite) TestTrackAssetsUpdate(c *C) {
+	rollbackDir := s.makeRollbackDir(c)
+
+	upd, err := boot.TrackedAssetsUpdate()
+	c.Assert(err, IsNil)
+	c.Check(upd, IsNil)
+
+	err = boot.TrackAssetsUpdate("pc", snap.R(1), snap.R(2), rollbackDir)
+	c.Assert(err, IsNil)
+	c.Check(s.bootloader.BootVars, DeepEquals, map[string]string{"snap_mode": "try"})
+
+	bootID, err := osutil.BootID()
+	c.Assert(err, IsNil)
+	upd, err = boot.TrackedAssetsUpdate()
+	c.Assert(err, IsNil)
+	c.Check(upd, DeepEquals, &boot.AssetsUpdate{
+		Gadget:       "pc",
+		FromRevision: snap.R(1),
+		ToRevision:   snap.R(2),
+		RollbackDir:  rollbackDir,
+		Hashes: map[string]string{
+			"EFI/grubx64.efi.backup": "b311c58ce18150412c7bae2341e6ca23df377e2c81b172c3b1478f9e2b9e1a7d67fba25acbe6802245af2621de0cc4dc",
+			"mbr.img.backup":         "6b91ac16dcd6b34a79ba7a41f33094d4eabd5fcbecffec114f2f41a58e99be055d73e39bc0c557bdcc73571d0f17e31d",
+		},
+		BootID: bootID,
+		Status: boot.AssetsUpdatePending,
+	})
+	c.Check(upd.VerifyBackup(), IsNil)
+
+	c.Assert(boot.ClearAssetsUpdate(), IsNil)
+	upd, err = boot.TrackedAssetsUpdate()
+	c.Assert(err, IsNil)
+	c.Check(upd, IsNil)
+	// clearing again is fine
+	c.Assert(boot.ClearAssetsUpdate(), IsNil)
+}
+
+func (s *bootSetSuite) TestTrackAssetsUpdateAlreadyTrying(c *C) {
+	rollbackDir := s.makeRollbackDir(c)
+	s.bootloader.BootVars["snap_mode"] = "try"
+	s.bootloader.BootVars["snap_try_kernel"] = "pc-kernel_2.snap"
+
+	err := boot.TrackAssetsUpdate("pc", snap.R(1), snap.R(2), rollbackDir)
+	c.Assert(err, IsNil)
+	c.Check(s.bootloader.BootVars, DeepEquals, map[string]string{
+		"snap_mode":       "try",
+		"snap_try_kernel": "pc-kernel_2.snap",
+	})
+}
+
+func (s *bootSetSuite) TestVerifyBackup(c *C) {
+	rollbackDir := s.makeRollbackDir(c)
+	err := boot.TrackAssetsUpdate("pc", snap.R(1), snap.R(2), rollbackDir)
+	c.Assert(err, IsNil)
+	upd, err := boot.TrackedAssetsUpdate()
+	c.Assert(err, IsNil)
+
+	c.Assert(ioutil.WriteFile(filepath.Join(rollbackDir, "mbr.img.backup"), []byte("changed"), 0644), IsNil)
+	c.Check(upd.VerifyBackup(), ErrorMatches, `boot assets backup file "mbr.img.backup" has changed`)
+
+	c.Assert(os.Remove(filepath.Join(rollbackDir, "mbr.img.backup")), IsNil)
+	c.Check(upd.VerifyBackup(), ErrorMatches, `boot assets backup file "mbr.img.backup" has changed`)
+
+	s.makeRollbackDir(c)
+	c.Assert(ioutil.WriteFile(filepath.Join(rollbackDir, "extra.backup"), nil, 0644), IsNil)
+	c.Check(upd.VerifyBackup(), ErrorMatches, `unexpected boot assets backup file "extra.backup"`)
+}
+
+func (s *bootSetSuite) testMarkBootSuccessfulAssetsUpdate(c *C, bootID, mode string, expected boot.AssetsUpdateStatus) {
+	err := boot.WriteAssetsUpdate(&boot.AssetsUpdate{
+		Gadget:       "pc",
+		FromRevision: snap.R(1),
+		ToRevision:   snap.R(2),
+		RollbackDir:  "/rollback",
+		BootID:       bootID,
+		Status:       boot.AssetsUpdatePending,
+	})
+	c.Assert(err, IsNil)
+	s.bootloader.BootVars["snap_mode"] = mode
+
+	err = boot.MarkBootSuccessful()
+	c.Assert(err, IsNil)
+	c.Check(s.bootloader.BootVars["snap_mode"], Equals, "")
+
+	upd, err := boot.TrackedAssetsUpdate()
+	c.Assert(err, IsNil)
+	c.Check(upd.Status, Equals, expected)
+
+	// settled, not changed again
+	s.bootloader.BootVars["snap_mode"] = "trying"
+	err = boot.MarkBootSuccessful()
+	c.Assert(err, IsNil)
+	upd, err = boot.TrackedAssetsUpdate()
+	c.Assert(err, IsNil)
+	c.Check(upd.Status, Equals, expected)
+}
+
+func (s *bootSetSuite) TestMarkBootSuccessfulAssetsUpdateSucceeded(c *C) {
+	s.testMarkBootSuccessfulAssetsUpdate(c, "other-boot-id", "trying", boot.AssetsUpdateSucceeded)
+}
+
+func (s *bootSetSuite) TestMarkBootSuccessfulAssetsUpdateFailed(c *C) {
+	// the bootloader reset the mode after failing to boot
+	s.testMarkBootSuccessfulAssetsUpdate(c, "other-boot-id", "", boot.AssetsUpdateFailed)
+}
+
+func (s *bootSetSuite) TestMarkBootSuccessfulAssetsUpdateNotRebooted(c *C) {
+	bootID, err := osutil.BootID()
+	c.Assert(err, IsNil)
+	err = boot.WriteAssetsUpdate(&boot.AssetsUpdate{
+		Gadget: "pc",
+		BootID: bootID,
+		Status: boot.AssetsUpdatePending,
+	})
+	c.Assert(err, IsNil)
+	s.bootloader.BootVars["snap_mode"] = "try"
+
+	err = boot.MarkBootSuccessful()
+	c.Assert(err, IsNil)
+	c.Check(s.bootloader.BootVars["snap_mode"], Equals, "try")
+
+	upd, err := boot.TrackedAssetsUpdate()
+	c.Assert(err, IsNil)
+	c.Check(upd.Status, Equals, boot.AssetsUpdatePending)
+}
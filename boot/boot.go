@@ -246,6 +246,9 @@ func nameAndRevnoFromSnap(sn string) (*NameAndRevision, error) {
 //   means snapd did not start successfully. In this case the bootloader
 //   will set snap_mode="" and the system will boot with the known good
 //   values from snap_{core,kernel}
+//
+// A pending update of the boot assets of the gadget, tracked with
+// TrackAssetsUpdate, is marked as succeeded or failed accordingly.
 func MarkBootSuccessful() error {
 	bl, err := bootloader.Find("", nil)
 	if err != nil {
@@ -256,6 +259,12 @@ func MarkBootSuccessful() error {
 		return err
 	}
 
+	// a pending update of the boot assets of the gadget succeeded
+	// only if the bootloader left the mode as "trying"
+	if err := markAssetsUpdate(m["snap_mode"]); err != nil {
+		return fmt.Errorf("cannot mark boot assets update: %v", err)
+	}
+
 	// snap_mode goes from "" -> "try" -> "trying" -> ""
 	// so if we are not in "trying" mode, nothing to do here
 	if m["snap_mode"] != "trying" {
@@ -20,11 +20,13 @@
 package boot
 
 import (
+	"github.com/snapcore/snapd/secboot"
 	"github.com/snapcore/snapd/snap"
 )
 
 var (
 	NameAndRevnoFromSnap = nameAndRevnoFromSnap
+	WriteAssetsUpdate    = writeAssetsUpdate
 )
 
 func NewCoreBootParticipant(s snap.PlaceInfo, t snap.Type) *coreBootParticipant {
@@ -36,3 +38,35 @@ func NewCoreKernel(s snap.PlaceInfo) *coreKernel {
 }
 
 type Trivial = trivial
+
+func MockSecbootSealKey(f func(key secboot.EncryptionKey, dir string, chains ...secboot.BootChain) error) (restore func()) {
+	old := secbootSealKey
+	secbootSealKey = f
+	return func() {
+		secbootSealKey = old
+	}
+}
+
+func MockSecbootGrubMeasurements(f func() ([]secboot.GrubMeasurement, error)) (restore func()) {
+	old := secbootGrubMeasurements
+	secbootGrubMeasurements = f
+	return func() {
+		secbootGrubMeasurements = old
+	}
+}
+
+func MockSnapOpen(f func(path string) (snap.Container, error)) (restore func()) {
+	old := snapOpen
+	snapOpen = f
+	return func() {
+		snapOpen = old
+	}
+}
+
+func MockSecbootKeyFromKeyring(f func() (secboot.EncryptionKey, error)) (restore func()) {
+	old := secbootKeyFromKeyring
+	secbootKeyFromKeyring = f
+	return func() {
+		secbootKeyFromKeyring = old
+	}
+}
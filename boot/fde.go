@@ -0,0 +1,197 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package boot
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/snapcore/snapd/bootloader"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/secboot"
+	"github.com/snapcore/snapd/snap"
+)
+
+var (
+	secbootSealKey          = secboot.SealKey
+	secbootKeyFromKeyring   = secboot.KeyFromKeyring
+	secbootGrubMeasurements = secboot.GrubMeasurements
+
+	snapOpen = snap.Open
+)
+
+// HasEncryptedData returns whether the data partition of the system is
+// encrypted with a key sealed to the TPM.
+func HasEncryptedData() bool {
+	return secboot.HasSealedKey(dirs.SnapFDEDir)
+}
+
+// BootChain returns the chain of measurements grub makes when booting
+// the kernel snap at kernelPath with the given grub configuration. It
+// follows the measurements grub made when booting the running system,
+// as recorded in the boot event log, with those of the grub
+// configuration that loaded the kernel, of the kernel snap and of its
+// kernel and initrd images replaced.
+func BootChain(grubCfg []byte, kernelPath string) (secboot.BootChain, error) {
+	measurements, err := secbootGrubMeasurements()
+	if err != nil {
+		return nil, err
+	}
+	snapf, err := snapOpen(kernelPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// a first stage grub.cfg can hand over to another one
+	cfgIdx := -1
+	for i, m := range measurements {
+		if path.Base(m.Path) == "grub.cfg" {
+			cfgIdx = i
+		}
+	}
+	if cfgIdx < 0 {
+		return nil, fmt.Errorf("cannot find the measurement of grub.cfg in the boot event log")
+	}
+
+	chain := make(secboot.BootChain, len(measurements))
+	found := make(map[string]bool)
+	for i, m := range measurements {
+		digest := m.Digest
+		switch name := path.Base(m.Path); {
+		case i == cfgIdx:
+			d := sha256.Sum256(grubCfg)
+			digest = d[:]
+		case name == "kernel.img" || name == "initrd.img":
+			content, err := snapf.ReadFile(name)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read %s from kernel snap: %v", name, err)
+			}
+			d := sha256.Sum256(content)
+			digest = d[:]
+			found[name] = true
+		case strings.HasSuffix(name, ".snap") && i > cfgIdx:
+			// the kernel snap, mounted with loopback
+			digest, _, err = osutil.FileDigest(kernelPath, crypto.SHA256)
+			if err != nil {
+				return nil, fmt.Errorf("cannot measure kernel snap: %v", err)
+			}
+		}
+		chain[i] = digest
+	}
+	for _, name := range []string{"kernel.img", "initrd.img"} {
+		if !found[name] {
+			return nil, fmt.Errorf("cannot find the measurement of %s in the boot event log", name)
+		}
+	}
+	return chain, nil
+}
+
+// ResealKey reseals the key of the encrypted data partition such that
+// it can be unsealed when booting with any of the given grub
+// configurations and any of the given kernel snaps. The key cannot be
+// unsealed again once the system booted, it is taken from the kernel
+// keyring it was stored in when the data partition was unlocked.
+func ResealKey(grubCfgs [][]byte, kernelPaths []string) error {
+	var chains []secboot.BootChain
+	for _, grubCfg := range grubCfgs {
+		for _, kernelPath := range kernelPaths {
+			chain, err := BootChain(grubCfg, kernelPath)
+			if err != nil {
+				return fmt.Errorf("cannot reseal key: %v", err)
+			}
+			chains = append(chains, chain)
+		}
+	}
+
+	key, err := secbootKeyFromKeyring()
+	if err != nil {
+		return fmt.Errorf("cannot reseal key: %v", err)
+	}
+	return secbootSealKey(key, dirs.SnapFDEDir, chains...)
+}
+
+func grubConfig(bl bootloader.Bootloader) ([]byte, error) {
+	if bl.Name() != "grub" {
+		return nil, fmt.Errorf("cannot use encrypted data with the %s bootloader", bl.Name())
+	}
+	return ioutil.ReadFile(bl.ConfigFile())
+}
+
+// resealKeyForKernels reseals the key of the encrypted data partition
+// to the current boot configuration with any of the given kernel snap
+// files, if the data is encrypted.
+func resealKeyForKernels(bl bootloader.Bootloader, kernels ...string) error {
+	if !HasEncryptedData() {
+		return nil
+	}
+	grubCfg, err := grubConfig(bl)
+	if err != nil {
+		return err
+	}
+	kernelPaths := make([]string, len(kernels))
+	for i, kernel := range kernels {
+		kernelPaths[i] = filepath.Join(dirs.SnapBlobDir, kernel)
+	}
+	return ResealKey([][]byte{grubCfg}, kernelPaths)
+}
+
+// CurrentBootConfig returns the current boot configuration, as needed
+// to reseal the key of the encrypted data partition after the boot
+// assets are updated. It returns nil if the data is not encrypted.
+func CurrentBootConfig() ([]byte, error) {
+	if !HasEncryptedData() {
+		return nil, nil
+	}
+	bl, err := bootloader.Find("", nil)
+	if err != nil {
+		return nil, err
+	}
+	return grubConfig(bl)
+}
+
+// ResealKeyForBootConfig reseals the key of the encrypted data
+// partition, after the boot assets were updated, such that it can be
+// unsealed booting the current kernel with either the given previous
+// boot configuration or the updated one. It does nothing if the data
+// is not encrypted.
+func ResealKeyForBootConfig(oldConfig []byte) error {
+	if !HasEncryptedData() {
+		return nil
+	}
+	bl, err := bootloader.Find("", nil)
+	if err != nil {
+		return err
+	}
+	newConfig, err := grubConfig(bl)
+	if err != nil {
+		return err
+	}
+	m, err := bl.GetBootVars("snap_kernel")
+	if err != nil {
+		return err
+	}
+	return ResealKey([][]byte{oldConfig, newConfig}, []string{filepath.Join(dirs.SnapBlobDir, m["snap_kernel"])})
+}
@@ -0,0 +1,285 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package boot_test
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/bootloader"
+	"github.com/snapcore/snapd/bootloader/bootloadertest"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/secboot"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snapdir"
+	"github.com/snapcore/snapd/snap/snaptest"
+)
+
+type fdeSuite struct {
+	baseBootSetSuite
+
+	bootloader *bootloadertest.MockBootloader
+
+	sealedChains [][]secboot.BootChain
+	sealErr      error
+
+	grubMeasurements []secboot.GrubMeasurement
+}
+
+var _ = Suite(&fdeSuite{})
+
+func mockFDEKey() secboot.EncryptionKey {
+	var key secboot.EncryptionKey
+	copy(key[:], "very secret key")
+	return key
+}
+
+func measurement(path, content string) secboot.GrubMeasurement {
+	digest := sha256.Sum256([]byte(content))
+	return secboot.GrubMeasurement{Path: path, Digest: digest[:]}
+}
+
+func (s *fdeSuite) SetUpTest(c *C) {
+	s.baseBootSetSuite.SetUpTest(c)
+
+	s.bootloader = bootloadertest.Mock("grub", c.MkDir())
+	bootloader.Force(s.bootloader)
+	s.AddCleanup(func() { bootloader.Force(nil) })
+	s.mockBootConfig(c, "grub.cfg v1")
+
+	s.sealedChains = nil
+	s.sealErr = nil
+	// as logged by grub booting the system
+	s.grubMeasurements = []secboot.GrubMeasurement{
+		measurement("(hd0,gpt2)/EFI/BOOT/grub.cfg", "first stage grub.cfg"),
+		measurement("(hd0,gpt2)/EFI/ubuntu/grub.cfg", "grub.cfg v0"),
+		measurement("(hd0,gpt2)/EFI/ubuntu/fonts/unicode.pf2", "font"),
+		measurement("(loop)/kernel.img", "kernel 39"),
+		measurement("(loop)/initrd.img", "initrd of kernel 39"),
+	}
+	s.AddCleanup(boot.MockSecbootGrubMeasurements(func() ([]secboot.GrubMeasurement, error) {
+		return s.grubMeasurements, nil
+	}))
+	s.AddCleanup(boot.MockSecbootKeyFromKeyring(func() (secboot.EncryptionKey, error) {
+		return mockFDEKey(), nil
+	}))
+	s.AddCleanup(boot.MockSecbootSealKey(func(key secboot.EncryptionKey, dir string, chains ...secboot.BootChain) error {
+		c.Check(key, DeepEquals, mockFDEKey())
+		c.Check(dir, Equals, dirs.SnapFDEDir)
+		s.sealedChains = append(s.sealedChains, chains)
+		return s.sealErr
+	}))
+
+	s.mockKernel(c, "krnl_40.snap", "kernel 40")
+	s.mockKernel(c, "krnl_42.snap", "kernel 42")
+}
+
+func (s *fdeSuite) mockBootConfig(c *C, content string) {
+	cfg := s.bootloader.ConfigFile()
+	c.Assert(os.MkdirAll(filepath.Dir(cfg), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(cfg, []byte(content), 0644), IsNil)
+}
+
+func (s *fdeSuite) mockKernel(c *C, name, content string) {
+	snaptest.PopulateDir(filepath.Join(dirs.SnapBlobDir, name), [][]string{
+		{"meta/snap.yaml", packageKernel},
+		{"kernel.img", content},
+		{"initrd.img", "initrd of " + content},
+	})
+}
+
+func (s *fdeSuite) mockEncrypted(c *C) {
+	c.Assert(os.MkdirAll(dirs.SnapFDEDir, 0700), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dirs.SnapFDEDir, "sealed-key-0.pub"), nil, 0600), IsNil)
+}
+
+func (s *fdeSuite) TestBootChain(c *C) {
+	chain, err := boot.BootChain([]byte("grub.cfg v1"), filepath.Join(dirs.SnapBlobDir, "krnl_40.snap"))
+	c.Assert(err, IsNil)
+	// in the order grub measured, only the configuration that loaded
+	// the kernel and the kernel images are replaced
+	c.Check(chain, DeepEquals, secboot.MeasureBootChain(
+		[]byte("first stage grub.cfg"),
+		[]byte("grub.cfg v1"),
+		[]byte("font"),
+		[]byte("kernel 40"),
+		[]byte("initrd of kernel 40"),
+	))
+}
+
+func (s *fdeSuite) TestBootChainEventLogError(c *C) {
+	restore := boot.MockSecbootGrubMeasurements(func() ([]secboot.GrubMeasurement, error) {
+		return nil, errors.New("cannot open boot event log: no such file")
+	})
+	defer restore()
+
+	_, err := boot.BootChain([]byte("grub.cfg v1"), filepath.Join(dirs.SnapBlobDir, "krnl_40.snap"))
+	c.Assert(err, ErrorMatches, "cannot open boot event log: no such file")
+}
+
+func (s *fdeSuite) TestBootChainMissingMeasurement(c *C) {
+	kernel := filepath.Join(dirs.SnapBlobDir, "krnl_40.snap")
+	all := s.grubMeasurements
+
+	s.grubMeasurements = all[2:]
+	_, err := boot.BootChain([]byte("grub.cfg v1"), kernel)
+	c.Assert(err, ErrorMatches, "cannot find the measurement of grub.cfg in the boot event log")
+
+	s.grubMeasurements = all[:4]
+	_, err = boot.BootChain([]byte("grub.cfg v1"), kernel)
+	c.Assert(err, ErrorMatches, "cannot find the measurement of initrd.img in the boot event log")
+}
+
+func (s *fdeSuite) TestBootChainKernelSnap(c *C) {
+	// grub mounting the kernel snap with loopback measures it too
+	s.grubMeasurements = append(s.grubMeasurements[:3], append([]secboot.GrubMeasurement{
+		measurement("(hd0,gpt3)/system-data/var/lib/snapd/snaps/krnl_39.snap", "kernel snap 39"),
+	}, s.grubMeasurements[3:]...)...)
+	kernel := filepath.Join(c.MkDir(), "krnl_40.snap")
+	c.Assert(ioutil.WriteFile(kernel, []byte("kernel snap 40"), 0644), IsNil)
+	restore := boot.MockSnapOpen(func(path string) (snap.Container, error) {
+		c.Check(path, Equals, kernel)
+		return snapdir.New(filepath.Join(dirs.SnapBlobDir, "krnl_40.snap")), nil
+	})
+	defer restore()
+
+	chain, err := boot.BootChain([]byte("grub.cfg v1"), kernel)
+	c.Assert(err, IsNil)
+	c.Check(chain, DeepEquals, secboot.MeasureBootChain(
+		[]byte("first stage grub.cfg"),
+		[]byte("grub.cfg v1"),
+		[]byte("font"),
+		[]byte("kernel snap 40"),
+		[]byte("kernel 40"),
+		[]byte("initrd of kernel 40"),
+	))
+}
+
+func (s *fdeSuite) TestBootChainMissingImage(c *C) {
+	kernel := filepath.Join(dirs.SnapBlobDir, "krnl_40.snap")
+	c.Assert(os.Remove(filepath.Join(kernel, "initrd.img")), IsNil)
+
+	_, err := boot.BootChain([]byte("grub.cfg v1"), kernel)
+	c.Assert(err, ErrorMatches, "cannot read initrd.img from kernel snap: .*")
+}
+
+func (s *fdeSuite) TestHasEncryptedData(c *C) {
+	c.Check(boot.HasEncryptedData(), Equals, false)
+	s.mockEncrypted(c)
+	c.Check(boot.HasEncryptedData(), Equals, true)
+}
+
+func (s *fdeSuite) TestSetNextBootForKernelReseals(c *C) {
+	s.mockEncrypted(c)
+	s.bootloader.BootVars["snap_kernel"] = "krnl_40.snap"
+
+	bp := boot.NewCoreBootParticipant(snap.MinimalPlaceInfo("krnl", snap.R(42)), snap.TypeKernel)
+	err := bp.SetNextBoot()
+	c.Assert(err, IsNil)
+
+	chain40, err := boot.BootChain([]byte("grub.cfg v1"), filepath.Join(dirs.SnapBlobDir, "krnl_40.snap"))
+	c.Assert(err, IsNil)
+	chain42, err := boot.BootChain([]byte("grub.cfg v1"), filepath.Join(dirs.SnapBlobDir, "krnl_42.snap"))
+	c.Assert(err, IsNil)
+	c.Check(s.sealedChains, DeepEquals, [][]secboot.BootChain{{chain40, chain42}})
+	c.Check(s.bootloader.BootVars["snap_try_kernel"], Equals, "krnl_42.snap")
+}
+
+func (s *fdeSuite) TestSetNextBootForKernelResealError(c *C) {
+	s.mockEncrypted(c)
+	s.bootloader.BootVars["snap_kernel"] = "krnl_40.snap"
+	s.sealErr = errors.New("cannot seal key: boom")
+
+	bp := boot.NewCoreBootParticipant(snap.MinimalPlaceInfo("krnl", snap.R(42)), snap.TypeKernel)
+	err := bp.SetNextBoot()
+	c.Assert(err, ErrorMatches, "cannot set next boot: cannot seal key: boom")
+	// the new kernel would not be able to unlock the data
+	c.Check(s.bootloader.BootVars["snap_try_kernel"], Equals, "")
+	c.Check(s.bootloader.BootVars["snap_mode"], Equals, "")
+}
+
+func (s *fdeSuite) TestSetNextBootForKernelNotEncrypted(c *C) {
+	s.bootloader.BootVars["snap_kernel"] = "krnl_40.snap"
+
+	bp := boot.NewCoreBootParticipant(snap.MinimalPlaceInfo("krnl", snap.R(42)), snap.TypeKernel)
+	err := bp.SetNextBoot()
+	c.Assert(err, IsNil)
+	c.Check(s.sealedChains, HasLen, 0)
+	c.Check(s.bootloader.BootVars["snap_try_kernel"], Equals, "krnl_42.snap")
+}
+
+func (s *fdeSuite) TestSetNextBootForKernelEncryptedUnsupportedBootloader(c *C) {
+	s.mockEncrypted(c)
+	ubl := bootloadertest.Mock("mock", c.MkDir())
+	bootloader.Force(ubl)
+
+	bp := boot.NewCoreBootParticipant(snap.MinimalPlaceInfo("krnl", snap.R(42)), snap.TypeKernel)
+	err := bp.SetNextBoot()
+	c.Assert(err, ErrorMatches, "cannot set next boot: cannot use encrypted data with the mock bootloader")
+}
+
+func (s *fdeSuite) TestResealKeyForBootConfig(c *C) {
+	s.mockEncrypted(c)
+	s.bootloader.BootVars["snap_kernel"] = "krnl_40.snap"
+
+	oldConfig, err := boot.CurrentBootConfig()
+	c.Assert(err, IsNil)
+	c.Check(string(oldConfig), Equals, "grub.cfg v1")
+
+	// the boot assets get updated
+	s.mockBootConfig(c, "grub.cfg v2")
+
+	err = boot.ResealKeyForBootConfig(oldConfig)
+	c.Assert(err, IsNil)
+
+	kernel := filepath.Join(dirs.SnapBlobDir, "krnl_40.snap")
+	chainOld, err := boot.BootChain([]byte("grub.cfg v1"), kernel)
+	c.Assert(err, IsNil)
+	chainNew, err := boot.BootChain([]byte("grub.cfg v2"), kernel)
+	c.Assert(err, IsNil)
+	c.Check(s.sealedChains, DeepEquals, [][]secboot.BootChain{{chainOld, chainNew}})
+}
+
+func (s *fdeSuite) TestResealKeyForBootConfigNotEncrypted(c *C) {
+	oldConfig, err := boot.CurrentBootConfig()
+	c.Assert(err, IsNil)
+	c.Check(oldConfig, IsNil)
+
+	err = boot.ResealKeyForBootConfig(oldConfig)
+	c.Assert(err, IsNil)
+	c.Check(s.sealedChains, HasLen, 0)
+}
+
+func (s *fdeSuite) TestResealKeyNotInKeyring(c *C) {
+	restore := boot.MockSecbootKeyFromKeyring(func() (secboot.EncryptionKey, error) {
+		return secboot.EncryptionKey{}, errors.New("cannot find key in the kernel keyring: required key not available")
+	})
+	defer restore()
+
+	err := boot.ResealKey([][]byte{[]byte("grub.cfg v1")}, []string{filepath.Join(dirs.SnapBlobDir, "krnl_40.snap")})
+	c.Assert(err, ErrorMatches, "cannot reseal key: cannot find key in the kernel keyring: required key not available")
+	c.Check(s.sealedChains, HasLen, 0)
+}
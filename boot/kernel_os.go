@@ -76,6 +76,14 @@ func (bs *coreBootParticipant) SetNextBoot() error {
 		return nil
 	}
 
+	if bs.t == snap.TypeKernel {
+		// the key of the encrypted data must be unsealable when
+		// booting either the current or the new kernel
+		if err := resealKeyForKernels(bootloader, m[goodBoot], blobName); err != nil {
+			return fmt.Errorf("cannot set next boot: %v", err)
+		}
+	}
+
 	return bootloader.SetBootVars(map[string]string{
 		nextBoot:    blobName,
 		"snap_mode": "try",
@@ -30,6 +30,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/snapcore/snapd/snap"
 )
 
 // AppActivator is a thing that activates the app that is a service in the
@@ -44,14 +46,15 @@ type AppActivator struct {
 
 // AppInfo describes a single snap application.
 type AppInfo struct {
-	Snap        string         `json:"snap,omitempty"`
-	Name        string         `json:"name"`
-	DesktopFile string         `json:"desktop-file,omitempty"`
-	Daemon      string         `json:"daemon,omitempty"`
-	Enabled     bool           `json:"enabled,omitempty"`
-	Active      bool           `json:"active,omitempty"`
-	CommonID    string         `json:"common-id,omitempty"`
-	Activators  []AppActivator `json:"activators,omitempty"`
+	Snap        string           `json:"snap,omitempty"`
+	Name        string           `json:"name"`
+	DesktopFile string           `json:"desktop-file,omitempty"`
+	Daemon      string           `json:"daemon,omitempty"`
+	DaemonScope snap.DaemonScope `json:"daemon-scope,omitempty"`
+	Enabled     bool             `json:"enabled,omitempty"`
+	Active      bool             `json:"active,omitempty"`
+	CommonID    string           `json:"common-id,omitempty"`
+	Activators  []AppActivator   `json:"activators,omitempty"`
 }
 
 // IsService returns true if the application is a background daemon.
@@ -239,6 +242,8 @@ type RestartOptions struct {
 	// Reload the services, if possible (i.e. if the App has a
 	// ReloadCommand, invoque it), instead of restarting.
 	Reload bool `json:"reload,omitempty"`
+
+	ScheduleOptions
 }
 
 // Restart services.
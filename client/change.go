@@ -39,10 +39,22 @@ type Change struct {
 
 	SpawnTime time.Time `json:"spawn-time,omitempty"`
 	ReadyTime time.Time `json:"ready-time,omitempty"`
+	// ScheduledTime is the time the change was scheduled to start at, if any
+	ScheduledTime time.Time `json:"scheduled-time,omitempty"`
 
 	data map[string]*json.RawMessage
 }
 
+// ScheduleOptions ask for a change to be started later instead of right
+// away. At most one of them can be set.
+type ScheduleOptions struct {
+	// At is the time to start the change at.
+	At *time.Time `json:"at,omitempty"`
+	// Window is a schedule, in the format of refresh.timer, at the next
+	// opening of which the change is started.
+	Window string `json:"window,omitempty"`
+}
+
 var ErrNoData = fmt.Errorf("data entry not found")
 
 // Get unmarshals into value the kind-specific data with the provided key.
@@ -0,0 +1,128 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// A Notice records an occurrence of a system event, such as a change
+// being updated or a snap being installed. Notices of the same type
+// and key are aggregated, keeping track of the number of occurrences
+// and of the data associated with the last one.
+type Notice struct {
+	ID            string            `json:"id"`
+	Type          string            `json:"type"`
+	Key           string            `json:"key"`
+	FirstOccurred time.Time         `json:"first-occurred"`
+	LastOccurred  time.Time         `json:"last-occurred"`
+	Occurrences   int               `json:"occurrences"`
+	LastData      map[string]string `json:"last-data,omitempty"`
+	ExpireAfter   time.Duration     `json:"expire-after,omitempty"`
+}
+
+type jsonNotice struct {
+	Notice
+	ExpireAfter string `json:"expire-after,omitempty"`
+}
+
+// NoticesOptions contains options for querying snapd for notices
+// supported options:
+// - Types: only return notices of these types.
+// - Keys: only return notices with these keys.
+// - After: only return notices that last occurred after this time.
+type NoticesOptions struct {
+	Types []string
+	Keys  []string
+	After time.Time
+}
+
+func (opts *NoticesOptions) query() url.Values {
+	q := make(url.Values)
+	if opts == nil {
+		return q
+	}
+	if len(opts.Types) > 0 {
+		q.Set("types", strings.Join(opts.Types, ","))
+	}
+	if len(opts.Keys) > 0 {
+		q.Set("keys", strings.Join(opts.Keys, ","))
+	}
+	if !opts.After.IsZero() {
+		q.Set("after", opts.After.Format(time.RFC3339Nano))
+	}
+	return q
+}
+
+func decodeNotices(raw json.RawMessage) ([]*Notice, error) {
+	var jns []*jsonNotice
+	if err := json.Unmarshal(raw, &jns); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal: %v", err)
+	}
+	ns := make([]*Notice, len(jns))
+	for i, jn := range jns {
+		ns[i] = &jn.Notice
+		ns[i].ExpireAfter, _ = time.ParseDuration(jn.ExpireAfter)
+	}
+	return ns, nil
+}
+
+// Notices returns the notices that match the given options.
+func (client *Client) Notices(opts *NoticesOptions) ([]*Notice, error) {
+	var raw json.RawMessage
+	if _, err := client.doSync("GET", "/v2/notices", opts.query(), nil, nil, &raw); err != nil {
+		return nil, err
+	}
+	return decodeNotices(raw)
+}
+
+// WaitNotices returns the notices that match the given options,
+// waiting up to serverTimeout for at least one to occur if none
+// exist yet. An empty list is returned if none occurred in that
+// time. The request can be canceled via the context.
+func (client *Client) WaitNotices(ctx context.Context, serverTimeout time.Duration, opts *NoticesOptions) ([]*Notice, error) {
+	q := opts.query()
+	q.Set("timeout", serverTimeout.String())
+
+	// the request can take longer than the usual timeout of
+	// do(), so go through raw() with the caller's context
+	res, err := client.raw(ctx, "GET", "/v2/notices", q, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var rsp response
+	if err := decodeInto(res.Body, &rsp); err != nil {
+		return nil, err
+	}
+	if err := rsp.err(client, res.StatusCode); err != nil {
+		return nil, err
+	}
+	if rsp.Type != "sync" {
+		return nil, fmt.Errorf("expected sync response, got %q", rsp.Type)
+	}
+	return decodeNotices(rsp.Result)
+}
@@ -0,0 +1,120 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+)
+
+const noticesResponse = `{
+	"result": [
+	    {
+		"id": "3",
+		"type": "snap-installed",
+		"key": "foo",
+		"first-occurred": "2020-09-19T12:41:18.505007495Z",
+		"last-occurred": "2020-09-19T12:44:19.680362867Z",
+		"occurrences": 2,
+		"last-data": {"revision": "7"},
+		"expire-after": "168h0m0s"
+	    }
+	],
+	"status": "OK",
+	"status-code": 200,
+	"type": "sync"
+}`
+
+var expectedNotices = []*client.Notice{{
+	ID:            "3",
+	Type:          "snap-installed",
+	Key:           "foo",
+	FirstOccurred: time.Date(2020, 9, 19, 12, 41, 18, 505007495, time.UTC),
+	LastOccurred:  time.Date(2020, 9, 19, 12, 44, 19, 680362867, time.UTC),
+	Occurrences:   2,
+	LastData:      map[string]string{"revision": "7"},
+	ExpireAfter:   7 * 24 * time.Hour,
+}}
+
+func (cs *clientSuite) TestNotices(c *check.C) {
+	cs.rsp = noticesResponse
+
+	notices, err := cs.cli.Notices(nil)
+	c.Assert(err, check.IsNil)
+	c.Check(notices, check.DeepEquals, expectedNotices)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/notices")
+	c.Check(cs.req.URL.Query(), check.HasLen, 0)
+}
+
+func (cs *clientSuite) TestNoticesFilters(c *check.C) {
+	cs.rsp = `{"type": "sync", "status-code": 200, "result": []}`
+
+	after := time.Date(2020, 9, 19, 12, 41, 18, 505007495, time.UTC)
+	notices, err := cs.cli.Notices(&client.NoticesOptions{
+		Types: []string{"snap-installed", "snap-removed"},
+		Keys:  []string{"foo", "bar"},
+		After: after,
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(notices, check.HasLen, 0)
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{
+		"types": {"snap-installed,snap-removed"},
+		"keys":  {"foo,bar"},
+		"after": {"2020-09-19T12:41:18.505007495Z"},
+	})
+}
+
+func (cs *clientSuite) TestNoticesError(c *check.C) {
+	cs.status = 400
+	cs.rsp = `{"type": "error", "status-code": 400, "result": {"message": "invalid notice type \"foo\""}}`
+
+	_, err := cs.cli.Notices(&client.NoticesOptions{Types: []string{"foo"}})
+	c.Check(err, check.ErrorMatches, `invalid notice type "foo"`)
+}
+
+func (cs *clientSuite) TestWaitNotices(c *check.C) {
+	cs.rsp = noticesResponse
+
+	notices, err := cs.cli.WaitNotices(context.Background(), time.Minute, &client.NoticesOptions{
+		Types: []string{"snap-installed"},
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(notices, check.DeepEquals, expectedNotices)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/notices")
+	c.Check(cs.req.URL.Query(), check.DeepEquals, url.Values{
+		"types":   {"snap-installed"},
+		"timeout": {"1m0s"},
+	})
+}
+
+func (cs *clientSuite) TestWaitNoticesError(c *check.C) {
+	cs.status = 400
+	cs.rsp = `{"type": "error", "status-code": 400, "result": {"message": "invalid timeout \"1h0m0s\": must be between 0 and 10m0s"}}`
+
+	_, err := cs.cli.WaitNotices(context.Background(), time.Hour, nil)
+	c.Check(err, check.ErrorMatches, `invalid timeout "1h0m0s": must be between 0 and 10m0s`)
+}
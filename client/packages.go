@@ -65,6 +65,8 @@ type Snap struct {
 	MountedFrom      string        `json:"mounted-from,omitempty"`
 	CohortKey        string        `json:"cohort-key,omitempty"`
 	Website          string        `json:"website,omitempty"`
+	// RefreshHold is set when automatic refreshes of the snap are held.
+	RefreshHold *time.Time `json:"refresh-hold,omitempty"`
 
 	Prices      map[string]float64    `json:"prices,omitempty"`
 	Screenshots []snap.ScreenshotInfo `json:"screenshots,omitempty"`
@@ -0,0 +1,129 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// QuotaGroupUsage holds the current resource usage of a quota group.
+type QuotaGroupUsage struct {
+	Memory uint64 `json:"memory"`
+	// CPU is the CPU time used so far, in nanoseconds
+	CPU   uint64 `json:"cpu"`
+	Tasks uint64 `json:"tasks"`
+}
+
+// QuotaGroupResult holds information about a single quota group.
+type QuotaGroupResult struct {
+	GroupName     string   `json:"group-name"`
+	Snaps         []string `json:"snaps,omitempty"`
+	MemoryLimit   uint64   `json:"memory-limit,omitempty"`
+	CPUPercentage int      `json:"cpu-percentage,omitempty"`
+	TaskLimit     int      `json:"task-limit,omitempty"`
+	// Usage is unset if the current usage could not be determined,
+	// e.g. because none of the services of the group ever ran.
+	Usage *QuotaGroupUsage `json:"usage,omitempty"`
+}
+
+// QuotaValues holds the snaps to add to a quota group and the limits
+// to set on it. Zero limits leave the current ones unchanged.
+type QuotaValues struct {
+	Snaps         []string
+	MemoryLimit   uint64
+	CPUPercentage int
+	TaskLimit     int
+}
+
+type postQuotaData struct {
+	Action        string   `json:"action"`
+	GroupName     string   `json:"group-name"`
+	Snaps         []string `json:"snaps,omitempty"`
+	MemoryLimit   uint64   `json:"memory-limit,omitempty"`
+	CPUPercentage int      `json:"cpu-percentage,omitempty"`
+	TaskLimit     int      `json:"task-limit,omitempty"`
+}
+
+func (client *Client) postQuota(data *postQuotaData) (changeID string, err error) {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(data); err != nil {
+		return "", err
+	}
+	return client.doAsync("POST", "/v2/quotas", nil, nil, &body)
+}
+
+// EnsureQuota creates the given quota group or updates it if it
+// already exists, adding the given snaps to it and setting the given
+// limits. It returns the ID of the change doing so.
+func (client *Client) EnsureQuota(groupName string, values *QuotaValues) (changeID string, err error) {
+	if groupName == "" {
+		return "", fmt.Errorf("cannot create or update quota group without a name")
+	}
+	data := &postQuotaData{
+		Action:    "ensure",
+		GroupName: groupName,
+	}
+	if values != nil {
+		data.Snaps = values.Snaps
+		data.MemoryLimit = values.MemoryLimit
+		data.CPUPercentage = values.CPUPercentage
+		data.TaskLimit = values.TaskLimit
+	}
+	return client.postQuota(data)
+}
+
+// RemoveQuota removes the given quota group. It returns the ID of the
+// change doing so.
+func (client *Client) RemoveQuota(groupName string) (changeID string, err error) {
+	if groupName == "" {
+		return "", fmt.Errorf("cannot remove quota group without a name")
+	}
+	return client.postQuota(&postQuotaData{
+		Action:    "remove",
+		GroupName: groupName,
+	})
+}
+
+// GetQuotaGroup returns the given quota group, along with its current
+// usage.
+func (client *Client) GetQuotaGroup(groupName string) (*QuotaGroupResult, error) {
+	if groupName == "" {
+		return nil, fmt.Errorf("cannot get quota group without a name")
+	}
+	var res *QuotaGroupResult
+	path := "/v2/quotas/" + url.PathEscape(groupName)
+	if _, err := client.doSync("GET", path, nil, nil, nil, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Quotas returns all the quota groups, along with their current
+// usage.
+func (client *Client) Quotas() ([]*QuotaGroupResult, error) {
+	var res []*QuotaGroupResult
+	if _, err := client.doSync("GET", "/v2/quotas", nil, nil, nil, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,136 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+)
+
+func (cs *clientSuite) TestEnsureQuota(c *check.C) {
+	cs.status = 202
+	cs.rsp = `{"type": "async", "status-code": 202, "change": "42"}`
+
+	chgID, err := cs.cli.EnsureQuota("foo", &client.QuotaValues{
+		Snaps:         []string{"bar", "baz"},
+		MemoryLimit:   1024,
+		CPUPercentage: 50,
+		TaskLimit:     32,
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(chgID, check.Equals, "42")
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/quotas")
+
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	var req map[string]interface{}
+	err = json.Unmarshal(body, &req)
+	c.Assert(err, check.IsNil)
+	c.Check(req, check.DeepEquals, map[string]interface{}{
+		"action":         "ensure",
+		"group-name":     "foo",
+		"snaps":          []interface{}{"bar", "baz"},
+		"memory-limit":   1024.0,
+		"cpu-percentage": 50.0,
+		"task-limit":     32.0,
+	})
+}
+
+func (cs *clientSuite) TestEnsureQuotaError(c *check.C) {
+	cs.status = 400
+	cs.rsp = `{"type": "error", "status-code": 400, "result": {"message": "quota group \"foo\" must have at least one limit"}}`
+
+	_, err := cs.cli.EnsureQuota("foo", nil)
+	c.Check(err, check.ErrorMatches, `quota group "foo" must have at least one limit`)
+
+	_, err = cs.cli.EnsureQuota("", nil)
+	c.Check(err, check.ErrorMatches, `cannot create or update quota group without a name`)
+}
+
+func (cs *clientSuite) TestRemoveQuota(c *check.C) {
+	cs.status = 202
+	cs.rsp = `{"type": "async", "status-code": 202, "change": "42"}`
+
+	chgID, err := cs.cli.RemoveQuota("foo")
+	c.Assert(err, check.IsNil)
+	c.Check(chgID, check.Equals, "42")
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/quotas")
+
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	var req map[string]interface{}
+	err = json.Unmarshal(body, &req)
+	c.Assert(err, check.IsNil)
+	c.Check(req, check.DeepEquals, map[string]interface{}{
+		"action":     "remove",
+		"group-name": "foo",
+	})
+
+	_, err = cs.cli.RemoveQuota("")
+	c.Check(err, check.ErrorMatches, `cannot remove quota group without a name`)
+}
+
+func (cs *clientSuite) TestGetQuotaGroup(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": {"group-name": "foo", "snaps": ["bar"], "memory-limit": 1024, "usage": {"memory": 512, "cpu": 2000000, "tasks": 2}}
+	}`
+
+	grp, err := cs.cli.GetQuotaGroup("foo")
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/quotas/foo")
+	c.Check(grp, check.DeepEquals, &client.QuotaGroupResult{
+		GroupName:   "foo",
+		Snaps:       []string{"bar"},
+		MemoryLimit: 1024,
+		Usage:       &client.QuotaGroupUsage{Memory: 512, CPU: 2000000, Tasks: 2},
+	})
+
+	_, err = cs.cli.GetQuotaGroup("")
+	c.Check(err, check.ErrorMatches, `cannot get quota group without a name`)
+}
+
+func (cs *clientSuite) TestQuotas(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": [
+			{"group-name": "bar", "cpu-percentage": 50},
+			{"group-name": "foo", "snaps": ["baz"], "task-limit": 32, "usage": {"memory": 512, "cpu": 2000000, "tasks": 2}}
+		]
+	}`
+
+	grps, err := cs.cli.Quotas()
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/quotas")
+	c.Check(grps, check.DeepEquals, []*client.QuotaGroupResult{
+		{GroupName: "bar", CPUPercentage: 50},
+		{GroupName: "foo", Snaps: []string{"baz"}, TaskLimit: 32, Usage: &client.QuotaGroupUsage{Memory: 512, CPU: 2000000, Tasks: 2}},
+	})
+}
@@ -28,6 +28,8 @@ import (
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"reflect"
+	"time"
 )
 
 type SnapOptions struct {
@@ -45,6 +47,10 @@ type SnapOptions struct {
 	Amend            bool   `json:"amend,omitempty"`
 
 	Users []string `json:"users,omitempty"`
+	// EncryptionKey is the public key snapshots are encrypted for.
+	EncryptionKey string `json:"encryption-key,omitempty"`
+
+	ScheduleOptions
 }
 
 func writeFieldBool(mw *multipart.Writer, key string, val bool) error {
@@ -81,6 +87,7 @@ type actionData struct {
 	Action   string `json:"action"`
 	Name     string `json:"name,omitempty"`
 	SnapPath string `json:"snap-path,omitempty"`
+	DryRun   bool   `json:"dry-run,omitempty"`
 	*SnapOptions
 }
 
@@ -88,6 +95,11 @@ type multiActionData struct {
 	Action string   `json:"action"`
 	Snaps  []string `json:"snaps,omitempty"`
 	Users  []string `json:"users,omitempty"`
+	DryRun bool     `json:"dry-run,omitempty"`
+
+	EncryptionKey string `json:"encryption-key,omitempty"`
+
+	ScheduleOptions
 }
 
 // Install adds the snap with the given name from the given channel (or
@@ -137,9 +149,144 @@ func (client *Client) Switch(name string, options *SnapOptions) (changeID string
 	return client.doSnapAction("switch", name, options)
 }
 
+// ChangePlan describes what the change made by a snap action would
+// do, without it being made.
+type ChangePlan struct {
+	Summary         string               `json:"summary"`
+	Tasks           []*PlannedTask       `json:"tasks,omitempty"`
+	Snaps           []*PlannedSnap       `json:"snaps,omitempty"`
+	AutoConnections []*PlannedConnection `json:"auto-connections,omitempty"`
+	Conflicts       []*PlannedConflict   `json:"conflicts,omitempty"`
+}
+
+// PlannedTask is a task of a planned change.
+type PlannedTask struct {
+	ID        string   `json:"id"`
+	Kind      string   `json:"kind"`
+	Summary   string   `json:"summary"`
+	WaitTasks []string `json:"wait-tasks,omitempty"`
+}
+
+// PlannedSnap is a snap that a planned change would install, refresh or
+// remove.
+type PlannedSnap struct {
+	Name     string `json:"name"`
+	Action   string `json:"action"`
+	Revision string `json:"revision,omitempty"`
+	Channel  string `json:"channel,omitempty"`
+	// DownloadSize is the size of the snap to download, if known
+	DownloadSize int64 `json:"download-size,omitempty"`
+	// RequiredBy lists the snaps that need a prerequisite snap
+	RequiredBy []string `json:"required-by,omitempty"`
+}
+
+// PlannedConnection is a connection that a planned change would make
+// automatically.
+type PlannedConnection struct {
+	Plug      PlugRef `json:"plug"`
+	Slot      SlotRef `json:"slot"`
+	Interface string  `json:"interface"`
+}
+
+// PlannedConflict is a change in progress that prevents a planned
+// change from being made.
+type PlannedConflict struct {
+	Snap       string `json:"snap,omitempty"`
+	ChangeKind string `json:"change-kind,omitempty"`
+	ChangeID   string `json:"change-id,omitempty"`
+	Message    string `json:"message"`
+}
+
+// PlanSnapAction returns the plan of the change that the install,
+// refresh or remove action on the given snaps would make, without
+// making it. Options can only be given for a single snap.
+func (client *Client) PlanSnapAction(actionName string, snaps []string, options *SnapOptions) (*ChangePlan, error) {
+	var action interface{}
+	path := "/v2/snaps"
+	if len(snaps) == 1 {
+		if options != nil && options.Dangerous {
+			return nil, ErrDangerousNotApplicable
+		}
+		action = &actionData{
+			Action:      actionName,
+			DryRun:      true,
+			SnapOptions: options,
+		}
+		path = fmt.Sprintf("/v2/snaps/%s", snaps[0])
+	} else {
+		if options != nil {
+			return nil, fmt.Errorf("cannot use options for multi-action")
+		}
+		action = &multiActionData{
+			Action: actionName,
+			Snaps:  snaps,
+			DryRun: true,
+		}
+	}
+	data, err := json.Marshal(action)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal snap action: %s", err)
+	}
+
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+
+	var plan ChangePlan
+	if _, err := client.doSync("POST", path, nil, headers, bytes.NewBuffer(data), &plan); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+type refreshHoldData struct {
+	Action    string     `json:"action"`
+	HoldUntil *time.Time `json:"hold-until,omitempty"`
+}
+
+// HoldRefresh holds automatic refreshes of the given snap until the
+// given time, or for the maximum allowed period if holdUntil is zero.
+// It returns the time until which refreshes are effectively held.
+func (client *Client) HoldRefresh(name string, holdUntil time.Time) (time.Time, error) {
+	hold := refreshHoldData{Action: "hold"}
+	if !holdUntil.IsZero() {
+		hold.HoldUntil = &holdUntil
+	}
+	var result struct {
+		HoldUntil time.Time `json:"hold-until"`
+	}
+	if err := client.doRefreshHold(name, &hold, &result); err != nil {
+		return time.Time{}, err
+	}
+	return result.HoldUntil, nil
+}
+
+// UnholdRefresh removes any hold on automatic refreshes of the given snap.
+func (client *Client) UnholdRefresh(name string) error {
+	return client.doRefreshHold(name, &refreshHoldData{Action: "unhold"}, nil)
+}
+
+func (client *Client) doRefreshHold(name string, hold *refreshHoldData, result interface{}) error {
+	data, err := json.Marshal(hold)
+	if err != nil {
+		return fmt.Errorf("cannot marshal snap action: %s", err)
+	}
+	path := fmt.Sprintf("/v2/snaps/%s", name)
+
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+
+	_, err = client.doSync("POST", path, nil, headers, bytes.NewBuffer(data), result)
+	return err
+}
+
 // SnapshotMany snapshots many snaps (all, if names empty) for many users (all, if users is empty).
-func (client *Client) SnapshotMany(names []string, users []string) (setID uint64, changeID string, err error) {
-	result, changeID, err := client.doMultiSnapActionFull("snapshot", names, &SnapOptions{Users: users})
+//
+// If encryptionKey is not empty the snapshot is encrypted for that
+// public key, otherwise for the one configured in the system, if any.
+func (client *Client) SnapshotMany(names []string, users []string, encryptionKey string) (setID uint64, changeID string, err error) {
+	result, changeID, err := client.doMultiSnapActionFull("snapshot", names, &SnapOptions{Users: users, EncryptionKey: encryptionKey})
 	if err != nil {
 		return 0, "", err
 	}
@@ -179,7 +326,8 @@ func (client *Client) doSnapAction(actionName string, snapName string, options *
 }
 
 func (client *Client) doMultiSnapAction(actionName string, snaps []string, options *SnapOptions) (changeID string, err error) {
-	if options != nil {
+	// only scheduling the action is supported
+	if options != nil && !reflect.DeepEqual(*options, SnapOptions{ScheduleOptions: options.ScheduleOptions}) {
 		return "", fmt.Errorf("cannot use options for multi-action") // (yet)
 	}
 	_, changeID, err = client.doMultiSnapActionFull(actionName, snaps, options)
@@ -194,6 +342,8 @@ func (client *Client) doMultiSnapActionFull(actionName string, snaps []string, o
 	}
 	if options != nil {
 		action.Users = options.Users
+		action.EncryptionKey = options.EncryptionKey
+		action.ScheduleOptions = options.ScheduleOptions
 	}
 	data, err := json.Marshal(&action)
 	if err != nil {
@@ -233,6 +383,37 @@ func (client *Client) InstallPath(path, name string, options *SnapOptions) (chan
 	return client.doAsyncNoTimeout("POST", "/v2/snaps", nil, headers, pr)
 }
 
+// InstallPathMany sideloads the snaps at the given paths in a single
+// change, installing each of them only after the ones before it.
+func (client *Client) InstallPathMany(paths []string, options *SnapOptions) (changeID string, err error) {
+	files := make([]*os.File, 0, len(paths))
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return "", fmt.Errorf("cannot open: %q", path)
+		}
+		files = append(files, f)
+	}
+
+	action := actionData{
+		Action:      "install",
+		SnapOptions: options,
+	}
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go sendSnapFiles(paths, files, pw, mw, &action)
+
+	headers := map[string]string{
+		"Content-Type": mw.FormDataContentType(),
+	}
+
+	return client.doAsyncNoTimeout("POST", "/v2/snaps", nil, headers, pr)
+}
+
 // Try
 func (client *Client) Try(path string, options *SnapOptions) (changeID string, err error) {
 	if options == nil {
@@ -257,7 +438,13 @@ func (client *Client) Try(path string, options *SnapOptions) (changeID string, e
 }
 
 func sendSnapFile(snapPath string, snapFile *os.File, pw *io.PipeWriter, mw *multipart.Writer, action *actionData) {
-	defer snapFile.Close()
+	sendSnapFiles([]string{snapPath}, []*os.File{snapFile}, pw, mw, action)
+}
+
+func sendSnapFiles(snapPaths []string, snapFiles []*os.File, pw *io.PipeWriter, mw *multipart.Writer, action *actionData) {
+	for _, snapFile := range snapFiles {
+		defer snapFile.Close()
+	}
 
 	if action.SnapOptions == nil {
 		action.SnapOptions = &SnapOptions{}
@@ -291,16 +478,18 @@ func sendSnapFile(snapPath string, snapFile *os.File, pw *io.PipeWriter, mw *mul
 		return
 	}
 
-	fw, err := mw.CreateFormFile("snap", filepath.Base(snapPath))
-	if err != nil {
-		pw.CloseWithError(err)
-		return
-	}
+	for i, snapFile := range snapFiles {
+		fw, err := mw.CreateFormFile("snap", filepath.Base(snapPaths[i]))
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
 
-	_, err = io.Copy(fw, snapFile)
-	if err != nil {
-		pw.CloseWithError(err)
-		return
+		_, err = io.Copy(fw, snapFile)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
 	}
 
 	mw.Close()
@@ -29,6 +29,7 @@ import (
 	"mime/multipart"
 	"net/http"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/check.v1"
 
@@ -73,7 +74,7 @@ func (cs *clientSuite) TestClientMultiOpSnapServerError(c *check.C) {
 		_, err := s.op(cs.cli, nil, nil)
 		c.Check(err, check.ErrorMatches, `.*fail`, check.Commentf(s.action))
 	}
-	_, _, err := cs.cli.SnapshotMany(nil, nil)
+	_, _, err := cs.cli.SnapshotMany(nil, nil, "")
 	c.Check(err, check.ErrorMatches, `.*fail`)
 }
 
@@ -93,7 +94,7 @@ func (cs *clientSuite) TestClientMultiOpSnapResponseError(c *check.C) {
 		_, err := s.op(cs.cli, nil, nil)
 		c.Check(err, check.ErrorMatches, `.*server error: "Internal Server Error"`, check.Commentf(s.action))
 	}
-	_, _, err := cs.cli.SnapshotMany(nil, nil)
+	_, _, err := cs.cli.SnapshotMany(nil, nil, "")
 	c.Check(err, check.ErrorMatches, `.*server error: "Internal Server Error"`)
 }
 
@@ -186,6 +187,164 @@ func (cs *clientSuite) TestClientMultiOpSnap(c *check.C) {
 	}
 }
 
+func (cs *clientSuite) TestClientMultiOpSnapScheduled(c *check.C) {
+	cs.status = 202
+	cs.rsp = `{
+		"change": "d728",
+		"status-code": 202,
+		"type": "async"
+	}`
+	at := time.Date(2031, 4, 21, 2, 0, 0, 0, time.UTC)
+	id, err := cs.cli.RefreshMany([]string{pkgName}, &client.SnapOptions{ScheduleOptions: client.ScheduleOptions{At: &at}})
+	c.Assert(err, check.IsNil)
+	c.Check(id, check.Equals, "d728")
+
+	var jsonBody map[string]interface{}
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&jsonBody), check.IsNil)
+	c.Check(jsonBody, check.DeepEquals, map[string]interface{}{
+		"action": "refresh",
+		"snaps":  []interface{}{pkgName},
+		"at":     "2031-04-21T02:00:00Z",
+	})
+
+	// other options are still not supported
+	_, err = cs.cli.RemoveMany([]string{pkgName}, &client.SnapOptions{Purge: true, ScheduleOptions: client.ScheduleOptions{Window: "02:00-04:00"}})
+	c.Check(err, check.ErrorMatches, "cannot use options for multi-action")
+}
+
+func (cs *clientSuite) TestClientHoldRefresh(c *check.C) {
+	cs.rsp = `{
+		"result": {"hold-until": "2026-10-20T10:00:00Z"},
+		"status-code": 200,
+		"type": "sync"
+	}`
+	holdUntil := time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC)
+	held, err := cs.cli.HoldRefresh(pkgName, holdUntil)
+	c.Assert(err, check.IsNil)
+	c.Check(held.Equal(holdUntil), check.Equals, true)
+
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, fmt.Sprintf("/v2/snaps/%s", pkgName))
+	c.Check(cs.req.Header.Get("Content-Type"), check.Equals, "application/json")
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	jsonBody := make(map[string]interface{})
+	err = json.Unmarshal(body, &jsonBody)
+	c.Assert(err, check.IsNil)
+	c.Check(jsonBody, check.DeepEquals, map[string]interface{}{
+		"action":     "hold",
+		"hold-until": "2026-10-20T10:00:00Z",
+	})
+}
+
+func (cs *clientSuite) TestClientHoldRefreshMaximum(c *check.C) {
+	cs.rsp = `{
+		"result": {"hold-until": "2026-10-20T10:00:00Z"},
+		"status-code": 200,
+		"type": "sync"
+	}`
+	_, err := cs.cli.HoldRefresh(pkgName, time.Time{})
+	c.Assert(err, check.IsNil)
+
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	jsonBody := make(map[string]interface{})
+	err = json.Unmarshal(body, &jsonBody)
+	c.Assert(err, check.IsNil)
+	c.Check(jsonBody, check.DeepEquals, map[string]interface{}{
+		"action": "hold",
+	})
+}
+
+func (cs *clientSuite) TestClientUnholdRefresh(c *check.C) {
+	cs.rsp = `{
+		"result": null,
+		"status-code": 200,
+		"type": "sync"
+	}`
+	err := cs.cli.UnholdRefresh(pkgName)
+	c.Assert(err, check.IsNil)
+
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, fmt.Sprintf("/v2/snaps/%s", pkgName))
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	jsonBody := make(map[string]interface{})
+	err = json.Unmarshal(body, &jsonBody)
+	c.Assert(err, check.IsNil)
+	c.Check(jsonBody, check.DeepEquals, map[string]interface{}{
+		"action": "unhold",
+	})
+}
+
+func (cs *clientSuite) TestClientPlanSnapAction(c *check.C) {
+	cs.rsp = `{
+		"result": {
+			"summary": "Install \"foo\" snap",
+			"tasks": [{"id": "1", "kind": "prerequisites", "summary": "Ensure prerequisites"}, {"id": "2", "kind": "download-snap", "summary": "Download", "wait-tasks": ["1"]}],
+			"snaps": [{"name": "foo", "action": "install", "revision": "3", "download-size": 1024}, {"name": "core18", "action": "install", "required-by": ["foo"]}],
+			"auto-connections": [{"plug": {"snap": "foo", "plug": "network"}, "slot": {"snap": "core", "slot": "network"}, "interface": "network"}]
+		},
+		"status-code": 200,
+		"type": "sync"
+	}`
+	plan, err := cs.cli.PlanSnapAction("install", []string{pkgName}, &client.SnapOptions{Channel: "edge"})
+	c.Assert(err, check.IsNil)
+	c.Check(plan, check.DeepEquals, &client.ChangePlan{
+		Summary: `Install "foo" snap`,
+		Tasks: []*client.PlannedTask{
+			{ID: "1", Kind: "prerequisites", Summary: "Ensure prerequisites"},
+			{ID: "2", Kind: "download-snap", Summary: "Download", WaitTasks: []string{"1"}},
+		},
+		Snaps: []*client.PlannedSnap{
+			{Name: "foo", Action: "install", Revision: "3", DownloadSize: 1024},
+			{Name: "core18", Action: "install", RequiredBy: []string{"foo"}},
+		},
+		AutoConnections: []*client.PlannedConnection{{
+			Plug:      client.PlugRef{Snap: "foo", Name: "network"},
+			Slot:      client.SlotRef{Snap: "core", Name: "network"},
+			Interface: "network",
+		}},
+	})
+
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, fmt.Sprintf("/v2/snaps/%s", pkgName))
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	jsonBody := make(map[string]interface{})
+	c.Assert(json.Unmarshal(body, &jsonBody), check.IsNil)
+	c.Check(jsonBody, check.DeepEquals, map[string]interface{}{
+		"action":  "install",
+		"channel": "edge",
+		"dry-run": true,
+	})
+}
+
+func (cs *clientSuite) TestClientPlanSnapActionMany(c *check.C) {
+	cs.rsp = `{
+		"result": {"summary": "Remove snaps \"foo\", \"bar\""},
+		"status-code": 200,
+		"type": "sync"
+	}`
+	plan, err := cs.cli.PlanSnapAction("remove", []string{"foo", "bar"}, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(plan, check.DeepEquals, &client.ChangePlan{Summary: `Remove snaps "foo", "bar"`})
+
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snaps")
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	jsonBody := make(map[string]interface{})
+	c.Assert(json.Unmarshal(body, &jsonBody), check.IsNil)
+	c.Check(jsonBody, check.DeepEquals, map[string]interface{}{
+		"action":  "remove",
+		"snaps":   []interface{}{"foo", "bar"},
+		"dry-run": true,
+	})
+
+	_, err = cs.cli.PlanSnapAction("remove", []string{"foo", "bar"}, &client.SnapOptions{Purge: true})
+	c.Check(err, check.ErrorMatches, "cannot use options for multi-action")
+}
+
 func (cs *clientSuite) TestClientMultiSnapshot(c *check.C) {
 	// Note body is essentially the same as TestClientMultiOpSnap; keep in sync
 	cs.status = 202
@@ -195,7 +354,7 @@ func (cs *clientSuite) TestClientMultiSnapshot(c *check.C) {
 		"status-code": 202,
 		"type": "async"
 	}`
-	setID, changeID, err := cs.cli.SnapshotMany([]string{pkgName}, nil)
+	setID, changeID, err := cs.cli.SnapshotMany([]string{pkgName}, nil, "")
 	c.Assert(err, check.IsNil)
 	c.Check(cs.req.Header.Get("Content-Type"), check.Equals, "application/json")
 
@@ -210,6 +369,15 @@ func (cs *clientSuite) TestClientMultiSnapshot(c *check.C) {
 	c.Check(cs.req.URL.Path, check.Equals, "/v2/snaps")
 	c.Check(setID, check.Equals, uint64(42))
 	c.Check(changeID, check.Equals, "d728")
+
+	_, _, err = cs.cli.SnapshotMany([]string{pkgName}, nil, "a-key")
+	c.Assert(err, check.IsNil)
+	body, err = ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	jsonBody = make(map[string]interface{})
+	c.Assert(json.Unmarshal(body, &jsonBody), check.IsNil)
+	c.Check(jsonBody["encryption-key"], check.Equals, "a-key")
+	c.Check(jsonBody, check.HasLen, 3)
 }
 
 func (cs *clientSuite) TestClientOpInstallPath(c *check.C) {
@@ -242,6 +410,41 @@ func (cs *clientSuite) TestClientOpInstallPath(c *check.C) {
 	c.Check(id, check.Equals, "66b3")
 }
 
+func (cs *clientSuite) TestClientOpInstallPathMany(c *check.C) {
+	cs.status = 202
+	cs.rsp = `{
+		"change": "66b3",
+		"status-code": 202,
+		"type": "async"
+	}`
+
+	dir := c.MkDir()
+	base := filepath.Join(dir, "core18.snap")
+	c.Assert(ioutil.WriteFile(base, []byte("base-data"), 0644), check.IsNil)
+	app := filepath.Join(dir, "foo.snap")
+	c.Assert(ioutil.WriteFile(app, []byte("app-data"), 0644), check.IsNil)
+
+	id, err := cs.cli.InstallPathMany([]string{base, app}, &client.SnapOptions{Dangerous: true})
+	c.Assert(err, check.IsNil)
+
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+
+	c.Assert(string(body), check.Matches, "(?s).*Content-Disposition: form-data; name=\"action\"\r\n\r\ninstall\r\n.*")
+	c.Assert(string(body), check.Matches, "(?s).*Content-Disposition: form-data; name=\"dangerous\"\r\n\r\ntrue\r\n.*")
+	c.Assert(string(body), check.Matches, "(?s).*name=\"snap\"; filename=\"core18.snap\"\r\n.*\r\nbase-data\r\n.*name=\"snap\"; filename=\"foo.snap\"\r\n.*\r\napp-data\r\n.*")
+
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snaps")
+	c.Check(id, check.Equals, "66b3")
+}
+
+func (cs *clientSuite) TestClientOpInstallPathManyMissingFile(c *check.C) {
+	missing := filepath.Join(c.MkDir(), "missing.snap")
+	_, err := cs.cli.InstallPathMany([]string{missing}, nil)
+	c.Check(err, check.ErrorMatches, `cannot open: ".*/missing.snap"`)
+}
+
 func (cs *clientSuite) TestClientOpInstallPathInstance(c *check.C) {
 	cs.status = 202
 	cs.rsp = `{
@@ -35,6 +35,16 @@ type SnapCtlOptions struct {
 	Args []string `json:"args"`
 }
 
+// UnsuccessfulError is returned by RunSnapctl when the command ran but
+// reported failure through its exit code.
+type UnsuccessfulError struct {
+	ExitCode int
+}
+
+func (e *UnsuccessfulError) Error() string {
+	return fmt.Sprintf("snapctl unsuccessful with exit code: %d", e.ExitCode)
+}
+
 type snapctlOutput struct {
 	Stdout string `json:"stdout"`
 	Stderr string `json:"stderr"`
@@ -49,6 +59,18 @@ func (client *Client) RunSnapctl(options *SnapCtlOptions) (stdout, stderr []byte
 
 	var output snapctlOutput
 	_, err = client.doSync("POST", "/v2/snapctl", nil, nil, bytes.NewReader(b), &output)
+	if e, ok := err.(*Error); ok && e.Kind == ErrorKindUnsuccessful {
+		var stdout, stderr string
+		var exitCode int
+		if val, ok := e.Value.(map[string]interface{}); ok {
+			stdout, _ = val["stdout"].(string)
+			stderr, _ = val["stderr"].(string)
+			if code, ok := val["exit-code"].(float64); ok {
+				exitCode = int(code)
+			}
+		}
+		return []byte(stdout), []byte(stderr), &UnsuccessfulError{ExitCode: exitCode}
+	}
 	if err != nil {
 		return nil, nil, err
 	}
@@ -21,9 +21,11 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"strconv"
 	"strings"
@@ -43,6 +45,8 @@ type snapshotAction struct {
 	Action string   `json:"action"`
 	Snaps  []string `json:"snaps,omitempty"`
 	Users  []string `json:"users,omitempty"`
+
+	DecryptionKey string `json:"decryption-key,omitempty"`
 }
 
 // A Snapshot is a collection of archives with a simple metadata json file
@@ -75,6 +79,20 @@ type Snapshot struct {
 
 	// set if the snapshot was created automatically on snap removal
 	Auto bool `json:"auto,omitempty"`
+
+	// set if the archives of the snapshot are encrypted
+	Encryption *SnapshotEncryption `json:"encryption,omitempty"`
+}
+
+// SnapshotEncryption describes how the archives of an encrypted
+// snapshot were encrypted.
+type SnapshotEncryption struct {
+	Scheme string `json:"scheme"`
+	// KeyID identifies the public key the archives were encrypted for
+	KeyID string `json:"key-id"`
+	// EphemeralKey is the public half of the key generated to encrypt
+	// this snapshot
+	EphemeralKey string `json:"ephemeral-key"`
 }
 
 // IsValid checks whether the snapshot is missing information that
@@ -141,26 +159,31 @@ func (client *Client) ForgetSnapshots(setID uint64, snaps []string) (changeID st
 // CheckSnapshots verifies the archive checksums in the given snapshot set.
 //
 // If snaps or users are non-empty, limit to checking only those
-// archives of the snapshot.
-func (client *Client) CheckSnapshots(setID uint64, snaps []string, users []string) (changeID string, err error) {
+// archives of the snapshot. If decryptionKey is not empty, the
+// archives of an encrypted snapshot are also checked to decrypt with
+// it.
+func (client *Client) CheckSnapshots(setID uint64, snaps []string, users []string, decryptionKey string) (changeID string, err error) {
 	return client.snapshotAction(&snapshotAction{
-		SetID:  setID,
-		Action: "check",
-		Snaps:  snaps,
-		Users:  users,
+		SetID:         setID,
+		Action:        "check",
+		Snaps:         snaps,
+		Users:         users,
+		DecryptionKey: decryptionKey,
 	})
 }
 
 // RestoreSnapshots extracts the given snapshot set.
 //
 // If snaps or users are non-empty, limit to checking only those
-// archives of the snapshot.
-func (client *Client) RestoreSnapshots(setID uint64, snaps []string, users []string) (changeID string, err error) {
+// archives of the snapshot. The decryptionKey is required to restore
+// an encrypted snapshot.
+func (client *Client) RestoreSnapshots(setID uint64, snaps []string, users []string, decryptionKey string) (changeID string, err error) {
 	return client.snapshotAction(&snapshotAction{
-		SetID:  setID,
-		Action: "restore",
-		Snaps:  snaps,
-		Users:  users,
+		SetID:         setID,
+		Action:        "restore",
+		Snaps:         snaps,
+		Users:         users,
+		DecryptionKey: decryptionKey,
 	})
 }
 
@@ -176,3 +199,72 @@ func (client *Client) snapshotAction(action *snapshotAction) (changeID string, e
 
 	return client.doAsync("POST", "/v2/snapshots", nil, headers, bytes.NewBuffer(data))
 }
+
+// SnapshotExportMediaType is the media type used to stream exported
+// snapshot sets, and to import them back.
+const SnapshotExportMediaType = "application/x.snapd.snapshot"
+
+// SnapshotImportSet is the result of importing a snapshot set.
+type SnapshotImportSet struct {
+	// ID is the ID given to the imported snapshot set
+	ID    uint64   `json:"set-id"`
+	Snaps []string `json:"snaps"`
+}
+
+// SnapshotExport streams the snapshot set with the given ID, for it to
+// be imported elsewhere with SnapshotImport. The caller must close the
+// returned stream.
+func (client *Client) SnapshotExport(setID uint64) (stream io.ReadCloser, err error) {
+	// no deadline for exports
+	rsp, err := client.raw(context.Background(), "GET", fmt.Sprintf("/v2/snapshots/%d/export", setID), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if rsp.StatusCode != 200 {
+		var r response
+		defer rsp.Body.Close()
+		if err := decodeInto(rsp.Body, &r); err != nil {
+			return nil, err
+		}
+		return nil, r.err(client, rsp.StatusCode)
+	}
+	if contentType := rsp.Header.Get("Content-Type"); contentType != SnapshotExportMediaType {
+		rsp.Body.Close()
+		return nil, fmt.Errorf("unexpected snapshot export content type %q", contentType)
+	}
+
+	return rsp.Body, nil
+}
+
+// SnapshotImport imports a snapshot set, as streamed by SnapshotExport,
+// as a new snapshot set.
+func (client *Client) SnapshotImport(exportStream io.Reader) (SnapshotImportSet, error) {
+	headers := map[string]string{
+		"Content-Type": SnapshotExportMediaType,
+	}
+
+	// no deadline for imports
+	rsp, err := client.raw(context.Background(), "POST", "/v2/snapshots", nil, headers, exportStream)
+	if err != nil {
+		return SnapshotImportSet{}, err
+	}
+	defer rsp.Body.Close()
+
+	var r response
+	if err := decodeInto(rsp.Body, &r); err != nil {
+		return SnapshotImportSet{}, err
+	}
+	if err := r.err(client, rsp.StatusCode); err != nil {
+		return SnapshotImportSet{}, err
+	}
+	if r.Type != "sync" {
+		return SnapshotImportSet{}, fmt.Errorf("expected sync response, got %q", r.Type)
+	}
+
+	var importSet SnapshotImportSet
+	if err := json.Unmarshal(r.Result, &importSet); err != nil {
+		return SnapshotImportSet{}, fmt.Errorf("cannot unmarshal: %v", err)
+	}
+	return importSet, nil
+}
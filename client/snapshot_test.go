@@ -20,7 +20,10 @@
 package client_test
 
 import (
+	"io/ioutil"
+	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"gopkg.in/check.v1"
@@ -93,7 +96,7 @@ func (cs *clientSuite) TestClientSnapshotSets(c *check.C) {
 	})
 }
 
-func (cs *clientSuite) testClientSnapshotActionFull(c *check.C, action string, users []string, f func() (string, error)) {
+func (cs *clientSuite) testClientSnapshotActionFull(c *check.C, action string, users []string, decryptionKey string, f func() (string, error)) {
 	cs.status = 202
 	cs.rsp = `{
 		"status-code": 202,
@@ -112,6 +115,7 @@ func (cs *clientSuite) testClientSnapshotActionFull(c *check.C, action string, u
 	c.Check(act.Action, check.Equals, action)
 	c.Check(act.Snaps, check.DeepEquals, []string{"asnap", "bsnap"})
 	c.Check(act.Users, check.DeepEquals, users)
+	c.Check(act.DecryptionKey, check.Equals, decryptionKey)
 
 	c.Check(cs.req.Method, check.Equals, "POST")
 	c.Check(cs.req.URL.Path, check.Equals, "/v2/snapshots")
@@ -119,14 +123,17 @@ func (cs *clientSuite) testClientSnapshotActionFull(c *check.C, action string, u
 }
 
 func (cs *clientSuite) TestClientForgetSnapshot(c *check.C) {
-	cs.testClientSnapshotActionFull(c, "forget", nil, func() (string, error) {
+	cs.testClientSnapshotActionFull(c, "forget", nil, "", func() (string, error) {
 		return cs.cli.ForgetSnapshots(42, []string{"asnap", "bsnap"})
 	})
 }
 
-func (cs *clientSuite) testClientSnapshotAction(c *check.C, action string, f func(uint64, []string, []string) (string, error)) {
-	cs.testClientSnapshotActionFull(c, action, []string{"auser", "buser"}, func() (string, error) {
-		return f(42, []string{"asnap", "bsnap"}, []string{"auser", "buser"})
+func (cs *clientSuite) testClientSnapshotAction(c *check.C, action string, f func(uint64, []string, []string, string) (string, error)) {
+	cs.testClientSnapshotActionFull(c, action, []string{"auser", "buser"}, "", func() (string, error) {
+		return f(42, []string{"asnap", "bsnap"}, []string{"auser", "buser"}, "")
+	})
+	cs.testClientSnapshotActionFull(c, action, []string{"auser", "buser"}, "a-key", func() (string, error) {
+		return f(42, []string{"asnap", "bsnap"}, []string{"auser", "buser"}, "a-key")
 	})
 }
 
@@ -137,3 +144,53 @@ func (cs *clientSuite) TestClientCheckSnapshots(c *check.C) {
 func (cs *clientSuite) TestClientRestoreSnapshots(c *check.C) {
 	cs.testClientSnapshotAction(c, "restore", cs.cli.RestoreSnapshots)
 }
+
+func (cs *clientSuite) TestClientSnapshotExport(c *check.C) {
+	cs.header = http.Header{"Content-Type": []string{client.SnapshotExportMediaType}}
+	cs.rsp = "snapshot export data"
+
+	stream, err := cs.cli.SnapshotExport(42)
+	c.Assert(err, check.IsNil)
+	defer stream.Close()
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snapshots/42/export")
+
+	data, err := ioutil.ReadAll(stream)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, "snapshot export data")
+}
+
+func (cs *clientSuite) TestClientSnapshotExportErrors(c *check.C) {
+	cs.status = 404
+	cs.rsp = `{"type": "error", "status-code": 404, "result": {"message": "no snapshot set with the given ID"}}`
+	_, err := cs.cli.SnapshotExport(42)
+	c.Check(err, check.ErrorMatches, "no snapshot set with the given ID")
+
+	cs.status = 200
+	cs.header = http.Header{"Content-Type": []string{"text/plain"}}
+	cs.rsp = "foo"
+	_, err = cs.cli.SnapshotExport(42)
+	c.Check(err, check.ErrorMatches, `unexpected snapshot export content type "text/plain"`)
+}
+
+func (cs *clientSuite) TestClientSnapshotImport(c *check.C) {
+	cs.rsp = `{"type": "sync", "status-code": 200, "result": {"set-id": 42, "snaps": ["bar", "foo"]}}`
+
+	importSet, err := cs.cli.SnapshotImport(strings.NewReader("snapshot export data"))
+	c.Assert(err, check.IsNil)
+	c.Check(importSet, check.DeepEquals, client.SnapshotImportSet{ID: 42, Snaps: []string{"bar", "foo"}})
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snapshots")
+	c.Check(cs.req.Header.Get("Content-Type"), check.Equals, client.SnapshotExportMediaType)
+	data, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, "snapshot export data")
+}
+
+func (cs *clientSuite) TestClientSnapshotImportError(c *check.C) {
+	cs.status = 400
+	cs.rsp = `{"type": "error", "status-code": 400, "result": {"message": "cannot import snapshot: empty import"}}`
+
+	_, err := cs.cli.SnapshotImport(strings.NewReader(""))
+	c.Check(err, check.ErrorMatches, "cannot import snapshot: empty import")
+}
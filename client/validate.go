@@ -0,0 +1,111 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// ValidationSetResult holds information about a single validation set.
+type ValidationSetResult struct {
+	AccountID string `json:"account-id"`
+	Name      string `json:"name"`
+	PinnedAt  int    `json:"pinned-at,omitempty"`
+	Mode      string `json:"mode,omitempty"`
+	Sequence  int    `json:"sequence,omitempty"`
+	Valid     bool   `json:"valid"`
+}
+
+// ValidateApplyOptions carries the options for applying a validation set.
+type ValidateApplyOptions struct {
+	// Mode is either "monitor" or "enforce".
+	Mode string
+	// Sequence optionally pins the validation set at the given sequence.
+	Sequence int
+}
+
+type postValidationSetData struct {
+	Action   string `json:"action"`
+	Mode     string `json:"mode,omitempty"`
+	Sequence int    `json:"sequence,omitempty"`
+}
+
+func validationSetPath(accountID, name string) string {
+	return fmt.Sprintf("/v2/validation-sets/%s/%s", accountID, name)
+}
+
+// ListValidationSets queries all validation sets tracked by the system.
+func (client *Client) ListValidationSets() ([]*ValidationSetResult, error) {
+	var res []*ValidationSetResult
+	_, err := client.doSync("GET", "/v2/validation-sets", nil, nil, nil, &res)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list validation sets: %v", err)
+	}
+	return res, nil
+}
+
+// ValidationSet queries the given validation set tracked by the system.
+func (client *Client) ValidationSet(accountID, name string) (*ValidationSetResult, error) {
+	var res *ValidationSetResult
+	_, err := client.doSync("GET", validationSetPath(accountID, name), nil, nil, nil, &res)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query validation set: %v", err)
+	}
+	return res, nil
+}
+
+// ApplyValidationSet starts tracking the given validation set in
+// monitor or enforce mode.
+func (client *Client) ApplyValidationSet(accountID, name string, opts *ValidateApplyOptions) (*ValidationSetResult, error) {
+	if opts == nil || opts.Mode == "" {
+		return nil, fmt.Errorf("internal error: mode must be specified")
+	}
+	data := &postValidationSetData{
+		Action:   "apply",
+		Mode:     opts.Mode,
+		Sequence: opts.Sequence,
+	}
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(data); err != nil {
+		return nil, err
+	}
+	var res *ValidationSetResult
+	if _, err := client.doSync("POST", validationSetPath(accountID, name), nil, nil, &body, &res); err != nil {
+		return nil, fmt.Errorf("cannot apply validation set: %v", err)
+	}
+	return res, nil
+}
+
+// ForgetValidationSet stops tracking the given validation set.
+func (client *Client) ForgetValidationSet(accountID, name string) error {
+	data := &postValidationSetData{
+		Action: "forget",
+	}
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(data); err != nil {
+		return err
+	}
+	if _, err := client.doSync("POST", validationSetPath(accountID, name), nil, nil, &body, nil); err != nil {
+		return fmt.Errorf("cannot forget validation set: %v", err)
+	}
+	return nil
+}
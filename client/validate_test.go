@@ -0,0 +1,135 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+)
+
+func (cs *clientSuite) TestListValidationSets(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": [
+			{"account-id": "foo", "name": "bar", "mode": "enforce", "pinned-at": 2, "sequence": 2, "valid": true},
+			{"account-id": "foo", "name": "baz", "mode": "monitor", "sequence": 5, "valid": false}
+		]
+	}`
+	vsets, err := cs.cli.ListValidationSets()
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/validation-sets")
+	c.Check(vsets, check.DeepEquals, []*client.ValidationSetResult{
+		{AccountID: "foo", Name: "bar", Mode: "enforce", PinnedAt: 2, Sequence: 2, Valid: true},
+		{AccountID: "foo", Name: "baz", Mode: "monitor", Sequence: 5, Valid: false},
+	})
+}
+
+func (cs *clientSuite) TestListValidationSetsError(c *check.C) {
+	cs.status = 500
+	cs.rsp = `{
+		"type": "error",
+		"status-code": 500,
+		"result": {"message": "failed"}
+	}`
+	_, err := cs.cli.ListValidationSets()
+	c.Assert(err, check.ErrorMatches, "cannot list validation sets: failed")
+}
+
+func (cs *clientSuite) TestValidationSet(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": {"account-id": "foo", "name": "bar", "mode": "monitor", "sequence": 3, "valid": true}
+	}`
+	vset, err := cs.cli.ValidationSet("foo", "bar")
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/validation-sets/foo/bar")
+	c.Check(vset, check.DeepEquals, &client.ValidationSetResult{
+		AccountID: "foo",
+		Name:      "bar",
+		Mode:      "monitor",
+		Sequence:  3,
+		Valid:     true,
+	})
+}
+
+func (cs *clientSuite) TestApplyValidationSet(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": {"account-id": "foo", "name": "bar", "mode": "enforce", "pinned-at": 3, "sequence": 3, "valid": true}
+	}`
+	vset, err := cs.cli.ApplyValidationSet("foo", "bar", &client.ValidateApplyOptions{Mode: "enforce", Sequence: 3})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/validation-sets/foo/bar")
+	c.Check(vset, check.DeepEquals, &client.ValidationSetResult{
+		AccountID: "foo",
+		Name:      "bar",
+		Mode:      "enforce",
+		PinnedAt:  3,
+		Sequence:  3,
+		Valid:     true,
+	})
+
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	var req map[string]interface{}
+	err = json.Unmarshal(body, &req)
+	c.Assert(err, check.IsNil)
+	c.Check(req, check.DeepEquals, map[string]interface{}{
+		"action":   "apply",
+		"mode":     "enforce",
+		"sequence": 3.0,
+	})
+}
+
+func (cs *clientSuite) TestApplyValidationSetNoMode(c *check.C) {
+	_, err := cs.cli.ApplyValidationSet("foo", "bar", nil)
+	c.Assert(err, check.ErrorMatches, "internal error: mode must be specified")
+}
+
+func (cs *clientSuite) TestForgetValidationSet(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": null
+	}`
+	err := cs.cli.ForgetValidationSet("foo", "bar")
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/validation-sets/foo/bar")
+
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	var req map[string]interface{}
+	err = json.Unmarshal(body, &req)
+	c.Assert(err, check.IsNil)
+	c.Check(req, check.DeepEquals, map[string]interface{}{
+		"action": "forget",
+	})
+}
@@ -0,0 +1,87 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/image"
+)
+
+const (
+	shortHelp = "Preseed the snaps of an image in a chroot"
+	longHelp  = `
+snap-preseed runs snapd of the system in the given chroot directory
+to perform the first boot seeding steps that don't need the actual
+device, such as mounting snaps and setting up security profiles.
+Seeding then resumes from the resulting state on first boot, which is
+also when the hooks of the snaps run.
+
+The chroot directory must have /dev, /proc and /sys/kernel/security
+mounted.
+`
+)
+
+var (
+	Stdout io.Writer = os.Stdout
+	Stderr io.Writer = os.Stderr
+
+	osGetuid     = os.Getuid
+	imagePreseed = image.Preseed
+)
+
+type options struct {
+	Positional struct {
+		ChrootDir string `positional-arg-name:"<chroot-dir>" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	var opts options
+	parser := flags.NewParser(&opts, flags.HelpFlag|flags.PassDoubleDash|flags.PassAfterNonOption)
+	parser.ShortDescription = shortHelp
+	parser.LongDescription = longHelp
+
+	rest, err := parser.ParseArgs(args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("too many arguments: %s", strings.Join(rest, " "))
+	}
+
+	if osGetuid() != 0 {
+		return fmt.Errorf("must be run as root")
+	}
+
+	return imagePreseed(opts.Positional.ChrootDir)
+}
@@ -0,0 +1,80 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"fmt"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	main "github.com/snapcore/snapd/cmd/snap-preseed"
+	"github.com/snapcore/snapd/testutil"
+)
+
+// Hook up check.v1 into the "go test" runner
+func Test(t *testing.T) { TestingT(t) }
+
+type cmdSuite struct {
+	testutil.BaseTest
+}
+
+var _ = Suite(&cmdSuite{})
+
+func (s *cmdSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	s.AddCleanup(main.MockOsGetuid(func() int { return 0 }))
+}
+
+func (s *cmdSuite) TestRunPreseed(c *C) {
+	var chrootDir string
+	restore := main.MockImagePreseed(func(dir string) error {
+		chrootDir = dir
+		return nil
+	})
+	defer restore()
+
+	c.Assert(main.Run([]string{"/a/chroot"}), IsNil)
+	c.Check(chrootDir, Equals, "/a/chroot")
+}
+
+func (s *cmdSuite) TestRunPreseedError(c *C) {
+	restore := main.MockImagePreseed(func(dir string) error {
+		return fmt.Errorf("boom")
+	})
+	defer restore()
+
+	c.Check(main.Run([]string{"/a/chroot"}), ErrorMatches, "boom")
+}
+
+func (s *cmdSuite) TestRunErrors(c *C) {
+	restore := main.MockImagePreseed(func(dir string) error {
+		c.Fatalf("unexpected call")
+		return nil
+	})
+	defer restore()
+
+	c.Check(main.Run(nil), ErrorMatches, "the required argument `<chroot-dir>` was not provided")
+	c.Check(main.Run([]string{"/a/chroot", "extra"}), ErrorMatches, "too many arguments: extra")
+
+	restore = main.MockOsGetuid(func() int { return 1000 })
+	defer restore()
+	c.Check(main.Run([]string{"/a/chroot"}), ErrorMatches, "must be run as root")
+}
@@ -0,0 +1,69 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"github.com/snapcore/snapd/gadget/install"
+)
+
+var installRun = install.Run
+
+func init() {
+	const (
+		short = "Create missing partitions for the device"
+		long  = `
+The create-partitions command compares the volume of the gadget with the
+partition table of the given block device, or image file, and creates the
+partitions with a role that are missing, along with their filesystems and
+content.
+
+With --encrypt, the data partition is encrypted with a key sealed to the
+TPM, such that it can only be unsealed when booting the given kernel snap
+with the grub configuration of the gadget. It can also be unlocked with a
+recovery key, which is written to the given file.
+`
+	)
+
+	if _, err := parser.AddCommand("create-partitions", short, long, &cmdCreatePartitions{}); err != nil {
+		panic(err)
+	}
+}
+
+type cmdCreatePartitions struct {
+	Encrypt         bool   `long:"encrypt" description:"Encrypt the data partition"`
+	SealedKeyDir    string `long:"sealed-key-dir" description:"Directory to store the sealed key of the encrypted data partition in"`
+	KernelPath      string `long:"kernel" description:"Kernel snap the key of the encrypted data partition is sealed to"`
+	RecoveryKeyFile string `long:"recovery-key-file" description:"File to write the recovery key of the encrypted data partition to"`
+
+	Positional struct {
+		GadgetRoot string `positional-arg-name:"<gadget-root>"`
+		Device     string `positional-arg-name:"<device>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *cmdCreatePartitions) Execute(args []string) error {
+	opts := &install.Options{
+		Encrypt:         c.Encrypt,
+		SealedKeyDir:    c.SealedKeyDir,
+		KernelPath:      c.KernelPath,
+		RecoveryKeyFile: c.RecoveryKeyFile,
+	}
+	return installRun(c.Positional.GadgetRoot, c.Positional.Device, opts)
+}
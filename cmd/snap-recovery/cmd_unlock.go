@@ -0,0 +1,74 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/snapcore/snapd/gadget/install"
+	"github.com/snapcore/snapd/secboot"
+)
+
+var (
+	secbootUnsealKey             = secboot.UnsealKey
+	secbootUnlockEncryptedDevice = secboot.UnlockEncryptedDevice
+	secbootStoreKeyInKeyring     = secboot.StoreKeyInKeyring
+)
+
+func init() {
+	const (
+		short = "Unlock the encrypted data partition"
+		long  = `
+The unlock command unseals the key of the encrypted data partition on the
+given device with the TPM, which only succeeds when the system booted with
+a boot chain the key was sealed to, and opens the partition.
+
+The key cannot be unsealed again until the next boot, it is kept in the
+kernel keyring for snapd to reseal it.
+`
+	)
+
+	if _, err := parser.AddCommand("unlock", short, long, &cmdUnlock{}); err != nil {
+		panic(err)
+	}
+}
+
+type cmdUnlock struct {
+	Positional struct {
+		SealedKeyDir string `positional-arg-name:"<sealed-key-dir>"`
+		Device       string `positional-arg-name:"<device>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *cmdUnlock) Execute(args []string) error {
+	key, err := secbootUnsealKey(c.Positional.SealedKeyDir)
+	if err != nil {
+		return err
+	}
+	if err := secbootUnlockEncryptedDevice(install.EncryptedDataName, c.Positional.Device, key); err != nil {
+		return err
+	}
+	fmt.Fprintf(Stdout, "Unlocked %s as /dev/mapper/%s\n", c.Positional.Device, install.EncryptedDataName)
+	if err := secbootStoreKeyInKeyring(key); err != nil {
+		// the data is unlocked, only resealing will fail
+		fmt.Fprintf(Stderr, "WARNING: %v\n", err)
+	}
+	return nil
+}
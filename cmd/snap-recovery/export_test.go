@@ -0,0 +1,61 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"github.com/snapcore/snapd/gadget/install"
+	"github.com/snapcore/snapd/secboot"
+)
+
+var (
+	ParseArgs = parseArgs
+)
+
+func MockInstallRun(f func(gadgetRoot, device string, opts *install.Options) error) (restore func()) {
+	old := installRun
+	installRun = f
+	return func() {
+		installRun = old
+	}
+}
+
+func MockSecbootUnsealKey(f func(dir string) (secboot.EncryptionKey, error)) (restore func()) {
+	old := secbootUnsealKey
+	secbootUnsealKey = f
+	return func() {
+		secbootUnsealKey = old
+	}
+}
+
+func MockSecbootUnlockEncryptedDevice(f func(name, node string, key secboot.EncryptionKey) error) (restore func()) {
+	old := secbootUnlockEncryptedDevice
+	secbootUnlockEncryptedDevice = f
+	return func() {
+		secbootUnlockEncryptedDevice = old
+	}
+}
+
+func MockSecbootStoreKeyInKeyring(f func(key secboot.EncryptionKey) error) (restore func()) {
+	old := secbootStoreKeyInKeyring
+	secbootStoreKeyInKeyring = f
+	return func() {
+		secbootStoreKeyInKeyring = old
+	}
+}
@@ -0,0 +1,177 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	main "github.com/snapcore/snapd/cmd/snap-recovery"
+	"github.com/snapcore/snapd/gadget/install"
+	"github.com/snapcore/snapd/secboot"
+	"github.com/snapcore/snapd/testutil"
+)
+
+// Hook up check.v1 into the "go test" runner
+func Test(t *testing.T) { TestingT(t) }
+
+type cmdSuite struct {
+	testutil.BaseTest
+
+	stdout *bytes.Buffer
+	stderr *bytes.Buffer
+}
+
+var _ = Suite(&cmdSuite{})
+
+func (s *cmdSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+
+	s.stdout = bytes.NewBuffer(nil)
+	oldStdout := main.Stdout
+	main.Stdout = s.stdout
+	s.AddCleanup(func() { main.Stdout = oldStdout })
+
+	s.stderr = bytes.NewBuffer(nil)
+	oldStderr := main.Stderr
+	main.Stderr = s.stderr
+	s.AddCleanup(func() { main.Stderr = oldStderr })
+}
+
+func (s *cmdSuite) TestNoArgs(c *C) {
+	err := main.ParseArgs([]string{})
+	c.Assert(err, ErrorMatches, "Please specify one command of: create-partitions or unlock")
+}
+
+func (s *cmdSuite) TestCreatePartitions(c *C) {
+	var gadgetRoot, device string
+	var opts *install.Options
+	restore := main.MockInstallRun(func(g, d string, o *install.Options) error {
+		gadgetRoot = g
+		device = d
+		opts = o
+		return nil
+	})
+	defer restore()
+
+	err := main.ParseArgs([]string{"create-partitions", "/run/gadget", "/dev/sda"})
+	c.Assert(err, IsNil)
+	c.Check(gadgetRoot, Equals, "/run/gadget")
+	c.Check(device, Equals, "/dev/sda")
+	c.Check(opts, DeepEquals, &install.Options{})
+}
+
+func (s *cmdSuite) TestCreatePartitionsEncrypted(c *C) {
+	var opts *install.Options
+	restore := main.MockInstallRun(func(g, d string, o *install.Options) error {
+		opts = o
+		return nil
+	})
+	defer restore()
+
+	err := main.ParseArgs([]string{"create-partitions", "--encrypt", "--sealed-key-dir", "/run/boot/fde", "--kernel", "/run/pc-kernel_1.snap", "--recovery-key-file", "/run/recovery.key", "/run/gadget", "/dev/sda"})
+	c.Assert(err, IsNil)
+	c.Check(opts, DeepEquals, &install.Options{
+		Encrypt:         true,
+		SealedKeyDir:    "/run/boot/fde",
+		KernelPath:      "/run/pc-kernel_1.snap",
+		RecoveryKeyFile: "/run/recovery.key",
+	})
+}
+
+func (s *cmdSuite) TestCreatePartitionsMissingArgs(c *C) {
+	restore := main.MockInstallRun(func(g, d string, o *install.Options) error {
+		c.Fatalf("unexpected call")
+		return nil
+	})
+	defer restore()
+
+	err := main.ParseArgs([]string{"create-partitions", "/run/gadget"})
+	c.Assert(err, ErrorMatches, "the required argument `<device>` was not provided")
+}
+
+func (s *cmdSuite) TestUnlock(c *C) {
+	var key secboot.EncryptionKey
+	copy(key[:], "secret")
+	restore := main.MockSecbootUnsealKey(func(dir string) (secboot.EncryptionKey, error) {
+		c.Check(dir, Equals, "/run/boot/fde")
+		return key, nil
+	})
+	defer restore()
+	var unlocked []string
+	restore = main.MockSecbootUnlockEncryptedDevice(func(name, node string, k secboot.EncryptionKey) error {
+		c.Check(k, DeepEquals, key)
+		unlocked = append(unlocked, name, node)
+		return nil
+	})
+	defer restore()
+	var stored []secboot.EncryptionKey
+	restore = main.MockSecbootStoreKeyInKeyring(func(k secboot.EncryptionKey) error {
+		stored = append(stored, k)
+		return nil
+	})
+	defer restore()
+
+	err := main.ParseArgs([]string{"unlock", "/run/boot/fde", "/dev/sda4"})
+	c.Assert(err, IsNil)
+	c.Check(unlocked, DeepEquals, []string{"ubuntu-data", "/dev/sda4"})
+	c.Check(stored, DeepEquals, []secboot.EncryptionKey{key})
+	c.Check(s.stdout.String(), Equals, "Unlocked /dev/sda4 as /dev/mapper/ubuntu-data\n")
+	c.Check(s.stderr.String(), Equals, "")
+}
+
+func (s *cmdSuite) TestUnlockKeyringError(c *C) {
+	restore := main.MockSecbootUnsealKey(func(dir string) (secboot.EncryptionKey, error) {
+		return secboot.EncryptionKey{}, nil
+	})
+	defer restore()
+	restore = main.MockSecbootUnlockEncryptedDevice(func(name, node string, k secboot.EncryptionKey) error {
+		return nil
+	})
+	defer restore()
+	restore = main.MockSecbootStoreKeyInKeyring(func(k secboot.EncryptionKey) error {
+		return errors.New("cannot add key to the kernel keyring: permission denied")
+	})
+	defer restore()
+
+	// the data is unlocked regardless
+	err := main.ParseArgs([]string{"unlock", "/run/boot/fde", "/dev/sda4"})
+	c.Assert(err, IsNil)
+	c.Check(s.stdout.String(), Equals, "Unlocked /dev/sda4 as /dev/mapper/ubuntu-data\n")
+	c.Check(s.stderr.String(), Equals, "WARNING: cannot add key to the kernel keyring: permission denied\n")
+}
+
+func (s *cmdSuite) TestUnlockUnsealError(c *C) {
+	restore := main.MockSecbootUnsealKey(func(dir string) (secboot.EncryptionKey, error) {
+		return secboot.EncryptionKey{}, errors.New("cannot unseal key: policy check failed")
+	})
+	defer restore()
+	restore = main.MockSecbootUnlockEncryptedDevice(func(name, node string, k secboot.EncryptionKey) error {
+		c.Fatalf("unexpected call")
+		return nil
+	})
+	defer restore()
+
+	err := main.ParseArgs([]string{"unlock", "/run/boot/fde", "/dev/sda4"})
+	c.Assert(err, ErrorMatches, "cannot unseal key: policy check failed")
+}
@@ -0,0 +1,210 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+)
+
+// bundleIndexName is the name of the index of a snap bundle, as
+// written by snap download --with-dependencies.
+const bundleIndexName = "bundle.yaml"
+
+// bundleSnap is a snap in a bundle, together with the file holding
+// its supporting assertions.
+type bundleSnap struct {
+	Name       string        `yaml:"name"`
+	Revision   snap.Revision `yaml:"revision"`
+	File       string        `yaml:"file"`
+	Assertions string        `yaml:"assertions"`
+}
+
+// bundleIndex lists the snaps of a bundle in the order they need to be
+// installed in, i.e. with bases and content providers before the snaps
+// using them.
+type bundleIndex struct {
+	Snaps []*bundleSnap `yaml:"snaps"`
+}
+
+func (idx *bundleIndex) validate(dir string) error {
+	if len(idx.Snaps) == 0 {
+		return fmt.Errorf(i18n.G("bundle has no snaps"))
+	}
+	for _, bs := range idx.Snaps {
+		if err := snap.ValidateName(bs.Name); err != nil {
+			return err
+		}
+		for _, fn := range []string{bs.File, bs.Assertions} {
+			if fn == "" || fn != filepath.Base(fn) || fn == "." || fn == ".." {
+				return fmt.Errorf(i18n.G("invalid file name %q in bundle for snap %q"), fn, bs.Name)
+			}
+			if !osutil.FileExists(filepath.Join(dir, fn)) {
+				return fmt.Errorf(i18n.G("bundle is missing file %q for snap %q"), fn, bs.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func writeBundleIndex(dir string, idx *bundleIndex) error {
+	data, err := yaml.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	return osutil.AtomicWriteFile(filepath.Join(dir, bundleIndexName), data, 0644, 0)
+}
+
+func readBundleIndex(dir string) (*bundleIndex, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, bundleIndexName))
+	if err != nil {
+		return nil, fmt.Errorf(i18n.G("cannot read bundle index: %v"), err)
+	}
+	var idx bundleIndex
+	if err := yaml.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf(i18n.G("cannot parse bundle index: %v"), err)
+	}
+	if err := idx.validate(dir); err != nil {
+		return nil, err
+	}
+	return &idx, nil
+}
+
+// writeBundleTarball writes a tarball with the index and all the files
+// of the bundle in dir.
+func writeBundleTarball(tarPath, dir string, idx *bundleIndex) (err error) {
+	f, err := os.OpenFile(tarPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(tarPath)
+		}
+	}()
+
+	tw := tar.NewWriter(f)
+	files := []string{bundleIndexName}
+	for _, bs := range idx.Snaps {
+		files = append(files, bs.File, bs.Assertions)
+	}
+	for _, fn := range files {
+		if err := addFileToTar(tw, dir, fn); err != nil {
+			return fmt.Errorf(i18n.G("cannot add %q to bundle: %v"), fn, err)
+		}
+	}
+	return tw.Close()
+}
+
+func addFileToTar(tw *tar.Writer, dir, name string) error {
+	r, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	fi, err := r.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(fi, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, r)
+	return err
+}
+
+// openBundle opens the bundle at the given path, either a directory or
+// a tarball. For tarballs the content is extracted into a temporary
+// directory that is removed by the returned cleanup function.
+func openBundle(bundlePath string) (dir string, idx *bundleIndex, cleanup func(), err error) {
+	cleanup = func() {}
+	if osutil.IsDirectory(bundlePath) {
+		idx, err = readBundleIndex(bundlePath)
+		return bundlePath, idx, cleanup, err
+	}
+
+	dir, err = ioutil.TempDir("", "snap-bundle-")
+	if err != nil {
+		return "", nil, nil, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	if err := extractBundleTarball(bundlePath, dir); err != nil {
+		cleanup()
+		return "", nil, nil, fmt.Errorf(i18n.G("cannot extract bundle %q: %v"), bundlePath, err)
+	}
+	idx, err = readBundleIndex(dir)
+	if err != nil {
+		cleanup()
+		return "", nil, nil, err
+	}
+	return dir, idx, cleanup, nil
+}
+
+func extractBundleTarball(tarPath, dir string) error {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// bundles are flat
+		if hdr.Typeflag != tar.TypeReg || hdr.Name != filepath.Base(hdr.Name) || hdr.Name == ".." {
+			return fmt.Errorf("unexpected entry %q", hdr.Name)
+		}
+		w, err := os.OpenFile(filepath.Join(dir, hdr.Name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, tr)
+		if cerr := w.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -121,7 +121,12 @@ func (c *cmdChanges) Execute(args []string) error {
 		if chg.ReadyTime.IsZero() {
 			readyTime = "-"
 		}
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", chg.ID, chg.Status, spawnTime, readyTime, chg.Summary)
+		summary := chg.Summary
+		if chg.Status == "Scheduled" {
+			// TRANSLATORS: the first %s is a change summary, the second %s is a time
+			summary = fmt.Sprintf(i18n.G("%s (starts %s)"), summary, c.fmtTime(chg.ScheduledTime))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", chg.ID, chg.Status, spawnTime, readyTime, summary)
 	}
 
 	w.Flush()
@@ -231,3 +231,28 @@ Doing +2016-04-21T01:02:03Z +2016-04-21T01:02:04Z +some summary \(50.00%\)
 `)
 	c.Check(s.Stderr(), check.Equals, "")
 }
+
+func (s *SnapSuite) TestChangesScheduled(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Assert(r.URL.Path, check.Equals, "/v2/changes")
+		fmt.Fprintln(w, `{"type": "sync", "result": [
+  {
+    "id":   "four",
+    "kind": "refresh-snap",
+    "summary": "Refresh \"foo\" snap",
+    "status": "Scheduled",
+    "ready": false,
+    "spawn-time": "2016-04-21T01:02:03Z",
+    "scheduled-time": "2016-04-22T02:00:00Z"
+  }
+]}`)
+	})
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"changes", "--abs-time"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Matches, `(?ms)ID +Status +Spawn +Ready +Summary
+four +Scheduled +2016-04-21T01:02:03Z +- +Refresh "foo" snap \(starts 2016-04-22T02:00:00Z\)
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+}
@@ -0,0 +1,217 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/interfaces/denials"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/strutil"
+)
+
+type cmdSandboxDenials struct {
+	clientMixin
+	File       flags.Filename `long:"file"`
+	Positional struct {
+		Snap installedSnapName `positional-arg-name:"<snap>"`
+	} `positional-args:"yes"`
+}
+
+var shortSandboxDenialsHelp = i18n.G("Explain the sandbox denials of snaps")
+var longSandboxDenialsHelp = i18n.G(`
+The sandbox-denials command finds the AppArmor and seccomp denials of snaps
+in the kernel log, or in the given log file, and lists the interfaces that
+would permit each of them, along with the snap connect commands that would
+connect them.
+`)
+
+func init() {
+	addDebugCommand("sandbox-denials", shortSandboxDenialsHelp, longSandboxDenialsHelp, func() flags.Commander {
+		return &cmdSandboxDenials{}
+	}, map[string]string{
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"file": i18n.G("Read the denials from the given kernel or audit log file"),
+	}, []argDesc{{
+		// TRANSLATORS: This needs to be wrapped in <>s.
+		name: "<snap>",
+		// TRANSLATORS: This should not start with a lowercase letter.
+		desc: i18n.G("Only explain the denials of the given snap"),
+	}})
+}
+
+var kernelLog = func() (io.ReadCloser, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("journalctl", "-k", "--no-pager", "-o", "cat")
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read kernel log: %v", osutil.OutputErr(stderr.Bytes(), err))
+	}
+	return ioutil.NopCloser(bytes.NewReader(output)), nil
+}
+
+// uniqueDenial is a denial seen count times in the log.
+type uniqueDenial struct {
+	*denials.Denial
+	count int
+}
+
+func (x *cmdSandboxDenials) readDenials() ([]*uniqueDenial, error) {
+	var log io.ReadCloser
+	var err error
+	if x.File != "" {
+		log, err = os.Open(string(x.File))
+	} else {
+		log, err = kernelLog()
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer log.Close()
+
+	ds, err := denials.Parse(log)
+	if err != nil {
+		return nil, err
+	}
+
+	var unique []*uniqueDenial
+	seen := make(map[string]*uniqueDenial)
+	for _, d := range ds {
+		if x.Positional.Snap != "" && d.Snap != string(x.Positional.Snap) {
+			continue
+		}
+		key := d.Snap + "\x00" + d.String()
+		if u := seen[key]; u != nil {
+			u.count++
+			continue
+		}
+		u := &uniqueDenial{Denial: d, count: 1}
+		seen[key] = u
+		unique = append(unique, u)
+	}
+	return unique, nil
+}
+
+func (x *cmdSandboxDenials) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	unique, err := x.readDenials()
+	if err != nil {
+		return err
+	}
+	if len(unique) == 0 {
+		if x.Positional.Snap != "" {
+			fmt.Fprintf(Stdout, i18n.G("No sandbox denials of snap %q found.\n"), x.Positional.Snap)
+		} else {
+			fmt.Fprintln(Stdout, i18n.G("No sandbox denials of snaps found."))
+		}
+		return nil
+	}
+
+	// the denials of each snap are listed together, in the order the
+	// snaps were first denied
+	var snaps []string
+	bySnap := make(map[string][]*uniqueDenial)
+	for _, u := range unique {
+		if bySnap[u.Snap] == nil {
+			snaps = append(snaps, u.Snap)
+		}
+		bySnap[u.Snap] = append(bySnap[u.Snap], u)
+	}
+
+	for i, snapName := range snaps {
+		if i > 0 {
+			fmt.Fprintln(Stdout)
+		}
+		if err := x.explain(snapName, bySnap[snapName]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *cmdSandboxDenials) explain(snapName string, ds []*uniqueDenial) error {
+	conns, err := x.client.Connections(&client.ConnectionOptions{Snap: snapName, All: true})
+	if err != nil {
+		return err
+	}
+	var plugs []client.Plug
+	for _, plug := range conns.Plugs {
+		if plug.Snap == snapName {
+			plugs = append(plugs, plug)
+		}
+	}
+
+	explainer := denials.NewExplainer(snapName)
+	fmt.Fprintf(Stdout, i18n.G("Denials of snap %q:\n"), snapName)
+	for _, d := range ds {
+		if d.count > 1 {
+			fmt.Fprintf(Stdout, i18n.G("  %s (%d times)\n"), d, d.count)
+		} else {
+			fmt.Fprintf(Stdout, "  %s\n", d)
+		}
+
+		ifaces, err := explainer.AllowingInterfaces(d.Denial)
+		if err != nil {
+			return err
+		}
+		if len(ifaces) == 0 {
+			fmt.Fprintln(Stdout, i18n.G("    not permitted by any interface"))
+			continue
+		}
+		fmt.Fprintf(Stdout, i18n.G("    permitted by: %s\n"), strings.Join(ifaces, ", "))
+
+		var connectable, connected []string
+		for _, plug := range plugs {
+			if !strutil.ListContains(ifaces, plug.Interface) {
+				continue
+			}
+			if len(plug.Connections) == 0 {
+				connectable = append(connectable, endpoint(plug.Snap, plug.Name))
+			} else {
+				connected = append(connected, endpoint(plug.Snap, plug.Name))
+			}
+		}
+		switch {
+		case len(connectable) > 0:
+			for _, plug := range connectable {
+				fmt.Fprintf(Stdout, i18n.G("    try: snap connect %s\n"), plug)
+			}
+		case len(connected) > 0:
+			fmt.Fprintf(Stdout, i18n.G("    connected already: %s\n"), strings.Join(connected, ", "))
+		default:
+			fmt.Fprintln(Stdout, i18n.G("    the snap has no plug of these interfaces"))
+		}
+	}
+	return nil
+}
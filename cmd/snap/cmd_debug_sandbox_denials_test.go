@@ -0,0 +1,153 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+	snap "github.com/snapcore/snapd/cmd/snap"
+	"github.com/snapcore/snapd/testutil"
+)
+
+const sandboxDenialsLog = `audit: type=1400 audit(1583932801.123:45): apparmor="DENIED" operation="open" profile="snap.foo.app" name="/dev/video0" pid=1234 comm="foo" requested_mask="wr" denied_mask="wr" fsuid=0 ouid=0
+audit: type=1400 audit(1583932801.523:46): apparmor="DENIED" operation="open" profile="snap.foo.app" name="/dev/video0" pid=1234 comm="foo" requested_mask="wr" denied_mask="wr" fsuid=0 ouid=0
+audit: type=1400 audit(1583932802.123:47): apparmor="DENIED" operation="ptrace" profile="snap.foo.app" pid=1234 comm="foo" requested_mask="trace" denied_mask="trace" peer="unconfined"
+audit: type=1400 audit(1583932802.123:48): apparmor="DENIED" operation="open" profile="/usr/sbin/cupsd" name="/etc/shadow" pid=1237 comm="cupsd" requested_mask="r" denied_mask="r" fsuid=0 ouid=0
+audit: type=1326 audit(1583932805.123:49): auid=1000 uid=1000 gid=1000 ses=2 subj=snap.bar.app (enforce) pid=1238 comm="bar" exe="/usr/bin/bar" sig=0 arch=c000003e syscall=169 compat=0 ip=0x7f0a code=0x50000
+`
+
+func (s *SnapSuite) mockSandboxDenialsConnections(c *check.C, n *int) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		*n++
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/connections")
+		var result client.Connections
+		switch snapName := r.URL.Query().Get("snap"); snapName {
+		case "foo":
+			result.Plugs = []client.Plug{{
+				Snap:      "foo",
+				Name:      "camera",
+				Interface: "camera",
+			}}
+		case "bar":
+			result.Plugs = []client.Plug{{
+				Snap:        "bar",
+				Name:        "docker-support",
+				Interface:   "docker-support",
+				Connections: []client.SlotRef{{Snap: "core", Name: "docker-support"}},
+			}}
+		default:
+			c.Errorf("unexpected snap %q", snapName)
+		}
+		c.Check(r.URL.Query().Get("select"), check.Equals, "all")
+		EncodeResponseBody(c, w, map[string]interface{}{
+			"type":   "sync",
+			"result": result,
+		})
+	})
+}
+
+func (s *SnapSuite) TestSandboxDenialsFromFile(c *check.C) {
+	resolver := testutil.MockCommand(c, "scmp_sys_resolver", "echo reboot")
+	defer resolver.Restore()
+
+	n := 0
+	s.mockSandboxDenialsConnections(c, &n)
+
+	logFile := filepath.Join(c.MkDir(), "log")
+	c.Assert(ioutil.WriteFile(logFile, []byte(sandboxDenialsLog), 0644), check.IsNil)
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "sandbox-denials", "--file", logFile})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `Denials of snap "foo":
+  apparmor: open "/dev/video0" (wr) (2 times)
+    permitted by: camera
+    try: snap connect foo:camera
+  apparmor: ptrace
+    not permitted by any interface
+
+Denials of snap "bar":
+  seccomp: syscall reboot
+    permitted by: docker-support
+    connected already: bar:docker-support
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(n, check.Equals, 2)
+	c.Check(resolver.Calls(), check.DeepEquals, [][]string{
+		{"scmp_sys_resolver", "-a", "x86_64", "169"},
+	})
+}
+
+func (s *SnapSuite) TestSandboxDenialsOfSnapFromKernelLog(c *check.C) {
+	logFile := filepath.Join(c.MkDir(), "log")
+	c.Assert(ioutil.WriteFile(logFile, []byte(sandboxDenialsLog), 0644), check.IsNil)
+	journalctl := testutil.MockCommand(c, "journalctl", "cat "+logFile)
+	defer journalctl.Restore()
+
+	n := 0
+	s.mockSandboxDenialsConnections(c, &n)
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "sandbox-denials", "foo"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `Denials of snap "foo":
+  apparmor: open "/dev/video0" (wr) (2 times)
+    permitted by: camera
+    try: snap connect foo:camera
+  apparmor: ptrace
+    not permitted by any interface
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(n, check.Equals, 1)
+	c.Check(journalctl.Calls(), check.DeepEquals, [][]string{
+		{"journalctl", "-k", "--no-pager", "-o", "cat"},
+	})
+}
+
+func (s *SnapSuite) TestSandboxDenialsNone(c *check.C) {
+	journalctl := testutil.MockCommand(c, "journalctl", "echo 'audit: nothing to see'")
+	defer journalctl.Restore()
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request to %q", r.URL.Path)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "sandbox-denials"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "No sandbox denials of snaps found.\n")
+
+	s.ResetStdStreams()
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"debug", "sandbox-denials", "bar_instance"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "No sandbox denials of snap \"bar_instance\" found.\n")
+}
+
+func (s *SnapSuite) TestSandboxDenialsKernelLogError(c *check.C) {
+	journalctl := testutil.MockCommand(c, "journalctl", "echo 'No journal files were found.' >&2; exit 1")
+	defer journalctl.Restore()
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "sandbox-denials"})
+	c.Assert(err, check.ErrorMatches, `cannot read kernel log: No journal files were found.`)
+}
@@ -0,0 +1,138 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+)
+
+type cmdSecurityProfile struct {
+	clientMixin
+	Backend    string `long:"backend" choice:"apparmor" choice:"seccomp" choice:"dbus" choice:"udev" choice:"mount" choice:"kmod"`
+	Positional struct {
+		App appName `positional-arg-name:"<snap.app>" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+var shortSecurityProfileHelp = i18n.G("Show the security profile of an app")
+var longSecurityProfileHelp = i18n.G(`
+The security-profile command shows the snippets that the interfaces of the
+snap contribute to the security profile of the given app, as they would be
+generated for the current connections, along with the plug, slot or
+connection that contributed each of them.
+`)
+
+func init() {
+	addDebugCommand("security-profile", shortSecurityProfileHelp, longSecurityProfileHelp, func() flags.Commander {
+		return &cmdSecurityProfile{}
+	}, map[string]string{
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"backend": i18n.G("Only show the profile of the given security backend (one of: apparmor, seccomp, dbus, udev, mount, kmod)"),
+	}, []argDesc{{
+		// TRANSLATORS: This needs to be wrapped in <>s.
+		name: "<snap.app>",
+		// TRANSLATORS: This should not start with a lowercase letter.
+		desc: i18n.G("The app to show the security profile of"),
+	}})
+}
+
+type securityProfileSnippet struct {
+	Kind      string          `json:"kind"`
+	Interface string          `json:"interface"`
+	Plug      *client.PlugRef `json:"plug,omitempty"`
+	Slot      *client.SlotRef `json:"slot,omitempty"`
+	Snippet   string          `json:"snippet"`
+}
+
+// source describes the plug, slot or connection the snippet comes from.
+func (s *securityProfileSnippet) source() string {
+	var plug, slot string
+	if s.Plug != nil {
+		plug = endpoint(s.Plug.Snap, s.Plug.Name)
+	}
+	if s.Slot != nil {
+		slot = endpoint(s.Slot.Snap, s.Slot.Name)
+	}
+	switch s.Kind {
+	case "permanent-plug":
+		return fmt.Sprintf(i18n.G("plug %s (%s)"), plug, s.Interface)
+	case "connected-plug":
+		return fmt.Sprintf(i18n.G("plug %s connected to %s (%s)"), plug, slot, s.Interface)
+	case "permanent-slot":
+		return fmt.Sprintf(i18n.G("slot %s (%s)"), slot, s.Interface)
+	case "connected-slot":
+		return fmt.Sprintf(i18n.G("slot %s connected to %s (%s)"), slot, plug, s.Interface)
+	}
+	return s.Interface
+}
+
+func (x *cmdSecurityProfile) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	params := map[string]string{"app": string(x.Positional.App)}
+	if x.Backend != "" {
+		params["backend"] = x.Backend
+	}
+	var resp struct {
+		App         string `json:"app"`
+		SecurityTag string `json:"security-tag"`
+		Profiles    []struct {
+			Backend  string                   `json:"backend"`
+			Snippets []securityProfileSnippet `json:"snippets"`
+		} `json:"profiles"`
+	}
+	if err := x.client.DebugGet("security-profile", &resp, params); err != nil {
+		return err
+	}
+	if len(resp.Profiles) == 0 {
+		fmt.Fprintf(Stdout, i18n.G("No security profiles of %q found.\n"), resp.App)
+		return nil
+	}
+
+	for i, profile := range resp.Profiles {
+		if i > 0 {
+			fmt.Fprintln(Stdout)
+		}
+		fmt.Fprintf(Stdout, i18n.G("%s profile of %s:\n"), profile.Backend, resp.SecurityTag)
+		if len(profile.Snippets) == 0 {
+			fmt.Fprintln(Stdout, i18n.G("  no snippets from interfaces"))
+			continue
+		}
+		for _, snippet := range profile.Snippets {
+			fmt.Fprintf(Stdout, "  # %s\n", snippet.source())
+			for _, line := range strings.Split(snippet.Snippet, "\n") {
+				if line == "" {
+					fmt.Fprintln(Stdout)
+				} else {
+					fmt.Fprintf(Stdout, "  %s\n", line)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+const securityProfileJSON = `{"type": "sync", "result": {
+	"app": "consumer.app",
+	"security-tag": "snap.consumer.app",
+	"profiles": [{
+		"backend": "apparmor",
+		"snippets": [{
+			"kind": "permanent-plug",
+			"interface": "test",
+			"plug": {"snap": "consumer", "plug": "plug"},
+			"snippet": "/permanent/plug r,"
+		}, {
+			"kind": "connected-plug",
+			"interface": "test",
+			"plug": {"snap": "consumer", "plug": "plug"},
+			"slot": {"snap": "core", "slot": "test"},
+			"snippet": "/connected/plug rw,\n\n/other r,"
+		}, {
+			"kind": "connected-slot",
+			"interface": "other",
+			"plug": {"snap": "producer", "plug": "other"},
+			"slot": {"snap": "consumer", "slot": "other"},
+			"snippet": "dbus (send) bus=session,"
+		}]
+	}, {
+		"backend": "kmod",
+		"snippets": []
+	}]
+}}`
+
+func (s *SnapSuite) TestSecurityProfile(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/debug")
+		c.Check(r.URL.Query(), check.DeepEquals, url.Values{
+			"aspect": []string{"security-profile"},
+			"app":    []string{"consumer.app"},
+		})
+		fmt.Fprintln(w, securityProfileJSON)
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "security-profile", "consumer.app"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `apparmor profile of snap.consumer.app:
+  # plug consumer:plug (test)
+  /permanent/plug r,
+  # plug consumer:plug connected to :test (test)
+  /connected/plug rw,
+
+  /other r,
+  # slot consumer:other connected to producer:other (other)
+  dbus (send) bus=session,
+
+kmod profile of snap.consumer.app:
+  no snippets from interfaces
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestSecurityProfileBackend(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Query(), check.DeepEquals, url.Values{
+			"aspect":  []string{"security-profile"},
+			"app":     []string{"consumer"},
+			"backend": []string{"udev"},
+		})
+		fmt.Fprintln(w, `{"type": "sync", "result": {"app": "consumer.consumer", "security-tag": "snap.consumer.consumer", "profiles": []}}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "security-profile", "--backend=udev", "consumer"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "No security profiles of \"consumer.consumer\" found.\n")
+}
+
+func (s *SnapSuite) TestSecurityProfileError(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+		fmt.Fprintln(w, `{"type": "error", "result": {"message": "snap \"consumer\" has no app \"other\"", "kind": "app-not-found"}, "status-code": 404}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"debug", "security-profile", "consumer.other"})
+	c.Assert(err, check.ErrorMatches, `snap "consumer" has no app "other"`)
+
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"debug", "security-profile", "--backend=foo", "consumer.app"})
+	c.Assert(err, check.ErrorMatches, `Invalid value .foo. for option .--backend.*`)
+}
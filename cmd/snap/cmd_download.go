@@ -21,8 +21,10 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/jessevdk/go-flags"
@@ -32,6 +34,7 @@ import (
 	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/image"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
 )
 
 type cmdDownload struct {
@@ -40,9 +43,13 @@ type cmdDownload struct {
 	Basename  string `long:"basename"`
 	TargetDir string `long:"target-directory"`
 
+	WithDependencies bool   `long:"with-dependencies"`
+	Model            string `long:"model"`
+	Bundle           string `long:"bundle"`
+
 	CohortKey  string `long:"cohort"`
 	Positional struct {
-		Snap remoteSnapName
+		Snaps []remoteSnapName `positional-arg-name:"<snap>"`
 	} `positional-args:"true" required:"true"`
 }
 
@@ -50,6 +57,13 @@ var shortDownloadHelp = i18n.G("Download the given snap")
 var longDownloadHelp = i18n.G(`
 The download command downloads the given snap and its supporting assertions
 to the current directory with .snap and .assert file extensions, respectively.
+
+With --with-dependencies the given snaps are downloaded together with
+everything they need to be installed: their bases, the default providers of
+their content plugs and, with --model, the snaps required by the given model
+assertion. A bundle.yaml index listing the snaps in installation order is
+written next to them; with --bundle everything is also put in a single
+tarball. Either can then be installed with 'snap install --bundle'.
 `)
 
 func init() {
@@ -64,6 +78,12 @@ func init() {
 		"basename": i18n.G("Use this basename for the snap and assertion files (defaults to <snap>_<revision>)"),
 		// TRANSLATORS: This should not start with a lowercase letter.
 		"target-directory": i18n.G("Download to this directory (defaults to the current directory)"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"with-dependencies": i18n.G("Also download the bases and default content providers of the snaps, and write a bundle index"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"model": i18n.G("With --with-dependencies, also download the snaps required by the given model assertion"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"bundle": i18n.G("With --with-dependencies, also write the downloaded snaps and their index into this tarball"),
 	}), []argDesc{{
 		name: "<snap>",
 		// TRANSLATORS: This should not start with a lowercase letter.
@@ -97,6 +117,120 @@ func fetchSnapAssertions(tsto *image.ToolingStore, snapPath string, snapInfo *sn
 	return assertPath, err
 }
 
+// downloadSnapAndAssertions downloads the given snap and its
+// supporting assertions, returning the paths of the files written.
+var downloadSnapAndAssertions = func(tsto *image.ToolingStore, snapName string, dlOpts image.DownloadOptions) (snapPath, assertPath string, snapInfo *snap.Info, err error) {
+	fmt.Fprintf(Stdout, i18n.G("Fetching snap %q\n"), snapName)
+	snapPath, snapInfo, err = tsto.DownloadSnap(snapName, dlOpts)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	fmt.Fprintf(Stdout, i18n.G("Fetching assertions for %q\n"), snapName)
+	assertPath, err = fetchSnapAssertions(tsto, snapPath, snapInfo)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return snapPath, assertPath, snapInfo, nil
+}
+
+var newToolingStore = image.NewToolingStore
+
+// snapDependencies returns the names of the snaps that need to be
+// installed before the given one: snapd if it does not use the core
+// snap, its base and the default providers of its content plugs.
+func snapDependencies(info *snap.Info) []string {
+	var deps []string
+	switch info.GetType() {
+	case snap.TypeBase, snap.TypeOS, snap.TypeSnapd:
+	default:
+		// as when installing, without the core snap the snapd snap
+		// is needed for interfaces to work
+		if info.Base != "" && info.Base != "core" {
+			deps = append(deps, "snapd")
+		}
+	}
+	switch {
+	case info.Base != "" && info.Base != "none":
+		deps = append(deps, info.Base)
+	case info.Base == "" && info.GetType() == snap.TypeApp:
+		deps = append(deps, "core")
+	}
+	var providers []string
+	for _, provider := range snap.NeededDefaultProviders(info) {
+		// old-style default-providers are of the form
+		// <snap>:<slot>
+		provider = strings.SplitN(provider, ":", 2)[0]
+		if !strutil.ListContains(deps, provider) && !strutil.ListContains(providers, provider) {
+			providers = append(providers, provider)
+		}
+	}
+	sort.Strings(providers)
+	return append(deps, providers...)
+}
+
+func modelRequiredSnaps(modelFile string) ([]string, error) {
+	data, err := ioutil.ReadFile(modelFile)
+	if err != nil {
+		return nil, err
+	}
+	a, err := asserts.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf(i18n.G("cannot decode model assertion %q: %v"), modelFile, err)
+	}
+	model, ok := a.(*asserts.Model)
+	if !ok {
+		return nil, fmt.Errorf(i18n.G("%q is not a model assertion"), modelFile)
+	}
+	var names []string
+	for _, sn := range model.RequiredNoEssentialSnaps() {
+		names = append(names, sn.SnapName())
+	}
+	return names, nil
+}
+
+func (x *cmdDownload) downloadWithDependencies(tsto *image.ToolingStore, snapNames []string, dlOpts image.DownloadOptions) (*bundleIndex, error) {
+	idx := &bundleIndex{}
+	visited := make(map[string]bool)
+
+	var download func(snapName string, dlOpts image.DownloadOptions) error
+	download = func(snapName string, dlOpts image.DownloadOptions) error {
+		if visited[snapName] {
+			return nil
+		}
+		visited[snapName] = true
+
+		snapPath, assertPath, info, err := downloadSnapAndAssertions(tsto, snapName, dlOpts)
+		if err != nil {
+			return err
+		}
+		// dependencies come from their default channel
+		for _, dep := range snapDependencies(info) {
+			depOpts := image.DownloadOptions{
+				TargetDir:           dlOpts.TargetDir,
+				LeavePartialOnError: true,
+			}
+			if err := download(dep, depOpts); err != nil {
+				return err
+			}
+		}
+		idx.Snaps = append(idx.Snaps, &bundleSnap{
+			Name:       info.SnapName(),
+			Revision:   info.Revision,
+			File:       filepath.Base(snapPath),
+			Assertions: filepath.Base(assertPath),
+		})
+		return nil
+	}
+
+	for _, snapName := range snapNames {
+		if err := download(snapName, dlOpts); err != nil {
+			return nil, err
+		}
+	}
+	return idx, nil
+}
+
 func (x *cmdDownload) Execute(args []string) error {
 	if strings.ContainsRune(x.Basename, filepath.Separator) {
 		return fmt.Errorf(i18n.G("cannot specify a path in basename (use --target-dir for that)"))
@@ -109,6 +243,18 @@ func (x *cmdDownload) Execute(args []string) error {
 		return ErrExtraArgs
 	}
 
+	snapNames := remoteSnapNames(x.Positional.Snaps)
+	if !x.WithDependencies {
+		if len(snapNames) > 1 {
+			return fmt.Errorf(i18n.G("cannot download more than one snap without --with-dependencies"))
+		}
+		if x.Model != "" || x.Bundle != "" {
+			return fmt.Errorf(i18n.G("cannot use --model or --bundle without --with-dependencies"))
+		}
+	} else if x.Basename != "" {
+		return fmt.Errorf(i18n.G("cannot specify a basename with --with-dependencies"))
+	}
+
 	var revision snap.Revision
 	if x.Revision == "" {
 		revision = snap.R(0)
@@ -119,6 +265,9 @@ func (x *cmdDownload) Execute(args []string) error {
 		if x.CohortKey != "" {
 			return fmt.Errorf(i18n.G("cannot specify both cohort and revision"))
 		}
+		if len(snapNames) > 1 {
+			return fmt.Errorf(i18n.G("cannot specify a revision when downloading more than one snap"))
+		}
 		var err error
 		revision, err = snap.ParseRevision(x.Revision)
 		if err != nil {
@@ -126,14 +275,11 @@ func (x *cmdDownload) Execute(args []string) error {
 		}
 	}
 
-	snapName := string(x.Positional.Snap)
-
-	tsto, err := image.NewToolingStore()
+	tsto, err := newToolingStore()
 	if err != nil {
 		return err
 	}
 
-	fmt.Fprintf(Stdout, i18n.G("Fetching snap %q\n"), snapName)
 	dlOpts := image.DownloadOptions{
 		TargetDir: x.TargetDir,
 		Basename:  x.Basename,
@@ -143,13 +289,12 @@ func (x *cmdDownload) Execute(args []string) error {
 		// if something goes wrong, don't force it to start over again
 		LeavePartialOnError: true,
 	}
-	snapPath, snapInfo, err := tsto.DownloadSnap(snapName, dlOpts)
-	if err != nil {
-		return err
+
+	if x.WithDependencies {
+		return x.executeWithDependencies(tsto, snapNames, dlOpts)
 	}
 
-	fmt.Fprintf(Stdout, i18n.G("Fetching assertions for %q\n"), snapName)
-	assertPath, err := fetchSnapAssertions(tsto, snapPath, snapInfo)
+	snapPath, assertPath, _, err := downloadSnapAndAssertions(tsto, snapNames[0], dlOpts)
 	if err != nil {
 		return err
 	}
@@ -170,3 +315,50 @@ func (x *cmdDownload) Execute(args []string) error {
 
 	return nil
 }
+
+func (x *cmdDownload) executeWithDependencies(tsto *image.ToolingStore, snapNames []string, dlOpts image.DownloadOptions) error {
+	if x.Model != "" {
+		required, err := modelRequiredSnaps(x.Model)
+		if err != nil {
+			return err
+		}
+		snapNames = append(snapNames, required...)
+	}
+
+	targetDir := x.TargetDir
+	if targetDir == "" {
+		var err error
+		targetDir, err = os.Getwd()
+		if err != nil {
+			return err
+		}
+	}
+	dlOpts.TargetDir = targetDir
+
+	idx, err := x.downloadWithDependencies(tsto, snapNames, dlOpts)
+	if err != nil {
+		return err
+	}
+	if err := writeBundleIndex(targetDir, idx); err != nil {
+		return fmt.Errorf(i18n.G("cannot write bundle index: %v"), err)
+	}
+
+	bundlePath := targetDir
+	if x.Bundle != "" {
+		if err := writeBundleTarball(x.Bundle, targetDir, idx); err != nil {
+			return fmt.Errorf(i18n.G("cannot write bundle: %v"), err)
+		}
+		bundlePath = x.Bundle
+	}
+
+	// simplify paths
+	wd, _ := os.Getwd()
+	if p, err := filepath.Rel(wd, bundlePath); err == nil {
+		bundlePath = p
+	}
+	fmt.Fprintf(Stdout, i18n.G(`Install the snaps with:
+   snap install --bundle %s
+`), bundlePath)
+
+	return nil
+}
@@ -20,9 +20,20 @@
 package main_test
 
 import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
 	"gopkg.in/check.v1"
 
 	snap "github.com/snapcore/snapd/cmd/snap"
+	"github.com/snapcore/snapd/image"
+	snapdsnap "github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/testutil"
 )
 
 // these only cover errors that happen before hitting the network,
@@ -59,3 +70,184 @@ func (s *SnapSuite) TestDownloadChannelAndRevision(c *check.C) {
 
 	c.Check(err, check.ErrorMatches, "cannot specify both channel and revision")
 }
+
+func (s *SnapSuite) TestDownloadManyWithoutDependencies(c *check.C) {
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{
+		"download", "a-snap", "b-snap",
+	})
+
+	c.Check(err, check.ErrorMatches, "cannot download more than one snap without --with-dependencies")
+}
+
+func (s *SnapSuite) TestDownloadBundleWithoutDependencies(c *check.C) {
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{
+		"download", "--bundle=foo.tar", "a-snap",
+	})
+
+	c.Check(err, check.ErrorMatches, "cannot use --model or --bundle without --with-dependencies")
+}
+
+func (s *SnapSuite) TestDownloadWithDependenciesBasename(c *check.C) {
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{
+		"download", "--with-dependencies", "--basename=foo", "a-snap",
+	})
+
+	c.Check(err, check.ErrorMatches, "cannot specify a basename with --with-dependencies")
+}
+
+func (s *SnapSuite) TestDownloadWithDependenciesRevision(c *check.C) {
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{
+		"download", "--with-dependencies", "--revision=1234", "a-snap", "b-snap",
+	})
+
+	c.Check(err, check.ErrorMatches, "cannot specify a revision when downloading more than one snap")
+}
+
+var downloadTestSnapYamls = map[string]string{
+	"app": `name: app
+version: 1
+base: core18
+plugs:
+  themes:
+    interface: content
+    default-provider: gtk-common-themes:gtk-3-themes
+  other:
+    interface: content
+    default-provider: other-provider
+`,
+	"other-app": `name: other-app
+version: 1
+plugs:
+  other:
+    interface: content
+    default-provider: other-provider
+`,
+	"core-app":          "name: core-app\nversion: 1\nbase: core\n",
+	"bare-app":          "name: bare-app\nversion: 1\nbase: none\n",
+	"snapd":             "name: snapd\nversion: 1\ntype: snapd\n",
+	"core18":            "name: core18\nversion: 1\ntype: base\n",
+	"core":              "name: core\nversion: 1\ntype: os\n",
+	"gtk-common-themes": "name: gtk-common-themes\nversion: 1\n",
+	"other-provider":    "name: other-provider\nversion: 1\nbase: core18\n",
+}
+
+func (s *SnapSuite) mockDownloads(c *check.C) *[]string {
+	var downloaded []string
+	s.AddCleanup(snap.MockDownloadSnapAndAssertions(func(tsto *image.ToolingStore, snapName string, dlOpts image.DownloadOptions) (string, string, *snapdsnap.Info, error) {
+		downloaded = append(downloaded, snapName)
+		info, err := snapdsnap.InfoFromSnapYaml([]byte(downloadTestSnapYamls[snapName]))
+		c.Assert(err, check.IsNil)
+		info.Revision = snapdsnap.R(len(snapName))
+
+		basename := filepath.Join(dlOpts.TargetDir, fmt.Sprintf("%s_%s", snapName, info.Revision))
+		c.Assert(ioutil.WriteFile(basename+".snap", []byte(snapName), 0644), check.IsNil)
+		c.Assert(ioutil.WriteFile(basename+".assert", []byte(snapName+" assertions"), 0644), check.IsNil)
+		return basename + ".snap", basename + ".assert", info, nil
+	}))
+	return &downloaded
+}
+
+func (s *SnapSuite) TestSnapDependencies(c *check.C) {
+	for name, expected := range map[string][]string{
+		"app":            {"snapd", "core18", "gtk-common-themes", "other-provider"},
+		"other-app":      {"core", "other-provider"},
+		"core-app":       {"core"},
+		"bare-app":       {"snapd"},
+		"core18":         nil,
+		"snapd":          nil,
+		"other-provider": {"snapd", "core18"},
+	} {
+		info, err := snapdsnap.InfoFromSnapYaml([]byte(downloadTestSnapYamls[name]))
+		c.Assert(err, check.IsNil)
+		c.Check(snap.SnapDependencies(info), check.DeepEquals, expected, check.Commentf(name))
+	}
+}
+
+func (s *SnapSuite) TestDownloadWithDependencies(c *check.C) {
+	downloaded := s.mockDownloads(c)
+	targetDir := c.MkDir()
+	oldCwd, err := os.Getwd()
+	c.Assert(err, check.IsNil)
+	c.Assert(os.Chdir(targetDir), check.IsNil)
+	defer os.Chdir(oldCwd)
+
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{
+		"download", "--with-dependencies", "app", "other-app",
+	})
+	c.Assert(err, check.IsNil)
+
+	c.Check(*downloaded, check.DeepEquals, []string{"app", "snapd", "core18", "gtk-common-themes", "core", "other-provider", "other-app"})
+	c.Check(filepath.Join(targetDir, "bundle.yaml"), testutil.FileEquals, `snaps:
+- name: snapd
+  revision: "5"
+  file: snapd_5.snap
+  assertions: snapd_5.assert
+- name: core18
+  revision: "6"
+  file: core18_6.snap
+  assertions: core18_6.assert
+- name: core
+  revision: "4"
+  file: core_4.snap
+  assertions: core_4.assert
+- name: gtk-common-themes
+  revision: "17"
+  file: gtk-common-themes_17.snap
+  assertions: gtk-common-themes_17.assert
+- name: other-provider
+  revision: "14"
+  file: other-provider_14.snap
+  assertions: other-provider_14.assert
+- name: app
+  revision: "3"
+  file: app_3.snap
+  assertions: app_3.assert
+- name: other-app
+  revision: "9"
+  file: other-app_9.snap
+  assertions: other-app_9.assert
+`)
+	c.Check(s.Stdout(), check.Equals, "Install the snaps with:\n   snap install --bundle .\n")
+}
+
+func (s *SnapSuite) TestDownloadWithDependenciesTarball(c *check.C) {
+	s.mockDownloads(c)
+	baseDir := c.MkDir()
+	oldCwd, err := os.Getwd()
+	c.Assert(err, check.IsNil)
+	c.Assert(os.Chdir(baseDir), check.IsNil)
+	defer os.Chdir(oldCwd)
+	targetDir := filepath.Join(baseDir, "snaps")
+	c.Assert(os.Mkdir(targetDir, 0755), check.IsNil)
+	tarball := filepath.Join(baseDir, "bundle.tar")
+
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{
+		"download", "--with-dependencies", "--target-directory", targetDir, "--bundle", tarball, "other-provider",
+	})
+	c.Assert(err, check.IsNil)
+
+	f, err := os.Open(tarball)
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+	var names []string
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, check.IsNil)
+		names = append(names, hdr.Name)
+	}
+	sort.Strings(names)
+	c.Check(names, check.DeepEquals, []string{
+		"bundle.yaml",
+		"core18_6.assert",
+		"core18_6.snap",
+		"other-provider_14.assert",
+		"other-provider_14.snap",
+		"snapd_5.assert",
+		"snapd_5.snap",
+	})
+	c.Check(s.Stdout(), check.Equals, "Install the snaps with:\n   snap install --bundle bundle.tar\n")
+}
@@ -193,6 +193,10 @@ var helpCategories = []helpCategory{
 		Label:       i18n.G("Daemons"),
 		Description: i18n.G("manage services"),
 		Commands:    []string{"services", "start", "stop", "restart", "logs"},
+	}, {
+		Label:       i18n.G("Quotas"),
+		Description: i18n.G("manage quota groups of snaps"),
+		Commands:    []string{"set-quota", "quota", "quotas", "remove-quota"},
 	}, {
 		Label:       i18n.G("Commands"),
 		Description: i18n.G("manage aliases"),
@@ -212,11 +216,11 @@ var helpCategories = []helpCategory{
 	}, {
 		Label:       i18n.G("Snapshots"),
 		Description: i18n.G("archives of snap data"),
-		Commands:    []string{"saved", "save", "check-snapshot", "restore", "forget"},
+		Commands:    []string{"saved", "save", "check-snapshot", "restore", "forget", "export-snapshot", "import-snapshot"},
 	}, {
 		Label:       i18n.G("Other"),
 		Description: i18n.G("miscellanea"),
-		Commands:    []string{"version", "warnings", "okay", "ack", "known", "model", "create-cohort"},
+		Commands:    []string{"version", "warnings", "okay", "ack", "known", "model", "create-cohort", "validate", "notices"},
 	}, {
 		Label:       i18n.G("Development"),
 		Description: i18n.G("developer-oriented features"),
@@ -358,6 +358,16 @@ func (iw *infoWriter) maybePrintInstallDate() {
 	fmt.Fprintf(iw, "refresh-date:\t%s\n", iw.fmtTime(iw.localSnap.InstallDate))
 }
 
+func (iw *infoWriter) maybePrintRefreshHold() {
+	if iw.localSnap == nil {
+		return
+	}
+	if iw.localSnap.RefreshHold == nil {
+		return
+	}
+	fmt.Fprintf(iw, "refresh-hold:\t%s\n", iw.fmtTime(*iw.localSnap.RefreshHold))
+}
+
 func (iw *infoWriter) maybePrintChinfo() {
 	if iw.diskSnap != nil {
 		return
@@ -735,6 +745,7 @@ func (x *infoCmd) Execute([]string) error {
 		iw.maybePrintCohortKey()
 		iw.maybePrintTrackingChannel()
 		iw.maybePrintInstallDate()
+		iw.maybePrintRefreshHold()
 		iw.maybePrintChinfo()
 	}
 	w.Flush()
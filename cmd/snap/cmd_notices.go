@@ -0,0 +1,112 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+)
+
+type cmdNotices struct {
+	clientMixin
+	timeMixin
+	Types   []string `long:"type" value-name:"<type>"`
+	Keys    []string `long:"key" value-name:"<key>"`
+	After   string   `long:"after" value-name:"<timestamp>"`
+	Timeout string   `long:"timeout" value-name:"<duration>"`
+}
+
+var shortNoticesHelp = i18n.G("List notices")
+var longNoticesHelp = i18n.G(`
+The notices command lists the notices of system events, such as changes being
+updated, warnings being added, or snaps being installed and removed.
+
+Notices of the same type and key are aggregated: only the last occurrence is
+listed, along with the number of times it occurred.
+
+With --timeout, the command waits up to the given duration for a matching
+notice to occur if none exist yet.
+`)
+
+func init() {
+	addCommand("notices", shortNoticesHelp, longNoticesHelp, func() flags.Commander { return &cmdNotices{} }, timeDescs.also(map[string]string{
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"type": i18n.G("Only list notices of this type (can be repeated)"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"key": i18n.G("Only list notices with this key (can be repeated)"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"after": i18n.G("Only list notices that occurred after this time (in RFC 3339 format)"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"timeout": i18n.G("Wait up to this duration for matching notices to occur"),
+	}), nil)
+}
+
+func (cmd *cmdNotices) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	opts := &client.NoticesOptions{
+		Types: cmd.Types,
+		Keys:  cmd.Keys,
+	}
+	if cmd.After != "" {
+		after, err := time.Parse(time.RFC3339Nano, cmd.After)
+		if err != nil {
+			return fmt.Errorf(i18n.G("invalid --after value %q: %v"), cmd.After, err)
+		}
+		opts.After = after
+	}
+
+	var notices []*client.Notice
+	var err error
+	if cmd.Timeout != "" {
+		var timeout time.Duration
+		timeout, err = time.ParseDuration(cmd.Timeout)
+		if err != nil {
+			return fmt.Errorf(i18n.G("invalid --timeout value %q: %v"), cmd.Timeout, err)
+		}
+		notices, err = cmd.client.WaitNotices(context.Background(), timeout, opts)
+	} else {
+		notices, err = cmd.client.Notices(opts)
+	}
+	if err != nil {
+		return err
+	}
+	if len(notices) == 0 {
+		fmt.Fprintln(Stderr, i18n.G("No matching notices."))
+		return nil
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	fmt.Fprintln(w, i18n.G("ID\tType\tKey\tLast\tOccurrences"))
+	for _, n := range notices {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", n.ID, n.Type, n.Key, cmd.fmtTime(n.LastOccurred), n.Occurrences)
+	}
+	return nil
+}
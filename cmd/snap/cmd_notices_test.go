@@ -0,0 +1,99 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+const twoNoticesJSON = `{"type": "sync", "status-code": 200, "result": [
+	{"id": "2", "type": "snap-installed", "key": "foo", "first-occurred": "2020-09-19T12:41:18Z", "last-occurred": "2020-09-19T12:41:18Z", "occurrences": 1, "expire-after": "168h0m0s"},
+	{"id": "5", "type": "change-update", "key": "42", "first-occurred": "2020-09-19T12:41:18Z", "last-occurred": "2020-09-19T12:44:19Z", "occurrences": 3, "last-data": {"kind": "install", "status": "Done"}, "expire-after": "168h0m0s"}
+]}`
+
+func (s *SnapSuite) TestNotices(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/notices")
+		c.Check(r.URL.Query(), check.HasLen, 0)
+		fmt.Fprintln(w, twoNoticesJSON)
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"notices", "--abs-time"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, ""+
+		"ID   Type            Key  Last                  Occurrences\n"+
+		"2    snap-installed  foo  2020-09-19T12:41:18Z  1\n"+
+		"5    change-update   42   2020-09-19T12:44:19Z  3\n")
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestNoticesFiltersAndTimeout(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(r.URL.Path, check.Equals, "/v2/notices")
+		c.Check(r.URL.Query(), check.DeepEquals, url.Values{
+			"types":   {"snap-installed,change-update"},
+			"keys":    {"foo"},
+			"after":   {"2020-09-19T12:00:00Z"},
+			"timeout": {"30s"},
+		})
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": []}`)
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"notices", "--type=snap-installed", "--type=change-update", "--key=foo", "--after=2020-09-19T12:00:00Z", "--timeout=30s"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(s.Stderr(), check.Equals, "No matching notices.\n")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestNoticesInvalidArgs(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request")
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"notices", "--after=yesterday"})
+	c.Check(err, check.ErrorMatches, `invalid --after value "yesterday": .*`)
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"notices", "--timeout=forever"})
+	c.Check(err, check.ErrorMatches, `invalid --timeout value "forever": .*`)
+}
+
+func (s *SnapSuite) TestNoticesError(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(400)
+		fmt.Fprintln(w, `{"type": "error", "status-code": 400, "result": {"message": "invalid notice type \"foo\""}}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"notices", "--type=foo"})
+	c.Check(err, check.ErrorMatches, `invalid notice type "foo"`)
+}
@@ -20,6 +20,9 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 
@@ -32,6 +35,9 @@ import (
 type cmdPrepareImage struct {
 	Classic      bool   `long:"classic"`
 	Architecture string `long:"arch"`
+	SystemLabel  string `long:"system-label"`
+	Customize    string `long:"customize" value-name:"<json-file>"`
+	Preseed      bool   `long:"preseed"`
 
 	Positional struct {
 		ModelAssertionFn string
@@ -62,6 +68,12 @@ For preparing classic images it supports a --classic mode`),
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"arch": i18n.G("Specify an architecture for snaps for --classic when the model does not"),
 			// TRANSLATORS: This should not start with a lowercase letter.
+			"system-label": i18n.G("Label of the recovery system to add for models with a grade (defaults to the current date)"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"customize": i18n.G("Apply the image customizations from the given JSON file"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"preseed": i18n.G("Preseed the snaps of the classic image, the target directory must be the chroot of the image"),
+			// TRANSLATORS: This should not start with a lowercase letter.
 			"snap": i18n.G("Include the given snap from the store or a local file and/or specify the channel to track for the given snap"),
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"extra-snaps": i18n.G("Extra snaps to be installed (DEPRECATED)"),
@@ -82,14 +94,28 @@ For preparing classic images it supports a --classic mode`),
 		})
 }
 
-var imagePrepare = image.Prepare
+var (
+	imagePrepare = image.Prepare
+	imagePreseed = image.Preseed
+)
 
 func (x *cmdPrepareImage) Execute(args []string) error {
+	if x.Preseed && !x.Classic {
+		return fmt.Errorf(i18n.G("--preseed is only supported with --classic"))
+	}
+
 	opts := &image.Options{
 		Snaps:        x.ExtraSnaps,
 		ModelFile:    x.Positional.ModelAssertionFn,
 		Channel:      x.Channel,
 		Architecture: x.Architecture,
+		Label:        x.SystemLabel,
+	}
+
+	if x.Customize != "" {
+		if err := readCustomizations(x.Customize, &opts.Customizations); err != nil {
+			return err
+		}
 	}
 
 	snaps := make([]string, 0, len(x.Snaps)+len(x.ExtraSnaps))
@@ -119,5 +145,27 @@ func (x *cmdPrepareImage) Execute(args []string) error {
 		opts.GadgetUnpackDir = filepath.Join(x.Positional.Rootdir, "gadget")
 	}
 
-	return imagePrepare(opts)
+	if err := imagePrepare(opts); err != nil {
+		return err
+	}
+
+	if x.Preseed {
+		return imagePreseed(opts.RootDir)
+	}
+	return nil
+}
+
+func readCustomizations(fn string, custo *image.Customizations) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return fmt.Errorf(i18n.G("cannot read image customizations: %v"), err)
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(custo); err != nil {
+		return fmt.Errorf(i18n.G("cannot parse image customizations %q: %v"), fn, err)
+	}
+	return nil
 }
@@ -20,6 +20,10 @@
 package main_test
 
 import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
 	. "gopkg.in/check.v1"
 
 	snap "github.com/snapcore/snapd/cmd/snap"
@@ -115,3 +119,117 @@ func (s *SnapPrepareImageSuite) TestPrepareImageExtraSnaps(c *C) {
 		SnapChannels:    map[string]string{"bar": "t/edge"},
 	})
 }
+
+func (s *SnapPrepareImageSuite) TestPrepareImageSystemLabel(c *C) {
+	var opts *image.Options
+	prep := func(o *image.Options) error {
+		opts = o
+		return nil
+	}
+	r := snap.MockImagePrepare(prep)
+	defer r()
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"prepare-image", "model", "root-dir", "--system-label", "20191122"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+
+	c.Check(opts, DeepEquals, &image.Options{
+		ModelFile:       "model",
+		RootDir:         "root-dir/image",
+		GadgetUnpackDir: "root-dir/gadget",
+		Label:           "20191122",
+	})
+}
+
+func (s *SnapPrepareImageSuite) TestPrepareImageCustomize(c *C) {
+	var opts *image.Options
+	prep := func(o *image.Options) error {
+		opts = o
+		return nil
+	}
+	r := snap.MockImagePrepare(prep)
+	defer r()
+
+	custoFile := filepath.Join(c.MkDir(), "custo.json")
+	err := ioutil.WriteFile(custoFile, []byte(`{
+  "console-conf": "disabled",
+  "cloud-init-dir": "/cloud-init",
+  "system-user": "/su.assert",
+  "extra-assertions": ["/a1.assert", "/a2.assert"],
+  "validation": "ignore"
+}`), 0644)
+	c.Assert(err, IsNil)
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"prepare-image", "model", "root-dir", "--customize", custoFile})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+
+	c.Check(opts, DeepEquals, &image.Options{
+		ModelFile:       "model",
+		RootDir:         "root-dir/image",
+		GadgetUnpackDir: "root-dir/gadget",
+		Customizations: image.Customizations{
+			ConsoleConf:          "disabled",
+			CloudInitDir:         "/cloud-init",
+			SystemUserFile:       "/su.assert",
+			ExtraAssertionsFiles: []string{"/a1.assert", "/a2.assert"},
+			Validation:           "ignore",
+		},
+	})
+}
+
+func (s *SnapPrepareImageSuite) TestPrepareImageCustomizeErrors(c *C) {
+	r := snap.MockImagePrepare(func(o *image.Options) error {
+		c.Fatalf("unexpected call")
+		return nil
+	})
+	defer r()
+
+	d := c.MkDir()
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"prepare-image", "model", "root-dir", "--customize", filepath.Join(d, "missing.json")})
+	c.Check(err, ErrorMatches, `cannot read image customizations: open .*/missing.json: no such file or directory`)
+
+	custoFile := filepath.Join(d, "custo.json")
+	err = ioutil.WriteFile(custoFile, []byte(`{"console-conf": "disabled", "unknown": true}`), 0644)
+	c.Assert(err, IsNil)
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"prepare-image", "model", "root-dir", "--customize", custoFile})
+	c.Check(err, ErrorMatches, `cannot parse image customizations ".*/custo.json": json: unknown field "unknown"`)
+}
+
+func (s *SnapPrepareImageSuite) TestPrepareImageClassicPreseed(c *C) {
+	var calls []string
+	r := snap.MockImagePrepare(func(o *image.Options) error {
+		calls = append(calls, "prepare:"+o.RootDir)
+		return nil
+	})
+	defer r()
+	r = snap.MockImagePreseed(func(chrootDir string) error {
+		calls = append(calls, "preseed:"+chrootDir)
+		return nil
+	})
+	defer r()
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"prepare-image", "--classic", "--preseed", "model", "root-dir"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+
+	c.Check(calls, DeepEquals, []string{"prepare:root-dir", "preseed:root-dir"})
+}
+
+func (s *SnapPrepareImageSuite) TestPrepareImagePreseedErrors(c *C) {
+	r := snap.MockImagePrepare(func(o *image.Options) error {
+		return fmt.Errorf("prepare failed")
+	})
+	defer r()
+	r = snap.MockImagePreseed(func(chrootDir string) error {
+		c.Fatalf("unexpected call")
+		return nil
+	})
+	defer r()
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"prepare-image", "--preseed", "model", "root-dir"})
+	c.Check(err, ErrorMatches, `--preseed is only supported with --classic`)
+
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"prepare-image", "--classic", "--preseed", "model", "root-dir"})
+	c.Check(err, ErrorMatches, `prepare failed`)
+}
@@ -0,0 +1,267 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/strutil"
+)
+
+var shortSetQuotaHelp = i18n.G("Create or update a quota group")
+var longSetQuotaHelp = i18n.G(`
+The set-quota command creates a quota group with the given name if it does not
+exist yet, or updates it otherwise, adding the given snaps to it and setting
+the given limits.
+
+The services of the snaps in a quota group share the limits of the group: the
+memory they can use (e.g. 500MB), the percentage of a single CPU they can use
+(e.g. 50%, or more than 100% on systems with several CPUs), and the number of
+tasks (processes and threads) they can have. A snap can only be in one quota
+group, and running services are restarted when their snap joins a group.
+`)
+
+var shortQuotaHelp = i18n.G("Show quota group")
+var longQuotaHelp = i18n.G(`
+The quota command shows the limits, the snaps and the current resource usage
+of a quota group.
+`)
+
+var shortQuotasHelp = i18n.G("List quota groups")
+var longQuotasHelp = i18n.G(`
+The quotas command lists all the quota groups with their limits and snaps.
+`)
+
+var shortRemoveQuotaHelp = i18n.G("Remove quota group")
+var longRemoveQuotaHelp = i18n.G(`
+The remove-quota command removes the given quota group, lifting its limits off
+its snaps. Running services are restarted to be moved out of the group.
+`)
+
+type cmdSetQuota struct {
+	waitMixin
+
+	Memory     string `long:"memory"`
+	CPU        string `long:"cpu"`
+	Tasks      int    `long:"tasks"`
+	Positional struct {
+		GroupName string              `positional-arg-name:"<group-name>"`
+		Snaps     []installedSnapName `positional-arg-name:"<snap>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+type cmdQuota struct {
+	clientMixin
+
+	Positional struct {
+		GroupName string `positional-arg-name:"<group-name>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+type cmdQuotas struct {
+	clientMixin
+}
+
+type cmdRemoveQuota struct {
+	waitMixin
+
+	Positional struct {
+		GroupName string `positional-arg-name:"<group-name>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func init() {
+	addCommand("set-quota", shortSetQuotaHelp, longSetQuotaHelp, func() flags.Commander { return &cmdSetQuota{} }, waitDescs.also(map[string]string{
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"memory": i18n.G("Memory limit for the quota group (e.g. 500MB)"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"cpu": i18n.G("CPU limit for the quota group, as a percentage of a single CPU (e.g. 50%)"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"tasks": i18n.G("Limit on the number of tasks for the quota group"),
+	}), []argDesc{{
+		// TRANSLATORS: This needs to begin with < and end with >
+		name: i18n.G("<group-name>"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		desc: i18n.G("Name of the quota group"),
+	}, {
+		// TRANSLATORS: This needs to begin with < and end with >
+		name: i18n.G("<snap>"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		desc: i18n.G("Snap to add to the quota group"),
+	}})
+	addCommand("quota", shortQuotaHelp, longQuotaHelp, func() flags.Commander { return &cmdQuota{} }, nil, []argDesc{{
+		// TRANSLATORS: This needs to begin with < and end with >
+		name: i18n.G("<group-name>"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		desc: i18n.G("Name of the quota group"),
+	}})
+	addCommand("quotas", shortQuotasHelp, longQuotasHelp, func() flags.Commander { return &cmdQuotas{} }, nil, nil)
+	addCommand("remove-quota", shortRemoveQuotaHelp, longRemoveQuotaHelp, func() flags.Commander { return &cmdRemoveQuota{} }, waitDescs, []argDesc{{
+		// TRANSLATORS: This needs to begin with < and end with >
+		name: i18n.G("<group-name>"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		desc: i18n.G("Name of the quota group"),
+	}})
+}
+
+func parseCPUPercentage(s string) (int, error) {
+	cpu, err := strconv.Atoi(strings.TrimSuffix(s, "%"))
+	if err != nil || cpu <= 0 {
+		return 0, fmt.Errorf(i18n.G("invalid --cpu value %q: must be a positive percentage"), s)
+	}
+	return cpu, nil
+}
+
+func (x *cmdSetQuota) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	values := &client.QuotaValues{
+		Snaps: installedSnapNames(x.Positional.Snaps),
+	}
+	if x.Memory != "" {
+		mem, err := strutil.ParseByteSize(x.Memory)
+		if err != nil {
+			return fmt.Errorf(i18n.G("invalid --memory value: %v"), err)
+		}
+		values.MemoryLimit = uint64(mem)
+	}
+	if x.CPU != "" {
+		cpu, err := parseCPUPercentage(x.CPU)
+		if err != nil {
+			return err
+		}
+		values.CPUPercentage = cpu
+	}
+	if x.Tasks < 0 {
+		return fmt.Errorf(i18n.G("invalid --tasks value %d: cannot be negative"), x.Tasks)
+	}
+	values.TaskLimit = x.Tasks
+
+	changeID, err := x.client.EnsureQuota(x.Positional.GroupName, values)
+	if err != nil {
+		return err
+	}
+	if _, err := x.wait(changeID); err != nil && err != noWait {
+		return err
+	}
+	return nil
+}
+
+func fmtMemory(mem uint64) string {
+	return strutil.SizeToStr(int64(mem))
+}
+
+func (x *cmdQuota) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	grp, err := x.client.GetQuotaGroup(x.Positional.GroupName)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(Stdout, "name:  %s\n", grp.GroupName)
+	fmt.Fprintln(Stdout, "constraints:")
+	if grp.MemoryLimit != 0 {
+		fmt.Fprintf(Stdout, "  memory:  %s\n", fmtMemory(grp.MemoryLimit))
+	}
+	if grp.CPUPercentage != 0 {
+		fmt.Fprintf(Stdout, "  cpu:     %d%%\n", grp.CPUPercentage)
+	}
+	if grp.TaskLimit != 0 {
+		fmt.Fprintf(Stdout, "  tasks:   %d\n", grp.TaskLimit)
+	}
+	if grp.Usage != nil {
+		fmt.Fprintln(Stdout, "current:")
+		fmt.Fprintf(Stdout, "  memory:  %s\n", fmtMemory(grp.Usage.Memory))
+		fmt.Fprintf(Stdout, "  cpu:     %s\n", time.Duration(grp.Usage.CPU).Round(time.Millisecond))
+		fmt.Fprintf(Stdout, "  tasks:   %d\n", grp.Usage.Tasks)
+	}
+	if len(grp.Snaps) > 0 {
+		fmt.Fprintln(Stdout, "snaps:")
+		for _, snapName := range grp.Snaps {
+			fmt.Fprintf(Stdout, "  - %s\n", snapName)
+		}
+	}
+	return nil
+}
+
+func (x *cmdQuotas) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	grps, err := x.client.Quotas()
+	if err != nil {
+		return err
+	}
+	if len(grps) == 0 {
+		fmt.Fprintln(Stderr, i18n.G("No quota groups defined."))
+		return nil
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	fmt.Fprintln(w, i18n.G("Quota\tMemory\tCPU\tTasks\tSnaps"))
+	for _, grp := range grps {
+		mem, cpu, tasks := "-", "-", "-"
+		if grp.MemoryLimit != 0 {
+			mem = fmtMemory(grp.MemoryLimit)
+		}
+		if grp.CPUPercentage != 0 {
+			cpu = fmt.Sprintf("%d%%", grp.CPUPercentage)
+		}
+		if grp.TaskLimit != 0 {
+			tasks = strconv.Itoa(grp.TaskLimit)
+		}
+		snaps := strings.Join(grp.Snaps, ",")
+		if snaps == "" {
+			snaps = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", grp.GroupName, mem, cpu, tasks, snaps)
+	}
+	return nil
+}
+
+func (x *cmdRemoveQuota) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	changeID, err := x.client.RemoveQuota(x.Positional.GroupName)
+	if err != nil {
+		return err
+	}
+	if _, err := x.wait(changeID); err != nil && err != noWait {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+func (s *SnapSuite) mockQuotaPost(c *check.C, expected map[string]interface{}) *int {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		switch r.URL.Path {
+		case "/v2/quotas":
+			c.Check(r.Method, check.Equals, "POST")
+			var body map[string]interface{}
+			c.Assert(json.NewDecoder(r.Body).Decode(&body), check.IsNil)
+			c.Check(body, check.DeepEquals, expected)
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type": "async", "status-code": 202, "change": "42"}`)
+		case "/v2/changes/42":
+			c.Check(r.Method, check.Equals, "GET")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done"}}`)
+		default:
+			c.Fatalf("unexpected path %q", r.URL.Path)
+		}
+	})
+	return &n
+}
+
+func (s *SnapSuite) TestSetQuota(c *check.C) {
+	n := s.mockQuotaPost(c, map[string]interface{}{
+		"action":         "ensure",
+		"group-name":     "work",
+		"snaps":          []interface{}{"foo", "bar"},
+		"memory-limit":   500000000.0,
+		"cpu-percentage": 50.0,
+		"task-limit":     32.0,
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"set-quota", "work", "foo", "bar", "--memory=500MB", "--cpu=50%", "--tasks=32"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(*n, check.Equals, 2)
+}
+
+func (s *SnapSuite) TestSetQuotaOnlyLimit(c *check.C) {
+	n := s.mockQuotaPost(c, map[string]interface{}{
+		"action":         "ensure",
+		"group-name":     "work",
+		"cpu-percentage": 150.0,
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"set-quota", "work", "--cpu=150"})
+	c.Assert(err, check.IsNil)
+	c.Check(*n, check.Equals, 2)
+}
+
+func (s *SnapSuite) TestSetQuotaNoWait(c *check.C) {
+	n := s.mockQuotaPost(c, map[string]interface{}{
+		"action":     "ensure",
+		"group-name": "work",
+		"task-limit": 8.0,
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"set-quota", "--no-wait", "work", "--tasks=8"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "42\n")
+	c.Check(*n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestSetQuotaInvalidArgs(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request")
+	})
+
+	for _, t := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"set-quota", "work", "--memory=lots"}, `invalid --memory value: cannot parse "lots": .*`},
+		{[]string{"set-quota", "work", "--cpu=half"}, `invalid --cpu value "half": must be a positive percentage`},
+		{[]string{"set-quota", "work", "--cpu=0%"}, `invalid --cpu value "0%": must be a positive percentage`},
+		{[]string{"set-quota", "work", "--tasks=-1"}, `invalid --tasks value -1: cannot be negative`},
+		{[]string{"set-quota"}, `the required argument .* was not provided`},
+	} {
+		_, err := snap.Parser(snap.Client()).ParseArgs(t.args)
+		c.Check(err, check.ErrorMatches, t.err, check.Commentf("%v", t.args))
+	}
+}
+
+func (s *SnapSuite) TestSetQuotaError(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(400)
+		fmt.Fprintln(w, `{"type": "error", "status-code": 400, "result": {"message": "quota group \"work\" must have at least one limit"}}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"set-quota", "work", "foo"})
+	c.Check(err, check.ErrorMatches, `quota group "work" must have at least one limit`)
+}
+
+func (s *SnapSuite) TestQuota(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/quotas/work")
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": {
+			"group-name": "work", "snaps": ["bar", "foo"], "memory-limit": 500000000, "cpu-percentage": 50, "task-limit": 32,
+			"usage": {"memory": 4096000, "cpu": 1500400000, "tasks": 3}}}`)
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"quota", "work"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `name:  work
+constraints:
+  memory:  500MB
+  cpu:     50%
+  tasks:   32
+current:
+  memory:  4MB
+  cpu:     1.5s
+  tasks:   3
+snaps:
+  - bar
+  - foo
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestQuotaNoUsage(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": {"group-name": "work", "task-limit": 32}}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"quota", "work"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, `name:  work
+constraints:
+  tasks:   32
+`)
+}
+
+func (s *SnapSuite) TestQuotas(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/quotas")
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": [
+			{"group-name": "idle", "cpu-percentage": 10},
+			{"group-name": "work", "snaps": ["bar", "foo"], "memory-limit": 500000000, "task-limit": 32}
+		]}`)
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"quotas"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, ""+
+		"Quota  Memory  CPU  Tasks  Snaps\n"+
+		"idle   -       10%  -      -\n"+
+		"work   500MB   -    32     bar,foo\n")
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestQuotasNone(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": []}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"quotas"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(s.Stderr(), check.Equals, "No quota groups defined.\n")
+}
+
+func (s *SnapSuite) TestRemoveQuota(c *check.C) {
+	n := s.mockQuotaPost(c, map[string]interface{}{
+		"action":     "remove",
+		"group-name": "work",
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"remove-quota", "work"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(*n, check.Equals, 2)
+}
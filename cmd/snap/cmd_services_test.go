@@ -168,6 +168,33 @@ func (s *appOpSuite) TestAppOps(c *check.C) {
 	}
 }
 
+func (s *appOpSuite) TestRestartScheduled(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.URL.Path, check.Equals, "/v2/apps")
+			c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+				"action": "restart",
+				"names":  []interface{}{"foo"},
+				"window": "02:00-04:00",
+			})
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type":"async", "change": "42", "status-code": 202}`)
+		case 1:
+			c.Check(r.URL.Path, check.Equals, "/v2/changes/42")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"status": "Scheduled", "scheduled-time": "2031-04-21T02:00:00Z"}}`)
+		default:
+			c.Fatalf("expected to get 2 requests, now on %d", n+1)
+		}
+		n++
+	})
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"restart", "--window", "02:00-04:00", "foo"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Matches, `Change 42 scheduled to start .*\n`)
+	c.Check(n, check.Equals, 2)
+}
+
 func (s *appOpSuite) TestAppStatus(c *check.C) {
 	n := 0
 	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
@@ -219,6 +246,23 @@ foo.zed  enabled  active    -
 	c.Check(n, check.Equals, 1)
 }
 
+func (s *appOpSuite) TestAppStatusUserService(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v2/apps")
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": [
+			{"snap": "foo", "name": "bar", "daemon": "simple", "daemon-scope": "user"},
+			{"snap": "foo", "name": "baz", "daemon": "simple", "active": true, "enabled": true}
+		]}`)
+	})
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"services"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(s.Stdout(), check.Equals, `Service  Startup  Current  Notes
+foo.bar  -        -        user-daemon
+foo.baz  enabled  active   -
+`)
+}
+
 func (s *appOpSuite) TestServiceCompletion(c *check.C) {
 	n := 0
 	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
@@ -65,6 +65,11 @@ Note a later refresh will typically undo a revision override, taking the snap
 back to the current revision of the channel it's tracking.
 
 Use --name to set the instance name when installing from snap file.
+
+Use --bundle to install all the snaps of a bundle written by
+'snap download --with-dependencies', either a directory or a tarball, in a
+single operation: their assertions are acknowledged and either all of the
+snaps get installed or none of them.
 `)
 
 var longRemoveHelp = i18n.G(`
@@ -87,6 +92,11 @@ have developer access to the snap, either directly or through the
 store's collaboration feature, and to be logged in (see 'snap help login').
 
 Note a later refresh will typically undo a revision override.
+
+The --hold option holds automatic refreshes of the given snaps, either for the
+given duration (e.g. --hold=72h) or for the maximum allowed period, while the
+rest of the system keeps refreshing. The --unhold option removes such a hold.
+Explicit refreshes of held snaps are still possible.
 `)
 
 var longTryHelp = i18n.G(`
@@ -112,9 +122,11 @@ and the snap can easily be enabled again.
 
 type cmdRemove struct {
 	waitMixin
+	scheduleMixin
 
 	Revision   string `long:"revision"`
 	Purge      bool   `long:"purge"`
+	DryRun     bool   `long:"dry-run"`
 	Positional struct {
 		Snaps []installedSnapName `positional-arg-name:"<snap>" required:"1"`
 	} `positional-args:"yes" required:"yes"`
@@ -133,6 +145,10 @@ func (x *cmdRemove) removeOne(opts *client.SnapOptions) error {
 		return nil
 	}
 
+	if scheduled, err := x.showScheduled(x.client, changeID); err != nil || scheduled {
+		return err
+	}
+
 	if _, err := x.wait(changeID); err != nil {
 		if err == noWait {
 			return nil
@@ -155,6 +171,10 @@ func (x *cmdRemove) removeMany(opts *client.SnapOptions) error {
 		return err
 	}
 
+	if scheduled, err := x.showScheduled(x.client, changeID); err != nil || scheduled {
+		return err
+	}
+
 	chg, err := x.wait(changeID)
 	if err != nil {
 		if err == noWait {
@@ -186,14 +206,31 @@ func (x *cmdRemove) removeMany(opts *client.SnapOptions) error {
 }
 
 func (x *cmdRemove) Execute([]string) error {
-	opts := &client.SnapOptions{Revision: x.Revision, Purge: x.Purge}
+	scheduleOpts, err := x.scheduleOptions()
+	if err != nil {
+		return err
+	}
+	if x.DryRun && x.asksForSchedule() {
+		return errors.New(i18n.G("cannot use --dry-run with --at or --window"))
+	}
+
+	opts := &client.SnapOptions{Revision: x.Revision, Purge: x.Purge, ScheduleOptions: scheduleOpts}
 	if len(x.Positional.Snaps) == 1 {
+		if x.DryRun {
+			return showChangePlan(x.client, "remove", installedSnapNames(x.Positional.Snaps), opts)
+		}
 		return x.removeOne(opts)
 	}
 
 	if x.Revision != "" {
 		return errors.New(i18n.G("a single snap name is needed to specify the revision"))
 	}
+	if x.DryRun {
+		return showChangePlan(x.client, "remove", installedSnapNames(x.Positional.Snaps), nil)
+	}
+	if x.asksForSchedule() {
+		return x.removeMany(&client.SnapOptions{ScheduleOptions: scheduleOpts})
+	}
 	return x.removeMany(nil)
 }
 
@@ -441,6 +478,8 @@ type cmdInstall struct {
 	Name string `long:"name"`
 
 	Cohort     string `long:"cohort"`
+	DryRun     bool   `long:"dry-run"`
+	Bundle     string `long:"bundle"`
 	Positional struct {
 		Snaps []remoteSnapName `positional-arg-name:"<snap>"`
 	} `positional-args:"yes" required:"yes"`
@@ -547,6 +586,48 @@ func (x *cmdInstall) installMany(names []string, opts *client.SnapOptions) error
 	return nil
 }
 
+// installBundle acknowledges the assertions of all the snaps in the
+// bundle and then installs all of them in a single change.
+func (x *cmdInstall) installBundle(opts *client.SnapOptions) error {
+	dir, idx, cleanup, err := openBundle(x.Bundle)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	paths := make([]string, len(idx.Snaps))
+	for i, bs := range idx.Snaps {
+		if err := ackFile(x.client, filepath.Join(dir, bs.Assertions)); err != nil {
+			return fmt.Errorf(i18n.G("cannot acknowledge assertions for snap %q: %v"), bs.Name, err)
+		}
+		paths[i] = filepath.Join(dir, bs.File)
+	}
+
+	if len(paths) == 1 {
+		return x.installOne(paths[0], "", opts)
+	}
+
+	changeID, err := x.client.InstallPathMany(paths, opts)
+	if err != nil {
+		return err
+	}
+
+	chg, err := x.wait(changeID)
+	if err != nil {
+		if err == noWait {
+			return nil
+		}
+		return err
+	}
+
+	var installed []string
+	if err := chg.Get("snap-names", &installed); err != nil {
+		return err
+	}
+
+	return showDone(x.client, installed, "install", opts, x.getEscapes())
+}
+
 func (x *cmdInstall) Execute([]string) error {
 	if err := x.setChannelFromCommandline(); err != nil {
 		return err
@@ -566,6 +647,15 @@ func (x *cmdInstall) Execute([]string) error {
 	x.setModes(opts)
 
 	names := remoteSnapNames(x.Positional.Snaps)
+	if x.Bundle != "" {
+		if len(names) > 0 {
+			return errors.New(i18n.G("cannot install snaps by name together with a bundle"))
+		}
+		if x.asksForChannel() || x.Revision != "" || x.Cohort != "" || x.Name != "" || x.DryRun {
+			return errors.New(i18n.G("cannot use --channel, --revision, --cohort, --name or --dry-run with --bundle"))
+		}
+		return x.installBundle(opts)
+	}
 	if len(names) == 0 {
 		return errors.New(i18n.G("cannot install zero snaps"))
 	}
@@ -575,7 +665,21 @@ func (x *cmdInstall) Execute([]string) error {
 		}
 	}
 
+	if x.DryRun {
+		for _, name := range names {
+			if strings.Contains(name, "/") || strings.HasSuffix(name, ".snap") || strings.Contains(name, ".snap.") {
+				return errors.New(i18n.G("cannot use --dry-run when installing snap files"))
+			}
+		}
+	}
+
 	if len(names) == 1 {
+		if x.DryRun {
+			if x.Name != "" {
+				return errors.New(i18n.G("cannot use --dry-run with an instance name"))
+			}
+			return showChangePlan(x.client, "install", names, opts)
+		}
 		return x.installOne(names[0], x.Name, opts)
 	}
 
@@ -586,6 +690,9 @@ func (x *cmdInstall) Execute([]string) error {
 	if x.Name != "" {
 		return errors.New(i18n.G("cannot use instance name when installing multiple snaps"))
 	}
+	if x.DryRun {
+		return showChangePlan(x.client, "install", names, nil)
+	}
 	return x.installMany(names, nil)
 }
 
@@ -595,6 +702,7 @@ type cmdRefresh struct {
 	waitMixin
 	channelMixin
 	modeMixin
+	scheduleMixin
 
 	Amend            bool   `long:"amend"`
 	Revision         string `long:"revision"`
@@ -603,6 +711,9 @@ type cmdRefresh struct {
 	List             bool   `long:"list"`
 	Time             bool   `long:"time"`
 	IgnoreValidation bool   `long:"ignore-validation"`
+	Hold             string `long:"hold" optional:"true" optional-value:"max" default-mask:"-"`
+	Unhold           bool   `long:"unhold"`
+	DryRun           bool   `long:"dry-run"`
 	Positional       struct {
 		Snaps []installedSnapName `positional-arg-name:"<snap>"`
 	} `positional-args:"yes"`
@@ -614,6 +725,10 @@ func (x *cmdRefresh) refreshMany(snaps []string, opts *client.SnapOptions) error
 		return err
 	}
 
+	if scheduled, err := x.showScheduled(x.client, changeID); err != nil || scheduled {
+		return err
+	}
+
 	chg, err := x.wait(changeID)
 	if err != nil {
 		if err == noWait {
@@ -647,6 +762,10 @@ func (x *cmdRefresh) refreshOne(name string, opts *client.SnapOptions) error {
 		return nil
 	}
 
+	if scheduled, err := x.showScheduled(x.client, changeID); err != nil || scheduled {
+		return err
+	}
+
 	if _, err := x.wait(changeID); err != nil {
 		if err == noWait {
 			return nil
@@ -659,6 +778,37 @@ func (x *cmdRefresh) refreshOne(name string, opts *client.SnapOptions) error {
 	return showDone(x.client, []string{name}, "refresh", opts, x.getEscapes())
 }
 
+func (x *cmdRefresh) holdRefreshes(names []string) error {
+	var holdUntil time.Time
+	if x.Hold != "max" {
+		dur, err := time.ParseDuration(x.Hold)
+		if err != nil {
+			return fmt.Errorf(i18n.G("cannot parse hold duration: %v"), err)
+		}
+		holdUntil = time.Now().Add(dur)
+	}
+
+	for _, name := range names {
+		held, err := x.client.HoldRefresh(name, holdUntil)
+		if err != nil {
+			return err
+		}
+		// TRANSLATORS: the first %q is a snap name, the second %s is a time
+		fmt.Fprintf(Stdout, i18n.G("Auto-refresh of %q held until %s\n"), name, x.fmtTime(held))
+	}
+	return nil
+}
+
+func (x *cmdRefresh) unholdRefreshes(names []string) error {
+	for _, name := range names {
+		if err := x.client.UnholdRefresh(name); err != nil {
+			return err
+		}
+		fmt.Fprintf(Stdout, i18n.G("Auto-refresh of %q is no longer held\n"), name)
+	}
+	return nil
+}
+
 func parseSysinfoTime(s string) time.Time {
 	t, err := time.Parse(time.RFC3339, s)
 	if err != nil {
@@ -742,6 +892,17 @@ func (x *cmdRefresh) Execute([]string) error {
 		return err
 	}
 
+	if x.DryRun && (x.Time || x.List) {
+		return errors.New(i18n.G("--dry-run cannot be used with --time or --list"))
+	}
+	if x.asksForSchedule() && (x.Time || x.List || x.DryRun) {
+		return errors.New(i18n.G("--at and --window cannot be used with --time, --list or --dry-run"))
+	}
+	scheduleOpts, err := x.scheduleOptions()
+	if err != nil {
+		return err
+	}
+
 	if x.Time {
 		if x.asksForMode() || x.asksForChannel() {
 			return errors.New(i18n.G("--time does not take mode or channel flags"))
@@ -757,6 +918,23 @@ func (x *cmdRefresh) Execute([]string) error {
 		return x.listRefresh()
 	}
 
+	if x.Hold != "" || x.Unhold {
+		if x.Hold != "" && x.Unhold {
+			return errors.New(i18n.G("cannot use --hold and --unhold together"))
+		}
+		if len(x.Positional.Snaps) == 0 {
+			return errors.New(i18n.G("--hold and --unhold need at least one snap name"))
+		}
+		if x.asksForMode() || x.asksForChannel() || x.Revision != "" || x.Amend || x.IgnoreValidation || x.Cohort != "" || x.LeaveCohort || x.DryRun || x.asksForSchedule() {
+			return errors.New(i18n.G("--hold and --unhold do not take other refresh options"))
+		}
+		names := installedSnapNames(x.Positional.Snaps)
+		if x.Unhold {
+			return x.unholdRefreshes(names)
+		}
+		return x.holdRefreshes(names)
+	}
+
 	if len(x.Positional.Snaps) == 0 && os.Getenv("SNAP_REFRESH_FROM_TIMER") == "1" {
 		fmt.Fprintf(Stdout, "Ignoring `snap refresh` from the systemd timer")
 		return nil
@@ -771,8 +949,12 @@ func (x *cmdRefresh) Execute([]string) error {
 			Revision:         x.Revision,
 			CohortKey:        x.Cohort,
 			LeaveCohort:      x.LeaveCohort,
+			ScheduleOptions:  scheduleOpts,
 		}
 		x.setModes(opts)
+		if x.DryRun {
+			return showChangePlan(x.client, "refresh", names, opts)
+		}
 		return x.refreshOne(names[0], opts)
 	}
 
@@ -784,6 +966,12 @@ func (x *cmdRefresh) Execute([]string) error {
 		return errors.New(i18n.G("a single snap name must be specified when ignoring validation"))
 	}
 
+	if x.DryRun {
+		return showChangePlan(x.client, "refresh", names, nil)
+	}
+	if x.asksForSchedule() {
+		return x.refreshMany(names, &client.SnapOptions{ScheduleOptions: scheduleOpts})
+	}
 	return x.refreshMany(names, nil)
 }
 
@@ -1039,13 +1227,75 @@ func (x cmdSwitch) Execute(args []string) error {
 	return showDone(x.client, []string{name}, "switch", opts, nil)
 }
 
+// showChangePlan asks snapd what the given action on the given snaps
+// would do, without doing it, and shows the answer.
+func showChangePlan(cli *client.Client, action string, names []string, opts *client.SnapOptions) error {
+	plan, err := cli.PlanSnapAction(action, names, opts)
+	if err != nil {
+		return err
+	}
+
+	if len(plan.Conflicts) > 0 {
+		fmt.Fprintf(Stdout, i18n.G("Cannot %s now:\n"), action)
+		for _, conflict := range plan.Conflicts {
+			fmt.Fprintf(Stdout, "  %s\n", conflict.Message)
+		}
+		return nil
+	}
+
+	fmt.Fprintf(Stdout, i18n.G("Would: %s\n"), plan.Summary)
+
+	w := tabWriter()
+	if len(plan.Snaps) > 0 {
+		fmt.Fprintln(w, i18n.G("\nSnap\tAction\tRev\tTracking\tDownload\tNotes"))
+		for _, planned := range plan.Snaps {
+			size := "-"
+			if planned.DownloadSize > 0 {
+				size = strutil.SizeToStr(planned.DownloadSize)
+			}
+			notes := "-"
+			if len(planned.RequiredBy) > 0 {
+				// TRANSLATORS: %s is a comma separated list of snap names
+				notes = fmt.Sprintf(i18n.G("required by %s"), strings.Join(planned.RequiredBy, ","))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", planned.Name, planned.Action, fmtRevision(planned.Revision), fmtChannel(planned.Channel), size, notes)
+		}
+	}
+	if len(plan.AutoConnections) > 0 {
+		fmt.Fprintln(w, i18n.G("\nInterface\tPlug\tSlot"))
+		for _, conn := range plan.AutoConnections {
+			fmt.Fprintf(w, "%s\t%s:%s\t%s:%s\n", conn.Interface, conn.Plug.Snap, conn.Plug.Name, conn.Slot.Snap, conn.Slot.Name)
+		}
+	}
+	if len(plan.Tasks) > 0 {
+		fmt.Fprintln(w, i18n.G("\nID\tTask\tWaits for\tSummary"))
+		for _, t := range plan.Tasks {
+			waits := "-"
+			if len(t.WaitTasks) > 0 {
+				waits = strings.Join(t.WaitTasks, ",")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", t.ID, t.Kind, waits, t.Summary)
+		}
+	}
+	return w.Flush()
+}
+
+func fmtRevision(rev string) string {
+	if rev == "" {
+		return "-"
+	}
+	return rev
+}
+
 func init() {
 	addCommand("remove", shortRemoveHelp, longRemoveHelp, func() flags.Commander { return &cmdRemove{} },
-		waitDescs.also(map[string]string{
+		waitDescs.also(scheduleDescs).also(map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"revision": i18n.G("Remove only the given revision"),
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"purge": i18n.G("Remove the snap without saving a snapshot of its data"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"dry-run": i18n.G("Show what removing the snaps would do, without doing it"),
 		}), nil)
 	addCommand("install", shortInstallHelp, longInstallHelp, func() flags.Commander { return &cmdInstall{} },
 		colorDescs.also(waitDescs).also(channelDescs).also(modeDescs).also(map[string]string{
@@ -1061,9 +1311,13 @@ func init() {
 			"name": i18n.G("Install the snap file under the given instance name"),
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"cohort": i18n.G("Install the snap in the given cohort"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"dry-run": i18n.G("Show what installing the snaps would do, without doing it"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"bundle": i18n.G("Install all the snaps in the given bundle, as written by 'snap download --with-dependencies'"),
 		}), nil)
 	addCommand("refresh", shortRefreshHelp, longRefreshHelp, func() flags.Commander { return &cmdRefresh{} },
-		colorDescs.also(waitDescs).also(channelDescs).also(modeDescs).also(timeDescs).also(map[string]string{
+		colorDescs.also(waitDescs).also(channelDescs).also(modeDescs).also(timeDescs).also(scheduleDescs).also(map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"amend": i18n.G("Allow refresh attempt on snap unknown to the store"),
 			// TRANSLATORS: This should not start with a lowercase letter.
@@ -1078,6 +1332,12 @@ func init() {
 			"cohort": i18n.G("Refresh the snap into the given cohort"),
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"leave-cohort": i18n.G("Refresh the snap out of its cohort"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"hold": i18n.G("Hold automatic refreshes of the given snaps for the given duration (or the maximum allowed)"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"unhold": i18n.G("Remove the hold on automatic refreshes of the given snaps"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"dry-run": i18n.G("Show what refreshing the snaps would do, without doing it"),
 		}), nil)
 	addCommand("try", shortTryHelp, longTryHelp, func() flags.Commander { return &cmdTry{} }, waitDescs.also(modeDescs), nil)
 	addCommand("enable", shortEnableHelp, longEnableHelp, func() flags.Commander { return &cmdEnable{} }, waitDescs, nil)
@@ -1137,6 +1137,77 @@ next: 2017-04-26T00:58:00+02:00 (but held)
 	c.Check(n, check.Equals, 1)
 }
 
+func (s *SnapSuite) TestRefreshHoldSnaps(c *check.C) {
+	var holdUntil []string
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		body := DecodedRequestBody(c, r)
+		c.Check(body["action"], check.Equals, "hold")
+		holdUntil = append(holdUntil, body["hold-until"].(string))
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": {"hold-until": "2017-04-28T00:00:00+02:00"}}`)
+	})
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"refresh", "--hold=72h", "--abs-time", "foo", "bar"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(holdUntil, check.HasLen, 2)
+	c.Check(s.Stdout(), check.Equals, `Auto-refresh of "foo" held until 2017-04-28T00:00:00+02:00
+Auto-refresh of "bar" held until 2017-04-28T00:00:00+02:00
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *SnapSuite) TestRefreshHoldSnapMaximum(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v2/snaps/foo")
+		c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+			"action": "hold",
+		})
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": {"hold-until": "2017-04-28T00:00:00+02:00"}}`)
+		n++
+	})
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"refresh", "--hold", "--abs-time", "foo"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "Auto-refresh of \"foo\" held until 2017-04-28T00:00:00+02:00\n")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestRefreshUnholdSnap(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v2/snaps/foo")
+		c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+			"action": "unhold",
+		})
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": null}`)
+		n++
+	})
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"refresh", "--unhold", "foo"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "Auto-refresh of \"foo\" is no longer held\n")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapSuite) TestRefreshHoldErrors(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request")
+	})
+	for _, t := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"refresh", "--hold"}, "--hold and --unhold need at least one snap name"},
+		{[]string{"refresh", "--hold", "--unhold", "foo"}, "cannot use --hold and --unhold together"},
+		{[]string{"refresh", "--hold", "--channel=edge", "foo"}, "--hold and --unhold do not take other refresh options"},
+		{[]string{"refresh", "--hold=forever", "foo"}, `cannot parse hold duration: .*`},
+	} {
+		_, err := snap.Parser(snap.Client()).ParseArgs(t.args)
+		c.Check(err, check.ErrorMatches, t.err, check.Commentf("%v", t.args))
+	}
+}
+
 func (s *SnapSuite) TestRefreshNoTimerNoSchedule(c *check.C) {
 	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
 		c.Check(r.Method, check.Equals, "GET")
@@ -1676,6 +1747,180 @@ func (s *SnapOpSuite) TestRemoveMany(c *check.C) {
 	c.Check(n, check.Equals, total)
 }
 
+func (s *SnapOpSuite) TestInstallDryRun(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(n, check.Equals, 0)
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v2/snaps/foo")
+		c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+			"action":  "install",
+			"channel": "beta",
+			"dry-run": true,
+		})
+		fmt.Fprintln(w, `{"type": "sync", "result": {
+"summary": "Install \"foo\" snap from \"beta\" channel",
+"tasks": [
+  {"id": "1", "kind": "prerequisites", "summary": "Ensure prerequisites for \"foo\" are available"},
+  {"id": "2", "kind": "download-snap", "summary": "Download snap \"foo\" (7) from channel \"beta\"", "wait-tasks": ["1"]}
+],
+"snaps": [
+  {"name": "foo", "action": "install", "revision": "7", "channel": "beta", "download-size": 2000000},
+  {"name": "core18", "action": "install", "required-by": ["foo"]}
+],
+"auto-connections": [
+  {"plug": {"snap": "foo", "plug": "network"}, "slot": {"snap": "core", "slot": "network"}, "interface": "network"}
+]}}`)
+		n++
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"install", "--dry-run", "--beta", "foo"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Equals, `Would: Install "foo" snap from "beta" channel
+
+Snap    Action   Rev  Tracking  Download  Notes
+foo     install  7    beta      2MB       -
+core18  install  -    -         -         required by foo
+
+Interface  Plug         Slot
+network    foo:network  core:network
+
+ID   Task           Waits for  Summary
+1    prerequisites  -          Ensure prerequisites for "foo" are available
+2    download-snap  1          Download snap "foo" (7) from channel "beta"
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapOpSuite) TestInstallDryRunConflict(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "sync", "result": {
+"summary": "",
+"conflicts": [
+  {"snap": "foo", "change-kind": "refresh-snap", "change-id": "42", "message": "snap \"foo\" has \"refresh-snap\" change in progress"}
+]}}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"install", "--dry-run", "foo"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, `Cannot install now:
+  snap "foo" has "refresh-snap" change in progress
+`)
+}
+
+func (s *SnapOpSuite) TestInstallDryRunSnapFile(c *check.C) {
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"install", "--dry-run", "./foo.snap"})
+	c.Assert(err, check.ErrorMatches, "cannot use --dry-run when installing snap files")
+}
+
+func (s *SnapOpSuite) TestRemoveManyDryRun(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v2/snaps")
+		c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+			"action":  "remove",
+			"snaps":   []interface{}{"one", "two"},
+			"dry-run": true,
+		})
+		fmt.Fprintln(w, `{"type": "sync", "result": {
+"summary": "Remove snaps \"one\", \"two\"",
+"snaps": [{"name": "one", "action": "remove"}, {"name": "two", "action": "remove"}]}}`)
+		n++
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"remove", "--dry-run", "one", "two"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, `Would: Remove snaps "one", "two"
+
+Snap  Action  Rev  Tracking  Download  Notes
+one   remove  -    -         -         -
+two   remove  -    -         -         -
+`)
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *SnapOpSuite) TestRefreshDryRunList(c *check.C) {
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"refresh", "--dry-run", "--list"})
+	c.Assert(err, check.ErrorMatches, "--dry-run cannot be used with --time or --list")
+}
+
+func (s *SnapOpSuite) TestRefreshScheduled(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "POST")
+			c.Check(r.URL.Path, check.Equals, "/v2/snaps/foo")
+			c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+				"action": "refresh",
+				"at":     "2031-04-22T02:00:00Z",
+			})
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type":"async", "change": "42", "status-code": 202}`)
+		case 1:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/changes/42")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"status": "Scheduled", "scheduled-time": "2031-04-22T02:00:00Z"}}`)
+		default:
+			c.Fatalf("expected to get 2 requests, now on %d", n+1)
+		}
+		n++
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"refresh", "--at", "2031-04-22T02:00:00Z", "foo"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Matches, `Change 42 scheduled to start .*\n`)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(n, check.Equals, 2)
+}
+
+func (s *SnapOpSuite) TestRemoveManyScheduled(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.URL.Path, check.Equals, "/v2/snaps")
+			c.Check(DecodedRequestBody(c, r), check.DeepEquals, map[string]interface{}{
+				"action": "remove",
+				"snaps":  []interface{}{"one", "two"},
+				"window": "mon,02:00-04:00",
+			})
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type":"async", "change": "42", "status-code": 202}`)
+		case 1:
+			c.Check(r.URL.Path, check.Equals, "/v2/changes/42")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"status": "Scheduled", "scheduled-time": "2031-04-21T02:00:00Z"}}`)
+		default:
+			c.Fatalf("expected to get 2 requests, now on %d", n+1)
+		}
+		n++
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"remove", "--window", "mon,02:00-04:00", "one", "two"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Matches, `Change 42 scheduled to start .*\n`)
+	c.Check(n, check.Equals, 2)
+}
+
+func (s *SnapOpSuite) TestRefreshScheduleErrors(c *check.C) {
+	for _, t := range []struct {
+		args   []string
+		errmsg string
+	}{
+		{[]string{"refresh", "--at", "10:00", "--window", "10:00-12:00", "foo"}, "cannot use --at and --window together"},
+		{[]string{"refresh", "--at", "potato", "foo"}, `cannot parse time "potato": expected RFC 3339, YYYY-MM-DD HH:MM or HH:MM`},
+		{[]string{"refresh", "--at", "10:00", "--list"}, "--at and --window cannot be used with --time, --list or --dry-run"},
+		{[]string{"refresh", "--window", "10:00-12:00", "--hold", "foo"}, "--hold and --unhold do not take other refresh options"},
+		{[]string{"remove", "--at", "10:00", "--dry-run", "foo"}, "cannot use --dry-run with --at or --window"},
+	} {
+		_, err := snap.Parser(snap.Client()).ParseArgs(t.args)
+		c.Check(err, check.ErrorMatches, t.errmsg, check.Commentf("%v", t.args))
+	}
+}
+
 func (s *SnapOpSuite) TestInstallManyChannel(c *check.C) {
 	s.RedirectClientToTestServer(nil)
 	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"install", "--beta", "one", "two"})
@@ -1734,6 +1979,110 @@ func (s *SnapOpSuite) TestInstallMany(c *check.C) {
 	c.Check(n, check.Equals, total)
 }
 
+func (s *SnapOpSuite) TestInstallBundle(c *check.C) {
+	bundleDir := c.MkDir()
+	for name, content := range map[string]string{
+		"bundle.yaml": `snaps:
+- name: one
+  revision: "1"
+  file: one_1.snap
+  assertions: one_1.assert
+- name: two
+  revision: "2"
+  file: two_2.snap
+  assertions: two_2.assert
+`,
+		"one_1.snap":   "one-data",
+		"one_1.assert": "one-assertions",
+		"two_2.snap":   "two-data",
+		"two_2.assert": "two-assertions",
+	} {
+		c.Assert(ioutil.WriteFile(filepath.Join(bundleDir, name), []byte(content), 0644), check.IsNil)
+	}
+
+	total := 6
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0, 1:
+			c.Check(r.Method, check.Equals, "POST")
+			c.Check(r.URL.Path, check.Equals, "/v2/assertions")
+			body, err := ioutil.ReadAll(r.Body)
+			c.Assert(err, check.IsNil)
+			c.Check(string(body), check.Equals, []string{"one-assertions", "two-assertions"}[n])
+			fmt.Fprintln(w, `{"type": "sync", "result": {}}`)
+		case 2:
+			c.Check(r.Method, check.Equals, "POST")
+			c.Check(r.URL.Path, check.Equals, "/v2/snaps")
+			form := testForm(r, c)
+			defer form.RemoveAll()
+
+			c.Check(form.Value["action"], check.DeepEquals, []string{"install"})
+			c.Assert(form.File["snap"], check.HasLen, 2)
+			for i, expected := range []struct{ filename, content string }{
+				{"one_1.snap", "one-data"},
+				{"two_2.snap", "two-data"},
+			} {
+				c.Check(form.File["snap"][i].Filename, check.Equals, expected.filename)
+				f, err := form.File["snap"][i].Open()
+				c.Assert(err, check.IsNil)
+				body, err := ioutil.ReadAll(f)
+				f.Close()
+				c.Assert(err, check.IsNil)
+				c.Check(string(body), check.Equals, expected.content)
+			}
+
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type":"async", "change": "42", "status-code": 202}`)
+		case 3:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/changes/42")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"status": "Doing"}}`)
+		case 4:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/changes/42")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done", "data": {"snap-names": ["one","two"]}}}`)
+		case 5:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/snaps")
+			fmt.Fprintf(w, `{"type": "sync", "result": [{"name": "one", "status": "active", "version": "1.0", "developer": "bar", "publisher": {"id": "bar-id", "username": "bar", "display-name": "Bar", "validation": "unproven"}, "revision":1, "channel":"stable"},{"name": "two", "status": "active", "version": "2.0", "developer": "baz", "publisher": {"id": "baz-id", "username": "baz", "display-name": "Baz", "validation": "unproven"}, "revision":2, "channel":"stable"}]}\n`)
+		default:
+			c.Fatalf("expected to get %d requests, now on %d", total, n+1)
+		}
+
+		n++
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"install", "--bundle", bundleDir})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Matches, `(?sm).*one 1.0 from Bar installed`)
+	c.Check(s.Stdout(), check.Matches, `(?sm).*two 2.0 from Baz installed`)
+	c.Check(s.Stderr(), check.Equals, "")
+	// ensure that the fake server api was actually hit
+	c.Check(n, check.Equals, total)
+}
+
+func (s *SnapOpSuite) TestInstallBundleBadIndex(c *check.C) {
+	bundleDir := c.MkDir()
+	c.Assert(ioutil.WriteFile(filepath.Join(bundleDir, "bundle.yaml"), []byte(`snaps:
+- name: one
+  revision: "1"
+  file: one_1.snap
+  assertions: one_1.assert
+`), 0644), check.IsNil)
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"install", "--bundle", bundleDir})
+	c.Assert(err, check.ErrorMatches, `.*one_1.snap.*`)
+}
+
+func (s *SnapOpSuite) TestInstallBundleConflicts(c *check.C) {
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"install", "--bundle", "foo.tar", "bar"})
+	c.Check(err, check.ErrorMatches, "cannot install snaps by name together with a bundle")
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"install", "--bundle", "foo.tar", "--channel", "edge"})
+	c.Check(err, check.ErrorMatches, `cannot use --channel, --revision, --cohort, --name or --dry-run with --bundle`)
+}
+
 func (s *SnapOpSuite) TestInstallZeroEmpty(c *check.C) {
 	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"install"})
 	c.Assert(err, check.ErrorMatches, "cannot install zero snaps")
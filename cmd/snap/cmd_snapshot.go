@@ -21,12 +21,16 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
 	"strconv"
 	"strings"
 
 	"github.com/jessevdk/go-flags"
 
 	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/strutil"
 	"github.com/snapcore/snapd/strutil/quantity"
 )
@@ -41,6 +45,8 @@ var (
 	shortForgetHelp  = i18n.G("Delete a snapshot")
 	shortCheckHelp   = i18n.G("Check a snapshot")
 	shortRestoreHelp = i18n.G("Restore a snapshot")
+	shortExportHelp  = i18n.G("Export a snapshot")
+	shortImportHelp  = i18n.G("Import a snapshot")
 )
 
 var longSavedHelp = i18n.G(`
@@ -58,6 +64,14 @@ for which users, or a combination of these.
 If a snap is included in a save operation, excluding its system and
 configuration data from the snapshot is not currently possible. This
 restriction may be lifted in the future.
+
+The data archives of the snapshot are encrypted for the P-256 public key
+in the file given with --encryption-key, or otherwise for the one set in
+the core.snapshots.encryption-key system option, if any. The metadata of
+the snapshot is not encrypted. A suitable key pair can be generated with:
+
+    openssl ecparam -name prime256v1 -genkey -noout -out snapshot.key
+    openssl ec -in snapshot.key -pubout -out snapshot.pub
 `)
 var longForgetHelp = i18n.G(`
 The forget command deletes a snapshot. This operation can not be
@@ -83,6 +97,10 @@ for which users, or a combination of these.
 If a snap is included in a check-snapshot operation, excluding its
 system and configuration data from the check is not currently
 possible. This restriction may be lifted in the future.
+
+The integrity of the data of an encrypted snapshot can be checked
+without its private key. If the private key is given with
+--decryption-key, the data is also verified to decrypt correctly.
 `)
 var longRestoreHelp = i18n.G(`
 The restore command replaces the current user, system and
@@ -96,6 +114,26 @@ for which users, or a combination of these.
 If a snap is included in a restore operation, excluding its system and
 configuration data from the restore is not currently possible. This
 restriction may be lifted in the future.
+
+Restoring an encrypted snapshot requires the file with the private key
+matching the public key it was encrypted for to be given with
+--decryption-key.
+`)
+
+var longExportHelp = i18n.G(`
+The export-snapshot command exports a snapshot to the given file, for it to
+be imported on another device with the 'import-snapshot' command.
+
+The exported file contains the user, system and configuration data of all
+the snaps included in the snapshot.
+`)
+var longImportHelp = i18n.G(`
+The import-snapshot command imports a snapshot previously exported with the
+'export-snapshot' command, as a new snapshot set. The integrity of the
+data of every snap in the snapshot is verified before the import is
+accepted.
+
+The imported snapshot can then be restored with the 'restore' command.
 `)
 
 type savedCmd struct {
@@ -146,6 +184,9 @@ func (x *savedCmd) Execute([]string) error {
 			if sh.Auto {
 				notes = append(notes, "auto")
 			}
+			if sh.Encryption != nil {
+				notes = append(notes, "encrypted")
+			}
 			if sh.Broken != "" {
 				notes = append(notes, "broken: "+sh.Broken)
 			}
@@ -161,11 +202,25 @@ func (x *savedCmd) Execute([]string) error {
 	return nil
 }
 
+// readKeyFile returns the contents of the given key file, or the empty
+// string if no file was given.
+func readKeyFile(filename flags.Filename) (string, error) {
+	if filename == "" {
+		return "", nil
+	}
+	data, err := ioutil.ReadFile(string(filename))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
 type saveCmd struct {
 	waitMixin
 	durationMixin
-	Users      string `long:"users"`
-	Positional struct {
+	Users         string         `long:"users"`
+	EncryptionKey flags.Filename `long:"encryption-key"`
+	Positional    struct {
 		Snaps []installedSnapName `positional-arg-name:"<snap>"`
 	} `positional-args:"yes"`
 }
@@ -173,7 +228,11 @@ type saveCmd struct {
 func (x *saveCmd) Execute([]string) error {
 	snaps := installedSnapNames(x.Positional.Snaps)
 	users := strutil.CommaSeparatedList(x.Users)
-	setID, changeID, err := x.client.SnapshotMany(snaps, users)
+	encryptionKey, err := readKeyFile(x.EncryptionKey)
+	if err != nil {
+		return fmt.Errorf(i18n.G("cannot read encryption key: %v"), err)
+	}
+	setID, changeID, err := x.client.SnapshotMany(snaps, users, encryptionKey)
 	if err != nil {
 		return err
 	}
@@ -229,8 +288,9 @@ func (x *forgetCmd) Execute([]string) error {
 
 type checkSnapshotCmd struct {
 	waitMixin
-	Users      string `long:"users"`
-	Positional struct {
+	Users         string         `long:"users"`
+	DecryptionKey flags.Filename `long:"decryption-key"`
+	Positional    struct {
 		ID    snapshotID          `positional-arg-name:"<id>"`
 		Snaps []installedSnapName `positional-arg-name:"<snap>"`
 	} `positional-args:"yes" required:"yes"`
@@ -243,7 +303,11 @@ func (x *checkSnapshotCmd) Execute([]string) error {
 	}
 	snaps := installedSnapNames(x.Positional.Snaps)
 	users := strutil.CommaSeparatedList(x.Users)
-	changeID, err := x.client.CheckSnapshots(setID, snaps, users)
+	decryptionKey, err := readKeyFile(x.DecryptionKey)
+	if err != nil {
+		return fmt.Errorf(i18n.G("cannot read decryption key: %v"), err)
+	}
+	changeID, err := x.client.CheckSnapshots(setID, snaps, users, decryptionKey)
 	if err != nil {
 		return err
 	}
@@ -268,8 +332,9 @@ func (x *checkSnapshotCmd) Execute([]string) error {
 
 type restoreCmd struct {
 	waitMixin
-	Users      string `long:"users"`
-	Positional struct {
+	Users         string         `long:"users"`
+	DecryptionKey flags.Filename `long:"decryption-key"`
+	Positional    struct {
 		ID    snapshotID          `positional-arg-name:"<id>"`
 		Snaps []installedSnapName `positional-arg-name:"<snap>"`
 	} `positional-args:"yes" required:"yes"`
@@ -282,7 +347,11 @@ func (x *restoreCmd) Execute([]string) error {
 	}
 	snaps := installedSnapNames(x.Positional.Snaps)
 	users := strutil.CommaSeparatedList(x.Users)
-	changeID, err := x.client.RestoreSnapshots(setID, snaps, users)
+	decryptionKey, err := readKeyFile(x.DecryptionKey)
+	if err != nil {
+		return fmt.Errorf(i18n.G("cannot read decryption key: %v"), err)
+	}
+	changeID, err := x.client.RestoreSnapshots(setID, snaps, users, decryptionKey)
 	if err != nil {
 		return err
 	}
@@ -305,6 +374,79 @@ func (x *restoreCmd) Execute([]string) error {
 	return nil
 }
 
+type exportSnapshotCmd struct {
+	clientMixin
+	Positional struct {
+		ID       snapshotID     `positional-arg-name:"<id>"`
+		Filename flags.Filename `positional-arg-name:"<filename>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (x *exportSnapshotCmd) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	setID, err := x.Positional.ID.ToUint()
+	if err != nil {
+		return err
+	}
+
+	exportStream, err := x.client.SnapshotExport(setID)
+	if err != nil {
+		return fmt.Errorf(i18n.G("cannot export snapshot #%s: %v"), x.Positional.ID, err)
+	}
+	defer exportStream.Close()
+
+	filename := string(x.Positional.Filename)
+	w, err := osutil.NewAtomicFile(filename, 0600, 0, osutil.NoChown, osutil.NoChown)
+	if err != nil {
+		return fmt.Errorf(i18n.G("cannot create %q: %v"), filename, err)
+	}
+	// if things worked, we'll commit (and Cancel becomes a NOP)
+	defer w.Cancel()
+
+	if _, err := io.Copy(w, exportStream); err != nil {
+		return fmt.Errorf(i18n.G("cannot export snapshot #%s: %v"), x.Positional.ID, err)
+	}
+	if err := w.Commit(); err != nil {
+		return fmt.Errorf(i18n.G("cannot write %q: %v"), filename, err)
+	}
+
+	fmt.Fprintf(Stdout, i18n.G("Exported snapshot #%s into %q\n"), x.Positional.ID, filename)
+	return nil
+}
+
+type importSnapshotCmd struct {
+	clientMixin
+	Positional struct {
+		Filename flags.Filename `positional-arg-name:"<filename>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (x *importSnapshotCmd) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	filename := string(x.Positional.Filename)
+	f, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf(i18n.G("cannot import snapshot: %v"), err)
+	}
+	defer f.Close()
+
+	importSet, err := x.client.SnapshotImport(f)
+	if err != nil {
+		return err
+	}
+
+	// TRANSLATORS: the %s is a comma-separated list of quoted snap names
+	fmt.Fprintf(Stdout, i18n.NG("Imported snapshot as #%d of snap %s.\n", "Imported snapshot as #%d of snaps %s.\n", len(importSet.Snaps)),
+		importSet.ID, strutil.Quoted(importSet.Snaps))
+	return nil
+}
+
 func init() {
 	addCommand("saved",
 		shortSavedHelp,
@@ -326,6 +468,8 @@ func init() {
 		}, durationDescs.also(waitDescs).also(map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"users": i18n.G("Snapshot data of only specific users (comma-separated) (default: all users)"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"encryption-key": i18n.G("Encrypt the snapshot data for the public key in the given file"),
 		}), nil)
 
 	addCommand("restore",
@@ -336,6 +480,8 @@ func init() {
 		}, waitDescs.also(map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"users": i18n.G("Restore data of only specific users (comma-separated) (default: all users)"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"decryption-key": i18n.G("Decrypt the snapshot data with the private key in the given file"),
 		}), []argDesc{
 			{
 				name: "<snap>",
@@ -373,6 +519,8 @@ func init() {
 		}, waitDescs.also(map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"users": i18n.G("Check data of only specific users (comma-separated) (default: all users)"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"decryption-key": i18n.G("Also check the snapshot data decrypts with the private key in the given file"),
 		}), []argDesc{
 			{
 				name: "<id>",
@@ -384,4 +532,36 @@ func init() {
 				desc: i18n.G("The snap for which data will be verified"),
 			},
 		})
+
+	addCommand("export-snapshot",
+		shortExportHelp,
+		longExportHelp,
+		func() flags.Commander {
+			return &exportSnapshotCmd{}
+		}, nil, []argDesc{
+			{
+				name: "<id>",
+				// TRANSLATORS: This should not start with a lowercase letter.
+				desc: i18n.G("Set id of snapshot to export (see 'snap help saved')"),
+			}, {
+				// TRANSLATORS: This needs to begin with < and end with >
+				name: i18n.G("<filename>"),
+				// TRANSLATORS: This should not start with a lowercase letter.
+				desc: i18n.G("The file to export the snapshot into"),
+			},
+		})
+
+	addCommand("import-snapshot",
+		shortImportHelp,
+		longImportHelp,
+		func() flags.Commander {
+			return &importSnapshotCmd{}
+		}, nil, []argDesc{
+			{
+				// TRANSLATORS: This needs to begin with < and end with >
+				name: i18n.G("<filename>"),
+				// TRANSLATORS: This should not start with a lowercase letter.
+				desc: i18n.G("The file to import the snapshot from"),
+			},
+		})
 }
@@ -21,12 +21,15 @@ package main_test
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"path/filepath"
 	"strings"
 	"time"
 
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/cmd/snap"
 	"github.com/snapcore/snapd/testutil"
 )
@@ -39,7 +42,7 @@ var snapshotsTests = []getCmdArgs{{
 	error: `invalid argument for snapshot set id: expected a non-negative integer argument \(see 'snap help saved'\)`,
 }, {
 	args:   "saved --id=3",
-	stdout: "Set  Snap  Age    Version  Rev   Size    Notes\n3    htop  .*  2        1168      1B  auto\n",
+	stdout: "Set  Snap  Age    Version  Rev   Size    Notes\n3    htop  .*  2        1168      1B  auto, encrypted\n",
 }, {
 	args:   "saved",
 	stdout: "Set  Snap  Age    Version  Rev   Size    Notes\n1    htop  .*  2        1168      1B  -\n",
@@ -97,7 +100,7 @@ func (s *SnapSuite) mockSnapshotsServer(c *C) {
 				// simulate a 1-month old snapshot
 				snapshotTime := time.Now().AddDate(0, -1, 0).Format(time.RFC3339)
 				if r.URL.Query().Get("set") == "3" {
-					fmt.Fprintf(w, `{"type":"sync","status-code":200,"status":"OK","result":[{"id":3,"snapshots":[{"set":3,"time":%q,"snap":"htop","revision":"1168","snap-id":"Z","auto":true,"epoch":{"read":[0],"write":[0]},"summary":"","version":"2","sha3-384":{"archive.tgz":""},"size":1}]}]}`, snapshotTime)
+					fmt.Fprintf(w, `{"type":"sync","status-code":200,"status":"OK","result":[{"id":3,"snapshots":[{"set":3,"time":%q,"snap":"htop","revision":"1168","snap-id":"Z","auto":true,"encryption":{"scheme":"p256-aes256gcm","key-id":"abc","ephemeral-key":"def"},"epoch":{"read":[0],"write":[0]},"summary":"","version":"2","sha3-384":{"archive.tgz":""},"size":1}]}]}`, snapshotTime)
 					return
 				}
 				fmt.Fprintf(w, `{"type":"sync","status-code":200,"status":"OK","result":[{"id":1,"snapshots":[{"set":1,"time":%q,"snap":"htop","revision":"1168","snap-id":"Z","epoch":{"read":[0],"write":[0]},"summary":"","version":"2","sha3-384":{"archive.tgz":""},"size":1}]}]}`, snapshotTime)
@@ -112,3 +115,121 @@ func (s *SnapSuite) mockSnapshotsServer(c *C) {
 		}
 	})
 }
+
+func (s *SnapSuite) TestSnapshotKeyFiles(c *C) {
+	var body map[string]interface{}
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/snaps", "/v2/snapshots":
+			if r.Method == "GET" {
+				fmt.Fprintln(w, `{"type":"sync","status-code":200,"status":"OK","result":[]}`)
+				return
+			}
+			body = DecodedRequestBody(c, r)
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type":"async", "status-code": 202, "change": "9", "result": {"set-id": 42}}`)
+		case "/v2/changes/9":
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done", "data": {}}}`)
+		default:
+			c.Errorf("unexpected path %q", r.URL.Path)
+		}
+	})
+
+	keyFile := filepath.Join(c.MkDir(), "snapshot.key")
+	c.Assert(ioutil.WriteFile(keyFile, []byte("key data"), 0600), IsNil)
+
+	for _, t := range []struct {
+		args []string
+		key  string
+	}{
+		{[]string{"save", "--encryption-key", keyFile}, "encryption-key"},
+		{[]string{"restore", "--decryption-key", keyFile, "42"}, "decryption-key"},
+		{[]string{"check-snapshot", "--decryption-key", keyFile, "42"}, "decryption-key"},
+	} {
+		body = nil
+		_, err := main.Parser(main.Client()).ParseArgs(t.args)
+		c.Assert(err, IsNil, Commentf("%v", t.args))
+		c.Check(body[t.key], Equals, "key data", Commentf("%v", t.args))
+	}
+
+	missing := filepath.Join(c.MkDir(), "missing")
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"save", "--encryption-key", missing})
+	c.Check(err, ErrorMatches, "cannot read encryption key: open .*/missing: no such file or directory")
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"restore", "--decryption-key", missing, "42"})
+	c.Check(err, ErrorMatches, "cannot read decryption key: open .*/missing: no such file or directory")
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"check-snapshot", "--decryption-key", missing, "42"})
+	c.Check(err, ErrorMatches, "cannot read decryption key: open .*/missing: no such file or directory")
+}
+
+func (s *SnapSuite) TestExportSnapshot(c *C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(r.Method, Equals, "GET")
+		c.Check(r.URL.Path, Equals, "/v2/snapshots/42/export")
+		w.Header().Set("Content-Type", client.SnapshotExportMediaType)
+		fmt.Fprint(w, "snapshot export data")
+	})
+
+	filename := filepath.Join(c.MkDir(), "export.snapshot")
+	rest, err := main.Parser(main.Client()).ParseArgs([]string{"export-snapshot", "42", filename})
+	c.Assert(err, IsNil)
+	c.Check(rest, HasLen, 0)
+	c.Check(s.Stdout(), Equals, fmt.Sprintf("Exported snapshot #42 into %q\n", filename))
+	c.Check(s.Stderr(), Equals, "")
+	c.Check(filename, testutil.FileEquals, "snapshot export data")
+	c.Check(n, Equals, 1)
+}
+
+func (s *SnapSuite) TestExportSnapshotErrors(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+		fmt.Fprintln(w, `{"type": "error", "status-code": 404, "result": {"message": "no snapshot set with the given ID"}}`)
+	})
+
+	filename := filepath.Join(c.MkDir(), "export.snapshot")
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"export-snapshot", "42", filename})
+	c.Check(err, ErrorMatches, "cannot export snapshot #42: no snapshot set with the given ID")
+	c.Check(filename, testutil.FileAbsent)
+
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"export-snapshot", "x", filename})
+	c.Check(err, ErrorMatches, `invalid argument for snapshot set id: expected a non-negative integer argument \(see 'snap help saved'\)`)
+}
+
+func (s *SnapSuite) TestImportSnapshot(c *C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(r.Method, Equals, "POST")
+		c.Check(r.URL.Path, Equals, "/v2/snapshots")
+		c.Check(r.Header.Get("Content-Type"), Equals, client.SnapshotExportMediaType)
+		data, err := ioutil.ReadAll(r.Body)
+		c.Assert(err, IsNil)
+		c.Check(string(data), Equals, "snapshot export data")
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": {"set-id": 7, "snaps": ["bar", "foo"]}}`)
+	})
+
+	filename := filepath.Join(c.MkDir(), "export.snapshot")
+	c.Assert(ioutil.WriteFile(filename, []byte("snapshot export data"), 0600), IsNil)
+	rest, err := main.Parser(main.Client()).ParseArgs([]string{"import-snapshot", filename})
+	c.Assert(err, IsNil)
+	c.Check(rest, HasLen, 0)
+	c.Check(s.Stdout(), Equals, "Imported snapshot as #7 of snaps \"bar\", \"foo\".\n")
+	c.Check(s.Stderr(), Equals, "")
+	c.Check(n, Equals, 1)
+}
+
+func (s *SnapSuite) TestImportSnapshotErrors(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(400)
+		fmt.Fprintln(w, `{"type": "error", "status-code": 400, "result": {"message": "cannot import snapshot: empty import"}}`)
+	})
+
+	filename := filepath.Join(c.MkDir(), "export.snapshot")
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"import-snapshot", filename})
+	c.Check(err, ErrorMatches, `cannot import snapshot: open .*/export.snapshot: no such file or directory`)
+
+	c.Assert(ioutil.WriteFile(filename, nil, 0600), IsNil)
+	_, err = main.Parser(main.Client()).ParseArgs([]string{"import-snapshot", filename})
+	c.Check(err, ErrorMatches, "cannot import snapshot: empty import")
+}
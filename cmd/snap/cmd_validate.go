@@ -0,0 +1,191 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+)
+
+type cmdValidate struct {
+	clientMixin
+	Monitor    bool `long:"monitor"`
+	Enforce    bool `long:"enforce"`
+	Forget     bool `long:"forget"`
+	Positional struct {
+		ValidationSet string `positional-arg-name:"<validation-set>"`
+	} `positional-args:"yes"`
+}
+
+var shortValidateHelp = i18n.G("List or apply validation sets")
+var longValidateHelp = i18n.G(`
+The validate command lists or applies validation sets that state which snaps
+are required or permitted to be installed together, optionally constrained to
+fixed revisions.
+
+A validation set can either be in monitoring mode, in which case its constraints
+aren't enforced, or in enforcing mode, in which case snapd will not allow
+operations which would result in snaps breaking the validation set's constraints.
+
+Without arguments, the tracked validation sets are listed. With a validation
+set argument only, the status of that validation set is shown.
+`)
+
+func init() {
+	addCommand("validate", shortValidateHelp, longValidateHelp, func() flags.Commander { return &cmdValidate{} }, map[string]string{
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"monitor": i18n.G("Monitor the given validation set"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"enforce": i18n.G("Enforce the given validation set"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"forget": i18n.G("Forget the given validation set"),
+	}, []argDesc{{
+		// TRANSLATORS: This needs to begin with < and end with >
+		name: i18n.G("<validation-set>"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		desc: i18n.G("Validation set with an optional pinned sequence point, i.e. account-id/name[=seq]"),
+	}})
+}
+
+func splitValidationSetArg(arg string) (account, name string, seq int, err error) {
+	parts := strings.Split(arg, "=")
+	if len(parts) > 2 {
+		return "", "", 0, fmt.Errorf(i18n.G("cannot parse validation set %q: expected a single sequence"), arg)
+	}
+	if len(parts) == 2 {
+		seq, err = strconv.Atoi(parts[1])
+		if err != nil || seq < 1 {
+			return "", "", 0, fmt.Errorf(i18n.G("invalid sequence in validation set %q"), arg)
+		}
+	}
+	names := strings.Split(parts[0], "/")
+	if len(names) != 2 || !asserts.IsValidAccountID(names[0]) || !asserts.IsValidValidationSetName(names[1]) {
+		return "", "", 0, fmt.Errorf(i18n.G("cannot parse validation set %q: expected account-id/name[=seq]"), arg)
+	}
+	return names[0], names[1], seq, nil
+}
+
+func fmtValid(res *client.ValidationSetResult) string {
+	if res.Valid {
+		return "valid"
+	}
+	return "invalid"
+}
+
+func fmtValidationSet(res *client.ValidationSetResult) string {
+	if res.PinnedAt == 0 {
+		return fmt.Sprintf("%s/%s", res.AccountID, res.Name)
+	}
+	return fmt.Sprintf("%s/%s=%d", res.AccountID, res.Name, res.PinnedAt)
+}
+
+func (cmd *cmdValidate) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	action := ""
+	n := 0
+	if cmd.Monitor {
+		action = "monitor"
+		n++
+	}
+	if cmd.Enforce {
+		action = "enforce"
+		n++
+	}
+	if cmd.Forget {
+		action = "forget"
+		n++
+	}
+	if n > 1 {
+		return fmt.Errorf(i18n.G("cannot use --monitor, --enforce and --forget together"))
+	}
+	if action != "" && cmd.Positional.ValidationSet == "" {
+		return fmt.Errorf(i18n.G("missing validation set argument"))
+	}
+
+	var accountID, name string
+	var seq int
+	if cmd.Positional.ValidationSet != "" {
+		var err error
+		accountID, name, seq, err = splitValidationSetArg(cmd.Positional.ValidationSet)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch action {
+	case "monitor", "enforce":
+		opts := &client.ValidateApplyOptions{
+			Mode:     action,
+			Sequence: seq,
+		}
+		res, err := cmd.client.ApplyValidationSet(accountID, name, opts)
+		if err != nil {
+			return err
+		}
+		// TRANSLATORS: the first %s is a validation set, the second its mode, the third whether it is valid or not
+		fmt.Fprintf(Stdout, i18n.G("%s is now in %s mode, %s\n"), fmtValidationSet(res), res.Mode, fmtValid(res))
+		return nil
+	case "forget":
+		if seq != 0 {
+			return fmt.Errorf(i18n.G("cannot use a sequence with --forget"))
+		}
+		return cmd.client.ForgetValidationSet(accountID, name)
+	}
+
+	if accountID != "" {
+		if seq != 0 {
+			return fmt.Errorf(i18n.G("cannot query a specific sequence of a validation set"))
+		}
+		res, err := cmd.client.ValidationSet(accountID, name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(Stdout, fmtValid(res))
+		return nil
+	}
+
+	results, err := cmd.client.ListValidationSets()
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		fmt.Fprintln(Stderr, i18n.G("No validations are available"))
+		return nil
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	fmt.Fprintln(w, i18n.G("Validation\tMode\tSeq\tCurrent"))
+	for _, res := range results {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", fmtValidationSet(res), res.Mode, res.Sequence, fmtValid(res))
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+func makeFakeValidationSetPostHandler(c *check.C, body string, action, mode string, sequence int) func(w http.ResponseWriter, r *http.Request) {
+	var called bool
+	return func(w http.ResponseWriter, r *http.Request) {
+		if called {
+			c.Fatalf("expected a single request")
+		}
+		called = true
+		c.Check(r.URL.Path, check.Equals, "/v2/validation-sets/foo/bar")
+		c.Check(r.Method, check.Equals, "POST")
+
+		var req map[string]interface{}
+		c.Assert(json.NewDecoder(r.Body).Decode(&req), check.IsNil)
+		expected := map[string]interface{}{"action": action}
+		if mode != "" {
+			expected["mode"] = mode
+		}
+		if sequence != 0 {
+			expected["sequence"] = float64(sequence)
+		}
+		c.Check(req, check.DeepEquals, expected)
+
+		w.WriteHeader(200)
+		fmt.Fprintln(w, body)
+	}
+}
+
+func (s *SnapSuite) TestValidateInvalidArgs(c *check.C) {
+	for _, args := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"foo"}, `cannot parse validation set "foo": expected account-id/name\[=seq\]`},
+		{[]string{"foo/Bar"}, `cannot parse validation set "foo/Bar": expected account-id/name\[=seq\]`},
+		{[]string{"foo/bar=x"}, `invalid sequence in validation set "foo/bar=x"`},
+		{[]string{"foo/bar=0"}, `invalid sequence in validation set "foo/bar=0"`},
+		{[]string{"foo/bar=1=2"}, `cannot parse validation set "foo/bar=1=2": expected a single sequence`},
+		{[]string{"--monitor"}, `missing validation set argument`},
+		{[]string{"--monitor", "--enforce", "foo/bar"}, `cannot use --monitor, --enforce and --forget together`},
+		{[]string{"--forget", "foo/bar=1"}, `cannot use a sequence with --forget`},
+		{[]string{"foo/bar=1"}, `cannot query a specific sequence of a validation set`},
+	} {
+		_, err := snap.Parser(snap.Client()).ParseArgs(append([]string{"validate"}, args.args...))
+		c.Check(err, check.ErrorMatches, args.err, check.Commentf("%v", args.args))
+	}
+}
+
+func (s *SnapSuite) TestValidateMonitor(c *check.C) {
+	s.RedirectClientToTestServer(makeFakeValidationSetPostHandler(c, `{"type": "sync", "status-code": 200, "result": {"account-id": "foo", "name": "bar", "mode": "monitor", "sequence": 3, "valid": false}}`, "apply", "monitor", 0))
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"validate", "--monitor", "foo/bar"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "foo/bar is now in monitor mode, invalid\n")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *SnapSuite) TestValidateEnforcePinned(c *check.C) {
+	s.RedirectClientToTestServer(makeFakeValidationSetPostHandler(c, `{"type": "sync", "status-code": 200, "result": {"account-id": "foo", "name": "bar", "mode": "enforce", "pinned-at": 3, "sequence": 3, "valid": true}}`, "apply", "enforce", 3))
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"validate", "--enforce", "foo/bar=3"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "foo/bar=3 is now in enforce mode, valid\n")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *SnapSuite) TestValidateEnforceError(c *check.C) {
+	s.RedirectClientToTestServer(makeFakeValidationSetPostHandler(c, `{"type": "error", "status-code": 400, "result": {"message": "boom"}}`, "apply", "enforce", 0))
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"validate", "--enforce", "foo/bar"})
+	c.Assert(err, check.ErrorMatches, "cannot apply validation set: boom")
+}
+
+func (s *SnapSuite) TestValidateForget(c *check.C) {
+	s.RedirectClientToTestServer(makeFakeValidationSetPostHandler(c, `{"type": "sync", "status-code": 200, "result": null}`, "forget", "", 0))
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"validate", "--forget", "foo/bar"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *SnapSuite) TestValidateQuery(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/validation-sets/foo/bar")
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": {"account-id": "foo", "name": "bar", "mode": "monitor", "sequence": 3, "valid": true}}`)
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"validate", "foo/bar"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "valid\n")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *SnapSuite) TestValidateList(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/validation-sets")
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": [
+			{"account-id": "foo", "name": "bar", "mode": "monitor", "pinned-at": 2, "sequence": 2, "valid": true},
+			{"account-id": "foo", "name": "baz", "mode": "enforce", "sequence": 5, "valid": false}
+		]}`)
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"validate"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, ""+
+		"Validation  Mode     Seq  Current\n"+
+		"foo/bar=2   monitor  2    valid\n"+
+		"foo/baz     enforce  5    invalid\n")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *SnapSuite) TestValidateListNone(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "sync", "status-code": 200, "result": []}`)
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"validate"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(s.Stderr(), check.Equals, "No validations are available\n")
+}
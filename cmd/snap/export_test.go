@@ -29,6 +29,7 @@ import (
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/image"
 	"github.com/snapcore/snapd/sandbox/selinux"
+	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/store"
 )
 
@@ -298,6 +299,24 @@ func MockImagePrepare(newImagePrepare func(*image.Options) error) (restore func(
 	}
 }
 
+func MockImagePreseed(newImagePreseed func(chrootDir string) error) (restore func()) {
+	old := imagePreseed
+	imagePreseed = newImagePreseed
+	return func() {
+		imagePreseed = old
+	}
+}
+
+func MockDownloadSnapAndAssertions(f func(tsto *image.ToolingStore, snapName string, dlOpts image.DownloadOptions) (string, string, *snap.Info, error)) (restore func()) {
+	old := downloadSnapAndAssertions
+	downloadSnapAndAssertions = f
+	return func() {
+		downloadSnapAndAssertions = old
+	}
+}
+
+var SnapDependencies = snapDependencies
+
 func MockSignalNotify(newSignalNotify func(sig ...os.Signal) (chan os.Signal, func())) (restore func()) {
 	old := signalNotify
 	signalNotify = newSignalNotify
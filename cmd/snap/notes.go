@@ -61,6 +61,7 @@ type Notes struct {
 	Broken           bool
 	IgnoreValidation bool
 	InCohort         bool
+	Held             bool
 	Health           string
 	Price            string
 }
@@ -102,6 +103,7 @@ func NotesFromLocal(snp *client.Snap) *Notes {
 		Broken:           snp.Broken != "",
 		IgnoreValidation: snp.IgnoreValidation,
 		InCohort:         snp.CohortKey != "",
+		Held:             snp.RefreshHold != nil,
 		Health:           health,
 	}
 }
@@ -162,6 +164,11 @@ func (n *Notes) String() string {
 	if n.InCohort {
 		ns = append(ns, i18n.G("in-cohort"))
 	}
+
+	if n.Held {
+		// TRANSLATORS: if possible, a single short word
+		ns = append(ns, i18n.G("held"))
+	}
 	if n.Health != "" && n.Health != "okay" {
 		ns = append(ns, n.Health)
 	}
@@ -20,9 +20,12 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 	"time"
 
+	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/strutil/quantity"
 	"github.com/snapcore/snapd/timeutil"
@@ -61,3 +64,76 @@ func (mx durationMixin) fmtDuration(t time.Time) string {
 	}
 	return strings.TrimSpace(quantity.FormatDuration(time.Since(t).Seconds()))
 }
+
+type scheduleMixin struct {
+	At     string `long:"at"`
+	Window string `long:"window"`
+}
+
+var scheduleDescs = mixinDescs{
+	// TRANSLATORS: This should not start with a lowercase letter.
+	"at": i18n.G("Start the operation at the given time (RFC 3339, YYYY-MM-DD HH:MM or HH:MM) instead of right away"),
+	// TRANSLATORS: This should not start with a lowercase letter.
+	"window": i18n.G("Start the operation at the next opening of the given window (as in refresh.timer, e.g. mon,02:00-04:00) instead of right away"),
+}
+
+func (mx scheduleMixin) asksForSchedule() bool {
+	return mx.At != "" || mx.Window != ""
+}
+
+// parseAtTime parses the time given with --at, either in RFC 3339
+// format, or as a local date and time, or as a local time of the day,
+// in which case it is the next such time.
+func parseAtTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local); err == nil {
+		return t, nil
+	}
+	clock, err := timeutil.ParseClock(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf(i18n.G("cannot parse time %q: expected RFC 3339, YYYY-MM-DD HH:MM or HH:MM"), s)
+	}
+	now := time.Now()
+	t := clock.Time(now)
+	if t.Before(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func (mx scheduleMixin) scheduleOptions() (client.ScheduleOptions, error) {
+	var opts client.ScheduleOptions
+	if mx.At != "" && mx.Window != "" {
+		return opts, errors.New(i18n.G("cannot use --at and --window together"))
+	}
+	if mx.At != "" {
+		at, err := parseAtTime(mx.At)
+		if err != nil {
+			return opts, err
+		}
+		opts.At = &at
+	}
+	opts.Window = mx.Window
+	return opts, nil
+}
+
+// showScheduled says when the given change, made with the options of the
+// mixin, is scheduled to start at, if it is scheduled at all.
+func (mx scheduleMixin) showScheduled(cli *client.Client, changeID string) (scheduled bool, err error) {
+	if !mx.asksForSchedule() {
+		return false, nil
+	}
+	chg, err := cli.Change(changeID)
+	if err != nil {
+		return false, err
+	}
+	if chg.ScheduledTime.IsZero() {
+		// the window is open already
+		return false, nil
+	}
+	// TRANSLATORS: the first %s is a change id, the second %s is a time
+	fmt.Fprintf(Stdout, i18n.G("Change %s scheduled to start %s\n"), changeID, timeutilHuman(chg.ScheduledTime))
+	return true, nil
+}
@@ -33,6 +33,7 @@ import (
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/sanity"
+	"github.com/snapcore/snapd/snapdenv"
 	"github.com/snapcore/snapd/systemd"
 )
 
@@ -51,7 +52,12 @@ func init() {
 }
 
 func main() {
-	cmd.ExecInSnapdOrCoreSnap()
+	// When preseeding re-exec is not used
+	if snapdenv.Preseeding() {
+		logger.Noticef("running for preseeding")
+	} else {
+		cmd.ExecInSnapdOrCoreSnap()
+	}
 
 	ch := make(chan os.Signal, 2)
 	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
@@ -115,15 +121,18 @@ func run(ch chan os.Signal) error {
 
 	// Run sanity check now, if anything goes wrong with the
 	// check we go into "degraded" mode where we always report
-	// the given error to any snap client.
+	// the given error to any snap client. No client is served
+	// when preseeding so the check is skipped then.
 	var checkTicker <-chan time.Time
 	var tic *time.Ticker
-	if err := sanityCheck(); err != nil {
-		degradedErr := fmt.Errorf("system does not fully support snapd: %s", err)
-		logger.Noticef("%s", degradedErr)
-		d.SetDegradedMode(degradedErr)
-		tic = time.NewTicker(checkRunningConditionsRetryDelay)
-		checkTicker = tic.C
+	if !snapdenv.Preseeding() {
+		if err := sanityCheck(); err != nil {
+			degradedErr := fmt.Errorf("system does not fully support snapd: %s", err)
+			logger.Noticef("%s", degradedErr)
+			d.SetDegradedMode(degradedErr)
+			tic = time.NewTicker(checkRunningConditionsRetryDelay)
+			checkTicker = tic.C
+		}
 	}
 
 	d.Version = cmd.Version
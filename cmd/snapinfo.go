@@ -89,7 +89,10 @@ func ClientAppInfoNotes(app *client.AppInfo) string {
 		return "-"
 	}
 
-	var notes = make([]string, 0, 2)
+	var notes = make([]string, 0, 3)
+	if app.DaemonScope == snap.UserDaemon {
+		notes = append(notes, "user-daemon")
+	}
 	var seenTimer, seenSocket bool
 	for _, act := range app.Activators {
 		switch act.Type {
@@ -142,7 +145,10 @@ func ClientAppInfosFromSnapAppInfos(apps []*snap.AppInfo) ([]client.AppInfo, err
 		}
 
 		appInfo.Daemon = app.Daemon
-		if !app.IsService() || !app.Snap.IsActive() {
+		appInfo.DaemonScope = app.DaemonScope
+		// the status of user services is per user, and not known
+		// to the system instance
+		if !app.IsService() || !app.Snap.IsActive() || app.IsUserService() {
 			out = append(out, appInfo)
 			continue
 		}
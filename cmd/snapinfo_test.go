@@ -79,4 +79,13 @@ func (*cmdSuite) TestAppStatusNotes(c *check.C) {
 		},
 	}
 	c.Check(cmd.ClientAppInfoNotes(&ai), check.Equals, "timer-activated,socket-activated")
+
+	ai = client.AppInfo{
+		Daemon:      "simple",
+		DaemonScope: snap.UserDaemon,
+		Activators: []client.AppActivator{
+			{Type: "socket"},
+		},
+	}
+	c.Check(cmd.ClientAppInfoNotes(&ai), check.Equals, "user-daemon,socket-activated")
 }
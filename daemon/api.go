@@ -71,6 +71,7 @@ import (
 	"github.com/snapcore/snapd/store"
 	"github.com/snapcore/snapd/strutil"
 	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/timeutil"
 )
 
 var api = []*Command{
@@ -102,11 +103,18 @@ var api = []*Command{
 	warningsCmd,
 	debugPprofCmd,
 	debugCmd,
+	metricsCmd,
 	snapshotCmd,
+	snapshotExportCmd,
 	connectionsCmd,
 	modelCmd,
 	cohortsCmd,
 	serialModelCmd,
+	validationSetsListCmd,
+	validationSetsCmd,
+	noticesCmd,
+	quotaGroupsCmd,
+	quotaGroupInfoCmd,
 }
 
 var (
@@ -772,6 +780,18 @@ type snapInstruction struct {
 	Snaps    []string     `json:"snaps"`
 	Users    []string     `json:"users"`
 
+	// HoldUntil is used by the hold action
+	HoldUntil time.Time `json:"hold-until"`
+
+	// DryRun asks for the plan of the change instead of making it
+	DryRun bool `json:"dry-run"`
+
+	// EncryptionKey is the public key to encrypt snapshots for
+	EncryptionKey string `json:"encryption-key"`
+
+	// ScheduleOptions are used by refresh and remove
+	client.ScheduleOptions
+
 	// The fields below should not be unmarshalled into. Do not export them.
 	userID int
 	ctx    context.Context
@@ -820,12 +840,16 @@ var (
 	snapstateRevert            = snapstate.Revert
 	snapstateRevertToRevision  = snapstate.RevertToRevision
 	snapstateSwitch            = snapstate.Switch
+	snapstateHoldRefresh       = snapstate.HoldRefresh
+	snapstateUnholdRefresh     = snapstate.UnholdRefresh
 
 	snapshotList    = snapshotstate.List
 	snapshotCheck   = snapshotstate.Check
 	snapshotForget  = snapshotstate.Forget
 	snapshotRestore = snapshotstate.Restore
 	snapshotSave    = snapshotstate.Save
+	snapshotExport  = snapshotstate.Export
+	snapshotImport  = snapshotstate.Import
 
 	assertstateRefreshSnapDeclarations = assertstate.RefreshSnapDeclarations
 )
@@ -862,12 +886,15 @@ func modeFlags(devMode, jailMode, classic bool) (snapstate.Flags, error) {
 
 func snapUpdateMany(inst *snapInstruction, st *state.State) (*snapInstructionResult, error) {
 	// we need refreshed snap-declarations to enforce refresh-control as best as we can, this also ensures that snap-declarations and their prerequisite assertions are updated regularly
-	if err := assertstateRefreshSnapDeclarations(st, inst.userID); err != nil {
-		return nil, err
+	// a dry-run leaves the assertions as they are
+	if !inst.DryRun {
+		if err := assertstateRefreshSnapDeclarations(st, inst.userID); err != nil {
+			return nil, err
+		}
 	}
 
 	// TODO: use a per-request context
-	updated, tasksets, err := snapstateUpdateMany(context.TODO(), st, inst.Snaps, inst.userID, nil)
+	updated, tasksets, err := snapstateUpdateMany(context.TODO(), st, inst.Snaps, inst.userID, &snapstate.Flags{Planning: inst.DryRun})
 	if err != nil {
 		return nil, err
 	}
@@ -913,6 +940,20 @@ func verifySnapInstructions(inst *snapInstruction) error {
 			return fmt.Errorf("leave-cohort can only be specified for refresh or switch")
 		}
 	}
+	if !inst.HoldUntil.IsZero() && inst.Action != "hold" {
+		return fmt.Errorf("hold-until can only be specified for hold")
+	}
+	if inst.DryRun && inst.Action != "install" && inst.Action != "refresh" && inst.Action != "remove" {
+		return fmt.Errorf("dry-run can only be specified for install, refresh or remove")
+	}
+	if inst.At != nil || inst.Window != "" {
+		if inst.Action != "refresh" && inst.Action != "remove" {
+			return fmt.Errorf("at and window can only be specified for refresh or remove")
+		}
+		if inst.DryRun {
+			return fmt.Errorf("cannot schedule a dry-run")
+		}
+	}
 	switch inst.Action {
 	case "install":
 		for _, snapName := range inst.Snaps {
@@ -1003,8 +1044,11 @@ func snapUpdate(inst *snapInstruction, st *state.State) (string, []*state.TaskSe
 	}
 
 	// we need refreshed snap-declarations to enforce refresh-control as best as we can
-	if err = assertstateRefreshSnapDeclarations(st, inst.userID); err != nil {
-		return "", nil, err
+	// a dry-run leaves the assertions as they are
+	if !inst.DryRun {
+		if err = assertstateRefreshSnapDeclarations(st, inst.userID); err != nil {
+			return "", nil, err
+		}
 	}
 
 	ts, err := snapstateUpdate(st, inst.Snaps[0], inst.revnoOpts(), inst.userID, flags)
@@ -1128,7 +1172,7 @@ func snapSwitch(inst *snapInstruction, st *state.State) (string, []*state.TaskSe
 }
 
 func snapshotMany(inst *snapInstruction, st *state.State) (*snapInstructionResult, error) {
-	setID, snapshotted, ts, err := snapshotSave(st, inst.Snaps, inst.Users)
+	setID, snapshotted, ts, err := snapshotSave(st, inst.Snaps, inst.Users, inst.EncryptionKey)
 	if err != nil {
 		return nil, err
 	}
@@ -1149,6 +1193,23 @@ func snapshotMany(inst *snapInstruction, st *state.State) (*snapInstructionResul
 	}, nil
 }
 
+// snapRefreshHold holds or unholds automatic refreshes of a snap,
+// unlike the other single-snap actions it does not create a change.
+func snapRefreshHold(inst *snapInstruction, st *state.State) Response {
+	if inst.Action == "unhold" {
+		if err := snapstateUnholdRefresh(st, inst.Snaps[0]); err != nil {
+			return inst.errToResponse(err)
+		}
+		return SyncResponse(nil, nil)
+	}
+
+	holdUntil, err := snapstateHoldRefresh(st, inst.Snaps[0], inst.HoldUntil)
+	if err != nil {
+		return inst.errToResponse(err)
+	}
+	return SyncResponse(map[string]interface{}{"hold-until": holdUntil}, nil)
+}
+
 type snapActionFunc func(*snapInstruction, *state.State) (string, []*state.TaskSet, error)
 
 var snapInstructionDispTable = map[string]snapActionFunc{
@@ -1203,24 +1264,72 @@ func postSnap(c *Command, r *http.Request, user *auth.UserState) Response {
 	if err := verifySnapInstructions(&inst); err != nil {
 		return BadRequest("%s", err)
 	}
+	start, err := scheduledStart(&inst.ScheduleOptions)
+	if err != nil {
+		return BadRequest("%v", err)
+	}
+
+	if inst.Action == "hold" || inst.Action == "unhold" {
+		return snapRefreshHold(&inst, state)
+	}
 
 	impl := inst.dispatch()
 	if impl == nil {
 		return BadRequest("unknown action %s", inst.Action)
 	}
 
+	if inst.DryRun {
+		return planSnapInstruction(&inst, state, func() (*snapInstructionResult, error) {
+			msg, tsets, err := impl(&inst, state)
+			if err != nil {
+				return nil, err
+			}
+			return &snapInstructionResult{Summary: msg, Tasksets: tsets}, nil
+		})
+	}
+
 	msg, tsets, err := impl(&inst, state)
 	if err != nil {
 		return inst.errToResponse(err)
 	}
 
 	chg := newChange(state, inst.Action+"-snap", msg, tsets, inst.Snaps)
+	if !start.IsZero() {
+		chg.ScheduleAt(start)
+	}
 
 	ensureStateSoon(state)
 
 	return AsyncResponse(nil, &Meta{Change: chg.ID()})
 }
 
+// scheduledStart returns the time to start a change at as asked for by
+// the given options, or the zero time if it should start right away.
+func scheduledStart(opts *client.ScheduleOptions) (time.Time, error) {
+	now := time.Now()
+	switch {
+	case opts.At != nil && opts.Window != "":
+		return time.Time{}, fmt.Errorf("cannot specify both at and window")
+	case opts.At != nil:
+		if opts.At.Before(now) {
+			return time.Time{}, fmt.Errorf("cannot schedule a change in the past")
+		}
+		return *opts.At, nil
+	case opts.Window != "":
+		schedule, err := timeutil.ParseSchedule(opts.Window)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("cannot parse window: %v", err)
+		}
+		window := timeutil.NextWindow(schedule)
+		if window.Start.Before(now) {
+			// the window is open already
+			return time.Time{}, nil
+		}
+		return window.Start, nil
+	}
+	return time.Time{}, nil
+}
+
 func newChange(st *state.State, kind, summary string, tsets []*state.TaskSet, snapNames []string) *state.Change {
 	chg := st.NewChange(kind, summary)
 	for _, ts := range tsets {
@@ -1308,6 +1417,10 @@ func snapsOp(c *Command, r *http.Request, user *auth.UserState) Response {
 	if err := verifySnapInstructions(&inst); err != nil {
 		return BadRequest("%v", err)
 	}
+	start, err := scheduledStart(&inst.ScheduleOptions)
+	if err != nil {
+		return BadRequest("%v", err)
+	}
 
 	st := c.d.overlord.State()
 	st.Lock()
@@ -1331,6 +1444,13 @@ func snapsOp(c *Command, r *http.Request, user *auth.UserState) Response {
 	default:
 		return BadRequest("unsupported multi-snap operation %q", inst.Action)
 	}
+
+	if inst.DryRun {
+		return planSnapInstruction(&inst, st, func() (*snapInstructionResult, error) {
+			return op(&inst, st)
+		})
+	}
+
 	res, err := op(&inst, st)
 	if err != nil {
 		return inst.errToResponse(err)
@@ -1342,6 +1462,9 @@ func snapsOp(c *Command, r *http.Request, user *auth.UserState) Response {
 		chg.SetStatus(state.DoneStatus)
 	} else {
 		chg = newChange(st, inst.Action+"-snap", res.Summary, res.Tasksets, res.Affected)
+		if !start.IsZero() {
+			chg.ScheduleAt(start)
+		}
 		ensureStateSoon(st)
 	}
 
@@ -1393,6 +1516,11 @@ func postSnaps(c *Command, r *http.Request, user *auth.UserState) Response {
 
 	flags.Unaliased = isTrue(form, "unaliased")
 
+	if len(form.File["snap"]) > 1 {
+		defer form.RemoveAll()
+		return sideloadManySnaps(c, form, flags, dangerousOK)
+	}
+
 	// find the file for the "snap" form field
 	var snapBody multipart.File
 	var origPath string
@@ -1420,26 +1548,16 @@ out:
 
 	// we are in charge of the tempfile life cycle until we hand it off to the change
 	changeTriggered := false
-	// if you change this prefix, look for it in the tests
-	// also see localInstallCleanup in snapstate/snapmgr.go
-	tmpf, err := ioutil.TempFile(dirs.SnapBlobDir, dirs.LocalInstallBlobTempPrefix)
-	if err != nil {
-		return InternalError("cannot create temporary file: %v", err)
+	tempPath, rsp := writeSideloadTempFile(snapBody)
+	if rsp != nil {
+		return rsp
 	}
-
-	tempPath := tmpf.Name()
-
 	defer func() {
 		if !changeTriggered {
 			os.Remove(tempPath)
 		}
 	}()
 
-	if _, err := io.Copy(tmpf, snapBody); err != nil {
-		return InternalError("cannot copy request into temporary file: %v", err)
-	}
-	tmpf.Sync()
-
 	if len(form.Value["snap-path"]) > 0 {
 		origPath = form.Value["snap-path"][0]
 	}
@@ -1458,62 +1576,159 @@ out:
 	st.Lock()
 	defer st.Unlock()
 
-	var snapName string
-	var sideInfo *snap.SideInfo
+	sideInfo, rsp := sideloadSideInfo(st, tempPath, origPath, dangerousOK, isTrue(form, "devmode"))
+	if rsp != nil {
+		return rsp
+	}
+	snapName := sideInfo.RealName
+
+	if instanceName != "" {
+		requestedSnapName := snap.InstanceSnap(instanceName)
+		if requestedSnapName != snapName {
+			return BadRequest(fmt.Sprintf("instance name %q does not match snap name %q", instanceName, snapName))
+		}
+	} else {
+		instanceName = snapName
+	}
+
+	msg := fmt.Sprintf(i18n.G("Install %q snap from file"), instanceName)
+	if origPath != "" {
+		msg = fmt.Sprintf(i18n.G("Install %q snap from file %q"), instanceName, origPath)
+	}
+
+	tset, _, err := snapstateInstallPath(st, sideInfo, tempPath, instanceName, "", flags)
+	if err != nil {
+		return errToResponse(err, []string{snapName}, InternalError, "cannot install snap file: %v")
+	}
+
+	chg := newChange(st, "install-snap", msg, []*state.TaskSet{tset}, []string{instanceName})
+	chg.Set("api-data", map[string]string{"snap-name": instanceName})
+
+	ensureStateSoon(st)
+
+	// only when the unlock succeeds (as opposed to panicing) is the handoff done
+	// but this is good enough
+	changeTriggered = true
+
+	return AsyncResponse(nil, &Meta{Change: chg.ID()})
+}
+
+// writeSideloadTempFile copies the given uploaded snap into a
+// temporary file in the snap blob directory, returning its path.
+func writeSideloadTempFile(snapBody io.Reader) (tempPath string, rsp Response) {
+	// if you change this prefix, look for it in the tests
+	// also see localInstallCleanup in snapstate/snapmgr.go
+	tmpf, err := ioutil.TempFile(dirs.SnapBlobDir, dirs.LocalInstallBlobTempPrefix)
+	if err != nil {
+		return "", InternalError("cannot create temporary file: %v", err)
+	}
+	defer tmpf.Close()
+
+	if _, err := io.Copy(tmpf, snapBody); err != nil {
+		os.Remove(tmpf.Name())
+		return "", InternalError("cannot copy request into temporary file: %v", err)
+	}
+	tmpf.Sync()
+
+	return tmpf.Name(), nil
+}
 
+// sideloadSideInfo returns the side info of the sideloaded snap at
+// tempPath, from its assertions unless dangerousOK is set. With devmode
+// the assertions are looked for but it's ok if they are not there.
+func sideloadSideInfo(st *state.State, tempPath, origPath string, dangerousOK, devmode bool) (*snap.SideInfo, Response) {
 	if !dangerousOK {
 		si, err := snapasserts.DeriveSideInfo(tempPath, assertstate.DB(st))
 		switch {
 		case err == nil:
-			snapName = si.RealName
-			sideInfo = si
+			return si, nil
 		case asserts.IsNotFound(err):
 			// with devmode we try to find assertions but it's ok
 			// if they are not there (implies --dangerous)
-			if !isTrue(form, "devmode") {
+			if !devmode {
 				msg := "cannot find signatures with metadata for snap"
 				if origPath != "" {
 					msg = fmt.Sprintf("%s %q", msg, origPath)
 				}
-				return BadRequest(msg)
+				return nil, BadRequest(msg)
 			}
 			// TODO: set a warning if devmode
 		default:
-			return BadRequest(err.Error())
+			return nil, BadRequest(err.Error())
 		}
 	}
 
-	if snapName == "" {
-		// potentially dangerous but dangerous or devmode params were set
-		info, err := unsafeReadSnapInfo(tempPath)
-		if err != nil {
-			return BadRequest("cannot read snap file: %v", err)
-		}
-		snapName = info.SnapName()
-		sideInfo = &snap.SideInfo{RealName: snapName}
+	// potentially dangerous but dangerous or devmode params were set
+	info, err := unsafeReadSnapInfo(tempPath)
+	if err != nil {
+		return nil, BadRequest("cannot read snap file: %v", err)
 	}
+	return &snap.SideInfo{RealName: info.SnapName()}, nil
+}
 
-	if instanceName != "" {
-		requestedSnapName := snap.InstanceSnap(instanceName)
-		if requestedSnapName != snapName {
-			return BadRequest(fmt.Sprintf("instance name %q does not match snap name %q", instanceName, snapName))
-		}
-	} else {
-		instanceName = snapName
+// sideloadManySnaps installs all the uploaded snap files in a single
+// change. Each snap is installed only after the ones uploaded before
+// it, which lets bases and content providers come first, and if any of
+// them fails none of them is left installed.
+func sideloadManySnaps(c *Command, form *multipart.Form, flags snapstate.Flags, dangerousOK bool) Response {
+	if len(form.Value["name"]) > 0 {
+		return BadRequest("cannot specify an instance name when installing multiple snap files")
 	}
 
-	msg := fmt.Sprintf(i18n.G("Install %q snap from file"), instanceName)
-	if origPath != "" {
-		msg = fmt.Sprintf(i18n.G("Install %q snap from file %q"), instanceName, origPath)
+	fheaders := form.File["snap"]
+	tempPaths := make([]string, 0, len(fheaders))
+	// we are in charge of the tempfiles life cycle until we hand them off to the change
+	changeTriggered := false
+	defer func() {
+		if !changeTriggered {
+			for _, tempPath := range tempPaths {
+				os.Remove(tempPath)
+			}
+		}
+	}()
+	for _, fheader := range fheaders {
+		snapBody, err := fheader.Open()
+		if err != nil {
+			return BadRequest(`cannot open uploaded "snap" file: %v`, err)
+		}
+		tempPath, rsp := writeSideloadTempFile(snapBody)
+		snapBody.Close()
+		if rsp != nil {
+			return rsp
+		}
+		tempPaths = append(tempPaths, tempPath)
 	}
 
-	tset, _, err := snapstateInstallPath(st, sideInfo, tempPath, instanceName, "", flags)
-	if err != nil {
-		return errToResponse(err, []string{snapName}, InternalError, "cannot install snap file: %v")
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	tsets := make([]*state.TaskSet, 0, len(tempPaths))
+	names := make([]string, 0, len(tempPaths))
+	for i, tempPath := range tempPaths {
+		sideInfo, rsp := sideloadSideInfo(st, tempPath, fheaders[i].Filename, dangerousOK, isTrue(form, "devmode"))
+		if rsp != nil {
+			return rsp
+		}
+		instanceName := sideInfo.RealName
+		if strutil.ListContains(names, instanceName) {
+			return BadRequest("cannot install snap %q more than once", instanceName)
+		}
+
+		ts, _, err := snapstateInstallPath(st, sideInfo, tempPath, instanceName, "", flags)
+		if err != nil {
+			return errToResponse(err, []string{instanceName}, InternalError, "cannot install snap file: %v")
+		}
+		if len(tsets) > 0 {
+			ts.WaitAll(tsets[len(tsets)-1])
+		}
+		tsets = append(tsets, ts)
+		names = append(names, instanceName)
 	}
 
-	chg := newChange(st, "install-snap", msg, []*state.TaskSet{tset}, []string{instanceName})
-	chg.Set("api-data", map[string]string{"snap-name": instanceName})
+	msg := fmt.Sprintf(i18n.G("Install snaps %s from files"), strutil.Quoted(names))
+	chg := newChange(st, "install-snap", msg, tsets, names)
+	chg.Set("api-data", map[string]interface{}{"snap-names": names})
 
 	ensureStateSoon(st)
 
@@ -1840,8 +2055,9 @@ type changeInfo struct {
 	Ready   bool        `json:"ready"`
 	Err     string      `json:"err,omitempty"`
 
-	SpawnTime time.Time  `json:"spawn-time,omitempty"`
-	ReadyTime *time.Time `json:"ready-time,omitempty"`
+	SpawnTime     time.Time  `json:"spawn-time,omitempty"`
+	ReadyTime     *time.Time `json:"ready-time,omitempty"`
+	ScheduledTime *time.Time `json:"scheduled-time,omitempty"`
 
 	Data map[string]*json.RawMessage `json:"data,omitempty"`
 }
@@ -1879,6 +2095,10 @@ func change2changeInfo(chg *state.Change) *changeInfo {
 	if !readyTime.IsZero() {
 		chgInfo.ReadyTime = &readyTime
 	}
+	scheduledTime := chg.ScheduledTime()
+	if !scheduledTime.IsZero() {
+		chgInfo.ScheduledTime = &scheduledTime
+	}
 	if err := chg.Err(); err != nil {
 		chgInfo.Err = err.Error()
 	}
@@ -2126,6 +2346,23 @@ func runSnapctl(c *Command, r *http.Request, user *auth.UserState) Response {
 		if e, ok := err.(*ctlcmd.ForbiddenCommandError); ok {
 			return Forbidden(e.Error())
 		}
+		if e, ok := err.(*ctlcmd.UnsuccessfulError); ok {
+			// the command ran but is reporting its result through
+			// the exit code
+			return &resp{
+				Type:   ResponseTypeError,
+				Status: 200,
+				Result: &errorResult{
+					Message: e.Error(),
+					Kind:    errorKindUnsuccessful,
+					Value: map[string]interface{}{
+						"stdout":    string(stdout),
+						"stderr":    string(stderr),
+						"exit-code": e.ExitCode,
+					},
+				},
+			}
+		}
 		if e, ok := err.(*flags.Error); ok && e.Type == flags.ErrHelp {
 			stdout = []byte(e.Error())
 		} else {
@@ -2362,6 +2599,13 @@ func postApps(c *Command, r *http.Request, user *auth.UserState) Response {
 		// on POST, don't allow empty to mean all
 		return BadRequest("cannot perform operation on services without a list of services to operate on")
 	}
+	if (inst.At != nil || inst.Window != "") && inst.Action != "restart" {
+		return BadRequest("at and window can only be specified for restart")
+	}
+	start, err := scheduledStart(&inst.ScheduleOptions)
+	if err != nil {
+		return BadRequest("%v", err)
+	}
 
 	st := c.d.overlord.State()
 	appInfos, rsp := appInfosFor(st, inst.Names, appInfoOptions{service: true})
@@ -2385,6 +2629,9 @@ func postApps(c *Command, r *http.Request, user *auth.UserState) Response {
 	st.Lock()
 	defer st.Unlock()
 	chg := newChange(st, "service-control", fmt.Sprintf("Running service command"), tss, inst.Names)
+	if !start.IsZero() {
+		chg.ScheduleAt(start)
+	}
 	st.EnsureBefore(0)
 	return AsyncResponse(nil, &Meta{Change: chg.ID()})
 }
@@ -265,6 +265,8 @@ func getDebug(c *Command, r *http.Request, user *auth.UserState) Response {
 		startupTag := query.Get("startup")
 		all := query.Get("all")
 		return getChangeTimings(st, chgID, ensureTag, startupTag, all == "true")
+	case "security-profile":
+		return getSecurityProfile(c, st, query.Get("app"), query.Get("backend"))
 	default:
 		return BadRequest("unknown debug aspect %q", aspect)
 	}
@@ -0,0 +1,169 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/apparmor"
+	"github.com/snapcore/snapd/interfaces/dbus"
+	"github.com/snapcore/snapd/interfaces/kmod"
+	"github.com/snapcore/snapd/interfaces/mount"
+	"github.com/snapcore/snapd/interfaces/seccomp"
+	"github.com/snapcore/snapd/interfaces/udev"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+// securityProfileSnippet is the part of the security profile of an app
+// contributed by one plug, slot or connection.
+type securityProfileSnippet struct {
+	Kind      string              `json:"kind"`
+	Interface string              `json:"interface"`
+	Plug      *interfaces.PlugRef `json:"plug,omitempty"`
+	Slot      *interfaces.SlotRef `json:"slot,omitempty"`
+	Snippet   string              `json:"snippet"`
+}
+
+type securityProfile struct {
+	Backend  string                   `json:"backend"`
+	Snippets []securityProfileSnippet `json:"snippets"`
+}
+
+type securityProfiles struct {
+	App         string            `json:"app"`
+	SecurityTag string            `json:"security-tag"`
+	Profiles    []securityProfile `json:"profiles"`
+}
+
+// specSnippet renders the part of the given specification that applies
+// to the app or hook with the given security tag. Mount entries and
+// kernel modules apply to all the apps and hooks of the snap.
+func specSnippet(spec interfaces.Specification, securityTag string) string {
+	var buf bytes.Buffer
+	switch spec := spec.(type) {
+	case *apparmor.Specification:
+		buf.WriteString(spec.SnippetForTag(securityTag))
+	case *seccomp.Specification:
+		buf.WriteString(spec.SnippetForTag(securityTag))
+	case *dbus.Specification:
+		buf.WriteString(spec.SnippetForTag(securityTag))
+	case *udev.Specification:
+		buf.WriteString(strings.Join(spec.SnippetsForTag(securityTag), "\n"))
+	case *mount.Specification:
+		for _, entry := range spec.MountEntries() {
+			fmt.Fprintf(&buf, "%s\n", entry)
+		}
+		for _, entry := range spec.UserMountEntries() {
+			fmt.Fprintf(&buf, "%s\n", entry)
+		}
+	case *kmod.Specification:
+		modules := make([]string, 0, len(spec.Modules()))
+		for module := range spec.Modules() {
+			modules = append(modules, module)
+		}
+		sort.Strings(modules)
+		buf.WriteString(strings.Join(modules, "\n"))
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+var securityProfileBackends = []interfaces.SecuritySystem{
+	interfaces.SecurityAppArmor,
+	interfaces.SecuritySecComp,
+	interfaces.SecurityDBus,
+	interfaces.SecurityUDev,
+	interfaces.SecurityMount,
+	interfaces.SecurityKMod,
+}
+
+func getSecurityProfile(c *Command, st *state.State, appName, backendName string) Response {
+	if appName == "" {
+		return BadRequest("cannot get security profile: no app given")
+	}
+	snapName, name := snap.SplitSnapApp(appName)
+	info, err := snapstate.CurrentInfo(st, snapName)
+	if _, ok := err.(*snap.NotInstalledError); ok {
+		return SnapNotFound(snapName, err)
+	}
+	if err != nil {
+		return InternalError("cannot get security profile: %v", err)
+	}
+	app := info.Apps[name]
+	if app == nil {
+		return AppNotFound("snap %q has no app %q", snapName, name)
+	}
+	securityTag := app.SecurityTag()
+
+	repo := c.d.overlord.InterfaceManager().Repository()
+	available := make(map[interfaces.SecuritySystem]bool)
+	for _, backend := range repo.Backends() {
+		available[backend.Name()] = true
+	}
+
+	var backends []interfaces.SecuritySystem
+	for _, backend := range securityProfileBackends {
+		if backendName != "" && string(backend) != backendName {
+			continue
+		}
+		if available[backend] {
+			backends = append(backends, backend)
+		}
+	}
+	if backendName != "" && len(backends) == 0 {
+		return BadRequest("cannot get security profile: unknown or unavailable security backend %q", backendName)
+	}
+
+	result := securityProfiles{
+		App:         app.Snap.InstanceName() + "." + app.Name,
+		SecurityTag: securityTag,
+		Profiles:    []securityProfile{},
+	}
+	for _, backend := range backends {
+		contributions, err := repo.SnapSpecificationContributions(backend, app.Snap.InstanceName())
+		if err != nil {
+			return InternalError("cannot get %s security profile of %q: %v", backend, result.App, err)
+		}
+		profile := securityProfile{
+			Backend:  string(backend),
+			Snippets: []securityProfileSnippet{},
+		}
+		for _, contribution := range contributions {
+			snippet := specSnippet(contribution.Spec, securityTag)
+			if snippet == "" {
+				continue
+			}
+			profile.Snippets = append(profile.Snippets, securityProfileSnippet{
+				Kind:      contribution.Kind,
+				Interface: contribution.Interface,
+				Plug:      contribution.Plug,
+				Slot:      contribution.Slot,
+				Snippet:   snippet,
+			})
+		}
+		result.Profiles = append(result.Profiles, profile)
+	}
+	return SyncResponse(result, nil)
+}
@@ -0,0 +1,179 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/apparmor"
+	"github.com/snapcore/snapd/interfaces/builtin"
+	"github.com/snapcore/snapd/interfaces/ifacetest"
+	"github.com/snapcore/snapd/interfaces/kmod"
+	"github.com/snapcore/snapd/interfaces/seccomp"
+	"github.com/snapcore/snapd/snap"
+)
+
+func (s *apiSuite) mockSecurityProfileSnaps(c *check.C) (restore func()) {
+	restore = builtin.MockInterface(&ifacetest.TestInterface{
+		InterfaceName: "test",
+		AppArmorPermanentPlugCallback: func(spec *apparmor.Specification, plug *snap.PlugInfo) error {
+			spec.AddSnippet("/permanent/plug r,")
+			return nil
+		},
+		AppArmorConnectedPlugCallback: func(spec *apparmor.Specification, plug *interfaces.ConnectedPlug, slot *interfaces.ConnectedSlot) error {
+			spec.AddSnippet("/connected/plug rw,")
+			return nil
+		},
+		AppArmorConnectedSlotCallback: func(spec *apparmor.Specification, plug *interfaces.ConnectedPlug, slot *interfaces.ConnectedSlot) error {
+			spec.AddSnippet("/connected/slot rw,")
+			return nil
+		},
+		SecCompConnectedPlugCallback: func(spec *seccomp.Specification, plug *interfaces.ConnectedPlug, slot *interfaces.ConnectedSlot) error {
+			spec.AddSnippet("bind")
+			return nil
+		},
+		KModConnectedPlugCallback: func(spec *kmod.Specification, plug *interfaces.ConnectedPlug, slot *interfaces.ConnectedSlot) error {
+			return spec.AddModule("foo")
+		},
+	})
+
+	d := s.daemon(c)
+	repo := d.overlord.InterfaceManager().Repository()
+	for _, backend := range []interfaces.SecurityBackend{&apparmor.Backend{}, &seccomp.Backend{}, &kmod.Backend{}} {
+		c.Assert(repo.AddBackend(backend), check.IsNil)
+	}
+
+	s.mockSnap(c, consumerYaml)
+	s.mockSnap(c, producerYaml)
+	_, err := repo.Connect(&interfaces.ConnRef{
+		PlugRef: interfaces.PlugRef{Snap: "consumer", Name: "plug"},
+		SlotRef: interfaces.SlotRef{Snap: "producer", Name: "slot"},
+	}, nil, nil, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	return restore
+}
+
+func (s *apiSuite) getSecurityProfile(c *check.C, query string) *resp {
+	req, err := http.NewRequest("GET", "/v2/debug?aspect=security-profile&"+query, nil)
+	c.Assert(err, check.IsNil)
+	return getDebug(debugCmd, req, nil).(*resp)
+}
+
+func (s *apiSuite) TestGetDebugSecurityProfile(c *check.C) {
+	restore := s.mockSecurityProfileSnaps(c)
+	defer restore()
+
+	rsp := s.getSecurityProfile(c, "app=consumer.app")
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+	c.Check(rsp.Result, check.DeepEquals, securityProfiles{
+		App:         "consumer.app",
+		SecurityTag: "snap.consumer.app",
+		Profiles: []securityProfile{{
+			Backend: "apparmor",
+			Snippets: []securityProfileSnippet{{
+				Kind:      "permanent-plug",
+				Interface: "test",
+				Plug:      &interfaces.PlugRef{Snap: "consumer", Name: "plug"},
+				Snippet:   "/permanent/plug r,",
+			}, {
+				Kind:      "connected-plug",
+				Interface: "test",
+				Plug:      &interfaces.PlugRef{Snap: "consumer", Name: "plug"},
+				Slot:      &interfaces.SlotRef{Snap: "producer", Name: "slot"},
+				Snippet:   "/connected/plug rw,",
+			}},
+		}, {
+			Backend: "seccomp",
+			Snippets: []securityProfileSnippet{{
+				Kind:      "connected-plug",
+				Interface: "test",
+				Plug:      &interfaces.PlugRef{Snap: "consumer", Name: "plug"},
+				Slot:      &interfaces.SlotRef{Snap: "producer", Name: "slot"},
+				Snippet:   "bind",
+			}},
+		}, {
+			Backend: "kmod",
+			Snippets: []securityProfileSnippet{{
+				Kind:      "connected-plug",
+				Interface: "test",
+				Plug:      &interfaces.PlugRef{Snap: "consumer", Name: "plug"},
+				Slot:      &interfaces.SlotRef{Snap: "producer", Name: "slot"},
+				Snippet:   "foo",
+			}},
+		}},
+	})
+}
+
+func (s *apiSuite) TestGetDebugSecurityProfileBackend(c *check.C) {
+	restore := s.mockSecurityProfileSnaps(c)
+	defer restore()
+
+	rsp := s.getSecurityProfile(c, "app=producer.app&backend=apparmor")
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+	c.Check(rsp.Result, check.DeepEquals, securityProfiles{
+		App:         "producer.app",
+		SecurityTag: "snap.producer.app",
+		Profiles: []securityProfile{{
+			Backend: "apparmor",
+			Snippets: []securityProfileSnippet{{
+				Kind:      "connected-slot",
+				Interface: "test",
+				Plug:      &interfaces.PlugRef{Snap: "consumer", Name: "plug"},
+				Slot:      &interfaces.SlotRef{Snap: "producer", Name: "slot"},
+				Snippet:   "/connected/slot rw,",
+			}},
+		}},
+	})
+
+	rsp = s.getSecurityProfile(c, "app=producer.app&backend=kmod")
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+	c.Check(rsp.Result, check.DeepEquals, securityProfiles{
+		App:         "producer.app",
+		SecurityTag: "snap.producer.app",
+		Profiles: []securityProfile{{
+			Backend:  "kmod",
+			Snippets: []securityProfileSnippet{},
+		}},
+	})
+}
+
+func (s *apiSuite) TestGetDebugSecurityProfileErrors(c *check.C) {
+	restore := s.mockSecurityProfileSnaps(c)
+	defer restore()
+
+	rsp := s.getSecurityProfile(c, "")
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, "cannot get security profile: no app given")
+
+	rsp = s.getSecurityProfile(c, "app=consumer.app&backend=udev")
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `cannot get security profile: unknown or unavailable security backend "udev"`)
+
+	rsp = s.getSecurityProfile(c, "app=consumer.other")
+	c.Check(rsp.Status, check.Equals, 404)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `snap "consumer" has no app "other"`)
+
+	rsp = s.getSecurityProfile(c, "app=missing.app")
+	c.Check(rsp.Status, check.Equals, 404)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `snap "missing" is not installed`)
+}
@@ -0,0 +1,59 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	"gopkg.in/check.v1"
+)
+
+var _ = check.Suite(&metricsSuite{})
+
+type metricsSuite struct {
+	apiBaseSuite
+}
+
+func (s *metricsSuite) TestMetricsRootOnly(c *check.C) {
+	c.Check(metricsCmd.RootOnly, check.Equals, true)
+}
+
+func (s *metricsSuite) TestGetMetrics(c *check.C) {
+	d := s.daemon(c)
+	st := d.overlord.State()
+	st.Lock()
+	st.Unlock()
+
+	req, err := http.NewRequest("GET", "/v2/metrics", nil)
+	c.Assert(err, check.IsNil)
+
+	rr := httptest.NewRecorder()
+	getMetrics(metricsCmd, req, nil).ServeHTTP(rr, req)
+
+	rsp := rr.Result()
+	c.Assert(rsp.StatusCode, check.Equals, 200)
+	c.Check(rsp.Header.Get("Content-Type"), check.Equals, "text/plain; version=0.0.4; charset=utf-8")
+	data, err := ioutil.ReadAll(rsp.Body)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Matches, `(?s)(.*\n)?# TYPE snapd_state_lock_hold_seconds histogram\n.*`)
+	c.Check(string(data), check.Matches, `(?s).*\nsnapd_state_lock_hold_seconds_count [1-9][0-9]*\n.*`)
+}
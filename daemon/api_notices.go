@@ -0,0 +1,103 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/strutil"
+)
+
+var noticesCmd = &Command{
+	Path:   "/v2/notices",
+	UserOK: true,
+	GET:    getNotices,
+}
+
+// maxNoticesTimeout is the longest a client can wait for notices in a
+// single request.
+var maxNoticesTimeout = 10 * time.Minute
+
+func getNotices(c *Command, r *http.Request, _ *auth.UserState) Response {
+	query := r.URL.Query()
+
+	var filter state.NoticeFilter
+	for _, typ := range strutil.CommaSeparatedList(query.Get("types")) {
+		noticeType := state.NoticeType(typ)
+		if !noticeType.Valid() {
+			return BadRequest("invalid notice type %q", typ)
+		}
+		filter.Types = append(filter.Types, noticeType)
+	}
+	filter.Keys = strutil.CommaSeparatedList(query.Get("keys"))
+
+	if s := query.Get("after"); s != "" {
+		after, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return BadRequest("invalid after timestamp %q: %v", s, err)
+		}
+		filter.After = after
+	}
+
+	var timeout time.Duration
+	if s := query.Get("timeout"); s != "" {
+		var err error
+		timeout, err = time.ParseDuration(s)
+		if err != nil {
+			return BadRequest("invalid timeout %q: %v", s, err)
+		}
+		if timeout < 0 || timeout > maxNoticesTimeout {
+			return BadRequest("invalid timeout %q: must be between 0 and %s", s, maxNoticesTimeout)
+		}
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var notices []*state.Notice
+	if timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		var err error
+		notices, err = st.WaitNotices(ctx, &filter)
+		switch err {
+		case nil, context.DeadlineExceeded:
+			// got some notices, or timed out without any
+		case context.Canceled:
+			// the client went away, nobody will read this
+			return BadRequest("request canceled")
+		default:
+			return InternalError("cannot wait for notices: %v", err)
+		}
+	} else {
+		notices = st.Notices(&filter)
+	}
+
+	if len(notices) == 0 {
+		// no need to confuse the issue
+		return SyncResponse([]*state.Notice{}, nil)
+	}
+	return SyncResponse(notices, nil)
+}
@@ -0,0 +1,133 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon_test
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/daemon"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/testutil"
+)
+
+var _ = check.Suite(&apiNoticesSuite{})
+
+type apiNoticesSuite struct {
+	testutil.BaseTest
+
+	st *state.State
+}
+
+func (s *apiNoticesSuite) SetUpTest(c *check.C) {
+	s.BaseTest.SetUpTest(c)
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+
+	o := overlord.Mock()
+	daemon.NewWithOverlord(o)
+	s.st = o.State()
+}
+
+func (s *apiNoticesSuite) getNotices(c *check.C, query url.Values) *daemon.Resp {
+	req, err := http.NewRequest("GET", "/v2/notices?"+query.Encode(), nil)
+	c.Assert(err, check.IsNil)
+	return daemon.NoticesCmd.GET(daemon.NoticesCmd, req, nil).(*daemon.Resp)
+}
+
+func noticeKeys(result interface{}) []string {
+	var keys []string
+	for _, n := range result.([]*state.Notice) {
+		keys = append(keys, string(n.Type())+":"+n.Key())
+	}
+	return keys
+}
+
+func (s *apiNoticesSuite) TestNoticesNone(c *check.C) {
+	rsp := s.getNotices(c, nil)
+	c.Assert(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Result, check.DeepEquals, []*state.Notice{})
+}
+
+func (s *apiNoticesSuite) TestNoticesFilters(c *check.C) {
+	s.st.Lock()
+	s.st.AddNotice(state.SnapInstalledNotice, "foo", nil)
+	s.st.AddNotice(state.SnapRemovedNotice, "bar", nil)
+	s.st.AddNotice(state.RefreshInhibitNotice, "foo", nil)
+	after := s.st.Notices(nil)[2].LastOccurred()
+	s.st.Unlock()
+
+	rsp := s.getNotices(c, nil)
+	c.Assert(rsp.Status, check.Equals, 200)
+	c.Check(noticeKeys(rsp.Result), check.DeepEquals, []string{"snap-installed:foo", "snap-removed:bar", "refresh-inhibit:foo"})
+
+	rsp = s.getNotices(c, url.Values{"types": {"snap-installed,snap-removed"}})
+	c.Assert(rsp.Status, check.Equals, 200)
+	c.Check(noticeKeys(rsp.Result), check.DeepEquals, []string{"snap-installed:foo", "snap-removed:bar"})
+
+	rsp = s.getNotices(c, url.Values{"keys": {"foo"}})
+	c.Assert(rsp.Status, check.Equals, 200)
+	c.Check(noticeKeys(rsp.Result), check.DeepEquals, []string{"snap-installed:foo", "refresh-inhibit:foo"})
+
+	rsp = s.getNotices(c, url.Values{"after": {after.Add(time.Hour).Format(time.RFC3339Nano)}})
+	c.Assert(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Result, check.DeepEquals, []*state.Notice{})
+}
+
+func (s *apiNoticesSuite) TestNoticesWait(c *check.C) {
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		s.st.Lock()
+		defer s.st.Unlock()
+		s.st.AddNotice(state.SnapInstalledNotice, "foo", nil)
+	}()
+
+	rsp := s.getNotices(c, url.Values{"timeout": {"5s"}})
+	c.Assert(rsp.Status, check.Equals, 200)
+	c.Check(noticeKeys(rsp.Result), check.DeepEquals, []string{"snap-installed:foo"})
+}
+
+func (s *apiNoticesSuite) TestNoticesWaitTimeout(c *check.C) {
+	rsp := s.getNotices(c, url.Values{"timeout": {"10ms"}})
+	c.Assert(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Result, check.DeepEquals, []*state.Notice{})
+}
+
+func (s *apiNoticesSuite) TestNoticesBadRequest(c *check.C) {
+	for _, t := range []struct {
+		query url.Values
+		err   string
+	}{
+		{url.Values{"types": {"foo"}}, `invalid notice type "foo"`},
+		{url.Values{"after": {"yesterday"}}, `invalid after timestamp "yesterday": .*`},
+		{url.Values{"timeout": {"forever"}}, `invalid timeout "forever": .*`},
+		{url.Values{"timeout": {"-1s"}}, `invalid timeout "-1s": must be between 0 and 10m0s`},
+		{url.Values{"timeout": {"1h"}}, `invalid timeout "1h": must be between 0 and 10m0s`},
+	} {
+		rsp := s.getNotices(c, t.query)
+		c.Check(rsp.Status, check.Equals, 400, check.Commentf("%v", t.query))
+		c.Check(rsp.Result.(*daemon.ErrorResult).Message, check.Matches, t.err)
+	}
+}
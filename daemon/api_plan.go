@@ -0,0 +1,205 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"sort"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/overlord/ifacestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
+)
+
+var (
+	snapstateCollectSnapInfos     = snapstate.CollectSnapInfos
+	snapstatePlannedPrerequisites = snapstate.PlannedPrerequisites
+	snapstateChangeConflicts      = snapstate.ChangeConflicts
+	ifacestateAutoConnections     = ifacestate.AutoConnections
+)
+
+// planTaskKinds are the kinds of the tasks identifying the snap that a
+// task set installs, refreshes or removes.
+var planTaskKinds = map[string]bool{
+	"prerequisites": true,
+	"discard-snap":  true,
+}
+
+// planConflicts describes all the changes in progress that conflict with
+// the snap instruction, the first of which stopped building it.
+func planConflicts(inst *snapInstruction, st *state.State, first *snapstate.ChangeConflictError) Response {
+	names := append([]string(nil), inst.Snaps...)
+	if first.Snap != "" && !strutil.ListContains(names, first.Snap) {
+		names = append(names, first.Snap)
+	}
+	conflicts, err := snapstateChangeConflicts(st, names)
+	if err != nil {
+		return InternalError("cannot plan %s: %v", inst.Action, err)
+	}
+	if len(conflicts) == 0 {
+		// the conflict is not with a change in progress, e.g. the
+		// state of the snap changed while building the instruction
+		conflicts = []*snapstate.ChangeConflictError{first}
+	}
+
+	plan := &client.ChangePlan{}
+	for _, conflict := range conflicts {
+		plan.Conflicts = append(plan.Conflicts, &client.PlannedConflict{
+			Snap:       conflict.Snap,
+			ChangeKind: conflict.ChangeKind,
+			ChangeID:   conflict.ChangeID,
+			Message:    conflict.Error(),
+		})
+	}
+	return SyncResponse(plan, nil)
+}
+
+// planSnapInstruction builds the task sets of a snap instruction with
+// the given function, then describes the change they would make and
+// throws them away.
+func planSnapInstruction(inst *snapInstruction, st *state.State, build func() (*snapInstructionResult, error)) Response {
+	infos, stop := snapstateCollectSnapInfos(st)
+	res, err := build()
+	stop()
+	if err != nil {
+		if conflict, ok := err.(*snapstate.ChangeConflictError); ok {
+			return planConflicts(inst, st, conflict)
+		}
+		return inst.errToResponse(err)
+	}
+
+	var tasks []*state.Task
+	for _, ts := range res.Tasksets {
+		tasks = append(tasks, ts.Tasks()...)
+	}
+	defer st.DiscardTasks(tasks)
+
+	plan := &client.ChangePlan{Summary: res.Summary}
+	for _, t := range tasks {
+		planned := &client.PlannedTask{
+			ID:      t.ID(),
+			Kind:    t.Kind(),
+			Summary: t.Summary(),
+		}
+		for _, wt := range t.WaitTasks() {
+			planned.WaitTasks = append(planned.WaitTasks, wt.ID())
+		}
+		plan.Tasks = append(plan.Tasks, planned)
+	}
+
+	snaps := make(map[string]*client.PlannedSnap)
+	var prereqsOf []*snapstate.SnapSetup
+	for _, t := range tasks {
+		if !planTaskKinds[t.Kind()] {
+			continue
+		}
+		snapsup, err := snapstate.TaskSnapSetup(t)
+		if err != nil {
+			return InternalError("cannot plan %s: %v", inst.Action, err)
+		}
+		name := snapsup.InstanceName()
+		if snaps[name] != nil {
+			continue
+		}
+		planned := &client.PlannedSnap{
+			Name:   name,
+			Action: inst.Action,
+		}
+		if inst.Action == "remove" {
+			if !inst.Revision.Unset() {
+				planned.Revision = inst.Revision.String()
+			}
+		} else {
+			planned.Revision = snapsup.Revision().String()
+			planned.Channel = snapsup.Channel
+			if snapsup.SnapPath == "" && snapsup.DownloadInfo != nil {
+				planned.DownloadSize = snapsup.DownloadInfo.Size
+			}
+			prereqsOf = append(prereqsOf, snapsup)
+		}
+		snaps[name] = planned
+		plan.Snaps = append(plan.Snaps, planned)
+	}
+
+	for _, snapsup := range prereqsOf {
+		prereqs, err := snapstatePlannedPrerequisites(st, snapsup)
+		if err != nil {
+			return InternalError("cannot plan %s: %v", inst.Action, err)
+		}
+		for _, name := range prereqs {
+			planned := snaps[name]
+			if planned == nil {
+				planned = &client.PlannedSnap{
+					Name:   name,
+					Action: "install",
+				}
+				snaps[name] = planned
+				plan.Snaps = append(plan.Snaps, planned)
+			}
+			if planned.Action == "install" && planned.Revision == "" {
+				planned.RequiredBy = append(planned.RequiredBy, snapsup.InstanceName())
+			}
+		}
+	}
+
+	if len(infos) > 0 {
+		names := make([]string, 0, len(infos))
+		for name := range infos {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		infoList := make([]*snap.Info, len(names))
+		for i, name := range names {
+			infoList[i] = infos[name]
+		}
+		connRefs, err := ifacestateAutoConnections(st, infoList)
+		if err != nil {
+			return InternalError("cannot plan %s: %v", inst.Action, err)
+		}
+		for _, connRef := range connRefs {
+			plan.AutoConnections = append(plan.AutoConnections, &client.PlannedConnection{
+				Plug:      client.PlugRef{Snap: connRef.PlugRef.Snap, Name: connRef.PlugRef.Name},
+				Slot:      client.SlotRef{Snap: connRef.SlotRef.Snap, Name: connRef.SlotRef.Name},
+				Interface: plannedInterface(infos, connRef),
+			})
+		}
+	}
+
+	return SyncResponse(plan, nil)
+}
+
+// plannedInterface returns the interface of the given connection, at
+// least one side of which belongs to the given snaps.
+func plannedInterface(infos map[string]*snap.Info, connRef *interfaces.ConnRef) string {
+	if info := infos[connRef.PlugRef.Snap]; info != nil {
+		if plug := info.Plugs[connRef.PlugRef.Name]; plug != nil {
+			return plug.Interface
+		}
+	}
+	if info := infos[connRef.SlotRef.Snap]; info != nil {
+		if slot := info.Slots[connRef.SlotRef.Name]; slot != nil {
+			return slot.Interface
+		}
+	}
+	return ""
+}
@@ -0,0 +1,277 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+func (s *apiSuite) mockPlanning(c *check.C, infos map[string]*snap.Info, prereqs []string, connRefs []*interfaces.ConnRef) (restore func()) {
+	oldCollect := snapstateCollectSnapInfos
+	oldPrereqs := snapstatePlannedPrerequisites
+	oldAutoConnections := ifacestateAutoConnections
+	snapstateCollectSnapInfos = func(*state.State) (map[string]*snap.Info, func()) {
+		return infos, func() {}
+	}
+	snapstatePlannedPrerequisites = func(_ *state.State, snapsup *snapstate.SnapSetup) ([]string, error) {
+		return prereqs, nil
+	}
+	ifacestateAutoConnections = func(_ *state.State, planned []*snap.Info) ([]*interfaces.ConnRef, error) {
+		c.Check(planned, check.HasLen, len(infos))
+		return connRefs, nil
+	}
+	return func() {
+		snapstateCollectSnapInfos = oldCollect
+		snapstatePlannedPrerequisites = oldPrereqs
+		ifacestateAutoConnections = oldAutoConnections
+	}
+}
+
+func plannedTaskSet(st *state.State, name string, rev int, firstKind string) *state.TaskSet {
+	first := st.NewTask(firstKind, "first "+name)
+	first.Set("snap-setup", &snapstate.SnapSetup{
+		SideInfo:     &snap.SideInfo{RealName: name, Revision: snap.R(rev)},
+		Channel:      "stable",
+		DownloadInfo: &snap.DownloadInfo{Size: 1024},
+	})
+	second := st.NewTask("link-snap", "second "+name)
+	second.WaitFor(first)
+	return state.NewTaskSet(first, second)
+}
+
+func (s *apiSuite) TestPostSnapDryRun(c *check.C) {
+	snapstateInstall = func(ctx context.Context, st *state.State, name string, opts *snapstate.RevisionOptions, userID int, flags snapstate.Flags) (*state.TaskSet, error) {
+		return plannedTaskSet(st, name, 7, "prerequisites"), nil
+	}
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "some-snap"}}
+	info.Plugs = map[string]*snap.PlugInfo{
+		"plug": {Snap: info, Name: "plug", Interface: "network"},
+	}
+	restore := s.mockPlanning(c, map[string]*snap.Info{"some-snap": info}, []string{"core18"}, []*interfaces.ConnRef{
+		interfaces.NewConnRef(info.Plugs["plug"], &snap.SlotInfo{Snap: &snap.Info{SideInfo: snap.SideInfo{RealName: "core"}}, Name: "network"}),
+	})
+	defer restore()
+
+	d := s.daemonWithFakeSnapManager(c)
+
+	buf := bytes.NewBufferString(`{"action": "install", "dry-run": true}`)
+	req, err := http.NewRequest("POST", "/v2/snaps/some-snap", buf)
+	c.Assert(err, check.IsNil)
+
+	s.vars = map[string]string{"name": "some-snap"}
+	rsp := postSnap(snapCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+
+	plan := rsp.Result.(*client.ChangePlan)
+	c.Check(plan.Summary, check.Equals, `Install "some-snap" snap`)
+	c.Assert(plan.Tasks, check.HasLen, 2)
+	c.Check(plan.Tasks[0].Kind, check.Equals, "prerequisites")
+	c.Check(plan.Tasks[0].WaitTasks, check.HasLen, 0)
+	c.Check(plan.Tasks[1].Kind, check.Equals, "link-snap")
+	c.Check(plan.Tasks[1].WaitTasks, check.DeepEquals, []string{plan.Tasks[0].ID})
+	c.Check(plan.Snaps, check.DeepEquals, []*client.PlannedSnap{
+		{Name: "some-snap", Action: "install", Revision: "7", Channel: "stable", DownloadSize: 1024},
+		{Name: "core18", Action: "install", RequiredBy: []string{"some-snap"}},
+	})
+	c.Check(plan.AutoConnections, check.DeepEquals, []*client.PlannedConnection{{
+		Plug:      client.PlugRef{Snap: "some-snap", Name: "plug"},
+		Slot:      client.SlotRef{Snap: "core", Name: "network"},
+		Interface: "network",
+	}})
+	c.Check(plan.Conflicts, check.HasLen, 0)
+
+	// nothing was left behind
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	c.Check(st.Changes(), check.HasLen, 0)
+	c.Check(st.Tasks(), check.HasLen, 0)
+}
+
+func (s *apiSuite) TestPostSnapDryRunConflict(c *check.C) {
+	snapstateInstall = func(ctx context.Context, st *state.State, name string, opts *snapstate.RevisionOptions, userID int, flags snapstate.Flags) (*state.TaskSet, error) {
+		return nil, &snapstate.ChangeConflictError{Snap: name, ChangeKind: "refresh-snap", ChangeID: "42"}
+	}
+	restore := s.mockPlanning(c, nil, nil, nil)
+	defer restore()
+
+	s.daemonWithFakeSnapManager(c)
+
+	buf := bytes.NewBufferString(`{"action": "install", "dry-run": true}`)
+	req, err := http.NewRequest("POST", "/v2/snaps/some-snap", buf)
+	c.Assert(err, check.IsNil)
+
+	s.vars = map[string]string{"name": "some-snap"}
+	rsp := postSnap(snapCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+
+	plan := rsp.Result.(*client.ChangePlan)
+	c.Check(plan.Tasks, check.HasLen, 0)
+	c.Check(plan.Conflicts, check.DeepEquals, []*client.PlannedConflict{{
+		Snap:       "some-snap",
+		ChangeKind: "refresh-snap",
+		ChangeID:   "42",
+		Message:    `snap "some-snap" has "refresh-snap" change in progress`,
+	}})
+}
+
+func (s *apiSuite) TestPostSnapDryRunWrongAction(c *check.C) {
+	s.daemonWithOverlordMock(c)
+
+	buf := bytes.NewBufferString(`{"action": "revert", "dry-run": true}`)
+	req, err := http.NewRequest("POST", "/v2/snaps/some-snap", buf)
+	c.Assert(err, check.IsNil)
+
+	s.vars = map[string]string{"name": "some-snap"}
+	rsp := postSnap(snapCmd, req, nil).(*resp)
+	c.Check(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, "dry-run can only be specified for install, refresh or remove")
+}
+
+func (s *apiSuite) TestPostSnapsRemoveDryRun(c *check.C) {
+	snapstateRemoveMany = func(st *state.State, names []string) ([]string, []*state.TaskSet, error) {
+		var tss []*state.TaskSet
+		for _, name := range names {
+			tss = append(tss, plannedTaskSet(st, name, 1, "discard-snap"))
+		}
+		return names, tss, nil
+	}
+	restore := s.mockPlanning(c, nil, nil, nil)
+	defer restore()
+
+	d := s.daemonWithFakeSnapManager(c)
+
+	buf := strings.NewReader(`{"action": "remove", "snaps": ["foo", "bar"], "dry-run": true}`)
+	req, err := http.NewRequest("POST", "/v2/snaps", buf)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+
+	plan := rsp.Result.(*client.ChangePlan)
+	c.Check(plan.Summary, check.Equals, `Remove snaps "foo", "bar"`)
+	c.Check(plan.Tasks, check.HasLen, 4)
+	c.Check(plan.Snaps, check.DeepEquals, []*client.PlannedSnap{
+		{Name: "foo", Action: "remove"},
+		{Name: "bar", Action: "remove"},
+	})
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	c.Check(st.Changes(), check.HasLen, 0)
+	c.Check(st.Tasks(), check.HasLen, 0)
+}
+
+func (s *apiSuite) TestPostSnapsRefreshDryRun(c *check.C) {
+	snapstateUpdateMany = func(_ context.Context, st *state.State, names []string, userID int, flags *snapstate.Flags) ([]string, []*state.TaskSet, error) {
+		c.Check(names, check.HasLen, 0)
+		// planning leaves the state alone
+		c.Check(flags, check.DeepEquals, &snapstate.Flags{Planning: true})
+		return []string{"foo"}, []*state.TaskSet{plannedTaskSet(st, "foo", 3, "prerequisites")}, nil
+	}
+	assertstateRefreshSnapDeclarations = func(*state.State, int) error {
+		c.Fatalf("unexpected refresh of the snap declarations")
+		return nil
+	}
+	restore := s.mockPlanning(c, nil, nil, nil)
+	defer restore()
+
+	d := s.daemonWithFakeSnapManager(c)
+
+	buf := strings.NewReader(`{"action": "refresh", "dry-run": true}`)
+	req, err := http.NewRequest("POST", "/v2/snaps", buf)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+
+	plan := rsp.Result.(*client.ChangePlan)
+	c.Check(plan.Summary, check.Equals, `Refresh snap "foo"`)
+	c.Check(plan.Snaps, check.DeepEquals, []*client.PlannedSnap{
+		{Name: "foo", Action: "refresh", Revision: "3", Channel: "stable", DownloadSize: 1024},
+	})
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	c.Check(st.Changes(), check.HasLen, 0)
+	c.Check(st.Tasks(), check.HasLen, 0)
+}
+
+func (s *apiSuite) TestPostSnapsRemoveDryRunConflicts(c *check.C) {
+	restore := s.mockPlanning(c, nil, nil, nil)
+	defer restore()
+
+	d := s.daemonWithFakeSnapManager(c)
+
+	// both snaps are being refreshed
+	st := d.overlord.State()
+	st.Lock()
+	var chgIDs []string
+	for _, name := range []string{"foo", "bar"} {
+		chg := st.NewChange("refresh-snap", "...")
+		chg.AddAll(plannedTaskSet(st, name, 2, "prerequisites"))
+		chgIDs = append(chgIDs, chg.ID())
+	}
+	st.Unlock()
+
+	snapstateRemoveMany = func(st *state.State, names []string) ([]string, []*state.TaskSet, error) {
+		return nil, nil, snapstate.CheckChangeConflictMany(st, names, "")
+	}
+
+	buf := strings.NewReader(`{"action": "remove", "snaps": ["foo", "bar"], "dry-run": true}`)
+	req, err := http.NewRequest("POST", "/v2/snaps", buf)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+
+	plan := rsp.Result.(*client.ChangePlan)
+	c.Check(plan.Tasks, check.HasLen, 0)
+	sort.Slice(plan.Conflicts, func(i, j int) bool { return plan.Conflicts[i].Snap > plan.Conflicts[j].Snap })
+	c.Check(plan.Conflicts, check.DeepEquals, []*client.PlannedConflict{{
+		Snap:       "foo",
+		ChangeKind: "refresh-snap",
+		ChangeID:   chgIDs[0],
+		Message:    `snap "foo" has "refresh-snap" change in progress`,
+	}, {
+		Snap:       "bar",
+		ChangeKind: "refresh-snap",
+		ChangeID:   chgIDs[1],
+		Message:    `snap "bar" has "refresh-snap" change in progress`,
+	}})
+}
@@ -0,0 +1,184 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/servicestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap/quota"
+)
+
+var (
+	quotaGroupsCmd = &Command{
+		Path:   "/v2/quotas",
+		GET:    getQuotaGroups,
+		POST:   postQuotaGroup,
+		UserOK: true,
+	}
+
+	quotaGroupInfoCmd = &Command{
+		Path:   "/v2/quotas/{group}",
+		GET:    getQuotaGroupInfo,
+		UserOK: true,
+	}
+)
+
+var (
+	servicestateEnsureQuota       = servicestate.EnsureQuota
+	servicestateRemoveQuota       = servicestate.RemoveQuota
+	servicestateCurrentQuotaUsage = servicestate.CurrentQuotaUsage
+)
+
+// quotaGroupResult computes the client representation of the given
+// quota group, along with its current usage if it can be determined.
+func quotaGroupResult(grp *quota.Group) *client.QuotaGroupResult {
+	res := &client.QuotaGroupResult{
+		GroupName:     grp.Name,
+		Snaps:         grp.Snaps,
+		MemoryLimit:   grp.MemoryLimit,
+		CPUPercentage: grp.CPUPercentage,
+		TaskLimit:     grp.TaskLimit,
+	}
+	usage, err := servicestateCurrentQuotaUsage(grp)
+	if err != nil {
+		// this is expected if no service of the group ever ran
+		logger.Debugf("cannot get current usage of quota group %q: %v", grp.Name, err)
+		return res
+	}
+	res.Usage = &client.QuotaGroupUsage{
+		Memory: usage.Memory,
+		CPU:    usage.CPU,
+		Tasks:  usage.Tasks,
+	}
+	return res
+}
+
+func getQuotaGroups(c *Command, r *http.Request, _ *auth.UserState) Response {
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	quotas, err := servicestate.AllQuotas(st)
+	if err != nil {
+		return InternalError("cannot get quota groups: %v", err)
+	}
+
+	names := make([]string, 0, len(quotas))
+	for name := range quotas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]*client.QuotaGroupResult, 0, len(names))
+	for _, name := range names {
+		results = append(results, quotaGroupResult(quotas[name]))
+	}
+	return SyncResponse(results, nil)
+}
+
+func getQuotaGroupInfo(c *Command, r *http.Request, _ *auth.UserState) Response {
+	name := muxVars(r)["group"]
+	if err := quota.ValidateGroupName(name); err != nil {
+		return BadRequest("%v", err)
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	grp, err := servicestate.GetQuota(st, name)
+	if err == state.ErrNoState {
+		return NotFound("cannot find quota group %q", name)
+	}
+	if err != nil {
+		return InternalError("cannot get quota group %q: %v", name, err)
+	}
+	return SyncResponse(quotaGroupResult(grp), nil)
+}
+
+type postQuotaGroupData struct {
+	Action        string   `json:"action"`
+	GroupName     string   `json:"group-name"`
+	Snaps         []string `json:"snaps,omitempty"`
+	MemoryLimit   uint64   `json:"memory-limit,omitempty"`
+	CPUPercentage int      `json:"cpu-percentage,omitempty"`
+	TaskLimit     int      `json:"task-limit,omitempty"`
+}
+
+func postQuotaGroup(c *Command, r *http.Request, _ *auth.UserState) Response {
+	var data postQuotaGroupData
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return BadRequest("cannot decode quota action from request body: %v", err)
+	}
+	if err := quota.ValidateGroupName(data.GroupName); err != nil {
+		return BadRequest("%v", err)
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var ts *state.TaskSet
+	var summary string
+	var err error
+	switch data.Action {
+	case "ensure":
+		summary = fmt.Sprintf(i18n.G("Update quota group %q"), data.GroupName)
+		if _, err := servicestate.GetQuota(st, data.GroupName); err == state.ErrNoState {
+			summary = fmt.Sprintf(i18n.G("Create quota group %q"), data.GroupName)
+		}
+		ts, err = servicestateEnsureQuota(st, &quota.Group{
+			Name:          data.GroupName,
+			Snaps:         data.Snaps,
+			MemoryLimit:   data.MemoryLimit,
+			CPUPercentage: data.CPUPercentage,
+			TaskLimit:     data.TaskLimit,
+		})
+	case "remove":
+		if len(data.Snaps) != 0 || data.MemoryLimit != 0 || data.CPUPercentage != 0 || data.TaskLimit != 0 {
+			return BadRequest("cannot use snaps or limits with remove action")
+		}
+		summary = fmt.Sprintf(i18n.G("Remove quota group %q"), data.GroupName)
+		ts, err = servicestateRemoveQuota(st, data.GroupName)
+	default:
+		return BadRequest("unknown quota action %q", data.Action)
+	}
+	if err != nil {
+		if cce, ok := err.(*snapstate.ChangeConflictError); ok {
+			return SnapChangeConflict(cce)
+		}
+		return BadRequest("%v", err)
+	}
+
+	chg := newChange(st, "quota-control", summary, []*state.TaskSet{ts}, data.Snaps)
+	st.EnsureBefore(0)
+	return AsyncResponse(nil, &Meta{Change: chg.ID()})
+}
@@ -0,0 +1,246 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/daemon"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord"
+	"github.com/snapcore/snapd/overlord/servicestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap/quota"
+	"github.com/snapcore/snapd/testutil"
+)
+
+var _ = check.Suite(&apiQuotaSuite{})
+
+type apiQuotaSuite struct {
+	testutil.BaseTest
+
+	st *state.State
+}
+
+func (s *apiQuotaSuite) SetUpTest(c *check.C) {
+	s.BaseTest.SetUpTest(c)
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+
+	o := overlord.Mock()
+	daemon.NewWithOverlord(o)
+	s.st = o.State()
+
+	s.AddCleanup(daemon.MockServicestateCurrentQuotaUsage(func(grp *quota.Group) (*servicestate.QuotaGroupUsage, error) {
+		if grp.Name == "idle" {
+			return nil, errors.New("accounting is not enabled")
+		}
+		return &servicestate.QuotaGroupUsage{Memory: 4096, CPU: 1500000000, Tasks: 3}, nil
+	}))
+}
+
+func (s *apiQuotaSuite) mockQuotas(grps ...*quota.Group) {
+	s.st.Lock()
+	defer s.st.Unlock()
+	quotas := make(map[string]*quota.Group, len(grps))
+	for _, grp := range grps {
+		quotas[grp.Name] = grp
+	}
+	s.st.Set("quotas", quotas)
+}
+
+func (s *apiQuotaSuite) postQuotas(c *check.C, body string) *daemon.Resp {
+	req, err := http.NewRequest("POST", "/v2/quotas", bytes.NewBufferString(body))
+	c.Assert(err, check.IsNil)
+	return daemon.QuotaGroupsCmd.POST(daemon.QuotaGroupsCmd, req, nil).(*daemon.Resp)
+}
+
+func (s *apiQuotaSuite) TestGetQuotaGroupsNone(c *check.C) {
+	req, err := http.NewRequest("GET", "/v2/quotas", nil)
+	c.Assert(err, check.IsNil)
+	rsp := daemon.QuotaGroupsCmd.GET(daemon.QuotaGroupsCmd, req, nil).(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Result, check.DeepEquals, []*client.QuotaGroupResult{})
+}
+
+func (s *apiQuotaSuite) TestGetQuotaGroups(c *check.C) {
+	s.mockQuotas(
+		&quota.Group{Name: "work", Snaps: []string{"foo"}, MemoryLimit: 1024 * 1024},
+		&quota.Group{Name: "idle", CPUPercentage: 50},
+	)
+
+	req, err := http.NewRequest("GET", "/v2/quotas", nil)
+	c.Assert(err, check.IsNil)
+	rsp := daemon.QuotaGroupsCmd.GET(daemon.QuotaGroupsCmd, req, nil).(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Result, check.DeepEquals, []*client.QuotaGroupResult{
+		{GroupName: "idle", CPUPercentage: 50},
+		{GroupName: "work", Snaps: []string{"foo"}, MemoryLimit: 1024 * 1024, Usage: &client.QuotaGroupUsage{Memory: 4096, CPU: 1500000000, Tasks: 3}},
+	})
+}
+
+func (s *apiQuotaSuite) TestGetQuotaGroupInfo(c *check.C) {
+	s.mockQuotas(&quota.Group{Name: "work", Snaps: []string{"foo"}, TaskLimit: 32})
+
+	s.AddCleanup(daemon.MockMuxVars(func(*http.Request) map[string]string {
+		return map[string]string{"group": "work"}
+	}))
+	req, err := http.NewRequest("GET", "/v2/quotas/work", nil)
+	c.Assert(err, check.IsNil)
+	rsp := daemon.QuotaGroupInfoCmd.GET(daemon.QuotaGroupInfoCmd, req, nil).(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Result, check.DeepEquals, &client.QuotaGroupResult{
+		GroupName: "work",
+		Snaps:     []string{"foo"},
+		TaskLimit: 32,
+		Usage:     &client.QuotaGroupUsage{Memory: 4096, CPU: 1500000000, Tasks: 3},
+	})
+}
+
+func (s *apiQuotaSuite) TestGetQuotaGroupInfoErrors(c *check.C) {
+	group := "missing"
+	s.AddCleanup(daemon.MockMuxVars(func(*http.Request) map[string]string {
+		return map[string]string{"group": group}
+	}))
+	req, err := http.NewRequest("GET", "/v2/quotas/"+group, nil)
+	c.Assert(err, check.IsNil)
+	rsp := daemon.QuotaGroupInfoCmd.GET(daemon.QuotaGroupInfoCmd, req, nil).(*daemon.Resp)
+	c.Check(rsp.Status, check.Equals, 404)
+	c.Check(rsp.Result.(*daemon.ErrorResult).Message, check.Equals, `cannot find quota group "missing"`)
+
+	group = "Invalid"
+	rsp = daemon.QuotaGroupInfoCmd.GET(daemon.QuotaGroupInfoCmd, req, nil).(*daemon.Resp)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*daemon.ErrorResult).Message, check.Equals, `invalid quota group name "Invalid"`)
+}
+
+func (s *apiQuotaSuite) TestPostEnsureQuota(c *check.C) {
+	var called *quota.Group
+	s.AddCleanup(daemon.MockServicestateEnsureQuota(func(st *state.State, update *quota.Group) (*state.TaskSet, error) {
+		called = update
+		return state.NewTaskSet(st.NewTask("quota-control", "...")), nil
+	}))
+
+	rsp := s.postQuotas(c, `{"action": "ensure", "group-name": "work", "snaps": ["foo"], "memory-limit": 1048576, "cpu-percentage": 50, "task-limit": 32}`)
+	c.Assert(rsp.Status, check.Equals, 202)
+	c.Check(called, check.DeepEquals, &quota.Group{
+		Name:          "work",
+		Snaps:         []string{"foo"},
+		MemoryLimit:   1024 * 1024,
+		CPUPercentage: 50,
+		TaskLimit:     32,
+	})
+
+	s.st.Lock()
+	defer s.st.Unlock()
+	chg := s.st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Kind(), check.Equals, "quota-control")
+	c.Check(chg.Summary(), check.Equals, `Create quota group "work"`)
+	c.Check(chg.Tasks(), check.HasLen, 1)
+	var snapNames []string
+	c.Assert(chg.Get("snap-names", &snapNames), check.IsNil)
+	c.Check(snapNames, check.DeepEquals, []string{"foo"})
+}
+
+func (s *apiQuotaSuite) TestPostEnsureQuotaUpdate(c *check.C) {
+	s.mockQuotas(&quota.Group{Name: "work", Snaps: []string{"foo"}, TaskLimit: 32})
+	s.AddCleanup(daemon.MockServicestateEnsureQuota(func(st *state.State, update *quota.Group) (*state.TaskSet, error) {
+		return state.NewTaskSet(st.NewTask("quota-control", "...")), nil
+	}))
+
+	rsp := s.postQuotas(c, `{"action": "ensure", "group-name": "work", "memory-limit": 1048576}`)
+	c.Assert(rsp.Status, check.Equals, 202)
+
+	s.st.Lock()
+	defer s.st.Unlock()
+	chg := s.st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Summary(), check.Equals, `Update quota group "work"`)
+}
+
+func (s *apiQuotaSuite) TestPostEnsureQuotaError(c *check.C) {
+	s.AddCleanup(daemon.MockServicestateEnsureQuota(func(st *state.State, update *quota.Group) (*state.TaskSet, error) {
+		return nil, errors.New("boom")
+	}))
+
+	rsp := s.postQuotas(c, `{"action": "ensure", "group-name": "work", "task-limit": 32}`)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*daemon.ErrorResult).Message, check.Equals, "boom")
+}
+
+func (s *apiQuotaSuite) TestPostEnsureQuotaConflict(c *check.C) {
+	s.AddCleanup(daemon.MockServicestateEnsureQuota(func(st *state.State, update *quota.Group) (*state.TaskSet, error) {
+		return nil, &snapstate.ChangeConflictError{Snap: "foo", ChangeKind: "install"}
+	}))
+
+	rsp := s.postQuotas(c, `{"action": "ensure", "group-name": "work", "snaps": ["foo"], "task-limit": 32}`)
+	c.Check(rsp.Status, check.Equals, 409)
+}
+
+func (s *apiQuotaSuite) TestPostRemoveQuota(c *check.C) {
+	var called string
+	s.AddCleanup(daemon.MockServicestateRemoveQuota(func(st *state.State, name string) (*state.TaskSet, error) {
+		called = name
+		return state.NewTaskSet(st.NewTask("quota-control", "...")), nil
+	}))
+
+	rsp := s.postQuotas(c, `{"action": "remove", "group-name": "work"}`)
+	c.Assert(rsp.Status, check.Equals, 202)
+	c.Check(called, check.Equals, "work")
+
+	s.st.Lock()
+	defer s.st.Unlock()
+	chg := s.st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Kind(), check.Equals, "quota-control")
+	c.Check(chg.Summary(), check.Equals, `Remove quota group "work"`)
+}
+
+func (s *apiQuotaSuite) TestPostQuotaBadRequest(c *check.C) {
+	s.AddCleanup(daemon.MockServicestateEnsureQuota(func(st *state.State, update *quota.Group) (*state.TaskSet, error) {
+		c.Fatalf("unexpected call")
+		return nil, nil
+	}))
+	s.AddCleanup(daemon.MockServicestateRemoveQuota(func(st *state.State, name string) (*state.TaskSet, error) {
+		c.Fatalf("unexpected call")
+		return nil, nil
+	}))
+
+	for _, t := range []struct {
+		body string
+		err  string
+	}{
+		{`}`, `cannot decode quota action from request body: .*`},
+		{`{"action": "ensure", "group-name": "Work"}`, `invalid quota group name "Work"`},
+		{`{"action": "foo", "group-name": "work"}`, `unknown quota action "foo"`},
+		{`{"action": "remove", "group-name": "work", "task-limit": 32}`, `cannot use snaps or limits with remove action`},
+	} {
+		rsp := s.postQuotas(c, t.body)
+		c.Check(rsp.Status, check.Equals, 400, check.Commentf("%s", t.body))
+		c.Check(rsp.Result.(*daemon.ErrorResult).Message, check.Matches, t.err)
+	}
+}
@@ -42,6 +42,12 @@ var snapshotCmd = &Command{
 	POST:     changeSnapshots,
 }
 
+var snapshotExportCmd = &Command{
+	Path:     "/v2/snapshots/{id}/export",
+	PolkitOK: "io.snapcraft.snapd.manage",
+	GET:      getSnapshotExport,
+}
+
 func listSnapshots(c *Command, r *http.Request, user *auth.UserState) Response {
 	query := r.URL.Query()
 	var setID uint64
@@ -67,6 +73,8 @@ type snapshotAction struct {
 	Action string   `json:"action"`
 	Snaps  []string `json:"snaps,omitempty"`
 	Users  []string `json:"users,omitempty"`
+
+	DecryptionKey string `json:"decryption-key,omitempty"`
 }
 
 func (action snapshotAction) String() string {
@@ -83,6 +91,10 @@ func (action snapshotAction) String() string {
 }
 
 func changeSnapshots(c *Command, r *http.Request, user *auth.UserState) Response {
+	if r.Header.Get("Content-Type") == client.SnapshotExportMediaType {
+		return doSnapshotImport(c, r, user)
+	}
+
 	var action snapshotAction
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&action); err != nil {
@@ -110,13 +122,16 @@ func changeSnapshots(c *Command, r *http.Request, user *auth.UserState) Response
 
 	switch action.Action {
 	case "check":
-		affected, ts, err = snapshotCheck(st, action.SetID, action.Snaps, action.Users)
+		affected, ts, err = snapshotCheck(st, action.SetID, action.Snaps, action.Users, action.DecryptionKey)
 	case "restore":
-		affected, ts, err = snapshotRestore(st, action.SetID, action.Snaps, action.Users)
+		affected, ts, err = snapshotRestore(st, action.SetID, action.Snaps, action.Users, action.DecryptionKey)
 	case "forget":
 		if len(action.Users) != 0 {
 			return BadRequest(`snapshot "forget" operation cannot specify users`)
 		}
+		if action.DecryptionKey != "" {
+			return BadRequest(`snapshot "forget" operation cannot specify a decryption key`)
+		}
 		affected, ts, err = snapshotForget(st, action.SetID, action.Snaps)
 	default:
 		return BadRequest("unknown snapshot operation %q", action.Action)
@@ -137,3 +152,42 @@ func changeSnapshots(c *Command, r *http.Request, user *auth.UserState) Response
 
 	return AsyncResponse(nil, &Meta{Change: chg.ID()})
 }
+
+func getSnapshotExport(c *Command, r *http.Request, user *auth.UserState) Response {
+	sid := muxVars(r)["id"]
+	setID, err := strconv.ParseUint(sid, 10, 64)
+	if err != nil {
+		return BadRequest("'id' must be a positive base 10 number; got %q", sid)
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	export, err := snapshotExport(context.TODO(), st, setID)
+	st.Unlock()
+	switch err {
+	case nil:
+		// woo
+	case client.ErrSnapshotSetNotFound:
+		return NotFound("%v", err)
+	default:
+		return InternalError("cannot export snapshot set #%d: %v", setID, err)
+	}
+
+	return &snapshotExportResponse{SnapshotExport: export}
+}
+
+func doSnapshotImport(c *Command, r *http.Request, user *auth.UserState) Response {
+	// the state is locked by snapshotImport only while needed, as the
+	// import itself can take a while
+	st := c.d.overlord.State()
+	setID, snapNames, err := snapshotImport(context.TODO(), st, r.Body)
+	if err != nil {
+		return BadRequest("%v", err)
+	}
+
+	result := client.SnapshotImportSet{
+		ID:    setID,
+		Snaps: snapNames,
+	}
+	return SyncResponse(&result, nil)
+}
@@ -20,10 +20,15 @@
 package daemon_test
 
 import (
+	"archive/tar"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 
 	"gopkg.in/check.v1"
@@ -33,6 +38,7 @@ import (
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/overlord"
 	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/store/storetest"
@@ -64,7 +70,7 @@ func (s *snapshotSuite) TearDownTest(c *check.C) {
 }
 
 func (s *snapshotSuite) TestSnapshotMany(c *check.C) {
-	defer daemon.MockSnapshotSave(func(s *state.State, snaps, users []string) (uint64, []string, *state.TaskSet, error) {
+	defer daemon.MockSnapshotSave(func(s *state.State, snaps, users []string, encryptionKey string) (uint64, []string, *state.TaskSet, error) {
 		c.Check(snaps, check.HasLen, 2)
 		t := s.NewTask("fake-snapshot-2", "Snapshot two")
 		return 1, snaps, state.NewTaskSet(t), nil
@@ -80,6 +86,23 @@ func (s *snapshotSuite) TestSnapshotMany(c *check.C) {
 	c.Check(res.Affected, check.DeepEquals, inst.Snaps)
 }
 
+func (s *snapshotSuite) TestSnapshotManyEncryptionKey(c *check.C) {
+	var calledKey string
+	defer daemon.MockSnapshotSave(func(s *state.State, snaps, users []string, encryptionKey string) (uint64, []string, *state.TaskSet, error) {
+		calledKey = encryptionKey
+		t := s.NewTask("fake-snapshot-1", "Snapshot one")
+		return 1, snaps, state.NewTaskSet(t), nil
+	})()
+
+	inst := daemon.MustUnmarshalSnapInstruction(c, `{"action": "snapshot", "snaps": ["foo"], "encryption-key": "some-key"}`)
+	st := s.o.State()
+	st.Lock()
+	_, err := daemon.SnapshotMany(inst, st)
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+	c.Check(calledKey, check.Equals, "some-key")
+}
+
 func (s *snapshotSuite) TestListSnapshots(c *check.C) {
 	snapshots := []client.SnapshotSet{{ID: 1}, {ID: 42}}
 
@@ -198,6 +221,9 @@ func (s *snapshotSuite) TestChangeSnapshots400(c *check.C) {
 		}, {
 			body:  `{"set": 42, "action": "forget", "users": ["foo"]}`,
 			error: `snapshot "forget" operation cannot specify users`,
+		}, {
+			body:  `{"set": 42, "action": "forget", "decryption-key": "foo"}`,
+			error: `snapshot "forget" operation cannot specify a decryption key`,
 		},
 	}
 
@@ -216,11 +242,11 @@ func (s *snapshotSuite) TestChangeSnapshots400(c *check.C) {
 func (s *snapshotSuite) TestChangeSnapshots404(c *check.C) {
 	var done string
 	expectedError := errors.New("bzzt")
-	defer daemon.MockSnapshotCheck(func(*state.State, uint64, []string, []string) ([]string, *state.TaskSet, error) {
+	defer daemon.MockSnapshotCheck(func(*state.State, uint64, []string, []string, string) ([]string, *state.TaskSet, error) {
 		done = "check"
 		return nil, nil, expectedError
 	})()
-	defer daemon.MockSnapshotRestore(func(*state.State, uint64, []string, []string) ([]string, *state.TaskSet, error) {
+	defer daemon.MockSnapshotRestore(func(*state.State, uint64, []string, []string, string) ([]string, *state.TaskSet, error) {
 		done = "restore"
 		return nil, nil, expectedError
 	})()
@@ -248,11 +274,11 @@ func (s *snapshotSuite) TestChangeSnapshots404(c *check.C) {
 func (s *snapshotSuite) TestChangeSnapshots500(c *check.C) {
 	var done string
 	expectedError := errors.New("bzzt")
-	defer daemon.MockSnapshotCheck(func(*state.State, uint64, []string, []string) ([]string, *state.TaskSet, error) {
+	defer daemon.MockSnapshotCheck(func(*state.State, uint64, []string, []string, string) ([]string, *state.TaskSet, error) {
 		done = "check"
 		return nil, nil, expectedError
 	})()
-	defer daemon.MockSnapshotRestore(func(*state.State, uint64, []string, []string) ([]string, *state.TaskSet, error) {
+	defer daemon.MockSnapshotRestore(func(*state.State, uint64, []string, []string, string) ([]string, *state.TaskSet, error) {
 		done = "restore"
 		return nil, nil, expectedError
 	})()
@@ -276,11 +302,11 @@ func (s *snapshotSuite) TestChangeSnapshots500(c *check.C) {
 
 func (s *snapshotSuite) TestChangeSnapshot(c *check.C) {
 	var done string
-	defer daemon.MockSnapshotCheck(func(*state.State, uint64, []string, []string) ([]string, *state.TaskSet, error) {
+	defer daemon.MockSnapshotCheck(func(*state.State, uint64, []string, []string, string) ([]string, *state.TaskSet, error) {
 		done = "check"
 		return []string{"foo"}, state.NewTaskSet(), nil
 	})()
-	defer daemon.MockSnapshotRestore(func(*state.State, uint64, []string, []string) ([]string, *state.TaskSet, error) {
+	defer daemon.MockSnapshotRestore(func(*state.State, uint64, []string, []string, string) ([]string, *state.TaskSet, error) {
 		done = "restore"
 		return []string{"foo"}, state.NewTaskSet(), nil
 	})()
@@ -321,3 +347,127 @@ func (s *snapshotSuite) TestChangeSnapshot(c *check.C) {
 
 	}
 }
+
+func (s *snapshotSuite) TestChangeSnapshotDecryptionKey(c *check.C) {
+	var calledKey string
+	defer daemon.MockSnapshotCheck(func(_ *state.State, _ uint64, _, _ []string, decryptionKey string) ([]string, *state.TaskSet, error) {
+		calledKey = "check: " + decryptionKey
+		return []string{"foo"}, state.NewTaskSet(), nil
+	})()
+	defer daemon.MockSnapshotRestore(func(_ *state.State, _ uint64, _, _ []string, decryptionKey string) ([]string, *state.TaskSet, error) {
+		calledKey = "restore: " + decryptionKey
+		return []string{"foo"}, state.NewTaskSet(), nil
+	})()
+
+	for _, action := range []string{"check", "restore"} {
+		comm := check.Commentf("%s", action)
+		body := fmt.Sprintf(`{"set": 42, "action": "%s", "decryption-key": "some-key"}`, action)
+		req, err := http.NewRequest("POST", "/v2/snapshots", strings.NewReader(body))
+		c.Assert(err, check.IsNil, comm)
+
+		rsp := daemon.ChangeSnapshots(daemon.SnapshotCmd, req, nil)
+		c.Check(rsp.Status, check.Equals, 202, comm)
+		c.Check(calledKey, check.Equals, action+": some-key", comm)
+
+		// the key does not end up in the change summary
+		st := s.o.State()
+		st.Lock()
+		chg := st.Change(rsp.Change)
+		c.Check(chg.Summary(), check.Not(check.Matches), ".*some-key.*", comm)
+		st.Unlock()
+	}
+}
+
+func (s *snapshotSuite) TestExportSnapshot(c *check.C) {
+	var calledID uint64
+	defer daemon.MockSnapshotExport(func(ctx context.Context, st *state.State, setID uint64) (*backend.SnapshotExport, error) {
+		calledID = setID
+		return &backend.SnapshotExport{SetID: setID}, nil
+	})()
+	defer daemon.MockMuxVars(func(*http.Request) map[string]string {
+		return map[string]string{"id": "42"}
+	})()
+
+	req, err := http.NewRequest("GET", "/v2/snapshots/42/export", nil)
+	c.Assert(err, check.IsNil)
+	rsp := daemon.GetSnapshotExport(daemon.SnapshotExportCmd, req, nil)
+	c.Check(calledID, check.Equals, uint64(42))
+
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+	c.Check(rec.Code, check.Equals, 200)
+	c.Check(rec.HeaderMap.Get("Content-Type"), check.Equals, client.SnapshotExportMediaType)
+	c.Check(rec.HeaderMap.Get("Content-Disposition"), check.Equals, "attachment; filename=42_export.snapshot")
+
+	tr := tar.NewReader(rec.Body)
+	hdr, err := tr.Next()
+	c.Assert(err, check.IsNil)
+	c.Check(hdr.Name, check.Equals, "export.json")
+	var meta map[string]interface{}
+	c.Assert(json.NewDecoder(tr).Decode(&meta), check.IsNil)
+	c.Check(meta["format-version"], check.Equals, 1.0)
+	_, err = tr.Next()
+	c.Check(err, check.Equals, io.EOF)
+}
+
+func (s *snapshotSuite) TestExportSnapshotErrors(c *check.C) {
+	expectedError := client.ErrSnapshotSetNotFound
+	defer daemon.MockSnapshotExport(func(ctx context.Context, st *state.State, setID uint64) (*backend.SnapshotExport, error) {
+		return nil, expectedError
+	})()
+	id := "42"
+	defer daemon.MockMuxVars(func(*http.Request) map[string]string {
+		return map[string]string{"id": id}
+	})()
+
+	req, err := http.NewRequest("GET", "/v2/snapshots/42/export", nil)
+	c.Assert(err, check.IsNil)
+	rsp := daemon.GetSnapshotExport(daemon.SnapshotExportCmd, req, nil).(*daemon.Resp)
+	c.Check(rsp.Status, check.Equals, 404)
+	c.Check(rsp.ErrorResult().Message, check.Equals, "no snapshot set with the given ID")
+
+	expectedError = errors.New("boom")
+	rsp = daemon.GetSnapshotExport(daemon.SnapshotExportCmd, req, nil).(*daemon.Resp)
+	c.Check(rsp.Status, check.Equals, 500)
+	c.Check(rsp.ErrorResult().Message, check.Equals, "cannot export snapshot set #42: boom")
+
+	id = "foo"
+	rsp = daemon.GetSnapshotExport(daemon.SnapshotExportCmd, req, nil).(*daemon.Resp)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.ErrorResult().Message, check.Equals, `'id' must be a positive base 10 number; got "foo"`)
+}
+
+func (s *snapshotSuite) TestImportSnapshot(c *check.C) {
+	var data string
+	defer daemon.MockSnapshotImport(func(ctx context.Context, st *state.State, r io.Reader) (uint64, []string, error) {
+		buf, err := ioutil.ReadAll(r)
+		c.Assert(err, check.IsNil)
+		data = string(buf)
+		return 42, []string{"bar", "foo"}, nil
+	})()
+
+	req, err := http.NewRequest("POST", "/v2/snapshots", strings.NewReader("snapshot export data"))
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", client.SnapshotExportMediaType)
+
+	rsp := daemon.ChangeSnapshots(daemon.SnapshotCmd, req, nil)
+	c.Check(rsp.Type, check.Equals, daemon.ResponseTypeSync)
+	c.Check(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Result, check.DeepEquals, &client.SnapshotImportSet{ID: 42, Snaps: []string{"bar", "foo"}})
+	c.Check(data, check.Equals, "snapshot export data")
+}
+
+func (s *snapshotSuite) TestImportSnapshotError(c *check.C) {
+	defer daemon.MockSnapshotImport(func(ctx context.Context, st *state.State, r io.Reader) (uint64, []string, error) {
+		return 0, nil, errors.New("cannot import snapshot: empty import")
+	})()
+
+	req, err := http.NewRequest("POST", "/v2/snapshots", strings.NewReader(""))
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", client.SnapshotExportMediaType)
+
+	rsp := daemon.ChangeSnapshots(daemon.SnapshotCmd, req, nil)
+	c.Check(rsp.Type, check.Equals, daemon.ResponseTypeError)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.ErrorResult().Message, check.Equals, "cannot import snapshot: empty import")
+}
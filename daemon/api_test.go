@@ -306,6 +306,8 @@ func (s *apiBaseSuite) SetUpTest(c *check.C) {
 	snapstateUpdate = nil
 	snapstateUpdateMany = nil
 	snapstateSwitch = nil
+	snapstateHoldRefresh = nil
+	snapstateUnholdRefresh = nil
 
 	devicestateRemodel = nil
 }
@@ -331,6 +333,8 @@ func (s *apiBaseSuite) TearDownTest(c *check.C) {
 	snapstateUpdate = snapstate.Update
 	snapstateUpdateMany = snapstate.UpdateMany
 	snapstateSwitch = snapstate.Switch
+	snapstateHoldRefresh = snapstate.HoldRefresh
+	snapstateUnholdRefresh = snapstate.UnholdRefresh
 }
 
 var modelDefaults = map[string]interface{}{
@@ -980,6 +984,34 @@ func (s *apiSuite) TestMapLocalOfTryResolvesSymlink(c *check.C) {
 	c.Check(mapLocal(about).MountedFrom, check.Equals, "")
 }
 
+func (s *apiSuite) TestMapLocalRefreshHold(c *check.C) {
+	info := snap.Info{SideInfo: snap.SideInfo{RealName: "hello", Revision: snap.R(1)}}
+	snapst := snapstate.SnapState{}
+	about := aboutSnap{info: &info, snapst: &snapst}
+
+	// not held
+	c.Check(mapLocal(about).RefreshHold, check.IsNil)
+
+	// an expired hold is not reported
+	past := time.Now().Add(-time.Hour)
+	snapst.RefreshHold = &past
+	c.Check(mapLocal(about).RefreshHold, check.IsNil)
+
+	// a hold by the snap itself is reported too
+	until := time.Now().Add(24 * time.Hour).UTC()
+	snapst.RefreshSelfHold = &snapstate.RefreshSelfHold{Since: past, Until: until}
+	held := mapLocal(about).RefreshHold
+	c.Assert(held, check.NotNil)
+	c.Check(held.Equal(until), check.Equals, true)
+
+	// the latest of the two holds wins
+	later := until.Add(time.Hour)
+	snapst.RefreshHold = &later
+	held = mapLocal(about).RefreshHold
+	c.Assert(held, check.NotNil)
+	c.Check(held.Equal(later), check.Equals, true)
+}
+
 func (s *apiSuite) TestListIncludesAll(c *check.C) {
 	// Very basic check to help stop us from not adding all the
 	// commands to the command list.
@@ -2647,6 +2679,87 @@ func (s *apiSuite) TestPostSnapDispatch(c *check.C) {
 	}
 }
 
+func (s *apiSuite) TestPostSnapHoldRefresh(c *check.C) {
+	d := s.daemonWithOverlordMock(c)
+
+	holdUntil := time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC)
+	var calledName string
+	var calledHoldUntil time.Time
+	snapstateHoldRefresh = func(st *state.State, name string, t time.Time) (time.Time, error) {
+		calledName = name
+		calledHoldUntil = t
+		return t, nil
+	}
+
+	s.vars = map[string]string{"name": "foo"}
+	buf := bytes.NewBufferString(`{"action": "hold", "hold-until": "2026-10-20T10:00:00Z"}`)
+	req, err := http.NewRequest("POST", "/v2/snaps/foo", buf)
+	c.Assert(err, check.IsNil)
+
+	rsp := postSnap(snapCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+	c.Check(rsp.Result, check.DeepEquals, map[string]interface{}{"hold-until": holdUntil})
+	c.Check(calledName, check.Equals, "foo")
+	c.Check(calledHoldUntil.Equal(holdUntil), check.Equals, true)
+
+	// no change was created
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	c.Check(st.Changes(), check.HasLen, 0)
+}
+
+func (s *apiSuite) TestPostSnapHoldRefreshError(c *check.C) {
+	s.daemonWithOverlordMock(c)
+
+	snapstateHoldRefresh = func(st *state.State, name string, t time.Time) (time.Time, error) {
+		return time.Time{}, &snap.NotInstalledError{Snap: name}
+	}
+
+	s.vars = map[string]string{"name": "foo"}
+	buf := bytes.NewBufferString(`{"action": "hold"}`)
+	req, err := http.NewRequest("POST", "/v2/snaps/foo", buf)
+	c.Assert(err, check.IsNil)
+
+	rsp := postSnap(snapCmd, req, nil).(*resp)
+	c.Check(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Kind, check.Equals, errorKindSnapNotInstalled)
+}
+
+func (s *apiSuite) TestPostSnapUnholdRefresh(c *check.C) {
+	s.daemonWithOverlordMock(c)
+
+	var calledName string
+	snapstateUnholdRefresh = func(st *state.State, name string) error {
+		calledName = name
+		return nil
+	}
+
+	s.vars = map[string]string{"name": "foo"}
+	buf := bytes.NewBufferString(`{"action": "unhold"}`)
+	req, err := http.NewRequest("POST", "/v2/snaps/foo", buf)
+	c.Assert(err, check.IsNil)
+
+	rsp := postSnap(snapCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeSync)
+	c.Check(calledName, check.Equals, "foo")
+}
+
+func (s *apiSuite) TestPostSnapHoldUntilOnlyForHold(c *check.C) {
+	s.daemonWithOverlordMock(c)
+
+	s.vars = map[string]string{"name": "foo"}
+	buf := bytes.NewBufferString(`{"action": "refresh", "hold-until": "2026-10-20T10:00:00Z"}`)
+	req, err := http.NewRequest("POST", "/v2/snaps/foo", buf)
+	c.Assert(err, check.IsNil)
+
+	rsp := postSnap(snapCmd, req, nil).(*resp)
+	c.Check(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, "hold-until can only be specified for hold")
+}
+
 func (s *apiSuite) TestPostSnapEnableDisableSwitchRevision(c *check.C) {
 	for _, action := range []string{"enable", "disable", "switch"} {
 		buf := bytes.NewBufferString(`{"action": "` + action + `", "revision": "42"}`)
@@ -3018,6 +3131,99 @@ func (s *apiSuite) TestSideloadSnapChangeConflict(c *check.C) {
 	c.Check(rsp.Result.(*errorResult).Kind, check.Equals, errorKindSnapChangeConflict)
 }
 
+const sideLoadManyBody = "" +
+	"----hello--\r\n" +
+	"Content-Disposition: form-data; name=\"snap\"; filename=\"core18.snap\"\r\n" +
+	"\r\n" +
+	"core18\r\n" +
+	"----hello--\r\n" +
+	"Content-Disposition: form-data; name=\"snap\"; filename=\"app.snap\"\r\n" +
+	"\r\n" +
+	"app\r\n" +
+	"----hello--\r\n"
+
+func (s *apiSuite) TestSideloadManySnaps(c *check.C) {
+	body := sideLoadManyBody +
+		"Content-Disposition: form-data; name=\"dangerous\"\r\n" +
+		"\r\n" +
+		"true\r\n" +
+		"----hello--\r\n"
+	d := s.daemonWithFakeSnapManager(c)
+
+	unsafeReadSnapInfo = func(path string) (*snap.Info, error) {
+		content, err := ioutil.ReadFile(path)
+		c.Assert(err, check.IsNil)
+		return &snap.Info{SuggestedName: string(content)}, nil
+	}
+
+	var installed []string
+	snapstateInstallPath = func(s *state.State, si *snap.SideInfo, path, name, channel string, flags snapstate.Flags) (*state.TaskSet, *snap.Info, error) {
+		c.Check(flags, check.DeepEquals, snapstate.Flags{RemoveSnapPath: true})
+		c.Check(path, testutil.FileEquals, si.RealName)
+		c.Check(name, check.Equals, si.RealName)
+		installed = append(installed, name)
+		t := s.NewTask("fake-install-snap", "Doing a fake install of "+name)
+		return state.NewTaskSet(t), &snap.Info{SuggestedName: name}, nil
+	}
+
+	req, err := http.NewRequest("POST", "/v2/snaps", bytes.NewBufferString(body))
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "multipart/thing; boundary=--hello--")
+
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync)
+	c.Check(installed, check.DeepEquals, []string{"core18", "app"})
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Kind(), check.Equals, "install-snap")
+	c.Check(chg.Summary(), check.Equals, `Install snaps "core18", "app" from files`)
+	var names []string
+	c.Assert(chg.Get("snap-names", &names), check.IsNil)
+	c.Check(names, check.DeepEquals, []string{"core18", "app"})
+
+	tasks := chg.Tasks()
+	c.Assert(tasks, check.HasLen, 2)
+	// the app waits for its base
+	c.Check(tasks[1].WaitTasks(), check.DeepEquals, []*state.Task{tasks[0]})
+}
+
+func (s *apiSuite) TestSideloadManySnapsNoSignaturesDangerOff(c *check.C) {
+	s.daemonWithOverlordMock(c)
+
+	req, err := http.NewRequest("POST", "/v2/snaps", bytes.NewBufferString(sideLoadManyBody))
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "multipart/thing; boundary=--hello--")
+
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `cannot find signatures with metadata for snap "core18.snap"`)
+	// the temporary files got removed
+	tempFiles, err := filepath.Glob(filepath.Join(dirs.SnapBlobDir, dirs.LocalInstallBlobTempPrefix+"*"))
+	c.Assert(err, check.IsNil)
+	c.Check(tempFiles, check.HasLen, 0)
+}
+
+func (s *apiSuite) TestSideloadManySnapsInstanceName(c *check.C) {
+	body := sideLoadManyBody +
+		"Content-Disposition: form-data; name=\"name\"\r\n" +
+		"\r\n" +
+		"app_foo\r\n" +
+		"----hello--\r\n"
+	s.daemonWithOverlordMock(c)
+
+	req, err := http.NewRequest("POST", "/v2/snaps", bytes.NewBufferString(body))
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "multipart/thing; boundary=--hello--")
+
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, `cannot specify an instance name when installing multiple snap files`)
+}
+
 func (s *apiSuite) TestSideloadSnapInstanceName(c *check.C) {
 	// try a multipart/form-data upload
 	body := sideLoadBodyWithoutDevMode +
@@ -4103,6 +4309,127 @@ func (s *apiSuite) TestRefreshMany1(c *check.C) {
 	c.Check(refreshSnapDecls, check.Equals, true)
 }
 
+func (s *apiSuite) TestPostSnapScheduledRefresh(c *check.C) {
+	snapstateUpdate = func(s *state.State, name string, opts *snapstate.RevisionOptions, userID int, flags snapstate.Flags) (*state.TaskSet, error) {
+		t := s.NewTask("fake-refresh-snap", "Doing a fake refresh")
+		return state.NewTaskSet(t), nil
+	}
+	assertstateRefreshSnapDeclarations = func(*state.State, int) error { return nil }
+
+	d := s.daemonWithFakeSnapManager(c)
+
+	at := time.Now().Add(time.Hour).Round(time.Second)
+	buf := bytes.NewBufferString(fmt.Sprintf(`{"action": "refresh", "at": %q}`, at.Format(time.RFC3339)))
+	req, err := http.NewRequest("POST", "/v2/snaps/some-snap", buf)
+	c.Assert(err, check.IsNil)
+
+	s.vars = map[string]string{"name": "some-snap"}
+	rsp := postSnap(snapCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync)
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Status(), check.Equals, state.ScheduledStatus)
+	c.Check(chg.Tasks()[0].AtTime().Equal(at), check.Equals, true)
+
+	chgInfo := change2changeInfo(chg)
+	c.Check(chgInfo.Status, check.Equals, "Scheduled")
+	c.Check(chgInfo.Ready, check.Equals, false)
+	c.Assert(chgInfo.ScheduledTime, check.NotNil)
+	c.Check(chgInfo.ScheduledTime.Equal(at), check.Equals, true)
+}
+
+func (s *apiSuite) TestPostSnapScheduledRefreshWindow(c *check.C) {
+	snapstateUpdate = func(s *state.State, name string, opts *snapstate.RevisionOptions, userID int, flags snapstate.Flags) (*state.TaskSet, error) {
+		t := s.NewTask("fake-refresh-snap", "Doing a fake refresh")
+		return state.NewTaskSet(t), nil
+	}
+	assertstateRefreshSnapDeclarations = func(*state.State, int) error { return nil }
+
+	d := s.daemonWithFakeSnapManager(c)
+
+	// a window that is not open now
+	now := time.Now()
+	start := now.Add(2 * time.Hour)
+	window := fmt.Sprintf("%02d:%02d-%02d:%02d", start.Hour(), start.Minute(), start.Add(time.Hour).Hour(), start.Minute())
+	buf := bytes.NewBufferString(fmt.Sprintf(`{"action": "refresh", "window": %q}`, window))
+	req, err := http.NewRequest("POST", "/v2/snaps/some-snap", buf)
+	c.Assert(err, check.IsNil)
+
+	s.vars = map[string]string{"name": "some-snap"}
+	rsp := postSnap(snapCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync)
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Status(), check.Equals, state.ScheduledStatus)
+	scheduled := chg.ScheduledTime()
+	c.Check(scheduled.After(now.Add(time.Hour)), check.Equals, true)
+	c.Check(scheduled.Before(now.Add(3*time.Hour)), check.Equals, true)
+}
+
+func (s *apiSuite) TestPostSnapScheduleErrors(c *check.C) {
+	s.daemonWithOverlordMock(c)
+
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+	for _, t := range []struct {
+		body   string
+		errmsg string
+	}{
+		{`{"action": "install", "at": "` + future + `"}`, "at and window can only be specified for refresh or remove"},
+		{`{"action": "refresh", "at": "` + future + `", "dry-run": true}`, "cannot schedule a dry-run"},
+		{`{"action": "refresh", "at": "` + future + `", "window": "10:00-12:00"}`, "cannot specify both at and window"},
+		{`{"action": "remove", "at": "` + past + `"}`, "cannot schedule a change in the past"},
+		{`{"action": "remove", "window": "potato"}`, `cannot parse window: .*`},
+	} {
+		req, err := http.NewRequest("POST", "/v2/snaps/some-snap", strings.NewReader(t.body))
+		c.Assert(err, check.IsNil)
+
+		s.vars = map[string]string{"name": "some-snap"}
+		rsp := postSnap(snapCmd, req, nil).(*resp)
+		c.Check(rsp.Type, check.Equals, ResponseTypeError, check.Commentf(t.body))
+		c.Check(rsp.Status, check.Equals, 400, check.Commentf(t.body))
+		c.Check(rsp.Result.(*errorResult).Message, check.Matches, t.errmsg, check.Commentf(t.body))
+	}
+}
+
+func (s *apiSuite) TestPostSnapsScheduledRemove(c *check.C) {
+	snapstateRemoveMany = func(s *state.State, names []string) ([]string, []*state.TaskSet, error) {
+		t := s.NewTask("fake-remove-2", "Remove two")
+		return names, []*state.TaskSet{state.NewTaskSet(t)}, nil
+	}
+
+	d := s.daemonWithFakeSnapManager(c)
+
+	at := time.Now().Add(time.Hour).Round(time.Second)
+	buf := strings.NewReader(fmt.Sprintf(`{"action": "remove", "snaps": ["foo", "bar"], "at": %q}`, at.Format(time.RFC3339)))
+	req, err := http.NewRequest("POST", "/v2/snaps", buf)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp := postSnaps(snapsCmd, req, nil).(*resp)
+	c.Assert(rsp.Type, check.Equals, ResponseTypeAsync)
+
+	st := d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Status(), check.Equals, state.ScheduledStatus)
+	c.Check(chg.ScheduledTime().Equal(at), check.Equals, true)
+
+	// and it can be cancelled
+	chg.Abort()
+	c.Check(chg.Status(), check.Equals, state.HoldStatus)
+}
+
 func (s *apiSuite) TestInstallMany(c *check.C) {
 	snapstateInstallMany = func(s *state.State, names []string, userID int) ([]string, []*state.TaskSet, error) {
 		c.Check(names, check.HasLen, 2)
@@ -6507,6 +6834,35 @@ func (s *apiSuite) TestSnapctlForbiddenError(c *check.C) {
 	c.Assert(rsp.Status, check.Equals, 403)
 }
 
+func (s *apiSuite) TestSnapctlUnsuccesfulError(c *check.C) {
+	_ = s.daemon(c)
+
+	runSnapctlUcrednetGet = func(string) (int32, uint32, string, error) {
+		return 100, 9999, dirs.SnapSocket, nil
+	}
+	defer func() { runSnapctlUcrednetGet = ucrednetGet }()
+	ctlcmdRun = func(ctx *hookstate.Context, arg []string, uid uint32) ([]byte, []byte, error) {
+		return []byte("some stdout"), []byte("some stderr"), &ctlcmd.UnsuccessfulError{ExitCode: 123}
+	}
+	defer func() { ctlcmdRun = ctlcmd.Run }()
+
+	buf := bytes.NewBufferString(fmt.Sprintf(`{"context-id": "some-context", "args": [%q, %q]}`, "is-connected", "plug"))
+	req, err := http.NewRequest("POST", "/v2/snapctl", buf)
+	c.Assert(err, check.IsNil)
+	rsp := runSnapctl(snapctlCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Type, check.Equals, ResponseTypeError)
+	c.Check(rsp.Result, check.DeepEquals, &errorResult{
+		Message: "unsuccessful with exit code: 123",
+		Kind:    errorKindUnsuccessful,
+		Value: map[string]interface{}{
+			"stdout":    "some stdout",
+			"stderr":    "some stderr",
+			"exit-code": 123,
+		},
+	})
+}
+
 type appSuite struct {
 	apiBaseSuite
 	cmd *testutil.MockCmd
@@ -7035,6 +7391,37 @@ func (s *appSuite) TestPosetAppsDisableNow(c *check.C) {
 	s.testPostApps(c, inst, expected)
 }
 
+func (s *appSuite) TestPostAppsScheduledRestart(c *check.C) {
+	at := time.Now().Add(time.Hour).Round(time.Second)
+	inst := servicestate.Instruction{Action: "restart", Names: []string{"snap-a.svc2"}}
+	inst.At = &at
+	postBody, err := json.Marshal(inst)
+	c.Assert(err, check.IsNil)
+
+	req, err := http.NewRequest("POST", "/v2/apps", bytes.NewBuffer(postBody))
+	c.Assert(err, check.IsNil)
+
+	rsp := postApps(appsCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, check.Equals, 202)
+
+	st := s.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Status(), check.Equals, state.ScheduledStatus)
+	c.Check(chg.ScheduledTime().Equal(at), check.Equals, true)
+	c.Check(s.cmd.Calls(), check.HasLen, 0)
+}
+
+func (s *appSuite) TestPostAppsScheduleOnlyRestart(c *check.C) {
+	req, err := http.NewRequest("POST", "/v2/apps", bytes.NewBufferString(`{"action": "start", "names": ["snap-a.svc2"], "window": "10:00-12:00"}`))
+	c.Assert(err, check.IsNil)
+	rsp := postApps(appsCmd, req, nil).(*resp)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, "at and window can only be specified for restart")
+}
+
 func (s *appSuite) TestPostAppsBadJSON(c *check.C) {
 	req, err := http.NewRequest("POST", "/v2/apps", bytes.NewBufferString(`'junk`))
 	c.Assert(err, check.IsNil)
@@ -0,0 +1,228 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/snapasserts"
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+var (
+	validationSetsListCmd = &Command{
+		Path:   "/v2/validation-sets",
+		GET:    listValidationSets,
+		UserOK: true,
+	}
+
+	validationSetsCmd = &Command{
+		Path:   "/v2/validation-sets/{account}/{name}",
+		GET:    getValidationSet,
+		POST:   applyValidationSet,
+		UserOK: true,
+	}
+)
+
+var (
+	assertstateApplyValidationSet  = assertstate.ApplyValidationSet
+	assertstateForgetValidationSet = assertstate.ForgetValidationSet
+)
+
+func modeString(mode assertstate.ValidationSetMode) string {
+	switch mode {
+	case assertstate.Monitor, assertstate.Enforce:
+		return mode.String()
+	}
+	return "unknown"
+}
+
+// validationSetResult computes the client representation of the
+// given tracked validation set, checking the installed snaps against
+// it.
+func validationSetResult(st *state.State, tr *assertstate.ValidationSetTracking) (*client.ValidationSetResult, error) {
+	vs, err := assertstate.ValidationSetAssertion(st, tr.AccountID, tr.Name, tr.Current)
+	if err != nil {
+		return nil, err
+	}
+	sets := snapasserts.NewValidationSets()
+	if err := sets.Add(vs); err != nil {
+		return nil, err
+	}
+	snaps, err := assertstate.InstalledSnaps(st)
+	if err != nil {
+		return nil, err
+	}
+	valid := true
+	if err := sets.CheckInstalledSnaps(snaps); err != nil {
+		if _, ok := err.(*snapasserts.ValidationSetsValidationError); !ok {
+			return nil, err
+		}
+		valid = false
+	}
+	return &client.ValidationSetResult{
+		AccountID: tr.AccountID,
+		Name:      tr.Name,
+		PinnedAt:  tr.PinnedAt,
+		Mode:      modeString(tr.Mode),
+		Sequence:  tr.Current,
+		Valid:     valid,
+	}, nil
+}
+
+func listValidationSets(c *Command, r *http.Request, _ *auth.UserState) Response {
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	validationSets, err := assertstate.ValidationSets(st)
+	if err != nil {
+		return InternalError("cannot get validation sets: %v", err)
+	}
+
+	keys := make([]string, 0, len(validationSets))
+	for k := range validationSets {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	results := make([]*client.ValidationSetResult, 0, len(keys))
+	for _, k := range keys {
+		res, err := validationSetResult(st, validationSets[k])
+		if err != nil {
+			return InternalError("cannot check validation set %s: %v", k, err)
+		}
+		results = append(results, res)
+	}
+
+	return SyncResponse(results, nil)
+}
+
+func validationSetAccountAndName(r *http.Request) (accountID, name string, rsp Response) {
+	vars := muxVars(r)
+	accountID = vars["account"]
+	name = vars["name"]
+
+	if !asserts.IsValidAccountID(accountID) {
+		return "", "", BadRequest("invalid account ID %q", accountID)
+	}
+	if !asserts.IsValidValidationSetName(name) {
+		return "", "", BadRequest("invalid name %q", name)
+	}
+	return accountID, name, nil
+}
+
+func getValidationSet(c *Command, r *http.Request, _ *auth.UserState) Response {
+	accountID, name, rsp := validationSetAccountAndName(r)
+	if rsp != nil {
+		return rsp
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var tr assertstate.ValidationSetTracking
+	err := assertstate.GetValidationSet(st, accountID, name, &tr)
+	if err == state.ErrNoState {
+		return NotFound("validation set not found")
+	}
+	if err != nil {
+		return InternalError("cannot get validation set: %v", err)
+	}
+
+	res, err := validationSetResult(st, &tr)
+	if err != nil {
+		return InternalError("cannot check validation set: %v", err)
+	}
+	return SyncResponse(res, nil)
+}
+
+type validationSetApplyRequest struct {
+	Action   string `json:"action"`
+	Mode     string `json:"mode"`
+	Sequence int    `json:"sequence,omitempty"`
+}
+
+func applyValidationSet(c *Command, r *http.Request, user *auth.UserState) Response {
+	accountID, name, rsp := validationSetAccountAndName(r)
+	if rsp != nil {
+		return rsp
+	}
+
+	var req validationSetApplyRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&req); err != nil {
+		return BadRequest("cannot decode request body into validation set action: %v", err)
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	switch req.Action {
+	case "forget":
+		if req.Mode != "" || req.Sequence != 0 {
+			return BadRequest("cannot use mode or sequence with forget action")
+		}
+		if err := assertstateForgetValidationSet(st, accountID, name); err != nil {
+			return BadRequest("%v", err)
+		}
+		return SyncResponse(nil, nil)
+	case "apply":
+		// handled below
+	default:
+		return BadRequest("unsupported action %q", req.Action)
+	}
+
+	var mode assertstate.ValidationSetMode
+	switch req.Mode {
+	case "monitor":
+		mode = assertstate.Monitor
+	case "enforce":
+		mode = assertstate.Enforce
+	default:
+		return BadRequest("invalid mode %q", req.Mode)
+	}
+	if req.Sequence < 0 {
+		return BadRequest("invalid sequence argument: %d", req.Sequence)
+	}
+
+	userID := 0
+	if user != nil {
+		userID = user.ID
+	}
+	tr, err := assertstateApplyValidationSet(st, accountID, name, req.Sequence, mode, userID)
+	if err != nil {
+		return BadRequest("cannot apply validation set: %v", err)
+	}
+
+	res, err := validationSetResult(st, tr)
+	if err != nil {
+		return InternalError("cannot check validation set: %v", err)
+	}
+	return SyncResponse(res, nil)
+}
@@ -0,0 +1,295 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/daemon"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/testutil"
+)
+
+var _ = check.Suite(&apiValidationSetsSuite{})
+
+type apiValidationSetsSuite struct {
+	testutil.BaseTest
+
+	d  *daemon.Daemon
+	st *state.State
+
+	storeSigning *assertstest.StoreStack
+}
+
+func (s *apiValidationSetsSuite) SetUpTest(c *check.C) {
+	s.BaseTest.SetUpTest(c)
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+
+	o := overlord.Mock()
+	s.d = daemon.NewWithOverlord(o)
+	s.st = o.State()
+
+	s.storeSigning = assertstest.NewStoreStack("can0nical", nil)
+	db, err := asserts.OpenDatabase(&asserts.DatabaseConfig{
+		Backstore: asserts.NewMemoryBackstore(),
+		Trusted:   s.storeSigning.Trusted,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(db.Add(s.storeSigning.StoreAccountKey("")), check.IsNil)
+
+	s.st.Lock()
+	assertstate.ReplaceDB(s.st, db)
+	s.st.Unlock()
+}
+
+func (s *apiValidationSetsSuite) mockValidationSet(c *check.C, name string, sequence int) {
+	a, err := s.storeSigning.Sign(asserts.ValidationSetType, map[string]interface{}{
+		"authority-id": "can0nical",
+		"account-id":   "can0nical",
+		"series":       "16",
+		"name":         name,
+		"sequence":     fmt.Sprintf("%d", sequence),
+		"snaps": []interface{}{
+			map[string]interface{}{
+				"name":     "foo",
+				"id":       "fooidididididididididididididid1",
+				"revision": "3",
+			},
+		},
+		"timestamp": time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, check.IsNil)
+
+	s.st.Lock()
+	defer s.st.Unlock()
+	c.Assert(assertstate.Add(s.st, a), check.IsNil)
+}
+
+func (s *apiValidationSetsSuite) mockInstalledFoo(rev int) {
+	s.st.Lock()
+	defer s.st.Unlock()
+	snapstate.Set(s.st, "foo", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "foo", SnapID: "fooidididididididididididididid1", Revision: snap.R(rev)},
+		},
+		Current: snap.R(rev),
+	})
+}
+
+func (s *apiValidationSetsSuite) mockTracking(name string, mode assertstate.ValidationSetMode, pinnedAt, current int) {
+	s.st.Lock()
+	defer s.st.Unlock()
+	assertstate.UpdateValidationSet(s.st, &assertstate.ValidationSetTracking{
+		AccountID: "can0nical",
+		Name:      name,
+		Mode:      mode,
+		PinnedAt:  pinnedAt,
+		Current:   current,
+	})
+}
+
+func (s *apiValidationSetsSuite) muxVars(account, name string) {
+	s.AddCleanup(daemon.MockMuxVars(func(*http.Request) map[string]string {
+		return map[string]string{"account": account, "name": name}
+	}))
+}
+
+func (s *apiValidationSetsSuite) TestListValidationSetsNone(c *check.C) {
+	req, err := http.NewRequest("GET", "/v2/validation-sets", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.ValidationSetsListCmd.GET(daemon.ValidationSetsListCmd, req, nil).(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Result, check.DeepEquals, []*client.ValidationSetResult{})
+}
+
+func (s *apiValidationSetsSuite) TestListValidationSets(c *check.C) {
+	s.mockValidationSet(c, "foo", 1)
+	s.mockValidationSet(c, "bar", 2)
+	s.mockTracking("foo", assertstate.Enforce, 1, 1)
+	s.mockTracking("bar", assertstate.Monitor, 0, 2)
+	s.mockInstalledFoo(3)
+
+	req, err := http.NewRequest("GET", "/v2/validation-sets", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.ValidationSetsListCmd.GET(daemon.ValidationSetsListCmd, req, nil).(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Result, check.DeepEquals, []*client.ValidationSetResult{
+		{AccountID: "can0nical", Name: "bar", Mode: "monitor", Sequence: 2, Valid: true},
+		{AccountID: "can0nical", Name: "foo", Mode: "enforce", PinnedAt: 1, Sequence: 1, Valid: true},
+	})
+}
+
+func (s *apiValidationSetsSuite) TestGetValidationSetInvalid(c *check.C) {
+	s.mockValidationSet(c, "foo", 1)
+	s.mockTracking("foo", assertstate.Monitor, 0, 1)
+	// wrong revision installed
+	s.mockInstalledFoo(2)
+	s.muxVars("can0nical", "foo")
+
+	req, err := http.NewRequest("GET", "/v2/validation-sets/can0nical/foo", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.ValidationSetsCmd.GET(daemon.ValidationSetsCmd, req, nil).(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Result, check.DeepEquals, &client.ValidationSetResult{
+		AccountID: "can0nical",
+		Name:      "foo",
+		Mode:      "monitor",
+		Sequence:  1,
+		Valid:     false,
+	})
+}
+
+func (s *apiValidationSetsSuite) TestGetValidationSetNotFound(c *check.C) {
+	s.muxVars("can0nical", "foo")
+
+	req, err := http.NewRequest("GET", "/v2/validation-sets/can0nical/foo", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.ValidationSetsCmd.GET(daemon.ValidationSetsCmd, req, nil).(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 404)
+	c.Check(rsp.Result.(*daemon.ErrorResult).Message, check.Equals, "validation set not found")
+}
+
+func (s *apiValidationSetsSuite) TestGetValidationSetInvalidArgs(c *check.C) {
+	for _, tc := range []struct {
+		account, name, err string
+	}{
+		{"-", "foo", `invalid account ID "-"`},
+		{"can0nical", "Foo", `invalid name "Foo"`},
+	} {
+		s.muxVars(tc.account, tc.name)
+		req, err := http.NewRequest("GET", "/v2/validation-sets/x/y", nil)
+		c.Assert(err, check.IsNil)
+
+		rsp := daemon.ValidationSetsCmd.GET(daemon.ValidationSetsCmd, req, nil).(*daemon.Resp)
+		c.Assert(rsp.Status, check.Equals, 400)
+		c.Check(rsp.Result.(*daemon.ErrorResult).Message, check.Equals, tc.err)
+	}
+}
+
+func (s *apiValidationSetsSuite) TestApplyValidationSet(c *check.C) {
+	s.mockValidationSet(c, "foo", 3)
+	s.mockInstalledFoo(3)
+	s.muxVars("can0nical", "foo")
+
+	var called int
+	s.AddCleanup(daemon.MockAssertstateApplyValidationSet(func(st *state.State, accountID, name string, sequence int, mode assertstate.ValidationSetMode, userID int) (*assertstate.ValidationSetTracking, error) {
+		called++
+		c.Check(accountID, check.Equals, "can0nical")
+		c.Check(name, check.Equals, "foo")
+		c.Check(sequence, check.Equals, 3)
+		c.Check(mode, check.Equals, assertstate.Enforce)
+		return &assertstate.ValidationSetTracking{
+			AccountID: accountID,
+			Name:      name,
+			Mode:      mode,
+			PinnedAt:  sequence,
+			Current:   sequence,
+		}, nil
+	}))
+
+	body := strings.NewReader(`{"action": "apply", "mode": "enforce", "sequence": 3}`)
+	req, err := http.NewRequest("POST", "/v2/validation-sets/can0nical/foo", body)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.ValidationSetsCmd.POST(daemon.ValidationSetsCmd, req, nil).(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 200)
+	c.Check(called, check.Equals, 1)
+	c.Check(rsp.Result, check.DeepEquals, &client.ValidationSetResult{
+		AccountID: "can0nical",
+		Name:      "foo",
+		Mode:      "enforce",
+		PinnedAt:  3,
+		Sequence:  3,
+		Valid:     true,
+	})
+}
+
+func (s *apiValidationSetsSuite) TestApplyValidationSetError(c *check.C) {
+	s.muxVars("can0nical", "foo")
+
+	s.AddCleanup(daemon.MockAssertstateApplyValidationSet(func(st *state.State, accountID, name string, sequence int, mode assertstate.ValidationSetMode, userID int) (*assertstate.ValidationSetTracking, error) {
+		return nil, fmt.Errorf("boom")
+	}))
+
+	body := strings.NewReader(`{"action": "apply", "mode": "monitor"}`)
+	req, err := http.NewRequest("POST", "/v2/validation-sets/can0nical/foo", body)
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.ValidationSetsCmd.POST(daemon.ValidationSetsCmd, req, nil).(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*daemon.ErrorResult).Message, check.Equals, "cannot apply validation set: boom")
+}
+
+func (s *apiValidationSetsSuite) TestApplyValidationSetBadRequests(c *check.C) {
+	s.muxVars("can0nical", "foo")
+
+	for _, tc := range []struct {
+		body, err string
+	}{
+		{`{"action": "bogus"}`, `unsupported action "bogus"`},
+		{`{"action": "apply", "mode": "bogus"}`, `invalid mode "bogus"`},
+		{`{"action": "apply", "mode": "monitor", "sequence": -1}`, `invalid sequence argument: -1`},
+		{`{"action": "forget", "mode": "monitor"}`, `cannot use mode or sequence with forget action`},
+		{`{"action": "forget"}`, `validation set can0nical/foo is not tracked`},
+		{`}`, `cannot decode request body into validation set action: .*`},
+	} {
+		req, err := http.NewRequest("POST", "/v2/validation-sets/can0nical/foo", strings.NewReader(tc.body))
+		c.Assert(err, check.IsNil)
+
+		rsp := daemon.ValidationSetsCmd.POST(daemon.ValidationSetsCmd, req, nil).(*daemon.Resp)
+		c.Assert(rsp.Status, check.Equals, 400, check.Commentf("%s", tc.body))
+		c.Check(rsp.Result.(*daemon.ErrorResult).Message, check.Matches, tc.err)
+	}
+}
+
+func (s *apiValidationSetsSuite) TestForgetValidationSet(c *check.C) {
+	s.mockTracking("foo", assertstate.Monitor, 0, 1)
+	s.muxVars("can0nical", "foo")
+
+	req, err := http.NewRequest("POST", "/v2/validation-sets/can0nical/foo", strings.NewReader(`{"action": "forget"}`))
+	c.Assert(err, check.IsNil)
+
+	rsp := daemon.ValidationSetsCmd.POST(daemon.ValidationSetsCmd, req, nil).(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 200)
+
+	s.st.Lock()
+	defer s.st.Unlock()
+	var tr assertstate.ValidationSetTracking
+	c.Check(assertstate.GetValidationSet(s.st, "can0nical", "foo", &tr), check.Equals, state.ErrNoState)
+}
@@ -47,6 +47,7 @@ import (
 	"github.com/snapcore/snapd/overlord/standby"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/polkit"
+	"github.com/snapcore/snapd/snapdenv"
 	"github.com/snapcore/snapd/store"
 	"github.com/snapcore/snapd/systemd"
 )
@@ -321,6 +322,13 @@ func logit(handler http.Handler) http.Handler {
 // Init sets up the Daemon's internal workings.
 // Don't call more than once.
 func (d *Daemon) Init() error {
+	if snapdenv.Preseeding() {
+		// when preseeding snapd only seeds the system and exits,
+		// no API is served
+		logger.Noticef("started %v in preseed mode.", httputil.UserAgent())
+		return nil
+	}
+
 	listenerMap, err := netutil.ActivationListeners()
 	if err != nil {
 		return err
@@ -444,6 +452,16 @@ func (d *Daemon) Start() error {
 		return err
 	}
 
+	if snapdenv.Preseeding() {
+		// only run the overlord loop until seeding asks to stop
+		d.overlord.Loop()
+		d.tomb.Go(func() error {
+			<-d.tomb.Dying()
+			return nil
+		})
+		return nil
+	}
+
 	d.connTracker = &connTracker{conns: make(map[net.Conn]struct{})}
 	d.serve = &http.Server{
 		Handler:   logit(d.router),
@@ -499,6 +517,8 @@ func (d *Daemon) HandleRestart(t state.RestartType) {
 		d.mu.Lock()
 		defer d.mu.Unlock()
 		d.restartSocket = true
+	case state.StopDaemon:
+		logger.Noticef("stopping snapd as requested")
 	default:
 		logger.Noticef("internal error: restart handler called with unknown restart type: %v", t)
 	}
@@ -522,6 +542,12 @@ func (d *Daemon) Stop(sigCh chan<- os.Signal) error {
 		return fmt.Errorf("internal error: no Overlord")
 	}
 
+	if snapdenv.Preseeding() {
+		d.tomb.Kill(nil)
+		d.overlord.Stop()
+		return d.tomb.Wait()
+	}
+
 	d.tomb.Kill(nil)
 
 	d.mu.Lock()
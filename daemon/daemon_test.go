@@ -52,6 +52,7 @@ import (
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/polkit"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snapdenv"
 	"github.com/snapcore/snapd/store"
 	"github.com/snapcore/snapd/systemd"
 	"github.com/snapcore/snapd/testutil"
@@ -576,6 +577,37 @@ func (s *daemonSuite) TestStartStop(c *check.C) {
 	c.Check(s.notified, check.DeepEquals, []string{extendedTimeoutUSec, "READY=1", "STOPPING=1"})
 }
 
+func (s *daemonSuite) TestStartStopPreseeding(c *check.C) {
+	restore := snapdenv.MockPreseeding(true)
+	defer restore()
+
+	d := newTestDaemon(c)
+	// mark as already seeded
+	s.markSeeded(d)
+
+	c.Assert(d.Init(), check.IsNil)
+	c.Check(d.snapdListener, check.IsNil)
+	c.Check(d.snapListener, check.IsNil)
+
+	c.Assert(d.Start(), check.IsNil)
+	// no API is served so systemd is not notified of readiness
+	c.Check(s.notified, check.DeepEquals, []string{"EXTEND_TIMEOUT_USEC=30000000"})
+
+	st := d.overlord.State()
+	st.Lock()
+	st.RequestRestart(state.StopDaemon)
+	st.Unlock()
+
+	select {
+	case <-d.Dying():
+	case <-time.After(2 * time.Second):
+		c.Fatal("daemon did not stop after StopDaemon was requested")
+	}
+
+	c.Assert(d.Stop(nil), check.IsNil)
+	c.Check(s.notified, check.DeepEquals, []string{"EXTEND_TIMEOUT_USEC=30000000"})
+}
+
 func (s *daemonSuite) TestRestartWiring(c *check.C) {
 	d := newTestDaemon(c)
 	// mark as already seeded
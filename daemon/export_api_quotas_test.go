@@ -0,0 +1,55 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"github.com/snapcore/snapd/overlord/servicestate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap/quota"
+)
+
+var (
+	QuotaGroupsCmd    = quotaGroupsCmd
+	QuotaGroupInfoCmd = quotaGroupInfoCmd
+)
+
+func MockServicestateEnsureQuota(f func(st *state.State, update *quota.Group) (*state.TaskSet, error)) (restore func()) {
+	old := servicestateEnsureQuota
+	servicestateEnsureQuota = f
+	return func() {
+		servicestateEnsureQuota = old
+	}
+}
+
+func MockServicestateRemoveQuota(f func(st *state.State, name string) (*state.TaskSet, error)) (restore func()) {
+	old := servicestateRemoveQuota
+	servicestateRemoveQuota = f
+	return func() {
+		servicestateRemoveQuota = old
+	}
+}
+
+func MockServicestateCurrentQuotaUsage(f func(grp *quota.Group) (*servicestate.QuotaGroupUsage, error)) (restore func()) {
+	old := servicestateCurrentQuotaUsage
+	servicestateCurrentQuotaUsage = f
+	return func() {
+		servicestateCurrentQuotaUsage = old
+	}
+}
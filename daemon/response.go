@@ -35,6 +35,8 @@ import (
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/metrics"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/store"
@@ -190,6 +192,8 @@ const (
 	errorKindSystemRestart = errorKind("system-restart")
 
 	errorKindAssertionNotFound = errorKind("assertion-not-found")
+
+	errorKindUnsuccessful = errorKind("unsuccessful")
 )
 
 type errorValue interface{}
@@ -288,6 +292,35 @@ func (f fileResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, string(f))
 }
 
+// A snapshotExportResponse's ServeHTTP method streams a snapshot set,
+// closing it when done.
+type snapshotExportResponse struct {
+	*backend.SnapshotExport
+}
+
+// ServeHTTP from the Response interface
+func (s *snapshotExportResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", client.SnapshotExportMediaType)
+	w.Header().Add("Content-Disposition", fmt.Sprintf("attachment; filename=%d_export.snapshot", s.SetID))
+	if err := s.StreamTo(w); err != nil {
+		// the headers are out already, the client will see a truncated stream
+		logger.Noticef("cannot export snapshot set #%d: %v", s.SetID, err)
+	}
+	s.Close()
+}
+
+// A metricsResponse's ServeHTTP method writes out the metrics of
+// snapd in the Prometheus text exposition format.
+type metricsResponse struct{}
+
+// ServeHTTP from the Response interface
+func (metricsResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	if err := metrics.WriteText(w); err != nil {
+		logger.Noticef("cannot write metrics: %v", err)
+	}
+}
+
 // A journalLineReaderSeqResponse's ServeHTTP method reads lines (presumed to
 // be, each one on its own, a JSON dump of a systemd.Log, as output by
 // journalctl -o json) from an io.ReadCloser, loads that into a client.Log, and
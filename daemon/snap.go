@@ -26,6 +26,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/cmd"
@@ -318,6 +319,10 @@ func mapLocal(about aboutSnap) *client.Snap {
 		result.MountedFrom, _ = os.Readlink(result.MountedFrom)
 	}
 	result.Health = about.health
+	if snapst.RefreshHeld(time.Now()) {
+		until := snapst.RefreshHeldUntil()
+		result.RefreshHold = &until
+	}
 
 	return result
 }
@@ -75,7 +75,9 @@ var (
 	SnapRepairAssertsDir string
 	SnapRunRepairDir     string
 
-	SnapRollbackDir string
+	SnapRollbackDir   string
+	SnapBootAssetsDir string
+	SnapFDEDir        string
 
 	SnapCacheDir        string
 	SnapNamesFile       string
@@ -285,6 +287,10 @@ func SetRootDir(rootdir string) {
 	SnapRunRepairDir = filepath.Join(SnapRunDir, "repair")
 
 	SnapRollbackDir = filepath.Join(rootdir, snappyDir, "rollback")
+	SnapBootAssetsDir = filepath.Join(rootdir, snappyDir, "boot-assets")
+	// the sealed key of the encrypted data partition lives on the
+	// boot partition, it is needed before the data can be unlocked
+	SnapFDEDir = filepath.Join(rootdir, "/boot/grub/fde")
 
 	SnapBinariesDir = filepath.Join(SnapMountDir, "bin")
 	SnapServicesDir = filepath.Join(rootdir, "/etc/systemd/system")
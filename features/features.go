@@ -43,6 +43,8 @@ const (
 	PerUserMountNamespace
 	// RefreshAppAwareness controls refresh being aware of running applications.
 	RefreshAppAwareness
+	// GateAutoRefreshHook controls running the gate-auto-refresh hook of affected snaps before auto-refresh.
+	GateAutoRefreshHook
 	// lastFeature is the final known feature, it is only used for testing.
 	lastFeature
 )
@@ -65,6 +67,7 @@ var featureNames = map[SnapdFeature]string{
 	SnapdSnap:             "snapd-snap",
 	PerUserMountNamespace: "per-user-mount-namespace",
 	RefreshAppAwareness:   "refresh-app-awareness",
+	GateAutoRefreshHook:   "gate-auto-refresh-hook",
 }
 
 // featuresEnabledWhenUnset contains a set of features that are enabled when not explicitly configured.
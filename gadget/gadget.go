@@ -25,6 +25,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"sort"
 	"strconv"
@@ -74,6 +75,8 @@ type Info struct {
 	Defaults map[string]map[string]interface{} `yaml:"defaults,omitempty"`
 
 	Connections []Connection `yaml:"connections"`
+
+	HotplugConnections []HotplugConnection `yaml:"hotplug-connections,omitempty"`
 }
 
 // ModelConstraints defines rules to be followed when reading the gadget metadata.
@@ -246,6 +249,36 @@ func (gcplug *ConnectionPlug) UnmarshalYAML(unmarshal func(interface{}) error) e
 	return nil
 }
 
+// HotplugConnection describes an interface connection requested by the
+// gadget between the slots created for hotplugged devices and a plug of
+// a seeded snap. The syntax is of a mapping like:
+//
+//  interface: <interface>
+//  [attributes: <attributes of the slot>]
+//  plug: <plug-snap-id>:plug
+//
+// A hotplug slot of the given interface gets connected to the plug if
+// it has all the given attributes, with the same values.
+type HotplugConnection struct {
+	Interface  string                 `yaml:"interface"`
+	Attributes map[string]interface{} `yaml:"attributes,omitempty"`
+	Plug       ConnectionPlug         `yaml:"plug"`
+}
+
+// Matches returns whether a hotplug slot of the given interface and with
+// the given attributes should be connected according to the rule.
+func (hconn *HotplugConnection) Matches(iface string, attrs map[string]interface{}) bool {
+	if iface != hconn.Interface {
+		return false
+	}
+	for k, v := range hconn.Attributes {
+		if slotValue, ok := attrs[k]; !ok || !reflect.DeepEqual(v, slotValue) {
+			return false
+		}
+	}
+	return true
+}
+
 type ConnectionSlot struct {
 	SnapID string
 	Slot   string
@@ -319,6 +352,23 @@ func InfoFromGadgetYaml(gadgetYaml []byte, constraints *ModelConstraints) (*Info
 		}
 	}
 
+	for i, hconn := range gi.HotplugConnections {
+		if hconn.Interface == "" {
+			return nil, errors.New("gadget hotplug connection interface cannot be empty")
+		}
+		if hconn.Plug.Empty() {
+			return nil, errors.New("gadget hotplug connection plug cannot be empty")
+		}
+		if len(hconn.Attributes) == 0 {
+			continue
+		}
+		attrs, err := metautil.NormalizeValue(hconn.Attributes)
+		if err != nil {
+			return nil, fmt.Errorf("attributes of gadget hotplug connection for %q: %v", hconn.Interface, err)
+		}
+		gi.HotplugConnections[i].Attributes = attrs.(map[string]interface{})
+	}
+
 	if len(gi.Volumes) == 0 && (constraints == nil || constraints.Classic) {
 		// volumes can be left out on classic
 		// can still specify defaults though
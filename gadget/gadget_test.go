@@ -544,6 +544,67 @@ connections:
 	}
 }
 
+func (s *gadgetYamlTestSuite) TestReadGadgetYamlHotplugConnections(c *C) {
+	err := ioutil.WriteFile(s.gadgetYamlPath, []byte(`
+hotplug-connections:
+  - interface: serial-port
+    attributes:
+      usb-vendor: "0403"
+      usb-product: "6001"
+    plug: snapid1:serial
+  - interface: camera
+    plug: snapid2:camera
+`), 0644)
+	c.Assert(err, IsNil)
+
+	ginfo, err := gadget.ReadInfo(s.dir, &gadget.ModelConstraints{Classic: true})
+	c.Assert(err, IsNil)
+	c.Assert(ginfo.HotplugConnections, DeepEquals, []gadget.HotplugConnection{
+		{
+			Interface:  "serial-port",
+			Attributes: map[string]interface{}{"usb-vendor": "0403", "usb-product": "6001"},
+			Plug:       gadget.ConnectionPlug{SnapID: "snapid1", Plug: "serial"},
+		}, {
+			Interface: "camera",
+			Plug:      gadget.ConnectionPlug{SnapID: "snapid2", Plug: "camera"},
+		},
+	})
+
+	serial := ginfo.HotplugConnections[0]
+	c.Check(serial.Matches("serial-port", map[string]interface{}{"path": "/dev/ttyUSB0", "usb-vendor": "0403", "usb-product": "6001"}), Equals, true)
+	c.Check(serial.Matches("serial-port", map[string]interface{}{"path": "/dev/ttyUSB0", "usb-vendor": "0403", "usb-product": "6010"}), Equals, false)
+	c.Check(serial.Matches("serial-port", map[string]interface{}{"path": "/dev/ttyUSB0"}), Equals, false)
+	c.Check(serial.Matches("hidraw", map[string]interface{}{"usb-vendor": "0403", "usb-product": "6001"}), Equals, false)
+	camera := ginfo.HotplugConnections[1]
+	c.Check(camera.Matches("camera", map[string]interface{}{"path": "/dev/video0"}), Equals, true)
+}
+
+func (s *gadgetYamlTestSuite) TestReadGadgetYamlInvalidHotplugConnection(c *C) {
+	mockGadgetYamlBroken := `
+hotplug-connections:
+ - @INVALID@
+`
+	tests := []struct {
+		invalidConn string
+		expectedErr string
+	}{
+		{`plug: snapid1:serial`, `gadget hotplug connection interface cannot be empty`},
+		{`interface: serial-port`, `gadget hotplug connection plug cannot be empty`},
+		{`{interface: serial-port, plug: ":"}`, `.*in gadget connection plug: expected "\(<snap-id>\|system\):name" not ":"`},
+		{`{interface: serial-port, plug: "snapid1:serial", attributes: {usb-vendor: null}}`, `attributes of gadget hotplug connection for "serial-port": invalid scalar: <nil>`},
+	}
+
+	for _, t := range tests {
+		mockGadgetYamlBroken := strings.Replace(mockGadgetYamlBroken, "@INVALID@", t.invalidConn, 1)
+
+		err := ioutil.WriteFile(s.gadgetYamlPath, []byte(mockGadgetYamlBroken), 0644)
+		c.Assert(err, IsNil)
+
+		_, err = gadget.ReadInfo(s.dir, nil)
+		c.Check(err, ErrorMatches, t.expectedErr)
+	}
+}
+
 func (s *gadgetYamlTestSuite) TestReadGadgetYamlVolumeUpdate(c *C) {
 	err := ioutil.WriteFile(s.gadgetYamlPath, mockVolumeUpdateGadgetYaml, 0644)
 	c.Assert(err, IsNil)
@@ -0,0 +1,79 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package install
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/gadget"
+)
+
+var (
+	mkfsImpl   = gadget.Mkfs
+	sysMount   = syscall.Mount
+	sysUnmount = syscall.Unmount
+)
+
+// makeFilesystem creates the filesystem declared by the given structure on
+// the device node of its partition.
+func makeFilesystem(node string, ps *gadget.LaidOutStructure) error {
+	if ps.IsBare() {
+		return nil
+	}
+	if err := mkfsImpl(ps.Filesystem, node, ps.EffectiveFilesystemLabel()); err != nil {
+		return fmt.Errorf("cannot create %s filesystem on %s: %v", ps.Filesystem, node, err)
+	}
+	return nil
+}
+
+// writeContent writes the gadget content of the given structure into the
+// filesystem on the device node of its partition.
+func writeContent(node, gadgetRoot string, ps *gadget.LaidOutStructure) (err error) {
+	if len(ps.Content) == 0 {
+		return nil
+	}
+
+	fw, err := gadget.NewMountedFilesystemWriter(gadgetRoot, ps)
+	if err != nil {
+		return err
+	}
+
+	mountpoint := filepath.Join(dirs.SnapRunDir, "gadget-install", filepath.Base(node))
+	if err := os.MkdirAll(mountpoint, 0755); err != nil {
+		return err
+	}
+	if err := sysMount(node, mountpoint, ps.Filesystem, 0, ""); err != nil {
+		return fmt.Errorf("cannot mount %s at %s: %v", node, mountpoint, err)
+	}
+	defer func() {
+		if errUnmount := sysUnmount(mountpoint, 0); errUnmount != nil && err == nil {
+			err = fmt.Errorf("cannot unmount %s: %v", mountpoint, errUnmount)
+		}
+	}()
+
+	if err := fw.Write(mountpoint, nil); err != nil {
+		return fmt.Errorf("cannot write content of %v: %v", ps, err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package install
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/gadget"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/secboot"
+)
+
+// EncryptedDataName is the name of the device mapper device the
+// encrypted data partition is unlocked as.
+const EncryptedDataName = "ubuntu-data"
+
+var (
+	secbootNewEncryptionKey      = secboot.NewEncryptionKey
+	secbootNewRecoveryKey        = secboot.NewRecoveryKey
+	secbootFormatEncryptedDevice = secboot.FormatEncryptedDevice
+	secbootAddRecoveryKey        = secboot.AddRecoveryKey
+	secbootUnlockEncryptedDevice = secboot.UnlockEncryptedDevice
+	secbootLockEncryptedDevice   = secboot.LockEncryptedDevice
+	secbootSealKey               = secboot.SealKey
+
+	bootBootChain = boot.BootChain
+)
+
+// Options are the options for the installation.
+type Options struct {
+	// Encrypt the data partition.
+	Encrypt bool
+	// SealedKeyDir is the directory the key of the encrypted data
+	// partition is sealed into, it must be readable before the data
+	// is unlocked.
+	SealedKeyDir string
+	// KernelPath is the kernel snap the system boots, the key is
+	// sealed to the boot chain of grub loading it.
+	KernelPath string
+	// RecoveryKeyFile is the file the recovery key of the encrypted
+	// data partition is written to, for the user to keep it safe.
+	RecoveryKeyFile string
+}
+
+// encryptionBootChain returns the boot chain the key of the encrypted
+// data partition is sealed to: grub loading the kernel with the grub
+// configuration of the gadget.
+func encryptionBootChain(gadgetRoot string, opts *Options) (secboot.BootChain, error) {
+	if opts.SealedKeyDir == "" {
+		return nil, fmt.Errorf("cannot encrypt the data partition without a sealed key directory")
+	}
+	if opts.KernelPath == "" {
+		return nil, fmt.Errorf("cannot encrypt the data partition without a kernel")
+	}
+	if opts.RecoveryKeyFile == "" {
+		return nil, fmt.Errorf("cannot encrypt the data partition without a recovery key file")
+	}
+	grubCfg, err := ioutil.ReadFile(filepath.Join(gadgetRoot, "grub.conf"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read grub configuration of the gadget: %v", err)
+	}
+	chain, err := bootBootChain(grubCfg, opts.KernelPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot measure boot chain: %v", err)
+	}
+	return chain, nil
+}
+
+// encryptionKeys are the keys of the encrypted data partition.
+type encryptionKeys struct {
+	key  secboot.EncryptionKey
+	rkey secboot.RecoveryKey
+}
+
+// newSealedEncryptionKeys creates the keys of the encrypted data
+// partition, sealing the key to the boot chain.
+func newSealedEncryptionKeys(chain secboot.BootChain, opts *Options) (*encryptionKeys, error) {
+	key, err := secbootNewEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	rkey, err := secbootNewRecoveryKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := secbootSealKey(key, opts.SealedKeyDir, chain); err != nil {
+		return nil, fmt.Errorf("cannot seal the encryption key: %v", err)
+	}
+	return &encryptionKeys{key: key, rkey: rkey}, nil
+}
+
+// removeEncryptionKeys removes the sealed key and the recovery key of
+// the encrypted data partition, after failing to set it up.
+func removeEncryptionKeys(opts *Options) {
+	if err := os.RemoveAll(opts.SealedKeyDir); err != nil {
+		logger.Noticef("cannot remove sealed key: %v", err)
+	}
+	if err := os.Remove(opts.RecoveryKeyFile); err != nil && !os.IsNotExist(err) {
+		logger.Noticef("cannot remove recovery key: %v", err)
+	}
+}
+
+// encryptPartition creates an encrypted container, which can also be
+// opened with the recovery key, on the device node of the given
+// structure partition and unlocks it, it returns the device node the
+// filesystem of the structure is to be created on.
+func encryptPartition(node string, keys *encryptionKeys, ps *gadget.LaidOutStructure, opts *Options) (string, error) {
+	if err := secbootFormatEncryptedDevice(keys.key, ps.EffectiveFilesystemLabel()+"-enc", node); err != nil {
+		return "", err
+	}
+	if err := secbootAddRecoveryKey(keys.key, keys.rkey, node); err != nil {
+		return "", err
+	}
+	if err := osutil.AtomicWriteFile(opts.RecoveryKeyFile, []byte(keys.rkey.String()+"\n"), 0600, 0); err != nil {
+		return "", fmt.Errorf("cannot write the recovery key: %v", err)
+	}
+	if err := secbootUnlockEncryptedDevice(EncryptedDataName, node, keys.key); err != nil {
+		return "", err
+	}
+	return filepath.Join("/dev/mapper", EncryptedDataName), nil
+}
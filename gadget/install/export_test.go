@@ -0,0 +1,110 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package install
+
+import (
+	"github.com/snapcore/snapd/secboot"
+)
+
+type LsblkFilesystemInfo = lsblkFilesystemInfo
+type LsblkBlockDevice = lsblkBlockDevice
+type SFDiskPartitionTable = sfdiskPartitionTable
+type SFDiskPartition = sfdiskPartition
+
+var (
+	FilesystemInfo     = filesystemInfo
+	BuildPartitionList = buildPartitionList
+
+	LayoutFromGadget          = layoutFromGadget
+	EnsureLayoutCompatibility = ensureLayoutCompatibility
+
+	MakeFilesystem = makeFilesystem
+)
+
+func MockMkfs(f func(typ, img, label string) error) (restore func()) {
+	old := mkfsImpl
+	mkfsImpl = f
+	return func() {
+		mkfsImpl = old
+	}
+}
+
+func MockSysMount(f func(source, target, fstype string, flags uintptr, data string) error) (restore func()) {
+	old := sysMount
+	sysMount = f
+	return func() {
+		sysMount = old
+	}
+}
+
+func MockSysUnmount(f func(target string, flags int) error) (restore func()) {
+	old := sysUnmount
+	sysUnmount = f
+	return func() {
+		sysUnmount = old
+	}
+}
+
+func MockSecbootFormatEncryptedDevice(f func(key secboot.EncryptionKey, label, node string) error) (restore func()) {
+	old := secbootFormatEncryptedDevice
+	secbootFormatEncryptedDevice = f
+	return func() {
+		secbootFormatEncryptedDevice = old
+	}
+}
+
+func MockSecbootUnlockEncryptedDevice(f func(name, node string, key secboot.EncryptionKey) error) (restore func()) {
+	old := secbootUnlockEncryptedDevice
+	secbootUnlockEncryptedDevice = f
+	return func() {
+		secbootUnlockEncryptedDevice = old
+	}
+}
+
+func MockSecbootSealKey(f func(key secboot.EncryptionKey, dir string, chains ...secboot.BootChain) error) (restore func()) {
+	old := secbootSealKey
+	secbootSealKey = f
+	return func() {
+		secbootSealKey = old
+	}
+}
+
+func MockSecbootAddRecoveryKey(f func(key secboot.EncryptionKey, rkey secboot.RecoveryKey, node string) error) (restore func()) {
+	old := secbootAddRecoveryKey
+	secbootAddRecoveryKey = f
+	return func() {
+		secbootAddRecoveryKey = old
+	}
+}
+
+func MockSecbootLockEncryptedDevice(f func(name string) error) (restore func()) {
+	old := secbootLockEncryptedDevice
+	secbootLockEncryptedDevice = f
+	return func() {
+		secbootLockEncryptedDevice = old
+	}
+}
+
+func MockBootBootChain(f func(grubCfg []byte, kernelPath string) (secboot.BootChain, error)) (restore func()) {
+	old := bootBootChain
+	bootBootChain = f
+	return func() {
+		bootBootChain = old
+	}
+}
@@ -0,0 +1,257 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package install lays out the volume of a gadget on a block device,
+// creating the partitions, and the filesystems with their content, that
+// are missing from the disk.
+package install
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/snapcore/snapd/gadget"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/secboot"
+)
+
+// creatableRoles are the roles of the structures that can be created on
+// the disk when missing, any other structure is expected to be present.
+var creatableRoles = map[string]bool{
+	gadget.SystemSeed: true,
+	gadget.SystemBoot: true,
+	gadget.SystemData: true,
+}
+
+// Run lays out the volume of the gadget found in gadgetRoot on the given
+// block device, or image file. The partitions of the gadget with a role
+// that are missing from the disk are created, formatted and have their
+// content written, the partitions already present are left untouched.
+// When asked to, the data partition is encrypted with a key sealed to
+// the TPM, which is sealed before the disk is modified.
+func Run(gadgetRoot, device string, opts *Options) (err error) {
+	if gadgetRoot == "" {
+		return fmt.Errorf("cannot use empty gadget root directory")
+	}
+	if device == "" {
+		return fmt.Errorf("cannot use empty device node")
+	}
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	var chain secboot.BootChain
+	if opts.Encrypt {
+		chain, err = encryptionBootChain(gadgetRoot, opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	lv, err := layoutFromGadget(gadgetRoot)
+	if err != nil {
+		return fmt.Errorf("cannot lay out the gadget volume: %v", err)
+	}
+
+	if st, err := os.Stat(device); err == nil && st.Mode().IsRegular() {
+		// an image file, expose it and its partitions as block devices
+		loop, err := attachLoopDevice(device)
+		if err != nil {
+			return fmt.Errorf("cannot attach image %q to a loop device: %v", device, err)
+		}
+		defer func() {
+			if err := detachLoopDevice(loop); err != nil {
+				logger.Noticef("cannot detach loop device %q: %v", loop, err)
+			}
+		}()
+		device = loop
+	}
+
+	sf := NewSFDisk(device)
+	diskLayout, err := sf.Layout()
+	if err != nil {
+		return fmt.Errorf("cannot read the partition table of %q: %v", device, err)
+	}
+
+	used, err := ensureLayoutCompatibility(lv, diskLayout)
+	if err != nil {
+		return fmt.Errorf("gadget and %q partition table not compatible: %v", device, err)
+	}
+
+	missing := false
+	for _, u := range used {
+		if !u {
+			missing = true
+			break
+		}
+	}
+	if !missing {
+		logger.Noticef("All partitions of the gadget are present on %q.", device)
+		return nil
+	}
+
+	var keys *encryptionKeys
+	for i, ps := range lv.LaidOutStructure {
+		if !used[i] && opts.Encrypt && ps.Role == gadget.SystemData {
+			// seal first, so that failing to do so leaves the disk
+			// untouched
+			keys, err = newSealedEncryptionKeys(chain, opts)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err != nil {
+					removeEncryptionKeys(opts)
+				}
+			}()
+			break
+		}
+	}
+
+	deviceMap, err := sf.Create(lv, used)
+	if err != nil {
+		return fmt.Errorf("cannot create the partitions: %v", err)
+	}
+	// wait for the device nodes of the new partitions to show up
+	if err := udevSettle(); err != nil {
+		return err
+	}
+
+	for i := range lv.LaidOutStructure {
+		if used[i] {
+			continue
+		}
+		ps := &lv.LaidOutStructure[i]
+		node := deviceMap[ps.Role]
+		if keys != nil && ps.Role == gadget.SystemData {
+			node, err = encryptPartition(node, keys, ps, opts)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err != nil {
+					if err := secbootLockEncryptedDevice(EncryptedDataName); err != nil {
+						logger.Noticef("cannot lock encrypted device: %v", err)
+					}
+				}
+			}()
+		}
+		if err := makeFilesystem(node, ps); err != nil {
+			return err
+		}
+		if err := writeContent(node, gadgetRoot, ps); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// layoutFromGadget lays out the single volume of the gadget found in
+// gadgetRoot.
+func layoutFromGadget(gadgetRoot string) (*gadget.LaidOutVolume, error) {
+	info, err := gadget.ReadInfo(gadgetRoot, nil)
+	if err != nil {
+		return nil, err
+	}
+	// limit ourselves to just one volume for now
+	if len(info.Volumes) != 1 {
+		return nil, fmt.Errorf("cannot position multiple volumes yet")
+	}
+
+	var vol gadget.Volume
+	for _, v := range info.Volumes {
+		vol = v
+	}
+
+	constraints := gadget.LayoutConstraints{
+		NonMBRStartOffset: 1 * gadget.SizeMiB,
+		SectorSize:        sectorSize,
+	}
+	return gadget.LayoutVolume(gadgetRoot, &vol, constraints)
+}
+
+// ensureLayoutCompatibility checks that the gadget layout fits on the disk
+// and that all the partitions found on the disk are part of it, at the same
+// position. It returns which of the gadget structures are either present
+// on the disk already or are not partitions at all, and fails if any other
+// structure cannot be created.
+func ensureLayoutCompatibility(gadgetLayout, diskLayout *gadget.LaidOutVolume) (used []bool, err error) {
+	if gadgetLayout.Size > diskLayout.Size {
+		return nil, fmt.Errorf("device is too small to fit the requested layout (%d > %d bytes)", gadgetLayout.Size, diskLayout.Size)
+	}
+
+	used = make([]bool, len(gadgetLayout.LaidOutStructure))
+	for _, ds := range diskLayout.LaidOutStructure {
+		found := false
+		for i, gs := range gadgetLayout.LaidOutStructure {
+			// partition names are not a thing with MBR
+			nameMatch := ds.Name == "" || ds.Name == gs.Name
+			if nameMatch && ds.StartOffset == gs.StartOffset && ds.Size == gs.Size {
+				used[i] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("cannot find disk partition #%d (starting at %d) in gadget", ds.Index, ds.StartOffset)
+		}
+	}
+
+	for i, gs := range gadgetLayout.LaidOutStructure {
+		if used[i] {
+			continue
+		}
+		if gs.EffectiveRole() == gadget.MBR || gs.Type == "bare" {
+			// not a partition
+			used[i] = true
+			continue
+		}
+		if !creatableRoles[gs.Role] {
+			return nil, fmt.Errorf("cannot create partition %s: only structures with role system-seed, system-boot or system-data can be created", gs)
+		}
+	}
+
+	return used, nil
+}
+
+func attachLoopDevice(image string) (string, error) {
+	output, err := exec.Command("losetup", "--find", "--show", "--partscan", image).CombinedOutput()
+	if err != nil {
+		return "", osutil.OutputErr(output, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func detachLoopDevice(device string) error {
+	if output, err := exec.Command("losetup", "--detach", device).CombinedOutput(); err != nil {
+		return osutil.OutputErr(output, err)
+	}
+	return nil
+}
+
+func udevSettle() error {
+	if output, err := exec.Command("udevadm", "settle", "--timeout=180").CombinedOutput(); err != nil {
+		return osutil.OutputErr(output, fmt.Errorf("cannot wait for udev to settle: %v", err))
+	}
+	return nil
+}
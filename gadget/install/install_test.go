@@ -0,0 +1,454 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2019-2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package install_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/gadget/install"
+	"github.com/snapcore/snapd/secboot"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type partitionTestSuite struct{}
+
+var _ = Suite(&partitionTestSuite{})
+
+func makeMockGadget(gadgetRoot, gadgetContent string) error {
+	if err := os.MkdirAll(filepath.Join(gadgetRoot, "meta"), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(gadgetRoot, "meta", "gadget.yaml"), []byte(gadgetContent), 0644); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(gadgetRoot, "pc-boot.img"), nil, 0644); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(gadgetRoot, "grubx64.efi"), nil, 0644); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type installSuite struct {
+	testutil.BaseTest
+
+	gadgetRoot string
+
+	cmdSfdisk   *testutil.MockCmd
+	cmdLsblk    *testutil.MockCmd
+	cmdBlockdev *testutil.MockCmd
+	cmdUdevadm  *testutil.MockCmd
+
+	mkfsCalls    [][]string
+	mountCalls   [][]string
+	unmountCalls []string
+}
+
+var _ = Suite(&installSuite{})
+
+const installGadgetContent = `volumes:
+  pc:
+    bootloader: grub
+    structure:
+      - name: mbr
+        type: mbr
+        size: 440
+        content:
+          - image: pc-boot.img
+      - name: BIOS Boot
+        type: DA,21686148-6449-6E6F-744E-656564454649
+        size: 1M
+        offset: 1M
+        offset-write: mbr+92
+      - name: Recovery
+        role: system-seed
+        filesystem: vfat
+        type: EF,C12A7328-F81F-11D2-BA4B-00A0C93EC93B
+        size: 1200M
+        content:
+          - source: grubx64.efi
+            target: EFI/boot/grubx64.efi
+      - name: Boot
+        role: system-boot
+        filesystem: ext4
+        filesystem-label: ubuntu-boot
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        size: 750M
+        content:
+          - source: grubx64.efi
+            target: EFI/boot/grubx64.efi
+      - name: Writable
+        role: system-data
+        filesystem: ext4
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        size: 1200M
+`
+
+const mockLsblkScript = `
+[ "$3" == "/dev/node1" ] && echo '{
+   "blockdevices": [ {"name": "node1", "fstype": null, "label": null, "uuid": null, "mountpoint": null} ]
+}'
+[ "$3" == "/dev/node2" ] && echo '{
+   "blockdevices": [ {"name": "node2", "fstype": "vfat", "label": "ubuntu-seed", "uuid": "A644-B807", "mountpoint": null} ]
+}'
+exit 0`
+
+func (s *installSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("/") })
+
+	s.gadgetRoot = filepath.Join(c.MkDir(), "gadget")
+	c.Assert(makeMockGadget(s.gadgetRoot, installGadgetContent), IsNil)
+
+	s.cmdSfdisk = testutil.MockCommand(c, "sfdisk", mockSfdiskScript)
+	s.AddCleanup(s.cmdSfdisk.Restore)
+	s.cmdLsblk = testutil.MockCommand(c, "lsblk", mockLsblkScript)
+	s.AddCleanup(s.cmdLsblk.Restore)
+	s.cmdBlockdev = testutil.MockCommand(c, "blockdev", "")
+	s.AddCleanup(s.cmdBlockdev.Restore)
+	s.cmdUdevadm = testutil.MockCommand(c, "udevadm", "")
+	s.AddCleanup(s.cmdUdevadm.Restore)
+
+	s.mkfsCalls = nil
+	s.AddCleanup(install.MockMkfs(func(typ, img, label string) error {
+		s.mkfsCalls = append(s.mkfsCalls, []string{typ, img, label})
+		return nil
+	}))
+	s.mountCalls = nil
+	s.AddCleanup(install.MockSysMount(func(source, target, fstype string, flags uintptr, data string) error {
+		s.mountCalls = append(s.mountCalls, []string{source, target, fstype})
+		return nil
+	}))
+	s.unmountCalls = nil
+	s.AddCleanup(install.MockSysUnmount(func(target string, flags int) error {
+		s.unmountCalls = append(s.unmountCalls, target)
+		return nil
+	}))
+}
+
+func (s *installSuite) TestRunEmptyArgs(c *C) {
+	err := install.Run("", "/dev/node", nil)
+	c.Assert(err, ErrorMatches, "cannot use empty gadget root directory")
+
+	err = install.Run(s.gadgetRoot, "", nil)
+	c.Assert(err, ErrorMatches, "cannot use empty device node")
+}
+
+func (s *installSuite) TestRunHappy(c *C) {
+	err := install.Run(s.gadgetRoot, "/dev/node", nil)
+	c.Assert(err, IsNil)
+
+	c.Check(s.cmdSfdisk.Calls(), DeepEquals, [][]string{
+		{"sfdisk", "--json", "-d", "/dev/node"},
+		{"sfdisk", "--json", "-d", "/dev/node"},
+		{"sfdisk", "/dev/node"},
+	})
+	c.Check(s.cmdBlockdev.Calls(), DeepEquals, [][]string{
+		{"blockdev", "--rereadpt", "/dev/node"},
+	})
+	c.Check(s.cmdUdevadm.Calls(), DeepEquals, [][]string{
+		{"udevadm", "settle", "--timeout=180"},
+	})
+
+	// only the missing partitions got a filesystem
+	c.Check(s.mkfsCalls, DeepEquals, [][]string{
+		{"ext4", "/dev/node3", "ubuntu-boot"},
+		{"ext4", "/dev/node4", "writable"},
+	})
+
+	// and only those with content were mounted to write it
+	mountpoint := filepath.Join(dirs.SnapRunDir, "gadget-install", "node3")
+	c.Check(s.mountCalls, DeepEquals, [][]string{
+		{"/dev/node3", mountpoint, "ext4"},
+	})
+	c.Check(s.unmountCalls, DeepEquals, []string{mountpoint})
+	c.Check(filepath.Join(mountpoint, "EFI/boot/grubx64.efi"), testutil.FilePresent)
+}
+
+func (s *installSuite) TestRunImageFile(c *C) {
+	cmdLosetup := testutil.MockCommand(c, "losetup", `[ "$1" = "--find" ] && echo /dev/loop7; exit 0`)
+	defer cmdLosetup.Restore()
+
+	img := filepath.Join(c.MkDir(), "disk.img")
+	c.Assert(ioutil.WriteFile(img, nil, 0644), IsNil)
+
+	err := install.Run(s.gadgetRoot, img, nil)
+	c.Assert(err, IsNil)
+
+	c.Check(cmdLosetup.Calls(), DeepEquals, [][]string{
+		{"losetup", "--find", "--show", "--partscan", img},
+		{"losetup", "--detach", "/dev/loop7"},
+	})
+	c.Check(s.cmdSfdisk.Calls(), DeepEquals, [][]string{
+		{"sfdisk", "--json", "-d", "/dev/loop7"},
+		{"sfdisk", "--json", "-d", "/dev/loop7"},
+		{"sfdisk", "/dev/loop7"},
+	})
+	c.Check(s.mkfsCalls, HasLen, 2)
+}
+
+func (s *installSuite) TestRunImageFileLosetupError(c *C) {
+	cmdLosetup := testutil.MockCommand(c, "losetup", `echo "losetup: cannot find an unused loop device"; exit 1`)
+	defer cmdLosetup.Restore()
+
+	img := filepath.Join(c.MkDir(), "disk.img")
+	c.Assert(ioutil.WriteFile(img, nil, 0644), IsNil)
+
+	err := install.Run(s.gadgetRoot, img, nil)
+	c.Assert(err, ErrorMatches, `cannot attach image ".*/disk.img" to a loop device: losetup: cannot find an unused loop device`)
+	c.Check(s.cmdSfdisk.Calls(), HasLen, 0)
+}
+
+func (s *installSuite) TestRunNotCompatible(c *C) {
+	gadgetRoot := filepath.Join(c.MkDir(), "gadget")
+	err := makeMockGadget(gadgetRoot, strings.Replace(installGadgetContent, "size: 1M", "size: 2M", 1))
+	c.Assert(err, IsNil)
+
+	err = install.Run(gadgetRoot, "/dev/node", nil)
+	c.Assert(err, ErrorMatches, `gadget and "/dev/node" partition table not compatible: cannot find disk partition #1 \(starting at 1048576\) in gadget`)
+	// nothing was written
+	c.Check(s.cmdSfdisk.Calls(), HasLen, 1)
+	c.Check(s.mkfsCalls, HasLen, 0)
+}
+
+func (s *installSuite) TestRunTooSmall(c *C) {
+	cmdSfdisk := testutil.MockCommand(c, "sfdisk", strings.Replace(mockSfdiskScript, `"lastlba": 8388574`, `"lastlba": 4095`, 1))
+	defer cmdSfdisk.Restore()
+
+	err := install.Run(s.gadgetRoot, "/dev/node", nil)
+	c.Assert(err, ErrorMatches, `gadget and "/dev/node" partition table not compatible: device is too small to fit the requested layout \(3305111552 > 2097152 bytes\)`)
+}
+
+func (s *installSuite) TestRunCannotCreateWithoutRole(c *C) {
+	gadgetRoot := filepath.Join(c.MkDir(), "gadget")
+	err := makeMockGadget(gadgetRoot, installGadgetContent+`      - name: Extra
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        size: 10M
+`)
+	c.Assert(err, IsNil)
+
+	err = install.Run(gadgetRoot, "/dev/node", nil)
+	c.Assert(err, ErrorMatches, `gadget and "/dev/node" partition table not compatible: cannot create partition #5 \("Extra"\): only structures with role system-seed, system-boot or system-data can be created`)
+}
+
+func (s *installSuite) TestRunMkfsError(c *C) {
+	restore := install.MockMkfs(func(typ, img, label string) error {
+		return errors.New("mkfs failed")
+	})
+	defer restore()
+
+	err := install.Run(s.gadgetRoot, "/dev/node", nil)
+	c.Assert(err, ErrorMatches, "cannot create ext4 filesystem on /dev/node3: mkfs failed")
+}
+
+func (s *installSuite) TestRunMountError(c *C) {
+	restore := install.MockSysMount(func(source, target, fstype string, flags uintptr, data string) error {
+		return errors.New("mount failed")
+	})
+	defer restore()
+
+	err := install.Run(s.gadgetRoot, "/dev/node", nil)
+	c.Assert(err, ErrorMatches, "cannot mount /dev/node3 at .*/run/snapd/gadget-install/node3: mount failed")
+	c.Check(s.unmountCalls, HasLen, 0)
+}
+
+func (s *installSuite) mockEncryption(c *C) (kernel string, calls *[]string) {
+	c.Assert(ioutil.WriteFile(filepath.Join(s.gadgetRoot, "grub.conf"), []byte("grub.cfg"), 0644), IsNil)
+	kernel = filepath.Join(c.MkDir(), "pc-kernel_1.snap")
+	snaptest.PopulateDir(kernel, [][]string{
+		{"meta/snap.yaml", "name: pc-kernel\nversion: 1\ntype: kernel\n"},
+		{"kernel.img", "kernel"},
+		{"initrd.img", "initrd"},
+	})
+
+	calls = &[]string{}
+	s.AddCleanup(install.MockBootBootChain(func(grubCfg []byte, kernelPath string) (secboot.BootChain, error) {
+		return secboot.MeasureBootChain(grubCfg, []byte(kernelPath)), nil
+	}))
+	s.AddCleanup(install.MockSecbootFormatEncryptedDevice(func(key secboot.EncryptionKey, label, node string) error {
+		*calls = append(*calls, fmt.Sprintf("format %s %s", label, node))
+		return nil
+	}))
+	s.AddCleanup(install.MockSecbootAddRecoveryKey(func(key secboot.EncryptionKey, rkey secboot.RecoveryKey, node string) error {
+		*calls = append(*calls, fmt.Sprintf("add-recovery-key %s", node))
+		return nil
+	}))
+	s.AddCleanup(install.MockSecbootUnlockEncryptedDevice(func(name, node string, key secboot.EncryptionKey) error {
+		*calls = append(*calls, fmt.Sprintf("unlock %s %s", name, node))
+		return nil
+	}))
+	s.AddCleanup(install.MockSecbootLockEncryptedDevice(func(name string) error {
+		*calls = append(*calls, fmt.Sprintf("lock %s", name))
+		return nil
+	}))
+	s.AddCleanup(install.MockSecbootSealKey(func(key secboot.EncryptionKey, dir string, chains ...secboot.BootChain) error {
+		*calls = append(*calls, "seal")
+		return os.MkdirAll(dir, 0700)
+	}))
+	return kernel, calls
+}
+
+func (s *installSuite) TestRunEncrypted(c *C) {
+	kernel, calls := s.mockEncryption(c)
+	sealedKeyDir := c.MkDir()
+
+	var formatKey, sealedKey secboot.EncryptionKey
+	restore := install.MockSecbootFormatEncryptedDevice(func(key secboot.EncryptionKey, label, node string) error {
+		formatKey = key
+		*calls = append(*calls, fmt.Sprintf("format %s %s", label, node))
+		return nil
+	})
+	defer restore()
+	var sealedChains []secboot.BootChain
+	restore = install.MockSecbootSealKey(func(key secboot.EncryptionKey, dir string, chains ...secboot.BootChain) error {
+		sealedKey = key
+		sealedChains = chains
+		c.Check(dir, Equals, sealedKeyDir)
+		// the disk was not touched yet
+		c.Check(s.cmdSfdisk.Calls(), HasLen, 1)
+		*calls = append(*calls, "seal")
+		return nil
+	})
+	defer restore()
+	var recoveryKey secboot.RecoveryKey
+	restore = install.MockSecbootAddRecoveryKey(func(key secboot.EncryptionKey, rkey secboot.RecoveryKey, node string) error {
+		c.Check(key, DeepEquals, formatKey)
+		recoveryKey = rkey
+		*calls = append(*calls, fmt.Sprintf("add-recovery-key %s", node))
+		return nil
+	})
+	defer restore()
+
+	recoveryKeyFile := filepath.Join(c.MkDir(), "recovery.key")
+	err := install.Run(s.gadgetRoot, "/dev/node", &install.Options{
+		Encrypt:         true,
+		SealedKeyDir:    sealedKeyDir,
+		KernelPath:      kernel,
+		RecoveryKeyFile: recoveryKeyFile,
+	})
+	c.Assert(err, IsNil)
+
+	c.Check(*calls, DeepEquals, []string{
+		"seal",
+		"format writable-enc /dev/node4",
+		"add-recovery-key /dev/node4",
+		"unlock ubuntu-data /dev/node4",
+	})
+	c.Check(formatKey, Not(DeepEquals), secboot.EncryptionKey{})
+	c.Check(sealedKey, DeepEquals, formatKey)
+	c.Check(recoveryKey, Not(DeepEquals), secboot.RecoveryKey{})
+	c.Check(recoveryKeyFile, testutil.FileEquals, recoveryKey.String()+"\n")
+	c.Check(sealedChains, DeepEquals, []secboot.BootChain{
+		secboot.MeasureBootChain([]byte("grub.cfg"), []byte(kernel)),
+	})
+
+	// the filesystem of the data partition is in the encrypted container
+	c.Check(s.mkfsCalls, DeepEquals, [][]string{
+		{"ext4", "/dev/node3", "ubuntu-boot"},
+		{"ext4", "/dev/mapper/ubuntu-data", "writable"},
+	})
+}
+
+func (s *installSuite) TestRunEncryptedMissingOptions(c *C) {
+	kernel, calls := s.mockEncryption(c)
+
+	err := install.Run(s.gadgetRoot, "/dev/node", &install.Options{Encrypt: true, KernelPath: kernel})
+	c.Assert(err, ErrorMatches, "cannot encrypt the data partition without a sealed key directory")
+
+	err = install.Run(s.gadgetRoot, "/dev/node", &install.Options{Encrypt: true, SealedKeyDir: c.MkDir()})
+	c.Assert(err, ErrorMatches, "cannot encrypt the data partition without a kernel")
+
+	err = install.Run(s.gadgetRoot, "/dev/node", &install.Options{Encrypt: true, SealedKeyDir: c.MkDir(), KernelPath: kernel})
+	c.Assert(err, ErrorMatches, "cannot encrypt the data partition without a recovery key file")
+
+	c.Assert(os.Remove(filepath.Join(s.gadgetRoot, "grub.conf")), IsNil)
+	err = install.Run(s.gadgetRoot, "/dev/node", &install.Options{Encrypt: true, SealedKeyDir: c.MkDir(), KernelPath: kernel, RecoveryKeyFile: filepath.Join(c.MkDir(), "recovery.key")})
+	c.Assert(err, ErrorMatches, "cannot read grub configuration of the gadget: .*")
+
+	// nothing was touched
+	c.Check(*calls, HasLen, 0)
+	c.Check(s.cmdSfdisk.Calls(), HasLen, 0)
+}
+
+func (s *installSuite) TestRunEncryptedSealError(c *C) {
+	kernel, _ := s.mockEncryption(c)
+	restore := install.MockSecbootSealKey(func(key secboot.EncryptionKey, dir string, chains ...secboot.BootChain) error {
+		return errors.New("cannot create primary key: no TPM")
+	})
+	defer restore()
+
+	err := install.Run(s.gadgetRoot, "/dev/node", &install.Options{
+		Encrypt:         true,
+		SealedKeyDir:    c.MkDir(),
+		KernelPath:      kernel,
+		RecoveryKeyFile: filepath.Join(c.MkDir(), "recovery.key"),
+	})
+	c.Assert(err, ErrorMatches, "cannot seal the encryption key: cannot create primary key: no TPM")
+	// the partition table was only read
+	c.Check(s.cmdSfdisk.Calls(), HasLen, 1)
+	c.Check(s.mkfsCalls, HasLen, 0)
+}
+
+func (s *installSuite) TestRunEncryptedCleanupOnError(c *C) {
+	kernel, calls := s.mockEncryption(c)
+	restore := install.MockMkfs(func(typ, img, label string) error {
+		if img == "/dev/mapper/ubuntu-data" {
+			return errors.New("mkfs failed")
+		}
+		return nil
+	})
+	defer restore()
+
+	sealedKeyDir := filepath.Join(c.MkDir(), "fde")
+	recoveryKeyFile := filepath.Join(c.MkDir(), "recovery.key")
+	err := install.Run(s.gadgetRoot, "/dev/node", &install.Options{
+		Encrypt:         true,
+		SealedKeyDir:    sealedKeyDir,
+		KernelPath:      kernel,
+		RecoveryKeyFile: recoveryKeyFile,
+	})
+	c.Assert(err, ErrorMatches, "cannot create ext4 filesystem on /dev/mapper/ubuntu-data: mkfs failed")
+
+	c.Check(*calls, DeepEquals, []string{
+		"seal",
+		"format writable-enc /dev/node4",
+		"add-recovery-key /dev/node4",
+		"unlock ubuntu-data /dev/node4",
+		"lock ubuntu-data",
+	})
+	c.Check(sealedKeyDir, testutil.FileAbsent)
+	c.Check(recoveryKeyFile, testutil.FileAbsent)
+}
@@ -16,7 +16,7 @@
  * along with this program.  If not, see <http://www.gnu.org/licenses/>.
  *
  */
-package partition
+package install
 
 import (
 	"bytes"
@@ -127,8 +127,8 @@ func positionedVolumeFromDump(dump *sfdiskDeviceDump) (*gadget.LaidOutVolume, er
 		return nil, fmt.Errorf("cannot position partitions: unknown unit %q", ptable.Unit)
 	}
 
-	structure := make([]gadget.VolumeStructure, len(ptable.Partitions))
-	ps := make([]gadget.LaidOutStructure, len(ptable.Partitions))
+	structure := make([]gadget.VolumeStructure, 0, len(ptable.Partitions))
+	ps := make([]gadget.LaidOutStructure, 0, len(ptable.Partitions))
 
 	for i, p := range ptable.Partitions {
 		info, err := filesystemInfo(p.Node)
@@ -143,18 +143,22 @@ func positionedVolumeFromDump(dump *sfdiskDeviceDump) (*gadget.LaidOutVolume, er
 		}
 		bd := info.BlockDevices[0]
 
-		structure[i] = gadget.VolumeStructure{
+		structure = append(structure, gadget.VolumeStructure{
 			Name:       p.Name,
 			Size:       gadget.Size(p.Size) * sectorSize,
 			Label:      bd.Label,
 			Type:       p.Type,
 			Filesystem: bd.FSType,
-		}
-		ps[i] = gadget.LaidOutStructure{
-			VolumeStructure: &structure[i],
-			StartOffset:     gadget.Size(p.Start) * sectorSize,
-			Index:           i + 1,
-		}
+		})
+		ps = append(ps, gadget.LaidOutStructure{
+			StartOffset: gadget.Size(p.Start) * sectorSize,
+			Index:       i + 1,
+		})
+	}
+	// structure has been fully populated, it is safe to point to its
+	// elements now
+	for i := range ps {
+		ps[i].VolumeStructure = &structure[i]
 	}
 
 	pv := &gadget.LaidOutVolume{
@@ -162,7 +166,7 @@ func positionedVolumeFromDump(dump *sfdiskDeviceDump) (*gadget.LaidOutVolume, er
 			ID:        ptable.ID,
 			Structure: structure,
 		},
-		Size:             gadget.Size(ptable.LastLBA),
+		Size:             gadget.Size(ptable.LastLBA+1) * sectorSize,
 		SectorSize:       sectorSize,
 		LaidOutStructure: ps,
 	}
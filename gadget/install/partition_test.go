@@ -16,15 +16,15 @@
  * along with this program.  If not, see <http://www.gnu.org/licenses/>.
  *
  */
-package partition_test
+package install_test
 
 import (
 	"path/filepath"
 
 	. "gopkg.in/check.v1"
 
-	"github.com/snapcore/snapd/cmd/snap-recovery/partition"
 	"github.com/snapcore/snapd/gadget"
+	"github.com/snapcore/snapd/gadget/install"
 	"github.com/snapcore/snapd/testutil"
 )
 
@@ -57,7 +57,7 @@ func (s *partitionTestSuite) TestDeviceInfo(c *C) {
 exit 0`)
 	defer cmdLsblk.Restore()
 
-	sf := partition.NewSFDisk("/dev/node")
+	sf := install.NewSFDisk("/dev/node")
 	pv, err := sf.Layout()
 	c.Assert(cmdSfdisk.Calls(), DeepEquals, [][]string{
 		{"sfdisk", "--json", "-d", "/dev/node"},
@@ -68,6 +68,7 @@ exit 0`)
 	})
 	c.Assert(err, IsNil)
 	c.Assert(pv.Volume.ID, Equals, "9151F25B-CDF0-48F1-9EDE-68CBD616E2CA")
+	c.Assert(pv.Size, Equals, gadget.Size(8388575*512))
 	c.Assert(len(pv.Structure), Equals, 2)
 
 	c.Assert(pv.Structure, DeepEquals, []gadget.VolumeStructure{
@@ -104,7 +105,7 @@ func (s *partitionTestSuite) TestDeviceInfoNotSectors(c *C) {
 }'`)
 	defer cmdSfdisk.Restore()
 
-	sf := partition.NewSFDisk("/dev/node")
+	sf := install.NewSFDisk("/dev/node")
 	_, err := sf.Layout()
 	c.Assert(err, ErrorMatches, "cannot position partitions: unknown unit .*")
 }
@@ -128,7 +129,7 @@ func (s *partitionTestSuite) TestDeviceInfoFilesystemInfoError(c *C) {
 	cmdLsblk := testutil.MockCommand(c, "lsblk", "echo lsblk error; exit 1")
 	defer cmdLsblk.Restore()
 
-	sf := partition.NewSFDisk("/dev/node")
+	sf := install.NewSFDisk("/dev/node")
 	_, err := sf.Layout()
 	c.Assert(err, ErrorMatches, "cannot obtain filesystem information: lsblk error")
 }
@@ -137,7 +138,7 @@ func (s *partitionTestSuite) TestDeviceInfoJsonError(c *C) {
 	cmd := testutil.MockCommand(c, "sfdisk", `echo 'This is not a json'`)
 	defer cmd.Restore()
 
-	sf := partition.NewSFDisk("/dev/node")
+	sf := install.NewSFDisk("/dev/node")
 	info, err := sf.Layout()
 	c.Assert(err, ErrorMatches, "cannot parse sfdisk output: invalid .*")
 	c.Assert(info, IsNil)
@@ -147,7 +148,7 @@ func (s *partitionTestSuite) TestDeviceInfoError(c *C) {
 	cmd := testutil.MockCommand(c, "sfdisk", "echo 'sfdisk: not found'; exit 127")
 	defer cmd.Restore()
 
-	sf := partition.NewSFDisk("/dev/node")
+	sf := install.NewSFDisk("/dev/node")
 	info, err := sf.Layout()
 	c.Assert(err, ErrorMatches, "sfdisk: not found")
 	c.Assert(info, IsNil)
@@ -217,14 +218,14 @@ func (s *partitionTestSuite) TestBuildPartitionList(c *C) {
 	cmdLsblk := testutil.MockCommand(c, "lsblk", lsblkMockScript)
 	defer cmdLsblk.Restore()
 
-	ptable := &partition.SFDiskPartitionTable{
+	ptable := &install.SFDiskPartitionTable{
 		Label:    "gpt",
 		ID:       "9151F25B-CDF0-48F1-9EDE-68CBD616E2CA",
 		Device:   "/dev/node",
 		Unit:     "sectors",
 		FirstLBA: 34,
 		LastLBA:  8388574,
-		Partitions: []partition.SFDiskPartition{
+		Partitions: []install.SFDiskPartition{
 			{
 				Node:  "/dev/node1",
 				Start: 2048,
@@ -239,10 +240,10 @@ func (s *partitionTestSuite) TestBuildPartitionList(c *C) {
 	gadgetRoot := filepath.Join(c.MkDir(), "gadget")
 	err := makeMockGadget(gadgetRoot, gadgetContent)
 	c.Assert(err, IsNil)
-	pv, err := positionedVolumeFromGadget(gadgetRoot)
+	pv, err := install.LayoutFromGadget(gadgetRoot)
 	c.Assert(err, IsNil)
 
-	plist, deviceMap := partition.BuildPartitionList(ptable, pv, []bool{true, true, false, false})
+	plist, deviceMap := install.BuildPartitionList(ptable, pv, []bool{true, true, false, false})
 	c.Assert(plist.String(), Equals, `label: gpt
 label-id: 9151F25B-CDF0-48F1-9EDE-68CBD616E2CA
 device: /dev/node
@@ -273,10 +274,10 @@ func (s *partitionTestSuite) TestCreatePartitions(c *C) {
 	gadgetRoot := filepath.Join(c.MkDir(), "gadget")
 	err := makeMockGadget(gadgetRoot, gadgetContent)
 	c.Assert(err, IsNil)
-	pv, err := positionedVolumeFromGadget(gadgetRoot)
+	pv, err := install.LayoutFromGadget(gadgetRoot)
 	c.Assert(err, IsNil)
 
-	sf := partition.NewSFDisk("/dev/node")
+	sf := install.NewSFDisk("/dev/node")
 	deviceMap, err := sf.Create(pv, []bool{true, true, false, false})
 	c.Assert(err, IsNil)
 	c.Assert(deviceMap, DeepEquals, map[string]string{
@@ -302,7 +303,7 @@ func (s *partitionTestSuite) TestFilesystemInfo(c *C) {
 }'`)
 	defer cmd.Restore()
 
-	info, err := partition.FilesystemInfo("/dev/node")
+	info, err := install.FilesystemInfo("/dev/node")
 	c.Assert(cmd.Calls(), DeepEquals, [][]string{
 		{"lsblk", "--fs", "--json", "/dev/node"},
 	})
@@ -319,7 +320,7 @@ func (s *partitionTestSuite) TestFilesystemInfoJsonError(c *C) {
 	cmd := testutil.MockCommand(c, "lsblk", `echo 'This is not a json'`)
 	defer cmd.Restore()
 
-	info, err := partition.FilesystemInfo("/dev/node")
+	info, err := install.FilesystemInfo("/dev/node")
 	c.Assert(err, ErrorMatches, "cannot parse lsblk output: invalid .*")
 	c.Assert(info, IsNil)
 }
@@ -328,7 +329,7 @@ func (s *partitionTestSuite) TestFilesystemInfoError(c *C) {
 	cmd := testutil.MockCommand(c, "lsblk", "echo 'lsblk: not found'; exit 127")
 	defer cmd.Restore()
 
-	info, err := partition.FilesystemInfo("/dev/node")
+	info, err := install.FilesystemInfo("/dev/node")
 	c.Assert(err, ErrorMatches, "lsblk: not found")
 	c.Assert(info, IsNil)
 }
@@ -28,9 +28,26 @@ import (
 	"github.com/snapcore/snapd/osutil"
 )
 
+// Mkfs creates an empty filesystem of the given type, with an optional
+// filesystem label, in the given image file or block device.
+func Mkfs(typ, img, label string) error {
+	return MkfsWithContent(typ, img, label, "")
+}
+
+// MkfsWithContent creates a filesystem of the given type, with an optional
+// filesystem label, in the given image file or block device, and populates it
+// with the contents of provided root directory, if any.
+func MkfsWithContent(typ, img, label, contentsRootDir string) error {
+	h, ok := mkfsHandlers[typ]
+	if !ok {
+		return fmt.Errorf("cannot create unsupported filesystem %q", typ)
+	}
+	return h(img, label, contentsRootDir)
+}
+
 // MkfsExt4 creates an EXT4 filesystem in given image file, with an optional
 // filesystem label, and populates it with the contents of provided root
-// directory.
+// directory, if any.
 func MkfsExt4(img, label, contentsRootDir string) error {
 	// taken from ubuntu-image
 	mkfsArgs := []string{
@@ -43,17 +60,26 @@ func MkfsExt4(img, label, contentsRootDir string) error {
 		"-O", "-metadata_csum",
 		// allow uninitialized block groups
 		"-O", "uninit_bg",
+	}
+	if contentsRootDir != "" {
 		// mkfs.ext4 can populate the filesystem with contents of given
 		// root directory
 		// TODO: support e2fsprogs 1.42 without -d in Ubuntu 16.04
-		"-d", contentsRootDir,
+		mkfsArgs = append(mkfsArgs, "-d", contentsRootDir)
 	}
 	if label != "" {
 		mkfsArgs = append(mkfsArgs, "-L", label)
 	}
 	mkfsArgs = append(mkfsArgs, img)
-	// run through fakeroot so that files are owned by root
-	cmd := exec.Command("fakeroot", mkfsArgs...)
+
+	var cmd *exec.Cmd
+	if contentsRootDir != "" {
+		// run through fakeroot so that files are owned by root
+		cmd = exec.Command("fakeroot", mkfsArgs...)
+	} else {
+		// no content to take ownership of
+		cmd = exec.Command(mkfsArgs[0], mkfsArgs[1:]...)
+	}
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		return osutil.OutputErr(out, err)
@@ -63,7 +89,7 @@ func MkfsExt4(img, label, contentsRootDir string) error {
 
 // MkfsVfat creates a VFAT filesystem in given image file, with an optional
 // filesystem label, and populates it with the contents of provided root
-// directory.
+// directory, if any.
 func MkfsVfat(img, label, contentsRootDir string) error {
 	// taken from ubuntu-image
 	mkfsArgs := []string{
@@ -85,6 +111,11 @@ func MkfsVfat(img, label, contentsRootDir string) error {
 		return osutil.OutputErr(out, err)
 	}
 
+	if contentsRootDir == "" {
+		// nothing to populate the filesystem with
+		return nil
+	}
+
 	// mkfs.vfat does not know how to populate the filesystem with contents,
 	// we need to do the work ourselves
 
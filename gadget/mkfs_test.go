@@ -188,3 +188,50 @@ func (m *mkfsSuite) TestMkfsVfatErrorInMcopy(c *C) {
 	c.Assert(cmdMkfs.Calls(), HasLen, 1)
 	c.Assert(cmdMcopy.Calls(), HasLen, 1)
 }
+
+func (m *mkfsSuite) TestMkfsExt4NoContent(c *C) {
+	cmd := testutil.MockCommand(c, "mkfs.ext4", "")
+	defer cmd.Restore()
+
+	err := gadget.MkfsExt4("/dev/node", "my-label", "")
+	c.Assert(err, IsNil)
+	// no content, no need for fakeroot
+	c.Check(cmd.Calls(), DeepEquals, [][]string{
+		{
+			"mkfs.ext4",
+			"-T", "default",
+			"-O", "-metadata_csum",
+			"-O", "uninit_bg",
+			"-L", "my-label",
+			"/dev/node",
+		},
+	})
+}
+
+func (m *mkfsSuite) TestMkfsVfatNoContent(c *C) {
+	cmd := testutil.MockCommand(c, "mkfs.vfat", "")
+	defer cmd.Restore()
+
+	err := gadget.MkfsVfat("/dev/node", "my-label", "")
+	c.Assert(err, IsNil)
+	c.Check(cmd.Calls(), HasLen, 1)
+}
+
+func (m *mkfsSuite) TestMkfs(c *C) {
+	cmdExt4 := testutil.MockCommand(c, "mkfs.ext4", "")
+	defer cmdExt4.Restore()
+	cmdVfat := testutil.MockCommand(c, "mkfs.vfat", "")
+	defer cmdVfat.Restore()
+
+	err := gadget.Mkfs("ext4", "/dev/node1", "writable")
+	c.Assert(err, IsNil)
+	err = gadget.Mkfs("vfat", "/dev/node2", "ubuntu-boot")
+	c.Assert(err, IsNil)
+	c.Check(cmdExt4.Calls(), HasLen, 1)
+	c.Check(cmdVfat.Calls(), DeepEquals, [][]string{
+		{"mkfs.vfat", "-S", "512", "-s", "1", "-F", "32", "-n", "ubuntu-boot", "/dev/node2"},
+	})
+
+	err = gadget.Mkfs("btrfs", "/dev/node3", "")
+	c.Assert(err, ErrorMatches, `cannot create unsupported filesystem "btrfs"`)
+}
@@ -66,46 +66,88 @@ func Update(old, new GadgetData, rollbackDirPath string) error {
 		return nil
 	}
 
-	oldVol, newVol, err := resolveVolume(old.Info, new.Info)
+	updates, err := resolveUpdates(old, new)
 	if err != nil {
 		return err
 	}
 
+	return applyUpdates(new, updates, rollbackDirPath)
+}
+
+// resolveUpdates finds the structures of the single volume of the gadget
+// that need an update from old to new, and checks that the update is
+// possible.
+func resolveUpdates(old, new GadgetData) ([]updatePair, error) {
+	oldVol, newVol, err := resolveVolume(old.Info, new.Info)
+	if err != nil {
+		return nil, err
+	}
+
 	// layout old partially, without going deep into the layout of structure
 	// content
 	pOld, err := LayoutVolumePartially(oldVol, defaultConstraints)
 	if err != nil {
-		return fmt.Errorf("cannot lay out the old volume: %v", err)
+		return nil, fmt.Errorf("cannot lay out the old volume: %v", err)
 	}
 
 	// layout new
 	pNew, err := LayoutVolume(new.RootDir, newVol, defaultConstraints)
 	if err != nil {
-		return fmt.Errorf("cannot lay out the new volume: %v", err)
+		return nil, fmt.Errorf("cannot lay out the new volume: %v", err)
 	}
 
 	if err := canUpdateVolume(pOld, pNew); err != nil {
-		return fmt.Errorf("cannot apply update to volume: %v", err)
+		return nil, fmt.Errorf("cannot apply update to volume: %v", err)
 	}
 
 	// now we know which structure is which, find which ones need an update
 	updates, err := resolveUpdate(pOld, pNew)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if len(updates) == 0 {
 		// nothing to update
-		return ErrNoUpdate
+		return nil, ErrNoUpdate
 	}
 
 	// can update old layout to new layout
 	for _, update := range updates {
 		if err := canUpdateStructure(update.from, update.to); err != nil {
-			return fmt.Errorf("cannot update volume structure %v: %v", update.to, err)
+			return nil, fmt.Errorf("cannot update volume structure %v: %v", update.to, err)
 		}
 	}
 
-	return applyUpdates(new, updates, rollbackDirPath)
+	return updates, nil
+}
+
+// Rollback restores the data modified by a successful Update from old to
+// new, using the backups kept in the rollback directory used by the
+// update. It is meant for the cases where the system could not boot with
+// the updated data.
+func Rollback(old, new GadgetData, rollbackDirPath string) error {
+	if len(new.Info.Volumes) != 1 || len(old.Info.Volumes) != 1 {
+		// nothing was updated
+		return nil
+	}
+
+	updates, err := resolveUpdates(old, new)
+	if err != nil {
+		if err == ErrNoUpdate {
+			return nil
+		}
+		return err
+	}
+
+	for _, one := range updates {
+		up, err := updaterForStructure(one.to, new.RootDir, rollbackDirPath)
+		if err != nil {
+			return fmt.Errorf("cannot prepare rollback for volume structure %v: %v", one.to, err)
+		}
+		if err := up.Rollback(); err != nil {
+			return fmt.Errorf("cannot rollback volume structure %v: %v", one.to, err)
+		}
+	}
+	return nil
 }
 
 func resolveVolume(old *Info, new *Info) (oldVol, newVol *Volume, err error) {
@@ -1263,3 +1263,70 @@ func (u *updateTestSuite) TestUpdaterMultiVolumesDoesNotError(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(strings.Count(logbuf.String(), "WARNING: gadget assests cannot be updated yet when multiple volumes are used"), Equals, 2)
 }
+
+func (u *updateTestSuite) TestRollbackHappy(c *C) {
+	oldData, newData, rollbackDir := updateDataSet(c)
+	// two structs were updated
+	newData.Info.Volumes["foo"].Structure[0].Update.Edition = 1
+	newData.Info.Volumes["foo"].Structure[2].Update.Edition = 1
+
+	rollbackCalls := make(map[string]bool)
+	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, psRootDir, psRollbackDir string) (gadget.Updater, error) {
+		c.Assert(psRootDir, Equals, newData.RootDir)
+		c.Assert(psRollbackDir, Equals, rollbackDir)
+
+		mu := &mockUpdater{
+			backupCb: func() error {
+				c.Fatalf("unexpected call")
+				return errors.New("not called")
+			},
+			updateCb: func() error {
+				c.Fatalf("unexpected call")
+				return errors.New("not called")
+			},
+			rollbackCb: func() error {
+				rollbackCalls[ps.Name] = true
+				return nil
+			},
+		}
+		return mu, nil
+	})
+	defer restore()
+
+	err := gadget.Rollback(oldData, newData, rollbackDir)
+	c.Assert(err, IsNil)
+	c.Assert(rollbackCalls, DeepEquals, map[string]bool{
+		"first": true,
+		"third": true,
+	})
+}
+
+func (u *updateTestSuite) TestRollbackNothingUpdated(c *C) {
+	oldData, newData, rollbackDir := updateDataSet(c)
+
+	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, psRootDir, psRollbackDir string) (gadget.Updater, error) {
+		c.Fatalf("unexpected call")
+		return &mockUpdater{}, nil
+	})
+	defer restore()
+
+	err := gadget.Rollback(oldData, newData, rollbackDir)
+	c.Assert(err, IsNil)
+}
+
+func (u *updateTestSuite) TestRollbackError(c *C) {
+	oldData, newData, rollbackDir := updateDataSet(c)
+	newData.Info.Volumes["foo"].Structure[1].Update.Edition = 1
+
+	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, psRootDir, psRollbackDir string) (gadget.Updater, error) {
+		return &mockUpdater{
+			rollbackCb: func() error {
+				return errors.New("failed")
+			},
+		}, nil
+	})
+	defer restore()
+
+	err := gadget.Rollback(oldData, newData, rollbackDir)
+	c.Assert(err, ErrorMatches, `cannot rollback volume structure #1 \("second"\): failed`)
+}
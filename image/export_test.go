@@ -20,6 +20,8 @@
 package image
 
 import (
+	"time"
+
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/store"
 )
@@ -32,6 +34,10 @@ var (
 	DecodeModelAssertion = decodeModelAssertion
 	SetupSeed            = setupSeed
 	InstallCloudConfig   = installCloudConfig
+
+	ValidateCustomizations = validateCustomizations
+	CustomAssertions       = customAssertions
+	CustomizeImage         = customizeImage
 )
 
 func (tsto *ToolingStore) User() *auth.UserState {
@@ -50,3 +56,11 @@ var (
 	ErrRevisionAndCohort = errRevisionAndCohort
 	ErrPathInBase        = errPathInBase
 )
+
+func MockTimeNow(f func() time.Time) (restore func()) {
+	old := timeNow
+	timeNow = f
+	return func() {
+		timeNow = old
+	}
+}
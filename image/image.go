@@ -20,6 +20,7 @@
 package image
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -27,6 +28,7 @@ import (
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/asserts/sysdb"
@@ -43,6 +45,8 @@ import (
 var (
 	Stdout io.Writer = os.Stdout
 	Stderr io.Writer = os.Stderr
+
+	timeNow = time.Now
 )
 
 type Options struct {
@@ -58,9 +62,37 @@ type Options struct {
 	RootDir         string
 	GadgetUnpackDir string
 
+	// Label is the label of the recovery system to add to the seed
+	// for Core 20 models, it defaults to the current date
+	Label string
+
 	// Architecture to use if none is specified by the model,
 	// useful only for classic mode. If set must match the model otherwise.
 	Architecture string
+
+	// Customizations to apply to the image.
+	Customizations Customizations
+}
+
+// Customizations holds per-image customizations, they can be given to
+// prepare-image as a JSON file.
+type Customizations struct {
+	// ConsoleConf can be set to "disabled" to disable console-conf on
+	// the first boot of a core image.
+	ConsoleConf string `json:"console-conf,omitempty"`
+	// CloudInitDir is a directory with cloud-init configuration
+	// files to install under /etc/cloud/cloud.cfg.d in the image.
+	CloudInitDir string `json:"cloud-init-dir,omitempty"`
+	// SystemUserFile is a file with a system-user assertion to add to
+	// the seed, for the user to be known to the device from first boot.
+	SystemUserFile string `json:"system-user,omitempty"`
+	// ExtraAssertionsFiles are files with extra assertions to add to
+	// the seed.
+	ExtraAssertionsFiles []string `json:"extra-assertions,omitempty"`
+	// Validation controls whether customizations not allowed by the
+	// model grade are an error ("enforce", the default), or only
+	// produce a warning ("ignore").
+	Validation string `json:"validation,omitempty"`
 }
 
 // classicHasSnaps returns whether the model or options specify any snaps for the classic case
@@ -94,6 +126,10 @@ func Prepare(opts *Options) error {
 		}
 	}
 
+	if err := validateCustomizations(model, &opts.Customizations); err != nil {
+		return err
+	}
+
 	tsto, err := NewToolingStoreFromModel(model, opts.Architecture)
 	if err != nil {
 		return err
@@ -104,7 +140,162 @@ func Prepare(opts *Options) error {
 		return fmt.Errorf("model with series %q != %q unsupported", model.Series(), release.Series)
 	}
 
-	return setupSeed(tsto, model, opts)
+	if err := setupSeed(tsto, model, opts); err != nil {
+		return err
+	}
+
+	return customizeImage(opts.RootDir, &opts.Customizations)
+}
+
+// validateCustomizations checks that the customizations can be applied
+// to an image for the model. Customizations not allowed by the model
+// grade only produce a warning if validation is set to "ignore".
+func validateCustomizations(model *asserts.Model, custo *Customizations) error {
+	switch custo.Validation {
+	case "", "enforce", "ignore":
+		// ok
+	default:
+		return fmt.Errorf("invalid customization validation mode %q", custo.Validation)
+	}
+
+	core20 := model.Grade() != asserts.ModelGradeUnset
+
+	switch custo.ConsoleConf {
+	case "":
+		// nothing to do
+	case "disabled":
+		if model.Classic() {
+			return fmt.Errorf("cannot customize console-conf for a classic model")
+		}
+		if core20 {
+			return fmt.Errorf("cannot customize console-conf for a model with a grade yet")
+		}
+	default:
+		return fmt.Errorf(`invalid console-conf customization %q, only "disabled" is supported`, custo.ConsoleConf)
+	}
+
+	if custo.CloudInitDir != "" && core20 {
+		return fmt.Errorf("cannot customize cloud-init for a model with a grade yet")
+	}
+
+	if core20 && model.Grade() != asserts.ModelDangerous {
+		var kinds []string
+		if custo.SystemUserFile != "" {
+			kinds = append(kinds, "system-user")
+		}
+		if len(custo.ExtraAssertionsFiles) != 0 {
+			kinds = append(kinds, "extra-assertions")
+		}
+		if len(kinds) != 0 {
+			msg := fmt.Sprintf("cannot use %s customization with a model of grade higher than dangerous", strings.Join(kinds, " and "))
+			if custo.Validation != "ignore" {
+				return errors.New(msg)
+			}
+			fmt.Fprintf(Stderr, "WARNING: %s\n", msg)
+		}
+	}
+
+	return nil
+}
+
+func readAssertionsFile(fn string) ([]asserts.Assertion, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read assertions: %v", err)
+	}
+	defer f.Close()
+
+	var as []asserts.Assertion
+	dec := asserts.NewDecoder(f)
+	for {
+		a, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode assertions from %q: %v", fn, err)
+		}
+		as = append(as, a)
+	}
+	return as, nil
+}
+
+// customAssertions returns the assertions from the files given by the
+// customizations, to add to the seed.
+func customAssertions(model *asserts.Model, custo *Customizations) ([]asserts.Assertion, error) {
+	var as []asserts.Assertion
+
+	if custo.SystemUserFile != "" {
+		suAs, err := readAssertionsFile(custo.SystemUserFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(suAs) != 1 || suAs[0].Type() != asserts.SystemUserType {
+			return nil, fmt.Errorf("cannot use %q: it must contain exactly one system-user assertion", custo.SystemUserFile)
+		}
+		su := suAs[0].(*asserts.SystemUser)
+		if su.BrandID() != model.BrandID() {
+			return nil, fmt.Errorf("cannot use system-user assertion for brand %q with a model of brand %q", su.BrandID(), model.BrandID())
+		}
+		if len(su.Models()) != 0 && !strutil.ListContains(su.Models(), model.Model()) {
+			return nil, fmt.Errorf("cannot use system-user assertion not valid for model %q", model.Model())
+		}
+		as = append(as, su)
+	}
+
+	for _, fn := range custo.ExtraAssertionsFiles {
+		extra, err := readAssertionsFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		as = append(as, extra...)
+	}
+
+	return as, nil
+}
+
+// customizeImage applies the customizations that are not about the seed
+// to the image in rootDir.
+func customizeImage(rootDir string, custo *Customizations) error {
+	if custo.CloudInitDir != "" {
+		if err := installCloudInitDir(rootDir, custo.CloudInitDir); err != nil {
+			return err
+		}
+	}
+
+	if custo.ConsoleConf == "disabled" {
+		consoleConfComplete := filepath.Join(rootDir, "/var/lib/console-conf/complete")
+		if err := os.MkdirAll(filepath.Dir(consoleConfComplete), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(consoleConfComplete, []byte("console-conf has been disabled by image customization\n"), 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func installCloudInitDir(rootDir, cloudInitDir string) error {
+	fis, err := ioutil.ReadDir(cloudInitDir)
+	if err != nil {
+		return fmt.Errorf("cannot read cloud-init directory: %v", err)
+	}
+
+	cloudCfgDir := filepath.Join(rootDir, "/etc/cloud/cloud.cfg.d")
+	if err := os.MkdirAll(cloudCfgDir, 0755); err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		src := filepath.Join(cloudInitDir, fi.Name())
+		if err := osutil.CopyFile(src, filepath.Join(cloudCfgDir, fi.Name()), osutil.CopyFlagOverwrite); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // these are postponed, not implemented or abandoned, not finalized,
@@ -191,10 +382,28 @@ func setupSeed(tsto *ToolingStore, model *asserts.Model, opts *Options) error {
 		return err
 	}
 
+	core20 := model.Grade() != asserts.ModelGradeUnset
 	seedDir := dirs.SnapSeedDirUnder(opts.RootDir)
+	var label string
+	if core20 {
+		// the seed is shared by all the recovery systems
+		// added to it, each with its own label
+		seedDir = filepath.Join(opts.RootDir, "system-seed")
+		label = opts.Label
+		if label == "" {
+			label = timeNow().Format("20060102")
+		}
+	}
+	extraAsserts, err := customAssertions(model, &opts.Customizations)
+	if err != nil {
+		return err
+	}
+
 	wOpts := &seedwriter.Options{
-		SeedDir:        seedDir,
-		DefaultChannel: opts.Channel,
+		SeedDir:         seedDir,
+		Label:           label,
+		DefaultChannel:  opts.Channel,
+		ExtraAssertions: extraAsserts,
 
 		TestSkipCopyUnverifiedModel: osutil.GetenvBool("UBUNTU_IMAGE_SKIP_COPY_UNVERIFIED_MODEL"),
 	}
@@ -358,6 +567,17 @@ func setupSeed(tsto *ToolingStore, model *asserts.Model, opts *Options) error {
 		return err
 	}
 
+	if core20 {
+		// TODO: make the recovery system bootable
+		for _, sn := range bootSnaps {
+			if sn.Info.GetType() == snap.TypeGadget {
+				// unpacking the gadget for core models
+				return unpackGadget(sn.Path, opts.GadgetUnpackDir)
+			}
+		}
+		return nil
+	}
+
 	bootWith := &boot.BootableSet{
 		UnpackedGadgetDir: opts.GadgetUnpackDir,
 	}
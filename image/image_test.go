@@ -2281,6 +2281,202 @@ func (s *imageSuite) TestSetupSeedClassicNoSnaps(c *C) {
 	c.Check(osutil.FileExists(blobdir), Equals, false)
 }
 
+func (s *imageSuite) makeSystemUser(c *C, headers map[string]interface{}) *asserts.SystemUser {
+	suHeaders := map[string]interface{}{
+		"authority-id": "my-brand",
+		"brand-id":     "my-brand",
+		"email":        "foo@example.com",
+		"series":       []interface{}{"16"},
+		"models":       []interface{}{"my-model"},
+		"name":         "Foo",
+		"username":     "foo",
+		"password":     "$6$salt$hash",
+		"since":        time.Now().Format(time.RFC3339),
+		"until":        time.Now().Add(24 * 30 * time.Hour).Format(time.RFC3339),
+	}
+	for k, v := range headers {
+		suHeaders[k] = v
+	}
+	su, err := s.Brands.Signing("my-brand").Sign(asserts.SystemUserType, suHeaders, nil, "")
+	c.Assert(err, IsNil)
+	return su.(*asserts.SystemUser)
+}
+
+func (s *imageSuite) TestSetupSeedClassicCustomAssertions(c *C) {
+	restore := image.MockTrusted(s.StoreSigning.Trusted)
+	defer restore()
+
+	model := s.Brands.Model("my-brand", "my-model", map[string]interface{}{
+		"classic": "true",
+	})
+
+	rootdir := filepath.Join(c.MkDir(), "classic-image-root")
+
+	d := c.MkDir()
+	suFile := filepath.Join(d, "system-user.assert")
+	err := ioutil.WriteFile(suFile, asserts.Encode(s.makeSystemUser(c, nil)), 0644)
+	c.Assert(err, IsNil)
+	otherAcct, err := s.StoreSigning.Find(asserts.AccountType, map[string]string{"account-id": "other"})
+	c.Assert(err, IsNil)
+	extraFile := filepath.Join(d, "extra.assert")
+	err = ioutil.WriteFile(extraFile, asserts.Encode(otherAcct), 0644)
+	c.Assert(err, IsNil)
+
+	opts := &image.Options{
+		Classic: true,
+		RootDir: rootdir,
+		Customizations: image.Customizations{
+			SystemUserFile:       suFile,
+			ExtraAssertionsFiles: []string{extraFile},
+		},
+	}
+
+	err = image.SetupSeed(s.tsto, model, opts)
+	c.Assert(err, IsNil)
+
+	seedAssertsDir := filepath.Join(rootdir, "var/lib/snapd/seed/assertions")
+	c.Check(filepath.Join(seedAssertsDir, "my-brand,foo@example.com.system-user"), testutil.FilePresent)
+	c.Check(filepath.Join(seedAssertsDir, "other.account"), testutil.FilePresent)
+}
+
+func (s *imageSuite) TestCustomAssertionsErrors(c *C) {
+	d := c.MkDir()
+	write := func(as ...asserts.Assertion) string {
+		fn := filepath.Join(c.MkDir(), "system-user.assert")
+		var buf bytes.Buffer
+		enc := asserts.NewEncoder(&buf)
+		for _, a := range as {
+			c.Assert(enc.Encode(a), IsNil)
+		}
+		c.Assert(ioutil.WriteFile(fn, buf.Bytes(), 0644), IsNil)
+		return fn
+	}
+
+	tests := []struct {
+		custo *image.Customizations
+		err   string
+	}{
+		{&image.Customizations{SystemUserFile: filepath.Join(d, "missing")}, `cannot read assertions: open .*/missing: no such file or directory`},
+		{&image.Customizations{SystemUserFile: write(s.model)}, `cannot use ".*": it must contain exactly one system-user assertion`},
+		{&image.Customizations{SystemUserFile: write(s.makeSystemUser(c, nil), s.makeSystemUser(c, nil))}, `cannot use ".*": it must contain exactly one system-user assertion`},
+		{&image.Customizations{SystemUserFile: write(s.makeSystemUser(c, map[string]interface{}{
+			"models": []interface{}{"other-model"},
+		}))}, `cannot use system-user assertion not valid for model "my-model"`},
+		{&image.Customizations{ExtraAssertionsFiles: []string{filepath.Join(d, "missing")}}, `cannot read assertions: open .*/missing: no such file or directory`},
+	}
+
+	for _, t := range tests {
+		_, err := image.CustomAssertions(s.model, t.custo)
+		c.Check(err, ErrorMatches, t.err)
+	}
+
+	otherModel := s.Brands.Model("canonical", "my-model", map[string]interface{}{
+		"architecture": "amd64",
+		"gadget":       "pc",
+		"kernel":       "pc-kernel",
+	})
+	_, err := image.CustomAssertions(otherModel, &image.Customizations{SystemUserFile: write(s.makeSystemUser(c, nil))})
+	c.Check(err, ErrorMatches, `cannot use system-user assertion for brand "my-brand" with a model of brand "canonical"`)
+}
+
+func (s *imageSuite) TestValidateCustomizations(c *C) {
+	classicModel := s.Brands.Model("my-brand", "my-model", map[string]interface{}{
+		"classic": "true",
+	})
+	core20Model := func(grade string) *asserts.Model {
+		return s.Brands.Model("my-brand", "my-model", map[string]interface{}{
+			"display-name": "my model",
+			"architecture": "amd64",
+			"base":         "core20",
+			"grade":        grade,
+			"snaps": []interface{}{
+				map[string]interface{}{
+					"name":            "pc-kernel",
+					"id":              s.AssertedSnapID("pc-kernel"),
+					"type":            "kernel",
+					"default-channel": "20",
+				},
+				map[string]interface{}{
+					"name":            "pc20",
+					"id":              s.AssertedSnapID("pc20"),
+					"type":            "gadget",
+					"default-channel": "20",
+				}},
+		})
+	}
+
+	tests := []struct {
+		model *asserts.Model
+		custo image.Customizations
+		err   string
+	}{
+		{s.model, image.Customizations{ConsoleConf: "disabled", CloudInitDir: "/cloud-init", SystemUserFile: "su"}, ""},
+		{s.model, image.Customizations{Validation: "enforce"}, ""},
+		{s.model, image.Customizations{Validation: "foo"}, `invalid customization validation mode "foo"`},
+		{s.model, image.Customizations{ConsoleConf: "enabled"}, `invalid console-conf customization "enabled", only "disabled" is supported`},
+		{classicModel, image.Customizations{ConsoleConf: "disabled"}, `cannot customize console-conf for a classic model`},
+		{classicModel, image.Customizations{CloudInitDir: "/cloud-init", SystemUserFile: "su"}, ""},
+		{core20Model("dangerous"), image.Customizations{SystemUserFile: "su", ExtraAssertionsFiles: []string{"extra"}}, ""},
+		{core20Model("dangerous"), image.Customizations{ConsoleConf: "disabled"}, `cannot customize console-conf for a model with a grade yet`},
+		{core20Model("dangerous"), image.Customizations{CloudInitDir: "/cloud-init"}, `cannot customize cloud-init for a model with a grade yet`},
+		{core20Model("signed"), image.Customizations{SystemUserFile: "su"}, `cannot use system-user customization with a model of grade higher than dangerous`},
+		{core20Model("secured"), image.Customizations{SystemUserFile: "su", ExtraAssertionsFiles: []string{"extra"}}, `cannot use system-user and extra-assertions customization with a model of grade higher than dangerous`},
+		{core20Model("signed"), image.Customizations{SystemUserFile: "su", Validation: "ignore"}, ""},
+	}
+
+	for i, t := range tests {
+		err := image.ValidateCustomizations(t.model, &t.custo)
+		if t.err == "" {
+			c.Check(err, IsNil, Commentf("#%d", i))
+		} else {
+			c.Check(err, ErrorMatches, t.err, Commentf("#%d", i))
+		}
+	}
+	// the grade violation was only warned about when ignoring validation
+	c.Check(s.stderr.String(), Equals, "WARNING: cannot use system-user customization with a model of grade higher than dangerous\n")
+}
+
+func (s *imageSuite) TestCustomizeImage(c *C) {
+	rootdir := c.MkDir()
+	cloudInitDir := c.MkDir()
+	err := ioutil.WriteFile(filepath.Join(cloudInitDir, "50-datasource.cfg"), []byte("datasource_list: [NoCloud]\n"), 0644)
+	c.Assert(err, IsNil)
+	err = ioutil.WriteFile(filepath.Join(cloudInitDir, "60-users.cfg"), []byte("users: []\n"), 0644)
+	c.Assert(err, IsNil)
+	// directories are ignored
+	err = os.Mkdir(filepath.Join(cloudInitDir, "subdir"), 0755)
+	c.Assert(err, IsNil)
+
+	err = image.CustomizeImage(rootdir, &image.Customizations{
+		ConsoleConf:  "disabled",
+		CloudInitDir: cloudInitDir,
+	})
+	c.Assert(err, IsNil)
+
+	cloudCfgDir := filepath.Join(rootdir, "etc/cloud/cloud.cfg.d")
+	c.Check(filepath.Join(cloudCfgDir, "50-datasource.cfg"), testutil.FileEquals, "datasource_list: [NoCloud]\n")
+	c.Check(filepath.Join(cloudCfgDir, "60-users.cfg"), testutil.FileEquals, "users: []\n")
+	c.Check(filepath.Join(cloudCfgDir, "subdir"), testutil.FileAbsent)
+	c.Check(filepath.Join(rootdir, "var/lib/console-conf/complete"), testutil.FilePresent)
+}
+
+func (s *imageSuite) TestCustomizeImageNothing(c *C) {
+	rootdir := c.MkDir()
+
+	err := image.CustomizeImage(rootdir, &image.Customizations{})
+	c.Assert(err, IsNil)
+
+	c.Check(filepath.Join(rootdir, "etc/cloud"), testutil.FileAbsent)
+	c.Check(filepath.Join(rootdir, "var/lib/console-conf"), testutil.FileAbsent)
+}
+
+func (s *imageSuite) TestCustomizeImageCloudInitDirMissing(c *C) {
+	err := image.CustomizeImage(c.MkDir(), &image.Customizations{
+		CloudInitDir: filepath.Join(c.MkDir(), "missing"),
+	})
+	c.Assert(err, ErrorMatches, "cannot read cloud-init directory: open .*/missing: no such file or directory")
+}
+
 func (s *imageSuite) TestSetupSeedClassicSnapdOnlyMissingCore16(c *C) {
 	restore := image.MockTrusted(s.StoreSigning.Trusted)
 	defer restore()
@@ -2397,3 +2593,97 @@ func (s *toolingStoreContextSuite) TestUpdateUserAuth(c *C) {
 	c.Check(u1, Equals, u)
 	c.Check(u1.StoreDischarges, DeepEquals, []string{"discharge2"})
 }
+
+const packageCore20 = `
+name: core20
+version: 20.04
+type: base
+`
+
+const packageGadget20 = `
+name: pc20
+version: 1.0
+type: gadget
+base: core20
+`
+
+func (s *imageSuite) TestSetupSeedCore20(c *C) {
+	restore := image.MockTrusted(s.StoreSigning.Trusted)
+	defer restore()
+	restore = image.MockTimeNow(func() time.Time {
+		return time.Date(2019, 11, 22, 12, 0, 0, 0, time.UTC)
+	})
+	defer restore()
+
+	model := s.Brands.Model("my-brand", "my-model", map[string]interface{}{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"grade":        "signed",
+		"snaps": []interface{}{
+			map[string]interface{}{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]interface{}{
+				"name":            "pc20",
+				"id":              s.AssertedSnapID("pc20"),
+				"type":            "gadget",
+				"default-channel": "20",
+			}},
+	})
+
+	rootdir := filepath.Join(c.MkDir(), "imageroot")
+	gadgetUnpackDir := c.MkDir()
+	s.setupSnaps(c, map[string]string{
+		"pc-kernel": "canonical",
+	})
+	s.MakeAssertedSnap(c, packageCore20, nil, snap.R(20), "canonical")
+	s.MakeAssertedSnap(c, packageGadget20, [][]string{{"grub.conf", ""}}, snap.R(22), "canonical")
+
+	opts := &image.Options{
+		RootDir:         rootdir,
+		GadgetUnpackDir: gadgetUnpackDir,
+	}
+
+	err := image.SetupSeed(s.tsto, model, opts)
+	c.Assert(err, IsNil)
+
+	seedDir := filepath.Join(rootdir, "system-seed")
+	// the label defaults to the current date
+	systemDir := filepath.Join(seedDir, "systems", "20191122")
+	c.Check(filepath.Join(systemDir, "model"), testutil.FileEquals, asserts.Encode(model))
+
+	// check the files are in place in the snaps pool
+	for _, name := range []string{"snapd", "pc-kernel", "core20", "pc20"} {
+		info := s.AssertedSnapInfo(name)
+		p := filepath.Join(seedDir, "snaps", filepath.Base(info.MountFile()))
+		c.Check(p, testutil.FilePresent)
+	}
+
+	// the gadget was unpacked
+	c.Check(filepath.Join(gadgetUnpackDir, "meta/snap.yaml"), testutil.FilePresent)
+
+	// no traditional seed
+	c.Check(filepath.Join(rootdir, "var/lib/snapd/seed"), testutil.FileAbsent)
+
+	// another recovery system can be added to the same seed, reusing
+	// the snaps already in the pool
+	for _, name := range []string{"snapd", "pc-kernel", "core20", "pc20"} {
+		info := s.AssertedSnapInfo(name)
+		sha3_384, size, err := asserts.SnapFileSHA3_384(s.AssertedSnap(name))
+		c.Assert(err, IsNil)
+		info.DownloadInfo.Sha3_384 = sha3_384
+		info.DownloadInfo.Size = int64(size)
+	}
+	opts.Label = "20191123"
+	err = image.SetupSeed(s.tsto, model, opts)
+	c.Assert(err, IsNil)
+	c.Check(filepath.Join(seedDir, "systems", "20191123", "model"), testutil.FilePresent)
+
+	l, err := ioutil.ReadDir(filepath.Join(seedDir, "snaps"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 4)
+}
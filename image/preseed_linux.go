@@ -0,0 +1,143 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package image
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+var (
+	procSelfMountInfo = osutil.ProcSelfMountInfo
+
+	// snapdCommandInChroot returns the command running the snapd of
+	// the chroot, in preseed mode, inside the chroot.
+	snapdCommandInChroot = func(chrootDir string) *exec.Cmd {
+		cmd := exec.Command(filepath.Join(dirs.CoreLibExecDir, "snapd"))
+		cmd.SysProcAttr = &syscall.SysProcAttr{Chroot: chrootDir}
+		cmd.Env = append(os.Environ(), "SNAPD_PRESEED=1")
+		cmd.Dir = "/"
+		return cmd
+	}
+)
+
+// preseedMountpoints are the mountpoints snapd needs inside the
+// chroot to mount snaps and set up security profiles.
+var preseedMountpoints = []string{"/dev", "/proc", "/sys/kernel/security"}
+
+func checkChroot(chrootDir string) error {
+	exists, isDir, err := osutil.DirExists(chrootDir)
+	if err != nil {
+		return fmt.Errorf("cannot verify %q: %v", chrootDir, err)
+	}
+	if !exists || !isDir {
+		return fmt.Errorf("cannot verify %q: is not a directory", chrootDir)
+	}
+
+	entries, err := osutil.LoadMountInfo(procSelfMountInfo)
+	if err != nil {
+		return fmt.Errorf("cannot parse mount info: %v", err)
+	}
+	mounted := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		mounted[entry.MountDir] = true
+	}
+	var missing []string
+	for _, mp := range preseedMountpoints {
+		if p := filepath.Join(chrootDir, mp); !mounted[p] {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("cannot preseed without the following mountpoints:\n - %s", strings.Join(missing, "\n - "))
+	}
+
+	snapdPath := filepath.Join(chrootDir, dirs.CoreLibExecDir, "snapd")
+	if !osutil.FileExists(snapdPath) {
+		return fmt.Errorf("cannot preseed: snapd not found at %s", snapdPath)
+	}
+
+	if osutil.FileExists(dirs.SnapStateFileUnder(chrootDir)) {
+		return fmt.Errorf("the system at %q appears to be preseeded already", chrootDir)
+	}
+
+	return nil
+}
+
+func checkPreseededState(chrootDir string) error {
+	f, err := os.Open(dirs.SnapStateFileUnder(chrootDir))
+	if err != nil {
+		return fmt.Errorf("cannot read the state after preseeding: %v", err)
+	}
+	defer f.Close()
+
+	st, err := state.ReadState(nil, f)
+	if err != nil {
+		return fmt.Errorf("cannot read the state after preseeding: %v", err)
+	}
+	st.Lock()
+	defer st.Unlock()
+
+	for _, chg := range st.Changes() {
+		if chg.Kind() == "seed" && chg.Status() == state.ErrorStatus {
+			return fmt.Errorf("cannot preseed: %v", chg.Err())
+		}
+	}
+
+	var systemKey interface{}
+	if err := st.Get("preseed-system-key", &systemKey); err != nil {
+		if err == state.ErrNoState {
+			return fmt.Errorf("cannot preseed: snapd did not complete preseeding")
+		}
+		return err
+	}
+	return nil
+}
+
+// Preseed runs snapd of the system in the given chroot directory in
+// preseed mode. snapd then performs the steps of first boot seeding
+// that don't need the actual device, such as mounting snaps and
+// setting up security profiles, and leaves the resulting state in the
+// chroot for seeding to resume from on first boot. The hooks of the
+// snaps are not run while preseeding, they run on first boot.
+func Preseed(chrootDir string) error {
+	if err := checkChroot(chrootDir); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(Stdout, "starting to preseed root: %s\n", chrootDir)
+
+	cmd := snapdCommandInChroot(chrootDir)
+	cmd.Stdout = Stdout
+	cmd.Stderr = Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("cannot run snapd in preseed mode: %v", err)
+	}
+
+	return checkPreseededState(chrootDir)
+}
@@ -0,0 +1,162 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+// +build linux
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package image_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/image"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type preseedSuite struct {
+	testutil.BaseTest
+
+	chrootDir string
+	stdout    *bytes.Buffer
+}
+
+var _ = Suite(&preseedSuite{})
+
+func (s *preseedSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+
+	s.chrootDir = c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(s.chrootDir, dirs.CoreLibExecDir), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(s.chrootDir, dirs.CoreLibExecDir, "snapd"), nil, 0755), IsNil)
+
+	s.mockMountInfo(c, "/dev", "/proc", "/sys/kernel/security")
+
+	s.stdout = &bytes.Buffer{}
+	oldStdout := image.Stdout
+	image.Stdout = s.stdout
+	s.AddCleanup(func() { image.Stdout = oldStdout })
+}
+
+func (s *preseedSuite) mockMountInfo(c *C, mountpoints ...string) {
+	var buf bytes.Buffer
+	for i, mp := range mountpoints {
+		fmt.Fprintf(&buf, "%d 1 0:%d / %s rw,relatime - tmpfs tmpfs rw\n", 100+i, i, filepath.Join(s.chrootDir, mp))
+	}
+	mountInfo := filepath.Join(c.MkDir(), "mountinfo")
+	c.Assert(ioutil.WriteFile(mountInfo, buf.Bytes(), 0644), IsNil)
+	s.AddCleanup(image.MockProcSelfMountInfo(mountInfo))
+}
+
+func (s *preseedSuite) writeState(c *C, f func(st *state.State)) {
+	st := state.New(nil)
+	st.Lock()
+	f(st)
+	data, err := json.Marshal(st)
+	st.Unlock()
+	c.Assert(err, IsNil)
+
+	stateFile := dirs.SnapStateFileUnder(s.chrootDir)
+	c.Assert(os.MkdirAll(filepath.Dir(stateFile), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(stateFile, data, 0600), IsNil)
+}
+
+func (s *preseedSuite) TestPreseedHappy(c *C) {
+	var chrootDir string
+	restore := image.MockSnapdCommandInChroot(func(dir string) *exec.Cmd {
+		chrootDir = dir
+		// the real snapd writes the state while preseeding
+		s.writeState(c, func(st *state.State) {
+			chg := st.NewChange("seed", "Seed system")
+			chg.AddTask(st.NewTask("mark-preseeded", "..."))
+			st.Set("preseed-system-key", map[string]interface{}{"build-id": "abcde"})
+		})
+		return exec.Command("true")
+	})
+	defer restore()
+
+	c.Assert(image.Preseed(s.chrootDir), IsNil)
+	c.Check(chrootDir, Equals, s.chrootDir)
+	c.Check(s.stdout.String(), Equals, fmt.Sprintf("starting to preseed root: %s\n", s.chrootDir))
+}
+
+func (s *preseedSuite) TestPreseedSeedingFailed(c *C) {
+	restore := image.MockSnapdCommandInChroot(func(dir string) *exec.Cmd {
+		s.writeState(c, func(st *state.State) {
+			chg := st.NewChange("seed", "Seed system")
+			t := st.NewTask("mark-preseeded", "...")
+			chg.AddTask(t)
+			t.Errorf("boom")
+			t.SetStatus(state.ErrorStatus)
+		})
+		return exec.Command("true")
+	})
+	defer restore()
+
+	c.Check(image.Preseed(s.chrootDir), ErrorMatches, `(?s)cannot preseed: cannot perform the following tasks:.*boom.*`)
+}
+
+func (s *preseedSuite) TestPreseedNotCompleted(c *C) {
+	restore := image.MockSnapdCommandInChroot(func(dir string) *exec.Cmd {
+		s.writeState(c, func(st *state.State) {})
+		return exec.Command("true")
+	})
+	defer restore()
+
+	c.Check(image.Preseed(s.chrootDir), ErrorMatches, `cannot preseed: snapd did not complete preseeding`)
+}
+
+func (s *preseedSuite) TestPreseedSnapdFails(c *C) {
+	restore := image.MockSnapdCommandInChroot(func(dir string) *exec.Cmd {
+		return exec.Command("false")
+	})
+	defer restore()
+
+	c.Check(image.Preseed(s.chrootDir), ErrorMatches, `cannot run snapd in preseed mode: exit status 1`)
+}
+
+func (s *preseedSuite) TestPreseedChecks(c *C) {
+	restore := image.MockSnapdCommandInChroot(func(dir string) *exec.Cmd {
+		c.Fatalf("unexpected call")
+		return nil
+	})
+	defer restore()
+
+	c.Check(image.Preseed(filepath.Join(s.chrootDir, "missing")), ErrorMatches, `cannot verify ".*/missing": is not a directory`)
+
+	s.mockMountInfo(c, "/dev")
+	c.Check(image.Preseed(s.chrootDir), ErrorMatches, fmt.Sprintf(`cannot preseed without the following mountpoints:
+ - %[1]s/proc
+ - %[1]s/sys/kernel/security`, s.chrootDir))
+
+	s.mockMountInfo(c, "/dev", "/proc", "/sys/kernel/security")
+	c.Assert(os.Remove(filepath.Join(s.chrootDir, dirs.CoreLibExecDir, "snapd")), IsNil)
+	c.Check(image.Preseed(s.chrootDir), ErrorMatches, `cannot preseed: snapd not found at .*/usr/lib/snapd/snapd`)
+
+	c.Assert(ioutil.WriteFile(filepath.Join(s.chrootDir, dirs.CoreLibExecDir, "snapd"), nil, 0755), IsNil)
+	s.writeState(c, func(st *state.State) {})
+	c.Check(image.Preseed(s.chrootDir), ErrorMatches, `the system at ".*" appears to be preseeded already`)
+}
@@ -36,6 +36,7 @@ import (
 	"strings"
 
 	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snapdenv"
 )
 
 // ValidateNoAppArmorRegexp will check that the given string does not
@@ -101,6 +102,11 @@ func loadProfiles(fnames []string, cacheDir string, flags aaParserFlags) error {
 	if flags&skipReadCache != 0 {
 		args = append(args, "--skip-read-cache")
 	}
+	if snapdenv.Preseeding() {
+		// the profiles are loaded from the cache on first boot,
+		// they must not end up in the kernel of the build host
+		args = append(args, "--skip-kernel-load")
+	}
 	if !osutil.GetenvBool("SNAPD_DEBUG") {
 		args = append(args, "--quiet")
 	}
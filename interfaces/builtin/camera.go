@@ -19,6 +19,16 @@
 
 package builtin
 
+import (
+	"regexp"
+	"strings"
+
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/hotplug"
+	"github.com/snapcore/snapd/interfaces/udev"
+	"github.com/snapcore/snapd/snap"
+)
+
 const cameraSummary = `allows access to all cameras`
 
 const cameraBaseDeclarationSlots = `
@@ -56,8 +66,38 @@ var cameraConnectedPlugUDev = []string{
 	`KERNEL=="vchiq"`,
 }
 
+// Pattern to match the device nodes of cameras that can be hotplugged
+var cameraDeviceNodePattern = regexp.MustCompile("^/dev/video[0-9]+$")
+
+// cameraInterface is the type for camera interfaces.
+type cameraInterface struct {
+	commonInterface
+}
+
+func (iface *cameraInterface) UDevConnectedPlug(spec *udev.Specification, plug *interfaces.ConnectedPlug, slot *interfaces.ConnectedSlot) error {
+	if tagHotplugSlotDevice(spec, "video4linux", slot) {
+		return nil
+	}
+	return iface.commonInterface.UDevConnectedPlug(spec, plug, slot)
+}
+
+func (iface *cameraInterface) HotplugDeviceDetected(di *hotplug.HotplugDeviceInfo) (*hotplug.ProposedSlot, error) {
+	if di.Subsystem() != "video4linux" || !cameraDeviceNodePattern.MatchString(di.DeviceName()) {
+		return nil, nil
+	}
+	// devices such as the metadata nodes of UVC cameras cannot capture
+	if caps, ok := di.Attribute("ID_V4L_CAPABILITIES"); ok && !strings.Contains(caps, ":capture:") {
+		return nil, nil
+	}
+	return hotplugDeviceSlot(di), nil
+}
+
+func (iface *cameraInterface) HotplugKey(di *hotplug.HotplugDeviceInfo) (snap.HotplugKey, error) {
+	return usbHotplugKey(di)
+}
+
 func init() {
-	registerIface(&commonInterface{
+	registerIface(&cameraInterface{commonInterface{
 		name:                  "camera",
 		summary:               cameraSummary,
 		implicitOnCore:        true,
@@ -66,5 +106,5 @@ func init() {
 		connectedPlugAppArmor: cameraConnectedPlugAppArmor,
 		connectedPlugUDev:     cameraConnectedPlugUDev,
 		reservedForOS:         true,
-	})
+	}})
 }
@@ -0,0 +1,87 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package builtin
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/hotplug"
+	"github.com/snapcore/snapd/interfaces/udev"
+	"github.com/snapcore/snapd/snap"
+)
+
+// hotplugDeviceSlot proposes a slot for the given hotplugged device, with its
+// device node as the path attribute and, for USB devices, the vendor and
+// product identifiers as the usb-vendor and usb-product attributes.
+func hotplugDeviceSlot(di *hotplug.HotplugDeviceInfo) *hotplug.ProposedSlot {
+	slot := hotplug.ProposedSlot{
+		Attrs: map[string]interface{}{
+			"path": di.DeviceName(),
+		},
+	}
+	if vendor, ok := di.Attribute("ID_VENDOR_ID"); ok {
+		slot.Attrs["usb-vendor"] = vendor
+	}
+	if product, ok := di.Attribute("ID_MODEL_ID"); ok {
+		slot.Attrs["usb-product"] = product
+	}
+	return &slot
+}
+
+// usbHotplugKey derives the hotplug key of a USB device from its vendor,
+// product and serial number, and from the number of its USB interface if
+// any, so that the key doesn't change when the device is plugged into a
+// different port. An empty key is returned for devices without a serial
+// number, leaving it to the default key derivation.
+func usbHotplugKey(di *hotplug.HotplugDeviceInfo) (snap.HotplugKey, error) {
+	if bus, _ := di.Attribute("ID_BUS"); bus != "usb" && di.Subsystem() != "usb" {
+		return "", nil
+	}
+	vendor, _ := di.Attribute("ID_VENDOR_ID")
+	product, _ := di.Attribute("ID_MODEL_ID")
+	serial, _ := di.Attribute("ID_SERIAL_SHORT")
+	if vendor == "" || product == "" || serial == "" {
+		return "", nil
+	}
+	ifaceNum, _ := di.Attribute("ID_USB_INTERFACE_NUM")
+
+	key := sha256.New()
+	for _, val := range []string{"usb", vendor, product, serial, ifaceNum} {
+		key.Write([]byte(val))
+		key.Write([]byte{0})
+	}
+	return snap.HotplugKey(fmt.Sprintf("%x", key.Sum(nil))), nil
+}
+
+// tagHotplugSlotDevice tags only the device node of the given slot if it is a
+// hotplug slot of a single device, as opposed to an implicit slot giving
+// access to all the devices of its kind. It returns whether the device got
+// tagged.
+func tagHotplugSlotDevice(spec *udev.Specification, subsystem string, slot *interfaces.ConnectedSlot) bool {
+	var path string
+	if err := slot.Attr("path", &path); err != nil || path == "" {
+		return false
+	}
+	spec.TagDevice(fmt.Sprintf(`SUBSYSTEM=="%s", ENV{DEVNAME}=="%s"`, subsystem, filepath.Clean(path)))
+	return true
+}
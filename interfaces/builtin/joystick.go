@@ -20,8 +20,12 @@
 package builtin
 
 import (
+	"regexp"
+
 	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/hotplug"
 	"github.com/snapcore/snapd/interfaces/udev"
+	"github.com/snapcore/snapd/snap"
 )
 
 const joystickSummary = `allows access to joystick devices`
@@ -91,11 +95,30 @@ type joystickInterface struct {
 	commonInterface
 }
 
+// Pattern to match the device nodes of joysticks that can be hotplugged
+var joystickDeviceNodePattern = regexp.MustCompile("^/dev/input/js([0-9]|[12][0-9]|3[01])$")
+
 func (iface *joystickInterface) UDevConnectedPlug(spec *udev.Specification, plug *interfaces.ConnectedPlug, slot *interfaces.ConnectedSlot) error {
 	spec.TriggerSubsystem("input/joystick")
+	// tagging the hotplugged joystick alone is enough for the device
+	// cgroup to be in effect
+	if tagHotplugSlotDevice(spec, "input", slot) {
+		return nil
+	}
 	return iface.commonInterface.UDevConnectedPlug(spec, plug, slot)
 }
 
+func (iface *joystickInterface) HotplugDeviceDetected(di *hotplug.HotplugDeviceInfo) (*hotplug.ProposedSlot, error) {
+	if di.Subsystem() != "input" || !joystickDeviceNodePattern.MatchString(di.DeviceName()) {
+		return nil, nil
+	}
+	return hotplugDeviceSlot(di), nil
+}
+
+func (iface *joystickInterface) HotplugKey(di *hotplug.HotplugDeviceInfo) (snap.HotplugKey, error) {
+	return usbHotplugKey(di)
+}
+
 func init() {
 	registerIface(&joystickInterface{commonInterface{
 		name:                  "joystick",
@@ -25,6 +25,7 @@ import (
 	"github.com/snapcore/snapd/interfaces"
 	"github.com/snapcore/snapd/interfaces/apparmor"
 	"github.com/snapcore/snapd/interfaces/builtin"
+	"github.com/snapcore/snapd/interfaces/hotplug"
 	"github.com/snapcore/snapd/interfaces/udev"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/testutil"
@@ -107,6 +108,33 @@ func (s *JoystickInterfaceSuite) TestAutoConnect(c *C) {
 	c.Assert(s.iface.AutoConnect(s.plugInfo, s.slotInfo), Equals, true)
 }
 
+func (s *JoystickInterfaceSuite) TestUDevSpecHotplugSlot(c *C) {
+	slotInfo := MockHotplugSlot(c, joystickCoreYaml, nil, "1234", "joystick", "gamepad", map[string]interface{}{"path": "/dev/input/js0"})
+	slot := interfaces.NewConnectedSlot(slotInfo, nil, nil)
+	spec := &udev.Specification{}
+	c.Assert(spec.AddConnectedPlug(s.iface, s.plug, slot), IsNil)
+	c.Assert(spec.Snippets(), HasLen, 2)
+	c.Assert(spec.Snippets(), testutil.Contains, `# joystick
+SUBSYSTEM=="input", ENV{DEVNAME}=="/dev/input/js0", TAG+="snap_consumer_app"`)
+	c.Assert(spec.TriggeredSubsystems(), DeepEquals, []string{"input/joystick"})
+}
+
+func (s *JoystickInterfaceSuite) TestHotplugDeviceDetected(c *C) {
+	hotplugIface := s.iface.(hotplug.Definer)
+	di, err := hotplug.NewHotplugDeviceInfo(map[string]string{"DEVPATH": "/sys/foo/bar", "DEVNAME": "/dev/input/js0", "ID_VENDOR_ID": "045e", "ID_MODEL_ID": "028e", "ACTION": "add", "SUBSYSTEM": "input", "ID_BUS": "usb"})
+	c.Assert(err, IsNil)
+	proposedSlot, err := hotplugIface.HotplugDeviceDetected(di)
+	c.Assert(err, IsNil)
+	c.Assert(proposedSlot, DeepEquals, &hotplug.ProposedSlot{Attrs: map[string]interface{}{"path": "/dev/input/js0", "usb-vendor": "045e", "usb-product": "028e"}})
+
+	// other input devices are ignored
+	di, err = hotplug.NewHotplugDeviceInfo(map[string]string{"DEVPATH": "/sys/foo/bar", "DEVNAME": "/dev/input/mouse0", "ACTION": "add", "SUBSYSTEM": "input"})
+	c.Assert(err, IsNil)
+	proposedSlot, err = hotplugIface.HotplugDeviceDetected(di)
+	c.Assert(err, IsNil)
+	c.Assert(proposedSlot, IsNil)
+}
+
 func (s *JoystickInterfaceSuite) TestInterfaces(c *C) {
 	c.Check(builtin.Interfaces(), testutil.DeepContains, s.iface)
 }
@@ -21,9 +21,12 @@ package builtin
 
 import (
 	"fmt"
+	"regexp"
 
 	"github.com/snapcore/snapd/interfaces"
 	"github.com/snapcore/snapd/interfaces/apparmor"
+	"github.com/snapcore/snapd/interfaces/hotplug"
+	"github.com/snapcore/snapd/interfaces/udev"
 	"github.com/snapcore/snapd/snap"
 )
 
@@ -99,6 +102,28 @@ func (iface *opticalDriveInterface) AppArmorConnectedPlug(spec *apparmor.Specifi
 	return nil
 }
 
+func (iface *opticalDriveInterface) UDevConnectedPlug(spec *udev.Specification, plug *interfaces.ConnectedPlug, slot *interfaces.ConnectedSlot) error {
+	if tagHotplugSlotDevice(spec, "block", slot) {
+		return nil
+	}
+	return iface.commonInterface.UDevConnectedPlug(spec, plug, slot)
+}
+
+// Pattern to match the device nodes of optical drives that can be hotplugged
+var opticalDriveDeviceNodePattern = regexp.MustCompile("^/dev/sr[0-9]+$")
+
+func (iface *opticalDriveInterface) HotplugDeviceDetected(di *hotplug.HotplugDeviceInfo) (*hotplug.ProposedSlot, error) {
+	cdrom, _ := di.Attribute("ID_CDROM")
+	if di.Subsystem() != "block" || cdrom != "1" || !opticalDriveDeviceNodePattern.MatchString(di.DeviceName()) {
+		return nil, nil
+	}
+	return hotplugDeviceSlot(di), nil
+}
+
+func (iface *opticalDriveInterface) HotplugKey(di *hotplug.HotplugDeviceInfo) (snap.HotplugKey, error) {
+	return usbHotplugKey(di)
+}
+
 func init() {
 	registerIface(&opticalDriveInterface{commonInterface: commonInterface{
 		name:                 "optical-drive",
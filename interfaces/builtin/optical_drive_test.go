@@ -25,6 +25,7 @@ import (
 	"github.com/snapcore/snapd/interfaces"
 	"github.com/snapcore/snapd/interfaces/apparmor"
 	"github.com/snapcore/snapd/interfaces/builtin"
+	"github.com/snapcore/snapd/interfaces/hotplug"
 	"github.com/snapcore/snapd/interfaces/udev"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/snaptest"
@@ -159,6 +160,32 @@ func (s *OpticalDriveInterfaceSuite) TestStaticInfo(c *C) {
 	c.Assert(si.BaseDeclarationSlots, testutil.Contains, "optical-drive")
 }
 
+func (s *OpticalDriveInterfaceSuite) TestUDevSpecHotplugSlot(c *C) {
+	slotInfo := MockHotplugSlot(c, opticalDriveCoreYaml, nil, "1234", "optical-drive", "dvd", map[string]interface{}{"path": "/dev/sr1"})
+	slot := interfaces.NewConnectedSlot(slotInfo, nil, nil)
+	spec := &udev.Specification{}
+	c.Assert(spec.AddConnectedPlug(s.iface, s.testPlugReadonly, slot), IsNil)
+	c.Assert(spec.Snippets(), HasLen, 2)
+	c.Assert(spec.Snippets(), testutil.Contains, `# optical-drive
+SUBSYSTEM=="block", ENV{DEVNAME}=="/dev/sr1", TAG+="snap_consumer_app-readonly"`)
+}
+
+func (s *OpticalDriveInterfaceSuite) TestHotplugDeviceDetected(c *C) {
+	hotplugIface := s.iface.(hotplug.Definer)
+	di, err := hotplug.NewHotplugDeviceInfo(map[string]string{"DEVPATH": "/sys/foo/bar", "DEVNAME": "/dev/sr1", "ID_CDROM": "1", "ID_VENDOR_ID": "0e8d", "ID_MODEL_ID": "1956", "ACTION": "add", "SUBSYSTEM": "block", "ID_BUS": "usb"})
+	c.Assert(err, IsNil)
+	proposedSlot, err := hotplugIface.HotplugDeviceDetected(di)
+	c.Assert(err, IsNil)
+	c.Assert(proposedSlot, DeepEquals, &hotplug.ProposedSlot{Attrs: map[string]interface{}{"path": "/dev/sr1", "usb-vendor": "0e8d", "usb-product": "1956"}})
+
+	// other block devices are ignored
+	di, err = hotplug.NewHotplugDeviceInfo(map[string]string{"DEVPATH": "/sys/foo/bar", "DEVNAME": "/dev/sdb", "ACTION": "add", "SUBSYSTEM": "block", "ID_BUS": "usb"})
+	c.Assert(err, IsNil)
+	proposedSlot, err = hotplugIface.HotplugDeviceDetected(di)
+	c.Assert(err, IsNil)
+	c.Assert(proposedSlot, IsNil)
+}
+
 func (s *OpticalDriveInterfaceSuite) TestInterfaces(c *C) {
 	c.Check(builtin.Interfaces(), testutil.DeepContains, s.iface)
 }
@@ -19,6 +19,16 @@
 
 package builtin
 
+import (
+	"regexp"
+	"strings"
+
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/hotplug"
+	"github.com/snapcore/snapd/interfaces/udev"
+	"github.com/snapcore/snapd/snap"
+)
+
 const rawusbSummary = `allows raw access to all USB devices`
 
 const rawusbBaseDeclarationSlots = `
@@ -61,8 +71,38 @@ var rawusbConnectedPlugUDev = []string{
 	`SUBSYSTEM=="tty", ENV{ID_BUS}=="usb"`,
 }
 
+// Pattern to match the device nodes of USB devices that can be hotplugged
+var rawusbDeviceNodePattern = regexp.MustCompile("^/dev/bus/usb/[0-9]{3}/[0-9]{3}$")
+
+// rawusbInterface is the type for raw-usb interfaces.
+type rawusbInterface struct {
+	commonInterface
+}
+
+func (iface *rawusbInterface) UDevConnectedPlug(spec *udev.Specification, plug *interfaces.ConnectedPlug, slot *interfaces.ConnectedSlot) error {
+	if tagHotplugSlotDevice(spec, "usb", slot) {
+		return nil
+	}
+	return iface.commonInterface.UDevConnectedPlug(spec, plug, slot)
+}
+
+func (iface *rawusbInterface) HotplugDeviceDetected(di *hotplug.HotplugDeviceInfo) (*hotplug.ProposedSlot, error) {
+	if di.Subsystem() != "usb" || di.DeviceType() != "usb_device" || !rawusbDeviceNodePattern.MatchString(di.DeviceName()) {
+		return nil, nil
+	}
+	// hubs, including the root hubs, are not interesting on their own
+	if ifaces, ok := di.Attribute("ID_USB_INTERFACES"); ok && strings.HasPrefix(ifaces, ":09") {
+		return nil, nil
+	}
+	return hotplugDeviceSlot(di), nil
+}
+
+func (iface *rawusbInterface) HotplugKey(di *hotplug.HotplugDeviceInfo) (snap.HotplugKey, error) {
+	return usbHotplugKey(di)
+}
+
 func init() {
-	registerIface(&commonInterface{
+	registerIface(&rawusbInterface{commonInterface{
 		name:                  "raw-usb",
 		summary:               rawusbSummary,
 		implicitOnCore:        true,
@@ -72,5 +112,5 @@ func init() {
 		connectedPlugSecComp:  rawusbConnectedPlugSecComp,
 		connectedPlugUDev:     rawusbConnectedPlugUDev,
 		reservedForOS:         true,
-	})
+	}})
 }
@@ -25,6 +25,7 @@ import (
 	"github.com/snapcore/snapd/interfaces"
 	"github.com/snapcore/snapd/interfaces/apparmor"
 	"github.com/snapcore/snapd/interfaces/builtin"
+	"github.com/snapcore/snapd/interfaces/hotplug"
 	"github.com/snapcore/snapd/interfaces/seccomp"
 	"github.com/snapcore/snapd/interfaces/udev"
 	"github.com/snapcore/snapd/snap"
@@ -111,6 +112,41 @@ func (s *RawUsbInterfaceSuite) TestAutoConnect(c *C) {
 	c.Assert(s.iface.AutoConnect(s.plugInfo, s.slotInfo), Equals, true)
 }
 
+func (s *RawUsbInterfaceSuite) TestUDevSpecHotplugSlot(c *C) {
+	slotInfo := MockHotplugSlot(c, rawusbCoreYaml, nil, "1234", "raw-usb", "dongle", map[string]interface{}{"path": "/dev/bus/usb/001/004"})
+	slot := interfaces.NewConnectedSlot(slotInfo, nil, nil)
+	spec := &udev.Specification{}
+	c.Assert(spec.AddConnectedPlug(s.iface, s.plug, slot), IsNil)
+	c.Assert(spec.Snippets(), HasLen, 2)
+	c.Assert(spec.Snippets(), testutil.Contains, `# raw-usb
+SUBSYSTEM=="usb", ENV{DEVNAME}=="/dev/bus/usb/001/004", TAG+="snap_consumer_app"`)
+}
+
+func (s *RawUsbInterfaceSuite) TestHotplugDeviceDetected(c *C) {
+	hotplugIface := s.iface.(hotplug.Definer)
+	di, err := hotplug.NewHotplugDeviceInfo(map[string]string{"DEVPATH": "/sys/foo/bar", "DEVNAME": "/dev/bus/usb/001/004", "DEVTYPE": "usb_device", "ID_VENDOR_ID": "0bda", "ID_MODEL_ID": "2838", "ID_USB_INTERFACES": ":ffffff:", "ACTION": "add", "SUBSYSTEM": "usb"})
+	c.Assert(err, IsNil)
+	proposedSlot, err := hotplugIface.HotplugDeviceDetected(di)
+	c.Assert(err, IsNil)
+	c.Assert(proposedSlot, DeepEquals, &hotplug.ProposedSlot{Attrs: map[string]interface{}{"path": "/dev/bus/usb/001/004", "usb-vendor": "0bda", "usb-product": "2838"}})
+}
+
+func (s *RawUsbInterfaceSuite) TestHotplugDeviceDetectedIgnored(c *C) {
+	hotplugIface := s.iface.(hotplug.Definer)
+	for _, attrs := range []map[string]string{
+		// hub
+		{"DEVPATH": "/sys/foo/bar", "DEVNAME": "/dev/bus/usb/001/001", "DEVTYPE": "usb_device", "ID_USB_INTERFACES": ":090000:", "ACTION": "add", "SUBSYSTEM": "usb"},
+		// interface of a device
+		{"DEVPATH": "/sys/foo/bar", "DEVTYPE": "usb_interface", "ACTION": "add", "SUBSYSTEM": "usb"},
+	} {
+		di, err := hotplug.NewHotplugDeviceInfo(attrs)
+		c.Assert(err, IsNil)
+		proposedSlot, err := hotplugIface.HotplugDeviceDetected(di)
+		c.Assert(err, IsNil)
+		c.Check(proposedSlot, IsNil)
+	}
+}
+
 func (s *RawUsbInterfaceSuite) TestInterfaces(c *C) {
 	c.Check(builtin.Interfaces(), testutil.DeepContains, s.iface)
 }
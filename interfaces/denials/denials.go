@@ -0,0 +1,260 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package denials parses the AppArmor and seccomp denials of snaps
+// found in the kernel or audit log, and finds the interfaces that would
+// permit them.
+package denials
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/snapcore/snapd/dirs"
+)
+
+// Kind is the kind of sandbox that denied an operation.
+type Kind string
+
+const (
+	AppArmor Kind = "apparmor"
+	Seccomp  Kind = "seccomp"
+)
+
+// Denial is a denial of an operation of a snap by its sandbox.
+type Denial struct {
+	Kind Kind
+	// Snap is the instance name of the snap the denied process
+	// belongs to.
+	Snap string
+	// Label is the security tag of the denied process, when known.
+	Label string
+
+	// Operation is the AppArmor operation, e.g. open or capable.
+	Operation string
+	// Path and Mask are the path and the permissions of AppArmor
+	// file denials.
+	Path string
+	Mask string
+	// Capability is the capability of AppArmor capability denials.
+	Capability string
+	// Family and SockType are the socket family and type of AppArmor
+	// network denials.
+	Family   string
+	SockType string
+
+	// Syscall is the name of the system call of seccomp denials, it
+	// is empty when it could not be resolved from SyscallNumber.
+	Syscall       string
+	SyscallNumber int
+	Arch          string
+}
+
+// String returns a short description of the denied operation.
+func (d *Denial) String() string {
+	if d.Kind == Seccomp {
+		if d.Syscall == "" {
+			return fmt.Sprintf("seccomp: syscall %d (%s)", d.SyscallNumber, d.Arch)
+		}
+		return fmt.Sprintf("seccomp: syscall %s", d.Syscall)
+	}
+	switch {
+	case d.Path != "":
+		return fmt.Sprintf("apparmor: %s %q (%s)", d.Operation, d.Path, d.Mask)
+	case d.Capability != "":
+		return fmt.Sprintf("apparmor: capability %s", d.Capability)
+	case d.Family != "":
+		return strings.TrimSpace(fmt.Sprintf("apparmor: network %s %s", d.Family, d.SockType))
+	}
+	return fmt.Sprintf("apparmor: %s", d.Operation)
+}
+
+// parseFields returns the key=value fields of an audit record, values
+// can be quoted.
+func parseFields(line string) map[string]string {
+	fields := make(map[string]string)
+	for len(line) > 0 {
+		line = strings.TrimLeft(line, " ")
+		eq := strings.IndexAny(line, "= ")
+		if eq < 0 {
+			break
+		}
+		if line[eq] == ' ' {
+			// not a field
+			line = line[eq:]
+			continue
+		}
+		key := line[:eq]
+		line = line[eq+1:]
+		var value string
+		if strings.HasPrefix(line, `"`) {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				value, line = line[1:], ""
+			} else {
+				value, line = line[1:end+1], line[end+2:]
+			}
+		} else {
+			end := strings.IndexByte(line, ' ')
+			if end < 0 {
+				value, line = line, ""
+			} else {
+				value, line = line[:end], line[end:]
+			}
+		}
+		fields[key] = value
+	}
+	return fields
+}
+
+// snapFromLabel returns the snap instance name of a security tag, like
+// snap.foo.app or snap-update-ns.foo.
+func snapFromLabel(label string) string {
+	switch {
+	case strings.HasPrefix(label, "snap."):
+		parts := strings.SplitN(label, ".", 3)
+		if len(parts) == 3 {
+			return parts[1]
+		}
+	case strings.HasPrefix(label, "snap-update-ns."):
+		return strings.TrimPrefix(label, "snap-update-ns.")
+	}
+	return ""
+}
+
+// snapFromExe returns the snap instance name of an executable mounted
+// from a snap.
+func snapFromExe(exe string) string {
+	prefix := dirs.SnapMountDir + "/"
+	if !strings.HasPrefix(exe, prefix) {
+		return ""
+	}
+	return strings.SplitN(strings.TrimPrefix(exe, prefix), "/", 2)[0]
+}
+
+// auditArches maps the audit architectures to the ones of libseccomp.
+var auditArches = map[string]string{
+	"c000003e": "x86_64",
+	"40000003": "x86",
+	"c00000b7": "aarch64",
+	"40000028": "arm",
+	"c0000015": "ppc64le",
+	"80000016": "s390x",
+}
+
+var resolveSyscall = func(arch string, nr int) (string, error) {
+	output, err := exec.Command("scmp_sys_resolver", "-a", arch, strconv.Itoa(nr)).Output()
+	if err != nil {
+		return "", err
+	}
+	name := strings.TrimSpace(string(output))
+	if name == "" || strings.HasPrefix(name, "UNKNOWN") {
+		return "", fmt.Errorf("unknown syscall %d", nr)
+	}
+	return name, nil
+}
+
+func parseAppArmorDenial(fields map[string]string) *Denial {
+	label := fields["profile"]
+	snapName := snapFromLabel(label)
+	if snapName == "" {
+		return nil
+	}
+	mask := fields["denied_mask"]
+	if mask == "" {
+		mask = fields["requested_mask"]
+	}
+	return &Denial{
+		Kind:       AppArmor,
+		Snap:       snapName,
+		Label:      label,
+		Operation:  fields["operation"],
+		Path:       fields["name"],
+		Mask:       mask,
+		Capability: fields["capname"],
+		Family:     fields["family"],
+		SockType:   fields["sock_type"],
+	}
+}
+
+func parseSeccompDenial(fields map[string]string) *Denial {
+	// the subject label is followed by the AppArmor mode, e.g.
+	// "snap.foo.app (enforce)"
+	label := strings.SplitN(fields["subj"], " ", 2)[0]
+	snapName := snapFromLabel(label)
+	if snapName == "" {
+		label = ""
+		snapName = snapFromExe(fields["exe"])
+	}
+	if snapName == "" {
+		return nil
+	}
+	nr, err := strconv.Atoi(fields["syscall"])
+	if err != nil {
+		return nil
+	}
+	d := &Denial{
+		Kind:          Seccomp,
+		Snap:          snapName,
+		Label:         label,
+		SyscallNumber: nr,
+		Arch:          fields["arch"],
+	}
+	if arch, ok := auditArches[d.Arch]; ok {
+		d.Arch = arch
+		if name, err := resolveSyscall(arch, nr); err == nil {
+			d.Syscall = name
+		}
+	}
+	return d
+}
+
+// parseLine returns the denial of a snap in the given kernel or audit
+// log line, if any.
+func parseLine(line string) *Denial {
+	switch {
+	case strings.Contains(line, `apparmor="DENIED"`):
+		return parseAppArmorDenial(parseFields(line))
+	case strings.Contains(line, "type=1326") || strings.Contains(line, "type=SECCOMP"):
+		return parseSeccompDenial(parseFields(line))
+	}
+	return nil
+}
+
+// Parse returns the denials of snaps found in the kernel or audit log
+// read from r, in order. Denials of processes that are not part of a
+// snap are ignored.
+func Parse(r io.Reader) ([]*Denial, error) {
+	var denials []*Denial
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		if d := parseLine(scanner.Text()); d != nil {
+			denials = append(denials, d)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return denials, nil
+}
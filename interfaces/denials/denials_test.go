@@ -0,0 +1,146 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package denials_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/interfaces/denials"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type denialsSuite struct {
+	testutil.BaseTest
+}
+
+var _ = Suite(&denialsSuite{})
+
+func (s *denialsSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+
+	dirs.SetRootDir("/")
+	s.AddCleanup(denials.MockResolveSyscall(func(arch string, nr int) (string, error) {
+		if arch == "x86_64" && nr == 165 {
+			return "mount", nil
+		}
+		return "", errors.New("unknown syscall")
+	}))
+}
+
+const kernelLog = `Mar 11 12:00:00 host kernel: [ 12.345] audit: type=1400 audit(1583932800.123:44): apparmor="STATUS" operation="profile_load" profile="unconfined" name="snap.foo.app" pid=100 comm="apparmor_parser"
+Mar 11 12:00:01 host kernel: [ 13.345] audit: type=1400 audit(1583932801.123:45): apparmor="DENIED" operation="open" profile="snap.foo.app" name="/dev/video0" pid=1234 comm="foo" requested_mask="wr" denied_mask="wr" fsuid=0 ouid=0
+Mar 11 12:00:02 host kernel: [ 14.345] audit: type=1400 audit(1583932802.123:46): apparmor="DENIED" operation="capable" profile="snap.bar_instance.hook.configure" pid=1235 comm="bar" capability=12  capname="net_admin"
+Mar 11 12:00:03 host kernel: [ 15.345] audit: type=1400 audit(1583932803.123:47): apparmor="DENIED" operation="create" profile="snap.foo.app" pid=1236 comm="foo" family="netlink" sock_type="raw" protocol=0 requested_mask="create" denied_mask="create"
+Mar 11 12:00:04 host kernel: [ 16.345] audit: type=1400 audit(1583932804.123:48): apparmor="DENIED" operation="open" profile="/usr/sbin/cupsd" name="/etc/shadow" pid=1237 comm="cupsd" requested_mask="r" denied_mask="r" fsuid=0 ouid=0
+Mar 11 12:00:05 host kernel: [ 17.345] audit: type=1326 audit(1583932805.123:49): auid=4294967295 uid=0 gid=0 ses=4294967295 subj=snap.foo.app (enforce) pid=1238 comm="foo" exe="/usr/bin/foo" sig=0 arch=c000003e syscall=165 compat=0 ip=0x7f0a code=0x50000
+Mar 11 12:00:06 host kernel: [ 18.345] audit: type=1326 audit(1583932806.123:50): auid=1000 uid=1000 gid=1000 ses=2 pid=1239 comm="baz" exe="/snap/baz/12/bin/baz" sig=0 arch=c00000b7 syscall=999 compat=0 ip=0x7f0a code=0x50000
+Mar 11 12:00:07 host kernel: [ 19.345] audit: type=1326 audit(1583932807.123:51): auid=1000 uid=1000 gid=1000 ses=2 pid=1240 comm="cat" exe="/usr/bin/cat" sig=0 arch=c000003e syscall=165 compat=0 ip=0x7f0a code=0x50000
+Mar 11 12:00:08 host kernel: [ 20.345] audit: type=1400 audit(1583932808.123:52): apparmor="DENIED" operation="mount" info="failed flags match" error=-13 profile="snap-update-ns.foo" name="/usr/share/foo/" pid=1241 comm="5" flags="rw, bind"
+`
+
+func (s *denialsSuite) TestParse(c *C) {
+	log := strings.Replace(kernelLog, `exe="/snap/`, `exe="`+dirs.SnapMountDir+`/`, -1)
+	ds, err := denials.Parse(strings.NewReader(log))
+	c.Assert(err, IsNil)
+	c.Check(ds, DeepEquals, []*denials.Denial{{
+		Kind:      denials.AppArmor,
+		Snap:      "foo",
+		Label:     "snap.foo.app",
+		Operation: "open",
+		Path:      "/dev/video0",
+		Mask:      "wr",
+	}, {
+		Kind:       denials.AppArmor,
+		Snap:       "bar_instance",
+		Label:      "snap.bar_instance.hook.configure",
+		Operation:  "capable",
+		Capability: "net_admin",
+	}, {
+		Kind:      denials.AppArmor,
+		Snap:      "foo",
+		Label:     "snap.foo.app",
+		Operation: "create",
+		Mask:      "create",
+		Family:    "netlink",
+		SockType:  "raw",
+	}, {
+		Kind:          denials.Seccomp,
+		Snap:          "foo",
+		Label:         "snap.foo.app",
+		Syscall:       "mount",
+		SyscallNumber: 165,
+		Arch:          "x86_64",
+	}, {
+		Kind:          denials.Seccomp,
+		Snap:          "baz",
+		SyscallNumber: 999,
+		Arch:          "aarch64",
+	}, {
+		Kind:      denials.AppArmor,
+		Snap:      "foo",
+		Label:     "snap-update-ns.foo",
+		Operation: "mount",
+		Path:      "/usr/share/foo/",
+	}})
+}
+
+func (s *denialsSuite) TestParseAuditLog(c *C) {
+	auditLog := `type=AVC msg=audit(1583932801.123:45): apparmor="DENIED" operation="open" profile="snap.foo.app" name="/dev/video0" pid=1234 comm="foo" requested_mask="r" denied_mask="r" fsuid=0 ouid=0
+type=SECCOMP msg=audit(1583932805.123:49): auid=4294967295 uid=0 gid=0 ses=4294967295 subj=snap.foo.app (enforce) pid=1238 comm="foo" exe="/usr/bin/foo" sig=0 arch=c000003e syscall=165 compat=0 ip=0x7f0a code=0x50000
+`
+	ds, err := denials.Parse(strings.NewReader(auditLog))
+	c.Assert(err, IsNil)
+	c.Assert(ds, HasLen, 2)
+	c.Check(ds[0].String(), Equals, `apparmor: open "/dev/video0" (r)`)
+	c.Check(ds[1].String(), Equals, `seccomp: syscall mount`)
+}
+
+func (s *denialsSuite) TestString(c *C) {
+	for _, t := range []struct {
+		d   denials.Denial
+		str string
+	}{
+		{denials.Denial{Kind: denials.AppArmor, Operation: "open", Path: "/dev/video0", Mask: "wr"}, `apparmor: open "/dev/video0" (wr)`},
+		{denials.Denial{Kind: denials.AppArmor, Operation: "capable", Capability: "net_admin"}, `apparmor: capability net_admin`},
+		{denials.Denial{Kind: denials.AppArmor, Operation: "create", Family: "netlink", SockType: "raw"}, `apparmor: network netlink raw`},
+		{denials.Denial{Kind: denials.AppArmor, Operation: "create", Family: "inet"}, `apparmor: network inet`},
+		{denials.Denial{Kind: denials.AppArmor, Operation: "dbus_method_call"}, `apparmor: dbus_method_call`},
+		{denials.Denial{Kind: denials.Seccomp, Syscall: "mount", SyscallNumber: 165, Arch: "x86_64"}, `seccomp: syscall mount`},
+		{denials.Denial{Kind: denials.Seccomp, SyscallNumber: 999, Arch: "aarch64"}, `seccomp: syscall 999 (aarch64)`},
+	} {
+		c.Check(t.d.String(), Equals, t.str, Commentf("%v", t.d))
+	}
+}
+
+func (s *denialsSuite) TestParseLongLines(c *C) {
+	long := fmt.Sprintf(`audit: type=1400 audit(1583932801.123:45): apparmor="DENIED" operation="open" profile="snap.foo.app" name="/%s" requested_mask="r"`, strings.Repeat("a", 100000))
+	ds, err := denials.Parse(strings.NewReader(long))
+	c.Assert(err, IsNil)
+	c.Assert(ds, HasLen, 1)
+	c.Check(ds[0].Path, HasLen, 100001)
+}
@@ -0,0 +1,350 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package denials
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/apparmor"
+	"github.com/snapcore/snapd/interfaces/builtin"
+	"github.com/snapcore/snapd/interfaces/seccomp"
+	"github.com/snapcore/snapd/snap"
+)
+
+// appName is the name of the app of the snap the snippets of the
+// interfaces are generated for.
+const appName = "app"
+
+type fileRule struct {
+	path  *regexp.Regexp
+	perms string
+}
+
+type networkRule struct {
+	family   string
+	sockType string
+}
+
+// policy is the part of the AppArmor and seccomp policy of a snap
+// granted by a connected plug of an interface.
+type policy struct {
+	iface string
+
+	files        []fileRule
+	capabilities []string
+	allCaps      bool
+	network      []networkRule
+	syscalls     map[string]bool
+}
+
+// Explainer finds the interfaces that would permit the denials of a
+// snap.
+type Explainer struct {
+	snapName string
+	policies []*policy
+}
+
+// NewExplainer returns an Explainer for the denials of the given snap.
+func NewExplainer(snapName string) *Explainer {
+	return &Explainer{snapName: snapName}
+}
+
+func (e *Explainer) load() error {
+	if e.policies != nil {
+		return nil
+	}
+
+	ifaces := builtin.Interfaces()
+	var plugsYaml, slotsYaml strings.Builder
+	for _, iface := range ifaces {
+		fmt.Fprintf(&plugsYaml, "  %s: null\n", iface.Name())
+		fmt.Fprintf(&slotsYaml, "  %s: null\n", iface.Name())
+	}
+	snapName, instanceKey := snap.SplitInstanceName(e.snapName)
+	plugSnap, err := snap.InfoFromSnapYaml([]byte(fmt.Sprintf("name: %s\nversion: 0\napps:\n  %s:\nplugs:\n%s", snapName, appName, plugsYaml.String())))
+	if err != nil {
+		return err
+	}
+	plugSnap.InstanceKey = instanceKey
+	slotSnap, err := snap.InfoFromSnapYaml([]byte(fmt.Sprintf("name: core\nversion: 0\ntype: os\nslots:\n%s", slotsYaml.String())))
+	if err != nil {
+		return err
+	}
+
+	tag := plugSnap.Apps[appName].SecurityTag()
+	e.policies = make([]*policy, 0, len(ifaces))
+	for _, iface := range ifaces {
+		plugInfo := plugSnap.Plugs[iface.Name()]
+		slotInfo := slotSnap.Slots[iface.Name()]
+		if plugInfo == nil || slotInfo == nil {
+			continue
+		}
+		// interfaces with plugs or slots that are not valid without
+		// attributes, or on the system, are not considered
+		if err := interfaces.BeforePreparePlug(iface, plugInfo); err != nil {
+			continue
+		}
+		if err := interfaces.BeforePrepareSlot(iface, slotInfo); err != nil {
+			continue
+		}
+		plug := interfaces.NewConnectedPlug(plugInfo, nil, nil)
+		slot := interfaces.NewConnectedSlot(slotInfo, nil, nil)
+
+		aaSpec := &apparmor.Specification{}
+		if err := aaSpec.AddConnectedPlug(iface, plug, slot); err != nil {
+			continue
+		}
+		if err := aaSpec.AddPermanentPlug(iface, plugInfo); err != nil {
+			continue
+		}
+		scSpec := &seccomp.Specification{}
+		if err := scSpec.AddConnectedPlug(iface, plug, slot); err != nil {
+			continue
+		}
+		if err := scSpec.AddPermanentPlug(iface, plugInfo); err != nil {
+			continue
+		}
+
+		p := &policy{iface: iface.Name(), syscalls: make(map[string]bool)}
+		p.addAppArmorSnippet(aaSpec.SnippetForTag(tag))
+		p.addSeccompSnippet(scSpec.SnippetForTag(tag))
+		e.policies = append(e.policies, p)
+	}
+	return nil
+}
+
+// AllowingInterfaces returns the names of the interfaces whose
+// connected plugs would permit the denied operation, sorted.
+func (e *Explainer) AllowingInterfaces(d *Denial) ([]string, error) {
+	if err := e.load(); err != nil {
+		return nil, fmt.Errorf("cannot load the policy of the interfaces: %v", err)
+	}
+	var names []string
+	for _, p := range e.policies {
+		if p.allows(d) {
+			names = append(names, p.iface)
+		}
+	}
+	return names, nil
+}
+
+var fileQualifiers = map[string]bool{
+	"audit": true,
+	"owner": true,
+	"allow": true,
+	"file":  true,
+}
+
+func isPath(s string) bool {
+	s = strings.TrimPrefix(s, `"`)
+	return strings.HasPrefix(s, "/") || strings.HasPrefix(s, "@{")
+}
+
+// addAppArmorSnippet adds the single line file, capability and network
+// rules of the snippet to the policy, other rules are ignored.
+func (p *policy) addAppArmorSnippet(snippet string) {
+	for _, line := range strings.Split(snippet, "\n") {
+		if idx := strings.Index(line, " #"); idx >= 0 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if !strings.HasSuffix(line, ",") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens := strings.Fields(strings.TrimSuffix(line, ","))
+		for len(tokens) > 0 && fileQualifiers[tokens[0]] {
+			tokens = tokens[1:]
+		}
+		if len(tokens) == 0 || tokens[0] == "deny" {
+			continue
+		}
+
+		switch tokens[0] {
+		case "capability":
+			if len(tokens) == 1 {
+				p.allCaps = true
+			}
+			p.capabilities = append(p.capabilities, tokens[1:]...)
+			continue
+		case "network":
+			var r networkRule
+			if len(tokens) > 1 {
+				r.family = tokens[1]
+			}
+			if len(tokens) > 2 {
+				r.sockType = tokens[2]
+			}
+			p.network = append(p.network, r)
+			continue
+		}
+
+		if len(tokens) < 2 {
+			continue
+		}
+		path, perms := tokens[0], tokens[1]
+		if !isPath(path) {
+			perms, path = path, perms
+			if !isPath(path) {
+				continue
+			}
+		}
+		re, err := globToRegexp(strings.Trim(path, `"`))
+		if err != nil {
+			continue
+		}
+		p.files = append(p.files, fileRule{path: re, perms: perms})
+	}
+}
+
+// addSeccompSnippet adds the syscalls of the snippet to the policy, the
+// filters on their arguments are ignored.
+func (p *policy) addSeccompSnippet(snippet string) {
+	for _, line := range strings.Split(snippet, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		p.syscalls[fields[0]] = true
+	}
+}
+
+// permsAllow returns whether the AppArmor file permissions allow the
+// requested access mask.
+func permsAllow(perms, mask string) bool {
+	if mask == "" {
+		return false
+	}
+	for _, m := range mask {
+		var ok bool
+		switch m {
+		case 'a':
+			ok = strings.ContainsAny(perms, "aw")
+		case 'c', 'd':
+			// creating and deleting files need write access
+			ok = strings.ContainsRune(perms, 'w')
+		default:
+			ok = strings.ContainsRune(perms, m)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *policy) allows(d *Denial) bool {
+	if d.Kind == Seccomp {
+		return d.Syscall != "" && p.syscalls[d.Syscall]
+	}
+	switch {
+	case d.Path != "":
+		for _, r := range p.files {
+			if r.path.MatchString(d.Path) && permsAllow(r.perms, d.Mask) {
+				return true
+			}
+		}
+	case d.Capability != "":
+		if p.allCaps {
+			return true
+		}
+		for _, c := range p.capabilities {
+			if c == d.Capability {
+				return true
+			}
+		}
+	case d.Family != "":
+		for _, r := range p.network {
+			if (r.family == "" || r.family == d.Family) && (r.sockType == "" || r.sockType == d.SockType) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// aaVariables are the values of the AppArmor variables used in the
+// snippets, any other variable matches a single path component.
+var aaVariables = map[string]string{
+	"PROC":     "/proc",
+	"HOME":     "(/home/[^/]+|/root)",
+	"HOMEDIRS": "/home",
+	"pid":      "[0-9]+",
+	"pids":     "[0-9]+",
+	"tid":      "[0-9]+",
+}
+
+// globToRegexp converts an AppArmor path glob to a regular expression
+// matching the same paths.
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var buf strings.Builder
+	buf.WriteString("^")
+	braces := 0
+	for i := 0; i < len(glob); i++ {
+		ch := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "@{"):
+			end := strings.IndexByte(glob[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated variable in %q", glob)
+			}
+			value, ok := aaVariables[glob[i+2:i+end]]
+			if !ok {
+				value = "[^/]+"
+			}
+			buf.WriteString(value)
+			i += end
+		case strings.HasPrefix(glob[i:], "**"):
+			buf.WriteString(".*")
+			i++
+		case ch == '*':
+			buf.WriteString("[^/]*")
+		case ch == '?':
+			buf.WriteString("[^/]")
+		case ch == '{':
+			braces++
+			buf.WriteString("(")
+		case ch == '}' && braces > 0:
+			braces--
+			buf.WriteString(")")
+		case ch == ',' && braces > 0:
+			buf.WriteString("|")
+		case ch == '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class in %q", glob)
+			}
+			buf.WriteString(glob[i : i+end+1])
+			i += end
+		case ch == '\\' && i+1 < len(glob):
+			i++
+			buf.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	if braces != 0 {
+		return nil, fmt.Errorf("unbalanced braces in %q", glob)
+	}
+	buf.WriteString("$")
+	return regexp.Compile(buf.String())
+}
@@ -0,0 +1,109 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package denials_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/interfaces/denials"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type explainSuite struct{}
+
+var _ = Suite(&explainSuite{})
+
+func (s *explainSuite) TestGlobToRegexp(c *C) {
+	for _, t := range []struct {
+		glob    string
+		matches []string
+		misses  []string
+	}{
+		{"/dev/video[0-9]*", []string{"/dev/video0", "/dev/video12"}, []string{"/dev/videox", "/dev/video0/foo"}},
+		{"@{PROC}/@{pid}/{,task/*/}stat", []string{"/proc/12/stat", "/proc/12/task/3/stat"}, []string{"/proc/self/stat", "/proc/12/x/y/stat"}},
+		{"/sys/devices/**/power_supply/**", []string{"/sys/devices/a/b/power_supply/BAT0/capacity"}, []string{"/sys/class/power_supply/BAT0"}},
+		{"@{HOME}/.config/{foo,bar{,-baz}}/", []string{"/home/user/.config/foo/", "/root/.config/bar-baz/"}, []string{"/home/user/.config/baz/"}},
+		{"/run/@{SNAP_INSTANCE_NAME}/?.sock", []string{"/run/foo/a.sock"}, []string{"/run/foo/bar/a.sock", "/run/foo/ab.sock"}},
+		{`/weird\{path`, []string{"/weird{path"}, nil},
+	} {
+		re, err := denials.GlobToRegexp(t.glob)
+		c.Assert(err, IsNil, Commentf(t.glob))
+		for _, path := range t.matches {
+			c.Check(re.MatchString(path), Equals, true, Commentf("%s %s", t.glob, path))
+		}
+		for _, path := range t.misses {
+			c.Check(re.MatchString(path), Equals, false, Commentf("%s %s", t.glob, path))
+		}
+	}
+}
+
+func (s *explainSuite) TestGlobToRegexpErrors(c *C) {
+	_, err := denials.GlobToRegexp("/foo/@{PROC")
+	c.Check(err, ErrorMatches, `unterminated variable in "/foo/@{PROC"`)
+	_, err = denials.GlobToRegexp("/dev/tty[0-9")
+	c.Check(err, ErrorMatches, `unterminated character class in "/dev/tty\[0-9"`)
+	_, err = denials.GlobToRegexp("/dev/{a,b")
+	c.Check(err, ErrorMatches, `unbalanced braces in "/dev/{a,b"`)
+}
+
+func (s *explainSuite) TestPermsAllow(c *C) {
+	c.Check(denials.PermsAllow("rw", "wr"), Equals, true)
+	c.Check(denials.PermsAllow("r", "r"), Equals, true)
+	c.Check(denials.PermsAllow("r", "w"), Equals, false)
+	c.Check(denials.PermsAllow("rw", "c"), Equals, true)
+	c.Check(denials.PermsAllow("rwk", "a"), Equals, true)
+	c.Check(denials.PermsAllow("ixr", "x"), Equals, true)
+	c.Check(denials.PermsAllow("mr", "x"), Equals, false)
+	c.Check(denials.PermsAllow("rw", ""), Equals, false)
+}
+
+func (s *explainSuite) TestAllowingInterfaces(c *C) {
+	e := denials.NewExplainer("foo")
+
+	names, err := e.AllowingInterfaces(&denials.Denial{Kind: denials.AppArmor, Snap: "foo", Operation: "open", Path: "/dev/video0", Mask: "wr"})
+	c.Assert(err, IsNil)
+	c.Check(names, testutil.DeepContains, "camera")
+	c.Check(names, Not(testutil.DeepContains), "network")
+
+	names, err = e.AllowingInterfaces(&denials.Denial{Kind: denials.AppArmor, Snap: "foo", Operation: "capable", Capability: "net_admin"})
+	c.Assert(err, IsNil)
+	c.Check(names, testutil.DeepContains, "network-control")
+	c.Check(names, Not(testutil.DeepContains), "camera")
+
+	names, err = e.AllowingInterfaces(&denials.Denial{Kind: denials.Seccomp, Snap: "foo", Syscall: "bind"})
+	c.Assert(err, IsNil)
+	c.Check(names, testutil.DeepContains, "network-bind")
+
+	// denials that are not understood are not permitted by anything
+	names, err = e.AllowingInterfaces(&denials.Denial{Kind: denials.Seccomp, Snap: "foo", SyscallNumber: 999})
+	c.Assert(err, IsNil)
+	c.Check(names, HasLen, 0)
+	names, err = e.AllowingInterfaces(&denials.Denial{Kind: denials.AppArmor, Snap: "foo", Operation: "open", Path: "/no/such/thing", Mask: "r"})
+	c.Assert(err, IsNil)
+	c.Check(names, HasLen, 0)
+}
+
+func (s *explainSuite) TestAllowingInterfacesInstance(c *C) {
+	e := denials.NewExplainer("foo_bar")
+
+	names, err := e.AllowingInterfaces(&denials.Denial{Kind: denials.AppArmor, Snap: "foo_bar", Operation: "open", Path: "/dev/video0", Mask: "r"})
+	c.Assert(err, IsNil)
+	c.Check(names, testutil.DeepContains, "camera")
+}
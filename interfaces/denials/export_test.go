@@ -1,7 +1,7 @@
 // -*- Mode: Go; indent-tabs-mode: t -*-
 
 /*
- * Copyright (C) 2019 Canonical Ltd
+ * Copyright (C) 2020 Canonical Ltd
  *
  * This program is free software: you can redistribute it and/or modify
  * it under the terms of the GNU General Public License version 3 as
@@ -16,14 +16,18 @@
  * along with this program.  If not, see <http://www.gnu.org/licenses/>.
  *
  */
-package partition
 
-type LsblkFilesystemInfo = lsblkFilesystemInfo
-type LsblkBlockDevice = lsblkBlockDevice
-type SFDiskPartitionTable = sfdiskPartitionTable
-type SFDiskPartition = sfdiskPartition
+package denials
 
 var (
-	FilesystemInfo     = filesystemInfo
-	BuildPartitionList = buildPartitionList
+	GlobToRegexp = globToRegexp
+	PermsAllow   = permsAllow
 )
+
+func MockResolveSyscall(f func(arch string, nr int) (string, error)) (restore func()) {
+	old := resolveSyscall
+	resolveSyscall = f
+	return func() {
+		resolveSyscall = old
+	}
+}
@@ -944,20 +944,23 @@ func (r *Repository) Interfaces() *Interfaces {
 	return ifaces
 }
 
+func (r *Repository) backend(securitySystem SecuritySystem, snapName string) (SecurityBackend, error) {
+	for _, b := range r.backends {
+		if b.Name() == securitySystem {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot handle interfaces of snap %q, security system %q is not known", snapName, securitySystem)
+}
+
 // SnapSpecification returns the specification of a given snap in a given security system.
 func (r *Repository) SnapSpecification(securitySystem SecuritySystem, snapName string) (Specification, error) {
 	r.m.Lock()
 	defer r.m.Unlock()
 
-	var backend SecurityBackend
-	for _, b := range r.backends {
-		if b.Name() == securitySystem {
-			backend = b
-			break
-		}
-	}
-	if backend == nil {
-		return nil, fmt.Errorf("cannot handle interfaces of snap %q, security system %q is not known", snapName, securitySystem)
+	backend, err := r.backend(securitySystem, snapName)
+	if err != nil {
+		return nil, err
 	}
 
 	spec := backend.NewSpecification()
@@ -989,6 +992,115 @@ func (r *Repository) SnapSpecification(securitySystem SecuritySystem, snapName s
 	return spec, nil
 }
 
+// SpecificationContribution is the part of the specification of a snap
+// contributed by one of its plugs or slots, either on its own or
+// through one of its connections.
+type SpecificationContribution struct {
+	// Kind is one of "permanent-plug", "connected-plug",
+	// "permanent-slot" and "connected-slot", after the method of the
+	// specification the contribution was collected with.
+	Kind      string
+	Interface string
+	// Plug and Slot are the plug and slot involved, only one of them
+	// is set for permanent contributions.
+	Plug *PlugRef
+	Slot *SlotRef
+	Spec Specification
+}
+
+// SnapSpecificationContributions returns the specification of a given
+// snap in a given security system broken down by the plug, slot or
+// connection that contributed each part of it, in a stable order.
+func (r *Repository) SnapSpecificationContributions(securitySystem SecuritySystem, snapName string) ([]*SpecificationContribution, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	backend, err := r.backend(securitySystem, snapName)
+	if err != nil {
+		return nil, err
+	}
+
+	var contributions []*SpecificationContribution
+	contribute := func(kind, iface string, plug *PlugRef, slot *SlotRef, add func(spec Specification) error) error {
+		spec := backend.NewSpecification()
+		if err := add(spec); err != nil {
+			return err
+		}
+		contributions = append(contributions, &SpecificationContribution{
+			Kind:      kind,
+			Interface: iface,
+			Plug:      plug,
+			Slot:      slot,
+			Spec:      spec,
+		})
+		return nil
+	}
+
+	// slot side
+	slots := make([]*snap.SlotInfo, 0, len(r.slots[snapName]))
+	for _, slotInfo := range r.slots[snapName] {
+		slots = append(slots, slotInfo)
+	}
+	sort.Sort(bySlotSnapAndName(slots))
+	for _, slotInfo := range slots {
+		iface := r.ifaces[slotInfo.Interface]
+		slotRef := &SlotRef{Snap: snapName, Name: slotInfo.Name}
+		err := contribute("permanent-slot", iface.Name(), nil, slotRef, func(spec Specification) error {
+			return spec.AddPermanentSlot(iface, slotInfo)
+		})
+		if err != nil {
+			return nil, err
+		}
+		plugs := make([]*snap.PlugInfo, 0, len(r.slotPlugs[slotInfo]))
+		for plugInfo := range r.slotPlugs[slotInfo] {
+			plugs = append(plugs, plugInfo)
+		}
+		sort.Sort(byPlugSnapAndName(plugs))
+		for _, plugInfo := range plugs {
+			conn := r.slotPlugs[slotInfo][plugInfo]
+			plugRef := &PlugRef{Snap: plugInfo.Snap.InstanceName(), Name: plugInfo.Name}
+			err := contribute("connected-slot", iface.Name(), plugRef, slotRef, func(spec Specification) error {
+				return spec.AddConnectedSlot(iface, conn.Plug, conn.Slot)
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	// plug side
+	plugs := make([]*snap.PlugInfo, 0, len(r.plugs[snapName]))
+	for _, plugInfo := range r.plugs[snapName] {
+		plugs = append(plugs, plugInfo)
+	}
+	sort.Sort(byPlugSnapAndName(plugs))
+	for _, plugInfo := range plugs {
+		iface := r.ifaces[plugInfo.Interface]
+		plugRef := &PlugRef{Snap: snapName, Name: plugInfo.Name}
+		err := contribute("permanent-plug", iface.Name(), plugRef, nil, func(spec Specification) error {
+			return spec.AddPermanentPlug(iface, plugInfo)
+		})
+		if err != nil {
+			return nil, err
+		}
+		slots := make([]*snap.SlotInfo, 0, len(r.plugSlots[plugInfo]))
+		for slotInfo := range r.plugSlots[plugInfo] {
+			slots = append(slots, slotInfo)
+		}
+		sort.Sort(bySlotSnapAndName(slots))
+		for _, slotInfo := range slots {
+			conn := r.plugSlots[plugInfo][slotInfo]
+			slotRef := &SlotRef{Snap: slotInfo.Snap.InstanceName(), Name: slotInfo.Name}
+			err := contribute("connected-plug", iface.Name(), plugRef, slotRef, func(spec Specification) error {
+				return spec.AddConnectedPlug(iface, conn.Plug, conn.Slot)
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return contributions, nil
+}
+
 // AddSnap adds plugs and slots declared by the given snap to the repository.
 //
 // This function can be used to implement snap install or, when used along with
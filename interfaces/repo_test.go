@@ -1683,6 +1683,85 @@ func (s *RepositorySuite) TestSnapSpecificationFailureWithPermanentSnippets(c *C
 	c.Assert(spec, IsNil)
 }
 
+func (s *RepositorySuite) TestSnapSpecificationContributions(c *C) {
+	repo := s.emptyRepo
+	backend := &ifacetest.TestSecurityBackend{BackendName: testSecurity}
+	c.Assert(repo.AddBackend(backend), IsNil)
+	c.Assert(repo.AddInterface(testInterface), IsNil)
+	c.Assert(repo.AddPlug(s.plug), IsNil)
+	c.Assert(repo.AddSlot(s.slot), IsNil)
+	c.Assert(repo.AddPlug(s.plugSelf), IsNil)
+	_, err := repo.Connect(NewConnRef(s.plug, s.slot), nil, nil, nil, nil, nil)
+	c.Assert(err, IsNil)
+	_, err = repo.Connect(NewConnRef(s.plugSelf, s.slot), nil, nil, nil, nil, nil)
+	c.Assert(err, IsNil)
+
+	type contribution struct {
+		kind    string
+		plug    string
+		slot    string
+		snippet []string
+	}
+	summary := func(contributions []*SpecificationContribution) []contribution {
+		var result []contribution
+		for _, cont := range contributions {
+			c.Check(cont.Interface, Equals, "interface")
+			x := contribution{
+				kind:    cont.Kind,
+				snippet: cont.Spec.(*ifacetest.Specification).Snippets,
+			}
+			if cont.Plug != nil {
+				x.plug = cont.Plug.String()
+			}
+			if cont.Slot != nil {
+				x.slot = cont.Slot.String()
+			}
+			result = append(result, x)
+		}
+		return result
+	}
+
+	contributions, err := repo.SnapSpecificationContributions(testSecurity, "consumer")
+	c.Assert(err, IsNil)
+	c.Check(summary(contributions), DeepEquals, []contribution{
+		{"permanent-plug", "consumer:plug", "", []string{"static plug snippet"}},
+		{"connected-plug", "consumer:plug", "producer:slot", []string{"connection-specific plug snippet"}},
+	})
+
+	contributions, err = repo.SnapSpecificationContributions(testSecurity, "producer")
+	c.Assert(err, IsNil)
+	c.Check(summary(contributions), DeepEquals, []contribution{
+		{"permanent-slot", "", "producer:slot", []string{"static slot snippet"}},
+		{"connected-slot", "consumer:plug", "producer:slot", []string{"connection-specific slot snippet"}},
+		{"connected-slot", "producer:self", "producer:slot", []string{"connection-specific slot snippet"}},
+		{"permanent-plug", "producer:self", "", []string{"static plug snippet"}},
+		{"connected-plug", "producer:self", "producer:slot", []string{"connection-specific plug snippet"}},
+	})
+}
+
+func (s *RepositorySuite) TestSnapSpecificationContributionsErrors(c *C) {
+	repo := s.emptyRepo
+	_, err := repo.SnapSpecificationContributions(testSecurity, "consumer")
+	c.Assert(err, ErrorMatches, `cannot handle interfaces of snap "consumer", security system "test" is not known`)
+
+	iface := &ifacetest.TestInterface{
+		InterfaceName: "interface",
+		TestConnectedPlugCallback: func(spec *ifacetest.Specification, plug *ConnectedPlug, slot *ConnectedSlot) error {
+			return fmt.Errorf("cannot compute snippet for consumer")
+		},
+	}
+	c.Assert(repo.AddBackend(&ifacetest.TestSecurityBackend{BackendName: testSecurity}), IsNil)
+	c.Assert(repo.AddInterface(iface), IsNil)
+	c.Assert(repo.AddPlug(s.plug), IsNil)
+	c.Assert(repo.AddSlot(s.slot), IsNil)
+	_, err = repo.Connect(NewConnRef(s.plug, s.slot), nil, nil, nil, nil, nil)
+	c.Assert(err, IsNil)
+
+	contributions, err := repo.SnapSpecificationContributions(testSecurity, "consumer")
+	c.Assert(err, ErrorMatches, "cannot compute snippet for consumer")
+	c.Check(contributions, IsNil)
+}
+
 func (s *RepositorySuite) TestAutoConnectCandidatePlugsAndSlots(c *C) {
 	// Add two interfaces, one with automatic connections, one with manual
 	repo := s.emptyRepo
@@ -22,6 +22,8 @@ package interfaces
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -212,17 +214,10 @@ func SystemKeyMismatch() (bool, error) {
 		return false, err
 	}
 
-	raw, err := ioutil.ReadFile(dirs.SnapSystemKeyFile)
-	if err != nil && os.IsNotExist(err) {
-		return false, ErrSystemKeyMissing
-	}
+	diskSystemKey, err := readSystemKey()
 	if err != nil {
 		return false, err
 	}
-	var diskSystemKey systemKey
-	if err := json.Unmarshal(raw, &diskSystemKey); err != nil {
-		return false, err
-	}
 	// deal with the race that "snap run" may start, then snapd
 	// is upgraded and generates a new system-key with different
 	// inputs than the "snap run" in memory. In this case we
@@ -251,7 +246,69 @@ func SystemKeyMismatch() (bool, error) {
 	mySystemKey.AppArmorParserFeatures = nil
 
 	// TODO: write custom struct compare
-	return !reflect.DeepEqual(mySystemKey, &diskSystemKey), nil
+	return !reflect.DeepEqual(mySystemKey, diskSystemKey), nil
+}
+
+func readSystemKey() (*systemKey, error) {
+	raw, err := ioutil.ReadFile(dirs.SnapSystemKeyFile)
+	if err != nil && os.IsNotExist(err) {
+		return nil, ErrSystemKeyMissing
+	}
+	if err != nil {
+		return nil, err
+	}
+	var diskSystemKey systemKey
+	if err := json.Unmarshal(raw, &diskSystemKey); err != nil {
+		return nil, err
+	}
+	return &diskSystemKey, nil
+}
+
+// RecordedSystemKey returns the system key read from the disk as
+// an opaque value, to be compared with SystemKeysMatch.
+func RecordedSystemKey() (interface{}, error) {
+	return readSystemKey()
+}
+
+// CurrentSystemKey calculates and returns the current system key as
+// an opaque value, to be compared with SystemKeysMatch.
+func CurrentSystemKey() (interface{}, error) {
+	return generateSystemKey()
+}
+
+// UnmarshalJSONSystemKey reads a system key previously serialized
+// to JSON, e.g. as part of the state, back into an opaque value.
+func UnmarshalJSONSystemKey(r io.Reader) (interface{}, error) {
+	var sk systemKey
+	if err := json.NewDecoder(r).Decode(&sk); err != nil {
+		return nil, err
+	}
+	return &sk, nil
+}
+
+// SystemKeysMatch returns whether the given system keys, as returned by
+// RecordedSystemKey, CurrentSystemKey or UnmarshalJSONSystemKey, match.
+// As with SystemKeyMismatch the apparmor-parser-features are not
+// compared.
+func SystemKeysMatch(systemKey1, systemKey2 interface{}) (bool, error) {
+	sk1, ok := systemKey1.(*systemKey)
+	if !ok {
+		return false, fmt.Errorf("internal error: unexpected system key type %T", systemKey1)
+	}
+	sk2, ok := systemKey2.(*systemKey)
+	if !ok {
+		return false, fmt.Errorf("internal error: unexpected system key type %T", systemKey2)
+	}
+	if sk1.Version != sk2.Version {
+		return false, ErrSystemKeyVersion
+	}
+
+	// copy to not affect the given keys
+	sk1c := *sk1
+	sk2c := *sk2
+	sk1c.AppArmorParserFeatures = nil
+	sk2c.AppArmorParserFeatures = nil
+	return reflect.DeepEqual(sk1c, sk2c), nil
 }
 
 func MockSystemKey(s string) func() {
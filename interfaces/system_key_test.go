@@ -243,6 +243,65 @@ func (s *systemKeySuite) TestInterfaceSystemKeyMismatchVersions(c *C) {
 	c.Assert(err, Equals, interfaces.ErrSystemKeyVersion)
 }
 
+func (s *systemKeySuite) TestRecordedSystemKeyMatchesCurrent(c *C) {
+	s.AddCleanup(interfaces.MockSystemKey(`
+{
+"build-id": "7a94e9736c091b3984bd63f5aebfc883c4d859e0",
+"apparmor-features": ["caps", "dbus"]
+}
+`))
+
+	_, err := interfaces.RecordedSystemKey()
+	c.Assert(err, Equals, interfaces.ErrSystemKeyMissing)
+
+	c.Assert(interfaces.WriteSystemKey(), IsNil)
+	recorded, err := interfaces.RecordedSystemKey()
+	c.Assert(err, IsNil)
+	current, err := interfaces.CurrentSystemKey()
+	c.Assert(err, IsNil)
+
+	ok, err := interfaces.SystemKeysMatch(recorded, current)
+	c.Assert(err, IsNil)
+	c.Check(ok, Equals, true)
+
+	// the recorded key survives a round trip through JSON
+	data, err := json.Marshal(recorded)
+	c.Assert(err, IsNil)
+	unmarshalled, err := interfaces.UnmarshalJSONSystemKey(strings.NewReader(string(data)))
+	c.Assert(err, IsNil)
+	ok, err = interfaces.SystemKeysMatch(unmarshalled, current)
+	c.Assert(err, IsNil)
+	c.Check(ok, Equals, true)
+
+	s.AddCleanup(interfaces.MockSystemKey(`
+{
+"build-id": "7a94e9736c091b3984bd63f5aebfc883c4d859e0",
+"apparmor-features": ["caps", "dbus", "more"]
+}
+`))
+	current, err = interfaces.CurrentSystemKey()
+	c.Assert(err, IsNil)
+	ok, err = interfaces.SystemKeysMatch(recorded, current)
+	c.Assert(err, IsNil)
+	c.Check(ok, Equals, false)
+}
+
+func (s *systemKeySuite) TestSystemKeysMatchErrors(c *C) {
+	sk1, err := interfaces.UnmarshalJSONSystemKey(strings.NewReader(`{"version":1}`))
+	c.Assert(err, IsNil)
+	sk2, err := interfaces.UnmarshalJSONSystemKey(strings.NewReader(`{"version":2}`))
+	c.Assert(err, IsNil)
+
+	_, err = interfaces.SystemKeysMatch(sk1, sk2)
+	c.Check(err, Equals, interfaces.ErrSystemKeyVersion)
+
+	_, err = interfaces.SystemKeysMatch(sk1, "foo")
+	c.Check(err, ErrorMatches, `internal error: unexpected system key type string`)
+
+	_, err = interfaces.UnmarshalJSONSystemKey(strings.NewReader(`{`))
+	c.Check(err, NotNil)
+}
+
 func (s *systemKeySuite) TestStaticVersion(c *C) {
 	// this is a static check to ensure we remember to bump the
 	// version when we add fields
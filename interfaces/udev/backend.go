@@ -36,6 +36,7 @@ import (
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/sandbox/cgroup"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snapdenv"
 	"github.com/snapcore/snapd/timings"
 )
 
@@ -52,6 +53,15 @@ func (b *Backend) Name() interfaces.SecuritySystem {
 	return interfaces.SecurityUDev
 }
 
+// reloadRules reloads the udev rules unless preseeding, in which
+// case udevd is not running and the rules are read on first boot.
+func (b *Backend) reloadRules(subsystemTriggers []string) error {
+	if snapdenv.Preseeding() {
+		return nil
+	}
+	return ReloadRules(subsystemTriggers)
+}
+
 // snapRulesFileName returns the path of the snap udev rules file.
 func snapRulesFilePath(snapName string) string {
 	rulesFileName := fmt.Sprintf("70-%s.rules", snap.SecurityTag(snapName))
@@ -90,7 +100,7 @@ func (b *Backend) Setup(snapInfo *snap.Info, opts interfaces.ConfinementOptions,
 			// FIXME: somehow detect the interfaces that were
 			// disconnected and set subsystemTriggers appropriately.
 			// ATM, it is always going to be empty on disconnect.
-			return ReloadRules(subsystemTriggers)
+			return b.reloadRules(subsystemTriggers)
 		}
 		return nil
 	}
@@ -127,7 +137,7 @@ func (b *Backend) Setup(snapInfo *snap.Info, opts interfaces.ConfinementOptions,
 	// FIXME: somehow detect the interfaces that were disconnected and set
 	// subsystemTriggers appropriately. ATM, it is always going to be empty
 	// on disconnect.
-	return ReloadRules(subsystemTriggers)
+	return b.reloadRules(subsystemTriggers)
 }
 
 // Remove removes udev rules specific to a given snap.
@@ -149,7 +159,7 @@ func (b *Backend) Remove(snapName string) error {
 	// FIXME: somehow detect the interfaces that were disconnected and set
 	// subsystemTriggers appropriately. ATM, it is always going to be empty
 	// on disconnect.
-	return ReloadRules(nil)
+	return b.reloadRules(nil)
 }
 
 func (b *Backend) deriveContent(spec *Specification, snapInfo *snap.Info) (content []string) {
@@ -32,6 +32,7 @@ import (
 	"github.com/snapcore/snapd/interfaces/udev"
 	"github.com/snapcore/snapd/sandbox/cgroup"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snapdenv"
 	"github.com/snapcore/snapd/testutil"
 	"github.com/snapcore/snapd/timings"
 )
@@ -114,6 +115,23 @@ func (s *backendSuite) TestInstallingSnapWritesAndLoadsRules(c *C) {
 	}
 }
 
+func (s *backendSuite) TestInstallingSnapWritesRulesPreseeding(c *C) {
+	restore := snapdenv.MockPreseeding(true)
+	defer restore()
+
+	s.Iface.UDevPermanentSlotCallback = func(spec *udev.Specification, slot *snap.SlotInfo) error {
+		spec.AddSnippet("dummy")
+		return nil
+	}
+	snapInfo := s.InstallSnap(c, interfaces.ConfinementOptions{}, "", ifacetest.SambaYamlV1, 0)
+	fname := filepath.Join(dirs.SnapUdevRulesDir, "70-snap.samba.rules")
+	c.Check(fname, testutil.FilePresent)
+	// udevd is not running, the rules are not reloaded
+	c.Check(s.udevadmCmd.Calls(), HasLen, 0)
+	s.RemoveSnap(c, snapInfo)
+	c.Check(s.udevadmCmd.Calls(), HasLen, 0)
+}
+
 func (s *backendSuite) TestInstallingSnapWithHookWritesAndLoadsRules(c *C) {
 	// NOTE: Hand out a permanent snippet so that .rules file is generated.
 	s.Iface.UDevPermanentSlotCallback = func(spec *udev.Specification, slot *snap.SlotInfo) error {
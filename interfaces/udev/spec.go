@@ -127,6 +127,27 @@ func (spec *Specification) Snippets() (result []string) {
 	return result
 }
 
+// SnippetsForTag returns the snippets that apply to the given security
+// tag, including those that are not specific to any app or hook.
+func (spec *Specification) SnippetsForTag(securityTag string) (result []string) {
+	if spec.ControlsDeviceCgroup() {
+		return nil
+	}
+	tag := udevTag(securityTag)
+	entries := make([]entry, 0, len(spec.entries))
+	for _, entry := range spec.entries {
+		if entry.tag == "" || entry.tag == tag {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Sort(byTagAndSnippet(entries))
+
+	for _, entry := range entries {
+		result = append(result, entry.snippet)
+	}
+	return result
+}
+
 // Implementation of methods required by interfaces.Specification
 
 // AddConnectedPlug records udev-specific side-effects of having a connected plug.
@@ -129,6 +129,29 @@ kernel="hoodoo", TAG+="snap_snap1_hook_configure"`,
 	})
 }
 
+func (s *specSuite) TestSnippetsForTag(c *C) {
+	iface := &ifacetest.TestInterface{
+		InterfaceName: "iface-1",
+		UDevConnectedPlugCallback: func(spec *udev.Specification, plug *interfaces.ConnectedPlug, slot *interfaces.ConnectedSlot) error {
+			spec.TagDevice(`kernel="voodoo"`)
+			spec.AddSnippet("# untagged")
+			return nil
+		},
+	}
+	c.Assert(s.spec.AddConnectedPlug(iface, s.plug, s.slot), IsNil)
+
+	c.Assert(s.spec.SnippetsForTag("snap.snap1.foo"), DeepEquals, []string{
+		"# untagged",
+		`# iface-1
+kernel="voodoo", TAG+="snap_snap1_foo"`,
+		`TAG=="snap_snap1_foo", RUN+="/usr/lib/snapd/snap-device-helper $env{ACTION} snap_snap1_foo $devpath $major:$minor"`,
+	})
+	c.Assert(s.spec.SnippetsForTag("snap.snap1.bar"), DeepEquals, []string{"# untagged"})
+
+	s.spec.SetControlsDeviceCgroup()
+	c.Assert(s.spec.SnippetsForTag("snap.snap1.foo"), IsNil)
+}
+
 // The spec.Specification can be used through the interfaces.Specification interface
 func (s *specSuite) TestSpecificationIface(c *C) {
 	var r interfaces.Specification = s.spec
@@ -0,0 +1,408 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package metrics implements simple counters, gauges and histograms
+// that can be exposed in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the text exposition format written
+// by Registry.WriteText.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets are the default histogram buckets, in seconds, suited
+// for things that usually take well under a second.
+var DefBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metric interface {
+	write(buf *bytes.Buffer)
+}
+
+// Registry holds a set of named metrics.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+// NewRegistry returns a new empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+// Default is the registry the package level constructors register
+// their metrics in.
+var Default = NewRegistry()
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[name]; ok {
+		panic(fmt.Sprintf("internal error: metric %q already registered", name))
+	}
+	r.metrics[name] = m
+}
+
+// WriteText writes all the metrics in the registry, sorted by name,
+// in the Prometheus text exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	metrics := make([]metric, len(names))
+	for i, name := range names {
+		metrics[i] = r.metrics[name]
+	}
+	r.mu.Unlock()
+
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		m.write(&buf)
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// WriteText writes the metrics in the Default registry.
+func WriteText(w io.Writer) error {
+	return Default.WriteText(w)
+}
+
+type series struct {
+	labelValues []string
+
+	value float64
+	// histograms only
+	counts []uint64
+	count  uint64
+}
+
+// vec is the set of series of a metric, one per combination of label
+// values.
+type vec struct {
+	name       string
+	help       string
+	typ        string
+	labelNames []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func newVec(name, help, typ string, labelNames []string) vec {
+	return vec{
+		name:       name,
+		help:       help,
+		typ:        typ,
+		labelNames: labelNames,
+		series:     make(map[string]*series),
+	}
+}
+
+// get returns the series for the given label values, creating it if
+// needed. It must be called with the lock held.
+func (v *vec) get(labelValues []string) *series {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("internal error: metric %q expects %d label values, got %d", v.name, len(v.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s := v.series[key]
+	if s == nil {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+// sorted returns the series sorted by label values. It must be called
+// with the lock held.
+func (v *vec) sorted() []*series {
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	sorted := make([]*series, len(keys))
+	for i, key := range keys {
+		sorted[i] = v.series[key]
+	}
+	return sorted
+}
+
+func (v *vec) writeHeader(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(buf, "# TYPE %s %s\n", v.name, v.typ)
+}
+
+func (v *vec) writeSample(buf *bytes.Buffer, suffix string, labelValues []string, extraName, extraValue string, value float64) {
+	buf.WriteString(v.name)
+	buf.WriteString(suffix)
+	if len(labelValues) > 0 || extraName != "" {
+		buf.WriteByte('{')
+		for i, labelValue := range labelValues {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(buf, "%s=\"%s\"", v.labelNames[i], escapeLabelValue(labelValue))
+		}
+		if extraName != "" {
+			if len(labelValues) > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(buf, "%s=\"%s\"", extraName, extraValue)
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(formatFloat(value))
+	buf.WriteByte('\n')
+}
+
+func (v *vec) write(buf *bytes.Buffer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.series) == 0 {
+		return
+	}
+	v.writeHeader(buf)
+	for _, s := range v.sorted() {
+		v.writeSample(buf, "", s.labelValues, "", "", s.value)
+	}
+}
+
+// Counter is a metric that can only go up.
+type Counter struct {
+	vec
+}
+
+// NewCounter returns a new Counter with the given label names,
+// registered in the registry.
+func (r *Registry) NewCounter(name, help string, labelNames ...string) *Counter {
+	c := &Counter{vec: newVec(name, help, "counter", labelNames)}
+	if len(labelNames) == 0 {
+		c.get(nil)
+	}
+	r.register(name, c)
+	return c
+}
+
+// NewCounter returns a new Counter registered in the Default registry.
+func NewCounter(name, help string, labelNames ...string) *Counter {
+	return Default.NewCounter(name, help, labelNames...)
+}
+
+// Inc increments by one the counter with the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds the given non-negative value to the counter with the given
+// label values.
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		panic(fmt.Sprintf("internal error: cannot decrease counter %q", c.name))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.get(labelValues).value += value
+}
+
+// Gauge is a metric that can go up and down.
+type Gauge struct {
+	vec
+}
+
+// NewGauge returns a new Gauge with the given label names, registered
+// in the registry.
+func (r *Registry) NewGauge(name, help string, labelNames ...string) *Gauge {
+	g := &Gauge{vec: newVec(name, help, "gauge", labelNames)}
+	if len(labelNames) == 0 {
+		g.get(nil)
+	}
+	r.register(name, g)
+	return g
+}
+
+// NewGauge returns a new Gauge registered in the Default registry.
+func NewGauge(name, help string, labelNames ...string) *Gauge {
+	return Default.NewGauge(name, help, labelNames...)
+}
+
+// Set sets the gauge with the given label values to the given value.
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.get(labelValues).value = value
+}
+
+// Add adds the given, possibly negative, value to the gauge with the
+// given label values.
+func (g *Gauge) Add(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.get(labelValues).value += value
+}
+
+// GaugeFunc is a gauge without labels whose value is obtained by
+// calling a function when the metrics are written.
+type GaugeFunc struct {
+	vec
+
+	fmu sync.Mutex
+	f   func() float64
+}
+
+// NewGaugeFunc returns a new GaugeFunc registered in the registry. It
+// is not written out until SetFunc is called.
+func (r *Registry) NewGaugeFunc(name, help string) *GaugeFunc {
+	g := &GaugeFunc{vec: newVec(name, help, "gauge", nil)}
+	r.register(name, g)
+	return g
+}
+
+// NewGaugeFunc returns a new GaugeFunc registered in the Default
+// registry.
+func NewGaugeFunc(name, help string) *GaugeFunc {
+	return Default.NewGaugeFunc(name, help)
+}
+
+// SetFunc sets the function that gives the value of the gauge. A nil
+// function unsets it.
+func (g *GaugeFunc) SetFunc(f func() float64) {
+	g.fmu.Lock()
+	defer g.fmu.Unlock()
+	g.f = f
+}
+
+func (g *GaugeFunc) write(buf *bytes.Buffer) {
+	g.fmu.Lock()
+	f := g.f
+	g.fmu.Unlock()
+	if f == nil {
+		return
+	}
+	g.writeHeader(buf)
+	g.writeSample(buf, "", nil, "", "", f())
+}
+
+// Histogram is a metric that counts observations in buckets.
+type Histogram struct {
+	vec
+	buckets []float64
+}
+
+// NewHistogram returns a new Histogram with the given upper bounds for
+// its buckets, in increasing order, and label names, registered in the
+// registry.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("internal error: buckets of histogram %q are not sorted", name))
+	}
+	h := &Histogram{
+		vec:     newVec(name, help, "histogram", labelNames),
+		buckets: buckets,
+	}
+	if len(labelNames) == 0 {
+		h.get(nil)
+	}
+	r.register(name, h)
+	return h
+}
+
+// NewHistogram returns a new Histogram registered in the Default
+// registry.
+func NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	return Default.NewHistogram(name, help, buckets, labelNames...)
+}
+
+// Observe adds an observation of the given value to the histogram with
+// the given label values.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.get(labelValues)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += value
+}
+
+func (h *Histogram) write(buf *bytes.Buffer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.series) == 0 {
+		return
+	}
+	h.writeHeader(buf)
+	for _, s := range h.sorted() {
+		for i, bound := range h.buckets {
+			var count uint64
+			if s.counts != nil {
+				count = s.counts[i]
+			}
+			h.writeSample(buf, "_bucket", s.labelValues, "le", formatFloat(bound), float64(count))
+		}
+		h.writeSample(buf, "_bucket", s.labelValues, "le", "+Inf", float64(s.count))
+		h.writeSample(buf, "_sum", s.labelValues, "", "", s.value)
+		h.writeSample(buf, "_count", s.labelValues, "", "", float64(s.count))
+	}
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}
@@ -0,0 +1,161 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package metrics_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/metrics"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type metricsSuite struct {
+	reg *metrics.Registry
+}
+
+var _ = Suite(&metricsSuite{})
+
+func (s *metricsSuite) SetUpTest(c *C) {
+	s.reg = metrics.NewRegistry()
+}
+
+func (s *metricsSuite) text(c *C) string {
+	var buf bytes.Buffer
+	c.Assert(s.reg.WriteText(&buf), IsNil)
+	return buf.String()
+}
+
+func (s *metricsSuite) TestEmpty(c *C) {
+	c.Check(s.text(c), Equals, "")
+}
+
+func (s *metricsSuite) TestCounter(c *C) {
+	plain := s.reg.NewCounter("plain_total", "A plain counter.")
+	labelled := s.reg.NewCounter("labelled_total", "A counter\nwith labels.", "method", "code")
+
+	c.Check(s.text(c), Equals, `# HELP plain_total A plain counter.
+# TYPE plain_total counter
+plain_total 0
+`)
+
+	plain.Inc()
+	plain.Add(1.5)
+	labelled.Inc("GET", "200")
+	labelled.Inc("GET", "200")
+	labelled.Inc("POST", "500")
+	labelled.Add(3, "GET", "404")
+
+	c.Check(s.text(c), Equals, `# HELP labelled_total A counter\nwith labels.
+# TYPE labelled_total counter
+labelled_total{method="GET",code="200"} 2
+labelled_total{method="GET",code="404"} 3
+labelled_total{method="POST",code="500"} 1
+# HELP plain_total A plain counter.
+# TYPE plain_total counter
+plain_total 2.5
+`)
+}
+
+func (s *metricsSuite) TestCounterCannotDecrease(c *C) {
+	counter := s.reg.NewCounter("foo_total", "Foo.")
+	c.Check(func() { counter.Add(-1) }, PanicMatches, `internal error: cannot decrease counter "foo_total"`)
+}
+
+func (s *metricsSuite) TestWrongLabelCount(c *C) {
+	counter := s.reg.NewCounter("foo_total", "Foo.", "kind")
+	c.Check(func() { counter.Inc() }, PanicMatches, `internal error: metric "foo_total" expects 1 label values, got 0`)
+	c.Check(func() { counter.Inc("a", "b") }, PanicMatches, `internal error: metric "foo_total" expects 1 label values, got 2`)
+}
+
+func (s *metricsSuite) TestDuplicateRegistration(c *C) {
+	s.reg.NewCounter("foo", "Foo.")
+	c.Check(func() { s.reg.NewGauge("foo", "Foo.") }, PanicMatches, `internal error: metric "foo" already registered`)
+}
+
+func (s *metricsSuite) TestGauge(c *C) {
+	g := s.reg.NewGauge("queue", "Things in the queue.", "queue")
+	g.Set(3, "a")
+	g.Add(-1, "a")
+	g.Set(7, `b"\`)
+
+	c.Check(s.text(c), Equals, `# HELP queue Things in the queue.
+# TYPE queue gauge
+queue{queue="a"} 2
+queue{queue="b\"\\"} 7
+`)
+}
+
+func (s *metricsSuite) TestGaugeFunc(c *C) {
+	g := s.reg.NewGaugeFunc("held_seconds", "Time held.")
+	c.Check(s.text(c), Equals, "")
+
+	g.SetFunc(func() float64 { return 0.25 })
+	c.Check(s.text(c), Equals, `# HELP held_seconds Time held.
+# TYPE held_seconds gauge
+held_seconds 0.25
+`)
+
+	g.SetFunc(nil)
+	c.Check(s.text(c), Equals, "")
+}
+
+func (s *metricsSuite) TestHistogram(c *C) {
+	h := s.reg.NewHistogram("took_seconds", "How long it took.", []float64{0.1, 1, 10}, "what")
+	h.Observe(0.05, "foo")
+	h.Observe(0.5, "foo")
+	h.Observe(20, "foo")
+	h.Observe(1, "bar")
+
+	c.Check(s.text(c), Equals, `# HELP took_seconds How long it took.
+# TYPE took_seconds histogram
+took_seconds_bucket{what="bar",le="0.1"} 0
+took_seconds_bucket{what="bar",le="1"} 1
+took_seconds_bucket{what="bar",le="10"} 1
+took_seconds_bucket{what="bar",le="+Inf"} 1
+took_seconds_sum{what="bar"} 1
+took_seconds_count{what="bar"} 1
+took_seconds_bucket{what="foo",le="0.1"} 1
+took_seconds_bucket{what="foo",le="1"} 2
+took_seconds_bucket{what="foo",le="10"} 2
+took_seconds_bucket{what="foo",le="+Inf"} 3
+took_seconds_sum{what="foo"} 20.55
+took_seconds_count{what="foo"} 3
+`)
+}
+
+func (s *metricsSuite) TestHistogramNoLabels(c *C) {
+	s.reg.NewHistogram("took_seconds", "How long it took.", []float64{1})
+
+	c.Check(s.text(c), Equals, `# HELP took_seconds How long it took.
+# TYPE took_seconds histogram
+took_seconds_bucket{le="1"} 0
+took_seconds_bucket{le="+Inf"} 0
+took_seconds_sum 0
+took_seconds_count 0
+`)
+}
+
+func (s *metricsSuite) TestHistogramUnsortedBuckets(c *C) {
+	c.Check(func() { s.reg.NewHistogram("foo", "Foo.", []float64{1, 0.5}) }, PanicMatches, `internal error: buckets of histogram "foo" are not sorted`)
+}
@@ -25,6 +25,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 
@@ -93,6 +94,20 @@ func (sto *fakeStore) Assertion(assertType *asserts.AssertionType, key []string,
 	return ref.Resolve(sto.db.Find)
 }
 
+func (sto *fakeStore) SeqFormingAssertion(assertType *asserts.AssertionType, sequenceKey []string, sequence int, _ *auth.UserState) (asserts.Assertion, error) {
+	sto.pokeStateLock()
+
+	if sequence > 0 {
+		ref := &asserts.Ref{Type: assertType, PrimaryKey: append(sequenceKey, strconv.Itoa(sequence))}
+		return ref.Resolve(sto.db.Find)
+	}
+	headers, err := asserts.HeadersFromSequenceKey(assertType, sequenceKey)
+	if err != nil {
+		return nil, err
+	}
+	return sto.db.FindSequence(assertType, headers)
+}
+
 var (
 	dev1PrivKey, _ = assertstest.GenerateKey(752)
 )
@@ -125,8 +140,8 @@ func (s *assertMgrSuite) SetUpTest(c *C) {
 	s.o.AddManager(s.o.TaskRunner())
 
 	s.fakeStore = &fakeStore{
-		state: s.state,
-		db:    s.storeSigning,
+		state:                  s.state,
+		db:                     s.storeSigning,
 		maxDeclSupportedFormat: asserts.SnapDeclarationType.MaxSupportedFormat(),
 	}
 	s.trivialDeviceCtx = &snapstatetest.TrivialDeviceContext{
@@ -0,0 +1,318 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package assertstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/snapasserts"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/release"
+)
+
+// ValidationSetMode reflects the mode of respective validation set, which is
+// either monitoring or enforcing.
+type ValidationSetMode int
+
+const (
+	Monitor ValidationSetMode = iota
+	Enforce
+)
+
+func (m ValidationSetMode) String() string {
+	switch m {
+	case Monitor:
+		return "monitor"
+	case Enforce:
+		return "enforce"
+	}
+	return fmt.Sprintf("unknown-mode-%d", int(m))
+}
+
+// ValidationSetTracking holds tracking parameters for associated validation set.
+type ValidationSetTracking struct {
+	AccountID string            `json:"account-id"`
+	Name      string            `json:"name"`
+	Mode      ValidationSetMode `json:"mode"`
+
+	// PinnedAt is an optional pinned sequence point, or 0 if not pinned.
+	PinnedAt int `json:"pinned-at,omitempty"`
+
+	// Current is the current sequence point.
+	Current int `json:"current,omitempty"`
+}
+
+// ValidationSetKey formats the given account id and name into a validation set key.
+func ValidationSetKey(accountID, name string) string {
+	return accountID + "/" + name
+}
+
+// UpdateValidationSet updates ValidationSetTracking.
+// The method assumes valid tr fields.
+func UpdateValidationSet(st *state.State, tr *ValidationSetTracking) {
+	var vsmap map[string]*json.RawMessage
+	err := st.Get("validation-sets", &vsmap)
+	if err != nil && err != state.ErrNoState {
+		panic("internal error: cannot unmarshal validation set tracking state: " + err.Error())
+	}
+	if vsmap == nil {
+		vsmap = make(map[string]*json.RawMessage)
+	}
+	data, err := json.Marshal(tr)
+	if err != nil {
+		panic("internal error: cannot marshal validation set tracking state: " + err.Error())
+	}
+	raw := json.RawMessage(data)
+	vsmap[ValidationSetKey(tr.AccountID, tr.Name)] = &raw
+	st.Set("validation-sets", vsmap)
+}
+
+// DeleteValidationSet deletes a validation set for the given accountID and name.
+// It is not an error to delete a non-existing one.
+func DeleteValidationSet(st *state.State, accountID, name string) {
+	var vsmap map[string]*json.RawMessage
+	err := st.Get("validation-sets", &vsmap)
+	if err != nil && err != state.ErrNoState {
+		panic("internal error: cannot unmarshal validation set tracking state: " + err.Error())
+	}
+	if len(vsmap) == 0 {
+		return
+	}
+	delete(vsmap, ValidationSetKey(accountID, name))
+	st.Set("validation-sets", vsmap)
+}
+
+// GetValidationSet retrieves the ValidationSetTracking for the given account and name.
+// It returns state.ErrNoState if the validation set is not tracked.
+func GetValidationSet(st *state.State, accountID, name string, tr *ValidationSetTracking) error {
+	if tr == nil {
+		return fmt.Errorf("internal error: tr is nil")
+	}
+
+	*tr = ValidationSetTracking{}
+
+	var vset map[string]*json.RawMessage
+	err := st.Get("validation-sets", &vset)
+	if err != nil {
+		return err
+	}
+	raw, ok := vset[ValidationSetKey(accountID, name)]
+	if !ok {
+		return state.ErrNoState
+	}
+	err = json.Unmarshal([]byte(*raw), tr)
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal validation set tracking state: %v", err)
+	}
+	return nil
+}
+
+// ValidationSets retrieves all ValidationSetTracking data.
+func ValidationSets(st *state.State) (map[string]*ValidationSetTracking, error) {
+	var vsmap map[string]*ValidationSetTracking
+	if err := st.Get("validation-sets", &vsmap); err != nil && err != state.ErrNoState {
+		return nil, err
+	}
+	return vsmap, nil
+}
+
+// ValidationSetAssertion returns the validation-set assertion for the
+// given account, name and sequence from the system assertion
+// database. If sequence is 0 the latest available sequence is
+// returned.
+func ValidationSetAssertion(st *state.State, accountID, name string, sequence int) (*asserts.ValidationSet, error) {
+	db := DB(st)
+	headers := map[string]string{
+		"series":     release.Series,
+		"account-id": accountID,
+		"name":       name,
+	}
+	if sequence > 0 {
+		headers["sequence"] = strconv.Itoa(sequence)
+		a, err := db.Find(asserts.ValidationSetType, headers)
+		if err != nil {
+			return nil, err
+		}
+		return a.(*asserts.ValidationSet), nil
+	}
+
+	a, err := db.FindSequence(asserts.ValidationSetType, headers)
+	if err != nil {
+		return nil, err
+	}
+	return a.(*asserts.ValidationSet), nil
+}
+
+// EnforcedValidationSets returns a snapasserts.ValidationSets struct
+// with all validation sets that are currently tracked in enforce mode.
+func EnforcedValidationSets(st *state.State) (*snapasserts.ValidationSets, error) {
+	return enforcedValidationSets(st, "")
+}
+
+func enforcedValidationSets(st *state.State, skipKey string) (*snapasserts.ValidationSets, error) {
+	valsets, err := ValidationSets(st)
+	if err != nil {
+		return nil, err
+	}
+
+	sets := snapasserts.NewValidationSets()
+	for key, tr := range valsets {
+		if tr.Mode != Enforce || key == skipKey {
+			continue
+		}
+		vs, err := ValidationSetAssertion(st, tr.AccountID, tr.Name, tr.Current)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find validation set %s: %v", key, err)
+		}
+		if err := sets.Add(vs); err != nil {
+			return nil, err
+		}
+	}
+	return sets, nil
+}
+
+// InstalledSnaps returns the installed snaps in a form suitable for
+// checking them against validation sets.
+func InstalledSnaps(st *state.State) ([]*snapasserts.InstalledSnap, error) {
+	snapStates, err := snapstate.All(st)
+	if err != nil {
+		return nil, err
+	}
+	snaps := make([]*snapasserts.InstalledSnap, 0, len(snapStates))
+	for _, snapst := range snapStates {
+		si := snapst.CurrentSideInfo()
+		if si == nil {
+			continue
+		}
+		snaps = append(snaps, snapasserts.NewInstalledSnap(si.RealName, si.SnapID, si.Revision))
+	}
+	return snaps, nil
+}
+
+// fetchValidationSet fetches the validation set with the given
+// account and name at the given sequence, or the latest one if
+// sequence is 0, from the store together with its prerequisites.
+func fetchValidationSet(st *state.State, accountID, name string, sequence, userID int) error {
+	deviceCtx, err := snapstate.DevicePastSeeding(st, nil)
+	if err != nil {
+		return err
+	}
+
+	var fetching func(f asserts.Fetcher) error
+	if sequence > 0 {
+		ref := &asserts.Ref{
+			Type:       asserts.ValidationSetType,
+			PrimaryKey: []string{release.Series, accountID, name, strconv.Itoa(sequence)},
+		}
+		fetching = func(f asserts.Fetcher) error {
+			return f.Fetch(ref)
+		}
+	} else {
+		user, err := userFromUserID(st, userID)
+		if err != nil {
+			return err
+		}
+		sto := snapstate.Store(st, deviceCtx)
+		st.Unlock()
+		latest, err := sto.SeqFormingAssertion(asserts.ValidationSetType, []string{release.Series, accountID, name}, 0, user)
+		st.Lock()
+		if err != nil {
+			return err
+		}
+		fetching = func(f asserts.Fetcher) error {
+			return f.Save(latest)
+		}
+	}
+	return doFetch(st, userID, deviceCtx, fetching)
+}
+
+// ApplyValidationSet starts tracking the validation set with the
+// given account and name in the given mode. If sequence is not 0 the
+// validation set gets pinned at that sequence and fetched from the
+// store if needed, otherwise the latest sequence is fetched from the
+// store and used. Enforcing a validation set
+// requires that it does not conflict with other enforced validation
+// sets and that the installed snaps satisfy it.
+func ApplyValidationSet(st *state.State, accountID, name string, sequence int, mode ValidationSetMode, userID int) (*ValidationSetTracking, error) {
+	if !asserts.IsValidValidationSetName(name) {
+		return nil, fmt.Errorf("invalid validation set name %q", name)
+	}
+	if sequence < 0 {
+		return nil, fmt.Errorf("invalid validation set sequence %d", sequence)
+	}
+
+	if err := fetchValidationSet(st, accountID, name, sequence, userID); err != nil {
+		return nil, fmt.Errorf("cannot fetch validation set %s: %v", ValidationSetKey(accountID, name), err)
+	}
+	vs, err := ValidationSetAssertion(st, accountID, name, sequence)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode == Enforce {
+		// the validation set being applied replaces any previously
+		// enforced sequence of itself
+		enforced, err := enforcedValidationSets(st, ValidationSetKey(accountID, name))
+		if err != nil {
+			return nil, err
+		}
+		if err := enforced.Add(vs); err != nil {
+			return nil, err
+		}
+		if err := enforced.Conflict(); err != nil {
+			return nil, err
+		}
+		snaps, err := InstalledSnaps(st)
+		if err != nil {
+			return nil, err
+		}
+		if err := enforced.CheckInstalledSnaps(snaps); err != nil {
+			return nil, err
+		}
+	}
+
+	tr := &ValidationSetTracking{
+		AccountID: accountID,
+		Name:      name,
+		Mode:      mode,
+		PinnedAt:  sequence,
+		Current:   vs.Sequence(),
+	}
+	UpdateValidationSet(st, tr)
+	return tr, nil
+}
+
+// ForgetValidationSet stops tracking the validation set with the
+// given account and name.
+func ForgetValidationSet(st *state.State, accountID, name string) error {
+	var tr ValidationSetTracking
+	if err := GetValidationSet(st, accountID, name, &tr); err != nil {
+		if err == state.ErrNoState {
+			return fmt.Errorf("validation set %s is not tracked", ValidationSetKey(accountID, name))
+		}
+		return err
+	}
+	DeleteValidationSet(st, accountID, name)
+	return nil
+}
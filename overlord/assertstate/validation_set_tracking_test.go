@@ -0,0 +1,269 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package assertstate_test
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/snapasserts"
+	"github.com/snapcore/snapd/asserts/sysdb"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+func (s *assertMgrSuite) TestValidationSetTrackingGetUpdateDelete(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	var tr assertstate.ValidationSetTracking
+	err := assertstate.GetValidationSet(s.state, "foo", "bar", &tr)
+	c.Assert(err, Equals, state.ErrNoState)
+
+	all, err := assertstate.ValidationSets(s.state)
+	c.Assert(err, IsNil)
+	c.Check(all, HasLen, 0)
+
+	tr1 := assertstate.ValidationSetTracking{
+		AccountID: "foo",
+		Name:      "bar",
+		Mode:      assertstate.Enforce,
+		PinnedAt:  1,
+		Current:   2,
+	}
+	assertstate.UpdateValidationSet(s.state, &tr1)
+	tr2 := assertstate.ValidationSetTracking{
+		AccountID: "foo",
+		Name:      "baz",
+		Mode:      assertstate.Monitor,
+		Current:   5,
+	}
+	assertstate.UpdateValidationSet(s.state, &tr2)
+
+	c.Assert(assertstate.GetValidationSet(s.state, "foo", "bar", &tr), IsNil)
+	c.Check(tr, DeepEquals, tr1)
+
+	all, err = assertstate.ValidationSets(s.state)
+	c.Assert(err, IsNil)
+	c.Check(all, DeepEquals, map[string]*assertstate.ValidationSetTracking{
+		"foo/bar": &tr1,
+		"foo/baz": &tr2,
+	})
+
+	assertstate.DeleteValidationSet(s.state, "foo", "bar")
+	c.Assert(assertstate.GetValidationSet(s.state, "foo", "bar", &tr), Equals, state.ErrNoState)
+	c.Assert(assertstate.GetValidationSet(s.state, "foo", "baz", &tr), IsNil)
+	c.Check(tr, DeepEquals, tr2)
+
+	// deleting a non-existing one is fine
+	assertstate.DeleteValidationSet(s.state, "foo", "bar")
+}
+
+func (s *assertMgrSuite) TestValidationSetModeString(c *C) {
+	c.Check(assertstate.Monitor.String(), Equals, "monitor")
+	c.Check(assertstate.Enforce.String(), Equals, "enforce")
+}
+
+func (s *assertMgrSuite) mockValidationSetInStore(c *C, sequence string, snaps ...interface{}) *asserts.ValidationSet {
+	a, err := s.dev1Signing.Sign(asserts.ValidationSetType, map[string]interface{}{
+		"authority-id": s.dev1Acct.AccountID(),
+		"account-id":   s.dev1Acct.AccountID(),
+		"series":       "16",
+		"name":         "myset",
+		"sequence":     sequence,
+		"snaps":        snaps,
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	c.Assert(s.storeSigning.Add(a), IsNil)
+	return a.(*asserts.ValidationSet)
+}
+
+func (s *assertMgrSuite) TestApplyValidationSetMonitor(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setModel(sysdb.GenericClassicModel())
+	c.Assert(assertstate.Add(s.state, s.storeSigning.StoreAccountKey("")), IsNil)
+
+	s.mockValidationSetInStore(c, "2", map[string]interface{}{
+		"name": "foo",
+		"id":   "fooidididididididididididididid1",
+	})
+
+	tr, err := assertstate.ApplyValidationSet(s.state, s.dev1Acct.AccountID(), "myset", 2, assertstate.Monitor, 0)
+	c.Assert(err, IsNil)
+	c.Check(tr, DeepEquals, &assertstate.ValidationSetTracking{
+		AccountID: s.dev1Acct.AccountID(),
+		Name:      "myset",
+		Mode:      assertstate.Monitor,
+		PinnedAt:  2,
+		Current:   2,
+	})
+
+	var stored assertstate.ValidationSetTracking
+	c.Assert(assertstate.GetValidationSet(s.state, s.dev1Acct.AccountID(), "myset", &stored), IsNil)
+	c.Check(&stored, DeepEquals, tr)
+
+	// the assertion was fetched
+	vs, err := assertstate.ValidationSetAssertion(s.state, s.dev1Acct.AccountID(), "myset", 0)
+	c.Assert(err, IsNil)
+	c.Check(vs.Sequence(), Equals, 2)
+
+	// not enforced
+	valsets, err := assertstate.EnforcedValidationSets(s.state)
+	c.Assert(err, IsNil)
+	c.Check(valsets.Keys(), HasLen, 0)
+}
+
+func (s *assertMgrSuite) TestApplyValidationSetLatest(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setModel(sysdb.GenericClassicModel())
+	c.Assert(assertstate.Add(s.state, s.storeSigning.StoreAccountKey("")), IsNil)
+
+	s.mockValidationSetInStore(c, "1", map[string]interface{}{
+		"name": "foo",
+		"id":   "fooidididididididididididididid1",
+	})
+	s.mockValidationSetInStore(c, "3", map[string]interface{}{
+		"name": "foo",
+		"id":   "fooidididididididididididididid1",
+	})
+
+	// the latest sequence is fetched from the store
+	tr, err := assertstate.ApplyValidationSet(s.state, s.dev1Acct.AccountID(), "myset", 0, assertstate.Monitor, 0)
+	c.Assert(err, IsNil)
+	c.Check(tr.PinnedAt, Equals, 0)
+	c.Check(tr.Current, Equals, 3)
+	_, err = assertstate.ValidationSetAssertion(s.state, s.dev1Acct.AccountID(), "myset", 1)
+	c.Check(asserts.IsNotFound(err), Equals, true)
+
+	tr, err = assertstate.ApplyValidationSet(s.state, s.dev1Acct.AccountID(), "myset", 1, assertstate.Monitor, 0)
+	c.Assert(err, IsNil)
+	c.Check(tr.PinnedAt, Equals, 1)
+	c.Check(tr.Current, Equals, 1)
+
+	// a newer sequence shows up in the store
+	s.mockValidationSetInStore(c, "4", map[string]interface{}{
+		"name": "foo",
+		"id":   "fooidididididididididididididid1",
+	})
+	tr, err = assertstate.ApplyValidationSet(s.state, s.dev1Acct.AccountID(), "myset", 0, assertstate.Monitor, 0)
+	c.Assert(err, IsNil)
+	c.Check(tr.Current, Equals, 4)
+}
+
+func (s *assertMgrSuite) TestApplyValidationSetLatestNotFound(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setModel(sysdb.GenericClassicModel())
+	c.Assert(assertstate.Add(s.state, s.storeSigning.StoreAccountKey("")), IsNil)
+
+	_, err := assertstate.ApplyValidationSet(s.state, s.dev1Acct.AccountID(), "myset", 0, assertstate.Monitor, 0)
+	c.Assert(err, ErrorMatches, `cannot fetch validation set .*/myset: validation-set assertion not found`)
+}
+
+func (s *assertMgrSuite) TestApplyValidationSetInvalid(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	_, err := assertstate.ApplyValidationSet(s.state, "foo", "Bar", 1, assertstate.Monitor, 0)
+	c.Assert(err, ErrorMatches, `invalid validation set name "Bar"`)
+
+	_, err = assertstate.ApplyValidationSet(s.state, "foo", "bar", -1, assertstate.Monitor, 0)
+	c.Assert(err, ErrorMatches, `invalid validation set sequence -1`)
+}
+
+func (s *assertMgrSuite) TestApplyValidationSetEnforce(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setModel(sysdb.GenericClassicModel())
+	c.Assert(assertstate.Add(s.state, s.storeSigning.StoreAccountKey("")), IsNil)
+
+	s.mockValidationSetInStore(c, "1", map[string]interface{}{
+		"name":     "foo",
+		"id":       "fooidididididididididididididid1",
+		"revision": "3",
+	})
+
+	// foo is not installed
+	_, err := assertstate.ApplyValidationSet(s.state, s.dev1Acct.AccountID(), "myset", 1, assertstate.Enforce, 0)
+	c.Assert(err, FitsTypeOf, &snapasserts.ValidationSetsValidationError{})
+	verr := err.(*snapasserts.ValidationSetsValidationError)
+	c.Check(verr.MissingSnaps, DeepEquals, map[string][]string{
+		"foo": {s.dev1Acct.AccountID() + "/myset"},
+	})
+	var tr assertstate.ValidationSetTracking
+	c.Assert(assertstate.GetValidationSet(s.state, s.dev1Acct.AccountID(), "myset", &tr), Equals, state.ErrNoState)
+
+	// wrong revision
+	snapstate.Set(s.state, "foo", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "foo", SnapID: "fooidididididididididididididid1", Revision: snap.R(2)},
+		},
+		Current: snap.R(2),
+	})
+	_, err = assertstate.ApplyValidationSet(s.state, s.dev1Acct.AccountID(), "myset", 1, assertstate.Enforce, 0)
+	c.Assert(err, FitsTypeOf, &snapasserts.ValidationSetsValidationError{})
+
+	// all good
+	snapstate.Set(s.state, "foo", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "foo", SnapID: "fooidididididididididididididid1", Revision: snap.R(3)},
+		},
+		Current: snap.R(3),
+	})
+	_, err = assertstate.ApplyValidationSet(s.state, s.dev1Acct.AccountID(), "myset", 1, assertstate.Enforce, 0)
+	c.Assert(err, IsNil)
+
+	valsets, err := assertstate.EnforcedValidationSets(s.state)
+	c.Assert(err, IsNil)
+	c.Check(valsets.Keys(), DeepEquals, []string{s.dev1Acct.AccountID() + "/myset"})
+}
+
+func (s *assertMgrSuite) TestForgetValidationSet(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	err := assertstate.ForgetValidationSet(s.state, "foo", "bar")
+	c.Assert(err, ErrorMatches, `validation set foo/bar is not tracked`)
+
+	assertstate.UpdateValidationSet(s.state, &assertstate.ValidationSetTracking{
+		AccountID: "foo",
+		Name:      "bar",
+		Mode:      assertstate.Monitor,
+		Current:   1,
+	})
+	err = assertstate.ForgetValidationSet(s.state, "foo", "bar")
+	c.Assert(err, IsNil)
+
+	var tr assertstate.ValidationSetTracking
+	c.Assert(assertstate.GetValidationSet(s.state, "foo", "bar", &tr), Equals, state.ErrNoState)
+}
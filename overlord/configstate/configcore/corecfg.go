@@ -73,6 +73,9 @@ func Run(tr config.Conf) error {
 	if err := validateProxyStore(tr); err != nil {
 		return err
 	}
+	if err := validateStoreLocalDir(tr); err != nil {
+		return err
+	}
 	if err := validateRefreshSchedule(tr); err != nil {
 		return err
 	}
@@ -91,6 +94,12 @@ func Run(tr config.Conf) error {
 	if err := validateAutomaticSnapshotsExpiration(tr); err != nil {
 		return err
 	}
+	if err := validateSnapshotsEncryptionKey(tr); err != nil {
+		return err
+	}
+	if err := validateScheduledSnapshots(tr); err != nil {
+		return err
+	}
 	// FIXME: ensure the user cannot set "core seed.loaded"
 
 	// capture cloud information
@@ -21,14 +21,25 @@ package configcore
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/timeutil"
 )
 
 func init() {
 	// add supported configuration of this module
 	supportedConfigurations["core.snapshots.automatic.retention"] = true
+	supportedConfigurations["core.snapshots.encryption-key"] = true
+	supportedConfigurations["core.snapshots.schedule"] = true
+	supportedConfigurations["core.snapshots.scheduled.snaps"] = true
+	supportedConfigurations["core.snapshots.scheduled.keep-daily"] = true
+	supportedConfigurations["core.snapshots.scheduled.keep-weekly"] = true
+	supportedConfigurations["core.snapshots.scheduled.max-age"] = true
 }
 
 func validateAutomaticSnapshotsExpiration(tr config.Conf) error {
@@ -47,3 +58,66 @@ func validateAutomaticSnapshotsExpiration(tr config.Conf) error {
 	}
 	return nil
 }
+
+func validateSnapshotsEncryptionKey(tr config.Conf) error {
+	key, err := coreCfg(tr, "snapshots.encryption-key")
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		return nil
+	}
+	if _, err := backend.ParseEncryptionKey(key); err != nil {
+		return fmt.Errorf("snapshots.encryption-key is invalid: %v", err)
+	}
+	return nil
+}
+
+func validateScheduledSnapshots(tr config.Conf) error {
+	scheduleStr, err := coreCfg(tr, "snapshots.schedule")
+	if err != nil {
+		return err
+	}
+	if scheduleStr != "" {
+		if _, err := timeutil.ParseSchedule(scheduleStr); err != nil {
+			return fmt.Errorf("snapshots.schedule cannot be parsed: %v", err)
+		}
+	}
+
+	snapsStr, err := coreCfg(tr, "snapshots.scheduled.snaps")
+	if err != nil {
+		return err
+	}
+	for _, name := range strutil.CommaSeparatedList(snapsStr) {
+		if err := snap.ValidateInstanceName(name); err != nil {
+			return fmt.Errorf("snapshots.scheduled.snaps is invalid: %v", err)
+		}
+	}
+
+	for _, key := range []string{"snapshots.scheduled.keep-daily", "snapshots.scheduled.keep-weekly"} {
+		keepStr, err := coreCfg(tr, key)
+		if err != nil {
+			return err
+		}
+		if keepStr != "" {
+			if _, err := strconv.ParseUint(keepStr, 10, 16); err != nil {
+				return fmt.Errorf("%s must be a non-negative number, not %q", key, keepStr)
+			}
+		}
+	}
+
+	maxAgeStr, err := coreCfg(tr, "snapshots.scheduled.max-age")
+	if err != nil {
+		return err
+	}
+	if maxAgeStr != "" {
+		dur, err := time.ParseDuration(maxAgeStr)
+		if err != nil {
+			return fmt.Errorf("snapshots.scheduled.max-age cannot be parsed: %v", err)
+		}
+		if dur < time.Hour*24 {
+			return fmt.Errorf("snapshots.scheduled.max-age must be a value greater than 24 hours")
+		}
+	}
+	return nil
+}
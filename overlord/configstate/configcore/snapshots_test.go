@@ -20,6 +20,12 @@
 package configcore_test
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+
 	. "gopkg.in/check.v1"
 
 	"github.com/snapcore/snapd/overlord/configstate/configcore"
@@ -70,3 +76,64 @@ func (s *refreshSuite) TestConfigureAutomaticSnapshotsExpirationInvalid(c *C) {
 	})
 	c.Assert(err, ErrorMatches, `snapshots.automatic.retention cannot be parsed:.*`)
 }
+
+func (s *snapshotsSuite) TestConfigureSnapshotsEncryptionKeyHappy(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	c.Assert(err, IsNil)
+
+	err = configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"snapshots.encryption-key": base64.StdEncoding.EncodeToString(der),
+		},
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *snapshotsSuite) TestConfigureSnapshotsEncryptionKeyInvalid(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"snapshots.encryption-key": "invalid",
+		},
+	})
+	c.Assert(err, ErrorMatches, `snapshots.encryption-key is invalid: cannot decode encryption key: .*`)
+}
+
+func (s *snapshotsSuite) TestConfigureScheduledSnapshotsHappy(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"snapshots.schedule":              "mon,02:00-04:00",
+			"snapshots.scheduled.snaps":       "foo,bar_instance",
+			"snapshots.scheduled.keep-daily":  7,
+			"snapshots.scheduled.keep-weekly": "0",
+			"snapshots.scheduled.max-age":     "720h",
+		},
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *snapshotsSuite) TestConfigureScheduledSnapshotsInvalid(c *C) {
+	for _, t := range []struct {
+		key, value string
+		err        string
+	}{
+		{"snapshots.schedule", "invalid", `snapshots.schedule cannot be parsed: .*`},
+		{"snapshots.scheduled.snaps", "foo,Bar", `snapshots.scheduled.snaps is invalid: invalid snap name: "Bar"`},
+		{"snapshots.scheduled.keep-daily", "-1", `snapshots.scheduled.keep-daily must be a non-negative number, not "-1"`},
+		{"snapshots.scheduled.keep-weekly", "a few", `snapshots.scheduled.keep-weekly must be a non-negative number, not "a few"`},
+		{"snapshots.scheduled.max-age", "invalid", `snapshots.scheduled.max-age cannot be parsed: .*`},
+		{"snapshots.scheduled.max-age", "1h", `snapshots.scheduled.max-age must be a value greater than 24 hours`},
+	} {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				t.key: t.value,
+			},
+		})
+		c.Check(err, ErrorMatches, t.err, Commentf("%s=%s", t.key, t.value))
+	}
+}
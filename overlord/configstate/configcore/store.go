@@ -0,0 +1,50 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+)
+
+func init() {
+	// add supported configuration of this module
+	supportedConfigurations["core.store.local-dir"] = true
+}
+
+func validateStoreLocalDir(tr config.Conf) error {
+	localDir, err := coreCfg(tr, "store.local-dir")
+	if err != nil {
+		return err
+	}
+	if localDir == "" {
+		return nil
+	}
+	if !filepath.IsAbs(localDir) {
+		return fmt.Errorf("store.local-dir must be an absolute path: %q", localDir)
+	}
+	if !osutil.IsDirectory(localDir) {
+		return fmt.Errorf("cannot set store.local-dir to %q: not a directory", localDir)
+	}
+	return nil
+}
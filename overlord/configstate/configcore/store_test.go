@@ -0,0 +1,86 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+)
+
+type storeSuite struct {
+	configcoreSuite
+}
+
+var _ = Suite(&storeSuite{})
+
+func (s *storeSuite) TestConfigureStoreLocalDirHappy(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"store.local-dir": c.MkDir(),
+		},
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *storeSuite) TestConfigureStoreLocalDirUnset(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"store.local-dir": "",
+		},
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *storeSuite) TestConfigureStoreLocalDirRelative(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"store.local-dir": "srv/snaps",
+		},
+	})
+	c.Assert(err, ErrorMatches, `store.local-dir must be an absolute path: "srv/snaps"`)
+}
+
+func (s *storeSuite) TestConfigureStoreLocalDirNotADirectory(c *C) {
+	notDir := filepath.Join(c.MkDir(), "foo")
+	c.Assert(ioutil.WriteFile(notDir, nil, 0644), IsNil)
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"store.local-dir": notDir,
+		},
+	})
+	c.Assert(err, ErrorMatches, `cannot set store.local-dir to ".*/foo": not a directory`)
+
+	err = configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"store.local-dir": "/does/not/exist",
+		},
+	})
+	c.Assert(err, ErrorMatches, `cannot set store.local-dir to "/does/not/exist": not a directory`)
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/snapcore/snapd/boot"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/overlord/assertstate"
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/overlord/configstate/config"
@@ -39,6 +40,7 @@ import (
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/overlord/storecontext"
 	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/snapdenv"
 	"github.com/snapcore/snapd/timings"
 )
 
@@ -51,6 +53,11 @@ type DeviceManager struct {
 	// newStore can make new stores for remodeling
 	newStore func(storecontext.DeviceBackend) snapstate.StoreService
 
+	// preseed is set when snapd runs inside a chroot to preseed
+	// an image
+	preseed              bool
+	preseedStopRequested bool
+
 	bootOkRan            bool
 	bootRevisionsUpdated bool
 
@@ -77,6 +84,7 @@ func Manager(s *state.State, hookManager *hookstate.HookManager, runner *state.T
 		keypairMgr: keypairMgr,
 		newStore:   newStore,
 		reg:        make(chan struct{}),
+		preseed:    snapdenv.Preseeding(),
 	}
 
 	s.Lock()
@@ -91,6 +99,7 @@ func Manager(s *state.State, hookManager *hookstate.HookManager, runner *state.T
 
 	runner.AddHandler("generate-device-key", m.doGenerateDeviceKey, nil)
 	runner.AddHandler("request-serial", m.doRequestSerial, nil)
+	runner.AddHandler("mark-preseeded", m.doMarkPreseeded, nil)
 	runner.AddHandler("mark-seeded", m.doMarkSeeded, nil)
 	runner.AddHandler("prepare-remodeling", m.doPrepareRemodeling, nil)
 	runner.AddCleanup("prepare-remodeling", m.cleanupRemodel)
@@ -429,6 +438,27 @@ func (m *DeviceManager) ensureSeedYaml() error {
 	return nil
 }
 
+// ensurePreseedingStops stops snapd when seeding failed while
+// preseeding, as mark-preseeded will then never get to stop it.
+func (m *DeviceManager) ensurePreseedingStops() error {
+	m.state.Lock()
+	defer m.state.Unlock()
+
+	if !m.preseed || m.preseedStopRequested {
+		return nil
+	}
+
+	for _, chg := range m.state.Changes() {
+		if chg.Kind() == "seed" && chg.Status() == state.ErrorStatus {
+			logger.Noticef("seeding failed while preseeding: %v", chg.Err())
+			m.preseedStopRequested = true
+			m.state.RequestRestart(state.StopDaemon)
+			break
+		}
+	}
+	return nil
+}
+
 func (m *DeviceManager) ensureBootOk() error {
 	m.state.Lock()
 	defer m.state.Unlock()
@@ -521,6 +551,9 @@ func (m *DeviceManager) Ensure() error {
 	if err := m.ensureSeedYaml(); err != nil {
 		errs = append(errs, err)
 	}
+	if err := m.ensurePreseedingStops(); err != nil {
+		errs = append(errs, err)
+	}
 	if err := m.ensureOperational(); err != nil {
 		errs = append(errs, err)
 	}
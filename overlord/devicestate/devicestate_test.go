@@ -21,6 +21,7 @@ package devicestate_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -41,6 +42,7 @@ import (
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/asserts/assertstest"
 	"github.com/snapcore/snapd/asserts/sysdb"
+	"github.com/snapcore/snapd/boot"
 	"github.com/snapcore/snapd/bootloader"
 	"github.com/snapcore/snapd/bootloader/bootloadertest"
 	"github.com/snapcore/snapd/dirs"
@@ -3518,19 +3520,169 @@ func (s *deviceMgrSuite) TestUpdateGadgetOnCoreSimple(c *C) {
 		s.se.Wait()
 	}
 
+	s.state.Lock()
+	defer s.state.Unlock()
+	// waiting for the reboot
+	c.Assert(chg.IsReady(), Equals, false)
+	c.Check(t.Status(), Equals, state.DoingStatus)
+	c.Check(updateCalled, Equals, true)
+	rollbackDir := filepath.Join(dirs.SnapRollbackDir, "foo-gadget_34")
+	c.Check(rollbackDir, Equals, passedRollbackDir)
+	// kept until the system booted with the update
+	c.Check(osutil.IsDirectory(rollbackDir), Equals, true)
+	c.Check(s.restartRequests, DeepEquals, []state.RestartType{state.RestartSystem})
+
+	upd, err := boot.TrackedAssetsUpdate()
+	c.Assert(err, IsNil)
+	c.Assert(upd, NotNil)
+	c.Check(upd.Gadget, Equals, "foo-gadget")
+	c.Check(upd.FromRevision, Equals, snap.R(33))
+	c.Check(upd.ToRevision, Equals, snap.R(34))
+	c.Check(upd.RollbackDir, Equals, rollbackDir)
+	c.Check(upd.Status, Equals, boot.AssetsUpdatePending)
+	c.Check(s.bootloader.BootVars["snap_mode"], Equals, "try")
+}
+
+// simulateRebootAfterGadgetUpdate simulates a reboot after a tracked
+// update of the gadget assets, leaving snap_mode as set by the
+// bootloader.
+func (s *deviceMgrSuite) simulateRebootAfterGadgetUpdate(c *C, mode string) {
+	updFile := filepath.Join(dirs.SnapBootAssetsDir, "update.json")
+	data, err := ioutil.ReadFile(updFile)
+	c.Assert(err, IsNil)
+	var upd map[string]interface{}
+	c.Assert(json.Unmarshal(data, &upd), IsNil)
+	upd["boot-id"] = "previous-boot-id"
+	data, err = json.Marshal(upd)
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(updFile, data, 0644), IsNil)
+
+	s.bootloader.BootVars["snap_mode"] = mode
+	devicestate.SetBootOkRan(s.mgr, false)
+}
+
+func (s *deviceMgrSuite) TestUpdateGadgetOnCoreBootedWithUpdate(c *C) {
+	restore := devicestate.MockGadgetUpdate(func(current, update gadget.GadgetData, path string) error {
+		return nil
+	})
+	defer restore()
+	restore = devicestate.MockGadgetRollback(func(current, update gadget.GadgetData, path string) error {
+		c.Fatalf("unexpected call")
+		return nil
+	})
+	defer restore()
+
+	chg, t := setupGadgetUpdate(c, s.state)
+
+	for i := 0; i < 6; i++ {
+		s.se.Ensure()
+		s.se.Wait()
+	}
+
+	s.simulateRebootAfterGadgetUpdate(c, "trying")
+
+	for i := 0; i < 6; i++ {
+		s.se.Ensure()
+		s.se.Wait()
+	}
+
 	s.state.Lock()
 	defer s.state.Unlock()
 	c.Assert(chg.IsReady(), Equals, true)
 	c.Check(chg.Err(), IsNil)
 	c.Check(t.Status(), Equals, state.DoneStatus)
-	c.Check(updateCalled, Equals, true)
+	c.Check(s.bootloader.BootVars["snap_mode"], Equals, "")
+	// the update is not tracked anymore
 	rollbackDir := filepath.Join(dirs.SnapRollbackDir, "foo-gadget_34")
-	c.Check(rollbackDir, Equals, passedRollbackDir)
-	// should have been removed right after update
 	c.Check(osutil.IsDirectory(rollbackDir), Equals, false)
+	upd, err := boot.TrackedAssetsUpdate()
+	c.Assert(err, IsNil)
+	c.Check(upd, IsNil)
 	c.Check(s.restartRequests, DeepEquals, []state.RestartType{state.RestartSystem})
 }
 
+func (s *deviceMgrSuite) TestUpdateGadgetOnCoreBootWithUpdateFailed(c *C) {
+	restore := devicestate.MockGadgetUpdate(func(current, update gadget.GadgetData, path string) error {
+		return nil
+	})
+	defer restore()
+	var rollbackCalls int
+	var passedRollbackDir string
+	restore = devicestate.MockGadgetRollback(func(current, update gadget.GadgetData, path string) error {
+		rollbackCalls++
+		passedRollbackDir = path
+		return nil
+	})
+	defer restore()
+
+	chg, t := setupGadgetUpdate(c, s.state)
+
+	for i := 0; i < 6; i++ {
+		s.se.Ensure()
+		s.se.Wait()
+	}
+
+	// the bootloader fell back to the previous boot
+	s.simulateRebootAfterGadgetUpdate(c, "")
+
+	for i := 0; i < 6; i++ {
+		s.se.Ensure()
+		s.se.Wait()
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Assert(chg.IsReady(), Equals, true)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*update gadget \(cannot boot with the updated gadget assets\).*`)
+	c.Check(t.Status(), Equals, state.ErrorStatus)
+	c.Assert(t.Log(), HasLen, 2)
+	c.Check(t.Log()[0], Matches, ".* INFO Restored the previous gadget assets")
+	c.Check(t.Log()[1], Matches, ".* ERROR cannot boot with the updated gadget assets")
+	c.Check(rollbackCalls, Equals, 1)
+	c.Check(passedRollbackDir, Equals, filepath.Join(dirs.SnapRollbackDir, "foo-gadget_34"))
+	upd, err := boot.TrackedAssetsUpdate()
+	c.Assert(err, IsNil)
+	c.Check(upd, IsNil)
+}
+
+func (s *deviceMgrSuite) TestUpdateGadgetOnCoreBootWithUpdateFailedBadBackup(c *C) {
+	restore := devicestate.MockGadgetUpdate(func(current, update gadget.GadgetData, path string) error {
+		return nil
+	})
+	defer restore()
+	restore = devicestate.MockGadgetRollback(func(current, update gadget.GadgetData, path string) error {
+		c.Fatalf("unexpected call")
+		return nil
+	})
+	defer restore()
+
+	chg, t := setupGadgetUpdate(c, s.state)
+
+	for i := 0; i < 6; i++ {
+		s.se.Ensure()
+		s.se.Wait()
+	}
+
+	rollbackDir := filepath.Join(dirs.SnapRollbackDir, "foo-gadget_34")
+	c.Assert(ioutil.WriteFile(filepath.Join(rollbackDir, "unexpected.backup"), nil, 0644), IsNil)
+	s.simulateRebootAfterGadgetUpdate(c, "")
+
+	for i := 0; i < 6; i++ {
+		s.se.Ensure()
+		s.se.Wait()
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Assert(chg.IsReady(), Equals, true)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*update gadget \(cannot restore previous gadget assets: unexpected boot assets backup file "unexpected.backup"\).*`)
+	c.Check(t.Status(), Equals, state.ErrorStatus)
+	// still tracked for inspection
+	upd, err := boot.TrackedAssetsUpdate()
+	c.Assert(err, IsNil)
+	c.Check(upd.Status, Equals, boot.AssetsUpdateFailed)
+}
+
 func (s *deviceMgrSuite) TestUpdateGadgetOnCoreNoUpdateNeeded(c *C) {
 	var called bool
 	restore := devicestate.MockGadgetUpdate(func(current, update gadget.GadgetData, path string) error {
@@ -3608,6 +3760,41 @@ func (s *deviceMgrSuite) TestUpdateGadgetOnCoreUpdateFailed(c *C) {
 	c.Check(s.restartRequests, HasLen, 0)
 }
 
+func (s *deviceMgrSuite) TestUpdateGadgetOnCoreResealFailed(c *C) {
+	restore := devicestate.MockGadgetUpdate(func(current, update gadget.GadgetData, path string) error {
+		return nil
+	})
+	defer restore()
+	var rollbackDir string
+	restore = devicestate.MockGadgetRollback(func(current, update gadget.GadgetData, path string) error {
+		rollbackDir = path
+		return nil
+	})
+	defer restore()
+	restore = devicestate.MockBootResealKeyForBootConfig(func(oldConfig []byte) error {
+		return errors.New("cannot unseal key: policy check failed")
+	})
+	defer restore()
+	chg, t := setupGadgetUpdate(c, s.state)
+
+	for i := 0; i < 6; i++ {
+		s.se.Ensure()
+		s.se.Wait()
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Assert(chg.IsReady(), Equals, true)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*update gadget \(cannot reseal the encryption key: cannot unseal key: policy check failed\).*`)
+	c.Check(t.Status(), Equals, state.ErrorStatus)
+	// the updated assets were not kept
+	c.Check(rollbackDir, Equals, filepath.Join(dirs.SnapRollbackDir, "foo-gadget_34"))
+	c.Check(s.restartRequests, HasLen, 0)
+	upd, err := boot.TrackedAssetsUpdate()
+	c.Assert(err, IsNil)
+	c.Check(upd, IsNil)
+}
+
 func (s *deviceMgrSuite) TestUpdateGadgetOnCoreNotDuringFirstboot(c *C) {
 	restore := devicestate.MockGadgetUpdate(func(current, update gadget.GadgetData, path string) error {
 		return errors.New("unexpected call")
@@ -3838,8 +4025,9 @@ volumes:
 
 	s.state.Lock()
 	defer s.state.Unlock()
-	c.Assert(chg.IsReady(), Equals, true)
-	c.Check(t.Status(), Equals, state.DoneStatus)
+	// waiting for the reboot
+	c.Assert(chg.IsReady(), Equals, false)
+	c.Check(t.Status(), Equals, state.DoingStatus)
 	c.Check(s.restartRequests, HasLen, 1)
 	c.Check(updaterForStructureCalls, Equals, 1)
 }
@@ -3980,3 +4168,183 @@ func (s *deviceMgrSuite) TestGadgetUpdateBlocksOtherTasks(c *C) {
 	// not blocking without gadget update task
 	c.Assert(devicestate.GadgetUpdateBlocked(t1, []*state.Task{t2}), Equals, false)
 }
+
+func (s *deviceMgrSuite) TestDoMarkPreseededWhilePreseeding(c *C) {
+	devicestate.SetPreseed(s.mgr, true)
+
+	restore := interfaces.MockSystemKey(`{"build-id": "abcde", "apparmor-features": ["caps", "dbus"]}`)
+	defer restore()
+	c.Assert(os.MkdirAll(filepath.Dir(dirs.SnapSystemKeyFile), 0755), IsNil)
+	c.Assert(interfaces.WriteSystemKey(), IsNil)
+
+	var unmounted []string
+	restore = devicestate.MockUnmountSnap(func(mountDir string) error {
+		unmounted = append(unmounted, mountDir)
+		return nil
+	})
+	defer restore()
+
+	s.state.Lock()
+	si := &snap.SideInfo{RealName: "core", Revision: snap.R(1)}
+	snapstate.Set(s.state, "core", &snapstate.SnapState{
+		SnapType: "os",
+		Active:   true,
+		Sequence: []*snap.SideInfo{si},
+		Current:  si.Revision,
+	})
+	chg := s.state.NewChange("seed", "Seed system")
+	t := s.state.NewTask("mark-preseeded", "...")
+	chg.AddTask(t)
+	s.state.Unlock()
+
+	s.se.Ensure()
+	s.se.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// the task stays in Doing until the first boot of the image
+	c.Check(t.Status(), Equals, state.DoingStatus)
+	c.Check(unmounted, DeepEquals, []string{filepath.Join(dirs.SnapMountDir, "core", "1")})
+	c.Check(s.restartRequests, DeepEquals, []state.RestartType{state.StopDaemon})
+
+	var systemKey map[string]interface{}
+	c.Assert(s.state.Get("preseed-system-key", &systemKey), IsNil)
+	c.Check(systemKey["build-id"], Equals, "abcde")
+	var preseedTime time.Time
+	c.Check(s.state.Get("preseed-time", &preseedTime), IsNil)
+}
+
+func (s *deviceMgrSuite) TestDoMarkPreseededWhilePreseedingUnmountError(c *C) {
+	devicestate.SetPreseed(s.mgr, true)
+
+	restore := devicestate.MockUnmountSnap(func(mountDir string) error {
+		return fmt.Errorf("boom")
+	})
+	defer restore()
+
+	s.state.Lock()
+	si := &snap.SideInfo{RealName: "core", Revision: snap.R(1)}
+	snapstate.Set(s.state, "core", &snapstate.SnapState{
+		SnapType: "os",
+		Active:   true,
+		Sequence: []*snap.SideInfo{si},
+		Current:  si.Revision,
+	})
+	chg := s.state.NewChange("seed", "Seed system")
+	t := s.state.NewTask("mark-preseeded", "...")
+	chg.AddTask(t)
+	s.state.Unlock()
+
+	// the failed seeding stops snapd on the next ensure pass
+	for i := 0; i < 2; i++ {
+		s.se.Ensure()
+		s.se.Wait()
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Check(t.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*cannot unmount snap "core": boom.*`)
+	// snapd is still stopped as seeding failed
+	c.Check(s.restartRequests, DeepEquals, []state.RestartType{state.StopDaemon})
+}
+
+func (s *deviceMgrSuite) TestDoMarkPreseededOnFirstBoot(c *C) {
+	restore := interfaces.MockSystemKey(`{"build-id": "abcde", "apparmor-features": ["caps", "dbus"]}`)
+	defer restore()
+
+	s.state.Lock()
+	s.state.Set("preseed-system-key", map[string]interface{}{
+		"build-id":          "abcde",
+		"apparmor-features": []string{"caps", "dbus"},
+	})
+	chg := s.state.NewChange("seed", "Seed system")
+	t := s.state.NewTask("mark-preseeded", "...")
+	chg.AddTask(t)
+	s.state.Unlock()
+
+	s.se.Ensure()
+	s.se.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Check(t.Status(), Equals, state.DoneStatus)
+	c.Check(t.Log(), HasLen, 0)
+	c.Check(s.restartRequests, HasLen, 0)
+	var restartTime time.Time
+	c.Check(s.state.Get("seed-restart-time", &restartTime), IsNil)
+}
+
+func (s *deviceMgrSuite) TestDoMarkPreseededOnFirstBootSystemKeyMismatch(c *C) {
+	restore := interfaces.MockSystemKey(`{"build-id": "abcde", "apparmor-features": ["caps", "dbus"]}`)
+	defer restore()
+	// the security profiles were regenerated for the current system key
+	c.Assert(os.MkdirAll(filepath.Dir(dirs.SnapSystemKeyFile), 0755), IsNil)
+	c.Assert(interfaces.WriteSystemKey(), IsNil)
+
+	s.state.Lock()
+	s.state.Set("preseed-system-key", map[string]interface{}{
+		"build-id":          "other",
+		"apparmor-features": []string{"caps"},
+	})
+	chg := s.state.NewChange("seed", "Seed system")
+	t := s.state.NewTask("mark-preseeded", "...")
+	chg.AddTask(t)
+	s.state.Unlock()
+
+	s.se.Ensure()
+	s.se.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Check(t.Status(), Equals, state.DoneStatus)
+	c.Assert(t.Log(), HasLen, 1)
+	c.Check(t.Log()[0], Matches, `.* System key of the preseeded image does not match the system, security profiles were regenerated`)
+}
+
+func (s *deviceMgrSuite) TestDoMarkPreseededOnFirstBootSystemKeyMismatchNotRegenerated(c *C) {
+	restore := interfaces.MockSystemKey(`{"build-id": "abcde", "apparmor-features": ["caps", "dbus"]}`)
+	defer restore()
+	// the system key of the preseeded image is still the recorded one
+	c.Assert(os.MkdirAll(filepath.Dir(dirs.SnapSystemKeyFile), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(dirs.SnapSystemKeyFile, []byte(`{"build-id": "other", "apparmor-features": ["caps"]}`), 0644), IsNil)
+
+	s.state.Lock()
+	s.state.Set("preseed-system-key", map[string]interface{}{
+		"build-id":          "other",
+		"apparmor-features": []string{"caps"},
+	})
+	chg := s.state.NewChange("seed", "Seed system")
+	t := s.state.NewTask("mark-preseeded", "...")
+	chg.AddTask(t)
+	s.state.Unlock()
+
+	s.se.Ensure()
+	s.se.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Check(t.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*cannot use the preseeded image: its system key does not match the system and the security profiles were not regenerated.*`)
+	var restartTime time.Time
+	c.Check(s.state.Get("seed-restart-time", &restartTime), Equals, state.ErrNoState)
+}
+
+func (s *deviceMgrSuite) TestEnsurePreseedingStopsOnSeedError(c *C) {
+	devicestate.SetPreseed(s.mgr, true)
+
+	s.state.Lock()
+	chg := s.state.NewChange("seed", "Seed system")
+	chg.SetStatus(state.ErrorStatus)
+	s.state.Unlock()
+
+	s.se.Ensure()
+	s.se.Ensure()
+
+	c.Check(s.restartRequests, DeepEquals, []state.RestartType{state.StopDaemon})
+}
@@ -170,3 +170,31 @@ func MockGadgetUpdate(mock func(current, update gadget.GadgetData, path string)
 		gadgetUpdate = old
 	}
 }
+
+func MockGadgetRollback(mock func(current, update gadget.GadgetData, path string) error) (restore func()) {
+	old := gadgetRollback
+	gadgetRollback = mock
+	return func() {
+		gadgetRollback = old
+	}
+}
+
+func MockBootResealKeyForBootConfig(mock func(oldConfig []byte) error) (restore func()) {
+	old := bootResealKeyForBootConfig
+	bootResealKeyForBootConfig = mock
+	return func() {
+		bootResealKeyForBootConfig = old
+	}
+}
+
+func SetPreseed(m *DeviceManager, b bool) {
+	m.preseed = b
+}
+
+func MockUnmountSnap(f func(mountDir string) error) (restore func()) {
+	old := unmountSnap
+	unmountSnap = f
+	return func() {
+		unmountSnap = old
+	}
+}
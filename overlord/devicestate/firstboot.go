@@ -34,6 +34,7 @@ import (
 	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/seed"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snapdenv"
 	"github.com/snapcore/snapd/timings"
 )
 
@@ -53,11 +54,16 @@ func installSeedSnap(st *state.State, sn *seed.Snap, flags snapstate.Flags) (*st
 	return snapstate.InstallPath(st, sn.SideInfo, sn.Path, "", sn.Channel, flags)
 }
 
-func trivialSeeding(st *state.State, markSeeded *state.Task) []*state.TaskSet {
+func trivialSeeding(st *state.State, markSeeded, preseedDone *state.Task) []*state.TaskSet {
 	// give the internal core config a chance to run (even if core is
 	// not used at all we put system configuration there)
 	configTs := snapstate.ConfigureSnap(st, "core", 0)
 	markSeeded.WaitAll(configTs)
+	if preseedDone != nil {
+		// nothing to preseed, just stop
+		configTs.WaitFor(preseedDone)
+		return []*state.TaskSet{state.NewTaskSet(preseedDone), configTs, state.NewTaskSet(markSeeded)}
+	}
 	return []*state.TaskSet{configTs, state.NewTaskSet(markSeeded)}
 }
 
@@ -74,7 +80,15 @@ func populateStateFromSeedImpl(st *state.State, tm timings.Measurer) ([]*state.T
 
 	markSeeded := st.NewTask("mark-seeded", i18n.G("Mark system seeded"))
 
-	deviceSeed, err := seed.Open(dirs.SnapSeedDir)
+	// when preseeding, the tasks of each snap up to its hooks run
+	// in the chroot of the image, mark-preseeded then stops snapd and
+	// the hooks and everything after them run on first boot
+	var preseedDone *state.Task
+	if snapdenv.Preseeding() {
+		preseedDone = st.NewTask("mark-preseeded", i18n.G("Mark system pre-seeded"))
+	}
+
+	deviceSeed, err := seed.Open(dirs.SnapSeedDir, "")
 	if err != nil {
 		return nil, err
 	}
@@ -85,7 +99,7 @@ func populateStateFromSeedImpl(st *state.State, tm timings.Measurer) ([]*state.T
 		model, err = importAssertionsFromSeed(st, deviceSeed)
 	})
 	if err == errNothingToDo {
-		return trivialSeeding(st, markSeeded), nil
+		return trivialSeeding(st, markSeeded, preseedDone), nil
 	}
 	if err != nil {
 		return nil, err
@@ -94,7 +108,7 @@ func populateStateFromSeedImpl(st *state.State, tm timings.Measurer) ([]*state.T
 	err = deviceSeed.LoadMeta(tm)
 	if release.OnClassic && err == seed.ErrNoMeta {
 		// on classic it is ok to not seed any snaps
-		return trivialSeeding(st, markSeeded), nil
+		return trivialSeeding(st, markSeeded, preseedDone), nil
 	}
 	if err != nil {
 		return nil, err
@@ -118,12 +132,50 @@ func populateStateFromSeedImpl(st *state.State, tm timings.Measurer) ([]*state.T
 		}
 		return append(all, ts)
 	}
-	chainSorted := func(infos []*snap.Info, infoToTs map[*snap.Info]*state.TaskSet) {
+	// lastBeforeHooks is the last task before the hooks of the
+	// previously chained snap, used when preseeding
+	var lastBeforeHooks *state.Task
+	chainInstallTs := func(all []*state.TaskSet, ts *state.TaskSet) ([]*state.TaskSet, error) {
+		if preseedDone == nil {
+			return chainTs(all, ts), nil
+		}
+		begin, err := ts.Edge(snapstate.BeginEdge)
+		if err != nil {
+			return nil, err
+		}
+		beforeHooks, err := ts.Edge(snapstate.BeforeHooksEdge)
+		if err != nil {
+			return nil, err
+		}
+		hooks, err := ts.Edge(snapstate.HooksEdge)
+		if err != nil {
+			return nil, err
+		}
+		// the tasks up to the hooks are chained with those of
+		// the previous snap and run before mark-preseeded
+		if lastBeforeHooks != nil {
+			begin.WaitFor(lastBeforeHooks)
+		}
+		preseedDone.WaitFor(beforeHooks)
+		lastBeforeHooks = beforeHooks
+		// the hooks and what follows run on first boot, in order
+		hooks.WaitFor(preseedDone)
+		if n := len(all); n != 0 {
+			hooks.WaitAll(all[n-1])
+		}
+		return append(all, ts), nil
+	}
+	chainSorted := func(infos []*snap.Info, infoToTs map[*snap.Info]*state.TaskSet) error {
 		sort.Stable(snap.ByType(infos))
 		for _, info := range infos {
 			ts := infoToTs[info]
-			tsAll = chainTs(tsAll, ts)
+			var err error
+			tsAll, err = chainInstallTs(tsAll, ts)
+			if err != nil {
+				return err
+			}
 		}
+		return nil
 	}
 
 	essInfoToTs := make(map[*snap.Info]*state.TaskSet, len(essentialSeedSnaps))
@@ -151,7 +203,9 @@ func populateStateFromSeedImpl(st *state.State, tm timings.Measurer) ([]*state.T
 	}
 	// now add/chain the tasksets in the right order based on essential
 	// snap types
-	chainSorted(essInfos, essInfoToTs)
+	if err := chainSorted(essInfos, essInfoToTs); err != nil {
+		return nil, err
+	}
 
 	// chain together configuring core, kernel, and gadget after
 	// installing them so that defaults are availabble from gadget
@@ -184,7 +238,9 @@ func populateStateFromSeedImpl(st *state.State, tm timings.Measurer) ([]*state.T
 
 	// now add/chain the tasksets in the right order, note that we
 	// only have tasksets that we did not already seeded
-	chainSorted(infos, infoToTs)
+	if err := chainSorted(infos, infoToTs); err != nil {
+		return nil, err
+	}
 
 	if len(tsAll) == 0 {
 		return nil, fmt.Errorf("cannot proceed, no snaps to seed")
@@ -192,6 +248,9 @@ func populateStateFromSeedImpl(st *state.State, tm timings.Measurer) ([]*state.T
 
 	ts := tsAll[len(tsAll)-1]
 	endTs := state.NewTaskSet()
+	if preseedDone != nil {
+		endTs.AddTask(preseedDone)
+	}
 	if model.Gadget() != "" {
 		// we have a gadget that could have interface
 		// connection instructions
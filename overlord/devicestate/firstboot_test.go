@@ -53,6 +53,7 @@ import (
 	"github.com/snapcore/snapd/seed/seedtest"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/snapdenv"
 	"github.com/snapcore/snapd/systemd"
 	"github.com/snapcore/snapd/testutil"
 	"github.com/snapcore/snapd/timings"
@@ -988,7 +989,7 @@ func (s *FirstBootTestSuite) TestImportAssertionsFromSeedClassicModelMismatch(c
 	st.Lock()
 	defer st.Unlock()
 
-	deviceSeed, err := seed.Open(dirs.SnapSeedDir)
+	deviceSeed, err := seed.Open(dirs.SnapSeedDir, "")
 	c.Assert(err, IsNil)
 
 	_, err = devicestate.ImportAssertionsFromSeed(st, deviceSeed)
@@ -1008,7 +1009,7 @@ func (s *FirstBootTestSuite) TestImportAssertionsFromSeedAllSnapsModelMismatch(c
 	st.Lock()
 	defer st.Unlock()
 
-	deviceSeed, err := seed.Open(dirs.SnapSeedDir)
+	deviceSeed, err := seed.Open(dirs.SnapSeedDir, "")
 	c.Assert(err, IsNil)
 
 	_, err = devicestate.ImportAssertionsFromSeed(st, deviceSeed)
@@ -1034,7 +1035,7 @@ func (s *FirstBootTestSuite) TestImportAssertionsFromSeedHappy(c *C) {
 	st.Lock()
 	defer st.Unlock()
 
-	deviceSeed, err := seed.Open(dirs.SnapSeedDir)
+	deviceSeed, err := seed.Open(dirs.SnapSeedDir, "")
 	c.Assert(err, IsNil)
 
 	model, err := devicestate.ImportAssertionsFromSeed(st, deviceSeed)
@@ -1075,7 +1076,7 @@ func (s *FirstBootTestSuite) TestImportAssertionsFromSeedMissingSig(c *C) {
 		}
 	}
 
-	deviceSeed, err := seed.Open(dirs.SnapSeedDir)
+	deviceSeed, err := seed.Open(dirs.SnapSeedDir, "")
 	c.Assert(err, IsNil)
 
 	// try import and verify that its rejects because other assertions are
@@ -1096,7 +1097,7 @@ func (s *FirstBootTestSuite) TestImportAssertionsFromSeedTwoModelAsserts(c *C) {
 	model2 := s.Brands.Model("my-brand", "my-second-model", s.modelHeaders("my-second-model"))
 	s.WriteAssertions("model2", model2)
 
-	deviceSeed, err := seed.Open(dirs.SnapSeedDir)
+	deviceSeed, err := seed.Open(dirs.SnapSeedDir, "")
 	c.Assert(err, IsNil)
 
 	// try import and verify that its rejects because other assertions are
@@ -1117,7 +1118,7 @@ func (s *FirstBootTestSuite) TestImportAssertionsFromSeedNoModelAsserts(c *C) {
 		}
 	}
 
-	deviceSeed, err := seed.Open(dirs.SnapSeedDir)
+	deviceSeed, err := seed.Open(dirs.SnapSeedDir, "")
 	c.Assert(err, IsNil)
 
 	// try import and verify that its rejects because other assertions are
@@ -1630,6 +1631,108 @@ snaps:
 	c.Check(seedTime.IsZero(), Equals, false)
 }
 
+func (s *FirstBootTestSuite) TestPopulateFromSeedOnClassicPreseeding(c *C) {
+	restore := release.MockOnClassic(true)
+	defer restore()
+	restore = snapdenv.MockPreseeding(true)
+	defer restore()
+
+	core18Fname, snapdFname, _, _ := s.makeCore18Snaps(c, &core18SnapsOpts{
+		classic: true,
+	})
+
+	snapYaml := `name: foo
+version: 1.0
+base: core18
+`
+	fooFname, fooDecl, fooRev := s.MakeAssertedSnap(c, snapYaml, nil, snap.R(128), "developerid")
+	s.WriteAssertions("foo.asserts", s.devAcct, fooRev, fooDecl)
+
+	assertsChain := s.makeModelAssertionChain(c, "my-model-classic", nil)
+	s.WriteAssertions("model.asserts", assertsChain...)
+
+	content := []byte(fmt.Sprintf(`
+snaps:
+ - name: snapd
+   file: %s
+ - name: foo
+   file: %s
+ - name: core18
+   file: %s
+`, snapdFname, fooFname, core18Fname))
+	err := ioutil.WriteFile(filepath.Join(dirs.SnapSeedDir, "seed.yaml"), content, 0644)
+	c.Assert(err, IsNil)
+
+	st := s.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	tsAll, err := devicestate.PopulateStateFromSeedImpl(st, s.perfTimings)
+	c.Assert(err, IsNil)
+
+	// mark-preseeded comes before mark-seeded in the last taskset
+	lastTasks := tsAll[len(tsAll)-1].Tasks()
+	c.Assert(lastTasks, HasLen, 2)
+	markPreseeded := lastTasks[0]
+	c.Check(markPreseeded.Kind(), Equals, "mark-preseeded")
+	c.Check(lastTasks[1].Kind(), Equals, "mark-seeded")
+
+	var prevBeforeHooks *state.Task
+	var installTss int
+	for _, ts := range tsAll {
+		begin, err := ts.Edge(snapstate.BeginEdge)
+		if err != nil {
+			// not an install taskset
+			continue
+		}
+		installTss++
+		beforeHooks, err := ts.Edge(snapstate.BeforeHooksEdge)
+		c.Assert(err, IsNil)
+		hooks, err := ts.Edge(snapstate.HooksEdge)
+		c.Assert(err, IsNil)
+
+		// the setup of each snap follows the setup of the previous
+		// one, without waiting for its hooks
+		if prevBeforeHooks != nil {
+			c.Check(begin.WaitTasks(), DeepEquals, []*state.Task{prevBeforeHooks})
+		} else {
+			c.Check(begin.WaitTasks(), HasLen, 0)
+		}
+		prevBeforeHooks = beforeHooks
+
+		// mark-preseeded runs after the setup of all snaps and
+		// before any of the hooks
+		c.Check(markPreseeded.WaitTasks(), testutil.Contains, beforeHooks)
+		c.Check(hooks.WaitTasks(), testutil.Contains, markPreseeded)
+	}
+	c.Check(installTss, Equals, 3)
+}
+
+func (s *FirstBootTestSuite) TestPopulateFromSeedOnClassicNoopPreseeding(c *C) {
+	restore := release.MockOnClassic(true)
+	defer restore()
+	restore = snapdenv.MockPreseeding(true)
+	defer restore()
+
+	st := s.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	err := os.Remove(filepath.Join(dirs.SnapSeedDir, "assertions"))
+	c.Assert(err, IsNil)
+
+	tsAll, err := devicestate.PopulateStateFromSeedImpl(st, s.perfTimings)
+	c.Assert(err, IsNil)
+	c.Assert(tsAll, HasLen, 3)
+
+	markPreseeded := tsAll[0].Tasks()[0]
+	c.Check(markPreseeded.Kind(), Equals, "mark-preseeded")
+	configTasks := tsAll[1].Tasks()
+	c.Assert(configTasks, HasLen, 1)
+	c.Check(configTasks[0].Kind(), Equals, "run-hook")
+	c.Check(configTasks[0].WaitTasks(), DeepEquals, []*state.Task{markPreseeded})
+	c.Check(tsAll[2].Tasks()[0].Kind(), Equals, "mark-seeded")
+}
+
 func (s *FirstBootTestSuite) TestPopulateFromSeedOnClassicWithSnapdOnlyAndGadgetHappy(c *C) {
 	restore := release.MockOnClassic(true)
 	defer restore()
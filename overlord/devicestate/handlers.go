@@ -29,6 +29,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -37,9 +38,11 @@ import (
 	"gopkg.in/tomb.v2"
 
 	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/boot"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/gadget"
 	"github.com/snapcore/snapd/httputil"
+	"github.com/snapcore/snapd/interfaces"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/assertstate"
@@ -67,6 +70,97 @@ func (m *DeviceManager) doMarkSeeded(t *state.Task, _ *tomb.Tomb) error {
 	return nil
 }
 
+// unmountSnap unmounts a snap mounted directly while preseeding, its
+// mount unit takes over on first boot.
+var unmountSnap = func(mountDir string) error {
+	if output, err := exec.Command("umount", "-d", "-l", mountDir).CombinedOutput(); err != nil {
+		return osutil.OutputErr(output, err)
+	}
+	return nil
+}
+
+func (m *DeviceManager) doMarkPreseeded(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	if m.preseed {
+		var preseeded bool
+		// the task may be retried while preseeding if something
+		// else triggers the runner before snapd stops
+		if err := t.Get("preseeded", &preseeded); err != nil && err != state.ErrNoState {
+			return err
+		}
+		if !preseeded {
+			snaps, err := snapstate.All(st)
+			if err != nil {
+				return err
+			}
+			for _, snapst := range snaps {
+				info, err := snapst.CurrentInfo()
+				if err != nil {
+					return err
+				}
+				st.Unlock()
+				err = unmountSnap(info.MountDir())
+				st.Lock()
+				if err != nil {
+					return fmt.Errorf("cannot unmount snap %q: %v", info.InstanceName(), err)
+				}
+			}
+
+			systemKey, err := interfaces.RecordedSystemKey()
+			if err != nil {
+				return fmt.Errorf("cannot get recorded system key: %v", err)
+			}
+			st.Set("preseed-system-key", systemKey)
+			st.Set("preseed-time", time.Now())
+			t.Set("preseeded", true)
+
+			st.RequestRestart(state.StopDaemon)
+		}
+		// stay in Doing, the task completes on first boot
+		return &state.Retry{}
+	}
+
+	// first boot of a preseeded image
+	var rawKey json.RawMessage
+	if err := st.Get("preseed-system-key", &rawKey); err != nil {
+		return fmt.Errorf("cannot get the system key recorded when preseeding: %v", err)
+	}
+	preseedKey, err := interfaces.UnmarshalJSONSystemKey(bytes.NewReader(rawKey))
+	if err != nil {
+		return fmt.Errorf("cannot decode the system key recorded when preseeding: %v", err)
+	}
+	currentKey, err := interfaces.CurrentSystemKey()
+	if err != nil {
+		return fmt.Errorf("cannot get the current system key: %v", err)
+	}
+	match, err := interfaces.SystemKeysMatch(preseedKey, currentKey)
+	if err != nil && err != interfaces.ErrSystemKeyVersion {
+		return err
+	}
+	if !match {
+		// the interface manager regenerates the security profiles on
+		// startup when the system key changed, and only records the
+		// new system key if that succeeded
+		recordedKey, err := interfaces.RecordedSystemKey()
+		if err != nil {
+			return fmt.Errorf("cannot get recorded system key: %v", err)
+		}
+		regenerated, err := interfaces.SystemKeysMatch(recordedKey, currentKey)
+		if err != nil && err != interfaces.ErrSystemKeyVersion {
+			return err
+		}
+		if !regenerated {
+			return fmt.Errorf("cannot use the preseeded image: its system key does not match the system and the security profiles were not regenerated")
+		}
+		t.Logf("System key of the preseeded image does not match the system, security profiles were regenerated")
+	}
+	st.Set("seed-restart-time", time.Now())
+	return nil
+}
+
 func isSameAssertsRevision(err error) bool {
 	if e, ok := err.(*asserts.RevisionError); ok {
 		if e.Used == e.Current {
@@ -990,7 +1084,10 @@ func gadgetCurrentAndUpdate(st *state.State, snapsup *snapstate.SnapSetup) (curr
 }
 
 var (
-	gadgetUpdate = gadget.Update
+	gadgetUpdate   = gadget.Update
+	gadgetRollback = gadget.Rollback
+
+	bootResealKeyForBootConfig = boot.ResealKeyForBootConfig
 )
 
 func (m *DeviceManager) doUpdateGadgetAssets(t *state.Task, _ *tomb.Tomb) error {
@@ -1007,6 +1104,16 @@ func (m *DeviceManager) doUpdateGadgetAssets(t *state.Task, _ *tomb.Tomb) error
 		return err
 	}
 
+	// the assets may have been updated already, in which case the
+	// task waits for the outcome of booting with them
+	upd, err := boot.TrackedAssetsUpdate()
+	if err != nil {
+		return err
+	}
+	if upd != nil && upd.Gadget == snapsup.InstanceName() && upd.ToRevision == snapsup.Revision() {
+		return finishGadgetAssetsUpdate(t, snapsup, upd)
+	}
+
 	currentData, updateData, err := gadgetCurrentAndUpdate(t.State(), snapsup)
 	if err != nil {
 		return err
@@ -1016,11 +1123,23 @@ func (m *DeviceManager) doUpdateGadgetAssets(t *state.Task, _ *tomb.Tomb) error
 		return nil
 	}
 
+	snapst, err := snapState(st, snapsup.InstanceName())
+	if err != nil {
+		return err
+	}
+
 	snapRollbackDir, err := makeRollbackDir(fmt.Sprintf("%v_%v", snapsup.InstanceName(), snapsup.SideInfo.Revision))
 	if err != nil {
 		return fmt.Errorf("cannot prepare update rollback directory: %v", err)
 	}
 
+	// the key of the encrypted data, if any, must be resealed to
+	// the updated boot configuration
+	oldBootConfig, err := boot.CurrentBootConfig()
+	if err != nil {
+		return fmt.Errorf("cannot read current boot configuration: %v", err)
+	}
+
 	st.Unlock()
 	err = gadgetUpdate(*currentData, *updateData, snapRollbackDir)
 	st.Lock()
@@ -1033,15 +1152,73 @@ func (m *DeviceManager) doUpdateGadgetAssets(t *state.Task, _ *tomb.Tomb) error
 		return err
 	}
 
-	t.SetStatus(state.DoneStatus)
+	rollback := func() {
+		st.Unlock()
+		rerr := gadgetRollback(*currentData, *updateData, snapRollbackDir)
+		st.Lock()
+		if rerr != nil {
+			logger.Noticef("cannot rollback gadget assets update: %v", rerr)
+		}
+	}
+
+	if err := bootResealKeyForBootConfig(oldBootConfig); err != nil {
+		// the data could not be unlocked with the updated assets
+		rollback()
+		return fmt.Errorf("cannot reseal the encryption key: %v", err)
+	}
 
-	if err := os.RemoveAll(snapRollbackDir); err != nil && !os.IsNotExist(err) {
-		logger.Noticef("failed to remove gadget update rollback directory %q: %v", snapRollbackDir, err)
+	if err := boot.TrackAssetsUpdate(snapsup.InstanceName(), snapst.Current, snapsup.Revision(), snapRollbackDir); err != nil {
+		// a failure to boot with the updated assets could not be
+		// detected, do not keep them
+		rollback()
+		return fmt.Errorf("cannot track gadget assets update: %v", err)
 	}
 
 	// TODO: consider having the option to do this early via recovery in
 	// core20, have fallback code as well there
 	st.RequestRestart(state.RestartSystem)
 
-	return nil
+	// wait for the outcome of booting with the updated assets
+	return &state.Retry{}
+}
+
+// finishGadgetAssetsUpdate completes the update of the gadget assets
+// once the system was rebooted, restoring the previous assets if the
+// system could not boot with the updated ones.
+func finishGadgetAssetsUpdate(t *state.Task, snapsup *snapstate.SnapSetup, upd *boot.AssetsUpdate) error {
+	st := t.State()
+
+	switch upd.Status {
+	case boot.AssetsUpdateSucceeded:
+		if err := boot.ClearAssetsUpdate(); err != nil {
+			return err
+		}
+		if err := os.RemoveAll(upd.RollbackDir); err != nil && !os.IsNotExist(err) {
+			logger.Noticef("failed to remove gadget update rollback directory %q: %v", upd.RollbackDir, err)
+		}
+		return nil
+	case boot.AssetsUpdateFailed:
+		if err := upd.VerifyBackup(); err != nil {
+			return fmt.Errorf("cannot restore previous gadget assets: %v", err)
+		}
+		currentData, updateData, err := gadgetCurrentAndUpdate(st, snapsup)
+		if err != nil {
+			return err
+		}
+		st.Unlock()
+		err = gadgetRollback(*currentData, *updateData, upd.RollbackDir)
+		st.Lock()
+		if err != nil {
+			return fmt.Errorf("cannot restore previous gadget assets: %v", err)
+		}
+		if err := boot.ClearAssetsUpdate(); err != nil {
+			return err
+		}
+		t.Logf("Restored the previous gadget assets")
+		// the refresh of the gadget is undone
+		return fmt.Errorf("cannot boot with the updated gadget assets")
+	default:
+		// not rebooted yet
+		return &state.Retry{}
+	}
 }
@@ -0,0 +1,106 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ctlcmd
+
+import (
+	"fmt"
+
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/overlord/ifacestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+)
+
+var (
+	shortIsConnectedHelp = i18n.G(`Return success if the given plug or slot is connected`)
+	longIsConnectedHelp  = i18n.G(`
+The is-connected command returns success if the given plug or slot of the
+calling snap is connected, and failure otherwise. It can be called from hooks
+as well as from the apps of the snap.
+
+$ snapctl is-connected plug
+$ echo $?
+1
+
+Snaps can only query their own plugs and slots - snap name is implicit and
+implied by the snapctl execution context.
+`)
+)
+
+func init() {
+	addCommand("is-connected", shortIsConnectedHelp, longIsConnectedHelp, func() command { return &isConnectedCommand{} })
+}
+
+type isConnectedCommand struct {
+	baseCommand
+
+	Positional struct {
+		PlugOrSlotSpec string `positional-arg-name:"<plug|slot>"`
+	} `positional-args:"true" required:"true"`
+}
+
+func (c *isConnectedCommand) Execute(args []string) error {
+	plugOrSlot := c.Positional.PlugOrSlotSpec
+
+	context := c.context()
+	if context == nil {
+		return fmt.Errorf(i18n.G("cannot %s without a context"), "check connection")
+	}
+
+	snapName := context.InstanceName()
+
+	st := context.State()
+	st.Lock()
+	defer st.Unlock()
+
+	info, err := snapstate.CurrentInfo(st, snapName)
+	if err != nil {
+		return fmt.Errorf("cannot get snap %q info: %v", snapName, err)
+	}
+	if info.Plugs[plugOrSlot] == nil && info.Slots[plugOrSlot] == nil {
+		return fmt.Errorf("snap %q has no plug or slot named %q", snapName, plugOrSlot)
+	}
+
+	conns, err := ifacestate.ConnectionStates(st)
+	if err != nil {
+		return fmt.Errorf("internal error: cannot get connections: %s", err)
+	}
+
+	// snapName is the name of the snap executing snapctl command, it's
+	// obtained from the context (ephemeral if run by apps, or full if run by
+	// hooks). plug and slot names are unique within a snap, so there is no
+	// ambiguity when matching.
+	for refStr, connState := range conns {
+		if !connState.Active() {
+			continue
+		}
+		connRef, err := interfaces.ParseConnRef(refStr)
+		if err != nil {
+			return fmt.Errorf("internal error: %s", err)
+		}
+		matchingPlug := connRef.PlugRef.Snap == snapName && connRef.PlugRef.Name == plugOrSlot
+		matchingSlot := connRef.SlotRef.Snap == snapName && connRef.SlotRef.Name == plugOrSlot
+		if matchingPlug || matchingSlot {
+			return nil
+		}
+	}
+
+	return &UnsuccessfulError{ExitCode: 1}
+}
@@ -0,0 +1,162 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ctlcmd_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/hookstate/ctlcmd"
+	"github.com/snapcore/snapd/overlord/hookstate/hooktest"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type isConnectedSuite struct {
+	testutil.BaseTest
+	st          *state.State
+	mockHandler *hooktest.MockHandler
+}
+
+var _ = Suite(&isConnectedSuite{})
+
+const isConnectedTestSnapYaml = `name: snap1
+version: 1.0
+plugs:
+  plug1:
+    interface: x11
+  plug2:
+    interface: x11
+  plug3:
+    interface: x11
+slots:
+  slot1:
+    interface: x11
+`
+
+const isConnectedOtherSnapYaml = `name: snap2
+version: 1.0
+plugs:
+  plug:
+    interface: x11
+slots:
+  slot:
+    interface: x11
+`
+
+func (s *isConnectedSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("/") })
+	s.AddCleanup(snap.MockSanitizePlugsSlots(func(snapInfo *snap.Info) {}))
+	s.mockHandler = hooktest.NewMockHandler()
+
+	s.st = state.New(nil)
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	for _, yaml := range []string{isConnectedTestSnapYaml, isConnectedOtherSnapYaml} {
+		info := snaptest.MockSnapCurrent(c, yaml, &snap.SideInfo{Revision: snap.R(1)})
+		snapstate.Set(s.st, info.InstanceName(), &snapstate.SnapState{
+			Active:   true,
+			Sequence: []*snap.SideInfo{{RealName: info.SnapName(), Revision: info.Revision}},
+			Current:  info.Revision,
+		})
+	}
+
+	s.st.Set("conns", map[string]interface{}{
+		"snap1:plug1 snap2:slot": map[string]interface{}{
+			"interface": "x11",
+		},
+		"snap1:plug2 snap2:slot": map[string]interface{}{
+			"interface": "x11",
+			"undesired": true,
+		},
+		"snap2:plug snap1:slot1": map[string]interface{}{
+			"interface": "x11",
+		},
+	})
+}
+
+func (s *isConnectedSuite) context(c *C, snapName string) *hookstate.Context {
+	s.st.Lock()
+	defer s.st.Unlock()
+	task := s.st.NewTask("test-task", "my test task")
+	setup := &hookstate.HookSetup{Snap: snapName, Revision: snap.R(1), Hook: "test-hook"}
+	ctx, err := hookstate.NewContext(task, s.st, setup, s.mockHandler, "")
+	c.Assert(err, IsNil)
+	return ctx
+}
+
+func (s *isConnectedSuite) TestIsConnected(c *C) {
+	ctx := s.context(c, "snap1")
+	for _, t := range []struct {
+		plugOrSlot string
+		connected  bool
+	}{
+		{"plug1", true},
+		// undesired connections are not connected
+		{"plug2", false},
+		{"plug3", false},
+		{"slot1", true},
+	} {
+		stdout, stderr, err := ctlcmd.Run(ctx, []string{"is-connected", t.plugOrSlot}, 0)
+		comment := Commentf("%s", t.plugOrSlot)
+		if t.connected {
+			c.Check(err, IsNil, comment)
+		} else {
+			c.Check(err, DeepEquals, &ctlcmd.UnsuccessfulError{ExitCode: 1}, comment)
+		}
+		c.Check(string(stdout), Equals, "", comment)
+		c.Check(string(stderr), Equals, "", comment)
+	}
+}
+
+func (s *isConnectedSuite) TestIsConnectedOnlyOwnPlugsAndSlots(c *C) {
+	// snap2 has a plug named "plug" but snap1 doesn't
+	ctx := s.context(c, "snap1")
+	_, _, err := ctlcmd.Run(ctx, []string{"is-connected", "plug"}, 0)
+	c.Check(err, ErrorMatches, `snap "snap1" has no plug or slot named "plug"`)
+
+	ctx = s.context(c, "snap2")
+	_, _, err = ctlcmd.Run(ctx, []string{"is-connected", "slot"}, 0)
+	c.Check(err, IsNil)
+}
+
+func (s *isConnectedSuite) TestIsConnectedAllowedForRegularUsers(c *C) {
+	ctx := s.context(c, "snap1")
+	_, _, err := ctlcmd.Run(ctx, []string{"is-connected", "plug1"}, 1000)
+	c.Check(err, IsNil)
+}
+
+func (s *isConnectedSuite) TestIsConnectedNoContext(c *C) {
+	_, _, err := ctlcmd.Run(nil, []string{"is-connected", "plug1"}, 0)
+	c.Check(err, ErrorMatches, `cannot check connection without a context`)
+}
+
+func (s *isConnectedSuite) TestIsConnectedNoArgs(c *C) {
+	ctx := s.context(c, "snap1")
+	_, _, err := ctlcmd.Run(ctx, []string{"is-connected"}, 0)
+	c.Check(err, ErrorMatches, "the required argument `<plug|slot>` was not provided")
+}
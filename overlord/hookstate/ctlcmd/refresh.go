@@ -0,0 +1,153 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ctlcmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+var (
+	shortRefreshHelp = i18n.G("Query and control the refreshes of the snap")
+	longRefreshHelp  = i18n.G(`
+The refresh command lets a snap query whether an update of it is pending,
+and hold or let proceed its own automatic refreshes.
+
+$ snapctl refresh --pending
+pending: ready
+channel: latest/stable
+version: 2.0
+revision: 12
+
+With --hold the automatic refreshes of the snap are held back, for at most
+a week since the snap first held them. With --proceed they are let go
+ahead again, with the next automatic refresh.
+
+From the gate-auto-refresh hook, --hold and --proceed instead apply to the
+refreshes of the snaps affecting the snap, such as its base or the snaps
+providing content to it. Those refreshes go ahead unless the hook holds
+them.
+
+Snaps can only query and control their own refreshes - snap name is implicit
+and implied by the snapctl execution context.
+`)
+)
+
+func init() {
+	addCommand("refresh", shortRefreshHelp, longRefreshHelp, func() command { return &refreshCommand{} })
+}
+
+type refreshCommand struct {
+	baseCommand
+
+	Pending bool `long:"pending" description:"Show whether an update of the snap is pending"`
+	Hold    bool `long:"hold" description:"Hold the automatic refreshes of the snap"`
+	Proceed bool `long:"proceed" description:"Let the automatic refreshes of the snap proceed"`
+}
+
+func (c *refreshCommand) Execute(args []string) error {
+	context := c.context()
+	if context == nil {
+		return fmt.Errorf(i18n.G("cannot %s without a context"), "run refresh")
+	}
+
+	n := 0
+	for _, opt := range []bool{c.Pending, c.Hold, c.Proceed} {
+		if opt {
+			n++
+		}
+	}
+	if n != 1 {
+		return errors.New(i18n.G("exactly one of --pending, --hold or --proceed is required"))
+	}
+
+	context.Lock()
+	defer context.Unlock()
+
+	st := context.State()
+	snapName := context.InstanceName()
+	if context.HookName() == "gate-auto-refresh" && !c.Pending {
+		var affecting []string
+		if err := context.Get("affecting-snaps", &affecting); err != nil && err != state.ErrNoState {
+			return err
+		}
+		if c.Hold {
+			return snapstate.HoldRefreshesBy(st, snapName, affecting)
+		}
+		return snapstate.ProceedWithRefreshesBy(st, snapName, affecting)
+	}
+
+	switch {
+	case c.Hold:
+		_, err := snapstate.HoldRefreshBySnap(st, snapName)
+		return err
+	case c.Proceed:
+		return snapstate.ProceedWithRefresh(st, snapName)
+	}
+	return c.printPending(st, snapName)
+}
+
+var timeNow = time.Now
+
+func (c *refreshCommand) printPending(st *state.State, snapName string) error {
+	var snapst snapstate.SnapState
+	if err := snapstate.Get(st, snapName, &snapst); err != nil {
+		return fmt.Errorf("cannot get state of snap %q: %v", snapName, err)
+	}
+	cand, err := snapstate.PendingRefresh(st, snapName)
+	if err != nil {
+		return err
+	}
+
+	now := timeNow()
+	pending := "none"
+	switch {
+	case cand == nil:
+	case snapst.RefreshHeld(now):
+		pending = "held"
+	case snapst.RefreshInhibitedTime != nil:
+		pending = "inhibited"
+	default:
+		pending = "ready"
+	}
+
+	c.printf("pending: %s\n", pending)
+	if cand != nil {
+		if cand.Channel != "" {
+			c.printf("channel: %s\n", cand.Channel)
+		}
+		if cand.Version != "" {
+			c.printf("version: %s\n", cand.Version)
+		}
+		c.printf("revision: %s\n", cand.Revision)
+	}
+	if snapst.RefreshHeld(now) {
+		c.printf("held-until: %s\n", snapst.RefreshHeldUntil().Format(time.RFC3339))
+	}
+	if snapst.RefreshInhibitedTime != nil {
+		c.printf("inhibited-since: %s\n", snapst.RefreshInhibitedTime.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ctlcmd_test
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/hookstate/ctlcmd"
+	"github.com/snapcore/snapd/overlord/hookstate/hooktest"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+type refreshSuite struct {
+	st          *state.State
+	mockHandler *hooktest.MockHandler
+	ctx         *hookstate.Context
+}
+
+var _ = Suite(&refreshSuite{})
+
+func (s *refreshSuite) SetUpTest(c *C) {
+	s.mockHandler = hooktest.NewMockHandler()
+
+	s.st = state.New(nil)
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	si := &snap.SideInfo{RealName: "snap1", Revision: snap.R(1)}
+	snapstate.Set(s.st, "snap1", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{si},
+		Current:  si.Revision,
+	})
+
+	task := s.st.NewTask("test-task", "my test task")
+	setup := &hookstate.HookSetup{Snap: "snap1", Revision: snap.R(1), Hook: "test-hook"}
+	var err error
+	s.ctx, err = hookstate.NewContext(task, s.st, setup, s.mockHandler, "")
+	c.Assert(err, IsNil)
+}
+
+func (s *refreshSuite) setCandidate(rev int) {
+	s.st.Lock()
+	defer s.st.Unlock()
+	s.st.Set("refresh-candidates", map[string]*snapstate.RefreshCandidate{
+		"snap1": {Channel: "latest/stable", Version: "2.0", Revision: snap.R(rev)},
+	})
+}
+
+func (s *refreshSuite) TestPendingNone(c *C) {
+	stdout, stderr, err := ctlcmd.Run(s.ctx, []string{"refresh", "--pending"}, 0)
+	c.Assert(err, IsNil)
+	c.Check(string(stdout), Equals, "pending: none\n")
+	c.Check(string(stderr), Equals, "")
+
+	// a candidate that is already current is not pending
+	s.setCandidate(1)
+	stdout, _, err = ctlcmd.Run(s.ctx, []string{"refresh", "--pending"}, 0)
+	c.Assert(err, IsNil)
+	c.Check(string(stdout), Equals, "pending: none\n")
+}
+
+func (s *refreshSuite) TestPendingReady(c *C) {
+	s.setCandidate(2)
+	stdout, _, err := ctlcmd.Run(s.ctx, []string{"refresh", "--pending"}, 0)
+	c.Assert(err, IsNil)
+	c.Check(string(stdout), Equals, `pending: ready
+channel: latest/stable
+version: 2.0
+revision: 2
+`)
+}
+
+func (s *refreshSuite) TestPendingInhibited(c *C) {
+	s.setCandidate(2)
+	inhibited := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	s.st.Lock()
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.st, "snap1", &snapst), IsNil)
+	snapst.RefreshInhibitedTime = &inhibited
+	snapstate.Set(s.st, "snap1", &snapst)
+	s.st.Unlock()
+
+	stdout, _, err := ctlcmd.Run(s.ctx, []string{"refresh", "--pending"}, 0)
+	c.Assert(err, IsNil)
+	c.Check(string(stdout), Equals, `pending: inhibited
+channel: latest/stable
+version: 2.0
+revision: 2
+inhibited-since: 2020-03-01T10:00:00Z
+`)
+}
+
+func (s *refreshSuite) TestPendingHeld(c *C) {
+	s.setCandidate(2)
+	now := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+	defer ctlcmd.MockTimeNow(func() time.Time { return now })()
+
+	s.st.Lock()
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.st, "snap1", &snapst), IsNil)
+	snapst.RefreshSelfHold = &snapstate.RefreshSelfHold{
+		Since: now,
+		Until: now.Add(24 * time.Hour),
+	}
+	snapstate.Set(s.st, "snap1", &snapst)
+	s.st.Unlock()
+
+	stdout, _, err := ctlcmd.Run(s.ctx, []string{"refresh", "--pending"}, 0)
+	c.Assert(err, IsNil)
+	c.Check(string(stdout), Equals, `pending: held
+channel: latest/stable
+version: 2.0
+revision: 2
+held-until: 2020-03-02T10:00:00Z
+`)
+
+	// the hold is over
+	now = now.Add(25 * time.Hour)
+	stdout, _, err = ctlcmd.Run(s.ctx, []string{"refresh", "--pending"}, 0)
+	c.Assert(err, IsNil)
+	c.Check(string(stdout), Equals, `pending: ready
+channel: latest/stable
+version: 2.0
+revision: 2
+`)
+}
+
+func (s *refreshSuite) TestHoldAndProceed(c *C) {
+	s.setCandidate(2)
+
+	stdout, _, err := ctlcmd.Run(s.ctx, []string{"refresh", "--hold"}, 0)
+	c.Assert(err, IsNil)
+	c.Check(string(stdout), Equals, "")
+
+	s.st.Lock()
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.st, "snap1", &snapst), IsNil)
+	s.st.Unlock()
+	c.Assert(snapst.RefreshSelfHold, NotNil)
+	heldUntil := snapst.RefreshSelfHold.Until.Format(time.RFC3339)
+
+	stdout, _, err = ctlcmd.Run(s.ctx, []string{"refresh", "--pending"}, 0)
+	c.Assert(err, IsNil)
+	c.Check(string(stdout), Equals, `pending: held
+channel: latest/stable
+version: 2.0
+revision: 2
+held-until: `+heldUntil+`
+`)
+
+	stdout, _, err = ctlcmd.Run(s.ctx, []string{"refresh", "--proceed"}, 0)
+	c.Assert(err, IsNil)
+	c.Check(string(stdout), Equals, "")
+
+	stdout, _, err = ctlcmd.Run(s.ctx, []string{"refresh", "--pending"}, 0)
+	c.Assert(err, IsNil)
+	c.Check(string(stdout), Equals, `pending: ready
+channel: latest/stable
+version: 2.0
+revision: 2
+`)
+}
+
+func (s *refreshSuite) TestHoldTooLong(c *C) {
+	s.st.Lock()
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.st, "snap1", &snapst), IsNil)
+	snapst.RefreshSelfHold = &snapstate.RefreshSelfHold{Since: time.Now().Add(-8 * 24 * time.Hour)}
+	snapstate.Set(s.st, "snap1", &snapst)
+	s.st.Unlock()
+
+	_, _, err := ctlcmd.Run(s.ctx, []string{"refresh", "--hold"}, 0)
+	c.Check(err, ErrorMatches, `cannot hold refreshes of snap "snap1" any longer: held since .*`)
+}
+
+func (s *refreshSuite) TestOptionErrors(c *C) {
+	for _, args := range [][]string{
+		{"refresh"},
+		{"refresh", "--pending", "--hold"},
+		{"refresh", "--hold", "--proceed"},
+	} {
+		_, _, err := ctlcmd.Run(s.ctx, args, 0)
+		c.Check(err, ErrorMatches, `exactly one of --pending, --hold or --proceed is required`, Commentf("%v", args))
+	}
+}
+
+func (s *refreshSuite) TestNoContext(c *C) {
+	_, _, err := ctlcmd.Run(nil, []string{"refresh", "--pending"}, 0)
+	c.Check(err, ErrorMatches, `cannot run refresh without a context`)
+}
+
+func (s *refreshSuite) TestPendingRegularUser(c *C) {
+	s.setCandidate(2)
+	stdout, _, err := ctlcmd.Run(s.ctx, []string{"refresh", "--pending"}, 1000)
+	c.Assert(err, IsNil)
+	c.Check(string(stdout), Equals, `pending: ready
+channel: latest/stable
+version: 2.0
+revision: 2
+`)
+}
+
+func (s *refreshSuite) gateHookContext(c *C, affecting []string) *hookstate.Context {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	si := &snap.SideInfo{RealName: "base1", Revision: snap.R(3)}
+	snapstate.Set(s.st, "base1", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{si},
+		Current:  si.Revision,
+		SnapType: "base",
+	})
+
+	task := s.st.NewTask("run-hook", "gate hook")
+	task.Set("hook-context", map[string]interface{}{"affecting-snaps": affecting})
+	setup := &hookstate.HookSetup{Snap: "snap1", Revision: snap.R(1), Hook: "gate-auto-refresh"}
+	ctx, err := hookstate.NewContext(task, s.st, setup, s.mockHandler, "")
+	c.Assert(err, IsNil)
+	return ctx
+}
+
+func (s *refreshSuite) TestGateHookHoldAndProceed(c *C) {
+	ctx := s.gateHookContext(c, []string{"base1", "snap1"})
+
+	_, _, err := ctlcmd.Run(ctx, []string{"refresh", "--hold"}, 0)
+	c.Assert(err, IsNil)
+
+	s.st.Lock()
+	var holds map[string]map[string]struct {
+		Until time.Time `json:"until"`
+	}
+	c.Assert(s.st.Get("refresh-gating-holds", &holds), IsNil)
+	c.Check(holds["base1"]["snap1"].Until.After(time.Now()), Equals, true)
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.st, "snap1", &snapst), IsNil)
+	c.Check(snapst.RefreshHeld(time.Now()), Equals, true)
+	s.st.Unlock()
+
+	_, _, err = ctlcmd.Run(ctx, []string{"refresh", "--proceed"}, 0)
+	c.Assert(err, IsNil)
+
+	s.st.Lock()
+	defer s.st.Unlock()
+	c.Assert(s.st.Get("refresh-gating-holds", &holds), IsNil)
+	c.Check(holds["base1"]["snap1"].Until.IsZero(), Equals, true)
+	c.Assert(snapstate.Get(s.st, "snap1", &snapst), IsNil)
+	c.Check(snapst.RefreshHeld(time.Now()), Equals, false)
+}
@@ -90,6 +90,10 @@ func (c *servicesCommand) Execute([]string) error {
 		if svc.Active {
 			current = i18n.G("active")
 		}
+		if svc.DaemonScope == snap.UserDaemon {
+			// the state of user services is per user
+			startup, current = "-", "-"
+		}
 		fmt.Fprintf(w, "%s.%s\t%s\t%s\t%s\n", svc.Snap, svc.Name, startup, current, cmd.ClientAppInfoNotes(&svc))
 	}
 
@@ -31,6 +31,7 @@ func init() {
 	snapstate.SetupPreRefreshHook = SetupPreRefreshHook
 	snapstate.SetupPostRefreshHook = SetupPostRefreshHook
 	snapstate.SetupRemoveHook = SetupRemoveHook
+	snapstate.SetupGateAutoRefreshHook = SetupGateAutoRefreshHook
 }
 
 func SetupInstallHook(st *state.State, snapName string) *state.Task {
@@ -99,6 +100,21 @@ func SetupRemoveHook(st *state.State, snapName string) *state.Task {
 	return task
 }
 
+// SetupGateAutoRefreshHook returns a task running the gate-auto-refresh
+// hook of the given snap, affected by the refresh of affectingSnaps.
+func SetupGateAutoRefreshHook(st *state.State, snapName string, affectingSnaps []string) *state.Task {
+	hooksup := &HookSetup{
+		Snap:        snapName,
+		Hook:        "gate-auto-refresh",
+		Optional:    true,
+		IgnoreError: true,
+	}
+
+	summary := fmt.Sprintf(i18n.G("Run gate-auto-refresh hook of %q snap if present"), hooksup.Snap)
+	contextData := map[string]interface{}{"affecting-snaps": affectingSnaps}
+	return HookTask(st, summary, hooksup, contextData)
+}
+
 func setupHooks(hookMgr *HookManager) {
 	handlerGenerator := func(context *Context) Handler {
 		return &snapHookHandler{}
@@ -108,4 +124,7 @@ func setupHooks(hookMgr *HookManager) {
 	hookMgr.Register(regexp.MustCompile("^post-refresh$"), handlerGenerator)
 	hookMgr.Register(regexp.MustCompile("^pre-refresh$"), handlerGenerator)
 	hookMgr.Register(regexp.MustCompile("^remove$"), handlerGenerator)
+	// the gate-auto-refresh hook holds refreshes only through
+	// "snapctl refresh --hold", so a missing or failing hook holds nothing
+	hookMgr.Register(regexp.MustCompile("^gate-auto-refresh$"), handlerGenerator)
 }
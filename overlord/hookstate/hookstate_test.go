@@ -435,6 +435,50 @@ func (s *hookManagerSuite) TestHookTaskHandleIgnoreErrorWorks(c *C) {
 	checkTaskLogContains(c, s.task, ".*ignoring failure in hook.*")
 }
 
+func (s *hookManagerSuite) TestGateAutoRefreshHookErrorHoldsNothing(c *C) {
+	const gatingYaml = `
+name: test-snap
+version: 1.0
+hooks:
+    gate-auto-refresh:
+`
+	si := &snap.SideInfo{RealName: "test-snap", SnapID: "some-snap-id", Revision: snap.R(1)}
+	snaptest.MockSnap(c, gatingYaml, si)
+
+	s.state.Lock()
+	snapstate.Set(s.state, "base-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "base-snap", Revision: snap.R(3)}},
+		Current:  snap.R(3),
+		SnapType: "base",
+	})
+	task := hookstate.SetupGateAutoRefreshHook(s.state, "test-snap", []string{"base-snap"})
+	chg := s.state.NewChange("gate", "...")
+	chg.AddTask(task)
+	s.change.Abort()
+	s.state.Unlock()
+
+	// the hook fails without holding anything
+	cmd := testutil.MockCommand(c, "snap", "exit 1")
+	defer cmd.Restore()
+
+	s.se.Ensure()
+	s.se.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Check(task.Status(), Equals, state.DoneStatus)
+	checkTaskLogContains(c, task, `.*ignoring failure in hook "gate-auto-refresh".*`)
+
+	var holds map[string]interface{}
+	err := s.state.Get("refresh-gating-holds", &holds)
+	if err != state.ErrNoState {
+		c.Assert(err, IsNil)
+		c.Check(holds, HasLen, 0)
+	}
+}
+
 func (s *hookManagerSuite) TestHookTaskEnforcesTimeout(c *C) {
 	var hooksup hookstate.HookSetup
 
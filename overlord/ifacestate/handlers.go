@@ -945,6 +945,25 @@ func batchConnectTasks(st *state.State, snapsup *snapstate.SnapSetup, conns map[
 	return ts, nil
 }
 
+// preferCoreSlots returns the given auto-connection candidate slots
+// without the one of ubuntu-core, if they are those of ubuntu-core and
+// core.
+func preferCoreSlots(candidates []*snap.SlotInfo) []*snap.SlotInfo {
+	// If we are in a core transition we may have both the old ubuntu-core
+	// snap and the new core snap providing the same interface. In that
+	// situation we want to ignore any candidates in ubuntu-core and simply
+	// go with those from the new core snap.
+	if len(candidates) == 2 {
+		switch {
+		case candidates[0].Snap.InstanceName() == "ubuntu-core" && candidates[1].Snap.InstanceName() == "core":
+			return candidates[1:2]
+		case candidates[1].Snap.InstanceName() == "ubuntu-core" && candidates[0].Snap.InstanceName() == "core":
+			return candidates[0:1]
+		}
+	}
+	return candidates
+}
+
 // doAutoConnect creates task(s) to connect the given snap to viable candidates.
 func (m *InterfaceManager) doAutoConnect(task *state.Task, _ *tomb.Tomb) error {
 	st := task.State()
@@ -1017,18 +1036,7 @@ func (m *InterfaceManager) doAutoConnect(task *state.Task, _ *tomb.Tomb) error {
 		if len(candidates) == 0 {
 			continue
 		}
-		// If we are in a core transition we may have both the old ubuntu-core
-		// snap and the new core snap providing the same interface. In that
-		// situation we want to ignore any candidates in ubuntu-core and simply
-		// go with those from the new core snap.
-		if len(candidates) == 2 {
-			switch {
-			case candidates[0].Snap.InstanceName() == "ubuntu-core" && candidates[1].Snap.InstanceName() == "core":
-				candidates = candidates[1:2]
-			case candidates[1].Snap.InstanceName() == "ubuntu-core" && candidates[0].Snap.InstanceName() == "core":
-				candidates = candidates[0:1]
-			}
-		}
+		candidates = preferCoreSlots(candidates)
 		if len(candidates) != 1 {
 			crefs := make([]string, len(candidates))
 			for i, candidate := range candidates {
@@ -1450,7 +1458,13 @@ func (m *InterfaceManager) doHotplugConnect(task *state.Task, _ *tomb.Tomb) erro
 		newconns = append(newconns, connRef)
 	}
 
-	if len(recreate) == 0 && len(newconns) == 0 {
+	// find the connections asked for by the hotplug connection rules of the gadget
+	gadgetconns, err := m.gadgetHotplugConnections(task, deviceCtx, slot, conns, newconns)
+	if err != nil {
+		return err
+	}
+
+	if len(recreate) == 0 && len(newconns) == 0 && len(gadgetconns) == 0 {
 		return nil
 	}
 
@@ -1472,6 +1486,14 @@ func (m *InterfaceManager) doHotplugConnect(task *state.Task, _ *tomb.Tomb) erro
 		}
 		connectTs.AddAll(ts)
 	}
+	// Create connect tasks and interface hooks for connections asked for by the gadget
+	for _, conn := range gadgetconns {
+		ts, err := connect(st, conn.PlugRef.Snap, conn.PlugRef.Name, conn.SlotRef.Snap, conn.SlotRef.Name, connectOpts{AutoConnect: true, ByGadget: true})
+		if err != nil {
+			return fmt.Errorf("internal error: connect of %q failed: %s", conn, err)
+		}
+		connectTs.AddAll(ts)
+	}
 
 	if len(connectTs.Tasks()) > 0 {
 		snapstate.InjectTasks(task, connectTs)
@@ -1484,6 +1506,65 @@ func (m *InterfaceManager) doHotplugConnect(task *state.Task, _ *tomb.Tomb) erro
 	return nil
 }
 
+// gadgetHotplugConnections returns the connections of the given hotplug slot
+// that the gadget asks for with its hotplug connection rules, other than
+// the existing ones and the given auto-connections.
+func (m *InterfaceManager) gadgetHotplugConnections(task *state.Task, deviceCtx snapstate.DeviceContext, slot *snap.SlotInfo, conns map[string]*connState, autoconns []*interfaces.ConnRef) ([]*interfaces.ConnRef, error) {
+	st := task.State()
+
+	hconns, err := snapstate.GadgetHotplugConnections(st, deviceCtx)
+	if err == state.ErrNoState {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(autoconns))
+	for _, connRef := range autoconns {
+		seen[connRef.ID()] = true
+	}
+
+	var gadgetconns []*interfaces.ConnRef
+	for _, hconn := range hconns {
+		if !hconn.Matches(slot.Interface, slot.Attrs) {
+			continue
+		}
+		plugSnapName, err := resolveSnapIDToName(st, hconn.Plug.SnapID)
+		if err != nil {
+			return nil, err
+		}
+		plug := m.repo.Plug(plugSnapName, hconn.Plug.Plug)
+		if plug == nil {
+			task.Logf("hotplug connect: ignoring missing plug %s:%s", hconn.Plug.SnapID, hconn.Plug.Plug)
+			continue
+		}
+		if plug.Interface != slot.Interface {
+			task.Logf("hotplug connect: ignoring plug %s:%s of interface %q", hconn.Plug.SnapID, hconn.Plug.Plug, plug.Interface)
+			continue
+		}
+
+		connRef := interfaces.NewConnRef(plug, slot)
+		key := connRef.ID()
+		if _, ok := conns[key]; ok || seen[key] {
+			// existing connection (or one with the Undesired flag set) or one
+			// made already, don't clobber it
+			continue
+		}
+
+		if err := checkAutoconnectConflicts(st, task, plug.Snap.InstanceName(), slot.Snap.InstanceName()); err != nil {
+			if retry, ok := err.(*state.Retry); ok {
+				task.Logf("hotplug connect will be retried: %s", retry.Reason)
+				return nil, err // will retry
+			}
+			return nil, fmt.Errorf("hotplug connect conflict check failed: %s", err)
+		}
+		seen[key] = true
+		gadgetconns = append(gadgetconns, connRef)
+	}
+	return gadgetconns, nil
+}
+
 // doHotplugUpdateSlot updates static attributes of a hotplug slot for given device.
 func (m *InterfaceManager) doHotplugUpdateSlot(task *state.Task, _ *tomb.Tomb) error {
 	st := task.State()
@@ -38,6 +38,7 @@ import (
 	"github.com/snapcore/snapd/overlord/ifacestate/udevmonitor"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/snaptest"
 	"github.com/snapcore/snapd/testutil"
@@ -484,6 +485,89 @@ func (s *hotplugSuite) TestHotplugAddWithAutoconnect(c *C) {
 	c.Assert(conn, NotNil)
 }
 
+func (s *hotplugSuite) TestHotplugAddWithGadgetConnections(c *C) {
+	r := release.MockOnClassic(false)
+	defer r()
+
+	s.MockModel(c, map[string]interface{}{
+		"gadget": "the-gadget",
+	})
+
+	repo := s.mgr.Repository()
+	st := s.state
+
+	st.Lock()
+	// mock the consumer snap/plug
+	s.MockSnapDecl(c, "consumer", "publisher1", nil)
+	si := &snap.SideInfo{RealName: "consumer", SnapID: "consumeridididididididididididid", Revision: snap.R(1)}
+	testSnap := snaptest.MockSnapInstance(c, "", testSnapYaml, si)
+	c.Assert(repo.AddPlug(testSnap.Plugs["plug"]), IsNil)
+	snapstate.Set(s.state, "consumer", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{si},
+		Current:  snap.R(1),
+		SnapType: "app",
+	})
+
+	// mock the gadget asking for the slot of the device to be connected
+	gadgetSideInfo := &snap.SideInfo{RealName: "the-gadget", SnapID: "the-gadget-id", Revision: snap.R(1)}
+	gadgetInfo := snaptest.MockSnapWithFiles(c, `
+name: the-gadget
+type: gadget
+version: 1.0
+`, gadgetSideInfo, [][]string{{"meta/gadget.yaml", `
+hotplug-connections:
+  - interface: test-a
+    attributes:
+      slot-a-attr1: a
+    plug: consumeridididididididididididid:plug
+  - interface: test-a
+    attributes:
+      slot-a-attr1: b
+    plug: consumeridididididididididididid:plug
+  - interface: test-b
+    plug: consumeridididididididididididid:plug
+  - interface: test-a
+    plug: consumeridididididididididididid:plug
+
+volumes:
+  volume-id:
+    bootloader: grub
+`}})
+	snapstate.Set(s.state, "the-gadget", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{&gadgetInfo.SideInfo},
+		Current:  snap.R(1),
+		SnapType: "gadget"})
+	st.Unlock()
+
+	di, err := hotplug.NewHotplugDeviceInfo(map[string]string{"DEVPATH": "a/path", "ACTION": "add", "SUBSYSTEM": "foo"})
+	c.Assert(err, IsNil)
+	s.udevMon.AddDevice(di)
+
+	c.Assert(s.o.Settle(5*time.Second), IsNil)
+	st.Lock()
+	defer st.Unlock()
+
+	// the slot got connected even though test-a doesn't auto-connect
+	var hp hotplugTasksWitness
+	hp.checkTasks(c, st)
+	c.Check(hp.seenTasks, DeepEquals, map[string]int{"hotplug-seq-wait": 2, "hotplug-add-slot": 2, "hotplug-connect": 2, "connect": 1})
+	c.Check(hp.seenHooks, DeepEquals, map[string]string{"prepare-plug-plug": "consumer", "connect-plug-plug": "consumer"})
+	c.Check(hp.connects, DeepEquals, []string{"consumer:plug core:hotplugslot-a"})
+
+	conn, err := repo.Connection(&interfaces.ConnRef{
+		PlugRef: interfaces.PlugRef{Snap: "consumer", Name: "plug"},
+		SlotRef: interfaces.SlotRef{Snap: "core", Name: "hotplugslot-a"}})
+	c.Assert(err, IsNil)
+	c.Assert(conn, NotNil)
+
+	var conns map[string]map[string]interface{}
+	c.Assert(st.Get("conns", &conns), IsNil)
+	c.Check(conns["consumer:plug core:hotplugslot-a"]["auto"], Equals, true)
+	c.Check(conns["consumer:plug core:hotplugslot-a"]["by-gadget"], Equals, true)
+}
+
 var testSnapYaml = `
 name: consumer
 version: 1
@@ -253,11 +253,23 @@ type ConnectionState struct {
 	HotplugGone      bool
 }
 
+// Active returns true if the connection is established, that is it's
+// neither undesired nor one of a hotplug device that is gone.
+func (c ConnectionState) Active() bool {
+	return !(c.Undesired || c.HotplugGone)
+}
+
 // ConnectionStates return the state of connections tracked by the manager
 func (m *InterfaceManager) ConnectionStates() (connStateByRef map[string]ConnectionState, err error) {
 	m.state.Lock()
 	defer m.state.Unlock()
-	states, err := getConns(m.state)
+	return ConnectionStates(m.state)
+}
+
+// ConnectionStates returns the state of connections stored in the state.
+// The state must be locked by the caller.
+func ConnectionStates(st *state.State) (connStateByRef map[string]ConnectionState, err error) {
+	states, err := getConns(st)
 	if err != nil {
 		return nil, err
 	}
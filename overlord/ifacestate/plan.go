@@ -0,0 +1,178 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ifacestate
+
+import (
+	"sort"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/ifacestate/ifacerepo"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/snap"
+)
+
+// AutoConnections returns the connections that would be made
+// automatically, as done by the auto-connect task, if the given snaps
+// replaced the revisions of them that are installed, if any. It is
+// used to look at what a change would do without making it.
+//
+// The snap declarations of the given snaps that are not in the system
+// assertion database are fetched from the store. The state must be
+// locked by the caller, it is unlocked while talking to the store.
+func AutoConnections(st *state.State, infos []*snap.Info) ([]*interfaces.ConnRef, error) {
+	deviceCtx, err := snapstate.DeviceCtx(st, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	autochecker, err := newAutoConnectChecker(st, deviceCtx)
+	if err != nil {
+		return nil, err
+	}
+	if err := fetchSnapDeclarations(st, deviceCtx, autochecker, infos); err != nil {
+		return nil, err
+	}
+
+	// build a repository with the installed snaps and the given ones
+	// in place of their current revisions
+	repo := ifacerepo.Get(st)
+	planned := interfaces.NewRepository()
+	for _, iface := range repo.AllInterfaces() {
+		if err := planned.AddInterface(iface); err != nil {
+			return nil, err
+		}
+	}
+	replaced := make(map[string]bool, len(infos))
+	for _, info := range infos {
+		replaced[info.InstanceName()] = true
+	}
+	// plugs and slots are copied one by one to keep hotplug slots
+	for _, plug := range repo.AllPlugs("") {
+		if replaced[plug.Snap.InstanceName()] {
+			continue
+		}
+		if err := planned.AddPlug(plug); err != nil {
+			return nil, err
+		}
+	}
+	for _, slot := range repo.AllSlots("") {
+		if replaced[slot.Snap.InstanceName()] {
+			continue
+		}
+		if err := planned.AddSlot(slot); err != nil {
+			return nil, err
+		}
+	}
+	for _, info := range infos {
+		if err := addImplicitSlots(st, info); err != nil {
+			return nil, err
+		}
+		if err := planned.AddSnap(info); err != nil {
+			return nil, err
+		}
+	}
+
+	conns, err := getConns(st)
+	if err != nil {
+		return nil, err
+	}
+
+	newconns := make(map[string]*interfaces.ConnRef)
+	maybeAdd := func(plug *snap.PlugInfo, slot *snap.SlotInfo) {
+		connRef := interfaces.NewConnRef(plug, slot)
+		if _, ok := conns[connRef.ID()]; ok {
+			// already connected, or undesired
+			return
+		}
+		newconns[connRef.ID()] = connRef
+	}
+	for _, info := range infos {
+		snapName := info.InstanceName()
+		for _, plug := range planned.Plugs(snapName) {
+			candidates := preferCoreSlots(planned.AutoConnectCandidateSlots(snapName, plug.Name, autochecker.check))
+			if len(candidates) == 1 {
+				maybeAdd(plug, candidates[0])
+			}
+		}
+		for _, slot := range planned.Slots(snapName) {
+			for _, plug := range planned.AutoConnectCandidatePlugs(snapName, slot.Name, autochecker.check) {
+				// the slot must be the only viable one for
+				// the plug, see doAutoConnect
+				candSlots := planned.AutoConnectCandidateSlots(plug.Snap.InstanceName(), plug.Name, autochecker.check)
+				if len(candSlots) == 1 && candSlots[0].String() == slot.String() {
+					maybeAdd(plug, slot)
+				}
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(newconns))
+	for id := range newconns {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	connRefs := make([]*interfaces.ConnRef, len(ids))
+	for i, id := range ids {
+		connRefs[i] = newconns[id]
+	}
+	return connRefs, nil
+}
+
+// fetchSnapDeclarations puts in the cache of the checker the snap
+// declarations of the given snaps that are not in the system assertion
+// database yet, fetching them from the store.
+func fetchSnapDeclarations(st *state.State, deviceCtx snapstate.DeviceContext, checker *autoConnectChecker, infos []*snap.Info) error {
+	var missing []string
+	for _, info := range infos {
+		if info.SnapID == "" {
+			continue
+		}
+		_, err := assertstate.SnapDeclaration(st, info.SnapID)
+		if err == nil {
+			continue
+		}
+		if !asserts.IsNotFound(err) {
+			return err
+		}
+		missing = append(missing, info.SnapID)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	sto := snapstate.Store(st, deviceCtx)
+	st.Unlock()
+	defer st.Lock()
+	for _, snapID := range missing {
+		a, err := sto.Assertion(asserts.SnapDeclarationType, []string{release.Series, snapID}, nil)
+		if err != nil {
+			// the checker then finds no auto-connections
+			// for the snap
+			logger.Noticef("cannot fetch snap declaration for %q: %v", snapID, err)
+			continue
+		}
+		checker.cache[snapID] = a.(*asserts.SnapDeclaration)
+	}
+	return nil
+}
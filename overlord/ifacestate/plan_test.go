@@ -0,0 +1,153 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ifacestate_test
+
+import (
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/ifacetest"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/ifacestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/store/storetest"
+)
+
+type declStore struct {
+	storetest.Store
+
+	decls map[string]asserts.Assertion
+}
+
+func (sto *declStore) Assertion(assertType *asserts.AssertionType, primaryKey []string, user *auth.UserState) (asserts.Assertion, error) {
+	if a := sto.decls[primaryKey[1]]; assertType == asserts.SnapDeclarationType && a != nil {
+		return a, nil
+	}
+	return nil, &asserts.NotFoundError{Type: assertType}
+}
+
+func (s *interfaceManagerSuite) mockAutoConnectPolicy(c *C) {
+	s.MockModel(c, nil)
+
+	restore := assertstest.MockBuiltinBaseDeclaration([]byte(`
+type: base-declaration
+authority-id: canonical
+series: 16
+slots:
+  test:
+    allow-auto-connection:
+      plug-publisher-id:
+        - $SLOT_PUBLISHER_ID
+`))
+	s.AddCleanup(restore)
+	s.mockIfaces(c, &ifacetest.TestInterface{InterfaceName: "test"}, &ifacetest.TestInterface{InterfaceName: "test2"})
+	s.MockSnapDecl(c, "producer", "one-publisher", nil)
+	s.mockSnap(c, producerYaml)
+	s.manager(c)
+}
+
+func plannedSnapInfo(c *C, yaml, snapID string) *snap.Info {
+	return snaptest.MockInfo(c, yaml, &snap.SideInfo{SnapID: snapID, Revision: snap.R(2)})
+}
+
+func (s *interfaceManagerSuite) TestAutoConnections(c *C) {
+	s.mockAutoConnectPolicy(c)
+	s.MockSnapDecl(c, "consumer", "one-publisher", nil)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	info := plannedSnapInfo(c, consumerYaml, "consumeridididididididididididid")
+	connRefs, err := ifacestate.AutoConnections(s.state, []*snap.Info{info})
+	c.Assert(err, IsNil)
+	c.Check(connRefs, DeepEquals, []*interfaces.ConnRef{{
+		PlugRef: interfaces.PlugRef{Snap: "consumer", Name: "plug"},
+		SlotRef: interfaces.SlotRef{Snap: "producer", Name: "slot"},
+	}})
+
+	// nothing is actually connected
+	c.Check(s.privateMgr.Repository().Interfaces().Connections, HasLen, 0)
+	c.Check(s.privateMgr.Repository().Plugs("consumer"), HasLen, 0)
+}
+
+func (s *interfaceManagerSuite) TestAutoConnectionsExistingConnection(c *C) {
+	s.mockAutoConnectPolicy(c)
+	s.MockSnapDecl(c, "consumer", "one-publisher", nil)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.state.Set("conns", map[string]interface{}{
+		"consumer:plug producer:slot": map[string]interface{}{"interface": "test", "undesired": true},
+	})
+
+	info := plannedSnapInfo(c, consumerYaml, "consumeridididididididididididid")
+	connRefs, err := ifacestate.AutoConnections(s.state, []*snap.Info{info})
+	c.Assert(err, IsNil)
+	c.Check(connRefs, HasLen, 0)
+}
+
+func (s *interfaceManagerSuite) TestAutoConnectionsOtherPublisher(c *C) {
+	s.mockAutoConnectPolicy(c)
+	s.MockSnapDecl(c, "consumer", "other-publisher", nil)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	info := plannedSnapInfo(c, consumerYaml, "consumeridididididididididididid")
+	connRefs, err := ifacestate.AutoConnections(s.state, []*snap.Info{info})
+	c.Assert(err, IsNil)
+	c.Check(connRefs, HasLen, 0)
+}
+
+func (s *interfaceManagerSuite) TestAutoConnectionsDeclarationFromStore(c *C) {
+	s.mockAutoConnectPolicy(c)
+
+	snapID := ("consumer" + strings.Repeat("id", 16))[:32]
+	decl, err := s.storeSigning.Sign(asserts.SnapDeclarationType, map[string]interface{}{
+		"series":       "16",
+		"snap-name":    "consumer",
+		"publisher-id": "one-publisher",
+		"snap-id":      snapID,
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.ReplaceStore(s.state, &declStore{decls: map[string]asserts.Assertion{snapID: decl}})
+
+	info := plannedSnapInfo(c, consumerYaml, snapID)
+	connRefs, err := ifacestate.AutoConnections(s.state, []*snap.Info{info})
+	c.Assert(err, IsNil)
+	c.Check(connRefs, HasLen, 1)
+
+	// the declaration is not added to the system database
+	_, err = s.Db.Find(asserts.SnapDeclarationType, map[string]string{"series": "16", "snap-id": snapID})
+	c.Check(asserts.IsNotFound(err), Equals, true)
+}
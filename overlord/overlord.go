@@ -34,6 +34,7 @@ import (
 
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/metrics"
 	"github.com/snapcore/snapd/osutil"
 
 	"github.com/snapcore/snapd/overlord/assertstate"
@@ -45,6 +46,7 @@ import (
 	"github.com/snapcore/snapd/overlord/hookstate"
 	"github.com/snapcore/snapd/overlord/ifacestate"
 	"github.com/snapcore/snapd/overlord/patch"
+	"github.com/snapcore/snapd/overlord/servicestate"
 	"github.com/snapcore/snapd/overlord/snapshotstate"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	_ "github.com/snapcore/snapd/overlord/snapstate/policy"
@@ -65,6 +67,9 @@ var (
 	defaultCachedDownloads = 5
 
 	configstateInit = configstate.Init
+
+	stateLockHeldSeconds = metrics.NewGaugeFunc("snapd_state_lock_held_seconds",
+		"For how long the state lock has currently been held, zero if it isn't.")
 )
 
 // Overlord is the central manager of a snappy system, keeping
@@ -91,6 +96,7 @@ type Overlord struct {
 	deviceMgr *devicestate.DeviceManager
 	cmdMgr    *cmdstate.CommandManager
 	shotMgr   *snapshotstate.SnapshotManager
+	svcMgr    *servicestate.ServiceManager
 	// proxyConf mediates the http proxy config
 	proxyConf func(req *http.Request) (*url.URL, error)
 }
@@ -131,6 +137,10 @@ func New(restartBehavior RestartBehavior) (*Overlord, error) {
 	o.stateEng = NewStateEngine(s)
 	o.runner = state.NewTaskRunner(s)
 
+	stateLockHeldSeconds.SetFunc(func() float64 {
+		return s.LockHeldFor().Seconds()
+	})
+
 	// any unknown task should be ignored and succeed
 	matchAnyUnknownTask := func(_ *state.Task) bool {
 		return true
@@ -169,6 +179,7 @@ func New(restartBehavior RestartBehavior) (*Overlord, error) {
 
 	o.addManager(cmdstate.Manager(s, o.runner))
 	o.addManager(snapshotstate.Manager(s, o.runner))
+	o.addManager(servicestate.Manager(s, o.runner))
 
 	if err := configstateInit(s, hookMgr); err != nil {
 		return nil, err
@@ -206,6 +217,8 @@ func (o *Overlord) addManager(mgr StateManager) {
 		o.cmdMgr = x
 	case *snapshotstate.SnapshotManager:
 		o.shotMgr = x
+	case *servicestate.ServiceManager:
+		o.svcMgr = x
 	}
 	o.stateEng.AddManager(mgr)
 }
@@ -575,6 +588,12 @@ func (o *Overlord) SnapshotManager() *snapshotstate.SnapshotManager {
 	return o.shotMgr
 }
 
+// ServiceManager returns the manager responsible for controlling user
+// services.
+func (o *Overlord) ServiceManager() *servicestate.ServiceManager {
+	return o.svcMgr
+}
+
 // Mock creates an Overlord without any managers and with a backend
 // not using disk. Managers can be added with AddManager. For testing.
 func Mock() *Overlord {
@@ -0,0 +1,513 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package servicestate
+
+import (
+	"fmt"
+	"sort"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/progress"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/quota"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/wrappers"
+)
+
+func init() {
+	snapstate.EnsureSnapServicesQuota = ensureSnapServicesQuota
+	snapstate.RemoveSnapFromQuota = removeSnapFromQuota
+}
+
+func daemonReload() error {
+	return systemd.New(dirs.GlobalRootDir, systemd.SystemMode, progress.Null).DaemonReload()
+}
+
+// AllQuotas returns all the quota groups, keyed by name.
+func AllQuotas(st *state.State) (map[string]*quota.Group, error) {
+	var quotas map[string]*quota.Group
+	if err := st.Get("quotas", &quotas); err != nil && err != state.ErrNoState {
+		return nil, err
+	}
+	if quotas == nil {
+		quotas = make(map[string]*quota.Group)
+	}
+	return quotas, nil
+}
+
+// GetQuota returns the quota group with the given name, or
+// state.ErrNoState if there is none.
+func GetQuota(st *state.State, name string) (*quota.Group, error) {
+	quotas, err := AllQuotas(st)
+	if err != nil {
+		return nil, err
+	}
+	grp, ok := quotas[name]
+	if !ok {
+		return nil, state.ErrNoState
+	}
+	return grp, nil
+}
+
+func setQuotas(st *state.State, quotas map[string]*quota.Group) {
+	if len(quotas) == 0 {
+		st.Set("quotas", nil)
+		return
+	}
+	st.Set("quotas", quotas)
+}
+
+// groupForSnap returns the quota group the given snap is in, if any.
+func groupForSnap(quotas map[string]*quota.Group, instanceName string) *quota.Group {
+	for _, grp := range quotas {
+		if strutil.ListContains(grp.Snaps, instanceName) {
+			return grp
+		}
+	}
+	return nil
+}
+
+// QuotaControlAction is the quota group change to be carried out by a
+// "quota-control" task.
+type QuotaControlAction struct {
+	// Action is either "ensure" or "remove".
+	Action string `json:"action"`
+	// QuotaName is the name of the quota group.
+	QuotaName string `json:"quota-name"`
+	// Update holds the snaps to add and the limits to set for
+	// "ensure", as passed to EnsureQuota.
+	Update *quota.Group `json:"update,omitempty"`
+}
+
+// checkQuotaControlConflict returns a ChangeConflictError if there is
+// a change in progress for the quota group with the given name.
+func checkQuotaControlConflict(st *state.State, name string) error {
+	for _, t := range st.Tasks() {
+		if t.Kind() != "quota-control" || t.Status().Ready() {
+			continue
+		}
+		var action QuotaControlAction
+		if err := t.Get("quota-control-action", &action); err != nil {
+			return fmt.Errorf("internal error: cannot get quota control action: %v", err)
+		}
+		if action.QuotaName != name {
+			continue
+		}
+		chg := t.Change()
+		if chg == nil {
+			continue
+		}
+		return &snapstate.ChangeConflictError{
+			Message:    fmt.Sprintf("quota group %q has %q change in progress", name, chg.Kind()),
+			ChangeKind: chg.Kind(),
+			ChangeID:   chg.ID(),
+		}
+	}
+	return nil
+}
+
+// quotaControlAffectedSnaps returns the snaps whose services a
+// "quota-control" task moves or restarts, for conflict detection.
+func quotaControlAffectedSnaps(t *state.Task) ([]string, error) {
+	var action QuotaControlAction
+	if err := t.Get("quota-control-action", &action); err != nil {
+		return nil, fmt.Errorf("internal error: cannot get quota control action: %v", err)
+	}
+	quotas, err := AllQuotas(t.State())
+	if err != nil {
+		return nil, err
+	}
+	var snaps []string
+	if grp := quotas[action.QuotaName]; grp != nil {
+		snaps = append(snaps, grp.Snaps...)
+	}
+	if action.Update != nil {
+		snaps = append(snaps, action.Update.Snaps...)
+	}
+	return snaps, nil
+}
+
+// updatedQuota returns the quota group resulting from applying the
+// given update to the current groups.
+func updatedQuota(st *state.State, quotas map[string]*quota.Group, update *quota.Group) (*quota.Group, error) {
+	if err := quota.ValidateGroupName(update.Name); err != nil {
+		return nil, err
+	}
+
+	grp := &quota.Group{Name: update.Name}
+	if current := quotas[update.Name]; current != nil {
+		*grp = *current
+		grp.Snaps = append([]string(nil), current.Snaps...)
+	}
+
+	for _, instanceName := range update.Snaps {
+		if strutil.ListContains(grp.Snaps, instanceName) {
+			continue
+		}
+		if other := groupForSnap(quotas, instanceName); other != nil {
+			return nil, fmt.Errorf("cannot add snap %q to quota group %q: snap is already in quota group %q", instanceName, grp.Name, other.Name)
+		}
+		if _, err := snapstate.CurrentInfo(st, instanceName); err != nil {
+			return nil, fmt.Errorf("cannot add snap %q to quota group %q: %v", instanceName, grp.Name, err)
+		}
+		grp.Snaps = append(grp.Snaps, instanceName)
+	}
+	if update.MemoryLimit != 0 {
+		grp.MemoryLimit = update.MemoryLimit
+	}
+	if update.CPUPercentage != 0 {
+		grp.CPUPercentage = update.CPUPercentage
+	}
+	if update.TaskLimit != 0 {
+		grp.TaskLimit = update.TaskLimit
+	}
+	sort.Strings(grp.Snaps)
+	if err := grp.Validate(); err != nil {
+		return nil, err
+	}
+	return grp, nil
+}
+
+// EnsureQuota returns a task set creating the quota group with the
+// name of the given one if it does not exist yet, or updating it
+// otherwise. The snaps of the given group are added to it, and its
+// non-zero limits replace the current ones.
+func EnsureQuota(st *state.State, update *quota.Group) (*state.TaskSet, error) {
+	quotas, err := AllQuotas(st)
+	if err != nil {
+		return nil, err
+	}
+	grp, err := updatedQuota(st, quotas, update)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkQuotaControlConflict(st, grp.Name); err != nil {
+		return nil, err
+	}
+	if err := snapstate.CheckChangeConflictMany(st, grp.Snaps, ""); err != nil {
+		return nil, err
+	}
+
+	summary := fmt.Sprintf(i18n.G("Update quota group %q"), grp.Name)
+	if quotas[grp.Name] == nil {
+		summary = fmt.Sprintf(i18n.G("Create quota group %q"), grp.Name)
+	}
+	t := st.NewTask("quota-control", summary)
+	t.Set("quota-control-action", &QuotaControlAction{
+		Action:    "ensure",
+		QuotaName: grp.Name,
+		Update:    update,
+	})
+	return state.NewTaskSet(t), nil
+}
+
+// RemoveQuota returns a task set removing the quota group with the
+// given name.
+func RemoveQuota(st *state.State, name string) (*state.TaskSet, error) {
+	grp, err := GetQuota(st, name)
+	if err == state.ErrNoState {
+		return nil, fmt.Errorf("cannot remove quota group %q: no such group", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkQuotaControlConflict(st, name); err != nil {
+		return nil, err
+	}
+	if err := snapstate.CheckChangeConflictMany(st, grp.Snaps, ""); err != nil {
+		return nil, err
+	}
+
+	t := st.NewTask("quota-control", fmt.Sprintf(i18n.G("Remove quota group %q"), name))
+	t.Set("quota-control-action", &QuotaControlAction{
+		Action:    "remove",
+		QuotaName: name,
+	})
+	return state.NewTaskSet(t), nil
+}
+
+func (m *ServiceManager) doQuotaControl(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var action QuotaControlAction
+	if err := t.Get("quota-control-action", &action); err != nil {
+		return err
+	}
+	quotas, err := AllQuotas(st)
+	if err != nil {
+		return err
+	}
+	current := quotas[action.QuotaName]
+
+	var grp *quota.Group
+	switch action.Action {
+	case "ensure":
+		if action.Update == nil {
+			return fmt.Errorf("internal error: no update for quota group %q", action.QuotaName)
+		}
+		// things might have changed since the task was created
+		grp, err = updatedQuota(st, quotas, action.Update)
+		if err != nil {
+			return err
+		}
+	case "remove":
+		if current == nil {
+			// removed in the meantime
+			return nil
+		}
+	default:
+		return fmt.Errorf("internal error: unknown quota action %q", action.Action)
+	}
+	infos := quotaSnapInfos(st, current, grp)
+	// for undo
+	t.Set("old-quota-group", current)
+
+	st.Unlock()
+	err = switchQuotaGroup(current, grp, infos)
+	if err != nil {
+		// put the slice and the services back as they were
+		if rerr := switchQuotaGroup(grp, current, infos); rerr != nil {
+			logger.Noticef("cannot restore quota group %q: %v", action.QuotaName, rerr)
+		}
+	}
+	st.Lock()
+	if err != nil {
+		return err
+	}
+
+	return setQuota(st, action.QuotaName, grp)
+}
+
+func (m *ServiceManager) undoQuotaControl(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var action QuotaControlAction
+	if err := t.Get("quota-control-action", &action); err != nil {
+		return err
+	}
+	var old *quota.Group
+	if err := t.Get("old-quota-group", &old); err != nil && err != state.ErrNoState {
+		return err
+	}
+	current, err := GetQuota(st, action.QuotaName)
+	if err != nil && err != state.ErrNoState {
+		return err
+	}
+	infos := quotaSnapInfos(st, current, old)
+
+	st.Unlock()
+	err = switchQuotaGroup(current, old, infos)
+	st.Lock()
+	if err != nil {
+		return err
+	}
+
+	return setQuota(st, action.QuotaName, old)
+}
+
+// setQuota sets the quota group with the given name in the state, or
+// removes it if grp is nil.
+func setQuota(st *state.State, name string, grp *quota.Group) error {
+	quotas, err := AllQuotas(st)
+	if err != nil {
+		return err
+	}
+	if grp != nil {
+		quotas[name] = grp
+	} else {
+		delete(quotas, name)
+	}
+	setQuotas(st, quotas)
+	return nil
+}
+
+// quotaSnapInfos returns the current infos of the snaps of the given
+// quota groups, either of which can be nil, keyed by instance name.
+func quotaSnapInfos(st *state.State, groups ...*quota.Group) map[string]*snap.Info {
+	infos := make(map[string]*snap.Info)
+	for _, grp := range groups {
+		if grp == nil {
+			continue
+		}
+		for _, instanceName := range grp.Snaps {
+			if infos[instanceName] != nil {
+				continue
+			}
+			info, err := snapstate.CurrentInfo(st, instanceName)
+			if err != nil {
+				// snaps are taken out of their group on removal,
+				// so this should not happen
+				logger.Noticef("cannot get info of snap %q in quota group %q: %v", instanceName, grp.Name, err)
+				continue
+			}
+			infos[instanceName] = info
+		}
+	}
+	return infos
+}
+
+// switchQuotaGroup changes the slice of a quota group and the services
+// of its snaps from the from group to the to one, either of which can
+// be nil for a group that does not exist. The limits are applied to
+// the running slice right away, and the running services of the snaps
+// that are moved in or out of the slice are restarted for it to take
+// effect. The state must not be locked, as this calls systemd.
+func switchQuotaGroup(from, to *quota.Group, infos map[string]*snap.Info) error {
+	inGroup := func(grp *quota.Group, instanceName string) bool {
+		return grp != nil && strutil.ListContains(grp.Snaps, instanceName)
+	}
+
+	var sliceChanged bool
+	if to != nil {
+		changed, err := wrappers.EnsureQuotaGroupSlice(to)
+		if err != nil {
+			return err
+		}
+		sliceChanged = changed
+	}
+	reload := sliceChanged
+
+	var moved []*snap.Info
+	for _, grp := range []*quota.Group{from, to} {
+		if grp == nil {
+			continue
+		}
+		for _, instanceName := range grp.Snaps {
+			info := infos[instanceName]
+			if info == nil || inGroup(from, instanceName) == inGroup(to, instanceName) {
+				continue
+			}
+			target := to
+			if !inGroup(to, instanceName) {
+				target = nil
+			}
+			changed, err := wrappers.EnsureSnapServicesQuotaGroup(info, target)
+			if err != nil {
+				return err
+			}
+			reload = reload || changed
+			moved = append(moved, info)
+		}
+	}
+
+	if to == nil && from != nil {
+		if err := wrappers.RemoveQuotaGroupSlice(from); err != nil {
+			return err
+		}
+		reload = true
+	}
+	if reload {
+		if err := daemonReload(); err != nil {
+			return err
+		}
+	}
+	if sliceChanged {
+		// a reload does not change the limits of a running slice
+		sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, progress.Null)
+		if err := sysd.SetProperties(to.SliceName(), wrappers.QuotaGroupSliceLimits(to)...); err != nil {
+			return err
+		}
+	}
+	for _, info := range moved {
+		if err := wrappers.RestartActiveServices(info.Services(), progress.Null); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureSnapServicesQuota makes sure that the services of the given
+// snap are in the slice of its quota group, if any, before they are
+// started. The services of a snap can change across refreshes.
+func ensureSnapServicesQuota(st *state.State, info *snap.Info) error {
+	quotas, err := AllQuotas(st)
+	if err != nil {
+		return err
+	}
+	grp := groupForSnap(quotas, info.InstanceName())
+	changed, err := wrappers.EnsureSnapServicesQuotaGroup(info, grp)
+	if err != nil {
+		return err
+	}
+	if changed {
+		return daemonReload()
+	}
+	return nil
+}
+
+// removeSnapFromQuota takes the given snap, which is being removed
+// for good, out of its quota group, if any.
+func removeSnapFromQuota(st *state.State, instanceName string) error {
+	quotas, err := AllQuotas(st)
+	if err != nil {
+		return err
+	}
+	grp := groupForSnap(quotas, instanceName)
+	if grp == nil {
+		return nil
+	}
+	snaps := make([]string, 0, len(grp.Snaps)-1)
+	for _, name := range grp.Snaps {
+		if name != instanceName {
+			snaps = append(snaps, name)
+		}
+	}
+	grp.Snaps = snaps
+	setQuotas(st, quotas)
+	return nil
+}
+
+// QuotaGroupUsage holds the current resource usage of a quota group.
+type QuotaGroupUsage struct {
+	Memory uint64 `json:"memory"`
+	// CPU is the CPU time used so far, in nanoseconds
+	CPU   uint64 `json:"cpu"`
+	Tasks uint64 `json:"tasks"`
+}
+
+// CurrentQuotaUsage returns the current resource usage of the given
+// quota group, as accounted by systemd for its slice.
+func CurrentQuotaUsage(grp *quota.Group) (*QuotaGroupUsage, error) {
+	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, progress.Null)
+	mem, err := sysd.CurrentMemoryUsage(grp.SliceName())
+	if err != nil {
+		return nil, err
+	}
+	cpu, err := sysd.CurrentCPUUsage(grp.SliceName())
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := sysd.CurrentTasksCount(grp.SliceName())
+	if err != nil {
+		return nil, err
+	}
+	return &QuotaGroupUsage{Memory: mem, CPU: cpu, Tasks: tasks}, nil
+}
@@ -0,0 +1,423 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package servicestate_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/servicestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/quota"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func TestServiceState(t *testing.T) { TestingT(t) }
+
+type quotaControlSuite struct {
+	testutil.BaseTest
+
+	st         *state.State
+	runner     *state.TaskRunner
+	systemctls [][]string
+	// systemctl fails with this error for set-property, if set
+	setPropertyErr error
+}
+
+var _ = Suite(&quotaControlSuite{})
+
+const testYaml = `name: %s
+version: 1
+apps:
+  svc:
+    command: bin/svc
+    daemon: simple
+`
+
+func (s *quotaControlSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+
+	s.systemctls = nil
+	s.setPropertyErr = nil
+	s.AddCleanup(systemd.MockSystemctl(func(args ...string) ([]byte, error) {
+		s.systemctls = append(s.systemctls, args)
+		switch args[0] {
+		case "set-property":
+			return nil, s.setPropertyErr
+		case "show":
+			switch args[1] {
+			case "--property=MemoryCurrent":
+				return []byte("MemoryCurrent=4096\n"), nil
+			case "--property=TasksCurrent":
+				return []byte("TasksCurrent=3\n"), nil
+			case "--property=CPUUsageNSec":
+				return []byte("CPUUsageNSec=1500000000\n"), nil
+			}
+			return []byte("ActiveState=inactive\n"), nil
+		}
+		return nil, nil
+	}))
+	s.AddCleanup(systemd.MockStopDelays(time.Millisecond, 25*time.Second))
+	s.AddCleanup(snap.MockSanitizePlugsSlots(func(snapInfo *snap.Info) {}))
+
+	s.st = state.New(nil)
+	s.runner = state.NewTaskRunner(s.st)
+	servicestate.Manager(s.st, s.runner)
+	s.runner.AddHandler("error-trigger", func(t *state.Task, _ *tomb.Tomb) error {
+		return errors.New("error out")
+	}, nil)
+	s.AddCleanup(s.runner.Stop)
+}
+
+func (s *quotaControlSuite) settle(c *C) {
+	s.st.Unlock()
+	defer s.st.Lock()
+	for i := 0; i < 5; i++ {
+		c.Assert(s.runner.Ensure(), IsNil)
+		s.runner.Wait()
+	}
+}
+
+// runQuotaChange runs the given quota task set in a change of its own
+// and returns the error of the change, if any.
+func (s *quotaControlSuite) runQuotaChange(c *C, ts *state.TaskSet) error {
+	chg := s.st.NewChange("quota-control", "...")
+	chg.AddAll(ts)
+	s.settle(c)
+	c.Assert(chg.Status().Ready(), Equals, true)
+	return chg.Err()
+}
+
+func (s *quotaControlSuite) ensureQuota(c *C, grp *quota.Group) {
+	ts, err := servicestate.EnsureQuota(s.st, grp)
+	c.Assert(err, IsNil)
+	c.Assert(s.runQuotaChange(c, ts), IsNil)
+}
+
+func (s *quotaControlSuite) mockSnap(c *C, name string) *snap.Info {
+	si := &snap.SideInfo{RealName: name, Revision: snap.R(1)}
+	info := snaptest.MockSnap(c, fmt.Sprintf(testYaml, name), si)
+	// only services with a unit file get restarted
+	svcFile := info.Apps["svc"].ServiceFile()
+	c.Assert(os.MkdirAll(filepath.Dir(svcFile), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(svcFile, nil, 0644), IsNil)
+	snapstate.Set(s.st, name, &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{si},
+		Current:  si.Revision,
+		SnapType: "app",
+	})
+	return info
+}
+
+func (s *quotaControlSuite) TestEnsureQuotaCreateAndUpdate(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	s.mockSnap(c, "foo")
+	s.mockSnap(c, "bar")
+
+	ts, err := servicestate.EnsureQuota(s.st, &quota.Group{Name: "grp", Snaps: []string{"foo"}, MemoryLimit: 1024 * 1024})
+	c.Assert(err, IsNil)
+	c.Assert(ts.Tasks(), HasLen, 1)
+	t := ts.Tasks()[0]
+	c.Check(t.Kind(), Equals, "quota-control")
+	c.Check(t.Summary(), Equals, `Create quota group "grp"`)
+	// nothing happens until the task runs
+	c.Check(s.systemctls, HasLen, 0)
+	_, err = servicestate.GetQuota(s.st, "grp")
+	c.Check(err, Equals, state.ErrNoState)
+
+	c.Assert(s.runQuotaChange(c, ts), IsNil)
+
+	grp, err := servicestate.GetQuota(s.st, "grp")
+	c.Assert(err, IsNil)
+	c.Check(grp, DeepEquals, &quota.Group{Name: "grp", Snaps: []string{"foo"}, MemoryLimit: 1024 * 1024})
+
+	sliceFile := filepath.Join(dirs.SnapServicesDir, "snap.grp.slice")
+	c.Check(sliceFile, testutil.FileContains, "MemoryMax=1048576\n")
+	dropIn := filepath.Join(dirs.SnapServicesDir, "snap.foo.svc.service.d", "snap-quota.conf")
+	c.Check(dropIn, testutil.FileContains, "Slice=snap.grp.slice\n")
+	c.Check(s.systemctls, DeepEquals, [][]string{
+		{"daemon-reload"},
+		{"set-property", "--runtime", "snap.grp.slice", "MemoryMax=1048576", "MemoryLimit=1048576", "CPUQuota=", "TasksMax=infinity"},
+		{"--root", dirs.GlobalRootDir, "is-active", "snap.foo.svc.service"},
+		{"stop", "snap.foo.svc.service"},
+		{"show", "--property=ActiveState", "snap.foo.svc.service"},
+		{"start", "snap.foo.svc.service"},
+	})
+
+	// adding a snap and a limit keeps the rest as is
+	s.systemctls = nil
+	ts, err = servicestate.EnsureQuota(s.st, &quota.Group{Name: "grp", Snaps: []string{"bar"}, TaskLimit: 32})
+	c.Assert(err, IsNil)
+	c.Check(ts.Tasks()[0].Summary(), Equals, `Update quota group "grp"`)
+	c.Assert(s.runQuotaChange(c, ts), IsNil)
+	grp, err = servicestate.GetQuota(s.st, "grp")
+	c.Assert(err, IsNil)
+	c.Check(grp, DeepEquals, &quota.Group{Name: "grp", Snaps: []string{"bar", "foo"}, MemoryLimit: 1024 * 1024, TaskLimit: 32})
+	c.Check(sliceFile, testutil.FileContains, "TasksMax=32\n")
+	c.Check(s.systemctls[0], DeepEquals, []string{"daemon-reload"})
+	c.Check(s.systemctls[1], DeepEquals, []string{"set-property", "--runtime", "snap.grp.slice", "MemoryMax=1048576", "MemoryLimit=1048576", "CPUQuota=", "TasksMax=32"})
+	c.Check(s.systemctls[2], DeepEquals, []string{"--root", dirs.GlobalRootDir, "is-active", "snap.bar.svc.service"})
+
+	quotas, err := servicestate.AllQuotas(s.st)
+	c.Assert(err, IsNil)
+	c.Check(quotas, HasLen, 1)
+}
+
+func (s *quotaControlSuite) TestEnsureQuotaUpdatesRunningSlice(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	s.mockSnap(c, "foo")
+	s.ensureQuota(c, &quota.Group{Name: "grp", Snaps: []string{"foo"}, MemoryLimit: 1024 * 1024})
+
+	// new limits are applied to the running slice, services are
+	// not restarted
+	s.systemctls = nil
+	s.ensureQuota(c, &quota.Group{Name: "grp", MemoryLimit: 2 * 1024 * 1024})
+	c.Check(s.systemctls, DeepEquals, [][]string{
+		{"daemon-reload"},
+		{"set-property", "--runtime", "snap.grp.slice", "MemoryMax=2097152", "MemoryLimit=2097152", "CPUQuota=", "TasksMax=infinity"},
+	})
+
+	// nothing to do if nothing changes
+	s.systemctls = nil
+	s.ensureQuota(c, &quota.Group{Name: "grp", Snaps: []string{"foo"}, MemoryLimit: 2 * 1024 * 1024})
+	c.Check(s.systemctls, HasLen, 0)
+}
+
+func (s *quotaControlSuite) TestEnsureQuotaErrors(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	s.mockSnap(c, "foo")
+	s.ensureQuota(c, &quota.Group{Name: "grp1", Snaps: []string{"foo"}, TaskLimit: 32})
+
+	for _, t := range []struct {
+		grp *quota.Group
+		err string
+	}{
+		{&quota.Group{Name: "Grp", TaskLimit: 32}, `invalid quota group name "Grp"`},
+		{&quota.Group{Name: "grp2"}, `quota group "grp2" must have at least one limit`},
+		{&quota.Group{Name: "grp2", TaskLimit: 32, Snaps: []string{"foo"}}, `cannot add snap "foo" to quota group "grp2": snap is already in quota group "grp1"`},
+		{&quota.Group{Name: "grp2", TaskLimit: 32, Snaps: []string{"bar"}}, `cannot add snap "bar" to quota group "grp2": snap "bar" is not installed`},
+	} {
+		_, err := servicestate.EnsureQuota(s.st, t.grp)
+		c.Check(err, ErrorMatches, t.err)
+	}
+
+	_, err := servicestate.GetQuota(s.st, "grp2")
+	c.Check(err, Equals, state.ErrNoState)
+}
+
+func (s *quotaControlSuite) TestEnsureQuotaRechecksWhenRunning(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	s.mockSnap(c, "foo")
+	ts1, err := servicestate.EnsureQuota(s.st, &quota.Group{Name: "grp1", Snaps: []string{"foo"}, TaskLimit: 32})
+	c.Assert(err, IsNil)
+	ts2, err := servicestate.EnsureQuota(s.st, &quota.Group{Name: "grp2", Snaps: []string{"foo"}, TaskLimit: 32})
+	c.Assert(err, IsNil)
+
+	c.Assert(s.runQuotaChange(c, ts1), IsNil)
+	err = s.runQuotaChange(c, ts2)
+	c.Check(err, ErrorMatches, `(?s).*cannot add snap "foo" to quota group "grp2": snap is already in quota group "grp1".*`)
+	_, err = servicestate.GetQuota(s.st, "grp2")
+	c.Check(err, Equals, state.ErrNoState)
+}
+
+func (s *quotaControlSuite) TestQuotaControlConflicts(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	s.mockSnap(c, "foo")
+	s.mockSnap(c, "bar")
+	s.ensureQuota(c, &quota.Group{Name: "grp", Snaps: []string{"foo"}, TaskLimit: 32})
+
+	ts, err := servicestate.EnsureQuota(s.st, &quota.Group{Name: "grp", Snaps: []string{"bar"}})
+	c.Assert(err, IsNil)
+	chg := s.st.NewChange("quota-control", "...")
+	chg.AddAll(ts)
+
+	_, err = servicestate.EnsureQuota(s.st, &quota.Group{Name: "grp", MemoryLimit: 1024 * 1024})
+	c.Check(err, FitsTypeOf, &snapstate.ChangeConflictError{})
+	c.Check(err, ErrorMatches, `quota group "grp" has "quota-control" change in progress`)
+	_, err = servicestate.RemoveQuota(s.st, "grp")
+	c.Check(err, ErrorMatches, `quota group "grp" has "quota-control" change in progress`)
+
+	// the snaps of the group and the added ones are affected
+	for _, name := range []string{"foo", "bar"} {
+		err = snapstate.CheckChangeConflict(s.st, name, nil)
+		c.Check(err, ErrorMatches, fmt.Sprintf(`snap %q has "quota-control" change in progress`, name))
+	}
+
+	// other groups are fine
+	_, err = servicestate.EnsureQuota(s.st, &quota.Group{Name: "other", TaskLimit: 32})
+	c.Check(err, IsNil)
+}
+
+func (s *quotaControlSuite) TestRemoveQuota(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	s.mockSnap(c, "foo")
+	s.ensureQuota(c, &quota.Group{Name: "grp", Snaps: []string{"foo"}, CPUPercentage: 50})
+
+	s.systemctls = nil
+	ts, err := servicestate.RemoveQuota(s.st, "grp")
+	c.Assert(err, IsNil)
+	c.Check(ts.Tasks()[0].Summary(), Equals, `Remove quota group "grp"`)
+	c.Assert(s.runQuotaChange(c, ts), IsNil)
+	c.Check(osutil.FileExists(filepath.Join(dirs.SnapServicesDir, "snap.grp.slice")), Equals, false)
+	c.Check(osutil.FileExists(filepath.Join(dirs.SnapServicesDir, "snap.foo.svc.service.d", "snap-quota.conf")), Equals, false)
+	c.Check(s.systemctls[0], DeepEquals, []string{"daemon-reload"})
+
+	quotas, err := servicestate.AllQuotas(s.st)
+	c.Assert(err, IsNil)
+	c.Check(quotas, HasLen, 0)
+
+	_, err = servicestate.RemoveQuota(s.st, "grp")
+	c.Check(err, ErrorMatches, `cannot remove quota group "grp": no such group`)
+}
+
+func (s *quotaControlSuite) TestEnsureQuotaRollsBackOnError(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	s.mockSnap(c, "foo")
+	s.setPropertyErr = errors.New("boom")
+	ts, err := servicestate.EnsureQuota(s.st, &quota.Group{Name: "grp", Snaps: []string{"foo"}, TaskLimit: 32})
+	c.Assert(err, IsNil)
+	c.Check(s.runQuotaChange(c, ts), ErrorMatches, "(?s).*boom.*")
+
+	// nothing is left behind
+	c.Check(osutil.FileExists(filepath.Join(dirs.SnapServicesDir, "snap.grp.slice")), Equals, false)
+	c.Check(osutil.FileExists(filepath.Join(dirs.SnapServicesDir, "snap.foo.svc.service.d", "snap-quota.conf")), Equals, false)
+	_, err = servicestate.GetQuota(s.st, "grp")
+	c.Check(err, Equals, state.ErrNoState)
+}
+
+func (s *quotaControlSuite) TestQuotaControlUndo(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	s.mockSnap(c, "foo")
+	s.mockSnap(c, "bar")
+	s.ensureQuota(c, &quota.Group{Name: "grp", Snaps: []string{"foo"}, TaskLimit: 32})
+	sliceFile := filepath.Join(dirs.SnapServicesDir, "snap.grp.slice")
+	fooDropIn := filepath.Join(dirs.SnapServicesDir, "snap.foo.svc.service.d", "snap-quota.conf")
+	barDropIn := filepath.Join(dirs.SnapServicesDir, "snap.bar.svc.service.d", "snap-quota.conf")
+
+	runAndUndo := func(ts *state.TaskSet) {
+		chg := s.st.NewChange("quota-control", "...")
+		chg.AddAll(ts)
+		terr := s.st.NewTask("error-trigger", "provoking undo")
+		terr.WaitAll(ts)
+		chg.AddTask(terr)
+		s.settle(c)
+		c.Assert(chg.Err(), ErrorMatches, "(?s).*error out.*")
+		c.Check(ts.Tasks()[0].Status(), Equals, state.UndoneStatus)
+	}
+
+	// an update is reverted
+	ts, err := servicestate.EnsureQuota(s.st, &quota.Group{Name: "grp", Snaps: []string{"bar"}, TaskLimit: 64})
+	c.Assert(err, IsNil)
+	runAndUndo(ts)
+	grp, err := servicestate.GetQuota(s.st, "grp")
+	c.Assert(err, IsNil)
+	c.Check(grp, DeepEquals, &quota.Group{Name: "grp", Snaps: []string{"foo"}, TaskLimit: 32})
+	c.Check(sliceFile, testutil.FileContains, "TasksMax=32\n")
+	c.Check(fooDropIn, testutil.FileContains, "Slice=snap.grp.slice\n")
+	c.Check(osutil.FileExists(barDropIn), Equals, false)
+
+	// a removal is reverted
+	ts, err = servicestate.RemoveQuota(s.st, "grp")
+	c.Assert(err, IsNil)
+	runAndUndo(ts)
+	grp, err = servicestate.GetQuota(s.st, "grp")
+	c.Assert(err, IsNil)
+	c.Check(grp, DeepEquals, &quota.Group{Name: "grp", Snaps: []string{"foo"}, TaskLimit: 32})
+	c.Check(sliceFile, testutil.FileContains, "TasksMax=32\n")
+	c.Check(fooDropIn, testutil.FileContains, "Slice=snap.grp.slice\n")
+
+	// a creation is reverted
+	ts, err = servicestate.EnsureQuota(s.st, &quota.Group{Name: "other", Snaps: []string{"bar"}, TaskLimit: 32})
+	c.Assert(err, IsNil)
+	runAndUndo(ts)
+	_, err = servicestate.GetQuota(s.st, "other")
+	c.Check(err, Equals, state.ErrNoState)
+	c.Check(osutil.FileExists(filepath.Join(dirs.SnapServicesDir, "snap.other.slice")), Equals, false)
+	c.Check(osutil.FileExists(barDropIn), Equals, false)
+}
+
+func (s *quotaControlSuite) TestSnapstateHooks(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	info := s.mockSnap(c, "foo")
+	s.ensureQuota(c, &quota.Group{Name: "grp", Snaps: []string{"foo"}, TaskLimit: 32})
+	dropIn := filepath.Join(dirs.SnapServicesDir, "snap.foo.svc.service.d", "snap-quota.conf")
+	c.Assert(osutil.FileExists(dropIn), Equals, true)
+
+	// a drop-in lost along the way is put back before starting
+	c.Assert(os.Remove(dropIn), IsNil)
+	s.systemctls = nil
+	c.Assert(snapstate.EnsureSnapServicesQuota(s.st, info), IsNil)
+	c.Check(dropIn, testutil.FileContains, "Slice=snap.grp.slice\n")
+	c.Check(s.systemctls, DeepEquals, [][]string{{"daemon-reload"}})
+
+	c.Assert(snapstate.RemoveSnapFromQuota(s.st, "foo"), IsNil)
+	grp, err := servicestate.GetQuota(s.st, "grp")
+	c.Assert(err, IsNil)
+	c.Check(grp.Snaps, HasLen, 0)
+
+	// not in any group
+	c.Assert(snapstate.RemoveSnapFromQuota(s.st, "foo"), IsNil)
+}
+
+func (s *quotaControlSuite) TestCurrentQuotaUsage(c *C) {
+	usage, err := servicestate.CurrentQuotaUsage(&quota.Group{Name: "grp"})
+	c.Assert(err, IsNil)
+	c.Check(usage, DeepEquals, &servicestate.QuotaGroupUsage{Memory: 4096, CPU: 1500000000, Tasks: 3})
+	c.Check(s.systemctls, DeepEquals, [][]string{
+		{"show", "--property=MemoryCurrent", "snap.grp.slice"},
+		{"show", "--property=CPUUsageNSec", "snap.grp.slice"},
+		{"show", "--property=TasksCurrent", "snap.grp.slice"},
+	})
+}
@@ -0,0 +1,128 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package servicestate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/systemd"
+	userclient "github.com/snapcore/snapd/usersession/client"
+)
+
+// ServiceAction is the user service control to be carried out by a
+// "service-control" task.
+type ServiceAction struct {
+	// Commands are the systemctl-like commands to run, in order.
+	Commands []string `json:"commands"`
+	// Services are the names of the user service units.
+	Services []string `json:"services"`
+}
+
+// userServiceControlTimeout matches the timeout of the systemctl
+// commands run for system services.
+var userServiceControlTimeout = 61 * time.Second
+
+type userServiceClient interface {
+	ServicesStart(ctx context.Context, services []string) (startFailures, stopFailures []userclient.ServiceFailure, err error)
+	ServicesStop(ctx context.Context, services []string) (stopFailures []userclient.ServiceFailure, err error)
+	ServicesRestart(ctx context.Context, services []string) (restartFailures []userclient.ServiceFailure, err error)
+}
+
+var newUserServiceClient = func() userServiceClient {
+	return userclient.New()
+}
+
+func logServiceFailures(t *state.Task, action string, failures []userclient.ServiceFailure) {
+	if len(failures) == 0 {
+		return
+	}
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+	for _, f := range failures {
+		t.Logf("cannot %s %s for uid %d: %s", action, f.Service, f.Uid, f.Error)
+	}
+}
+
+func controlUserServices(t *state.Task, cmd string, services []string) error {
+	cli := newUserServiceClient()
+	ctx, cancel := context.WithTimeout(context.Background(), userServiceControlTimeout)
+	defer cancel()
+
+	switch cmd {
+	case "start":
+		startFailures, stopFailures, err := cli.ServicesStart(ctx, services)
+		logServiceFailures(t, "start", startFailures)
+		logServiceFailures(t, "stop", stopFailures)
+		return err
+	case "stop":
+		stopFailures, err := cli.ServicesStop(ctx, services)
+		logServiceFailures(t, "stop", stopFailures)
+		return err
+	case "restart", "reload-or-restart":
+		// the session agents do not know whether a service
+		// supports reloading, so user services are restarted
+		restartFailures, err := cli.ServicesRestart(ctx, services)
+		logServiceFailures(t, "restart", restartFailures)
+		return err
+	}
+	return fmt.Errorf("internal error: unknown user service command %q", cmd)
+}
+
+func (m *ServiceManager) doServiceControl(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	var sa ServiceAction
+	err := t.Get("service-action", &sa)
+	st.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// user services are enabled and disabled for all users at once
+	sysd := systemd.New(dirs.GlobalRootDir, systemd.GlobalUserMode, nil)
+	for _, cmd := range sa.Commands {
+		switch cmd {
+		case "enable":
+			for _, svc := range sa.Services {
+				if err := sysd.Enable(svc); err != nil {
+					return err
+				}
+			}
+		case "disable":
+			for _, svc := range sa.Services {
+				if err := sysd.Disable(svc); err != nil {
+					return err
+				}
+			}
+		default:
+			if err := controlUserServices(t, cmd, sa.Services); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
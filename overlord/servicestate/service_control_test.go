@@ -0,0 +1,245 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package servicestate_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/servicestate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/testutil"
+	userclient "github.com/snapcore/snapd/usersession/client"
+)
+
+type serviceControlSuite struct {
+	testutil.BaseTest
+
+	st         *state.State
+	runner     *state.TaskRunner
+	systemctls [][]string
+	userCalls  [][]string
+	userErr    error
+}
+
+var _ = Suite(&serviceControlSuite{})
+
+const userServicesYaml = `name: foo
+version: 1
+apps:
+  sys:
+    command: bin/sys
+    daemon: simple
+  usr:
+    command: bin/usr
+    daemon: simple
+    daemon-scope: user
+`
+
+type fakeUserServiceClient struct {
+	s *serviceControlSuite
+}
+
+func (f *fakeUserServiceClient) ServicesStart(ctx context.Context, services []string) (startFailures, stopFailures []userclient.ServiceFailure, err error) {
+	f.s.userCalls = append(f.s.userCalls, append([]string{"start"}, services...))
+	if f.s.userErr != nil {
+		return []userclient.ServiceFailure{{Uid: 1000, Service: services[0], Error: "boom"}}, nil, f.s.userErr
+	}
+	return nil, nil, nil
+}
+
+func (f *fakeUserServiceClient) ServicesStop(ctx context.Context, services []string) (stopFailures []userclient.ServiceFailure, err error) {
+	f.s.userCalls = append(f.s.userCalls, append([]string{"stop"}, services...))
+	return nil, f.s.userErr
+}
+
+func (f *fakeUserServiceClient) ServicesRestart(ctx context.Context, services []string) (restartFailures []userclient.ServiceFailure, err error) {
+	f.s.userCalls = append(f.s.userCalls, append([]string{"restart"}, services...))
+	return nil, f.s.userErr
+}
+
+func (s *serviceControlSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+
+	s.systemctls = nil
+	s.userCalls = nil
+	s.userErr = nil
+	s.AddCleanup(systemd.MockSystemctl(func(args ...string) ([]byte, error) {
+		s.systemctls = append(s.systemctls, args)
+		return nil, nil
+	}))
+	s.AddCleanup(servicestate.MockNewUserServiceClient(func() servicestate.UserServiceClient {
+		return &fakeUserServiceClient{s: s}
+	}))
+
+	s.st = state.New(nil)
+	s.runner = state.NewTaskRunner(s.st)
+	servicestate.Manager(s.st, s.runner)
+	s.AddCleanup(s.runner.Stop)
+}
+
+func (s *serviceControlSuite) settle(c *C) {
+	s.st.Unlock()
+	defer s.st.Lock()
+	for i := 0; i < 5; i++ {
+		c.Assert(s.runner.Ensure(), IsNil)
+		s.runner.Wait()
+	}
+}
+
+func (s *serviceControlSuite) TestManager(c *C) {
+	kinds := s.runner.KnownTaskKinds()
+	sort.Strings(kinds)
+	c.Check(kinds, DeepEquals, []string{"quota-control", "service-control"})
+}
+
+func (s *serviceControlSuite) TestControlSplitsUserServices(c *C) {
+	info := snaptest.MockInfo(c, userServicesYaml, &snap.SideInfo{Revision: snap.R(1)})
+
+	inst := &servicestate.Instruction{Action: "start", Names: []string{"foo"}}
+	inst.Enable = true
+	tts, err := servicestate.Control(s.st, []*snap.AppInfo{info.Apps["sys"], info.Apps["usr"]}, inst, nil)
+	c.Assert(err, IsNil)
+	c.Assert(tts, HasLen, 3)
+
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	var argv []string
+	c.Assert(tts[0].Tasks()[0].Get("argv", &argv), IsNil)
+	c.Check(argv, DeepEquals, []string{"systemctl", "enable", "snap.foo.sys.service"})
+	c.Assert(tts[1].Tasks()[0].Get("argv", &argv), IsNil)
+	c.Check(argv, DeepEquals, []string{"systemctl", "start", "snap.foo.sys.service"})
+
+	t := tts[2].Tasks()[0]
+	c.Check(t.Kind(), Equals, "service-control")
+	c.Check(t.Summary(), Equals, "enable and start of user services [foo.usr]")
+	c.Check(t.WaitTasks(), DeepEquals, tts[1].Tasks())
+	var sa servicestate.ServiceAction
+	c.Assert(t.Get("service-action", &sa), IsNil)
+	c.Check(sa, DeepEquals, servicestate.ServiceAction{
+		Commands: []string{"enable", "start"},
+		Services: []string{"snap.foo.usr.service"},
+	})
+}
+
+func (s *serviceControlSuite) TestControlOnlyUserServices(c *C) {
+	info := snaptest.MockInfo(c, userServicesYaml, &snap.SideInfo{Revision: snap.R(1)})
+
+	inst := &servicestate.Instruction{Action: "restart", Names: []string{"foo.usr"}}
+	inst.Reload = true
+	tts, err := servicestate.Control(s.st, []*snap.AppInfo{info.Apps["usr"]}, inst, nil)
+	c.Assert(err, IsNil)
+	c.Assert(tts, HasLen, 1)
+
+	s.st.Lock()
+	defer s.st.Unlock()
+	t := tts[0].Tasks()[0]
+	c.Check(t.Kind(), Equals, "service-control")
+	var sa servicestate.ServiceAction
+	c.Assert(t.Get("service-action", &sa), IsNil)
+	c.Check(sa.Commands, DeepEquals, []string{"reload-or-restart"})
+}
+
+func (s *serviceControlSuite) runServiceControl(c *C, sa *servicestate.ServiceAction) *state.Change {
+	t := s.st.NewTask("service-control", "...")
+	t.Set("service-action", sa)
+	chg := s.st.NewChange("service-control", "...")
+	chg.AddTask(t)
+
+	s.settle(c)
+	return chg
+}
+
+func (s *serviceControlSuite) TestDoServiceControlEnableStart(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	chg := s.runServiceControl(c, &servicestate.ServiceAction{
+		Commands: []string{"enable", "start"},
+		Services: []string{"snap.foo.usr.service"},
+	})
+	c.Assert(chg.Err(), IsNil)
+	c.Check(chg.Status(), Equals, state.DoneStatus)
+	c.Check(s.systemctls, DeepEquals, [][]string{
+		{"--user", "--global", "--root", dirs.GlobalRootDir, "enable", "snap.foo.usr.service"},
+	})
+	c.Check(s.userCalls, DeepEquals, [][]string{
+		{"start", "snap.foo.usr.service"},
+	})
+}
+
+func (s *serviceControlSuite) TestDoServiceControlDisableStop(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	chg := s.runServiceControl(c, &servicestate.ServiceAction{
+		Commands: []string{"disable", "stop"},
+		Services: []string{"snap.foo.usr.service"},
+	})
+	c.Assert(chg.Err(), IsNil)
+	c.Check(s.systemctls, DeepEquals, [][]string{
+		{"--user", "--global", "--root", dirs.GlobalRootDir, "disable", "snap.foo.usr.service"},
+	})
+	c.Check(s.userCalls, DeepEquals, [][]string{
+		{"stop", "snap.foo.usr.service"},
+	})
+}
+
+func (s *serviceControlSuite) TestDoServiceControlRestart(c *C) {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	chg := s.runServiceControl(c, &servicestate.ServiceAction{
+		Commands: []string{"reload-or-restart"},
+		Services: []string{"snap.foo.usr.service"},
+	})
+	c.Assert(chg.Err(), IsNil)
+	c.Check(s.systemctls, HasLen, 0)
+	c.Check(s.userCalls, DeepEquals, [][]string{
+		{"restart", "snap.foo.usr.service"},
+	})
+}
+
+func (s *serviceControlSuite) TestDoServiceControlError(c *C) {
+	s.userErr = errors.New("cannot start user services of uid 1000: some user services failed to start")
+
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	chg := s.runServiceControl(c, &servicestate.ServiceAction{
+		Commands: []string{"start"},
+		Services: []string{"snap.foo.usr.service"},
+	})
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*some user services failed to start.*`)
+	t := chg.Tasks()[0]
+	c.Check(t.Log(), HasLen, 2)
+	c.Check(t.Log()[0], Matches, `.* cannot start snap.foo.usr.service for uid 1000: boom`)
+}
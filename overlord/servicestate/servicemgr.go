@@ -0,0 +1,47 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package servicestate
+
+import (
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+// ServiceManager is responsible for controlling the services of snaps
+// that need more than a plain systemctl call, i.e. user services, and
+// for changing quota groups.
+type ServiceManager struct {
+	state *state.State
+}
+
+// Manager returns a new service manager.
+func Manager(st *state.State, runner *state.TaskRunner) *ServiceManager {
+	m := &ServiceManager{state: st}
+	runner.AddHandler("service-control", m.doServiceControl, nil)
+	runner.AddHandler("quota-control", m.doQuotaControl, m.undoQuotaControl)
+
+	snapstate.AddAffectedSnapsByAttr("quota-control-action", quotaControlAffectedSnaps)
+	return m
+}
+
+// Ensure is part of the overlord.StateManager interface.
+func (m *ServiceManager) Ensure() error {
+	return nil
+}
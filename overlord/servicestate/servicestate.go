@@ -21,6 +21,7 @@ package servicestate
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/snapcore/snapd/client"
@@ -73,14 +74,20 @@ func Control(st *state.State, appInfos []*snap.AppInfo, inst *Instruction, conte
 	st.Lock()
 	defer st.Unlock()
 
-	svcs := make([]string, 0, len(appInfos))
+	var svcs, userSvcs []string
+	var names, userNames []string
 	snapNames := make([]string, 0, len(appInfos))
 	lastName := ""
-	names := make([]string, len(appInfos))
-	for i, svc := range appInfos {
-		svcs = append(svcs, svc.ServiceName())
+	for _, svc := range appInfos {
 		snapName := svc.Snap.InstanceName()
-		names[i] = snapName + "." + svc.Name
+		name := snapName + "." + svc.Name
+		if svc.IsUserService() {
+			userSvcs = append(userSvcs, svc.ServiceName())
+			userNames = append(userNames, name)
+		} else {
+			svcs = append(svcs, svc.ServiceName())
+			names = append(names, name)
+		}
 		if snapName != lastName {
 			snapNames = append(snapNames, snapName)
 			lastName = snapName
@@ -100,16 +107,30 @@ func Control(st *state.State, appInfos []*snap.AppInfo, inst *Instruction, conte
 		return nil, &ServiceActionConflictError{err}
 	}
 
-	for _, cmd := range ctlcmds {
-		argv := append([]string{"systemctl", cmd}, svcs...)
-		desc := fmt.Sprintf("%s of %v", cmd, names)
-		// Give the systemctl a maximum time of 61 for now.
-		//
-		// Longer term we need to refactor this code and
-		// reuse the snapd/systemd and snapd/wrapper packages
-		// to control the timeout in a single place.
-		ts := cmdstate.ExecWithTimeout(st, desc, argv, 61*time.Second)
-		tts = append(tts, ts)
+	if len(svcs) > 0 {
+		for _, cmd := range ctlcmds {
+			argv := append([]string{"systemctl", cmd}, svcs...)
+			desc := fmt.Sprintf("%s of %v", cmd, names)
+			// Give the systemctl a maximum time of 61 for now.
+			//
+			// Longer term we need to refactor this code and
+			// reuse the snapd/systemd and snapd/wrapper packages
+			// to control the timeout in a single place.
+			ts := cmdstate.ExecWithTimeout(st, desc, argv, 61*time.Second)
+			tts = append(tts, ts)
+		}
+	}
+
+	if len(userSvcs) > 0 {
+		// user services live in the systemd instances of the
+		// logged in users, they are controlled through their
+		// session agents
+		t := st.NewTask("service-control", fmt.Sprintf("%s of user services %v", strings.Join(ctlcmds, " and "), userNames))
+		t.Set("service-action", &ServiceAction{
+			Commands: ctlcmds,
+			Services: userSvcs,
+		})
+		tts = append(tts, state.NewTaskSet(t))
 	}
 
 	// make a taskset wait for its predecessor
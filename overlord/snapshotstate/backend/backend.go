@@ -30,6 +30,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/snapcore/snapd/client"
@@ -61,6 +62,9 @@ var (
 // Flags encompasses extra flags for snapshots backend Save.
 type Flags struct {
 	Auto bool
+	// EncryptionKey, if set, is the public key to encrypt the
+	// archives of the snapshot for (see ParseEncryptionKey)
+	EncryptionKey string
 }
 
 // Iter loops over all snapshots in the snapshots directory, applying the given
@@ -92,6 +96,11 @@ func Iter(ctx context.Context, f func(*Reader) error) error {
 				break
 			}
 
+			if strings.HasPrefix(name, ".") {
+				// snapshots being imported, or other hidden files
+				continue
+			}
+
 			filename := filepath.Join(dirs.SnapshotsDir, name)
 			reader, openError := backendOpen(filename)
 			// reader can be non-nil even when openError is not nil (in
@@ -163,8 +172,10 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 	}
 
 	var auto bool
+	var encryptionKey string
 	if flags != nil {
 		auto = flags.Auto
+		encryptionKey = flags.EncryptionKey
 	}
 
 	snapshot := &client.Snapshot{
@@ -181,6 +192,18 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 		Auto:     auto,
 	}
 
+	var encrypter *snapshotCipher
+	if encryptionKey != "" {
+		key, err := ParseEncryptionKey(encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		encrypter, snapshot.Encryption, err = newSnapshotEncrypter(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	aw, err := osutil.NewAtomicFile(Filename(snapshot), 0600, 0, osutil.NoChown, osutil.NoChown)
 	if err != nil {
 		return nil, err
@@ -190,7 +213,7 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 
 	w := zip.NewWriter(aw)
 	defer w.Close() // note this does not close the file descriptor (that's done by hand on the atomic writer, above)
-	if err := addDirToZip(ctx, snapshot, w, "root", archiveName, si.DataDir()); err != nil {
+	if err := addDirToZip(ctx, snapshot, w, encrypter, "root", archiveName, si.DataDir()); err != nil {
 		return nil, err
 	}
 
@@ -200,7 +223,7 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 	}
 
 	for _, usr := range users {
-		if err := addDirToZip(ctx, snapshot, w, usr.Username, userArchiveName(usr), si.UserDataDir(usr.HomeDir)); err != nil {
+		if err := addDirToZip(ctx, snapshot, w, encrypter, usr.Username, userArchiveName(usr), si.UserDataDir(usr.HomeDir)); err != nil {
 			return nil, err
 		}
 	}
@@ -238,7 +261,7 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 
 var isTesting = osutil.GetenvBool("SNAPPY_TESTING")
 
-func addDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer, username string, entry, dir string) error {
+func addDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer, encrypter *snapshotCipher, username string, entry, dir string) error {
 	parent, revdir := filepath.Split(dir)
 	exists, isDir, err := osutil.DirExists(parent)
 	if err != nil {
@@ -301,8 +324,20 @@ func addDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer,
 	var sz sizer
 	hasher := crypto.SHA3_384.New()
 
+	// the hash and size are those of the archive as stored, so they
+	// can be checked without decrypting it
+	out := io.MultiWriter(archiveWriter, hasher, &sz)
+	var encWriter io.WriteCloser
+	if encrypter != nil {
+		encWriter, err = encrypter.Writer(entry, out)
+		if err != nil {
+			return err
+		}
+		out = encWriter
+	}
+
 	cmd := tarAsUser(username, tarArgs...)
-	cmd.Stdout = io.MultiWriter(archiveWriter, hasher, &sz)
+	cmd.Stdout = out
 	matchCounter := &strutil.MatchCounter{N: 1}
 	cmd.Stderr = matchCounter
 	if isTesting {
@@ -317,6 +352,12 @@ func addDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer,
 		return fmt.Errorf("tar failed: %v", err)
 	}
 
+	if encWriter != nil {
+		if err := encWriter.Close(); err != nil {
+			return err
+		}
+	}
+
 	snapshot.SHA3_384[entry] = fmt.Sprintf("%x", hasher.Sum(nil))
 	snapshot.Size += sz.size
 
@@ -20,9 +20,12 @@
 package backend_test
 
 import (
+	"archive/tar"
 	"archive/zip"
 	"bytes"
 	"context"
+	"crypto/elliptic"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -35,6 +38,7 @@ import (
 	"strings"
 	"testing"
 
+	"golang.org/x/crypto/sha3"
 	"gopkg.in/check.v1"
 
 	"github.com/snapcore/snapd/client"
@@ -408,11 +412,11 @@ func (s *snapshotSuite) TestAddDirToZipBails(c *check.C) {
 	buf, restore := logger.MockLogger()
 	defer restore()
 	// note as the zip is nil this would panic if it didn't bail
-	c.Check(backend.AddDirToZip(nil, snapshot, nil, "", "an/entry", filepath.Join(s.root, "nonexistent")), check.IsNil)
+	c.Check(backend.AddDirToZip(nil, snapshot, nil, nil, "", "an/entry", filepath.Join(s.root, "nonexistent")), check.IsNil)
 	// no log for the non-existent case
 	c.Check(buf.String(), check.Equals, "")
 	buf.Reset()
-	c.Check(backend.AddDirToZip(nil, snapshot, nil, "", "an/entry", "/etc/passwd"), check.IsNil)
+	c.Check(backend.AddDirToZip(nil, snapshot, nil, nil, "", "an/entry", "/etc/passwd"), check.IsNil)
 	c.Check(buf.String(), check.Matches, "(?m).* is not a directory.")
 }
 
@@ -426,7 +430,7 @@ func (s *snapshotSuite) TestAddDirToZipTarFails(c *check.C) {
 
 	var buf bytes.Buffer
 	z := zip.NewWriter(&buf)
-	c.Assert(backend.AddDirToZip(ctx, nil, z, "", "an/entry", d), check.ErrorMatches, ".* context canceled")
+	c.Assert(backend.AddDirToZip(ctx, nil, z, nil, "", "an/entry", d), check.ErrorMatches, ".* context canceled")
 }
 
 func (s *snapshotSuite) TestAddDirToZip(c *check.C) {
@@ -440,7 +444,7 @@ func (s *snapshotSuite) TestAddDirToZip(c *check.C) {
 	snapshot := &client.Snapshot{
 		SHA3_384: map[string]string{},
 	}
-	c.Assert(backend.AddDirToZip(context.Background(), snapshot, z, "", "an/entry", d), check.IsNil)
+	c.Assert(backend.AddDirToZip(context.Background(), snapshot, z, nil, "", "an/entry", d), check.IsNil)
 	z.Close() // write out the central directory
 
 	c.Check(snapshot.SHA3_384, check.HasLen, 1)
@@ -554,6 +558,116 @@ func (s *snapshotSuite) testHappyRoundtrip(c *check.C, marker string, auto bool)
 	}
 }
 
+func (s *snapshotSuite) TestHappyRoundtripEncrypted(c *check.C) {
+	// run tar directly, even as root
+	defer backend.MockSysGeteuid(func() sys.UserID { return 1000 })()
+	logger.SimpleSetup()
+
+	pub, priv := testKeyPair(c, elliptic.P256())
+	decKey, err := backend.ParseDecryptionKey(priv)
+	c.Assert(err, check.IsNil)
+	_, otherPriv := testKeyPair(c, elliptic.P256())
+	otherDecKey, err := backend.ParseDecryptionKey(otherPriv)
+	c.Assert(err, check.IsNil)
+
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33"}
+	shw, err := backend.Save(context.TODO(), 12, info, nil, []string{"snapuser"}, &backend.Flags{EncryptionKey: pub})
+	c.Assert(err, check.IsNil)
+	c.Assert(shw.Encryption, check.NotNil)
+	c.Check(shw.Encryption.KeyID, check.Equals, decKey.ID())
+	c.Check(hashkeys(shw), check.DeepEquals, []string{"archive.tgz", "user/snapuser.tgz"})
+
+	shr, err := backend.Open(backend.Filename(shw))
+	c.Assert(err, check.IsNil)
+	defer shr.Close()
+	// the metadata is readable
+	c.Check(shr.Snapshot.Encryption, check.DeepEquals, shw.Encryption)
+	c.Check(shr.SHA3_384, check.DeepEquals, shw.SHA3_384)
+
+	// and the data is not
+	for _, t := range table(snap.MinimalPlaceInfo("hello-snap", snap.R(42)), filepath.Join(dirs.GlobalRootDir, "home/snapuser")) {
+		data, err := ioutil.ReadFile(backend.Filename(shw))
+		c.Assert(err, check.IsNil)
+		c.Check(bytes.Contains(data, []byte(t.content)), check.Equals, false)
+		c.Check(bytes.Contains(data, []byte(t.name)), check.Equals, false)
+	}
+
+	// the hashes can be checked without the key
+	c.Check(shr.Check(context.TODO(), nil), check.IsNil)
+	// but restoring needs it
+	_, err = shr.Restore(context.TODO(), snap.R(0), nil, logger.Debugf)
+	c.Check(err, check.ErrorMatches, `cannot restore snapshot ".*": snapshot is encrypted and no decryption key was given`)
+
+	c.Check(shr.SetDecryptionKey(otherDecKey), check.ErrorMatches, `cannot decrypt snapshot of "hello-snap" in set #12: decryption key \(.*\) does not match .*`)
+	c.Assert(shr.SetDecryptionKey(decKey), check.IsNil)
+	c.Check(shr.Check(context.TODO(), nil), check.IsNil)
+
+	newroot := c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(newroot, "home/snapuser"), 0755), check.IsNil)
+	dirs.SetRootDir(newroot)
+
+	rs, err := shr.Restore(context.TODO(), snap.R(0), nil, logger.Debugf)
+	c.Assert(err, check.IsNil)
+	rs.Cleanup()
+	c.Check(exec.Command("diff", "-urN", "-x*.zip", s.root, newroot).Run(), check.IsNil)
+}
+
+func (s *snapshotSuite) TestCheckEncryptedTampered(c *check.C) {
+	defer backend.MockSysGeteuid(func() sys.UserID { return 1000 })()
+
+	pub, priv := testKeyPair(c, elliptic.P256())
+	decKey, err := backend.ParseDecryptionKey(priv)
+	c.Assert(err, check.IsNil)
+
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42)}, Version: "v1.33"}
+	shw, err := backend.Save(context.TODO(), 12, info, nil, []string{"snapuser"}, &backend.Flags{EncryptionKey: pub})
+	c.Assert(err, check.IsNil)
+
+	// rewrite the snapshot with a flipped bit in an archive, and a
+	// hash that matches the result
+	fn := backend.Filename(shw)
+	zr, err := zip.OpenReader(fn)
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range zr.File {
+		r, err := f.Open()
+		c.Assert(err, check.IsNil)
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		c.Assert(err, check.IsNil)
+		switch f.Name {
+		case "archive.tgz":
+			data[len(data)/2] ^= 1
+			shw.SHA3_384["archive.tgz"] = fmt.Sprintf("%x", sha3.Sum384(data))
+		case "meta.json":
+			data, err = json.Marshal(shw)
+			c.Assert(err, check.IsNil)
+			data = append(data, '\n')
+		case "meta.sha3_384":
+			meta, err := json.Marshal(shw)
+			c.Assert(err, check.IsNil)
+			data = []byte(fmt.Sprintf("%x\n", sha3.Sum384(append(meta, '\n'))))
+		}
+		w, err := zw.Create(f.Name)
+		c.Assert(err, check.IsNil)
+		_, err = w.Write(data)
+		c.Assert(err, check.IsNil)
+	}
+	zr.Close()
+	c.Assert(zw.Close(), check.IsNil)
+	c.Assert(ioutil.WriteFile(fn, buf.Bytes(), 0600), check.IsNil)
+
+	shr, err := backend.Open(fn)
+	c.Assert(err, check.IsNil)
+	defer shr.Close()
+	// the hashes check out
+	c.Check(shr.Check(context.TODO(), nil), check.IsNil)
+	// but the archive does not decrypt
+	c.Assert(shr.SetDecryptionKey(decKey), check.IsNil)
+	c.Check(shr.Check(context.TODO(), nil), check.ErrorMatches, `snapshot entry "archive.tgz": cannot decrypt archive: cipher: message authentication failed`)
+}
+
 func (s *snapshotSuite) TestRestoreRoundtripDifferentRevision(c *check.C) {
 	if os.Geteuid() == 0 {
 		c.Skip("this test cannot run as root (runuser will fail)")
@@ -718,3 +832,161 @@ func (s *snapshotSuite) TestMaybeRunuserNoHappy(c *check.C) {
 	})
 	c.Check(strings.TrimSpace(logbuf.String()), check.Matches, ".* No user wrapper found.*")
 }
+
+func (s *snapshotSuite) saveForExport(c *check.C, setID uint64) *client.Snapshot {
+	logger.SimpleSetup()
+
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33"}
+	shw, err := backend.Save(context.TODO(), setID, info, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	return shw
+}
+
+func (s *snapshotSuite) TestExportImportRoundtrip(c *check.C) {
+	shw := s.saveForExport(c, 12)
+
+	se, err := backend.NewSnapshotExport(context.TODO(), 12)
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	c.Assert(se.StreamTo(&buf), check.IsNil)
+	se.Close()
+
+	snapNames, err := backend.Import(context.TODO(), 13, &buf)
+	c.Assert(err, check.IsNil)
+	c.Check(snapNames, check.DeepEquals, []string{"hello-snap"})
+
+	sets, err := backend.List(context.TODO(), 0, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(sets, check.HasLen, 2)
+	c.Check(sets[0].ID, check.Equals, uint64(12))
+	c.Check(sets[1].ID, check.Equals, uint64(13))
+	c.Assert(sets[1].Snapshots, check.HasLen, 1)
+	sh := sets[1].Snapshots[0]
+	c.Check(sh.Snap, check.Equals, "hello-snap")
+	c.Check(sh.SnapID, check.Equals, "hello-id")
+	c.Check(sh.Version, check.Equals, "v1.33")
+	c.Check(sh.SHA3_384, check.DeepEquals, shw.SHA3_384)
+
+	rdr, err := backend.Open(filepath.Join(dirs.SnapshotsDir, "13_hello-snap_v1.33_42.zip"))
+	c.Assert(err, check.IsNil)
+	defer rdr.Close()
+	c.Check(rdr.Check(context.TODO(), nil), check.IsNil)
+
+	// no leftovers from the import
+	matches, err := filepath.Glob(filepath.Join(dirs.SnapshotsDir, ".*"))
+	c.Assert(err, check.IsNil)
+	c.Check(matches, check.HasLen, 0)
+}
+
+func (s *snapshotSuite) TestExportNotFound(c *check.C) {
+	s.saveForExport(c, 12)
+
+	_, err := backend.NewSnapshotExport(context.TODO(), 42)
+	c.Check(err, check.Equals, client.ErrSnapshotSetNotFound)
+}
+
+func (s *snapshotSuite) TestIterSkipsHiddenFiles(c *check.C) {
+	c.Assert(os.MkdirAll(dirs.SnapshotsDir, 0700), check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dirs.SnapshotsDir, ".import-foo.zip"), nil, 0600), check.IsNil)
+
+	logbuf, restore := logger.MockLogger()
+	defer restore()
+
+	n := 0
+	err := backend.Iter(context.TODO(), func(*backend.Reader) error {
+		n++
+		return nil
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(n, check.Equals, 0)
+	c.Check(logbuf.String(), check.Equals, "")
+}
+
+func makeImport(c *check.C, files map[string][]byte, meta string) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if meta != "" {
+		c.Assert(tw.WriteHeader(&tar.Header{Name: "export.json", Mode: 0600, Size: int64(len(meta))}), check.IsNil)
+		_, err := tw.Write([]byte(meta))
+		c.Assert(err, check.IsNil)
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c.Assert(tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(files[name]))}), check.IsNil)
+		_, err := tw.Write(files[name])
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(tw.Close(), check.IsNil)
+	return &buf
+}
+
+func (s *snapshotSuite) TestImportTampered(c *check.C) {
+	shw := s.saveForExport(c, 12)
+
+	// rewrite the snapshot with a different archive, keeping its metadata
+	orig, err := zip.OpenReader(backend.Filename(shw))
+	c.Assert(err, check.IsNil)
+	defer orig.Close()
+	var zbuf bytes.Buffer
+	w := zip.NewWriter(&zbuf)
+	for _, f := range orig.File {
+		fw, err := w.Create(f.Name)
+		c.Assert(err, check.IsNil)
+		if f.Name == "archive.tgz" {
+			_, err = fw.Write([]byte("not the data you are looking for"))
+			c.Assert(err, check.IsNil)
+			continue
+		}
+		fr, err := f.Open()
+		c.Assert(err, check.IsNil)
+		_, err = io.Copy(fw, fr)
+		fr.Close()
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(w.Close(), check.IsNil)
+
+	name := filepath.Base(backend.Filename(shw))
+	r := makeImport(c, map[string][]byte{name: zbuf.Bytes()}, fmt.Sprintf(`{"format-version": 1, "files": [%q]}`, name))
+	_, err = backend.Import(context.TODO(), 13, r)
+	c.Check(err, check.ErrorMatches, `cannot import snapshot ".*": snapshot entry "archive.tgz" expected hash \(.*\) does not match actual \(.*\)`)
+
+	// nothing was imported, nothing was left behind
+	matches, err := filepath.Glob(filepath.Join(dirs.SnapshotsDir, "*"))
+	c.Assert(err, check.IsNil)
+	c.Check(matches, check.DeepEquals, []string{backend.Filename(shw)})
+	matches, err = filepath.Glob(filepath.Join(dirs.SnapshotsDir, ".*"))
+	c.Assert(err, check.IsNil)
+	c.Check(matches, check.HasLen, 0)
+}
+
+func (s *snapshotSuite) TestImportErrors(c *check.C) {
+	for _, t := range []struct {
+		files map[string][]byte
+		meta  string
+		err   string
+	}{
+		{nil, "", `cannot import snapshot: empty import`},
+		{map[string][]byte{"foo.zip": nil}, "", `cannot import snapshot: expected "export.json" as first member, got "foo.zip"`},
+		{nil, `{"format-version": 2}`, `cannot import snapshot: unsupported format version 2`},
+		{nil, `}`, `cannot import snapshot: cannot decode export.json: .*`},
+		{map[string][]byte{"foo.txt": nil}, `{"format-version": 1, "files": ["foo.txt"]}`, `cannot import snapshot: unexpected member "foo.txt"`},
+		{map[string][]byte{"../foo.zip": nil}, `{"format-version": 1, "files": ["../foo.zip"]}`, `cannot import snapshot: unexpected member "../foo.zip"`},
+		{map[string][]byte{"foo.zip": nil}, `{"format-version": 1, "files": ["bar.zip"]}`, `cannot import snapshot: unexpected member "foo.zip"`},
+		{nil, `{"format-version": 1, "files": ["foo.zip"]}`, `cannot import snapshot: expected 1 snapshots, got 0`},
+		{map[string][]byte{"foo.zip": []byte("foo")}, `{"format-version": 1, "files": ["foo.zip"]}`, `cannot import snapshot "foo.zip": zip: not a valid zip file`},
+	} {
+		_, err := backend.Import(context.TODO(), 13, makeImport(c, t.files, t.meta))
+		c.Check(err, check.ErrorMatches, t.err, check.Commentf("%s", t.meta))
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dirs.SnapshotsDir, "*"))
+	c.Assert(err, check.IsNil)
+	c.Check(matches, check.HasLen, 0)
+	matches, err = filepath.Glob(filepath.Join(dirs.SnapshotsDir, ".*"))
+	c.Assert(err, check.IsNil)
+	c.Check(matches, check.HasLen, 0)
+}
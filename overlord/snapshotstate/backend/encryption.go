@@ -0,0 +1,380 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package backend
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/snapcore/snapd/client"
+)
+
+// The archives of an encrypted snapshot are encrypted with AES-256-GCM,
+// in chunks, with a key derived from an ECDH agreement on P-256 between
+// an ephemeral key generated for the snapshot and the public key it is
+// encrypted for. Only the archives are encrypted; the metadata, and the
+// hashes of the (encrypted) archives, stay readable.
+const encryptionScheme = "p256-aes256gcm"
+
+const (
+	encryptionChunkSize = 64 * 1024
+	nonceSize           = 12
+)
+
+var randReader = rand.Reader
+
+// EncryptionKey is a public key snapshots can be encrypted for.
+type EncryptionKey struct {
+	pub *ecdsa.PublicKey
+	id  string
+}
+
+// DecryptionKey is the private key needed to decrypt the snapshots
+// encrypted for its public key.
+type DecryptionKey struct {
+	priv *ecdsa.PrivateKey
+	id   string
+}
+
+// ID identifies the key; it's the same for both halves of a key pair.
+func (k *EncryptionKey) ID() string {
+	return k.id
+}
+
+// ID identifies the key; it's the same for both halves of a key pair.
+func (k *DecryptionKey) ID() string {
+	return k.id
+}
+
+func keyID(pub *ecdsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	h := crypto.SHA3_384.New()
+	h.Write(der)
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+func checkCurve(pub *ecdsa.PublicKey) error {
+	if pub.Curve != elliptic.P256() {
+		return fmt.Errorf("unsupported elliptic curve %s (only P-256 is supported)", pub.Curve.Params().Name)
+	}
+	return nil
+}
+
+// ParseEncryptionKey parses a public key, either PEM encoded or as the
+// base64 encoding of its DER form, to encrypt snapshots for.
+func ParseEncryptionKey(s string) (*EncryptionKey, error) {
+	var der []byte
+	if block, _ := pem.Decode([]byte(s)); block != nil {
+		der = block.Bytes
+	} else {
+		var err error
+		der, err = base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode encryption key: %v", err)
+		}
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse encryption key: %v", err)
+	}
+	pub, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("cannot use encryption key: not an elliptic curve key")
+	}
+	if err := checkCurve(pub); err != nil {
+		return nil, fmt.Errorf("cannot use encryption key: %v", err)
+	}
+	id, err := keyID(pub)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptionKey{pub: pub, id: id}, nil
+}
+
+// ParseDecryptionKey parses a PEM encoded private key, either in SEC 1
+// ("EC PRIVATE KEY") or PKCS #8 ("PRIVATE KEY") form.
+func ParseDecryptionKey(s string) (*DecryptionKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, fmt.Errorf("cannot decode decryption key: no PEM data found")
+	}
+	var priv *ecdsa.PrivateKey
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		var err error
+		priv, err = x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse decryption key: %v", err)
+		}
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse decryption key: %v", err)
+		}
+		var ok bool
+		priv, ok = key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("cannot use decryption key: not an elliptic curve key")
+		}
+	default:
+		return nil, fmt.Errorf("cannot decode decryption key: unexpected PEM block type %q", block.Type)
+	}
+	if err := checkCurve(&priv.PublicKey); err != nil {
+		return nil, fmt.Errorf("cannot use decryption key: %v", err)
+	}
+	id, err := keyID(&priv.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &DecryptionKey{priv: priv, id: id}, nil
+}
+
+// snapshotCipher encrypts or decrypts the archives of one snapshot.
+type snapshotCipher struct {
+	shared    []byte
+	ephemeral []byte
+}
+
+// newSnapshotEncrypter generates the ephemeral key for a new snapshot
+// encrypted for the given key, and returns the encrypter for its
+// archives along with the encryption metadata to store in it.
+func newSnapshotEncrypter(key *EncryptionKey) (*snapshotCipher, *client.SnapshotEncryption, error) {
+	curve := key.pub.Curve
+	d, x, y, err := elliptic.GenerateKey(curve, randReader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot generate ephemeral key: %v", err)
+	}
+	sx, _ := curve.ScalarMult(key.pub.X, key.pub.Y, d)
+	sc := &snapshotCipher{
+		shared:    sharedSecret(curve, sx),
+		ephemeral: elliptic.Marshal(curve, x, y),
+	}
+	meta := &client.SnapshotEncryption{
+		Scheme:       encryptionScheme,
+		KeyID:        key.id,
+		EphemeralKey: base64.StdEncoding.EncodeToString(sc.ephemeral),
+	}
+	return sc, meta, nil
+}
+
+// newSnapshotDecrypter returns the cipher to decrypt the archives of a
+// snapshot with the given encryption metadata.
+func newSnapshotDecrypter(key *DecryptionKey, meta *client.SnapshotEncryption) (*snapshotCipher, error) {
+	if meta.Scheme != encryptionScheme {
+		return nil, fmt.Errorf("unsupported snapshot encryption scheme %q", meta.Scheme)
+	}
+	if meta.KeyID != key.id {
+		return nil, fmt.Errorf("decryption key (%.7s…) does not match the key the snapshot was encrypted for (%.7s…)", key.id, meta.KeyID)
+	}
+	ephemeral, err := base64.StdEncoding.DecodeString(meta.EphemeralKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode snapshot ephemeral key: %v", err)
+	}
+	curve := key.priv.Curve
+	x, y := elliptic.Unmarshal(curve, ephemeral)
+	if x == nil {
+		return nil, fmt.Errorf("invalid snapshot ephemeral key")
+	}
+	sx, _ := curve.ScalarMult(x, y, key.priv.D.Bytes())
+	return &snapshotCipher{
+		shared:    sharedSecret(curve, sx),
+		ephemeral: ephemeral,
+	}, nil
+}
+
+func sharedSecret(curve elliptic.Curve, x *big.Int) []byte {
+	// left-pad to the size of the field so the secret is always the
+	// same length
+	size := (curve.Params().BitSize + 7) / 8
+	secret := make([]byte, size)
+	xb := x.Bytes()
+	copy(secret[size-len(xb):], xb)
+	return secret
+}
+
+// aead returns the cipher for the given archive of the snapshot; each
+// archive gets its own key so that chunks cannot be moved between them.
+func (sc *snapshotCipher) aead(entry string) (cipher.AEAD, error) {
+	h := sha256.New()
+	h.Write(sc.shared)
+	h.Write(sc.ephemeral)
+	h.Write([]byte(entry))
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce returns the nonce for the given chunk; the last chunk is
+// flagged so that truncation of the archive is detected.
+func chunkNonce(nonce []byte, counter uint64, last bool) []byte {
+	binary.BigEndian.PutUint64(nonce, counter)
+	nonce[nonceSize-1] = 0
+	if last {
+		nonce[nonceSize-1] = 1
+	}
+	return nonce
+}
+
+// Writer returns a writer that encrypts the given archive of the
+// snapshot into w. It must be closed to write out the last chunk.
+func (sc *snapshotCipher) Writer(entry string, w io.Writer) (io.WriteCloser, error) {
+	aead, err := sc.aead(entry)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptingWriter{
+		w:     w,
+		aead:  aead,
+		buf:   make([]byte, 0, encryptionChunkSize),
+		nonce: make([]byte, nonceSize),
+	}, nil
+}
+
+type encryptingWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	buf     []byte
+	out     []byte
+	nonce   []byte
+	counter uint64
+}
+
+func (ew *encryptingWriter) seal(last bool) error {
+	ew.out = ew.aead.Seal(ew.out[:0], chunkNonce(ew.nonce, ew.counter, last), ew.buf, nil)
+	ew.counter++
+	ew.buf = ew.buf[:0]
+	_, err := ew.w.Write(ew.out)
+	return err
+}
+
+func (ew *encryptingWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if len(ew.buf) == encryptionChunkSize {
+			// only seal a full chunk once there's more data, as the
+			// last chunk must be sealed as such on Close
+			if err := ew.seal(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(ew.buf[len(ew.buf):encryptionChunkSize], p)
+		ew.buf = ew.buf[:len(ew.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+func (ew *encryptingWriter) Close() error {
+	return ew.seal(true)
+}
+
+var errTruncated = errors.New("encrypted archive is truncated")
+
+// Reader returns a reader that decrypts the given archive of the
+// snapshot as read from r.
+func (sc *snapshotCipher) Reader(entry string, r io.Reader) (io.Reader, error) {
+	aead, err := sc.aead(entry)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptingReader{
+		r:     bufio.NewReaderSize(r, encryptionChunkSize+aead.Overhead()+1),
+		aead:  aead,
+		buf:   make([]byte, encryptionChunkSize+aead.Overhead()),
+		nonce: make([]byte, nonceSize),
+	}, nil
+}
+
+type decryptingReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	buf     []byte
+	plain   []byte
+	out     []byte
+	nonce   []byte
+	counter uint64
+	done    bool
+}
+
+func (dr *decryptingReader) open() error {
+	n, err := io.ReadFull(dr.r, dr.buf)
+	switch err {
+	case nil, io.ErrUnexpectedEOF:
+		// ok
+	case io.EOF:
+		return errTruncated
+	default:
+		return err
+	}
+	// the last chunk is the one not followed by any more data
+	last := err == io.ErrUnexpectedEOF
+	if !last {
+		if _, err := dr.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+	// note an archive truncated right after a chunk ends up here
+	// with that chunk taken as the last one, failing to open
+	dr.plain, err = dr.aead.Open(dr.plain[:0], chunkNonce(dr.nonce, dr.counter, last), dr.buf[:n], nil)
+	if err != nil {
+		return fmt.Errorf("cannot decrypt archive: %v", err)
+	}
+	dr.out = dr.plain
+	dr.counter++
+	dr.done = last
+	return nil
+}
+
+func (dr *decryptingReader) Read(p []byte) (int, error) {
+	for len(dr.out) == 0 {
+		if dr.done {
+			return 0, io.EOF
+		}
+		if err := dr.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, dr.out)
+	dr.out = dr.out[n:]
+	return n, nil
+}
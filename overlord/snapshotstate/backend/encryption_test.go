@@ -0,0 +1,205 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package backend_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+)
+
+type encryptionSuite struct{}
+
+var _ = check.Suite(&encryptionSuite{})
+
+// testKeyPair returns a generated key pair, with the public key in the
+// form of the encryption-key option and the private one PEM encoded.
+func testKeyPair(c *check.C, curve elliptic.Curve) (pub, priv string) {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	c.Assert(err, check.IsNil)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	c.Assert(err, check.IsNil)
+	privDER, err := x509.MarshalECPrivateKey(key)
+	c.Assert(err, check.IsNil)
+	return base64.StdEncoding.EncodeToString(der), string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privDER}))
+}
+
+func (s *encryptionSuite) keys(c *check.C) (*backend.EncryptionKey, *backend.DecryptionKey) {
+	pub, priv := testKeyPair(c, elliptic.P256())
+	encKey, err := backend.ParseEncryptionKey(pub)
+	c.Assert(err, check.IsNil)
+	decKey, err := backend.ParseDecryptionKey(priv)
+	c.Assert(err, check.IsNil)
+	return encKey, decKey
+}
+
+func (s *encryptionSuite) TestParseKeys(c *check.C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, check.IsNil)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	c.Assert(err, check.IsNil)
+	sec1, err := x509.MarshalECPrivateKey(key)
+	c.Assert(err, check.IsNil)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	c.Assert(err, check.IsNil)
+
+	var ids []string
+	for _, pub := range []string{
+		base64.StdEncoding.EncodeToString(der),
+		base64.StdEncoding.EncodeToString(der) + "\n",
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	} {
+		encKey, err := backend.ParseEncryptionKey(pub)
+		c.Assert(err, check.IsNil)
+		ids = append(ids, encKey.ID())
+	}
+	for _, priv := range []*pem.Block{
+		{Type: "EC PRIVATE KEY", Bytes: sec1},
+		{Type: "PRIVATE KEY", Bytes: pkcs8},
+	} {
+		decKey, err := backend.ParseDecryptionKey(string(pem.EncodeToMemory(priv)))
+		c.Assert(err, check.IsNil)
+		ids = append(ids, decKey.ID())
+	}
+
+	c.Check(ids[0], check.HasLen, 96)
+	for _, id := range ids[1:] {
+		c.Check(id, check.Equals, ids[0])
+	}
+}
+
+func (s *encryptionSuite) TestParseKeysErrors(c *check.C) {
+	p384pub, p384priv := testKeyPair(c, elliptic.P384())
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	c.Assert(err, check.IsNil)
+	rsaDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	c.Assert(err, check.IsNil)
+	rsaPKCS8, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	c.Assert(err, check.IsNil)
+
+	for pub, expected := range map[string]string{
+		"not base64!": `cannot decode encryption key: .*`,
+		"Zm9v":        `cannot parse encryption key: .*`,
+		p384pub:       `cannot use encryption key: unsupported elliptic curve P-384 \(only P-256 is supported\)`,
+		base64.StdEncoding.EncodeToString(rsaDER): `cannot use encryption key: not an elliptic curve key`,
+	} {
+		_, err := backend.ParseEncryptionKey(pub)
+		c.Check(err, check.ErrorMatches, expected, check.Commentf(pub))
+	}
+
+	for priv, expected := range map[string]string{
+		"foo": `cannot decode decryption key: no PEM data found`,
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rsaDER})):     `cannot decode decryption key: unexpected PEM block type "PUBLIC KEY"`,
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: rsaDER})): `cannot parse decryption key: .*`,
+		string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: rsaPKCS8})):  `cannot use decryption key: not an elliptic curve key`,
+		p384priv: `cannot use decryption key: unsupported elliptic curve P-384 \(only P-256 is supported\)`,
+	} {
+		_, err := backend.ParseDecryptionKey(priv)
+		c.Check(err, check.ErrorMatches, expected, check.Commentf(priv))
+	}
+}
+
+func (s *encryptionSuite) TestRoundtrip(c *check.C) {
+	encKey, decKey := s.keys(c)
+
+	for _, size := range []int{0, 1, backend.EncryptionChunkSize - 1, backend.EncryptionChunkSize, backend.EncryptionChunkSize + 1, 3*backend.EncryptionChunkSize + 42} {
+		data := make([]byte, size)
+		_, err := rand.Read(data)
+		c.Assert(err, check.IsNil)
+
+		decrypted, meta, err := backend.EncryptionRoundtrip(encKey, decKey, "archive.tgz", "archive.tgz", data, func(encrypted []byte) []byte {
+			// a few bytes can show up in the ciphertext by chance
+			if size >= 16 {
+				c.Check(bytes.Contains(encrypted, data), check.Equals, false)
+			}
+			return encrypted
+		})
+		c.Assert(err, check.IsNil, check.Commentf("%d", size))
+		c.Check(bytes.Equal(decrypted, data), check.Equals, true, check.Commentf("%d", size))
+		c.Check(meta.Scheme, check.Equals, "p256-aes256gcm")
+		c.Check(meta.KeyID, check.Equals, encKey.ID())
+		c.Check(meta.EphemeralKey, check.Not(check.Equals), "")
+	}
+}
+
+func (s *encryptionSuite) TestEphemeralKeyPerSnapshot(c *check.C) {
+	encKey, decKey := s.keys(c)
+
+	_, meta1, err := backend.EncryptionRoundtrip(encKey, decKey, "archive.tgz", "archive.tgz", []byte("foo"), nil)
+	c.Assert(err, check.IsNil)
+	_, meta2, err := backend.EncryptionRoundtrip(encKey, decKey, "archive.tgz", "archive.tgz", []byte("foo"), nil)
+	c.Assert(err, check.IsNil)
+	c.Check(meta1.EphemeralKey, check.Not(check.Equals), meta2.EphemeralKey)
+}
+
+func (s *encryptionSuite) TestWrongKey(c *check.C) {
+	encKey, _ := s.keys(c)
+	_, otherDecKey := s.keys(c)
+
+	_, _, err := backend.EncryptionRoundtrip(encKey, otherDecKey, "archive.tgz", "archive.tgz", []byte("foo"), nil)
+	c.Check(err, check.ErrorMatches, `decryption key \(.*…\) does not match the key the snapshot was encrypted for \(.*…\)`)
+}
+
+func (s *encryptionSuite) TestWrongEntry(c *check.C) {
+	encKey, decKey := s.keys(c)
+
+	_, _, err := backend.EncryptionRoundtrip(encKey, decKey, "archive.tgz", "user/snapuser.tgz", []byte("foo"), nil)
+	c.Check(err, check.ErrorMatches, `cannot decrypt archive: cipher: message authentication failed`)
+}
+
+func (s *encryptionSuite) TestTampered(c *check.C) {
+	encKey, decKey := s.keys(c)
+	data := make([]byte, 2*backend.EncryptionChunkSize+10)
+	overhead := 16
+
+	for name, mangle := range map[string]func([]byte) []byte{
+		"flipped": func(b []byte) []byte {
+			b[len(b)/2] ^= 1
+			return b
+		},
+		"truncated at chunk": func(b []byte) []byte {
+			return b[:backend.EncryptionChunkSize+overhead]
+		},
+		"truncated mid chunk": func(b []byte) []byte {
+			return b[:backend.EncryptionChunkSize+overhead+10]
+		},
+		"chunks swapped": func(b []byte) []byte {
+			chunk := backend.EncryptionChunkSize + overhead
+			swapped := append([]byte(nil), b[chunk:2*chunk]...)
+			swapped = append(swapped, b[:chunk]...)
+			return append(swapped, b[2*chunk:]...)
+		},
+	} {
+		_, _, err := backend.EncryptionRoundtrip(encKey, decKey, "archive.tgz", "archive.tgz", data, mangle)
+		c.Check(err, check.ErrorMatches, `cannot decrypt archive: cipher: message authentication failed`, check.Commentf(name))
+	}
+
+	_, _, err := backend.EncryptionRoundtrip(encKey, decKey, "archive.tgz", "archive.tgz", data, func([]byte) []byte { return nil })
+	c.Check(err, check.ErrorMatches, `encrypted archive is truncated`)
+}
@@ -0,0 +1,345 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package backend
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/naming"
+	"github.com/snapcore/snapd/strutil"
+)
+
+const (
+	exportMetadataName  = "export.json"
+	exportFormatVersion = 1
+
+	importTmpPrefix = ".import-"
+)
+
+// exportMetadata is the first member of an exported snapshot set,
+// describing the members that follow it.
+type exportMetadata struct {
+	FormatVersion int       `json:"format-version"`
+	Date          time.Time `json:"date"`
+	Files         []string  `json:"files"`
+}
+
+// SnapshotExport is a snapshot set that's been opened for exporting.
+type SnapshotExport struct {
+	SetID uint64
+
+	files []*os.File
+}
+
+// NewSnapshotExport opens all the snapshots of the given set, so that
+// they can be streamed with StreamTo even if the set is forgotten in
+// the meantime. The caller must Close the returned SnapshotExport
+// when done with it.
+func NewSnapshotExport(ctx context.Context, setID uint64) (_ *SnapshotExport, e error) {
+	se := &SnapshotExport{SetID: setID}
+	defer func() {
+		if e != nil {
+			se.Close()
+		}
+	}()
+
+	err := Iter(ctx, func(reader *Reader) error {
+		if reader.SetID != setID {
+			return nil
+		}
+		// the reader is closed by Iter, keep our own handle
+		f, err := os.Open(reader.Name())
+		if err != nil {
+			return err
+		}
+		se.files = append(se.files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot export snapshot set #%d: %v", setID, err)
+	}
+	if len(se.files) == 0 {
+		return nil, client.ErrSnapshotSetNotFound
+	}
+	sort.Slice(se.files, func(i, j int) bool { return se.files[i].Name() < se.files[j].Name() })
+
+	return se, nil
+}
+
+// Close the files of the snapshot set.
+func (se *SnapshotExport) Close() {
+	for _, f := range se.files {
+		f.Close()
+	}
+	se.files = nil
+}
+
+// StreamTo writes the snapshot set, as a tar archive, to the given writer.
+func (se *SnapshotExport) StreamTo(w io.Writer) error {
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+
+	now := time.Now()
+	meta := exportMetadata{
+		FormatVersion: exportFormatVersion,
+		Date:          now,
+		Files:         make([]string, len(se.files)),
+	}
+	for i, f := range se.files {
+		meta.Files[i] = filepath.Base(f.Name())
+	}
+	metaBuf, err := json.Marshal(&meta)
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     exportMetadataName,
+		Size:     int64(len(metaBuf)),
+		Mode:     0600,
+		ModTime:  now,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(metaBuf); err != nil {
+		return err
+	}
+
+	for _, f := range se.files {
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     filepath.Base(f.Name()),
+			Size:     fi.Size(),
+			Mode:     0600,
+			ModTime:  fi.ModTime(),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := f.Seek(0, 0); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, f); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// Import a snapshot set, as written by SnapshotExport.StreamTo, from the
+// given reader, giving it the given set id. Every snapshot in the set is
+// checked against the hashes recorded in its metadata before the set is
+// accepted. It returns the names of the snaps in the imported set.
+func Import(ctx context.Context, id uint64, r io.Reader) (snapNames []string, e error) {
+	if err := os.MkdirAll(dirs.SnapshotsDir, 0700); err != nil {
+		return nil, err
+	}
+
+	var tmpFiles, imported []string
+	defer func() {
+		for _, fn := range tmpFiles {
+			os.Remove(fn)
+		}
+		if e != nil {
+			for _, fn := range imported {
+				os.Remove(fn)
+			}
+		}
+	}()
+
+	var meta *exportMetadata
+	var received []string
+	tr := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read snapshot import: %v", err)
+		}
+
+		if meta == nil {
+			if hdr.Name != exportMetadataName {
+				return nil, fmt.Errorf("cannot import snapshot: expected %q as first member, got %q", exportMetadataName, hdr.Name)
+			}
+			meta = &exportMetadata{}
+			if err := json.NewDecoder(tr).Decode(meta); err != nil {
+				return nil, fmt.Errorf("cannot import snapshot: cannot decode %s: %v", exportMetadataName, err)
+			}
+			if meta.FormatVersion != exportFormatVersion {
+				return nil, fmt.Errorf("cannot import snapshot: unsupported format version %d", meta.FormatVersion)
+			}
+			continue
+		}
+
+		if hdr.Typeflag != tar.TypeReg || filepath.Base(hdr.Name) != hdr.Name || !strings.HasSuffix(hdr.Name, ".zip") {
+			return nil, fmt.Errorf("cannot import snapshot: unexpected member %q", hdr.Name)
+		}
+		if !strutil.ListContains(meta.Files, hdr.Name) || strutil.ListContains(received, hdr.Name) {
+			return nil, fmt.Errorf("cannot import snapshot: unexpected member %q", hdr.Name)
+		}
+		received = append(received, hdr.Name)
+
+		tmpFn := filepath.Join(dirs.SnapshotsDir, importTmpPrefix+hdr.Name)
+		tmpFiles = append(tmpFiles, tmpFn)
+		if err := writeImportMember(ctx, tmpFn, tr); err != nil {
+			return nil, fmt.Errorf("cannot import snapshot %q: %v", hdr.Name, err)
+		}
+
+		fn, snapName, err := importSnapshot(ctx, id, tmpFn)
+		if err != nil {
+			return nil, fmt.Errorf("cannot import snapshot %q: %v", hdr.Name, err)
+		}
+		imported = append(imported, fn)
+		snapNames = append(snapNames, snapName)
+	}
+
+	if meta == nil {
+		return nil, errors.New("cannot import snapshot: empty import")
+	}
+	if len(received) != len(meta.Files) {
+		return nil, fmt.Errorf("cannot import snapshot: expected %d snapshots, got %d", len(meta.Files), len(received))
+	}
+
+	sort.Strings(snapNames)
+	return snapNames, nil
+}
+
+func writeImportMember(ctx context.Context, fn string, r io.Reader) error {
+	f, err := os.OpenFile(fn, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.MultiWriter(osutil.ContextWriter(ctx), f), r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// importSnapshot checks the given snapshot and writes it to its final
+// place in the snapshots directory with the given set id.
+func importSnapshot(ctx context.Context, id uint64, tmpFn string) (fn, snapName string, e error) {
+	reader, err := Open(tmpFn)
+	if err != nil {
+		return "", "", err
+	}
+	defer reader.Close()
+
+	if err := naming.ValidateInstance(reader.Snap); err != nil {
+		return "", "", err
+	}
+	if err := snap.ValidateVersion(reader.Version); err != nil {
+		return "", "", err
+	}
+	if err := reader.Check(ctx, nil); err != nil {
+		return "", "", err
+	}
+
+	snapshot := reader.Snapshot
+	snapshot.SetID = id
+	fn = Filename(&snapshot)
+	if osutil.FileExists(fn) {
+		return "", "", fmt.Errorf("snapshot %q already exists", fn)
+	}
+
+	aw, err := osutil.NewAtomicFile(fn, 0600, 0, osutil.NoChown, osutil.NoChown)
+	if err != nil {
+		return "", "", err
+	}
+	// if things worked, we'll commit (and Cancel becomes a NOP)
+	defer aw.Cancel()
+
+	w := zip.NewWriter(aw)
+	defer w.Close() // note this does not close the file descriptor (that's done by hand on the atomic writer, above)
+
+	// only the entries covered by the (checked) hashes are carried over
+	entries := make([]string, 0, len(snapshot.SHA3_384))
+	for entry := range snapshot.SHA3_384 {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	for _, entry := range entries {
+		body, _, err := zipMember(reader.File, entry)
+		if err != nil {
+			return "", "", err
+		}
+		entryWriter, err := w.CreateHeader(&zip.FileHeader{Name: entry})
+		if err != nil {
+			body.Close()
+			return "", "", err
+		}
+		_, err = io.Copy(io.MultiWriter(osutil.ContextWriter(ctx), entryWriter), body)
+		body.Close()
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	metaWriter, err := w.Create(metadataName)
+	if err != nil {
+		return "", "", err
+	}
+	hasher := crypto.SHA3_384.New()
+	enc := json.NewEncoder(io.MultiWriter(metaWriter, hasher))
+	if err := enc.Encode(&snapshot); err != nil {
+		return "", "", err
+	}
+	hashWriter, err := w.Create(metaHashName)
+	if err != nil {
+		return "", "", err
+	}
+	fmt.Fprintf(hashWriter, "%x\n", hasher.Sum(nil))
+	if err := w.Close(); err != nil {
+		return "", "", err
+	}
+
+	if err := aw.Commit(); err != nil {
+		return "", "", err
+	}
+
+	return fn, snapshot.Snap, nil
+}
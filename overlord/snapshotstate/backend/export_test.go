@@ -20,9 +20,12 @@
 package backend
 
 import (
+	"bytes"
+	"io/ioutil"
 	"os"
 	"os/user"
 
+	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/osutil/sys"
 )
 
@@ -95,3 +98,38 @@ func SetUserWrapper(newUserWrapper string) (restore func()) {
 		userWrapper = oldUserWrapper
 	}
 }
+
+func EncryptionRoundtrip(encKey *EncryptionKey, decKey *DecryptionKey, entry, decEntry string, data []byte, mangle func([]byte) []byte) ([]byte, *client.SnapshotEncryption, error) {
+	encrypter, meta, err := newSnapshotEncrypter(encKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	var buf bytes.Buffer
+	w, err := encrypter.Writer(entry, &buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, nil, err
+	}
+	encrypted := buf.Bytes()
+	if mangle != nil {
+		encrypted = mangle(encrypted)
+	}
+
+	decrypter, err := newSnapshotDecrypter(decKey, meta)
+	if err != nil {
+		return nil, meta, err
+	}
+	r, err := decrypter.Reader(decEntry, bytes.NewReader(encrypted))
+	if err != nil {
+		return nil, meta, err
+	}
+	decrypted, err := ioutil.ReadAll(r)
+	return decrypted, meta, err
+}
+
+const EncryptionChunkSize = encryptionChunkSize
@@ -46,6 +46,24 @@ import (
 type Reader struct {
 	*os.File
 	client.Snapshot
+
+	decrypter *snapshotCipher
+}
+
+// SetDecryptionKey sets the key to decrypt the archives of an
+// encrypted snapshot with, when checking or restoring it. It fails if
+// the snapshot was encrypted for a different key, and does nothing if
+// the snapshot is not encrypted.
+func (r *Reader) SetDecryptionKey(key *DecryptionKey) error {
+	if r.Encryption == nil {
+		return nil
+	}
+	decrypter, err := newSnapshotDecrypter(key, r.Encryption)
+	if err != nil {
+		return fmt.Errorf("cannot decrypt snapshot of %q in set #%d: %v", r.Snap, r.SetID, err)
+	}
+	r.decrypter = decrypter
+	return nil
 }
 
 // Open a Snapshot given its full filename.
@@ -130,10 +148,23 @@ func (r *Reader) checkOne(ctx context.Context, entry string, hasher hash.Hash) e
 	defer body.Close()
 
 	expectedHash := r.SHA3_384[entry]
-	readSize, err := io.Copy(io.MultiWriter(osutil.ContextWriter(ctx), hasher), body)
-	if err != nil {
+	var sz sizer
+	var src io.Reader = io.TeeReader(body, io.MultiWriter(hasher, &sz))
+	if r.decrypter != nil {
+		// also check the archive decrypts (and so that it's
+		// authentic), besides its hash
+		src, err = r.decrypter.Reader(entry, src)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := io.Copy(osutil.ContextWriter(ctx), src); err != nil {
+		if r.decrypter != nil {
+			return fmt.Errorf("snapshot entry %q: %v", entry, err)
+		}
 		return err
 	}
+	readSize := sz.size
 
 	if readSize != reportedSize {
 		return fmt.Errorf("snapshot entry %q size (%d) different from actual (%d)", entry, reportedSize, readSize)
@@ -186,6 +217,10 @@ func (r *Reader) Restore(ctx context.Context, current snap.Revision, usernames [
 		}
 	}()
 
+	if r.Encryption != nil && r.decrypter == nil {
+		return rs, fmt.Errorf("cannot restore snapshot %q: snapshot is encrypted and no decryption key was given", r.Name())
+	}
+
 	sort.Strings(usernames)
 	isRoot := sys.Geteuid() == 0
 	si := snap.MinimalPlaceInfo(r.Snap, r.Revision)
@@ -297,7 +332,13 @@ func (r *Reader) Restore(ctx context.Context, current snap.Revision, usernames [
 
 		expectedHash := r.SHA3_384[entry]
 
-		tr := io.TeeReader(body, io.MultiWriter(hasher, &sz))
+		var tr io.Reader = io.TeeReader(body, io.MultiWriter(hasher, &sz))
+		if r.decrypter != nil {
+			tr, err = r.decrypter.Reader(entry, tr)
+			if err != nil {
+				return rs, err
+			}
+		}
 
 		// resist the temptation of using archive/tar unless it's proven
 		// that calling out to tar has issues -- there are a lot of
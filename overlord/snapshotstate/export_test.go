@@ -22,6 +22,7 @@ package snapshotstate
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"time"
 
 	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
@@ -41,14 +42,23 @@ var (
 	UndoRestore                = undoRestore
 	CleanupRestore             = cleanupRestore
 	DoCheck                    = doCheck
+	CleanupCheck               = cleanupCheck
+	CacheDecryptionKey         = cacheDecryptionKey
 	DoForget                   = doForget
 	SaveExpiration             = saveExpiration
+	SaveScheduledTime          = saveScheduledTime
 	ExpiredSnapshotSets        = expiredSnapshotSets
+	PrunableSnapshotSets       = prunableSnapshotSets
 	RemoveSnapshotState        = removeSnapshotState
 
 	DefaultAutomaticSnapshotExpiration = defaultAutomaticSnapshotExpiration
 )
 
+func CachedDecryptionKey(task *state.Task) *backend.DecryptionKey {
+	key, _ := task.State().Cached(decryptionKeyKey{task.ID()}).(*backend.DecryptionKey)
+	return key
+}
+
 func (summaries snapshotSnapSummaries) AsMaps() []map[string]string {
 	out := make([]map[string]string, len(summaries))
 	for i, summary := range summaries {
@@ -162,3 +172,19 @@ func MockConfigSetSnapConfig(f func(*state.State, string, *json.RawMessage) erro
 func (mgr *SnapshotManager) SetLastForgetExpiredSnapshotTime(t time.Time) {
 	mgr.lastForgetExpiredSnapshotTime = t
 }
+
+func MockBackendNewSnapshotExport(f func(context.Context, uint64) (*backend.SnapshotExport, error)) (restore func()) {
+	old := backendNewSnapshotExport
+	backendNewSnapshotExport = f
+	return func() {
+		backendNewSnapshotExport = old
+	}
+}
+
+func MockBackendImport(f func(context.Context, uint64, io.Reader) ([]string, error)) (restore func()) {
+	old := backendImport
+	backendImport = f
+	return func() {
+		backendImport = old
+	}
+}
@@ -35,6 +35,8 @@ import (
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/timeutil"
 )
 
 var (
@@ -50,6 +52,8 @@ var (
 	backendCleanup       = (*backend.RestoreState).Cleanup
 
 	autoExpirationInterval = time.Hour * 24 // interval between forgetExpiredSnapshots runs as part of Ensure()
+
+	maxScheduledSnapshotDelay = time.Hour * 24 * 31 // upper bound on the time between scheduled snapshots
 )
 
 // SnapshotManager takes snapshots of active snaps
@@ -57,6 +61,9 @@ type SnapshotManager struct {
 	state *state.State
 
 	lastForgetExpiredSnapshotTime time.Time
+
+	nextScheduledSnapshot time.Time
+	lastSnapshotSchedule  string
 }
 
 // Manager returns a new SnapshotManager
@@ -66,6 +73,7 @@ func Manager(st *state.State, runner *state.TaskRunner) *SnapshotManager {
 	runner.AddHandler("save-snapshot", doSave, doForget)
 	runner.AddHandler("forget-snapshot", doForget, nil)
 	runner.AddHandler("check-snapshot", doCheck, nil)
+	runner.AddCleanup("check-snapshot", cleanupCheck)
 	runner.AddHandler("restore-snapshot", doRestore, undoRestore)
 	runner.AddCleanup("restore-snapshot", cleanupRestore)
 
@@ -79,10 +87,132 @@ func Manager(st *state.State, runner *state.TaskRunner) *SnapshotManager {
 
 // Ensure is part of the overlord.StateManager interface.
 func (mgr *SnapshotManager) Ensure() error {
+	err := mgr.ensureScheduledSnapshot()
+
 	// process expired snapshots once a day.
 	if time.Now().After(mgr.lastForgetExpiredSnapshotTime.Add(autoExpirationInterval)) {
-		return mgr.forgetExpiredSnapshots()
+		if ferr := mgr.forgetExpiredSnapshots(); ferr != nil && err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+// snapshotSchedule returns the parsed snapshots.schedule option, which
+// is empty if scheduled snapshots are disabled.
+func snapshotSchedule(st *state.State) (schedule []*timeutil.Schedule, scheduleStr string, err error) {
+	tr := config.NewTransaction(st)
+	if err := tr.Get("core", "snapshots.schedule", &scheduleStr); err != nil && !config.IsNoOption(err) {
+		return nil, "", err
+	}
+	if scheduleStr == "" {
+		return nil, "", nil
+	}
+	schedule, err = timeutil.ParseSchedule(scheduleStr)
+	if err != nil {
+		logger.Noticef("snapshots.schedule cannot be parsed: %v", err)
+		return nil, scheduleStr, nil
+	}
+	return schedule, scheduleStr, nil
+}
+
+// scheduledSnapshotSnaps returns the active snaps that opted into
+// scheduled snapshots via snapshots.scheduled.snaps.
+func scheduledSnapshotSnaps(st *state.State) ([]string, error) {
+	var snapsStr string
+	tr := config.NewTransaction(st)
+	if err := tr.Get("core", "snapshots.scheduled.snaps", &snapsStr); err != nil && !config.IsNoOption(err) {
+		return nil, err
+	}
+	optedIn := strutil.CommaSeparatedList(snapsStr)
+	if len(optedIn) == 0 {
+		return nil, nil
+	}
+	active, err := allActiveSnapNames(st)
+	if err != nil {
+		return nil, err
+	}
+	var snaps []string
+	for _, name := range active {
+		if strutil.ListContains(optedIn, name) {
+			snaps = append(snaps, name)
+		}
+	}
+	return snaps, nil
+}
+
+func scheduledSnapshotInFlight(st *state.State) bool {
+	for _, chg := range st.Changes() {
+		if chg.Kind() == "scheduled-snapshot" && !chg.Status().Ready() {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureScheduledSnapshot takes a snapshot of the snaps that opted into
+// scheduled snapshots when snapshots.schedule says it's time to.
+func (mgr *SnapshotManager) ensureScheduledSnapshot() error {
+	st := mgr.state
+	st.Lock()
+	defer st.Unlock()
+
+	schedule, scheduleStr, err := snapshotSchedule(st)
+	if err != nil {
+		return err
+	}
+	if scheduleStr != mgr.lastSnapshotSchedule {
+		// the schedule has changed
+		mgr.nextScheduledSnapshot = time.Time{}
+		mgr.lastSnapshotSchedule = scheduleStr
+	}
+	if len(schedule) == 0 {
+		return nil
+	}
+
+	// ensure nothing is in flight already
+	if scheduledSnapshotInFlight(st) {
+		return nil
+	}
+
+	now := time.Now()
+	if mgr.nextScheduledSnapshot.IsZero() {
+		var lastSnapshot time.Time
+		if err := st.Get("last-scheduled-snapshot", &lastSnapshot); err != nil && err != state.ErrNoState {
+			return err
+		}
+		if lastSnapshot.IsZero() {
+			// the first scheduled snapshot happens in the next window
+			lastSnapshot = now
+		}
+		mgr.nextScheduledSnapshot = now.Add(timeutil.Next(schedule, lastSnapshot, maxScheduledSnapshotDelay))
+		logger.Debugf("Next scheduled snapshot at %s.", mgr.nextScheduledSnapshot.Format(time.RFC3339))
+	}
+	if mgr.nextScheduledSnapshot.After(now) {
+		return nil
+	}
+
+	snaps, err := scheduledSnapshotSnaps(st)
+	if err != nil {
+		return err
+	}
+	if len(snaps) > 0 {
+		setID, ts, err := ScheduledSnapshot(st, snaps)
+		if err != nil {
+			if _, ok := err.(*snapstate.ChangeConflictError); ok {
+				// try again on the next Ensure
+				logger.Debugf("Postponing scheduled snapshot: %v", err)
+				return nil
+			}
+			return err
+		}
+		msg := fmt.Sprintf("Save scheduled snapshot set #%d of snaps %s", setID, strutil.Quoted(snaps))
+		chg := st.NewChange("scheduled-snapshot", msg)
+		chg.AddAll(ts)
 	}
+	st.Set("last-scheduled-snapshot", now)
+	mgr.nextScheduledSnapshot = time.Time{}
+
 	return nil
 }
 
@@ -90,10 +220,21 @@ func (mgr *SnapshotManager) forgetExpiredSnapshots() error {
 	mgr.state.Lock()
 	defer mgr.state.Unlock()
 
-	sets, err := expiredSnapshotSets(mgr.state, time.Now())
+	now := time.Now()
+	sets, err := expiredSnapshotSets(mgr.state, now)
 	if err != nil {
 		return fmt.Errorf("internal error: cannot determine expired snapshots: %v", err)
 	}
+	prunable, err := prunableSnapshotSets(mgr.state, now)
+	if err != nil {
+		return fmt.Errorf("internal error: cannot determine scheduled snapshots to prune: %v", err)
+	}
+	for setID := range prunable {
+		if sets == nil {
+			sets = make(map[uint64]bool)
+		}
+		sets[setID] = true
+	}
 
 	if len(sets) == 0 {
 		return nil
@@ -154,6 +295,56 @@ type snapshotSetup struct {
 	Filename string        `json:"filename,omitempty"`
 	Current  snap.Revision `json:"current"`
 	Auto     bool          `json:"auto,omitempty"`
+	// Scheduled is set for snapshots taken on snapshots.schedule
+	Scheduled bool `json:"scheduled,omitempty"`
+
+	// EncryptionKey is the public key to encrypt a new snapshot for
+	EncryptionKey string `json:"encryption-key,omitempty"`
+	// Decrypt is set if the snapshot is to be decrypted with the
+	// private key given when creating the task; the key itself is
+	// only kept in memory, see cacheDecryptionKey
+	Decrypt bool `json:"decrypt,omitempty"`
+}
+
+type decryptionKeyKey struct {
+	taskID string
+}
+
+// cacheDecryptionKey keeps the decryption key for the task in memory,
+// so that the private key never makes it into the state on disk. The
+// state must be locked by the caller.
+func cacheDecryptionKey(task *state.Task, key *backend.DecryptionKey) {
+	task.State().Cache(decryptionKeyKey{task.ID()}, key)
+}
+
+// forgetDecryptionKey drops the cached decryption key of the task, if
+// any. The state must be locked by the caller.
+func forgetDecryptionKey(task *state.Task) {
+	task.State().Cache(decryptionKeyKey{task.ID()}, nil)
+}
+
+// cachedDecryptionKey returns the cached decryption key of the task,
+// or nil if it does not decrypt the snapshot. The state must be locked
+// by the caller.
+func cachedDecryptionKey(task *state.Task, snapshot *snapshotSetup) (*backend.DecryptionKey, error) {
+	if !snapshot.Decrypt {
+		return nil, nil
+	}
+	key, ok := task.State().Cached(decryptionKeyKey{task.ID()}).(*backend.DecryptionKey)
+	if !ok {
+		// e.g. snapd was restarted since the task was created
+		return nil, fmt.Errorf("cannot decrypt snapshot of %q in set #%d: decryption key is no longer available", snapshot.Snap, snapshot.SetID)
+	}
+	return key, nil
+}
+
+// setDecryptionKey sets the decryption key, if any, on the opened
+// snapshot.
+func setDecryptionKey(reader *backend.Reader, key *backend.DecryptionKey) error {
+	if key == nil {
+		return nil
+	}
+	return reader.SetDecryptionKey(key)
 }
 
 func filename(setID uint64, si *snap.Info) string {
@@ -204,6 +395,11 @@ func prepareSave(task *state.Task) (snapshot *snapshotSetup, cur *snap.Info, cfg
 			return nil, nil, nil, err
 		}
 	}
+	if snapshot.Scheduled {
+		if err := saveScheduledTime(st, snapshot.SetID, time.Now()); err != nil {
+			return nil, nil, nil, err
+		}
+	}
 
 	return snapshot, cur, cfg, nil
 }
@@ -213,7 +409,7 @@ func doSave(task *state.Task, tomb *tomb.Tomb) error {
 	if err != nil {
 		return err
 	}
-	_, err = backendSave(tomb.Context(nil), snapshot.SetID, cur, cfg, snapshot.Users, &backend.Flags{Auto: snapshot.Auto})
+	_, err = backendSave(tomb.Context(nil), snapshot.SetID, cur, cfg, snapshot.Users, &backend.Flags{Auto: snapshot.Auto || snapshot.Scheduled, EncryptionKey: snapshot.EncryptionKey})
 	if err != nil {
 		st := task.State()
 		st.Lock()
@@ -234,6 +430,15 @@ func prepareRestore(task *state.Task) (snapshot *snapshotSetup, oldCfg map[strin
 	if err := task.Get("snapshot-setup", &snapshot); err != nil {
 		return nil, nil, nil, taskGetErrMsg(task, err, "snapshot")
 	}
+	defer func() {
+		if err != nil {
+			forgetDecryptionKey(task)
+		}
+	}()
+	key, err := cachedDecryptionKey(task, snapshot)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
 	rawCfg, err := configGetSnapConfig(st, snapshot.Snap)
 	if err != nil {
@@ -250,6 +455,10 @@ func prepareRestore(task *state.Task) (snapshot *snapshotSetup, oldCfg map[strin
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("cannot open snapshot: %v", err)
 	}
+	if err := setDecryptionKey(reader, key); err != nil {
+		reader.Close()
+		return nil, nil, nil, err
+	}
 	// note given the Open succeeded, caller needs to close it when done
 
 	return snapshot, oldCfg, reader, nil
@@ -263,6 +472,11 @@ func doRestore(task *state.Task, tomb *tomb.Tomb) error {
 	defer reader.Close()
 
 	st := task.State()
+	defer func() {
+		st.Lock()
+		defer st.Unlock()
+		forgetDecryptionKey(task)
+	}()
 	logf := func(format string, args ...interface{}) {
 		st.Lock()
 		defer st.Unlock()
@@ -328,6 +542,8 @@ func cleanupRestore(task *state.Task, _ *tomb.Tomb) error {
 
 	st := task.State()
 	st.Lock()
+	// the key is normally gone by now, unless the task never ran
+	forgetDecryptionKey(task)
 	status := task.Status()
 	err := task.Get("restore-state", &restoreState)
 	st.Unlock()
@@ -356,10 +572,21 @@ func doCheck(task *state.Task, tomb *tomb.Tomb) error {
 	st := task.State()
 	st.Lock()
 	err := task.Get("snapshot-setup", &snapshot)
-	st.Unlock()
 	if err != nil {
+		st.Unlock()
 		return taskGetErrMsg(task, err, "snapshot")
 	}
+	key, err := cachedDecryptionKey(task, &snapshot)
+	st.Unlock()
+
+	defer func() {
+		st.Lock()
+		defer st.Unlock()
+		forgetDecryptionKey(task)
+	}()
+	if err != nil {
+		return err
+	}
 
 	reader, err := backendOpen(snapshot.Filename)
 	if err != nil {
@@ -367,9 +594,24 @@ func doCheck(task *state.Task, tomb *tomb.Tomb) error {
 	}
 	defer reader.Close()
 
+	if err := setDecryptionKey(reader, key); err != nil {
+		return err
+	}
+
 	return backendCheck(reader, tomb.Context(nil), snapshot.Users)
 }
 
+func cleanupCheck(task *state.Task, _ *tomb.Tomb) error {
+	st := task.State()
+	st.Lock()
+	defer st.Unlock()
+
+	// the key is normally gone by now, unless the task never ran
+	forgetDecryptionKey(task)
+
+	return nil
+}
+
 func doForget(task *state.Task, _ *tomb.Tomb) error {
 	// note this is also undoSave
 	st := task.State()
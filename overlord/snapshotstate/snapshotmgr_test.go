@@ -33,8 +33,10 @@ import (
 
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/snapshotstate"
 	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap"
 )
@@ -230,6 +232,195 @@ func (s *snapshotSuite) TestEnsureForgetSnapshotsConflictWithRestoreSnapshot(c *
 	s.testEnsureForgetSnapshotsConflict(c, "restore-snapshot")
 }
 
+func (snapshotSuite) TestEnsurePrunesScheduledSnapshots(c *check.C) {
+	var removed []string
+	defer snapshotstate.MockOsRemove(func(fileName string) error {
+		removed = append(removed, fileName)
+		return nil
+	})()
+	shotfile, err := os.Create(filepath.Join(c.MkDir(), "foo.zip"))
+	c.Assert(err, check.IsNil)
+	defer shotfile.Close()
+	defer snapshotstate.MockBackendIter(func(_ context.Context, f func(*backend.Reader) error) error {
+		for _, setID := range []uint64{1, 2, 3} {
+			c.Assert(f(&backend.Reader{
+				Snapshot: client.Snapshot{SetID: setID, Snap: "a-snap"},
+				File:     shotfile,
+			}), check.IsNil)
+		}
+		return nil
+	})()
+
+	st := state.New(nil)
+	runner := state.NewTaskRunner(st)
+	mgr := snapshotstate.Manager(st, runner)
+
+	st.Lock()
+	defer st.Unlock()
+
+	now := time.Now()
+	c.Assert(snapshotstate.SaveScheduledTime(st, 1, now.Add(-72*time.Hour)), check.IsNil)
+	c.Assert(snapshotstate.SaveScheduledTime(st, 2, now.Add(-time.Hour)), check.IsNil)
+	c.Assert(snapshotstate.SaveExpiration(st, 3, now.Add(time.Hour)), check.IsNil)
+	tr := config.NewTransaction(st)
+	tr.Set("core", "snapshots.scheduled.keep-daily", 1)
+	tr.Set("core", "snapshots.scheduled.keep-weekly", 0)
+	tr.Commit()
+
+	st.Unlock()
+	c.Assert(mgr.Ensure(), check.IsNil)
+	st.Lock()
+
+	var snapshots map[uint64]interface{}
+	c.Assert(st.Get("snapshots", &snapshots), check.IsNil)
+	c.Check(snapshots, check.HasLen, 2)
+	c.Check(snapshots[1], check.IsNil)
+	c.Check(removed, check.HasLen, 1)
+}
+
+func (snapshotSuite) mockScheduledSnapshots(c *check.C, st *state.State, snaps string) {
+	tr := config.NewTransaction(st)
+	tr.Set("core", "snapshots.schedule", "0:00-24:00")
+	tr.Set("core", "snapshots.scheduled.snaps", snaps)
+	tr.Commit()
+
+	// pretend the last scheduled snapshot was a while ago
+	st.Set("last-scheduled-snapshot", time.Now().Add(-48*time.Hour))
+}
+
+func (s snapshotSuite) TestEnsureScheduledSnapshot(c *check.C) {
+	defer snapshotstate.MockSnapstateAll(func(*state.State) (map[string]*snapstate.SnapState, error) {
+		return map[string]*snapstate.SnapState{
+			"a-snap": {Active: true},
+			"b-snap": {Active: true},
+			"c-snap": {Active: true},
+			"d-snap": {},
+		}, nil
+	})()
+
+	st := state.New(nil)
+	runner := state.NewTaskRunner(st)
+	mgr := snapshotstate.Manager(st, runner)
+
+	st.Lock()
+	defer st.Unlock()
+	s.mockScheduledSnapshots(c, st, "c-snap,a-snap,d-snap,gone-snap")
+	before := time.Now()
+
+	st.Unlock()
+	c.Assert(mgr.Ensure(), check.IsNil)
+	st.Lock()
+
+	changes := st.Changes()
+	c.Assert(changes, check.HasLen, 1)
+	chg := changes[0]
+	c.Check(chg.Kind(), check.Equals, "scheduled-snapshot")
+	c.Check(chg.Summary(), check.Equals, `Save scheduled snapshot set #1 of snaps "a-snap", "c-snap"`)
+	tasks := chg.Tasks()
+	c.Assert(tasks, check.HasLen, 2)
+	for _, t := range tasks {
+		var snapshot map[string]interface{}
+		c.Assert(t.Get("snapshot-setup", &snapshot), check.IsNil)
+		c.Check(snapshot["scheduled"], check.Equals, true)
+	}
+	var last time.Time
+	c.Assert(st.Get("last-scheduled-snapshot", &last), check.IsNil)
+	c.Check(last.Before(before), check.Equals, false)
+
+	// nothing new while the scheduled snapshot is in flight
+	st.Unlock()
+	c.Assert(mgr.Ensure(), check.IsNil)
+	st.Lock()
+	c.Check(st.Changes(), check.HasLen, 1)
+
+	// and the next one is only taken in the next window
+	for _, t := range tasks {
+		t.SetStatus(state.DoneStatus)
+	}
+	st.Unlock()
+	c.Assert(mgr.Ensure(), check.IsNil)
+	st.Lock()
+	c.Check(st.Changes(), check.HasLen, 1)
+}
+
+func (s snapshotSuite) TestEnsureScheduledSnapshotDisabled(c *check.C) {
+	st := state.New(nil)
+	runner := state.NewTaskRunner(st)
+	mgr := snapshotstate.Manager(st, runner)
+
+	st.Lock()
+	defer st.Unlock()
+	st.Set("last-scheduled-snapshot", time.Now().Add(-48*time.Hour))
+	tr := config.NewTransaction(st)
+	tr.Set("core", "snapshots.scheduled.snaps", "a-snap")
+	tr.Commit()
+
+	st.Unlock()
+	c.Assert(mgr.Ensure(), check.IsNil)
+	st.Lock()
+	c.Check(st.Changes(), check.HasLen, 0)
+}
+
+func (s snapshotSuite) TestEnsureScheduledSnapshotNoSnaps(c *check.C) {
+	defer snapshotstate.MockSnapstateAll(func(*state.State) (map[string]*snapstate.SnapState, error) {
+		return map[string]*snapstate.SnapState{
+			"a-snap": {Active: true},
+		}, nil
+	})()
+
+	st := state.New(nil)
+	runner := state.NewTaskRunner(st)
+	mgr := snapshotstate.Manager(st, runner)
+
+	st.Lock()
+	defer st.Unlock()
+	s.mockScheduledSnapshots(c, st, "")
+	before := time.Now()
+
+	st.Unlock()
+	c.Assert(mgr.Ensure(), check.IsNil)
+	st.Lock()
+	c.Check(st.Changes(), check.HasLen, 0)
+	var last time.Time
+	c.Assert(st.Get("last-scheduled-snapshot", &last), check.IsNil)
+	c.Check(last.Before(before), check.Equals, false)
+}
+
+func (s snapshotSuite) TestEnsureScheduledSnapshotConflict(c *check.C) {
+	defer snapshotstate.MockSnapstateAll(func(*state.State) (map[string]*snapstate.SnapState, error) {
+		return map[string]*snapstate.SnapState{
+			"a-snap": {Active: true},
+		}, nil
+	})()
+	conflict := true
+	defer snapshotstate.MockSnapstateCheckChangeConflictMany(func(*state.State, []string, string) error {
+		if conflict {
+			return &snapstate.ChangeConflictError{Snap: "a-snap", ChangeKind: "refresh-snap"}
+		}
+		return nil
+	})()
+
+	st := state.New(nil)
+	runner := state.NewTaskRunner(st)
+	mgr := snapshotstate.Manager(st, runner)
+
+	st.Lock()
+	defer st.Unlock()
+	s.mockScheduledSnapshots(c, st, "a-snap")
+
+	st.Unlock()
+	c.Assert(mgr.Ensure(), check.IsNil)
+	st.Lock()
+	c.Check(st.Changes(), check.HasLen, 0)
+
+	// retried on the next Ensure
+	conflict = false
+	st.Unlock()
+	c.Assert(mgr.Ensure(), check.IsNil)
+	st.Lock()
+	c.Check(st.Changes(), check.HasLen, 1)
+}
+
 func (snapshotSuite) TestFilename(c *check.C) {
 	si := &snap.Info{
 		SideInfo: snap.SideInfo{
@@ -463,6 +654,42 @@ func (snapshotSuite) TestDoSaveFailureRemovesStateEntry(c *check.C) {
 	c.Check(expirations, check.HasLen, 0)
 }
 
+func (snapshotSuite) TestDoSaveScheduled(c *check.C) {
+	st := state.New(nil)
+
+	defer snapshotstate.MockSnapstateCurrentInfo(func(_ *state.State, snapname string) (*snap.Info, error) {
+		return &snap.Info{SideInfo: snap.SideInfo{RealName: "a-snap", Revision: snap.R(-1)}}, nil
+	})()
+	defer snapshotstate.MockConfigGetSnapConfig(func(_ *state.State, snapname string) (*json.RawMessage, error) {
+		return nil, nil
+	})()
+	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, flags *backend.Flags) (*client.Snapshot, error) {
+		c.Check(flags.Auto, check.Equals, true)
+		return nil, nil
+	})()
+
+	st.Lock()
+	task := st.NewTask("save-snapshot", "...")
+	task.Set("snapshot-setup", map[string]interface{}{
+		"set-id":    42,
+		"snap":      "a-snap",
+		"scheduled": true,
+	})
+	before := time.Now()
+	st.Unlock()
+	err := snapshotstate.DoSave(task, &tomb.Tomb{})
+	c.Assert(err, check.IsNil)
+
+	st.Lock()
+	defer st.Unlock()
+	var snapshots map[uint64]struct {
+		ScheduledTime *time.Time `json:"scheduled-time"`
+	}
+	c.Assert(st.Get("snapshots", &snapshots), check.IsNil)
+	c.Assert(snapshots[42].ScheduledTime, check.NotNil)
+	c.Check(snapshots[42].ScheduledTime.Before(before), check.Equals, false)
+}
+
 type readerSuite struct {
 	task     *state.Task
 	calls    []string
@@ -562,6 +789,66 @@ func (rs *readerSuite) TestDoRestore(c *check.C) {
 	c.Check(v, check.DeepEquals, map[string]interface{}{"config": map[string]interface{}{"old": "conf"}})
 }
 
+// setDecryptionKey marks the task as decrypting, caching the given key
+// for it unless it is empty.
+func (rs *readerSuite) setDecryptionKey(c *check.C, priv string) {
+	st := rs.task.State()
+	st.Lock()
+	defer st.Unlock()
+	var snapshot map[string]interface{}
+	c.Assert(rs.task.Get("snapshot-setup", &snapshot), check.IsNil)
+	snapshot["decrypt"] = true
+	rs.task.Set("snapshot-setup", snapshot)
+	if priv != "" {
+		key, err := backend.ParseDecryptionKey(priv)
+		c.Assert(err, check.IsNil)
+		snapshotstate.CacheDecryptionKey(rs.task, key)
+	}
+}
+
+func (rs *readerSuite) checkDecryptionKeyForgotten(c *check.C) {
+	st := rs.task.State()
+	st.Lock()
+	defer st.Unlock()
+	c.Check(snapshotstate.CachedDecryptionKey(rs.task), check.IsNil)
+}
+
+func (rs *readerSuite) TestDoRestoreForgetsDecryptionKey(c *check.C) {
+	_, priv, _ := testKeyPair(c)
+	rs.setDecryptionKey(c, priv)
+
+	err := snapshotstate.DoRestore(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.IsNil)
+	c.Check(rs.calls, check.DeepEquals, []string{"get config", "open", "restore", "set config"})
+	rs.checkDecryptionKeyForgotten(c)
+}
+
+func (rs *readerSuite) TestDoRestoreFailsDecryptionKeyGone(c *check.C) {
+	// as after a restart, the key is not in the state on disk
+	rs.setDecryptionKey(c, "")
+
+	err := snapshotstate.DoRestore(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.ErrorMatches, `cannot decrypt snapshot of "a-snap" in set #0: decryption key is no longer available`)
+	c.Check(rs.calls, check.HasLen, 0)
+}
+
+func (rs *readerSuite) TestDoRestoreFailsWrongDecryptionKey(c *check.C) {
+	_, _, encryption := testKeyPair(c)
+	_, priv, _ := testKeyPair(c)
+	rs.setDecryptionKey(c, priv)
+	defer snapshotstate.MockBackendOpen(func(string) (*backend.Reader, error) {
+		rs.calls = append(rs.calls, "open")
+		return &backend.Reader{
+			Snapshot: client.Snapshot{SetID: 42, Snap: "a-snap", Encryption: encryption},
+		}, nil
+	})()
+
+	err := snapshotstate.DoRestore(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.ErrorMatches, `cannot decrypt snapshot of "a-snap" in set #42: decryption key .* does not match the key the snapshot was encrypted for .*`)
+	c.Check(rs.calls, check.DeepEquals, []string{"get config", "open"})
+	rs.checkDecryptionKeyForgotten(c)
+}
+
 func (rs *readerSuite) TestDoRestoreFailsNoTaskSnapshot(c *check.C) {
 	rs.task.State().Lock()
 	rs.task.Clear("snapshot-setup")
@@ -674,6 +961,17 @@ func (rs *readerSuite) TestCleanupRestore(c *check.C) {
 	c.Check(rs.calls, check.DeepEquals, []string{"cleanup"})
 }
 
+func (rs *readerSuite) TestCleanupRestoreForgetsDecryptionKey(c *check.C) {
+	_, priv, _ := testKeyPair(c)
+	rs.setDecryptionKey(c, priv)
+
+	// e.g. the change was aborted before the task ran
+	err := snapshotstate.CleanupRestore(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.IsNil)
+	c.Check(rs.calls, check.HasLen, 0)
+	rs.checkDecryptionKeyForgotten(c)
+}
+
 func (rs *readerSuite) TestDoCheck(c *check.C) {
 	defer snapshotstate.MockBackendOpen(func(filename string) (*backend.Reader, error) {
 		rs.calls = append(rs.calls, "open")
@@ -694,6 +992,46 @@ func (rs *readerSuite) TestDoCheck(c *check.C) {
 
 }
 
+func (rs *readerSuite) TestDoCheckForgetsDecryptionKey(c *check.C) {
+	_, priv, _ := testKeyPair(c)
+	rs.setDecryptionKey(c, priv)
+
+	err := snapshotstate.DoCheck(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.IsNil)
+	c.Check(rs.calls, check.DeepEquals, []string{"open", "check"})
+	rs.checkDecryptionKeyForgotten(c)
+
+	// and it's also forgotten on error
+	rs.calls = nil
+	rs.setDecryptionKey(c, priv)
+	defer snapshotstate.MockBackendOpen(func(string) (*backend.Reader, error) {
+		rs.calls = append(rs.calls, "open")
+		return nil, errors.New("bzzt")
+	})()
+	err = snapshotstate.DoCheck(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.ErrorMatches, "cannot open snapshot: bzzt")
+	c.Check(rs.calls, check.DeepEquals, []string{"open"})
+	rs.checkDecryptionKeyForgotten(c)
+}
+
+func (rs *readerSuite) TestDoCheckFailsDecryptionKeyGone(c *check.C) {
+	rs.setDecryptionKey(c, "")
+
+	err := snapshotstate.DoCheck(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.ErrorMatches, `cannot decrypt snapshot of "a-snap" in set #0: decryption key is no longer available`)
+	c.Check(rs.calls, check.HasLen, 0)
+}
+
+func (rs *readerSuite) TestCleanupCheckForgetsDecryptionKey(c *check.C) {
+	_, priv, _ := testKeyPair(c)
+	rs.setDecryptionKey(c, priv)
+
+	err := snapshotstate.CleanupCheck(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.IsNil)
+	c.Check(rs.calls, check.HasLen, 0)
+	rs.checkDecryptionKeyForgotten(c)
+}
+
 func (rs *readerSuite) TestDoRemove(c *check.C) {
 	defer snapshotstate.MockOsRemove(func(filename string) error {
 		c.Check(filename, check.Equals, "/some/file.zip")
@@ -23,6 +23,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"sort"
 	"time"
 
@@ -41,13 +42,23 @@ var (
 	snapstateAll                     = snapstate.All
 	snapstateCheckChangeConflictMany = snapstate.CheckChangeConflictMany
 	backendIter                      = backend.Iter
+	backendNewSnapshotExport         = backend.NewSnapshotExport
+	backendImport                    = backend.Import
 
 	// Default expiration time for automatic snapshots, if not set by the user
 	defaultAutomaticSnapshotExpiration = time.Hour * 24 * 31
+
+	// Default number of days and weeks to keep the newest scheduled
+	// snapshot set of, if not set by the user
+	defaultScheduledSnapshotKeepDaily  = 7
+	defaultScheduledSnapshotKeepWeekly = 4
 )
 
 type snapshotState struct {
 	ExpiryTime time.Time `json:"expiry-time"`
+	// ScheduledTime is set for snapshot sets taken on schedule, which
+	// are pruned according to the retention policy instead of expiring.
+	ScheduledTime *time.Time `json:"scheduled-time,omitempty"`
 }
 
 func newSnapshotSetID(st *state.State) (uint64, error) {
@@ -106,9 +117,42 @@ func AutomaticSnapshotExpiration(st *state.State) (time.Duration, error) {
 	return defaultAutomaticSnapshotExpiration, nil
 }
 
+// snapshotEncryptionKey returns the public key to encrypt new snapshots
+// for: the given one if set, or else the one configured in the system,
+// if any.
+func snapshotEncryptionKey(st *state.State, key string) (string, error) {
+	if key == "" {
+		tr := config.NewTransaction(st)
+		if err := tr.Get("core", "snapshots.encryption-key", &key); err != nil && !config.IsNoOption(err) {
+			return "", err
+		}
+	}
+	if key != "" {
+		if _, err := backend.ParseEncryptionKey(key); err != nil {
+			return "", err
+		}
+	}
+	return key, nil
+}
+
 // saveExpiration saves expiration date of the given snapshot set, in the state.
 // The state needs to be locked by the caller.
 func saveExpiration(st *state.State, setID uint64, expiryTime time.Time) error {
+	return saveSnapshotState(st, setID, &snapshotState{
+		ExpiryTime: expiryTime,
+	})
+}
+
+// saveScheduledTime saves the time the given scheduled snapshot set was
+// taken, in the state.
+// The state needs to be locked by the caller.
+func saveScheduledTime(st *state.State, setID uint64, scheduledTime time.Time) error {
+	return saveSnapshotState(st, setID, &snapshotState{
+		ScheduledTime: &scheduledTime,
+	})
+}
+
+func saveSnapshotState(st *state.State, setID uint64, snapshotSet *snapshotState) error {
 	var snapshots map[uint64]*json.RawMessage
 	err := st.Get("snapshots", &snapshots)
 	if err != nil && err != state.ErrNoState {
@@ -117,9 +161,7 @@ func saveExpiration(st *state.State, setID uint64, expiryTime time.Time) error {
 	if snapshots == nil {
 		snapshots = make(map[uint64]*json.RawMessage)
 	}
-	data, err := json.Marshal(&snapshotState{
-		ExpiryTime: expiryTime,
-	})
+	data, err := json.Marshal(snapshotSet)
 	if err != nil {
 		return err
 	}
@@ -162,6 +204,10 @@ func expiredSnapshotSets(st *state.State, cutoffTime time.Time) (map[uint64]bool
 
 	expired := make(map[uint64]bool)
 	for setID, snapshotSet := range snapshots {
+		if snapshotSet.ScheduledTime != nil {
+			// pruned by prunableSnapshotSets instead
+			continue
+		}
 		if snapshotSet.ExpiryTime.Before(cutoffTime) {
 			expired[setID] = true
 		}
@@ -170,6 +216,128 @@ func expiredSnapshotSets(st *state.State, cutoffTime time.Time) (map[uint64]bool
 	return expired, nil
 }
 
+// scheduledSnapshotRetention is the retention policy of scheduled
+// snapshot sets: the newest set of each of the last KeepDaily days and
+// of each of the last KeepWeekly weeks is kept, unless it is older than
+// MaxAge. If both KeepDaily and KeepWeekly are zero only MaxAge applies.
+type scheduledSnapshotRetention struct {
+	KeepDaily  int
+	KeepWeekly int
+	MaxAge     time.Duration
+}
+
+func scheduledSnapshotRetentionPolicy(st *state.State) (*scheduledSnapshotRetention, error) {
+	tr := config.NewTransaction(st)
+	getInt := func(key string, def int) int {
+		var n int
+		if err := tr.Get("core", key, &n); err != nil {
+			if !config.IsNoOption(err) {
+				logger.Noticef("%s cannot be parsed: %v", key, err)
+			}
+			return def
+		}
+		return n
+	}
+
+	keepDaily := getInt("snapshots.scheduled.keep-daily", defaultScheduledSnapshotKeepDaily)
+	keepWeekly := getInt("snapshots.scheduled.keep-weekly", defaultScheduledSnapshotKeepWeekly)
+	var maxAgeStr string
+	if err := tr.Get("core", "snapshots.scheduled.max-age", &maxAgeStr); err != nil && !config.IsNoOption(err) {
+		return nil, err
+	}
+	var maxAge time.Duration
+	if maxAgeStr != "" {
+		var err error
+		maxAge, err = time.ParseDuration(maxAgeStr)
+		if err != nil {
+			logger.Noticef("snapshots.scheduled.max-age cannot be parsed: %v", err)
+			maxAge = 0
+		}
+	}
+
+	return &scheduledSnapshotRetention{
+		KeepDaily:  keepDaily,
+		KeepWeekly: keepWeekly,
+		MaxAge:     maxAge,
+	}, nil
+}
+
+// prunableSnapshotSets returns the scheduled snapshot sets from the
+// state that the retention policy doesn't keep at the given time.
+// The state needs to be locked by the caller.
+func prunableSnapshotSets(st *state.State, now time.Time) (map[uint64]bool, error) {
+	var snapshots map[uint64]*snapshotState
+	err := st.Get("snapshots", &snapshots)
+	if err != nil {
+		if err != state.ErrNoState {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	type scheduledSet struct {
+		setID uint64
+		time  time.Time
+	}
+	var scheduled []scheduledSet
+	for setID, snapshotSet := range snapshots {
+		if snapshotSet.ScheduledTime != nil {
+			scheduled = append(scheduled, scheduledSet{setID: setID, time: *snapshotSet.ScheduledTime})
+		}
+	}
+	if len(scheduled) == 0 {
+		return nil, nil
+	}
+	// newest first
+	sort.Slice(scheduled, func(i, j int) bool {
+		if scheduled[i].time.Equal(scheduled[j].time) {
+			return scheduled[i].setID > scheduled[j].setID
+		}
+		return scheduled[i].time.After(scheduled[j].time)
+	})
+
+	policy, err := scheduledSnapshotRetentionPolicy(st)
+	if err != nil {
+		return nil, err
+	}
+
+	keep := make(map[uint64]bool)
+	// keepNewestPer keeps the newest set of each of the last n periods
+	keepNewestPer := func(n int, period func(time.Time) string) {
+		var last string
+		for _, set := range scheduled {
+			if n <= 0 {
+				return
+			}
+			p := period(set.time.Local())
+			if p == last {
+				continue
+			}
+			last = p
+			keep[set.setID] = true
+			n--
+		}
+	}
+	keepNewestPer(policy.KeepDaily, func(t time.Time) string {
+		return t.Format("2006-01-02")
+	})
+	keepNewestPer(policy.KeepWeekly, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-%d", year, week)
+	})
+	countBased := policy.KeepDaily > 0 || policy.KeepWeekly > 0
+
+	prunable := make(map[uint64]bool)
+	for _, set := range scheduled {
+		tooOld := policy.MaxAge > 0 && set.time.Add(policy.MaxAge).Before(now)
+		if tooOld || (countBased && !keep[set.setID]) {
+			prunable[set.setID] = true
+		}
+	}
+
+	return prunable, nil
+}
+
 // snapshotSnapSummaries are used internally to get useful data from a
 // snapshot set when deciding whether to check/forget/restore it.
 type snapshotSnapSummaries []*snapshotSnapSummary
@@ -183,10 +351,11 @@ func (summaries snapshotSnapSummaries) snapNames() []string {
 }
 
 type snapshotSnapSummary struct {
-	snap     string
-	snapID   string
-	filename string
-	epoch    snap.Epoch
+	snap       string
+	snapID     string
+	filename   string
+	epoch      snap.Epoch
+	encryption *client.SnapshotEncryption
 }
 
 // snapSummariesInSnapshotSet goes looking for the requested snaps in the
@@ -199,10 +368,11 @@ func snapSummariesInSnapshotSet(setID uint64, requested []string) (summaries sna
 			found = true
 			if len(requested) == 0 || strutil.SortedListContains(requested, r.Snap) {
 				summaries = append(summaries, &snapshotSnapSummary{
-					filename: r.Name(),
-					snap:     r.Snap,
-					snapID:   r.SnapID,
-					epoch:    r.Epoch,
+					filename:   r.Name(),
+					snap:       r.Snap,
+					snapID:     r.SnapID,
+					epoch:      r.Epoch,
+					encryption: r.Encryption,
 				})
 			}
 		}
@@ -256,9 +426,32 @@ func checkSnapshotTaskConflict(st *state.State, setID uint64, conflictingKinds .
 // Note that the state must be locked by the caller.
 var List = backend.List
 
-// Save creates a taskset for taking snapshots of snaps' data.
+// Save creates a taskset for taking snapshots of snaps' data. If
+// encryptionKey is empty the snapshots are encrypted for the key
+// configured in snapshots.encryption-key, if any.
+// Note that the state must be locked by the caller.
+func Save(st *state.State, instanceNames []string, users []string, encryptionKey string) (setID uint64, snapsSaved []string, ts *state.TaskSet, err error) {
+	return save(st, instanceNames, users, encryptionKey, false)
+}
+
+// ScheduledSnapshot creates a taskset for taking a scheduled snapshot
+// of the data of the given snaps, which is then pruned according to
+// the retention policy of scheduled snapshots.
 // Note that the state must be locked by the caller.
-func Save(st *state.State, instanceNames []string, users []string) (setID uint64, snapsSaved []string, ts *state.TaskSet, err error) {
+func ScheduledSnapshot(st *state.State, instanceNames []string) (setID uint64, ts *state.TaskSet, err error) {
+	if len(instanceNames) == 0 {
+		return 0, nil, fmt.Errorf("internal error: no snaps to take a scheduled snapshot of")
+	}
+	setID, _, ts, err = save(st, instanceNames, nil, "", true)
+	return setID, ts, err
+}
+
+func save(st *state.State, instanceNames []string, users []string, encryptionKey string, scheduled bool) (setID uint64, snapsSaved []string, ts *state.TaskSet, err error) {
+	encryptionKey, err = snapshotEncryptionKey(st, encryptionKey)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
 	if len(instanceNames) == 0 {
 		instanceNames, err = allActiveSnapNames(st)
 		if err != nil {
@@ -280,11 +473,16 @@ func Save(st *state.State, instanceNames []string, users []string) (setID uint64
 
 	for _, name := range instanceNames {
 		desc := fmt.Sprintf("Save data of snap %q in snapshot set #%d", name, setID)
+		if scheduled {
+			desc = fmt.Sprintf("Save data of snap %q in scheduled snapshot set #%d", name, setID)
+		}
 		task := st.NewTask("save-snapshot", desc)
 		snapshot := snapshotSetup{
-			SetID: setID,
-			Snap:  name,
-			Users: users,
+			SetID:         setID,
+			Snap:          name,
+			Users:         users,
+			Scheduled:     scheduled,
+			EncryptionKey: encryptionKey,
 		}
 		task.Set("snapshot-setup", &snapshot)
 		// Here, note that a snapshot set behaves as a unit: it either
@@ -312,6 +510,10 @@ func AutomaticSnapshot(st *state.State, snapName string) (ts *state.TaskSet, err
 	if expiration == 0 {
 		return nil, snapstate.ErrNothingToDo
 	}
+	encryptionKey, err := snapshotEncryptionKey(st, "")
+	if err != nil {
+		return nil, err
+	}
 	setID, err := newSnapshotSetID(st)
 	if err != nil {
 		return nil, err
@@ -321,9 +523,10 @@ func AutomaticSnapshot(st *state.State, snapName string) (ts *state.TaskSet, err
 	desc := fmt.Sprintf("Save data of snap %q in automatic snapshot set #%d", snapName, setID)
 	task := st.NewTask("save-snapshot", desc)
 	snapshot := snapshotSetup{
-		SetID: setID,
-		Snap:  snapName,
-		Auto:  true,
+		SetID:         setID,
+		Snap:          snapName,
+		Auto:          true,
+		EncryptionKey: encryptionKey,
 	}
 	task.Set("snapshot-setup", &snapshot)
 	ts.AddTask(task)
@@ -331,9 +534,45 @@ func AutomaticSnapshot(st *state.State, snapName string) (ts *state.TaskSet, err
 	return ts, nil
 }
 
-// Restore creates a taskset for restoring a snapshot's data.
+// checkDecryptionKey checks that the given decryption key, if any, is
+// the one needed to decrypt the snapshot with the given summary.
+func checkDecryptionKey(summary *snapshotSnapSummary, key *backend.DecryptionKey) error {
+	if summary.encryption == nil || key == nil {
+		return nil
+	}
+	if summary.encryption.KeyID != key.ID() {
+		return fmt.Errorf("decryption key does not match the key the snapshot for %q was encrypted for", summary.snap)
+	}
+	return nil
+}
+
+func parseDecryptionKey(decryptionKey string) (*backend.DecryptionKey, error) {
+	if decryptionKey == "" {
+		return nil, nil
+	}
+	return backend.ParseDecryptionKey(decryptionKey)
+}
+
+// cacheDecryptionKeys keeps the decryption key, if any, in memory for
+// all the tasks of the taskset.
+func cacheDecryptionKeys(ts *state.TaskSet, key *backend.DecryptionKey) {
+	if key == nil {
+		return
+	}
+	for _, task := range ts.Tasks() {
+		cacheDecryptionKey(task, key)
+	}
+}
+
+// Restore creates a taskset for restoring a snapshot's data. The
+// decryptionKey is needed to restore encrypted snapshots.
 // Note that the state must be locked by the caller.
-func Restore(st *state.State, setID uint64, snapNames []string, users []string) (snapsFound []string, ts *state.TaskSet, err error) {
+func Restore(st *state.State, setID uint64, snapNames []string, users []string, decryptionKey string) (snapsFound []string, ts *state.TaskSet, err error) {
+	key, err := parseDecryptionKey(decryptionKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	summaries, err := snapSummariesInSnapshotSet(setID, snapNames)
 	if err != nil {
 		return nil, nil, err
@@ -357,6 +596,13 @@ func Restore(st *state.State, setID uint64, snapNames []string, users []string)
 	ts = state.NewTaskSet()
 
 	for _, summary := range summaries {
+		if summary.encryption != nil && key == nil {
+			return nil, nil, fmt.Errorf("cannot restore snapshot for %q: snapshot is encrypted and no decryption key was given", summary.snap)
+		}
+		if err := checkDecryptionKey(summary, key); err != nil {
+			return nil, nil, fmt.Errorf("cannot restore snapshot: %v", err)
+		}
+
 		var current snap.Revision
 		if snapst, ok := all[summary.snap]; ok {
 			info, err := snapst.CurrentInfo()
@@ -383,18 +629,27 @@ func Restore(st *state.State, setID uint64, snapNames []string, users []string)
 			Users:    users,
 			Filename: summary.filename,
 			Current:  current,
+			Decrypt:  key != nil,
 		}
 		task.Set("snapshot-setup", &snapshot)
 		// see the note about snapshots not using lanes, above.
 		ts.AddTask(task)
 	}
+	cacheDecryptionKeys(ts, key)
 
 	return snapsFound, ts, nil
 }
 
-// Check creates a taskset for checking a snapshot's data.
+// Check creates a taskset for checking a snapshot's data. If a
+// decryptionKey is given, encrypted archives are also checked to
+// decrypt with it; otherwise only their hashes are checked.
 // Note that the state must be locked by the caller.
-func Check(st *state.State, setID uint64, snapNames []string, users []string) (snapsFound []string, ts *state.TaskSet, err error) {
+func Check(st *state.State, setID uint64, snapNames []string, users []string, decryptionKey string) (snapsFound []string, ts *state.TaskSet, err error) {
+	key, err := parseDecryptionKey(decryptionKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// check needs to conflict with forget of itself
 	if err := checkSnapshotTaskConflict(st, setID, "forget-snapshot"); err != nil {
 		return nil, nil, err
@@ -408,6 +663,10 @@ func Check(st *state.State, setID uint64, snapNames []string, users []string) (s
 	ts = state.NewTaskSet()
 
 	for _, summary := range summaries {
+		if err := checkDecryptionKey(summary, key); err != nil {
+			return nil, nil, fmt.Errorf("cannot check snapshot: %v", err)
+		}
+
 		desc := fmt.Sprintf("Check data of snap %q in snapshot set #%d", summary.snap, setID)
 		task := st.NewTask("check-snapshot", desc)
 		snapshot := snapshotSetup{
@@ -415,10 +674,12 @@ func Check(st *state.State, setID uint64, snapNames []string, users []string) (s
 			Snap:     summary.snap,
 			Users:    users,
 			Filename: summary.filename,
+			Decrypt:  key != nil,
 		}
 		task.Set("snapshot-setup", &snapshot)
 		ts.AddTask(task)
 	}
+	cacheDecryptionKeys(ts, key)
 
 	return summaries.snapNames(), ts, nil
 }
@@ -451,3 +712,35 @@ func Forget(st *state.State, setID uint64, snapNames []string) (snapsFound []str
 
 	return summaries.snapNames(), ts, nil
 }
+
+// Export opens the snapshot set with the given id for exporting. The
+// returned SnapshotExport must be closed by the caller, and can be
+// streamed without holding the state lock.
+// Note that the state must be locked by the caller.
+func Export(ctx context.Context, st *state.State, setID uint64) (*backend.SnapshotExport, error) {
+	// an export of a set that is still being saved would be incomplete
+	if err := checkSnapshotTaskConflict(st, setID, "save-snapshot"); err != nil {
+		return nil, err
+	}
+
+	return backendNewSnapshotExport(ctx, setID)
+}
+
+// Import a snapshot set, as produced by Export, from the given reader,
+// giving it a new set id. It returns the new set id and the names of
+// the snaps in it.
+// Note that the state must not be locked by the caller.
+func Import(ctx context.Context, st *state.State, r io.Reader) (setID uint64, snapNames []string, err error) {
+	st.Lock()
+	setID, err = newSnapshotSetID(st)
+	st.Unlock()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	snapNames, err = backendImport(ctx, setID, r)
+	if err != nil {
+		return 0, nil, err
+	}
+	return setID, snapNames, nil
+}
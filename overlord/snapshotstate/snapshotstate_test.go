@@ -21,8 +21,16 @@ package snapshotstate_test
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"os/user"
@@ -57,6 +65,29 @@ var _ = check.Suite(&snapshotSuite{})
 // tie gocheck into testing
 func TestSnapshot(t *testing.T) { check.TestingT(t) }
 
+// testKeyPair returns a generated key pair for snapshot encryption,
+// along with the encryption metadata of a snapshot encrypted for it.
+func testKeyPair(c *check.C) (pub, priv string, encryption *client.SnapshotEncryption) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, check.IsNil)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	c.Assert(err, check.IsNil)
+	privDER, err := x509.MarshalECPrivateKey(key)
+	c.Assert(err, check.IsNil)
+	pub = base64.StdEncoding.EncodeToString(der)
+	priv = string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privDER}))
+
+	encKey, err := backend.ParseEncryptionKey(pub)
+	c.Assert(err, check.IsNil)
+	// any point on the curve does as ephemeral key
+	ephemeral := elliptic.Marshal(elliptic.P256(), key.X, key.Y)
+	return pub, priv, &client.SnapshotEncryption{
+		Scheme:       "p256-aes256gcm",
+		KeyID:        encKey.ID(),
+		EphemeralKey: base64.StdEncoding.EncodeToString(ephemeral),
+	}
+}
+
 func (snapshotSuite) SetUpTest(c *check.C) {
 	dirs.SetRootDir(c.MkDir())
 }
@@ -294,7 +325,7 @@ func (snapshotSuite) TestSaveChecksSnapnamesError(c *check.C) {
 	st := state.New(nil)
 	st.Lock()
 	defer st.Unlock()
-	_, _, _, err := snapshotstate.Save(st, nil, nil)
+	_, _, _, err := snapshotstate.Save(st, nil, nil, "")
 	c.Check(err, check.ErrorMatches, "bzzt")
 }
 
@@ -359,7 +390,7 @@ func (s snapshotSuite) TestSaveChecksSnapstateConflict(c *check.C) {
 	st, restore := s.createConflictingChange(c)
 	defer restore()
 
-	_, _, _, err := snapshotstate.Save(st, []string{"foo"}, nil)
+	_, _, _, err := snapshotstate.Save(st, []string{"foo"}, nil, "")
 	c.Assert(err, check.NotNil)
 	c.Check(err, check.FitsTypeOf, &snapstate.ChangeConflictError{})
 }
@@ -395,7 +426,7 @@ func (snapshotSuite) TestSaveConflictsWithSnapstate(c *check.C) {
 	})
 
 	chg := st.NewChange("snapshot-save", "...")
-	_, _, saveTasks, err := snapshotstate.Save(st, nil, nil)
+	_, _, saveTasks, err := snapshotstate.Save(st, nil, nil, "")
 	c.Assert(err, check.IsNil)
 	chg.AddAll(saveTasks)
 
@@ -411,7 +442,7 @@ func (snapshotSuite) TestSaveChecksSnapstateConflictError(c *check.C) {
 	st := state.New(nil)
 	st.Lock()
 	defer st.Unlock()
-	_, _, _, err := snapshotstate.Save(st, nil, nil)
+	_, _, _, err := snapshotstate.Save(st, nil, nil, "")
 	c.Check(err, check.ErrorMatches, "bzzt")
 }
 
@@ -422,7 +453,7 @@ func (snapshotSuite) TestSaveChecksSetIDError(c *check.C) {
 
 	st.Set("last-snapshot-set-id", "3/4")
 
-	_, _, _, err := snapshotstate.Save(st, nil, nil)
+	_, _, _, err := snapshotstate.Save(st, nil, nil, "")
 	c.Check(err, check.ErrorMatches, ".* could not unmarshal .*")
 }
 
@@ -431,7 +462,7 @@ func (snapshotSuite) TestSaveNoSnapsInState(c *check.C) {
 	st.Lock()
 	defer st.Unlock()
 
-	setID, saved, taskset, err := snapshotstate.Save(st, nil, nil)
+	setID, saved, taskset, err := snapshotstate.Save(st, nil, nil, "")
 	c.Assert(err, check.IsNil)
 	c.Check(setID, check.Equals, uint64(1))
 	c.Check(saved, check.HasLen, 0)
@@ -453,7 +484,7 @@ func (snapshotSuite) TestSaveSomeSnaps(c *check.C) {
 	st.Lock()
 	defer st.Unlock()
 
-	setID, saved, taskset, err := snapshotstate.Save(st, nil, nil)
+	setID, saved, taskset, err := snapshotstate.Save(st, nil, nil, "")
 	c.Assert(err, check.IsNil)
 	c.Check(setID, check.Equals, uint64(1))
 	c.Check(saved, check.DeepEquals, []string{"a-snap", "c-snap"})
@@ -477,7 +508,7 @@ func (snapshotSuite) TestSaveOneSnap(c *check.C) {
 	st.Lock()
 	defer st.Unlock()
 
-	setID, saved, taskset, err := snapshotstate.Save(st, []string{"a-snap"}, []string{"a-user"})
+	setID, saved, taskset, err := snapshotstate.Save(st, []string{"a-snap"}, []string{"a-user"}, "")
 	c.Assert(err, check.IsNil)
 	c.Check(setID, check.Equals, uint64(1))
 	c.Check(saved, check.DeepEquals, []string{"a-snap"})
@@ -495,6 +526,92 @@ func (snapshotSuite) TestSaveOneSnap(c *check.C) {
 	})
 }
 
+func (snapshotSuite) TestScheduledSnapshot(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	setID, taskset, err := snapshotstate.ScheduledSnapshot(st, []string{"a-snap", "b-snap"})
+	c.Assert(err, check.IsNil)
+	c.Check(setID, check.Equals, uint64(1))
+	tasks := taskset.Tasks()
+	c.Assert(tasks, check.HasLen, 2)
+	for i, name := range []string{"a-snap", "b-snap"} {
+		c.Check(tasks[i].Kind(), check.Equals, "save-snapshot")
+		c.Check(tasks[i].Summary(), check.Equals, fmt.Sprintf(`Save data of snap %q in scheduled snapshot set #1`, name))
+		var snapshot map[string]interface{}
+		c.Check(tasks[i].Get("snapshot-setup", &snapshot), check.IsNil)
+		c.Check(snapshot, check.DeepEquals, map[string]interface{}{
+			"set-id":    1.,
+			"snap":      name,
+			"current":   "unset",
+			"scheduled": true,
+		})
+	}
+
+	_, _, err = snapshotstate.ScheduledSnapshot(st, nil)
+	c.Check(err, check.ErrorMatches, "internal error: no snaps to take a scheduled snapshot of")
+}
+
+func (snapshotSuite) TestSaveEncryptionKey(c *check.C) {
+	defer snapshotstate.MockSnapstateAll(func(*state.State) (map[string]*snapstate.SnapState, error) {
+		return nil, errors.New("bzzt")
+	})()
+	pub, _, _ := testKeyPair(c)
+	configuredPub, _, _ := testKeyPair(c)
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	encryptionKey := func(ts *state.TaskSet) string {
+		var snapshot map[string]interface{}
+		c.Assert(ts.Tasks()[0].Get("snapshot-setup", &snapshot), check.IsNil)
+		key, _ := snapshot["encryption-key"].(string)
+		return key
+	}
+
+	_, _, ts, err := snapshotstate.Save(st, []string{"a-snap"}, nil, pub)
+	c.Assert(err, check.IsNil)
+	c.Check(encryptionKey(ts), check.Equals, pub)
+
+	tr := config.NewTransaction(st)
+	c.Assert(tr.Set("core", "snapshots.encryption-key", configuredPub), check.IsNil)
+	tr.Commit()
+
+	// the configured key is used by default
+	_, _, ts, err = snapshotstate.Save(st, []string{"a-snap"}, nil, "")
+	c.Assert(err, check.IsNil)
+	c.Check(encryptionKey(ts), check.Equals, configuredPub)
+
+	// but can be overridden
+	_, _, ts, err = snapshotstate.Save(st, []string{"a-snap"}, nil, pub)
+	c.Assert(err, check.IsNil)
+	c.Check(encryptionKey(ts), check.Equals, pub)
+
+	_, _, _, err = snapshotstate.Save(st, []string{"a-snap"}, nil, "Zm9v")
+	c.Check(err, check.ErrorMatches, "cannot parse encryption key: .*")
+}
+
+func (snapshotSuite) TestAutomaticSnapshotEncryptionKey(c *check.C) {
+	pub, _, _ := testKeyPair(c)
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	tr := config.NewTransaction(st)
+	tr.Set("core", "snapshots.automatic.retention", "24h")
+	tr.Set("core", "snapshots.encryption-key", pub)
+	tr.Commit()
+
+	ts, err := snapshotstate.AutomaticSnapshot(st, "foo")
+	c.Assert(err, check.IsNil)
+	var snapshot map[string]interface{}
+	c.Assert(ts.Tasks()[0].Get("snapshot-setup", &snapshot), check.IsNil)
+	c.Check(snapshot["encryption-key"], check.Equals, pub)
+}
+
 func (snapshotSuite) TestSaveIntegration(c *check.C) {
 	if os.Geteuid() == 0 {
 		c.Skip("this test cannot run as root (runuser will fail)")
@@ -550,7 +667,7 @@ func (snapshotSuite) TestSaveIntegration(c *check.C) {
 		}
 	}
 
-	setID, saved, taskset, err := snapshotstate.Save(st, nil, []string{"a-user"})
+	setID, saved, taskset, err := snapshotstate.Save(st, nil, []string{"a-user"}, "")
 	c.Assert(err, check.IsNil)
 	c.Check(setID, check.Equals, uint64(1))
 	c.Check(saved, check.DeepEquals, []string{"one-snap", "too-snap", "tri-snap"})
@@ -656,7 +773,7 @@ exec /bin/tar "$@"
 		c.Assert(os.Mkdir(filepath.Join(homedir, "snap", name, "common", "common-"+name), mode), check.IsNil)
 	}
 
-	setID, saved, taskset, err := snapshotstate.Save(st, nil, []string{"a-user"})
+	setID, saved, taskset, err := snapshotstate.Save(st, nil, []string{"a-user"}, "")
 	c.Assert(err, check.IsNil)
 	c.Check(setID, check.Equals, uint64(1))
 	c.Check(saved, check.DeepEquals, []string{"one-snap", "too-snap", "tri-snap"})
@@ -701,7 +818,7 @@ func (snapshotSuite) TestRestoreChecksIterError(c *check.C) {
 	st.Lock()
 	defer st.Unlock()
 
-	_, _, err := snapshotstate.Restore(st, 42, nil, nil)
+	_, _, err := snapshotstate.Restore(st, 42, nil, nil, "")
 	c.Assert(err, check.ErrorMatches, "bzzt")
 }
 
@@ -709,7 +826,7 @@ func (s snapshotSuite) TestRestoreChecksSnapstateConflicts(c *check.C) {
 	st, restore := s.createConflictingChange(c)
 	defer restore()
 
-	_, _, err := snapshotstate.Restore(st, 42, nil, nil)
+	_, _, err := snapshotstate.Restore(st, 42, nil, nil, "")
 	c.Assert(err, check.NotNil)
 	c.Check(err, check.FitsTypeOf, &snapstate.ChangeConflictError{})
 
@@ -766,7 +883,7 @@ func (snapshotSuite) TestRestoreConflictsWithSnapstate(c *check.C) {
 	})
 
 	chg := st.NewChange("snapshot-restore", "...")
-	_, restoreTasks, err := snapshotstate.Restore(st, 42, nil, nil)
+	_, restoreTasks, err := snapshotstate.Restore(st, 42, nil, nil, "")
 	c.Assert(err, check.IsNil)
 	chg.AddAll(restoreTasks)
 
@@ -798,7 +915,7 @@ func (snapshotSuite) TestRestoreChecksForgetConflicts(c *check.C) {
 	tsk.Set("snapshot-setup", map[string]int{"set-id": 42})
 	chg.AddTask(tsk)
 
-	_, _, err = snapshotstate.Restore(st, 42, nil, nil)
+	_, _, err = snapshotstate.Restore(st, 42, nil, nil, "")
 	c.Assert(err, check.ErrorMatches, `cannot operate on snapshot set #42 while change \"1\" is in progress`)
 }
 
@@ -833,7 +950,7 @@ func (snapshotSuite) TestRestoreChecksChangesToSnapID(c *check.C) {
 	st.Lock()
 	defer st.Unlock()
 
-	_, _, err = snapshotstate.Restore(st, 42, nil, nil)
+	_, _, err = snapshotstate.Restore(st, 42, nil, nil, "")
 	c.Assert(err, check.ErrorMatches, `cannot restore snapshot for "a-snap": current snap \(ID 1234567…\) does not match snapshot \(ID 0987654…\)`)
 }
 
@@ -874,7 +991,7 @@ func (snapshotSuite) TestRestoreChecksChangesToEpoch(c *check.C) {
 	st.Lock()
 	defer st.Unlock()
 
-	_, _, err = snapshotstate.Restore(st, 42, nil, nil)
+	_, _, err = snapshotstate.Restore(st, 42, nil, nil, "")
 	c.Assert(err, check.ErrorMatches, `cannot restore snapshot for "a-snap": current snap \(epoch 17\) cannot read snapshot data \(epoch 42\)`)
 }
 
@@ -915,7 +1032,7 @@ func (snapshotSuite) TestRestoreWorksWithCompatibleEpoch(c *check.C) {
 	st.Lock()
 	defer st.Unlock()
 
-	found, taskset, err := snapshotstate.Restore(st, 42, nil, nil)
+	found, taskset, err := snapshotstate.Restore(st, 42, nil, nil, "")
 	c.Assert(err, check.IsNil)
 	c.Check(found, check.DeepEquals, []string{"a-snap"})
 	tasks := taskset.Tasks()
@@ -951,7 +1068,7 @@ func (snapshotSuite) TestRestore(c *check.C) {
 	st.Lock()
 	defer st.Unlock()
 
-	found, taskset, err := snapshotstate.Restore(st, 42, []string{"a-snap", "b-snap"}, []string{"a-user"})
+	found, taskset, err := snapshotstate.Restore(st, 42, []string{"a-snap", "b-snap"}, []string{"a-user"}, "")
 	c.Assert(err, check.IsNil)
 	c.Check(found, check.DeepEquals, []string{"a-snap"})
 	tasks := taskset.Tasks()
@@ -969,6 +1086,52 @@ func (snapshotSuite) TestRestore(c *check.C) {
 	})
 }
 
+func (snapshotSuite) TestRestoreEncrypted(c *check.C) {
+	shotfile, err := os.Create(filepath.Join(c.MkDir(), "yadda.zip"))
+	c.Assert(err, check.IsNil)
+	defer shotfile.Close()
+	_, priv, encryption := testKeyPair(c)
+	_, otherPriv, _ := testKeyPair(c)
+	defer snapshotstate.MockBackendIter(func(_ context.Context, f func(*backend.Reader) error) error {
+		return f(&backend.Reader{
+			Snapshot: client.Snapshot{SetID: 42, Snap: "a-snap", Encryption: encryption},
+			File:     shotfile,
+		})
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	_, _, err = snapshotstate.Restore(st, 42, nil, nil, "")
+	c.Check(err, check.ErrorMatches, `cannot restore snapshot for "a-snap": snapshot is encrypted and no decryption key was given`)
+	_, _, err = snapshotstate.Restore(st, 42, nil, nil, "foo")
+	c.Check(err, check.ErrorMatches, `cannot decode decryption key: no PEM data found`)
+	_, _, err = snapshotstate.Restore(st, 42, nil, nil, otherPriv)
+	c.Check(err, check.ErrorMatches, `cannot restore snapshot: decryption key does not match the key the snapshot for "a-snap" was encrypted for`)
+
+	_, taskset, err := snapshotstate.Restore(st, 42, nil, nil, priv)
+	c.Assert(err, check.IsNil)
+	task := taskset.Tasks()[0]
+	var snapshot map[string]interface{}
+	c.Check(task.Get("snapshot-setup", &snapshot), check.IsNil)
+	c.Check(snapshot["decrypt"], check.Equals, true)
+	checkDecryptionKeyInMemoryOnly(c, task, priv, encryption)
+}
+
+// checkDecryptionKeyInMemoryOnly checks the task has the decryption key
+// cached, and that it is nowhere in the state.
+func checkDecryptionKeyInMemoryOnly(c *check.C, task *state.Task, priv string, encryption *client.SnapshotEncryption) {
+	key := snapshotstate.CachedDecryptionKey(task)
+	c.Assert(key, check.NotNil)
+	c.Check(key.ID(), check.Equals, encryption.KeyID)
+
+	buf, err := json.Marshal(task.State())
+	c.Assert(err, check.IsNil)
+	c.Check(string(buf), check.Not(testutil.Contains), "PRIVATE KEY")
+	c.Check(string(buf), check.Not(testutil.Contains), strings.Split(priv, "\n")[1])
+}
+
 func (snapshotSuite) TestRestoreIntegration(c *check.C) {
 	if os.Geteuid() == 0 {
 		c.Skip("this test cannot run as root (runuser will fail)")
@@ -1028,7 +1191,7 @@ func (snapshotSuite) TestRestoreIntegration(c *check.C) {
 	// remove b-user's home
 	c.Assert(os.RemoveAll(homedirB), check.IsNil)
 
-	found, taskset, err := snapshotstate.Restore(st, 42, nil, []string{"a-user", "b-user"})
+	found, taskset, err := snapshotstate.Restore(st, 42, nil, []string{"a-user", "b-user"}, "")
 	c.Assert(err, check.IsNil)
 	sort.Strings(found)
 	c.Check(found, check.DeepEquals, []string{"one-snap", "too-snap", "tri-snap"})
@@ -1106,7 +1269,7 @@ func (snapshotSuite) TestRestoreIntegrationFails(c *check.C) {
 	c.Assert(os.MkdirAll(filepath.Join(homedir, "snap"), 0755), check.IsNil)
 	c.Assert(os.MkdirAll(filepath.Join(homedir, "snap", "too-snap"), 0), check.IsNil)
 
-	found, taskset, err := snapshotstate.Restore(st, 42, nil, []string{"a-user"})
+	found, taskset, err := snapshotstate.Restore(st, 42, nil, []string{"a-user"}, "")
 	c.Assert(err, check.IsNil)
 	sort.Strings(found)
 	c.Check(found, check.DeepEquals, []string{"one-snap", "too-snap", "tri-snap"})
@@ -1158,7 +1321,7 @@ func (snapshotSuite) TestCheckChecksIterError(c *check.C) {
 	st.Lock()
 	defer st.Unlock()
 
-	_, _, err := snapshotstate.Check(st, 42, nil, nil)
+	_, _, err := snapshotstate.Check(st, 42, nil, nil, "")
 	c.Assert(err, check.ErrorMatches, "bzzt")
 }
 
@@ -1166,7 +1329,7 @@ func (s snapshotSuite) TestCheckDoesNotTriggerSnapstateConflict(c *check.C) {
 	st, restore := s.createConflictingChange(c)
 	defer restore()
 
-	_, _, err := snapshotstate.Check(st, 42, nil, nil)
+	_, _, err := snapshotstate.Check(st, 42, nil, nil, "")
 	c.Assert(err, check.IsNil)
 }
 
@@ -1194,7 +1357,7 @@ func (snapshotSuite) TestCheckChecksForgetConflicts(c *check.C) {
 	tsk.Set("snapshot-setup", map[string]int{"set-id": 42})
 	chg.AddTask(tsk)
 
-	_, _, err = snapshotstate.Check(st, 42, nil, nil)
+	_, _, err = snapshotstate.Check(st, 42, nil, nil, "")
 	c.Assert(err, check.ErrorMatches, `cannot operate on snapshot set #42 while change \"1\" is in progress`)
 }
 
@@ -1217,7 +1380,7 @@ func (snapshotSuite) TestCheck(c *check.C) {
 	st.Lock()
 	defer st.Unlock()
 
-	found, taskset, err := snapshotstate.Check(st, 42, []string{"a-snap", "b-snap"}, []string{"a-user"})
+	found, taskset, err := snapshotstate.Check(st, 42, []string{"a-snap", "b-snap"}, []string{"a-user"}, "")
 	c.Assert(err, check.IsNil)
 	c.Check(found, check.DeepEquals, []string{"a-snap"})
 	tasks := taskset.Tasks()
@@ -1235,6 +1398,41 @@ func (snapshotSuite) TestCheck(c *check.C) {
 	})
 }
 
+func (snapshotSuite) TestCheckEncrypted(c *check.C) {
+	shotfile, err := os.Create(filepath.Join(c.MkDir(), "yadda.zip"))
+	c.Assert(err, check.IsNil)
+	defer shotfile.Close()
+	_, priv, encryption := testKeyPair(c)
+	_, otherPriv, _ := testKeyPair(c)
+	defer snapshotstate.MockBackendIter(func(_ context.Context, f func(*backend.Reader) error) error {
+		return f(&backend.Reader{
+			Snapshot: client.Snapshot{SetID: 42, Snap: "a-snap", Encryption: encryption},
+			File:     shotfile,
+		})
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	// without a key only the hashes are checked
+	_, taskset, err := snapshotstate.Check(st, 42, nil, nil, "")
+	c.Assert(err, check.IsNil)
+	var snapshot map[string]interface{}
+	c.Check(taskset.Tasks()[0].Get("snapshot-setup", &snapshot), check.IsNil)
+	c.Check(snapshot["decrypt"], check.IsNil)
+	c.Check(snapshotstate.CachedDecryptionKey(taskset.Tasks()[0]), check.IsNil)
+
+	_, _, err = snapshotstate.Check(st, 42, nil, nil, otherPriv)
+	c.Check(err, check.ErrorMatches, `cannot check snapshot: decryption key does not match the key the snapshot for "a-snap" was encrypted for`)
+
+	_, taskset, err = snapshotstate.Check(st, 42, nil, nil, priv)
+	c.Assert(err, check.IsNil)
+	c.Check(taskset.Tasks()[0].Get("snapshot-setup", &snapshot), check.IsNil)
+	c.Check(snapshot["decrypt"], check.Equals, true)
+	checkDecryptionKeyInMemoryOnly(c, taskset.Tasks()[0], priv, encryption)
+}
+
 func (snapshotSuite) TestForgetChecksIterError(c *check.C) {
 	defer snapshotstate.MockBackendIter(func(context.Context, func(*backend.Reader) error) error {
 		return errors.New("bzzt")
@@ -1369,6 +1567,81 @@ func (snapshotSuite) TestSaveExpiration(c *check.C) {
 	})
 }
 
+func (snapshotSuite) TestSaveScheduledTime(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	tm, err := time.Parse(time.RFC3339, "2019-03-11T11:24:00Z")
+	c.Assert(err, check.IsNil)
+	c.Assert(snapshotstate.SaveScheduledTime(st, 12, tm), check.IsNil)
+
+	var snapshots map[uint64]interface{}
+	c.Assert(st.Get("snapshots", &snapshots), check.IsNil)
+	c.Check(snapshots, check.DeepEquals, map[uint64]interface{}{
+		12: map[string]interface{}{"expiry-time": "0001-01-01T00:00:00Z", "scheduled-time": "2019-03-11T11:24:00Z"},
+	})
+}
+
+func (snapshotSuite) TestPrunableSnapshotSets(c *check.C) {
+	oldLocal := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = oldLocal }()
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	now, err := time.Parse(time.RFC3339, "2020-03-12T12:00:00Z")
+	c.Assert(err, check.IsNil)
+
+	prunable, err := snapshotstate.PrunableSnapshotSets(st, now)
+	c.Assert(err, check.IsNil)
+	c.Check(prunable, check.HasLen, 0)
+
+	for setID, when := range map[uint64]string{
+		1: "2020-03-02T12:00:00Z", // Monday, week 10
+		2: "2020-03-08T12:00:00Z", // Sunday, week 10
+		3: "2020-03-09T12:00:00Z", // Monday, week 11
+		4: "2020-03-10T06:00:00Z",
+		5: "2020-03-10T12:00:00Z",
+		6: "2020-03-11T12:00:00Z",
+	} {
+		tm, err := time.Parse(time.RFC3339, when)
+		c.Assert(err, check.IsNil)
+		c.Assert(snapshotstate.SaveScheduledTime(st, setID, tm), check.IsNil)
+	}
+	// automatic snapshot sets are not pruned
+	c.Assert(snapshotstate.SaveExpiration(st, 7, now.Add(-time.Hour)), check.IsNil)
+
+	for _, t := range []struct {
+		conf     map[string]interface{}
+		prunable []uint64
+	}{
+		// by default, 7 days and 4 weeks are kept
+		{nil, []uint64{4}},
+		{map[string]interface{}{"keep-daily": 3, "keep-weekly": 2}, []uint64{1, 4}},
+		{map[string]interface{}{"keep-daily": 3, "keep-weekly": 0}, []uint64{1, 2, 4}},
+		{map[string]interface{}{"keep-daily": 0, "keep-weekly": 1}, []uint64{1, 2, 3, 4, 5}},
+		{map[string]interface{}{"keep-daily": 3, "keep-weekly": 2, "max-age": "72h"}, []uint64{1, 2, 4}},
+		// only the age counts without count-based retention
+		{map[string]interface{}{"keep-daily": 0, "keep-weekly": 0, "max-age": "72h"}, []uint64{1, 2}},
+		{map[string]interface{}{"keep-daily": 0, "keep-weekly": 0}, nil},
+	} {
+		tr := config.NewTransaction(st)
+		c.Assert(tr.Set("core", "snapshots.scheduled", t.conf), check.IsNil)
+		tr.Commit()
+
+		prunable, err := snapshotstate.PrunableSnapshotSets(st, now)
+		c.Assert(err, check.IsNil)
+		expected := make(map[uint64]bool, len(t.prunable))
+		for _, setID := range t.prunable {
+			expected[setID] = true
+		}
+		c.Check(prunable, check.DeepEquals, expected, check.Commentf("%v", t.conf))
+	}
+}
+
 func (snapshotSuite) TestRemoveSnapshotState(c *check.C) {
 	st := state.New(nil)
 	st.Lock()
@@ -1402,6 +1675,9 @@ func (snapshotSuite) TestExpiredSnapshotSets(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(snapshotstate.SaveExpiration(st, 13, tm), check.IsNil)
 
+	// scheduled snapshot sets don't expire
+	c.Assert(snapshotstate.SaveScheduledTime(st, 14, tm), check.IsNil)
+
 	tm, err = time.Parse(time.RFC3339, "2020-03-11T11:24:00Z")
 	c.Assert(err, check.IsNil)
 	expired, err := snapshotstate.ExpiredSnapshotSets(st, tm)
@@ -1477,3 +1753,73 @@ func (snapshotSuite) TestAutomaticSnapshotDefaultUbuntuCore(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(du, check.Equals, time.Duration(0))
 }
+
+func (snapshotSuite) TestExport(c *check.C) {
+	var called uint64
+	defer snapshotstate.MockBackendNewSnapshotExport(func(ctx context.Context, setID uint64) (*backend.SnapshotExport, error) {
+		called = setID
+		return &backend.SnapshotExport{SetID: setID}, nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	se, err := snapshotstate.Export(context.TODO(), st, 42)
+	c.Assert(err, check.IsNil)
+	c.Check(se.SetID, check.Equals, uint64(42))
+	c.Check(called, check.Equals, uint64(42))
+}
+
+func (snapshotSuite) TestExportConflictsWithSave(c *check.C) {
+	defer snapshotstate.MockBackendNewSnapshotExport(func(ctx context.Context, setID uint64) (*backend.SnapshotExport, error) {
+		c.Fatalf("unexpected call")
+		return nil, nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+	chg := st.NewChange("save-snapshot", "...")
+	tsk := st.NewTask("save-snapshot", "...")
+	tsk.Set("snapshot-setup", map[string]int{"set-id": 42})
+	chg.AddTask(tsk)
+
+	_, err := snapshotstate.Export(context.TODO(), st, 42)
+	c.Check(err, check.ErrorMatches, `cannot operate on snapshot set #42 while change "1" is in progress`)
+}
+
+func (snapshotSuite) TestImport(c *check.C) {
+	var calledID uint64
+	defer snapshotstate.MockBackendImport(func(ctx context.Context, id uint64, r io.Reader) ([]string, error) {
+		calledID = id
+		return []string{"bar", "foo"}, nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	st.Set("last-snapshot-set-id", 41)
+	st.Unlock()
+
+	setID, snapNames, err := snapshotstate.Import(context.TODO(), st, strings.NewReader(""))
+	c.Assert(err, check.IsNil)
+	c.Check(setID, check.Equals, uint64(42))
+	c.Check(calledID, check.Equals, uint64(42))
+	c.Check(snapNames, check.DeepEquals, []string{"bar", "foo"})
+
+	st.Lock()
+	defer st.Unlock()
+	var lastSetID uint64
+	c.Assert(st.Get("last-snapshot-set-id", &lastSetID), check.IsNil)
+	c.Check(lastSetID, check.Equals, uint64(42))
+}
+
+func (snapshotSuite) TestImportError(c *check.C) {
+	defer snapshotstate.MockBackendImport(func(ctx context.Context, id uint64, r io.Reader) ([]string, error) {
+		return nil, errors.New("boom")
+	})()
+
+	st := state.New(nil)
+	_, _, err := snapshotstate.Import(context.TODO(), st, strings.NewReader(""))
+	c.Check(err, check.ErrorMatches, "boom")
+}
@@ -46,6 +46,9 @@ const maxPostponement = 60 * 24 * time.Hour
 // cannot inhibit refreshes for more than maxInhibition
 const maxInhibition = 7 * 24 * time.Hour
 
+// a snap cannot hold its own refreshes for more than maxSelfHold
+const maxSelfHold = 7 * 24 * time.Hour
+
 // hooks setup by devicestate
 var (
 	CanAutoRefresh        func(st *state.State) (bool, error)
@@ -56,6 +59,9 @@ var (
 // refreshRetryDelay specified the minimum time to retry failed refreshes
 var refreshRetryDelay = 20 * time.Minute
 
+// timeNow is used to check and record refresh holds
+var timeNow = time.Now
+
 // autoRefresh will ensure that snaps are refreshed automatically
 // according to the refresh schedule.
 type autoRefresh struct {
@@ -327,7 +333,8 @@ func (m *autoRefresh) ensureLastRefreshAnchor() {
 // the refresh schedule is automatically reset to the default.
 //
 // TODO: we can remove the refreshSchedule reset because we have validation
-//       of the schedule now.
+//
+//	of the schedule now.
 func (m *autoRefresh) refreshScheduleWithDefaultsFallback() (ts []*timeutil.Schedule, scheduleAsStr string, legacy bool, err error) {
 	if managed, legacy := refreshScheduleManaged(m.state); managed {
 		if m.lastRefreshSchedule != "managed" {
@@ -475,6 +482,115 @@ func getTime(st *state.State, timeKey string) (time.Time, error) {
 	return t1, nil
 }
 
+// HoldRefresh holds automatic refreshes of the given snap until the
+// given time and returns the time the hold was recorded with. A zero
+// holdUntil holds refreshes for the maximum allowed period, a snap
+// cannot be held for more than maxPostponement.
+func HoldRefresh(st *state.State, instanceName string, holdUntil time.Time) (time.Time, error) {
+	var snapst SnapState
+	err := Get(st, instanceName, &snapst)
+	if err == state.ErrNoState {
+		return time.Time{}, &snap.NotInstalledError{Snap: instanceName}
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	now := timeNow()
+	if holdUntil.IsZero() {
+		holdUntil = now.Add(maxPostponement)
+	}
+	if !holdUntil.After(now) {
+		return time.Time{}, fmt.Errorf("cannot hold refreshes of snap %q: hold time is in the past", instanceName)
+	}
+	if holdUntil.Sub(now) > maxPostponement {
+		return time.Time{}, fmt.Errorf("cannot hold refreshes of snap %q for more than %d days", instanceName, int(maxPostponement.Hours()/24))
+	}
+
+	holdUntil = holdUntil.UTC()
+	snapst.RefreshHold = &holdUntil
+	Set(st, instanceName, &snapst)
+	return holdUntil, nil
+}
+
+// UnholdRefresh removes any hold on automatic refreshes of the given snap.
+func UnholdRefresh(st *state.State, instanceName string) error {
+	var snapst SnapState
+	err := Get(st, instanceName, &snapst)
+	if err == state.ErrNoState {
+		return &snap.NotInstalledError{Snap: instanceName}
+	}
+	if err != nil {
+		return err
+	}
+
+	if snapst.RefreshHold == nil {
+		return nil
+	}
+	snapst.RefreshHold = nil
+	Set(st, instanceName, &snapst)
+	return nil
+}
+
+// HoldRefreshBySnap holds automatic refreshes of the given snap on
+// request of the snap itself, for as long as it is allowed to, and
+// returns the time until which they are held. A snap can hold its own
+// refreshes for at most maxSelfHold since it first held them; the
+// window only starts over once the snap is refreshed.
+func HoldRefreshBySnap(st *state.State, instanceName string) (time.Time, error) {
+	var snapst SnapState
+	err := Get(st, instanceName, &snapst)
+	if err == state.ErrNoState {
+		return time.Time{}, &snap.NotInstalledError{Snap: instanceName}
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	now := timeNow().UTC()
+	if snapst.RefreshSelfHold == nil {
+		snapst.RefreshSelfHold = &RefreshSelfHold{Since: now}
+	}
+	until := snapst.RefreshSelfHold.Since.Add(maxSelfHold)
+	if !until.After(now) {
+		return time.Time{}, fmt.Errorf("cannot hold refreshes of snap %q any longer: held since %s", instanceName, snapst.RefreshSelfHold.Since.Format(time.RFC3339))
+	}
+	snapst.RefreshSelfHold.Until = until
+	Set(st, instanceName, &snapst)
+	return until, nil
+}
+
+// ProceedWithRefresh releases any hold the given snap put on its own
+// automatic refreshes. Holds by the user are not affected.
+func ProceedWithRefresh(st *state.State, instanceName string) error {
+	var snapst SnapState
+	err := Get(st, instanceName, &snapst)
+	if err == state.ErrNoState {
+		return &snap.NotInstalledError{Snap: instanceName}
+	}
+	if err != nil {
+		return err
+	}
+
+	if snapst.RefreshSelfHold == nil || snapst.RefreshSelfHold.Until.IsZero() {
+		return nil
+	}
+	// keep Since, so holding again doesn't extend the window
+	snapst.RefreshSelfHold.Until = time.Time{}
+	Set(st, instanceName, &snapst)
+	return nil
+}
+
+// autoRefreshHoldFilter is an updateFilter that drops the snaps whose
+// automatic refreshes are currently held.
+func autoRefreshHoldFilter(update *snap.Info, snapst *SnapState) bool {
+	if snapst.RefreshHeld(timeNow()) {
+		logger.Debugf("auto-refresh of snap %q is held until %s", update.InstanceName(), snapst.RefreshHeldUntil().Format(time.RFC3339))
+		return false
+	}
+	return true
+}
+
 // inhibitRefresh returns an error if refresh is inhibited by running apps.
 //
 // Internally the snap state is updated to remember when the inhibition first
@@ -488,14 +604,24 @@ func inhibitRefresh(st *state.State, snapst *SnapState, info *snap.Info, checker
 			// This is reset to nil on successful refresh.
 			snapst.RefreshInhibitedTime = &now
 			Set(st, info.InstanceName(), snapst)
+			addRefreshInhibitNotice(st, info, snapst)
 			return err
 		}
 
 		if now.Sub(*snapst.RefreshInhibitedTime) < maxInhibition {
 			// If we are still in the allowed window then just return
 			// the error but don't change the snap state again.
+			addRefreshInhibitNotice(st, info, snapst)
 			return err
 		}
 	}
 	return nil
 }
+
+// addRefreshInhibitNotice records that the refresh of the given snap
+// was inhibited by its running applications.
+func addRefreshInhibitNotice(st *state.State, info *snap.Info, snapst *SnapState) {
+	st.AddNotice(state.RefreshInhibitNotice, info.InstanceName(), map[string]string{
+		"inhibited-since": snapst.RefreshInhibitedTime.Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,398 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
+)
+
+// a snap cannot hold the refreshes of another snap for more than
+// maxGatingHold
+const maxGatingHold = 7 * 24 * time.Hour
+
+// gatingHold records that the automatic refreshes of a snap are held by
+// another snap, from its gate-auto-refresh hook.
+type gatingHold struct {
+	// Revision is the revision of the held snap when it was first
+	// held, the hold is dropped once the snap is at another revision.
+	Revision snap.Revision `json:"revision"`
+	Since    time.Time     `json:"since"`
+	Until    time.Time     `json:"until"`
+}
+
+// gatingHolds returns the holds by gating snaps, indexed by held snap
+// and then by gating snap.
+func gatingHolds(st *state.State) (map[string]map[string]*gatingHold, error) {
+	var holds map[string]map[string]*gatingHold
+	err := st.Get("refresh-gating-holds", &holds)
+	if err != nil && err != state.ErrNoState {
+		return nil, err
+	}
+	if holds == nil {
+		holds = make(map[string]map[string]*gatingHold)
+	}
+	return holds, nil
+}
+
+// HoldRefreshesBy holds the automatic refreshes of the given snaps on
+// request of the gating snap, for as long as it is allowed to. A snap
+// can hold the refreshes of another snap for at most maxGatingHold since
+// it first held them; the window only starts over once the held snap is
+// refreshed. Holding its own refreshes is the same as HoldRefreshBySnap.
+func HoldRefreshesBy(st *state.State, gatingSnap string, snaps []string) error {
+	holds, err := gatingHolds(st)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	now := timeNow().UTC()
+	for _, name := range snaps {
+		if name == gatingSnap {
+			if _, err := HoldRefreshBySnap(st, name); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		var snapst SnapState
+		err := Get(st, name, &snapst)
+		if err == state.ErrNoState {
+			err = &snap.NotInstalledError{Snap: name}
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		hold := holds[name][gatingSnap]
+		if hold == nil || hold.Revision != snapst.Current {
+			hold = &gatingHold{Revision: snapst.Current, Since: now}
+		}
+		until := hold.Since.Add(maxGatingHold)
+		if !until.After(now) {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("cannot hold refreshes of snap %q by snap %q any longer: held since %s", name, gatingSnap, hold.Since.Format(time.RFC3339))
+			}
+			continue
+		}
+		hold.Until = until
+		if holds[name] == nil {
+			holds[name] = make(map[string]*gatingHold)
+		}
+		holds[name][gatingSnap] = hold
+	}
+	st.Set("refresh-gating-holds", holds)
+	return firstErr
+}
+
+// ProceedWithRefreshesBy releases the holds the gating snap put on the
+// automatic refreshes of the given snaps.
+func ProceedWithRefreshesBy(st *state.State, gatingSnap string, snaps []string) error {
+	holds, err := gatingHolds(st)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range snaps {
+		if name == gatingSnap {
+			if err := ProceedWithRefresh(st, name); err != nil {
+				return err
+			}
+			continue
+		}
+		// keep Since, so holding again doesn't extend the window
+		if hold := holds[name][gatingSnap]; hold != nil {
+			hold.Until = time.Time{}
+		}
+	}
+	st.Set("refresh-gating-holds", holds)
+	return nil
+}
+
+// heldByGatingSnaps returns the snaps currently holding the automatic
+// refreshes of the given snap at its current revision.
+func heldByGatingSnaps(holds map[string]map[string]*gatingHold, instanceName string, current snap.Revision, now time.Time) []string {
+	var holding []string
+	for gatingSnap, hold := range holds[instanceName] {
+		if hold.Revision == current && hold.Until.After(now) {
+			holding = append(holding, gatingSnap)
+		}
+	}
+	sort.Strings(holding)
+	return holding
+}
+
+// pruneGatingHolds drops the holds of snaps that were refreshed or
+// removed since, and the ones of gating snaps that are gone.
+func pruneGatingHolds(st *state.State, snapStates map[string]*SnapState) error {
+	holds, err := gatingHolds(st)
+	if err != nil {
+		return err
+	}
+	if len(holds) == 0 {
+		return nil
+	}
+
+	for name, byGatingSnap := range holds {
+		snapst := snapStates[name]
+		for gatingSnap, hold := range byGatingSnap {
+			if snapst == nil || hold.Revision != snapst.Current || snapStates[gatingSnap] == nil {
+				delete(byGatingSnap, gatingSnap)
+			}
+		}
+		if len(byGatingSnap) == 0 {
+			delete(holds, name)
+		}
+	}
+	st.Set("refresh-gating-holds", holds)
+	return nil
+}
+
+// contentConn is a connection of a content plug of one snap to a slot
+// of another.
+type contentConn struct {
+	plugSnap string
+	slotSnap string
+}
+
+// contentConns returns the active connections of the content interface.
+func contentConns(st *state.State) ([]contentConn, error) {
+	var conns map[string]*struct {
+		Interface   string `json:"interface"`
+		Undesired   bool   `json:"undesired,omitempty"`
+		HotplugGone bool   `json:"hotplug-gone,omitempty"`
+	}
+	if err := st.Get("conns", &conns); err != nil && err != state.ErrNoState {
+		return nil, err
+	}
+
+	var result []contentConn
+	for id, conn := range conns {
+		if conn.Interface != "content" || conn.Undesired || conn.HotplugGone {
+			continue
+		}
+		connRef, err := interfaces.ParseConnRef(id)
+		if err != nil {
+			return nil, err
+		}
+		if connRef.PlugRef.Snap == connRef.SlotRef.Snap {
+			continue
+		}
+		result = append(result, contentConn{plugSnap: connRef.PlugRef.Snap, slotSnap: connRef.SlotRef.Snap})
+	}
+	return result, nil
+}
+
+// isAffectedBy returns whether the refresh of update affects the snap:
+// it is the snap itself, its base, or a snap providing content to it.
+func isAffectedBy(info, update *snap.Info, conns []contentConn) bool {
+	if update.InstanceName() == info.InstanceName() {
+		return true
+	}
+
+	switch update.GetType() {
+	case snap.TypeBase, snap.TypeOS:
+		if info.GetType() == snap.TypeApp {
+			base := info.Base
+			if base == "" {
+				base = "core"
+			}
+			if update.SnapName() == base {
+				return true
+			}
+		}
+	}
+
+	for _, conn := range conns {
+		if conn.plugSnap == info.InstanceName() && conn.slotSnap == update.InstanceName() {
+			return true
+		}
+	}
+	return false
+}
+
+// affectedByRefresh returns the active snaps with a gate-auto-refresh
+// hook affected by the given updates, each with the sorted names of the
+// snaps affecting it.
+func affectedByRefresh(st *state.State, snapStates map[string]*SnapState, updates []*snap.Info) (map[string][]string, error) {
+	conns, err := contentConns(st)
+	if err != nil {
+		return nil, err
+	}
+
+	affected := make(map[string][]string)
+	for name, snapst := range snapStates {
+		if !snapst.Active {
+			continue
+		}
+		info, err := snapst.CurrentInfo()
+		if err != nil {
+			logger.Noticef("cannot check whether snap %q is affected by auto-refresh: %v", name, err)
+			continue
+		}
+		if info.Hooks["gate-auto-refresh"] == nil {
+			continue
+		}
+
+		var affecting []string
+		for _, update := range updates {
+			if isAffectedBy(info, update, conns) {
+				affecting = append(affecting, update.InstanceName())
+			}
+		}
+		if len(affecting) > 0 {
+			sort.Strings(affecting)
+			affected[name] = affecting
+		}
+	}
+	return affected, nil
+}
+
+// gatedAutoRefresh is AutoRefresh when the gate-auto-refresh hook is
+// enabled. If any snap with the hook is affected by the updates the
+// refreshes are not set up right away: the hooks of the affected snaps
+// are run first, and a conditional-auto-refresh task then refreshes the
+// snaps the hooks didn't hold.
+func gatedAutoRefresh(ctx context.Context, st *state.State, userID int) ([]string, []*state.TaskSet, error) {
+	flags := &Flags{IsAutoRefresh: true}
+	updates, stateByInstanceName, deviceCtx, err := filteredRefreshCandidates(ctx, st, nil, userID, autoRefreshHoldFilter, flags)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	snapStates, err := All(st)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := pruneGatingHolds(st, snapStates); err != nil {
+		return nil, nil, err
+	}
+	affected, err := affectedByRefresh(st, snapStates, updates)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(affected) == 0 {
+		return doUpdate(ctx, st, nil, updates, updateManyParams(stateByInstanceName), userID, flags, deviceCtx, "")
+	}
+
+	names := make([]string, len(updates))
+	for i, update := range updates {
+		names[i] = update.InstanceName()
+	}
+	sort.Strings(names)
+
+	gatingSnaps := make([]string, 0, len(affected))
+	for name := range affected {
+		gatingSnaps = append(gatingSnaps, name)
+	}
+	sort.Strings(gatingSnaps)
+
+	ts := state.NewTaskSet()
+	for _, name := range gatingSnaps {
+		ts.AddTask(SetupGateAutoRefreshHook(st, name, affected[name]))
+	}
+	conditional := st.NewTask("conditional-auto-refresh", i18n.G("Run auto-refresh for ready snaps"))
+	conditional.Set("snaps", names)
+	conditional.WaitAll(ts)
+	ts.AddTask(conditional)
+
+	return names, []*state.TaskSet{ts}, nil
+}
+
+// conditionalAutoRefreshUpdateMany exists just to make testing simpler
+var conditionalAutoRefreshUpdateMany = updateManyFiltered
+
+func (m *SnapManager) doConditionalAutoRefresh(t *state.Task, tomb *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var snaps []string
+	if err := t.Get("snaps", &snaps); err != nil {
+		return err
+	}
+	holds, err := gatingHolds(st)
+	if err != nil {
+		return err
+	}
+
+	now := timeNow()
+	ready := make(map[string]bool, len(snaps))
+	for _, name := range snaps {
+		var snapst SnapState
+		err := Get(st, name, &snapst)
+		if err == state.ErrNoState {
+			// removed in the meantime
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if holding := heldByGatingSnaps(holds, name, snapst.Current, now); len(holding) > 0 {
+			t.Logf("Auto-refresh of snap %q is held by %s.", name, strutil.Quoted(holding))
+			continue
+		}
+		ready[name] = true
+	}
+	if len(ready) == 0 {
+		t.Logf("No snaps to auto-refresh.")
+		return nil
+	}
+
+	// like AutoRefresh do not name the snaps so that a snap that cannot
+	// be refreshed is logged and skipped instead of failing the others
+	filter := func(update *snap.Info, snapst *SnapState) bool {
+		return ready[update.InstanceName()] && autoRefreshHoldFilter(update, snapst)
+	}
+	chg := t.Change()
+	updated, tasksets, err := conditionalAutoRefreshUpdateMany(tomb.Context(nil), st, nil, 0, filter, &Flags{IsAutoRefresh: true}, chg.ID())
+	if err != nil {
+		return err
+	}
+	if len(updated) == 0 {
+		t.Logf("No snaps to auto-refresh.")
+		return nil
+	}
+
+	t.Logf("Auto-refreshing %s.", strutil.Quoted(updated))
+	for _, ts := range tasksets {
+		chg.AddAll(ts)
+	}
+	chg.Set("snap-names", updated)
+	chg.Set("api-data", map[string]interface{}{"snap-names": updated})
+	st.EnsureBefore(0)
+
+	return nil
+}
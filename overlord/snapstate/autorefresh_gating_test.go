@@ -0,0 +1,455 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate_test
+
+import (
+	"context"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/snapstate/snapstatetest"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type autoRefreshGatingSuite struct {
+	testutil.BaseTest
+	state *state.State
+	store *autoRefreshStore
+}
+
+var _ = Suite(&autoRefreshGatingSuite{})
+
+const baseSnapByaml = `name: base-snap-b
+type: base
+version: 1
+`
+
+const snapAyaml = `name: snap-a
+version: 1
+base: base-snap-b
+hooks:
+  gate-auto-refresh:
+`
+
+const snapCyaml = `name: snap-c
+version: 1
+plugs:
+  content:
+    interface: content
+hooks:
+  gate-auto-refresh:
+`
+
+const snapDyaml = `name: snap-d
+version: 1
+slots:
+  content:
+    interface: content
+`
+
+const snapEyaml = `name: snap-e
+version: 1
+base: other-base
+hooks:
+  gate-auto-refresh:
+`
+
+const coreYaml = `name: core
+type: os
+version: 1
+`
+
+func (s *autoRefreshGatingSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("/") })
+
+	s.state = state.New(nil)
+	s.store = &autoRefreshStore{}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	snapstate.ReplaceStore(s.state, s.store)
+
+	for _, yaml := range []string{baseSnapByaml, snapAyaml, snapCyaml, snapDyaml, snapEyaml, coreYaml} {
+		info := snaptest.MockSnap(c, yaml, &snap.SideInfo{Revision: snap.R(1)})
+		name := info.SnapName()
+		si := &snap.SideInfo{RealName: name, Revision: snap.R(1), SnapID: name + "-id"}
+		snapstate.Set(s.state, name, &snapstate.SnapState{
+			Active:   true,
+			Sequence: []*snap.SideInfo{si},
+			Current:  si.Revision,
+			SnapType: string(info.GetType()),
+		})
+	}
+	s.state.Set("conns", map[string]interface{}{
+		"snap-c:content snap-d:content": map[string]interface{}{
+			"interface": "content",
+		},
+	})
+
+	snapstate.CanAutoRefresh = func(*state.State) (bool, error) { return true, nil }
+	s.AddCleanup(func() { snapstate.CanAutoRefresh = nil })
+	snapstate.AutoAliases = func(*state.State, *snap.Info) (map[string]string, error) {
+		return nil, nil
+	}
+	s.AddCleanup(func() { snapstate.AutoAliases = nil })
+	s.state.Set("seeded", true)
+	s.state.Set("seed-time", time.Now())
+	s.state.Set("refresh-privacy-key", "privacy-key")
+	s.AddCleanup(snapstatetest.MockDeviceModel(DefaultModel()))
+}
+
+func mockUpdate(name string, typ snap.Type) *snap.Info {
+	return &snap.Info{
+		SideInfo: snap.SideInfo{RealName: name, SnapID: name + "-id", Revision: snap.R(2)},
+		SnapType: typ,
+	}
+}
+
+func (s *autoRefreshGatingSuite) TestAffectedByBaseAndContentProvider(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	affected, err := snapstate.AffectedByRefresh(s.state, []*snap.Info{
+		mockUpdate("base-snap-b", snap.TypeBase),
+		mockUpdate("snap-d", snap.TypeApp),
+	})
+	c.Assert(err, IsNil)
+	c.Check(affected, DeepEquals, map[string][]string{
+		"snap-a": {"base-snap-b"},
+		"snap-c": {"snap-d"},
+	})
+}
+
+func (s *autoRefreshGatingSuite) TestAffectedByCoreAndSelf(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	affected, err := snapstate.AffectedByRefresh(s.state, []*snap.Info{
+		mockUpdate("core", snap.TypeOS),
+		mockUpdate("snap-a", snap.TypeApp),
+	})
+	c.Assert(err, IsNil)
+	c.Check(affected, DeepEquals, map[string][]string{
+		"snap-a": {"snap-a"},
+		"snap-c": {"core"},
+	})
+}
+
+func (s *autoRefreshGatingSuite) TestAffectedIgnoresUndesiredConnections(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.state.Set("conns", map[string]interface{}{
+		"snap-c:content snap-d:content": map[string]interface{}{
+			"interface": "content",
+			"undesired": true,
+		},
+	})
+
+	affected, err := snapstate.AffectedByRefresh(s.state, []*snap.Info{
+		mockUpdate("snap-d", snap.TypeApp),
+	})
+	c.Assert(err, IsNil)
+	c.Check(affected, HasLen, 0)
+}
+
+func (s *autoRefreshGatingSuite) TestHoldAndProceedRefreshesBy(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	err := snapstate.HoldRefreshesBy(s.state, "snap-c", []string{"snap-d", "core"})
+	c.Assert(err, IsNil)
+	err = snapstate.HoldRefreshesBy(s.state, "snap-a", []string{"snap-d"})
+	c.Assert(err, IsNil)
+
+	held, err := snapstate.HeldByGatingSnaps(s.state, "snap-d")
+	c.Assert(err, IsNil)
+	c.Check(held, DeepEquals, []string{"snap-a", "snap-c"})
+	held, err = snapstate.HeldByGatingSnaps(s.state, "core")
+	c.Assert(err, IsNil)
+	c.Check(held, DeepEquals, []string{"snap-c"})
+
+	err = snapstate.ProceedWithRefreshesBy(s.state, "snap-c", []string{"snap-d", "core"})
+	c.Assert(err, IsNil)
+
+	held, err = snapstate.HeldByGatingSnaps(s.state, "snap-d")
+	c.Assert(err, IsNil)
+	c.Check(held, DeepEquals, []string{"snap-a"})
+	held, err = snapstate.HeldByGatingSnaps(s.state, "core")
+	c.Assert(err, IsNil)
+	c.Check(held, HasLen, 0)
+}
+
+func (s *autoRefreshGatingSuite) TestHoldRefreshesBySelf(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	err := snapstate.HoldRefreshesBy(s.state, "snap-a", []string{"snap-a"})
+	c.Assert(err, IsNil)
+
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, "snap-a", &snapst), IsNil)
+	c.Check(snapst.RefreshHeld(time.Now()), Equals, true)
+
+	err = snapstate.ProceedWithRefreshesBy(s.state, "snap-a", []string{"snap-a"})
+	c.Assert(err, IsNil)
+	c.Assert(snapstate.Get(s.state, "snap-a", &snapst), IsNil)
+	c.Check(snapst.RefreshHeld(time.Now()), Equals, false)
+}
+
+func (s *autoRefreshGatingSuite) TestHoldRefreshesByWindowOver(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.state.Set("refresh-gating-holds", map[string]interface{}{
+		"snap-d": map[string]interface{}{
+			"snap-c": map[string]interface{}{
+				"revision": "1",
+				"since":    time.Now().Add(-8 * 24 * time.Hour),
+			},
+		},
+	})
+
+	err := snapstate.HoldRefreshesBy(s.state, "snap-c", []string{"snap-d", "core"})
+	c.Check(err, ErrorMatches, `cannot hold refreshes of snap "snap-d" by snap "snap-c" any longer: held since .*`)
+
+	// the other holds are still in place
+	held, err := snapstate.HeldByGatingSnaps(s.state, "core")
+	c.Assert(err, IsNil)
+	c.Check(held, DeepEquals, []string{"snap-c"})
+	held, err = snapstate.HeldByGatingSnaps(s.state, "snap-d")
+	c.Assert(err, IsNil)
+	c.Check(held, HasLen, 0)
+}
+
+func (s *autoRefreshGatingSuite) TestHoldDroppedOnceRefreshed(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	err := snapstate.HoldRefreshesBy(s.state, "snap-c", []string{"snap-d"})
+	c.Assert(err, IsNil)
+
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, "snap-d", &snapst), IsNil)
+	si := &snap.SideInfo{RealName: "snap-d", Revision: snap.R(2), SnapID: "snap-d-id"}
+	snapst.Sequence = append(snapst.Sequence, si)
+	snapst.Current = si.Revision
+	snapstate.Set(s.state, "snap-d", &snapst)
+
+	held, err := snapstate.HeldByGatingSnaps(s.state, "snap-d")
+	c.Assert(err, IsNil)
+	c.Check(held, HasLen, 0)
+}
+
+func (s *autoRefreshGatingSuite) TestAutoRefreshRunsGateHooks(c *C) {
+	s.store.updates = []*snap.Info{
+		mockUpdate("base-snap-b", snap.TypeBase),
+	}
+
+	restore := snapstate.MockSetupGateAutoRefreshHook(func(st *state.State, snapName string, affecting []string) *state.Task {
+		t := st.NewTask("run-hook", "")
+		t.Set("snap", snapName)
+		t.Set("affecting", affecting)
+		return t
+	})
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	tr := config.NewTransaction(s.state)
+	tr.Set("core", "experimental.gate-auto-refresh-hook", true)
+	tr.Commit()
+
+	names, tss, err := snapstate.AutoRefresh(auth.EnsureContextTODO(), s.state)
+	c.Assert(err, IsNil)
+	c.Check(names, DeepEquals, []string{"base-snap-b"})
+	c.Assert(tss, HasLen, 1)
+
+	tasks := tss[0].Tasks()
+	c.Assert(tasks, HasLen, 2)
+	hook, conditional := tasks[0], tasks[1]
+	c.Check(hook.Kind(), Equals, "run-hook")
+	var snapName string
+	var affecting []string
+	c.Assert(hook.Get("snap", &snapName), IsNil)
+	c.Assert(hook.Get("affecting", &affecting), IsNil)
+	c.Check(snapName, Equals, "snap-a")
+	c.Check(affecting, DeepEquals, []string{"base-snap-b"})
+
+	c.Check(conditional.Kind(), Equals, "conditional-auto-refresh")
+	c.Check(conditional.WaitTasks(), DeepEquals, []*state.Task{hook})
+	var snaps []string
+	c.Assert(conditional.Get("snaps", &snaps), IsNil)
+	c.Check(snaps, DeepEquals, []string{"base-snap-b"})
+}
+
+func (s *autoRefreshGatingSuite) TestAutoRefreshNothingToGate(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	tr := config.NewTransaction(s.state)
+	tr.Set("core", "experimental.gate-auto-refresh-hook", true)
+	tr.Commit()
+
+	names, tss, err := snapstate.AutoRefresh(auth.EnsureContextTODO(), s.state)
+	c.Assert(err, IsNil)
+	c.Check(names, HasLen, 0)
+	c.Check(tss, HasLen, 0)
+}
+
+type conditionalAutoRefreshSuite struct {
+	baseHandlerSuite
+}
+
+var _ = Suite(&conditionalAutoRefreshSuite{})
+
+func (s *conditionalAutoRefreshSuite) SetUpTest(c *C) {
+	s.baseHandlerSuite.SetUpTest(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	for _, name := range []string{"snap-a", "snap-b", "snap-c"} {
+		si := &snap.SideInfo{RealName: name, Revision: snap.R(1)}
+		snapstate.Set(s.state, name, &snapstate.SnapState{
+			Active:   true,
+			Sequence: []*snap.SideInfo{si},
+			Current:  si.Revision,
+		})
+	}
+}
+
+// mockConditionalRefresh mocks the refresh of all the snaps passing the
+// filter out of snap-a, snap-b and snap-c.
+func mockConditionalRefresh(c *C, chgID *string, refreshed *[]string) (restore func()) {
+	return snapstate.MockConditionalAutoRefreshUpdateMany(func(ctx context.Context, st *state.State, snaps []string, userID int, filter snapstate.UpdateFilter, flags *snapstate.Flags, changeID string) ([]string, []*state.TaskSet, error) {
+		c.Check(changeID, Equals, *chgID)
+		c.Check(flags, DeepEquals, &snapstate.Flags{IsAutoRefresh: true})
+		// all the snaps are considered so that a failing one does
+		// not prevent the others from refreshing
+		c.Check(snaps, IsNil)
+		for _, name := range []string{"snap-a", "snap-b", "snap-c"} {
+			info := &snap.Info{SideInfo: snap.SideInfo{RealName: name}}
+			if filter(info, &snapstate.SnapState{}) {
+				*refreshed = append(*refreshed, name)
+			}
+		}
+		ts := state.NewTaskSet(st.NewTask("fake-refresh", ""))
+		return *refreshed, []*state.TaskSet{ts}, nil
+	})
+}
+
+func (s *conditionalAutoRefreshSuite) TestRefreshesSnapsNotHeld(c *C) {
+	var chgID string
+	var refreshed []string
+	defer mockConditionalRefresh(c, &chgID, &refreshed)()
+
+	s.state.Lock()
+	err := snapstate.HoldRefreshesBy(s.state, "snap-c", []string{"snap-b"})
+	c.Assert(err, IsNil)
+	chg := s.state.NewChange("auto-refresh", "...")
+	task := s.state.NewTask("conditional-auto-refresh", "test")
+	task.Set("snaps", []string{"snap-a", "snap-b"})
+	chg.AddTask(task)
+	chgID = chg.ID()
+	s.state.Unlock()
+
+	s.se.Ensure()
+	s.se.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Check(task.Status(), Equals, state.DoneStatus)
+	c.Check(refreshed, DeepEquals, []string{"snap-a"})
+	c.Check(logstr(task), testutil.Contains, `Auto-refresh of snap "snap-b" is held by "snap-c".`)
+	c.Check(chg.Tasks(), HasLen, 2)
+
+	var snapNames []string
+	c.Assert(chg.Get("snap-names", &snapNames), IsNil)
+	c.Check(snapNames, DeepEquals, []string{"snap-a"})
+}
+
+func (s *conditionalAutoRefreshSuite) TestRefreshesSnapsHoldExpired(c *C) {
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	defer snapstate.MockTimeNow(func() time.Time { return now })()
+
+	var chgID string
+	var refreshed []string
+	defer mockConditionalRefresh(c, &chgID, &refreshed)()
+
+	s.state.Lock()
+	err := snapstate.HoldRefreshesBy(s.state, "snap-c", []string{"snap-b"})
+	c.Assert(err, IsNil)
+	chg := s.state.NewChange("auto-refresh", "...")
+	task := s.state.NewTask("conditional-auto-refresh", "test")
+	task.Set("snaps", []string{"snap-a", "snap-b"})
+	chg.AddTask(task)
+	chgID = chg.ID()
+	s.state.Unlock()
+
+	// the hold is over
+	now = now.Add(7*24*time.Hour + time.Second)
+
+	s.se.Ensure()
+	s.se.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Check(task.Status(), Equals, state.DoneStatus)
+	c.Check(refreshed, DeepEquals, []string{"snap-a", "snap-b"})
+	c.Check(logstr(task), Not(testutil.Contains), `is held by`)
+}
+
+func (s *conditionalAutoRefreshSuite) TestAllHeld(c *C) {
+	defer snapstate.MockConditionalAutoRefreshUpdateMany(func(context.Context, *state.State, []string, int, snapstate.UpdateFilter, *snapstate.Flags, string) ([]string, []*state.TaskSet, error) {
+		c.Fatalf("unexpected refresh")
+		return nil, nil, nil
+	})()
+
+	s.state.Lock()
+	err := snapstate.HoldRefreshesBy(s.state, "snap-c", []string{"snap-a", "snap-b"})
+	c.Assert(err, IsNil)
+	chg := s.state.NewChange("auto-refresh", "...")
+	task := s.state.NewTask("conditional-auto-refresh", "test")
+	task.Set("snaps", []string{"snap-a", "snap-b"})
+	chg.AddTask(task)
+	s.state.Unlock()
+
+	s.se.Ensure()
+	s.se.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Check(task.Status(), Equals, state.DoneStatus)
+	c.Check(logstr(task), testutil.Contains, `No snaps to auto-refresh.`)
+}
@@ -47,7 +47,8 @@ type autoRefreshStore struct {
 
 	ops []string
 
-	err error
+	updates []*snap.Info
+	err     error
 }
 
 func (r *autoRefreshStore) SnapAction(ctx context.Context, currentSnaps []*store.CurrentSnap, actions []*store.SnapAction, user *auth.UserState, opts *store.RefreshOptions) ([]*snap.Info, error) {
@@ -67,7 +68,7 @@ func (r *autoRefreshStore) SnapAction(ctx context.Context, currentSnaps []*store
 		}
 	}
 	r.ops = append(r.ops, "list-refresh")
-	return nil, r.err
+	return r.updates, r.err
 }
 
 type autoRefreshTestSuite struct {
@@ -649,3 +650,165 @@ func (s *autoRefreshTestSuite) TestRefreshOnMeteredConnNotMetered(c *C) {
 	c.Check(err, IsNil)
 	c.Check(s.store.ops, DeepEquals, []string{"list-refresh"})
 }
+
+func (s *autoRefreshTestSuite) TestHoldRefresh(c *C) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	restore := snapstate.MockTimeNow(func() time.Time { return now })
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	holdUntil := now.Add(10 * 24 * time.Hour)
+	held, err := snapstate.HoldRefresh(s.state, "some-snap", holdUntil)
+	c.Assert(err, IsNil)
+	c.Check(held.Equal(holdUntil), Equals, true)
+
+	var snapst snapstate.SnapState
+	err = snapstate.Get(s.state, "some-snap", &snapst)
+	c.Assert(err, IsNil)
+	c.Assert(snapst.RefreshHold, NotNil)
+	c.Check(snapst.RefreshHold.Equal(holdUntil), Equals, true)
+	c.Check(snapst.RefreshHeld(now), Equals, true)
+	c.Check(snapst.RefreshHeld(holdUntil.Add(time.Minute)), Equals, false)
+
+	err = snapstate.UnholdRefresh(s.state, "some-snap")
+	c.Assert(err, IsNil)
+	err = snapstate.Get(s.state, "some-snap", &snapst)
+	c.Assert(err, IsNil)
+	c.Check(snapst.RefreshHold, IsNil)
+	c.Check(snapst.RefreshHeld(now), Equals, false)
+}
+
+func (s *autoRefreshTestSuite) TestHoldRefreshMaximum(c *C) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	restore := snapstate.MockTimeNow(func() time.Time { return now })
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	held, err := snapstate.HoldRefresh(s.state, "some-snap", time.Time{})
+	c.Assert(err, IsNil)
+	c.Check(held.Equal(now.Add(60*24*time.Hour)), Equals, true)
+
+	// the hold expires once the maximum is over
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, "some-snap", &snapst), IsNil)
+	c.Check(snapst.RefreshHeld(now.Add(60*24*time.Hour-time.Second)), Equals, true)
+	c.Check(snapst.RefreshHeld(now.Add(60*24*time.Hour)), Equals, false)
+}
+
+func (s *autoRefreshTestSuite) TestHoldRefreshErrors(c *C) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	restore := snapstate.MockTimeNow(func() time.Time { return now })
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	_, err := snapstate.HoldRefresh(s.state, "some-snap", now)
+	c.Check(err, ErrorMatches, `cannot hold refreshes of snap "some-snap": hold time is in the past`)
+
+	_, err = snapstate.HoldRefresh(s.state, "some-snap", now.Add(60*24*time.Hour+time.Second))
+	c.Check(err, ErrorMatches, `cannot hold refreshes of snap "some-snap" for more than 60 days`)
+
+	_, err = snapstate.HoldRefresh(s.state, "other-snap", now.Add(time.Hour))
+	c.Check(err, ErrorMatches, `snap "other-snap" is not installed`)
+
+	err = snapstate.UnholdRefresh(s.state, "other-snap")
+	c.Check(err, ErrorMatches, `snap "other-snap" is not installed`)
+}
+
+func (s *autoRefreshTestSuite) TestHoldRefreshBySnap(c *C) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	restore := snapstate.MockTimeNow(func() time.Time { return now })
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	held, err := snapstate.HoldRefreshBySnap(s.state, "some-snap")
+	c.Assert(err, IsNil)
+	c.Check(held.Equal(now.Add(7*24*time.Hour)), Equals, true)
+
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, "some-snap", &snapst), IsNil)
+	c.Assert(snapst.RefreshSelfHold, NotNil)
+	since := snapst.RefreshSelfHold.Since
+	c.Check(snapst.RefreshSelfHold.Until.Equal(held), Equals, true)
+	c.Check(snapst.RefreshHeld(now), Equals, true)
+	c.Check(snapst.RefreshHeldUntil().Equal(held), Equals, true)
+	// the user didn't hold anything
+	c.Check(snapst.RefreshHold, IsNil)
+
+	c.Assert(snapstate.ProceedWithRefresh(s.state, "some-snap"), IsNil)
+	c.Assert(snapstate.Get(s.state, "some-snap", &snapst), IsNil)
+	c.Check(snapst.RefreshHeld(now), Equals, false)
+	c.Assert(snapst.RefreshSelfHold, NotNil)
+	c.Check(snapst.RefreshSelfHold.Since.Equal(since), Equals, true)
+
+	// holding again later doesn't extend the window
+	now = now.Add(24 * time.Hour)
+	held2, err := snapstate.HoldRefreshBySnap(s.state, "some-snap")
+	c.Assert(err, IsNil)
+	c.Check(held2.Equal(held), Equals, true)
+}
+
+func (s *autoRefreshTestSuite) TestHoldRefreshBySnapWindowOver(c *C) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	restore := snapstate.MockTimeNow(func() time.Time { return now })
+	defer restore()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, "some-snap", &snapst), IsNil)
+	snapst.RefreshSelfHold = &snapstate.RefreshSelfHold{Since: now.Add(-7 * 24 * time.Hour)}
+	snapstate.Set(s.state, "some-snap", &snapst)
+
+	_, err := snapstate.HoldRefreshBySnap(s.state, "some-snap")
+	c.Check(err, ErrorMatches, `cannot hold refreshes of snap "some-snap" any longer: held since .*`)
+
+	_, err = snapstate.HoldRefreshBySnap(s.state, "other-snap")
+	c.Check(err, ErrorMatches, `snap "other-snap" is not installed`)
+	err = snapstate.ProceedWithRefresh(s.state, "other-snap")
+	c.Check(err, ErrorMatches, `snap "other-snap" is not installed`)
+}
+
+func (s *autoRefreshTestSuite) TestSelfHeldAutoRefreshPending(c *C) {
+	s.store.updates = []*snap.Info{{
+		SideInfo: snap.SideInfo{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(8), Channel: "latest/stable"},
+		Version:  "2.0",
+	}}
+
+	s.state.Lock()
+	_, err := snapstate.HoldRefreshBySnap(s.state, "some-snap")
+	c.Assert(err, IsNil)
+	cand, err := snapstate.PendingRefresh(s.state, "some-snap")
+	c.Assert(err, IsNil)
+	c.Check(cand, IsNil)
+	s.state.Unlock()
+
+	af := snapstate.NewAutoRefresh(s.state)
+	err = af.Ensure()
+	c.Check(err, IsNil)
+	c.Check(s.store.ops, DeepEquals, []string{"list-refresh"})
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	// the refresh was held
+	c.Check(s.state.Changes(), HasLen, 0)
+
+	cand, err = snapstate.PendingRefresh(s.state, "some-snap")
+	c.Assert(err, IsNil)
+	c.Check(cand, DeepEquals, &snapstate.RefreshCandidate{
+		Channel:  "latest/stable",
+		Version:  "2.0",
+		Revision: snap.R(8),
+	})
+
+	_, err = snapstate.PendingRefresh(s.state, "other-snap")
+	c.Check(err, ErrorMatches, `snap "other-snap" is not installed`)
+}
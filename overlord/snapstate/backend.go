@@ -49,6 +49,7 @@ type StoreService interface {
 	DownloadStream(context.Context, string, *snap.DownloadInfo, *auth.UserState) (io.ReadCloser, error)
 
 	Assertion(assertType *asserts.AssertionType, primaryKey []string, user *auth.UserState) (asserts.Assertion, error)
+	SeqFormingAssertion(assertType *asserts.AssertionType, sequenceKey []string, sequence int, user *auth.UserState) (asserts.Assertion, error)
 
 	SuggestedCurrency() string
 	Buy(options *client.BuyOptions, user *auth.UserState) (*client.BuyResult, error)
@@ -23,6 +23,7 @@ import (
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/progress"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snapdenv"
 	"github.com/snapcore/snapd/systemd"
 )
 
@@ -30,7 +31,12 @@ func addMountUnit(s *snap.Info, meter progress.Meter) error {
 	squashfsPath := dirs.StripRootDir(s.MountFile())
 	whereDir := dirs.StripRootDir(s.MountDir())
 
-	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, meter)
+	var sysd systemd.Systemd
+	if snapdenv.Preseeding() {
+		sysd = systemd.NewEmulationMode(dirs.GlobalRootDir)
+	} else {
+		sysd = systemd.New(dirs.GlobalRootDir, systemd.SystemMode, meter)
+	}
 	_, err := sysd.AddMountUnitFile(s.InstanceName(), s.Revision.String(), squashfsPath, whereDir, "squashfs")
 	return err
 }
@@ -32,6 +32,7 @@ import (
 	"github.com/snapcore/snapd/overlord/snapstate/backend"
 	"github.com/snapcore/snapd/progress"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snapdenv"
 	"github.com/snapcore/snapd/systemd"
 	"github.com/snapcore/snapd/testutil"
 )
@@ -96,6 +97,43 @@ WantedBy=multi-user.target
 `[1:], dirs.StripRootDir(dirs.SnapMountDir)))
 }
 
+func (s *mountunitSuite) TestAddMountUnitPreseeding(c *C) {
+	restore := squashfs.MockNeedsFuse(false)
+	defer restore()
+	restore = snapdenv.MockPreseeding(true)
+	defer restore()
+	var sysctlArgs [][]string
+	restore = systemd.MockSystemctl(func(cmd ...string) ([]byte, error) {
+		sysctlArgs = append(sysctlArgs, cmd)
+		return nil, nil
+	})
+	defer restore()
+	mockMount := testutil.MockCommand(c, "mount", "")
+	defer mockMount.Restore()
+
+	info := &snap.Info{
+		SideInfo: snap.SideInfo{
+			RealName: "foo",
+			Revision: snap.R(13),
+		},
+		Version:       "1.1",
+		Architectures: []string{"all"},
+	}
+	err := backend.AddMountUnit(info, progress.Null)
+	c.Assert(err, IsNil)
+
+	// the snap is mounted directly and the unit enabled offline
+	where := filepath.Join(dirs.StripRootDir(dirs.SnapMountDir), "foo", "13")
+	un := fmt.Sprintf("%s.mount", systemd.EscapeUnitNamePath(where))
+	c.Check(filepath.Join(dirs.SnapServicesDir, un), testutil.FilePresent)
+	c.Check(mockMount.Calls(), DeepEquals, [][]string{
+		{"mount", "-t", "squashfs", filepath.Join(dirs.GlobalRootDir, "/var/lib/snapd/snaps/foo_13.snap"), filepath.Join(dirs.GlobalRootDir, where), "-o", "nodev,ro,x-gdu.hide"},
+	})
+	c.Check(sysctlArgs, DeepEquals, [][]string{
+		{"--root", dirs.GlobalRootDir, "enable", un},
+	})
+}
+
 func (s *mountunitSuite) TestRemoveMountUnit(c *C) {
 	info := &snap.Info{
 		SideInfo: snap.SideInfo{
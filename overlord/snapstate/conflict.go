@@ -35,6 +35,8 @@ var FinalTasks = []string{"mark-seeded", "set-model"}
 type ChangeConflictError struct {
 	Snap       string
 	ChangeKind string
+	// ChangeID is the id of the conflicting change, if known
+	ChangeID string
 	// a Message is optional, otherwise one is composed from the other information
 	Message string
 }
@@ -97,6 +99,44 @@ func affectedSnaps(t *state.Task) ([]string, error) {
 // It's like CheckChangeConflict, but for multiple snaps, and does not
 // check snapst.
 func CheckChangeConflictMany(st *state.State, instanceNames []string, ignoreChangeID string) error {
+	var conflict *ChangeConflictError
+	err := findChangeConflicts(st, instanceNames, ignoreChangeID, func(c *ChangeConflictError) bool {
+		conflict = c
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	if conflict != nil {
+		return conflict
+	}
+	return nil
+}
+
+// ChangeConflicts returns all the conflicts of the changes in progress
+// with changes to the given snaps, one per snap and conflicting change,
+// where CheckChangeConflictMany returns only the first one.
+func ChangeConflicts(st *state.State, instanceNames []string) ([]*ChangeConflictError, error) {
+	var conflicts []*ChangeConflictError
+	seen := make(map[[2]string]bool)
+	err := findChangeConflicts(st, instanceNames, "", func(c *ChangeConflictError) bool {
+		k := [2]string{c.Snap, c.ChangeID}
+		if !seen[k] {
+			seen[k] = true
+			conflicts = append(conflicts, c)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conflicts, nil
+}
+
+// findChangeConflicts calls found with the conflicts of the changes in
+// progress with changes to the given snaps, for as long as it returns
+// true.
+func findChangeConflicts(st *state.State, instanceNames []string, ignoreChangeID string, found func(*ChangeConflictError) bool) error {
 	snapMap := make(map[string]bool, len(instanceNames))
 	for _, k := range instanceNames {
 		snapMap[k] = true
@@ -106,17 +146,20 @@ func CheckChangeConflictMany(st *state.State, instanceNames []string, ignoreChan
 		if chg.Status().Ready() {
 			continue
 		}
-		if chg.Kind() == "transition-ubuntu-core" {
-			return &ChangeConflictError{Message: "ubuntu-core to core transition in progress, no other changes allowed until this is done", ChangeKind: "transition-ubuntu-core"}
-		}
-		if chg.Kind() == "transition-to-snapd-snap" {
-			return &ChangeConflictError{Message: "transition to snapd snap in progress, no other changes allowed until this is done", ChangeKind: "transition-to-snapd-snap"}
-		}
-		if chg.Kind() == "remodel" {
+		var conflict *ChangeConflictError
+		switch chg.Kind() {
+		case "transition-ubuntu-core":
+			conflict = &ChangeConflictError{Message: "ubuntu-core to core transition in progress, no other changes allowed until this is done", ChangeKind: "transition-ubuntu-core", ChangeID: chg.ID()}
+		case "transition-to-snapd-snap":
+			conflict = &ChangeConflictError{Message: "transition to snapd snap in progress, no other changes allowed until this is done", ChangeKind: "transition-to-snapd-snap", ChangeID: chg.ID()}
+		case "remodel":
 			if ignoreChangeID != "" && chg.ID() == ignoreChangeID {
 				continue
 			}
-			return &ChangeConflictError{Message: "remodeling in progress, no other changes allowed until this is done", ChangeKind: "remodel"}
+			conflict = &ChangeConflictError{Message: "remodeling in progress, no other changes allowed until this is done", ChangeKind: "remodel", ChangeID: chg.ID()}
+		}
+		if conflict != nil && !found(conflict) {
+			return nil
 		}
 	}
 
@@ -144,7 +187,9 @@ func CheckChangeConflictMany(st *state.State, instanceNames []string, ignoreChan
 
 		for _, snap := range snaps {
 			if snapMap[snap] {
-				return &ChangeConflictError{Snap: snap, ChangeKind: chg.Kind()}
+				if !found(&ChangeConflictError{Snap: snap, ChangeKind: chg.Kind(), ChangeID: chg.ID()}) {
+					return nil
+				}
 			}
 		}
 	}
@@ -150,6 +150,14 @@ func MockRefreshRetryDelay(d time.Duration) func() {
 	}
 }
 
+func MockTimeNow(f func() time.Time) func() {
+	old := timeNow
+	timeNow = f
+	return func() {
+		timeNow = old
+	}
+}
+
 func MockIsOnMeteredConnection(mock func() (bool, error)) func() {
 	old := IsOnMeteredConnection
 	IsOnMeteredConnection = mock
@@ -190,6 +198,44 @@ func MockReRefreshUpdateMany(f func(context.Context, *state.State, []string, int
 	}
 }
 
+func MockConditionalAutoRefreshUpdateMany(f func(context.Context, *state.State, []string, int, UpdateFilter, *Flags, string) ([]string, []*state.TaskSet, error)) (restore func()) {
+	old := conditionalAutoRefreshUpdateMany
+	conditionalAutoRefreshUpdateMany = f
+	return func() {
+		conditionalAutoRefreshUpdateMany = old
+	}
+}
+
+func MockSetupGateAutoRefreshHook(f func(st *state.State, snapName string, affectingSnaps []string) *state.Task) (restore func()) {
+	old := SetupGateAutoRefreshHook
+	SetupGateAutoRefreshHook = f
+	return func() {
+		SetupGateAutoRefreshHook = old
+	}
+}
+
+func AffectedByRefresh(st *state.State, updates []*snap.Info) (map[string][]string, error) {
+	snapStates, err := All(st)
+	if err != nil {
+		return nil, err
+	}
+	return affectedByRefresh(st, snapStates, updates)
+}
+
+// HeldByGatingSnaps returns the snaps holding the refreshes of the given
+// snap right now.
+func HeldByGatingSnaps(st *state.State, instanceName string) ([]string, error) {
+	holds, err := gatingHolds(st)
+	if err != nil {
+		return nil, err
+	}
+	var snapst SnapState
+	if err := Get(st, instanceName, &snapst); err != nil {
+		return nil, err
+	}
+	return heldByGatingSnaps(holds, instanceName, snapst.Current, timeNow()), nil
+}
+
 func MockReRefreshRetryTimeout(d time.Duration) (restore func()) {
 	old := reRefreshRetryTimeout
 	reRefreshRetryTimeout = d
@@ -68,6 +68,11 @@ type Flags struct {
 
 	// RequireTypeBase is set to mark that a snap needs to be of type: base, otherwise installation fails.
 	RequireTypeBase bool `json:"require-base-type,omitempty"`
+
+	// Planning is set when the task sets are only built to describe
+	// the change they would make, in which case the state must not
+	// be otherwise modified.
+	Planning bool `json:"planning,omitempty"`
 }
 
 // DevModeAllowed returns whether a snap can be installed with devmode confinement (either set or overridden)
@@ -80,5 +85,6 @@ func (f Flags) ForSnapSetup() Flags {
 	f.SkipConfigure = false
 	f.NoReRefresh = false
 	f.RequireTypeBase = false
+	f.Planning = false
 	return f
 }
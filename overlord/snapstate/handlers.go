@@ -44,6 +44,7 @@ import (
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snapdenv"
 	"github.com/snapcore/snapd/store"
 	"github.com/snapcore/snapd/strutil"
 	"github.com/snapcore/snapd/timings"
@@ -1058,6 +1059,7 @@ func (m *SnapManager) doLinkSnap(t *state.Task, _ *tomb.Tomb) (err error) {
 		snapst.Required = true
 	}
 	oldRefreshInhibitedTime := snapst.RefreshInhibitedTime
+	oldRefreshSelfHold := snapst.RefreshSelfHold
 	// only set userID if unset or logged out in snapst and if we
 	// actually have an associated user
 	if snapsup.UserID > 0 {
@@ -1130,14 +1132,22 @@ func (m *SnapManager) doLinkSnap(t *state.Task, _ *tomb.Tomb) (err error) {
 	t.Set("old-current", oldCurrent)
 	t.Set("old-candidate-index", oldCandidateIndex)
 	t.Set("old-refresh-inhibited-time", oldRefreshInhibitedTime)
+	t.Set("old-refresh-self-hold", oldRefreshSelfHold)
 	t.Set("old-cohort-key", oldCohortKey)
 
 	// Record the fact that the snap was refreshed successfully.
 	snapst.RefreshInhibitedTime = nil
+	snapst.RefreshSelfHold = nil
 
 	// Do at the end so we only preserve the new state if it worked.
 	Set(st, snapsup.InstanceName(), snapst)
 
+	if !isInstalled {
+		st.AddNotice(state.SnapInstalledNotice, snapsup.InstanceName(), map[string]string{
+			"revision": cand.Revision.String(),
+		})
+	}
+
 	if cand.SnapID != "" {
 		// write the auxiliary store info
 		aux := &auxStoreInfo{
@@ -1201,6 +1211,12 @@ func (m *SnapManager) doLinkSnap(t *state.Task, _ *tomb.Tomb) (err error) {
 // maybeRestart will schedule a reboot or restart as needed for the
 // just linked snap with info if it's a core or snapd or kernel snap.
 func maybeRestart(t *state.Task, info *snap.Info) {
+	if snapdenv.Preseeding() {
+		// nothing is running from the snaps while preseeding, on
+		// first boot snapd is started from the linked snaps
+		return
+	}
+
 	st := t.State()
 
 	model, err := ModelFromTask(t)
@@ -1308,6 +1324,10 @@ func (m *SnapManager) undoLinkSnap(t *state.Task, _ *tomb.Tomb) error {
 	if err := t.Get("old-refresh-inhibited-time", &oldRefreshInhibitedTime); err != nil && err != state.ErrNoState {
 		return err
 	}
+	var oldRefreshSelfHold *RefreshSelfHold
+	if err := t.Get("old-refresh-self-hold", &oldRefreshSelfHold); err != nil && err != state.ErrNoState {
+		return err
+	}
 	var oldCohortKey string
 	if err := t.Get("old-cohort-key", &oldCohortKey); err != nil && err != state.ErrNoState {
 		return err
@@ -1355,6 +1375,7 @@ func (m *SnapManager) undoLinkSnap(t *state.Task, _ *tomb.Tomb) error {
 	snapst.JailMode = oldJailMode
 	snapst.Classic = oldClassic
 	snapst.RefreshInhibitedTime = oldRefreshInhibitedTime
+	snapst.RefreshSelfHold = oldRefreshSelfHold
 	snapst.CohortKey = oldCohortKey
 
 	newInfo, err := readInfo(snapsup.InstanceName(), snapsup.SideInfo, 0)
@@ -1482,6 +1503,12 @@ func (m *SnapManager) startSnapServices(t *state.Task, _ *tomb.Tomb) error {
 		return err
 	}
 
+	if EnsureSnapServicesQuota != nil {
+		if err := EnsureSnapServicesQuota(st, currentInfo); err != nil {
+			return err
+		}
+	}
+
 	pb := NewTaskProgressAdapterUnlocked(t)
 	st.Unlock()
 	err = m.backend.StartServices(startupOrdered, pb, perfTimings)
@@ -1642,6 +1669,11 @@ func (m *SnapManager) doDiscardSnap(t *state.Task, _ *tomb.Tomb) error {
 		if err != nil {
 			return err
 		}
+		if RemoveSnapFromQuota != nil {
+			if err := RemoveSnapFromQuota(st, snapsup.InstanceName()); err != nil {
+				return err
+			}
+		}
 		err = m.backend.DiscardSnapNamespace(snapsup.InstanceName())
 		if err != nil {
 			t.Errorf("cannot discard snap namespace %q, will retry in 3 mins: %s", snapsup.InstanceName(), err)
@@ -1666,6 +1698,8 @@ func (m *SnapManager) doDiscardSnap(t *state.Task, _ *tomb.Tomb) error {
 		}
 
 		// XXX: also remove sequence files?
+
+		st.AddNotice(state.SnapRemovedNotice, snapsup.InstanceName(), nil)
 	}
 	if err = config.DiscardRevisionConfig(st, snapsup.InstanceName(), snapsup.Revision()); err != nil {
 		return err
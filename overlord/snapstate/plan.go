@@ -0,0 +1,117 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+type collectedInfosKey struct{}
+
+// CollectSnapInfos makes Install, InstallPath, InstallMany, Update and
+// UpdateMany collect, until the returned function is called, the infos
+// of the snap revisions the task sets they build would install, by
+// instance name. It is used to look at what a change would do without
+// making it.
+func CollectSnapInfos(st *state.State) (infos map[string]*snap.Info, stop func()) {
+	infos = make(map[string]*snap.Info)
+	st.Cache(collectedInfosKey{}, infos)
+	return infos, func() {
+		st.Cache(collectedInfosKey{}, nil)
+	}
+}
+
+func collectSnapInfo(st *state.State, info *snap.Info) {
+	if infos, ok := st.Cached(collectedInfosKey{}).(map[string]*snap.Info); ok {
+		infos[info.InstanceName()] = info
+	}
+}
+
+// PlannedPrerequisites returns the names of the snaps that are not
+// installed, nor being installed by a change in progress, and that the
+// prerequisites task of the given snap setup would install: the
+// default providers of its content plugs, its base and, if needed,
+// the snapd snap.
+func PlannedPrerequisites(st *state.State, snapsup *SnapSetup) ([]string, error) {
+	switch snapsup.Type {
+	case snap.TypeOS, snap.TypeBase, snap.TypeKernel, snap.TypeGadget, snap.TypeSnapd:
+		return nil, nil
+	}
+
+	base := defaultCoreSnapName
+	if snapsup.Base != "" {
+		base = snapsup.Base
+	}
+
+	var prereqs []string
+	wanted := func(snapName string) error {
+		if snapName == "core16" {
+			// the core snap provides everything needed for core16
+			coreInstalled, err := isInstalled(st, "core")
+			if err != nil || coreInstalled {
+				return err
+			}
+		}
+		installed, err := isInstalled(st, snapName)
+		if err != nil || installed {
+			return err
+		}
+		inFlight, err := linkSnapInFlight(st, snapName)
+		if err != nil || inFlight {
+			return err
+		}
+		for _, prereq := range prereqs {
+			if prereq == snapName {
+				return nil
+			}
+		}
+		prereqs = append(prereqs, snapName)
+		return nil
+	}
+
+	for _, prereq := range snapsup.Prereq {
+		if err := wanted(prereq); err != nil {
+			return nil, err
+		}
+	}
+	if base != "none" {
+		if err := wanted(base); err != nil {
+			return nil, err
+		}
+	}
+
+	// see installPrereqs
+	snapdSnapInstalled, err := isInstalled(st, "snapd")
+	if err != nil {
+		return nil, err
+	}
+	coreSnapInstalled, err := isInstalled(st, "core")
+	if err != nil {
+		return nil, err
+	}
+	if base != "core" && !snapdSnapInstalled && !coreSnapInstalled {
+		if err := wanted("snapd"); err != nil {
+			return nil, err
+		}
+	}
+
+	return prereqs, nil
+}
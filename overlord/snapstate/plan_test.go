@@ -0,0 +1,108 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate_test
+
+import (
+	"context"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/snap"
+)
+
+func (s *snapmgrTestSuite) TestCollectSnapInfos(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(1)}},
+		Current:  snap.R(1),
+		SnapType: "app",
+	})
+
+	infos, stop := snapstate.CollectSnapInfos(s.state)
+
+	_, err := snapstate.Install(context.Background(), s.state, "some-other-snap", nil, 0, snapstate.Flags{})
+	c.Assert(err, IsNil)
+	_, _, err = snapstate.UpdateMany(context.Background(), s.state, []string{"some-snap"}, 0, nil)
+	c.Assert(err, IsNil)
+
+	stop()
+
+	_, err = snapstate.Install(context.Background(), s.state, "snap-with-snapd-control", nil, 0, snapstate.Flags{})
+	c.Assert(err, IsNil)
+
+	c.Assert(infos, HasLen, 2)
+	c.Check(infos["some-other-snap"].Revision, Equals, snap.R(11))
+	c.Check(infos["some-snap"].Revision, Equals, snap.R(11))
+}
+
+func (s *snapmgrTestSuite) TestPlannedPrerequisites(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-base", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "some-base", Revision: snap.R(1)}},
+		Current:  snap.R(1),
+		SnapType: "base",
+	})
+
+	// a base being installed by a change in progress is not planned
+	chg := s.state.NewChange("install", "...")
+	t := s.state.NewTask("link-snap", "...")
+	t.Set("snap-setup", &snapstate.SnapSetup{SideInfo: &snap.SideInfo{RealName: "other-base"}})
+	chg.AddTask(t)
+
+	for _, t := range []struct {
+		snapsup *snapstate.SnapSetup
+		prereqs []string
+	}{
+		{&snapstate.SnapSetup{Type: snap.TypeApp}, nil},
+		{&snapstate.SnapSetup{Type: snap.TypeApp, Base: "some-base"}, nil},
+		{&snapstate.SnapSetup{Type: snap.TypeApp, Base: "other-base"}, nil},
+		{&snapstate.SnapSetup{Type: snap.TypeApp, Base: "core18"}, []string{"core18"}},
+		{&snapstate.SnapSetup{Type: snap.TypeApp, Base: "core16"}, nil},
+		{&snapstate.SnapSetup{Type: snap.TypeApp, Base: "none", Prereq: []string{"content-provider", "some-base", "content-provider"}}, []string{"content-provider"}},
+		{&snapstate.SnapSetup{Type: snap.TypeBase, Base: "core18"}, nil},
+		{&snapstate.SnapSetup{Type: snap.TypeGadget, Base: "core18"}, nil},
+	} {
+		prereqs, err := snapstate.PlannedPrerequisites(s.state, t.snapsup)
+		c.Assert(err, IsNil)
+		c.Check(prereqs, DeepEquals, t.prereqs, Commentf("%+v", t.snapsup))
+	}
+}
+
+func (s *snapmgrTestSuite) TestPlannedPrerequisitesSnapd(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "core", nil)
+
+	prereqs, err := snapstate.PlannedPrerequisites(s.state, &snapstate.SnapSetup{Type: snap.TypeApp, Base: "core18"})
+	c.Assert(err, IsNil)
+	c.Check(prereqs, DeepEquals, []string{"core18", "snapd"})
+
+	prereqs, err = snapstate.PlannedPrerequisites(s.state, &snapstate.SnapSetup{Type: snap.TypeApp})
+	c.Assert(err, IsNil)
+	c.Check(prereqs, DeepEquals, []string{"core"})
+}
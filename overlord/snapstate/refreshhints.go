@@ -25,6 +25,7 @@ import (
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/store"
 	"github.com/snapcore/snapd/timings"
 )
@@ -72,7 +73,7 @@ func (r *refreshHints) refresh() error {
 	defer perfTimings.Save(r.state)
 
 	timings.Run(perfTimings, "refresh-candidates", "query store for refresh candidates", func(tm timings.Measurer) {
-		_, _, _, err = refreshCandidates(auth.EnsureContextTODO(), r.state, nil, nil, &store.RefreshOptions{RefreshManaged: refreshManaged})
+		_, _, _, err = refreshCandidates(auth.EnsureContextTODO(), r.state, nil, nil, &store.RefreshOptions{RefreshManaged: refreshManaged}, false)
 	})
 	// TODO: we currently set last-refresh-hints even when there was an
 	// error. In the future we may retry with a backoff.
@@ -121,3 +122,53 @@ func (r *refreshHints) Ensure() error {
 	}
 	return r.refresh()
 }
+
+// RefreshCandidate describes an update of a snap found by the last
+// check for refreshes of all the snaps.
+type RefreshCandidate struct {
+	Channel  string        `json:"channel,omitempty"`
+	Version  string        `json:"version,omitempty"`
+	Revision snap.Revision `json:"revision"`
+}
+
+// recordRefreshCandidates remembers the updates found by a check for
+// refreshes of all the snaps, replacing the ones of the previous check.
+func recordRefreshCandidates(st *state.State, updates []*snap.Info, stateByInstanceName map[string]*SnapState) {
+	candidates := make(map[string]*RefreshCandidate, len(updates))
+	for _, update := range updates {
+		channel := update.Channel
+		if snapst := stateByInstanceName[update.InstanceName()]; channel == "" && snapst != nil {
+			channel = snapst.Channel
+		}
+		candidates[update.InstanceName()] = &RefreshCandidate{
+			Channel:  channel,
+			Version:  update.Version,
+			Revision: update.Revision,
+		}
+	}
+	st.Set("refresh-candidates", candidates)
+}
+
+// PendingRefresh returns the update of the given snap found by the last
+// check for refreshes, or nil if there is none the snap doesn't already
+// have.
+func PendingRefresh(st *state.State, instanceName string) (*RefreshCandidate, error) {
+	var snapst SnapState
+	err := Get(st, instanceName, &snapst)
+	if err == state.ErrNoState {
+		return nil, &snap.NotInstalledError{Snap: instanceName}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates map[string]*RefreshCandidate
+	if err := st.Get("refresh-candidates", &candidates); err != nil && err != state.ErrNoState {
+		return nil, err
+	}
+	cand := candidates[instanceName]
+	if cand == nil || cand.Revision == snapst.Current {
+		return nil, nil
+	}
+	return cand, nil
+}
@@ -153,6 +153,27 @@ type SnapState struct {
 	// attempted but inhibited because the snap was busy. This value is
 	// reset on each successful refresh.
 	RefreshInhibitedTime *time.Time `json:"refresh-inhibited-time,omitempty"`
+
+	// RefreshHold records the time until which automatic refreshes
+	// of the snap were held back by the user. Manual refreshes are
+	// not affected.
+	RefreshHold *time.Time `json:"refresh-hold,omitempty"`
+
+	// RefreshSelfHold records the holding of automatic refreshes of
+	// the snap by the snap itself, through snapctl. It is reset on
+	// each successful refresh.
+	RefreshSelfHold *RefreshSelfHold `json:"refresh-self-hold,omitempty"`
+}
+
+// RefreshSelfHold describes the holding of automatic refreshes of a
+// snap by the snap itself.
+type RefreshSelfHold struct {
+	// Since is when the snap first held its refreshes, it bounds for
+	// how long the snap can keep holding them.
+	Since time.Time `json:"since"`
+	// Until is the time until which the refreshes are held, it is
+	// zero if the snap let them proceed.
+	Until time.Time `json:"until"`
 }
 
 // Type returns the type of the snap or an error.
@@ -181,6 +202,26 @@ func (snapst *SnapState) IsInstalled() bool {
 	return true
 }
 
+// RefreshHeld returns whether automatic refreshes of the snap are
+// held at the given time, either by the user or by the snap itself.
+func (snapst *SnapState) RefreshHeld(now time.Time) bool {
+	return snapst.RefreshHeldUntil().After(now)
+}
+
+// RefreshHeldUntil returns the time until which automatic refreshes of
+// the snap are held, either by the user or by the snap itself, or the
+// zero time if they never were.
+func (snapst *SnapState) RefreshHeldUntil() time.Time {
+	var until time.Time
+	if snapst.RefreshHold != nil {
+		until = *snapst.RefreshHold
+	}
+	if snapst.RefreshSelfHold != nil && snapst.RefreshSelfHold.Until.After(until) {
+		until = snapst.RefreshSelfHold.Until
+	}
+	return until
+}
+
 // LocalRevision returns the "latest" local revision. Local revisions
 // start at -1 and are counted down.
 func (snapst *SnapState) LocalRevision() snap.Revision {
@@ -399,6 +440,7 @@ func Manager(st *state.State, runner *state.TaskRunner) (*SnapManager, error) {
 	runner.AddHandler("switch-snap-channel", m.doSwitchSnapChannel, nil)
 	runner.AddHandler("toggle-snap-flags", m.doToggleSnapFlags, nil)
 	runner.AddHandler("check-rerefresh", m.doCheckReRefresh, nil)
+	runner.AddHandler("conditional-auto-refresh", m.doConditionalAutoRefresh, nil)
 
 	// FIXME: drop the task entirely after a while
 	// (having this wart here avoids yet-another-patch)
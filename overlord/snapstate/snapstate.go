@@ -31,6 +31,7 @@ import (
 	"time"
 
 	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/snapasserts"
 	"github.com/snapcore/snapd/boot"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/features"
@@ -63,6 +64,9 @@ const (
 )
 
 const (
+	BeginEdge                 = state.TaskSetEdge("begin")
+	BeforeHooksEdge           = state.TaskSetEdge("before-hooks")
+	HooksEdge                 = state.TaskSetEdge("hooks")
 	DownloadAndChecksDoneEdge = state.TaskSetEdge("download-and-checks-done")
 )
 
@@ -261,8 +265,9 @@ func doInstall(st *state.State, snapst *SnapState, snapsup *SnapSetup, flags int
 	}
 
 	// only run install hook if installing the snap for the first time
+	var installHook *state.Task
 	if !snapst.IsInstalled() {
-		installHook := SetupInstallHook(st, snapsup.InstanceName())
+		installHook = SetupInstallHook(st, snapsup.InstanceName())
 		addTask(installHook)
 		prev = installHook
 	}
@@ -332,7 +337,14 @@ func doInstall(st *state.State, snapst *SnapState, snapsup *SnapSetup, flags int
 
 	installSet := state.NewTaskSet(tasks...)
 	installSet.WaitAll(ts)
-	ts.AddAll(installSet)
+	installSet.MarkEdge(prereq, BeginEdge)
+	installSet.MarkEdge(setupAliases, BeforeHooksEdge)
+	if installHook != nil {
+		installSet.MarkEdge(installHook, HooksEdge)
+	}
+	if err := ts.AddAllWithEdges(installSet); err != nil {
+		return nil, err
+	}
 	if checkAsserts != nil {
 		ts.MarkEdge(checkAsserts, DownloadAndChecksDoneEdge)
 	}
@@ -394,6 +406,10 @@ var SetupRemoveHook = func(st *state.State, snapName string) *state.Task {
 	panic("internal error: snapstate.SetupRemoveHook is unset")
 }
 
+var SetupGateAutoRefreshHook = func(st *state.State, snapName string, affectingSnaps []string) *state.Task {
+	panic("internal error: snapstate.SetupGateAutoRefreshHook is unset")
+}
+
 var CheckHealthHook = func(st *state.State, snapName string, rev snap.Revision) *state.Task {
 	panic("internal error: snapstate.CheckHealthHook is unset")
 }
@@ -652,6 +668,9 @@ func InstallPath(st *state.State, si *snap.SideInfo, path, instanceName, channel
 	}
 
 	ts, err := doInstall(st, &snapst, snapsup, instFlags, "")
+	if err == nil {
+		collectSnapInfo(st, info)
+	}
 	return ts, info, err
 }
 
@@ -725,6 +744,12 @@ func InstallWithDeviceContext(ctx context.Context, st *state.State, name string,
 		return nil, err
 	}
 
+	if !flags.IgnoreValidation {
+		if err := checkValidationSets(st, info, "install"); err != nil {
+			return nil, err
+		}
+	}
+
 	snapsup := &SnapSetup{
 		Channel:      opts.Channel,
 		Base:         info.Base,
@@ -743,7 +768,12 @@ func InstallWithDeviceContext(ctx context.Context, st *state.State, name string,
 		CohortKey: opts.CohortKey,
 	}
 
-	return doInstall(st, &snapst, snapsup, 0, fromChange)
+	ts, err := doInstall(st, &snapst, snapsup, 0, fromChange)
+	if err != nil {
+		return nil, err
+	}
+	collectSnapInfo(st, info)
+	return ts, nil
 }
 
 // InstallMany installs everything from the given list of names.
@@ -792,6 +822,10 @@ func InstallMany(st *state.State, names []string, userID int) ([]string, []*stat
 			return nil, nil, err
 		}
 
+		if err := checkValidationSets(st, info, "install"); err != nil {
+			return nil, nil, err
+		}
+
 		snapsup := &SnapSetup{
 			Channel:      "stable",
 			Base:         info.Base,
@@ -809,6 +843,7 @@ func InstallMany(st *state.State, names []string, userID int) ([]string, []*stat
 		if err != nil {
 			return nil, nil, err
 		}
+		collectSnapInfo(st, info)
 		ts.JoinLane(st.NewLane())
 		tasksets = append(tasksets, ts)
 	}
@@ -819,13 +854,67 @@ func InstallMany(st *state.State, names []string, userID int) ([]string, []*stat
 // RefreshCandidates gets a list of candidates for update
 // Note that the state must be locked by the caller.
 func RefreshCandidates(st *state.State, user *auth.UserState) ([]*snap.Info, error) {
-	updates, _, _, err := refreshCandidates(context.TODO(), st, nil, user, nil)
+	updates, _, _, err := refreshCandidates(context.TODO(), st, nil, user, nil, false)
 	return updates, err
 }
 
 // ValidateRefreshes allows to hook validation into the handling of refresh candidates.
 var ValidateRefreshes func(st *state.State, refreshes []*snap.Info, ignoreValidation map[string]bool, userID int, deviceCtx DeviceContext) (validated []*snap.Info, err error)
 
+// EnforcedValidationSets allows to hook getting of validation sets in enforce
+// mode into installation/refresh/removal of snaps.
+var EnforcedValidationSets func(st *state.State) (*snapasserts.ValidationSets, error)
+
+// EnsureSnapServicesQuota allows to hook placing the services of a
+// snap into the slice of its quota group before they are started.
+var EnsureSnapServicesQuota func(st *state.State, info *snap.Info) error
+
+// RemoveSnapFromQuota allows to hook taking a snap out of its quota
+// group when it is removed for good.
+var RemoveSnapFromQuota func(st *state.State, instanceName string) error
+
+// checkValidationSets verifies that installing or refreshing to the
+// given snap revision does not break any enforced validation set.
+func checkValidationSets(st *state.State, info *snap.Info, action string) error {
+	if EnforcedValidationSets == nil {
+		return nil
+	}
+	valsets, err := EnforcedValidationSets(st)
+	if err != nil {
+		return err
+	}
+	if sets := valsets.CheckPresenceInvalid(info); len(sets) != 0 {
+		return fmt.Errorf("cannot %s snap %q: invalid according to validation sets %s", action, info.InstanceName(), strings.Join(sets, ","))
+	}
+	if rev, sets := valsets.RequiredRevision(info); !rev.Unset() && rev != info.Revision {
+		return fmt.Errorf("cannot %s snap %q at revision %s: validation sets %s require revision %s", action, info.InstanceName(), info.Revision, strings.Join(sets, ","), rev)
+	}
+	return nil
+}
+
+// checkValidationSetsForRemove verifies that removing the given snap,
+// or only the given revision of it unless removeAll is set, does not
+// break any enforced validation set.
+func checkValidationSetsForRemove(st *state.State, info *snap.Info, removeAll bool) error {
+	if EnforcedValidationSets == nil {
+		return nil
+	}
+	valsets, err := EnforcedValidationSets(st)
+	if err != nil {
+		return err
+	}
+	if removeAll {
+		if sets := valsets.CheckPresenceRequired(info); len(sets) != 0 {
+			return fmt.Errorf("cannot remove snap %q: required by validation sets %s", info.InstanceName(), strings.Join(sets, ","))
+		}
+		return nil
+	}
+	if rev, sets := valsets.RequiredRevision(info); !rev.Unset() && rev == info.Revision {
+		return fmt.Errorf("cannot remove snap %q at revision %s: required by validation sets %s", info.InstanceName(), info.Revision, strings.Join(sets, ","))
+	}
+	return nil
+}
+
 // UpdateMany updates everything from the given list of names that the
 // store says is updateable. If the list is empty, update everything.
 // Note that the state must be locked by the caller.
@@ -845,21 +934,33 @@ func updateManyFiltered(ctx context.Context, st *state.State, names []string, us
 	if flags == nil {
 		flags = &Flags{}
 	}
-	user, err := userFromUserID(st, userID)
+	updates, stateByInstanceName, deviceCtx, err := filteredRefreshCandidates(ctx, st, names, userID, filter, flags)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	return doUpdate(ctx, st, names, updates, updateManyParams(stateByInstanceName), userID, flags, deviceCtx, fromChange)
+}
+
+// filteredRefreshCandidates returns the updates available for the given
+// snaps, or all of them if names is empty, that pass the filter and the
+// validation checks.
+func filteredRefreshCandidates(ctx context.Context, st *state.State, names []string, userID int, filter updateFilter, flags *Flags) ([]*snap.Info, map[string]*SnapState, DeviceContext, error) {
+	user, err := userFromUserID(st, userID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
 	// need to have a model set before trying to talk the store
 	deviceCtx, err := DevicePastSeeding(st, nil)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	refreshOpts := &store.RefreshOptions{IsAutoRefresh: flags.IsAutoRefresh}
-	updates, stateByInstanceName, ignoreValidation, err := refreshCandidates(ctx, st, names, user, refreshOpts)
+	updates, stateByInstanceName, ignoreValidation, err := refreshCandidates(ctx, st, names, user, refreshOpts, flags.Planning)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	if filter != nil {
@@ -872,19 +973,46 @@ func updateManyFiltered(ctx context.Context, st *state.State, names []string, us
 		updates = actual
 	}
 
+	if EnforcedValidationSets != nil && len(updates) != 0 {
+		actual := updates[:0]
+		for _, update := range updates {
+			if ignoreValidation[update.InstanceName()] {
+				actual = append(actual, update)
+				continue
+			}
+			if err := checkValidationSets(st, update, "refresh"); err != nil {
+				// not doing "refresh all" report the error
+				if len(names) != 0 {
+					return nil, nil, nil, err
+				}
+				// doing "refresh all", log the problem
+				logger.Noticef("cannot refresh some snaps: %v", err)
+				continue
+			}
+			actual = append(actual, update)
+		}
+		updates = actual
+	}
+
 	if ValidateRefreshes != nil && len(updates) != 0 {
 		updates, err = ValidateRefreshes(st, updates, ignoreValidation, userID, deviceCtx)
 		if err != nil {
 			// not doing "refresh all" report the error
 			if len(names) != 0 {
-				return nil, nil, err
+				return nil, nil, nil, err
 			}
 			// doing "refresh all", log the problems
 			logger.Noticef("cannot refresh some snaps: %v", err)
 		}
 	}
 
-	params := func(update *snap.Info) (*RevisionOptions, Flags, *SnapState) {
+	return updates, stateByInstanceName, deviceCtx, nil
+}
+
+// updateManyParams returns the function giving doUpdate the options,
+// flags and state to refresh each of the updates with.
+func updateManyParams(stateByInstanceName map[string]*SnapState) func(*snap.Info) (*RevisionOptions, Flags, *SnapState) {
+	return func(update *snap.Info) (*RevisionOptions, Flags, *SnapState) {
 		snapst := stateByInstanceName[update.InstanceName()]
 		updateFlags := snapst.Flags
 		if !update.NeedsClassic() && updateFlags.Classic {
@@ -899,8 +1027,6 @@ func updateManyFiltered(ctx context.Context, st *state.State, names []string, us
 		return opts, snapst.Flags, snapst
 
 	}
-
-	return doUpdate(ctx, st, names, updates, params, userID, flags, deviceCtx, fromChange)
 }
 
 func doUpdate(ctx context.Context, st *state.State, names []string, updates []*snap.Info, params func(*snap.Info) (*RevisionOptions, Flags, *SnapState), userID int, globalFlags *Flags, deviceCtx DeviceContext, fromChange string) ([]string, []*state.TaskSet, error) {
@@ -1012,6 +1138,7 @@ func doUpdate(ctx context.Context, st *state.State, names []string, updates []*s
 			}
 			return nil, nil, err
 		}
+		collectSnapInfo(st, update)
 		ts.JoinLane(st.NewLane())
 
 		// because of the sorting of updates we fill prereqs
@@ -1414,6 +1541,11 @@ func UpdateWithDeviceContext(st *state.State, name string, opts *RevisionOptions
 	info, infoErr := infoForUpdate(st, &snapst, name, opts, userID, flags, deviceCtx)
 	switch infoErr {
 	case nil:
+		if !flags.IgnoreValidation {
+			if err := checkValidationSets(st, info, "refresh"); err != nil {
+				return nil, err
+			}
+		}
 		updates = append(updates, info)
 	case store.ErrNoUpdateAvailable:
 		// there may be some new auto-aliases
@@ -1549,7 +1681,16 @@ func AutoRefresh(ctx context.Context, st *state.State) ([]string, []*state.TaskS
 		}
 	}
 
-	return UpdateMany(ctx, st, nil, userID, &Flags{IsAutoRefresh: true})
+	tr := config.NewTransaction(st)
+	gateAutoRefreshHook, err := config.GetFeatureFlag(tr, features.GateAutoRefreshHook)
+	if err != nil && !config.IsNoOption(err) {
+		return nil, nil, err
+	}
+	if gateAutoRefreshHook {
+		return gatedAutoRefresh(ctx, st, userID)
+	}
+
+	return updateManyFiltered(ctx, st, nil, userID, autoRefreshHoldFilter, &Flags{IsAutoRefresh: true}, "")
 }
 
 // Enable sets a snap to the active state
@@ -1748,6 +1889,10 @@ func Remove(st *state.State, name string, revision snap.Revision, flags *RemoveF
 		return nil, fmt.Errorf("snap %q is not removable: %v", name, err)
 	}
 
+	if err := checkValidationSetsForRemove(st, info, removeAll); err != nil {
+		return nil, err
+	}
+
 	// main/current SnapSetup
 	snapsup := SnapSetup{
 		SideInfo: &snap.SideInfo{
@@ -2336,19 +2481,35 @@ func ConfigDefaults(st *state.State, deviceCtx DeviceContext, snapName string) (
 // specified in the gadget for the given device context.
 // If gadget is absent it returns ErrNoState.
 func GadgetConnections(st *state.State, deviceCtx DeviceContext) ([]gadget.Connection, error) {
-	info, err := GadgetInfo(st, deviceCtx)
+	gadgetInfo, err := readGadgetInfo(st, deviceCtx)
 	if err != nil {
 		return nil, err
 	}
 
-	constraints := &gadget.ModelConstraints{
-		Classic: release.OnClassic,
+	return gadgetInfo.Connections, nil
+}
+
+// GadgetHotplugConnections returns the rules for connecting hotplug
+// slots specified in the gadget for the given device context.
+// If gadget is absent it returns ErrNoState.
+func GadgetHotplugConnections(st *state.State, deviceCtx DeviceContext) ([]gadget.HotplugConnection, error) {
+	gadgetInfo, err := readGadgetInfo(st, deviceCtx)
+	if err != nil {
+		return nil, err
 	}
 
-	gadgetInfo, err := gadget.ReadInfo(info.MountDir(), constraints)
+	return gadgetInfo.HotplugConnections, nil
+}
+
+func readGadgetInfo(st *state.State, deviceCtx DeviceContext) (*gadget.Info, error) {
+	info, err := GadgetInfo(st, deviceCtx)
 	if err != nil {
 		return nil, err
 	}
 
-	return gadgetInfo.Connections, nil
+	constraints := &gadget.ModelConstraints{
+		Classic: release.OnClassic,
+	}
+
+	return gadget.ReadInfo(info.MountDir(), constraints)
 }
@@ -37,6 +37,8 @@ import (
 	"gopkg.in/tomb.v2"
 
 	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/asserts/snapasserts"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/gadget"
 	"github.com/snapcore/snapd/interfaces"
@@ -201,6 +203,7 @@ func (s *snapmgrTestSuite) SetUpTest(c *C) {
 func (s *snapmgrTestSuite) TearDownTest(c *C) {
 	s.BaseTest.TearDownTest(c)
 	snapstate.ValidateRefreshes = nil
+	snapstate.EnforcedValidationSets = nil
 	snapstate.AutoAliases = nil
 	snapstate.CanAutoRefresh = nil
 }
@@ -634,6 +637,30 @@ func (s *snapmgrTestSuite) TestInstallTasks(c *C) {
 	c.Assert(s.state.TaskCount(), Equals, len(ts.Tasks()))
 }
 
+func (s *snapmgrTestSuite) TestInstallTaskEdges(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	opts := &snapstate.RevisionOptions{Channel: "some-channel"}
+	ts, err := snapstate.Install(context.Background(), s.state, "some-snap", opts, 0, snapstate.Flags{})
+	c.Assert(err, IsNil)
+
+	te, err := ts.Edge(snapstate.BeginEdge)
+	c.Assert(err, IsNil)
+	c.Check(te.Kind(), Equals, "prerequisites")
+
+	te, err = ts.Edge(snapstate.BeforeHooksEdge)
+	c.Assert(err, IsNil)
+	c.Check(te.Kind(), Equals, "setup-aliases")
+
+	te, err = ts.Edge(snapstate.HooksEdge)
+	c.Assert(err, IsNil)
+	c.Assert(te.Kind(), Equals, "run-hook")
+	var hsup hookstate.HookSetup
+	c.Assert(te.Get("hook-setup", &hsup), IsNil)
+	c.Check(hsup.Hook, Equals, "install")
+}
+
 func (s *snapmgrTestSuite) TestInstallSnapdSnapType(c *C) {
 	restore := snap.MockSnapdSnapID("snapd-id") // id provided by fakeStore
 	defer restore()
@@ -867,6 +894,9 @@ func (s *snapmgrTestSuite) testUpdateCreatesGCTasks(c *C, expectedDiscards int)
 	te, err := ts.Edge(snapstate.DownloadAndChecksDoneEdge)
 	c.Assert(te, NotNil)
 	c.Assert(err, IsNil)
+	// no install hook on refresh
+	_, err = ts.Edge(snapstate.HooksEdge)
+	c.Assert(err, NotNil)
 
 	verifyUpdateTasks(c, unlinkBefore|cleanupAfter|doesReRefresh, expectedDiscards, ts, s.state)
 	c.Assert(s.state.TaskCount(), Equals, len(ts.Tasks()))
@@ -940,6 +970,14 @@ func (s snapmgrTestSuite) TestInstallFailsOnBusySnap(c *C) {
 	err = snapstate.Get(s.state, "some-snap", snapst)
 	c.Assert(err, IsNil)
 	c.Check(snapst.RefreshInhibitedTime, NotNil)
+
+	// And the inhibition was noticed.
+	notices := s.state.Notices(&state.NoticeFilter{Types: []state.NoticeType{state.RefreshInhibitNotice}})
+	c.Assert(notices, HasLen, 1)
+	c.Check(notices[0].Key(), Equals, "some-snap")
+	c.Check(notices[0].LastData(), DeepEquals, map[string]string{
+		"inhibited-since": snapst.RefreshInhibitedTime.Format(time.RFC3339),
+	})
 }
 
 func (s snapmgrTestSuite) TestInstallDespiteBusySnap(c *C) {
@@ -989,6 +1027,7 @@ func (s snapmgrTestSuite) TestInstallDespiteBusySnap(c *C) {
 	// And observe that refresh occurred regardless of the running process.
 	_, err := snapstate.DoInstall(s.state, snapst, snapsup, 0, "")
 	c.Assert(err, IsNil)
+	c.Check(s.state.Notices(&state.NoticeFilter{Types: []state.NoticeType{state.RefreshInhibitNotice}}), HasLen, 0)
 }
 
 func (s snapmgrTestSuite) TestInstallFailsOnSystem(c *C) {
@@ -1146,6 +1185,41 @@ func (s *snapmgrTestSuite) TestParallelInstanceUpdateMany(c *C) {
 	verifyUpdateTasks(c, unlinkBefore|cleanupAfter, 1, tts[1], s.state)
 }
 
+func (s *snapmgrTestSuite) TestUpdateManyPlanning(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(1)}},
+		Current:  snap.R(1),
+		SnapType: "app",
+	})
+
+	updates, tts, err := snapstate.UpdateMany(context.Background(), s.state, nil, 0, &snapstate.Flags{Planning: true})
+	c.Assert(err, IsNil)
+	c.Check(updates, DeepEquals, []string{"some-snap"})
+	c.Check(tts, Not(HasLen), 0)
+	for _, ts := range tts {
+		for _, t := range ts.Tasks() {
+			var snapsup snapstate.SnapSetup
+			if t.Get("snap-setup", &snapsup) == nil {
+				c.Check(snapsup.Flags.Planning, Equals, false)
+			}
+		}
+	}
+
+	// the refresh candidates were not recorded
+	var candidates map[string]interface{}
+	c.Check(s.state.Get("refresh-candidates", &candidates), Equals, state.ErrNoState)
+
+	// but they are when not planning
+	_, _, err = snapstate.UpdateMany(context.Background(), s.state, nil, 0, nil)
+	c.Assert(err, IsNil)
+	c.Check(s.state.Get("refresh-candidates", &candidates), IsNil)
+	c.Check(candidates, HasLen, 1)
+}
+
 func (s *snapmgrTestSuite) TestUpdateManyDevModeConfinementFiltering(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -1534,6 +1608,224 @@ func (s *snapmgrTestSuite) TestUpdateManyValidateRefreshesUnhappy(c *C) {
 
 }
 
+func mockValidationSets(c *C, snaps ...interface{}) *snapasserts.ValidationSets {
+	vs := assertstest.FakeAssertion(map[string]interface{}{
+		"type":         "validation-set",
+		"authority-id": "foo",
+		"series":       "16",
+		"account-id":   "foo",
+		"name":         "bar",
+		"sequence":     "3",
+		"snaps":        snaps,
+	}).(*asserts.ValidationSet)
+	valsets := snapasserts.NewValidationSets()
+	c.Assert(valsets.Add(vs), IsNil)
+	return valsets
+}
+
+func (s *snapmgrTestSuite) TestInstallEnforcedValidationSetsError(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.EnforcedValidationSets = func(st *state.State) (*snapasserts.ValidationSets, error) {
+		return nil, errors.New("boom")
+	}
+
+	_, err := snapstate.Install(context.Background(), s.state, "some-snap", nil, 0, snapstate.Flags{})
+	c.Assert(err, ErrorMatches, "boom")
+
+	// unless validation is ignored
+	_, err = snapstate.Install(context.Background(), s.state, "some-snap", nil, 0, snapstate.Flags{IgnoreValidation: true})
+	c.Assert(err, IsNil)
+}
+
+func (s *snapmgrTestSuite) TestInstallEnforcedValidationSetsUnrelated(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.EnforcedValidationSets = func(st *state.State) (*snapasserts.ValidationSets, error) {
+		return mockValidationSets(c, map[string]interface{}{
+			"name":     "other-snap",
+			"id":       "otheridididididididididididididi",
+			"presence": "invalid",
+		}), nil
+	}
+
+	ts, err := snapstate.Install(context.Background(), s.state, "some-snap", nil, 0, snapstate.Flags{})
+	c.Assert(err, IsNil)
+	verifyInstallTasks(c, 0, 0, ts, s.state)
+}
+
+func (s *snapmgrTestSuite) TestUpdateEnforcedValidationSetsWrongRevision(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "some-snap", SnapID: "somesnapidididididididididididid", Revision: snap.R(7)},
+			{RealName: "some-snap", SnapID: "somesnapidididididididididididid", Revision: snap.R(11)},
+		},
+		Current:  snap.R(11),
+		SnapType: "app",
+	})
+
+	snapstate.EnforcedValidationSets = func(st *state.State) (*snapasserts.ValidationSets, error) {
+		return mockValidationSets(c, map[string]interface{}{
+			"name":     "some-snap",
+			"id":       "somesnapidididididididididididid",
+			"revision": "11",
+		}), nil
+	}
+
+	_, err := snapstate.Update(s.state, "some-snap", &snapstate.RevisionOptions{Revision: snap.R(7)}, 0, snapstate.Flags{})
+	c.Assert(err, ErrorMatches, `cannot refresh snap "some-snap" at revision 7: validation sets foo/bar require revision 11`)
+}
+
+func (s *snapmgrTestSuite) TestUpdateManyEnforcedValidationSetsError(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(1)},
+		},
+		Current: snap.R(1),
+	})
+
+	snapstate.EnforcedValidationSets = func(st *state.State) (*snapasserts.ValidationSets, error) {
+		return nil, errors.New("boom")
+	}
+
+	// refresh all => no error
+	updates, tts, err := snapstate.UpdateMany(context.Background(), s.state, nil, 0, nil)
+	c.Assert(err, IsNil)
+	c.Check(tts, HasLen, 0)
+	c.Check(updates, HasLen, 0)
+
+	// refresh some-snap => report error
+	updates, tts, err = snapstate.UpdateMany(context.Background(), s.state, []string{"some-snap"}, 0, nil)
+	c.Assert(err, ErrorMatches, "boom")
+	c.Check(tts, HasLen, 0)
+	c.Check(updates, HasLen, 0)
+}
+
+func (s *snapmgrTestSuite) TestRemoveEnforcedValidationSetsRequired(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "foo", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "foo", SnapID: "fooidididididididididididididid1", Revision: snap.R(5)},
+			{RealName: "foo", SnapID: "fooidididididididididididididid1", Revision: snap.R(11)},
+		},
+		Current:  snap.R(11),
+		SnapType: "app",
+	})
+
+	snapstate.EnforcedValidationSets = func(st *state.State) (*snapasserts.ValidationSets, error) {
+		return mockValidationSets(c, map[string]interface{}{
+			"name": "foo",
+			"id":   "fooidididididididididididididid1",
+		}), nil
+	}
+
+	_, err := snapstate.Remove(s.state, "foo", snap.R(0), nil)
+	c.Assert(err, ErrorMatches, `cannot remove snap "foo": required by validation sets foo/bar`)
+
+	// removing an inactive revision is fine
+	_, err = snapstate.Remove(s.state, "foo", snap.R(5), nil)
+	c.Assert(err, IsNil)
+}
+
+func (s *snapmgrTestSuite) TestRemoveRevisionEnforcedValidationSetsRequired(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "foo", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "foo", SnapID: "fooidididididididididididididid1", Revision: snap.R(5)},
+			{RealName: "foo", SnapID: "fooidididididididididididididid1", Revision: snap.R(7)},
+			{RealName: "foo", SnapID: "fooidididididididididididididid1", Revision: snap.R(11)},
+		},
+		Current:  snap.R(11),
+		SnapType: "app",
+	})
+
+	snapstate.EnforcedValidationSets = func(st *state.State) (*snapasserts.ValidationSets, error) {
+		return mockValidationSets(c, map[string]interface{}{
+			"name":     "foo",
+			"id":       "fooidididididididididididididid1",
+			"presence": "optional",
+			"revision": "5",
+		}), nil
+	}
+
+	_, err := snapstate.Remove(s.state, "foo", snap.R(5), nil)
+	c.Assert(err, ErrorMatches, `cannot remove snap "foo" at revision 5: required by validation sets foo/bar`)
+
+	// other revisions can go
+	_, err = snapstate.Remove(s.state, "foo", snap.R(7), nil)
+	c.Assert(err, IsNil)
+}
+
+func (s *snapmgrTestSuite) TestRemoveRevisionEnforcedValidationSetsError(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.Set(s.state, "foo", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "foo", SnapID: "fooidididididididididididididid1", Revision: snap.R(5)},
+			{RealName: "foo", SnapID: "fooidididididididididididididid1", Revision: snap.R(11)},
+		},
+		Current:  snap.R(11),
+		SnapType: "app",
+	})
+
+	snapstate.EnforcedValidationSets = func(st *state.State) (*snapasserts.ValidationSets, error) {
+		return nil, errors.New("boom")
+	}
+
+	_, err := snapstate.Remove(s.state, "foo", snap.R(5), nil)
+	c.Assert(err, ErrorMatches, "boom")
+}
+
+func (s *snapmgrTestSuite) TestInstallManyEnforcedValidationSetsError(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.EnforcedValidationSets = func(st *state.State) (*snapasserts.ValidationSets, error) {
+		return nil, errors.New("boom")
+	}
+
+	installed, tts, err := snapstate.InstallMany(s.state, []string{"one", "two"}, 0)
+	c.Assert(err, ErrorMatches, "boom")
+	c.Check(installed, HasLen, 0)
+	c.Check(tts, HasLen, 0)
+}
+
+func (s *snapmgrTestSuite) TestInstallManyEnforcedValidationSetsUnrelated(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	snapstate.EnforcedValidationSets = func(st *state.State) (*snapasserts.ValidationSets, error) {
+		return mockValidationSets(c, map[string]interface{}{
+			"name":     "other-snap",
+			"id":       "otheridididididididididididididi",
+			"presence": "invalid",
+		}), nil
+	}
+
+	installed, tts, err := snapstate.InstallMany(s.state, []string{"one", "two"}, 0)
+	c.Assert(err, IsNil)
+	c.Check(installed, DeepEquals, []string{"one", "two"})
+	c.Check(tts, HasLen, 2)
+}
+
 func (s *snapmgrTestSuite) TestRevertCreatesNoGCTasks(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -7229,6 +7521,10 @@ func (s *snapmgrTestSuite) TestRemoveRunThrough(c *C) {
 	c.Assert(err, Equals, state.ErrNoState)
 	c.Check(snapstate.AuxStoreInfoFilename("some-snap-id"), testutil.FileAbsent)
 
+	// the removal was noticed
+	notices := s.state.Notices(&state.NoticeFilter{Types: []state.NoticeType{state.SnapRemovedNotice}})
+	c.Assert(notices, HasLen, 1)
+	c.Check(notices[0].Key(), Equals, "some-snap")
 }
 
 func (s *snapmgrTestSuite) TestParallelInstanceRemoveRunThrough(c *C) {
@@ -10215,6 +10511,58 @@ func mockAutoRefreshAssertions(f func(st *state.State, userID int) error) func()
 	}
 }
 
+func (s *snapmgrTestSuite) TestAutoRefreshSkipsHeldSnaps(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	holdUntil := time.Now().Add(time.Hour)
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(1)},
+		},
+		Current:     snap.R(1),
+		SnapType:    "app",
+		RefreshHold: &holdUntil,
+	})
+
+	updates, _, err := snapstate.AutoRefresh(context.Background(), s.state)
+	c.Assert(err, IsNil)
+	c.Check(updates, HasLen, 0)
+
+	// an expired hold does not prevent the auto-refresh
+	expired := time.Now().Add(-time.Hour)
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, "some-snap", &snapst), IsNil)
+	snapst.RefreshHold = &expired
+	snapstate.Set(s.state, "some-snap", &snapst)
+
+	updates, _, err = snapstate.AutoRefresh(context.Background(), s.state)
+	c.Assert(err, IsNil)
+	c.Check(updates, DeepEquals, []string{"some-snap"})
+}
+
+func (s *snapmgrTestSuite) TestUpdateManyIgnoresRefreshHold(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	holdUntil := time.Now().Add(time.Hour)
+	snapstate.Set(s.state, "some-snap", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(1)},
+		},
+		Current:     snap.R(1),
+		SnapType:    "app",
+		RefreshHold: &holdUntil,
+	})
+
+	// manual refreshes are not affected by the hold
+	updates, _, err := snapstate.UpdateMany(context.Background(), s.state, nil, 0, nil)
+	c.Assert(err, IsNil)
+	c.Check(updates, DeepEquals, []string{"some-snap"})
+}
+
 func (s *snapmgrTestSuite) TestEnsureRefreshesWithUpdateStoreError(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -13027,6 +13375,49 @@ func (s *snapmgrTestSuite) TestConflictManyRemodeling(c *C) {
 	c.Check(err, ErrorMatches, `remodeling in progress, no other changes allowed until this is done`)
 }
 
+func (s *snapmgrTestSuite) TestChangeConflicts(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	var chgIDs []string
+	for _, instanceName := range []string{"a-snap", "b-snap"} {
+		snapstate.Set(s.state, instanceName, &snapstate.SnapState{
+			Sequence: []*snap.SideInfo{
+				{RealName: instanceName, Revision: snap.R(11)},
+			},
+			Current: snap.R(11),
+			Active:  false,
+		})
+
+		ts, err := snapstate.Enable(s.state, instanceName)
+		c.Assert(err, IsNil)
+		chg := s.state.NewChange("enable", "...")
+		chg.AddAll(ts)
+		chgIDs = append(chgIDs, chg.ID())
+	}
+
+	conflicts, err := snapstate.ChangeConflicts(s.state, []string{"c-snap"})
+	c.Assert(err, IsNil)
+	c.Check(conflicts, HasLen, 0)
+
+	// one conflict per snap and change, in whichever order
+	conflicts, err = snapstate.ChangeConflicts(s.state, []string{"a-snap", "b-snap", "c-snap"})
+	c.Assert(err, IsNil)
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Snap < conflicts[j].Snap })
+	c.Check(conflicts, DeepEquals, []*snapstate.ChangeConflictError{
+		{Snap: "a-snap", ChangeKind: "enable", ChangeID: chgIDs[0]},
+		{Snap: "b-snap", ChangeKind: "enable", ChangeID: chgIDs[1]},
+	})
+
+	chg := s.state.NewChange("remodel", "...")
+	chg.SetStatus(state.DoingStatus)
+	conflicts, err = snapstate.ChangeConflicts(s.state, []string{"c-snap"})
+	c.Assert(err, IsNil)
+	c.Check(conflicts, DeepEquals, []*snapstate.ChangeConflictError{
+		{Message: "remodeling in progress, no other changes allowed until this is done", ChangeKind: "remodel", ChangeID: chg.ID()},
+	})
+}
+
 func (s *snapmgrTestSuite) TestInstallWithoutCoreRunThrough1(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -14614,6 +15005,36 @@ connections:
 		{Plug: gadget.ConnectionPlug{SnapID: "snap1idididididididididididididi", Plug: "plug"}, Slot: gadget.ConnectionSlot{SnapID: "snap2idididididididididididididi", Slot: "slot"}}})
 }
 
+func (s *snapmgrTestSuite) TestGadgetHotplugConnections(c *C) {
+	r := release.MockOnClassic(false)
+	defer r()
+
+	// using MockSnap, we want to read the bits on disk
+	snapstate.MockSnapReadInfo(snap.ReadInfo)
+
+	deviceCtxNoGadget := deviceWithoutGadgetContext()
+	deviceCtx := deviceWithGadgetContext("the-gadget")
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	_, err := snapstate.GadgetHotplugConnections(s.state, deviceCtxNoGadget)
+	c.Assert(err, Equals, state.ErrNoState)
+
+	s.prepareGadget(c, `
+hotplug-connections:
+  - interface: serial-port
+    attributes:
+      usb-vendor: "0403"
+    plug: snap1idididididididididididididi:plug
+`)
+
+	hconns, err := snapstate.GadgetHotplugConnections(s.state, deviceCtx)
+	c.Assert(err, IsNil)
+	c.Check(hconns, DeepEquals, []gadget.HotplugConnection{
+		{Interface: "serial-port", Attributes: map[string]interface{}{"usb-vendor": "0403"}, Plug: gadget.ConnectionPlug{SnapID: "snap1idididididididididididididi", Plug: "plug"}}})
+}
+
 func (s *snapmgrTestSuite) TestSnapManagerCanStandby(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
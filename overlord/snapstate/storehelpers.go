@@ -318,7 +318,10 @@ func collectCurrentSnaps(snapStates map[string]*SnapState, consider func(*store.
 	return curSnaps
 }
 
-func refreshCandidates(ctx context.Context, st *state.State, names []string, user *auth.UserState, opts *store.RefreshOptions) ([]*snap.Info, map[string]*SnapState, map[string]bool, error) {
+// refreshCandidates returns the updates available for the given snaps,
+// or all of them if names is empty, in which case they are also
+// recorded for refresh hints unless planning.
+func refreshCandidates(ctx context.Context, st *state.State, names []string, user *auth.UserState, opts *store.RefreshOptions, planning bool) ([]*snap.Info, map[string]*SnapState, map[string]bool, error) {
 	snapStates, err := All(st)
 	if err != nil {
 		return nil, nil, nil, err
@@ -439,6 +442,10 @@ func refreshCandidates(ctx context.Context, st *state.State, names []string, use
 		updates = append(updates, updatesForUser...)
 	}
 
+	if len(names) == 0 && !planning {
+		recordRefreshCandidates(st, updates, stateByInstanceName)
+	}
+
 	return updates, stateByInstanceName, ignoreValidationByInstanceName, nil
 }
 
@@ -65,6 +65,10 @@ const (
 	// ErrorStatus means the change or task has errored out while running or being undone.
 	ErrorStatus Status = 9
 
+	// ScheduledStatus means the change is ready to start but was scheduled to start later.
+	// It is only ever computed for changes, see Change.ScheduleAt.
+	ScheduledStatus Status = 10
+
 	nStatuses = iota
 )
 
@@ -100,6 +104,8 @@ func (s Status) String() string {
 		return "Hold"
 	case ErrorStatus:
 		return "Error"
+	case ScheduledStatus:
+		return "Scheduled"
 	}
 	panic(fmt.Sprintf("internal error: unknown task status code: %d", s))
 }
@@ -126,8 +132,14 @@ type Change struct {
 	lanes   int
 	ready   chan struct{}
 
-	spawnTime time.Time
-	readyTime time.Time
+	// taskStatusCounts counts the tasks of the change by status, it
+	// is computed on first use and then kept up to date as tasks are
+	// added or change status
+	taskStatusCounts []int
+
+	spawnTime     time.Time
+	readyTime     time.Time
+	scheduledTime time.Time
 }
 
 type byReadyTime []*Change
@@ -159,8 +171,9 @@ type marshalledChange struct {
 	TaskIDs []string                    `json:"task-ids,omitempty"`
 	Lanes   int                         `json:"lanes,omitempty"`
 
-	SpawnTime time.Time  `json:"spawn-time"`
-	ReadyTime *time.Time `json:"ready-time,omitempty"`
+	SpawnTime     time.Time  `json:"spawn-time"`
+	ReadyTime     *time.Time `json:"ready-time,omitempty"`
+	ScheduledTime *time.Time `json:"scheduled-time,omitempty"`
 }
 
 // MarshalJSON makes Change a json.Marshaller
@@ -170,6 +183,10 @@ func (c *Change) MarshalJSON() ([]byte, error) {
 	if !c.readyTime.IsZero() {
 		readyTime = &c.readyTime
 	}
+	var scheduledTime *time.Time
+	if !c.scheduledTime.IsZero() {
+		scheduledTime = &c.scheduledTime
+	}
 	return json.Marshal(marshalledChange{
 		ID:      c.id,
 		Kind:    c.kind,
@@ -180,8 +197,9 @@ func (c *Change) MarshalJSON() ([]byte, error) {
 		TaskIDs: c.taskIDs,
 		Lanes:   c.lanes,
 
-		SpawnTime: c.spawnTime,
-		ReadyTime: readyTime,
+		SpawnTime:     c.spawnTime,
+		ReadyTime:     readyTime,
+		ScheduledTime: scheduledTime,
 	})
 }
 
@@ -212,6 +230,9 @@ func (c *Change) UnmarshalJSON(data []byte) error {
 	if unmarshalled.ReadyTime != nil {
 		c.readyTime = *unmarshalled.ReadyTime
 	}
+	if unmarshalled.ScheduledTime != nil {
+		c.scheduledTime = *unmarshalled.ScheduledTime
+	}
 	return nil
 }
 
@@ -257,6 +278,7 @@ var statusOrder = []Status{
 	UndoStatus,
 	DoingStatus,
 	DoStatus,
+	ScheduledStatus,
 	ErrorStatus,
 	UndoneStatus,
 	DoneStatus,
@@ -284,12 +306,12 @@ func (c *Change) Status() Status {
 		if len(c.taskIDs) == 0 {
 			return HoldStatus
 		}
-		statusStats := make([]int, nStatuses)
-		for _, tid := range c.taskIDs {
-			statusStats[c.state.tasks[tid].Status()]++
-		}
+		statusStats := c.statusCounts()
 		for _, s := range statusOrder {
 			if statusStats[s] > 0 {
+				if s == DoStatus && timeNow().Before(c.scheduledTime) {
+					return ScheduledStatus
+				}
 				return s
 			}
 		}
@@ -301,10 +323,22 @@ func (c *Change) Status() Status {
 // SetStatus sets the change status, overriding the default behavior (see Status method).
 func (c *Change) SetStatus(s Status) {
 	c.state.writing()
+	old := c.Status()
 	c.status = s
 	if s.Ready() {
 		c.markReady()
 	}
+	if c.Status() != old {
+		c.addNotice()
+	}
+}
+
+// addNotice records a change-update notice for the change.
+func (c *Change) addNotice() {
+	c.state.AddNotice(ChangeUpdateNotice, c.id, map[string]string{
+		"kind":   c.kind,
+		"status": c.Status().String(),
+	})
 }
 
 func (c *Change) markReady() {
@@ -315,6 +349,7 @@ func (c *Change) markReady() {
 	}
 	if c.readyTime.IsZero() {
 		c.readyTime = timeNow()
+		changeDurationSeconds.Observe(c.readyTime.Sub(c.spawnTime).Seconds(), c.kind, c.Status().String())
 	}
 }
 
@@ -323,15 +358,39 @@ func (c *Change) Ready() <-chan struct{} {
 	return c.ready
 }
 
+// statusCounts returns the number of tasks of the change in each status.
+func (c *Change) statusCounts() []int {
+	if c.taskStatusCounts == nil {
+		c.taskStatusCounts = make([]int, nStatuses)
+		for _, tid := range c.taskIDs {
+			c.taskStatusCounts[c.state.tasks[tid].Status()]++
+		}
+	}
+	return c.taskStatusCounts
+}
+
 // taskStatusChanged is called by tasks when their status is changed,
 // to give the opportunity for the change to close its ready channel.
 func (c *Change) taskStatusChanged(t *Task, old, new Status) {
+	if old == DefaultStatus {
+		old = DoStatus
+	}
+	if new == DefaultStatus {
+		new = DoStatus
+	}
+	if c.taskStatusCounts != nil {
+		c.taskStatusCounts[old]--
+		c.taskStatusCounts[new]++
+	}
 	if old.Ready() == new.Ready() {
 		return
 	}
-	for _, tid := range c.taskIDs {
-		task := c.state.tasks[tid]
-		if task != t && !task.status.Ready() {
+	for s, n := range c.statusCounts() {
+		if Status(s) == new {
+			// not counting t itself
+			n--
+		}
+		if n > 0 && !Status(s).Ready() {
 			return
 		}
 	}
@@ -394,6 +453,30 @@ func (c *Change) ReadyTime() time.Time {
 	return c.readyTime
 }
 
+// ScheduleAt schedules the change to start no earlier than when, by
+// scheduling all of its tasks that are not ready yet to happen no
+// earlier than that. Tasks added to the change later on are not affected.
+// Until then, and as long as none of its tasks started, the change
+// reports ScheduledStatus.
+func (c *Change) ScheduleAt(when time.Time) {
+	c.state.writing()
+	old := c.Status()
+	c.scheduledTime = when
+	for _, tid := range c.taskIDs {
+		c.state.tasks[tid].At(when)
+	}
+	if c.Status() != old {
+		c.addNotice()
+	}
+}
+
+// ScheduledTime returns the time the change was scheduled to start at,
+// if any.
+func (c *Change) ScheduledTime() time.Time {
+	c.state.reading()
+	return c.scheduledTime
+}
+
 // changeError holds a set of task errors.
 type changeError struct {
 	errors []taskError
@@ -460,6 +543,9 @@ func (c *Change) AddTask(t *Task) {
 	}
 	t.change = c.id
 	c.taskIDs = addOnce(c.taskIDs, t.ID())
+	if c.taskStatusCounts != nil {
+		c.taskStatusCounts[t.Status()]++
+	}
 }
 
 // AddAll registers all tasks in the set as required for the state
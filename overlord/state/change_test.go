@@ -68,11 +68,55 @@ func (cs *changeSuite) TestReadyTime(c *C) {
 }
 
 func (cs *changeSuite) TestStatusString(c *C) {
-	for s := state.Status(0); s < state.ErrorStatus+1; s++ {
+	for s := state.Status(0); s < state.ScheduledStatus+1; s++ {
 		c.Assert(s.String(), Matches, ".+")
 	}
 }
 
+func (cs *changeSuite) TestScheduleAt(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	chg := st.NewChange("refresh", "...")
+	t1 := st.NewTask("download", "1...")
+	t2 := st.NewTask("link", "2...")
+	t2.WaitFor(t1)
+	chg.AddAll(state.NewTaskSet(t1, t2))
+	c.Check(chg.Status(), Equals, state.DoStatus)
+	c.Check(chg.ScheduledTime().IsZero(), Equals, true)
+
+	when := time.Now().Add(time.Hour)
+	chg.ScheduleAt(when)
+	c.Check(chg.ScheduledTime().Equal(when), Equals, true)
+	c.Check(chg.Status(), Equals, state.ScheduledStatus)
+	c.Check(chg.Status().Ready(), Equals, false)
+	c.Check(t1.AtTime().Equal(when), Equals, true)
+	c.Check(t2.AtTime().Equal(when), Equals, true)
+
+	// once started the change is no longer just scheduled
+	t1.SetStatus(state.DoingStatus)
+	c.Check(chg.Status(), Equals, state.DoingStatus)
+	t1.SetStatus(state.DoStatus)
+
+	// aborting a scheduled change cancels it
+	chg.Abort()
+	c.Check(chg.Status(), Equals, state.HoldStatus)
+	c.Check(chg.IsReady(), Equals, true)
+}
+
+func (cs *changeSuite) TestScheduleAtPast(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	chg := st.NewChange("refresh", "...")
+	chg.AddTask(st.NewTask("download", "1..."))
+
+	chg.ScheduleAt(time.Now().Add(-time.Hour))
+	c.Check(chg.Status(), Equals, state.DoStatus)
+}
+
 func (cs *changeSuite) TestGetSet(c *C) {
 	st := state.New(nil)
 	st.Lock()
@@ -258,6 +302,39 @@ func (cs *changeSuite) TestStatusDerivedFromTasks(c *C) {
 	}
 }
 
+func (cs *changeSuite) TestStatusWithTasksAddedLater(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	chg := st.NewChange("install", "...")
+	t1 := st.NewTask("download", "1...")
+	chg.AddTask(t1)
+	c.Assert(chg.Status(), Equals, state.DoStatus)
+
+	t1.SetStatus(state.DoneStatus)
+	c.Assert(chg.Status(), Equals, state.DoneStatus)
+
+	t2 := st.NewTask("download", "2...")
+	t2.SetStatus(state.ErrorStatus)
+	chg.AddTask(t2)
+	c.Assert(chg.Status(), Equals, state.ErrorStatus)
+
+	t3 := st.NewTask("download", "3...")
+	chg.AddTask(t3)
+	c.Assert(chg.Status(), Equals, state.DoStatus)
+
+	t3.SetStatus(state.DoingStatus)
+	c.Assert(chg.Status(), Equals, state.DoingStatus)
+
+	t3.SetStatus(state.DefaultStatus)
+	c.Assert(chg.Status(), Equals, state.DoStatus)
+
+	t3.SetStatus(state.UndoneStatus)
+	c.Assert(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.IsReady(), Equals, true)
+}
+
 func (cs *changeSuite) TestCloseReadyOnExplicitStatus(c *C) {
 	st := state.New(nil)
 	st.Lock()
@@ -0,0 +1,42 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package state
+
+import (
+	"github.com/snapcore/snapd/metrics"
+)
+
+var (
+	lockHoldSeconds = metrics.NewHistogram("snapd_state_lock_hold_seconds",
+		"Time the state lock was held for.", metrics.DefBuckets)
+
+	changeDurationSeconds = metrics.NewHistogram("snapd_change_duration_seconds",
+		"Time from spawning a change to it becoming ready, by kind and final status.",
+		[]float64{1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600}, "kind", "status")
+
+	taskRunSeconds = metrics.NewHistogram("snapd_task_run_seconds",
+		"Time spent running a task handler, by task kind.",
+		[]float64{.01, .1, .5, 1, 5, 10, 30, 60, 300}, "kind")
+
+	runningTasks = metrics.NewGauge("snapd_taskrunner_running_tasks",
+		"Number of tasks being run by the task runner.")
+	waitingTasks = metrics.NewGauge("snapd_taskrunner_waiting_tasks",
+		"Number of tasks waiting on other tasks, a later time or a blocked predicate before they can run.")
+)
@@ -0,0 +1,375 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/snapcore/snapd/logger"
+)
+
+// DefaultNoticeExpireAfter is how long a notice is kept around after
+// it last occurred.
+var DefaultNoticeExpireAfter = 7 * 24 * time.Hour
+
+// NoticeType is the type of a notice.
+type NoticeType string
+
+const (
+	// ChangeUpdateNotice is recorded whenever a change's status
+	// changes. The key is the change ID.
+	ChangeUpdateNotice NoticeType = "change-update"
+
+	// WarningNotice is recorded whenever a warning is added or
+	// repeated. The key is the warning message.
+	WarningNotice NoticeType = "warning"
+
+	// RefreshInhibitNotice is recorded whenever a refresh of a snap
+	// is inhibited by its running applications. The key is the
+	// snap instance name.
+	RefreshInhibitNotice NoticeType = "refresh-inhibit"
+
+	// SnapInstalledNotice is recorded whenever a snap gets
+	// installed. The key is the snap instance name.
+	SnapInstalledNotice NoticeType = "snap-installed"
+
+	// SnapRemovedNotice is recorded whenever a snap gets removed
+	// completely. The key is the snap instance name.
+	SnapRemovedNotice NoticeType = "snap-removed"
+)
+
+// Valid returns whether the notice type is one of the known ones.
+func (t NoticeType) Valid() bool {
+	switch t {
+	case ChangeUpdateNotice, WarningNotice, RefreshInhibitNotice, SnapInstalledNotice, SnapRemovedNotice:
+		return true
+	}
+	return false
+}
+
+type jsonNotice struct {
+	ID            string            `json:"id"`
+	Type          NoticeType        `json:"type"`
+	Key           string            `json:"key"`
+	FirstOccurred time.Time         `json:"first-occurred"`
+	LastOccurred  time.Time         `json:"last-occurred"`
+	Occurrences   int               `json:"occurrences"`
+	LastData      map[string]string `json:"last-data,omitempty"`
+	ExpireAfter   string            `json:"expire-after,omitempty"`
+}
+
+// Notice records an occurrence of a given event. Notices of the
+// same type and key are aggregated, keeping track of the number of
+// occurrences and of the data of the last one.
+type Notice struct {
+	// the unique, increasing, identifier of the notice
+	id string
+	// the type of event
+	noticeType NoticeType
+	// the type-specific key identifying what the event is about
+	key string
+	// the first time one of these notices occurred
+	firstOccurred time.Time
+	// the last time one of these notices occurred
+	lastOccurred time.Time
+	// the number of times one of these notices occurred
+	occurrences int
+	// data associated with the last occurrence
+	lastData map[string]string
+	// how much time since one of these last occurred should we drop the notice
+	expireAfter time.Duration
+}
+
+// ID returns the unique identifier of the notice.
+func (n *Notice) ID() string {
+	return n.id
+}
+
+// Type returns the type of the notice.
+func (n *Notice) Type() NoticeType {
+	return n.noticeType
+}
+
+// Key returns the type-specific key of the notice.
+func (n *Notice) Key() string {
+	return n.key
+}
+
+// LastOccurred returns the last time the notice occurred.
+func (n *Notice) LastOccurred() time.Time {
+	return n.lastOccurred
+}
+
+// Occurrences returns how many times the notice occurred.
+func (n *Notice) Occurrences() int {
+	return n.occurrences
+}
+
+// LastData returns the data associated with the last occurrence of the notice.
+func (n *Notice) LastData() map[string]string {
+	return n.lastData
+}
+
+func (n *Notice) String() string {
+	return fmt.Sprintf("Notice %s (%s:%s)", n.id, n.noticeType, n.key)
+}
+
+func (n *Notice) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonNotice{
+		ID:            n.id,
+		Type:          n.noticeType,
+		Key:           n.key,
+		FirstOccurred: n.firstOccurred,
+		LastOccurred:  n.lastOccurred,
+		Occurrences:   n.occurrences,
+		LastData:      n.lastData,
+		ExpireAfter:   n.expireAfter.String(),
+	})
+}
+
+func (n *Notice) UnmarshalJSON(data []byte) error {
+	var jn jsonNotice
+	if err := json.Unmarshal(data, &jn); err != nil {
+		return err
+	}
+	n.id = jn.ID
+	n.noticeType = jn.Type
+	n.key = jn.Key
+	n.firstOccurred = jn.FirstOccurred
+	n.lastOccurred = jn.LastOccurred
+	n.occurrences = jn.Occurrences
+	n.lastData = jn.LastData
+	if jn.ExpireAfter != "" {
+		var err error
+		n.expireAfter, err = time.ParseDuration(jn.ExpireAfter)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExpiredBefore returns whether the notice expired before the given time.
+func (n *Notice) ExpiredBefore(t time.Time) bool {
+	return n.lastOccurred.Add(n.expireAfter).Before(t)
+}
+
+func noticeUniqueKey(noticeType NoticeType, key string) string {
+	return string(noticeType) + ":" + key
+}
+
+// flattenNotices returns all non-expired notices as a flat list,
+// for serialising.
+// Call with the lock held.
+func (s *State) flattenNotices() []*Notice {
+	now := timeNow()
+	flat := make([]*Notice, 0, len(s.notices))
+	for _, n := range s.notices {
+		if n.ExpiredBefore(now) {
+			continue
+		}
+		flat = append(flat, n)
+	}
+	sort.Sort(byLastOccurred(flat))
+	return flat
+}
+
+// unflattenNotices takes a flat list of notices and replaces the
+// notices map with them, ignoring expired notices in the process.
+// Call with the lock held.
+func (s *State) unflattenNotices(flat []*Notice) {
+	now := timeNow()
+	s.notices = make(map[string]*Notice, len(flat))
+	for _, n := range flat {
+		if n.ExpiredBefore(now) {
+			continue
+		}
+		s.notices[noticeUniqueKey(n.noticeType, n.key)] = n
+	}
+}
+
+// AddNotice records an occurrence of the notice with the given type
+// and key, with the given data, and returns the notice ID. If a notice
+// with the same type and key exists already it is updated and moved to
+// the end of the notice stream, otherwise a new notice is created.
+// Waiters in WaitNotices are woken up.
+func (s *State) AddNotice(noticeType NoticeType, key string, data map[string]string) string {
+	s.writing()
+
+	if !noticeType.Valid() || key == "" {
+		// programming error!
+		logger.Panicf("internal error, please report: attempted to add invalid notice (type %q, key %q)", noticeType, key)
+	}
+
+	now := timeNow().UTC()
+	uniqueKey := noticeUniqueKey(noticeType, key)
+	n := s.notices[uniqueKey]
+	if n == nil {
+		n = &Notice{
+			noticeType:    noticeType,
+			key:           key,
+			firstOccurred: now,
+			expireAfter:   DefaultNoticeExpireAfter,
+		}
+		s.notices[uniqueKey] = n
+	}
+	// a new id on every occurrence so that clients waiting for
+	// notices after a given one see the repeated ones too
+	s.lastNoticeId++
+	n.id = strconv.Itoa(s.lastNoticeId)
+	n.lastOccurred = now
+	n.occurrences++
+	n.lastData = data
+
+	s.noticeCond.Broadcast()
+
+	return n.id
+}
+
+// NoticeFilter allows filtering notices by various fields.
+type NoticeFilter struct {
+	// Types, if not empty, only includes notices of these types.
+	Types []NoticeType
+	// Keys, if not empty, only includes notices with one of these keys.
+	Keys []string
+	// After, if not zero, only includes notices that last occurred
+	// after this time.
+	After time.Time
+}
+
+func (f *NoticeFilter) matches(n *Notice) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Types) > 0 && !noticeTypeIn(n.noticeType, f.Types) {
+		return false
+	}
+	if len(f.Keys) > 0 && !stringIn(n.key, f.Keys) {
+		return false
+	}
+	if !f.After.IsZero() && !n.lastOccurred.After(f.After) {
+		return false
+	}
+	return true
+}
+
+func noticeTypeIn(t NoticeType, types []NoticeType) bool {
+	for _, t1 := range types {
+		if t == t1 {
+			return true
+		}
+	}
+	return false
+}
+
+func stringIn(s string, strs []string) bool {
+	for _, s1 := range strs {
+		if s == s1 {
+			return true
+		}
+	}
+	return false
+}
+
+type byLastOccurred []*Notice
+
+func (a byLastOccurred) Len() int      { return len(a) }
+func (a byLastOccurred) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byLastOccurred) Less(i, j int) bool {
+	if a[i].lastOccurred.Equal(a[j].lastOccurred) {
+		ii, _ := strconv.Atoi(a[i].id)
+		ij, _ := strconv.Atoi(a[j].id)
+		return ii < ij
+	}
+	return a[i].lastOccurred.Before(a[j].lastOccurred)
+}
+
+// Notices returns the non-expired notices that match the filter (if
+// any), sorted by the time they last occurred.
+func (s *State) Notices(filter *NoticeFilter) []*Notice {
+	s.reading()
+
+	now := timeNow()
+	var notices []*Notice
+	for _, n := range s.notices {
+		if n.ExpiredBefore(now) || !filter.matches(n) {
+			continue
+		}
+		notices = append(notices, n)
+	}
+	sort.Sort(byLastOccurred(notices))
+	return notices
+}
+
+// WaitNotices returns the notices that match the filter (if any),
+// waiting for at least one to occur if none exist yet. It returns
+// ctx.Err() if the context is done before that.
+//
+// It must be called with the state lock held, which it releases
+// while waiting.
+func (s *State) WaitNotices(ctx context.Context, filter *NoticeFilter) ([]*Notice, error) {
+	s.reading()
+
+	notices := s.Notices(filter)
+	if len(notices) > 0 {
+		return notices, nil
+	}
+
+	// wake up the waiter when the context is done so that it can
+	// check ctx.Err() and return
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// take the lock so that the broadcast cannot happen
+			// before the waiter is waiting
+			s.mu.Lock()
+			s.noticeCond.Broadcast()
+			s.mu.Unlock()
+		case <-stop:
+		}
+	}()
+
+	for {
+		s.waitNotice()
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		notices = s.Notices(filter)
+		if len(notices) > 0 {
+			return notices, nil
+		}
+	}
+}
+
+// waitNotice waits for a broadcast on noticeCond, releasing the state
+// lock meanwhile. The state is not checkpointed, any modification
+// will be when the lock is finally released with Unlock.
+func (s *State) waitNotice() {
+	s.releasing()
+	s.noticeCond.Wait()
+	s.acquired()
+}
@@ -0,0 +1,248 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package state_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+func (stateSuite) TestAddNoticeAggregates(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	restore := state.MockTime(t0)
+	defer restore()
+	id1 := st.AddNotice(state.SnapInstalledNotice, "foo", map[string]string{"revision": "1"})
+	id2 := st.AddNotice(state.SnapInstalledNotice, "bar", nil)
+
+	restore = state.MockTime(t0.Add(time.Second))
+	defer restore()
+	id3 := st.AddNotice(state.SnapInstalledNotice, "foo", map[string]string{"revision": "2"})
+
+	c.Check(id1, check.Equals, "1")
+	c.Check(id2, check.Equals, "2")
+	c.Check(id3, check.Equals, "3")
+
+	notices := st.Notices(nil)
+	c.Assert(notices, check.HasLen, 2)
+	c.Check(notices[0].Key(), check.Equals, "bar")
+	c.Check(notices[1].Key(), check.Equals, "foo")
+	c.Check(notices[1].ID(), check.Equals, "3")
+	c.Check(notices[1].Type(), check.Equals, state.SnapInstalledNotice)
+	c.Check(notices[1].Occurrences(), check.Equals, 2)
+	c.Check(notices[1].LastOccurred().Equal(t0.Add(time.Second)), check.Equals, true)
+	c.Check(notices[1].LastData(), check.DeepEquals, map[string]string{"revision": "2"})
+}
+
+func (stateSuite) TestAddNoticeInvalid(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	c.Check(func() { st.AddNotice("foo", "bar", nil) }, check.PanicMatches, `internal error, please report: attempted to add invalid notice \(type "foo", key "bar"\)`)
+	c.Check(func() { st.AddNotice(state.WarningNotice, "", nil) }, check.PanicMatches, `internal error, please report: attempted to add invalid notice \(type "warning", key ""\)`)
+}
+
+func (stateSuite) TestNoticesFilter(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	restore := state.MockTime(t0)
+	defer restore()
+	st.AddNotice(state.SnapInstalledNotice, "foo", nil)
+	restore = state.MockTime(t0.Add(time.Second))
+	defer restore()
+	st.AddNotice(state.SnapRemovedNotice, "bar", nil)
+	restore = state.MockTime(t0.Add(2 * time.Second))
+	defer restore()
+	st.AddNotice(state.RefreshInhibitNotice, "foo", nil)
+
+	keys := func(notices []*state.Notice) []string {
+		var ks []string
+		for _, n := range notices {
+			ks = append(ks, string(n.Type())+":"+n.Key())
+		}
+		return ks
+	}
+
+	c.Check(keys(st.Notices(&state.NoticeFilter{
+		Types: []state.NoticeType{state.SnapInstalledNotice, state.SnapRemovedNotice},
+	})), check.DeepEquals, []string{"snap-installed:foo", "snap-removed:bar"})
+	c.Check(keys(st.Notices(&state.NoticeFilter{
+		Keys: []string{"foo"},
+	})), check.DeepEquals, []string{"snap-installed:foo", "refresh-inhibit:foo"})
+	c.Check(keys(st.Notices(&state.NoticeFilter{
+		After: t0,
+	})), check.DeepEquals, []string{"snap-removed:bar", "refresh-inhibit:foo"})
+	c.Check(st.Notices(&state.NoticeFilter{
+		Types: []state.NoticeType{state.WarningNotice},
+	}), check.HasLen, 0)
+}
+
+func (stateSuite) TestNoticesExpire(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	restore := state.MockTime(time.Now().Add(-state.DefaultNoticeExpireAfter - time.Hour))
+	defer restore()
+	st.AddNotice(state.SnapInstalledNotice, "old", nil)
+	restore()
+	st.AddNotice(state.SnapInstalledNotice, "new", nil)
+
+	notices := st.Notices(nil)
+	c.Assert(notices, check.HasLen, 1)
+	c.Check(notices[0].Key(), check.Equals, "new")
+}
+
+func (stateSuite) TestNoticesRoundTrip(c *check.C) {
+	b := new(fakeStateBackend)
+	st := state.New(b)
+	st.Lock()
+	st.AddNotice(state.SnapInstalledNotice, "foo", map[string]string{"revision": "1"})
+	st.Unlock()
+
+	st2, err := state.ReadState(nil, bytes.NewReader(b.checkpoints[len(b.checkpoints)-1]))
+	c.Assert(err, check.IsNil)
+	st2.Lock()
+	defer st2.Unlock()
+
+	notices := st2.Notices(nil)
+	c.Assert(notices, check.HasLen, 1)
+	c.Check(notices[0].ID(), check.Equals, "1")
+	c.Check(notices[0].Key(), check.Equals, "foo")
+	c.Check(notices[0].LastData(), check.DeepEquals, map[string]string{"revision": "1"})
+
+	// the notice ids carry on
+	c.Check(st2.AddNotice(state.SnapRemovedNotice, "foo", nil), check.Equals, "2")
+}
+
+func (stateSuite) TestNoticeMarshalJSON(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	restore := state.MockTime(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	defer restore()
+	st.AddNotice(state.SnapInstalledNotice, "foo", map[string]string{"revision": "1"})
+
+	buf, err := json.Marshal(st.Notices(nil))
+	c.Assert(err, check.IsNil)
+	var v []map[string]interface{}
+	c.Assert(json.Unmarshal(buf, &v), check.IsNil)
+	c.Check(v, check.DeepEquals, []map[string]interface{}{{
+		"id":             "1",
+		"type":           "snap-installed",
+		"key":            "foo",
+		"first-occurred": "2020-01-01T00:00:00Z",
+		"last-occurred":  "2020-01-01T00:00:00Z",
+		"occurrences":    1.0,
+		"last-data":      map[string]interface{}{"revision": "1"},
+		"expire-after":   state.DefaultNoticeExpireAfter.String(),
+	}})
+}
+
+func (stateSuite) TestChangeAndWarningNotices(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	chg := st.NewChange("install", "...")
+	t := st.NewTask("download", "...")
+	chg.AddTask(t)
+	c.Check(st.Notices(nil), check.HasLen, 0)
+
+	t.SetStatus(state.DoingStatus)
+	notices := st.Notices(&state.NoticeFilter{Types: []state.NoticeType{state.ChangeUpdateNotice}})
+	c.Assert(notices, check.HasLen, 1)
+	c.Check(notices[0].Key(), check.Equals, chg.ID())
+	c.Check(notices[0].LastData(), check.DeepEquals, map[string]string{"kind": "install", "status": "Doing"})
+
+	// no change status transition, no new occurrence
+	t.SetStatus(state.DoingStatus)
+	c.Check(st.Notices(nil)[0].Occurrences(), check.Equals, 1)
+
+	t.SetStatus(state.DoneStatus)
+	notices = st.Notices(nil)
+	c.Assert(notices, check.HasLen, 1)
+	c.Check(notices[0].Occurrences(), check.Equals, 2)
+	c.Check(notices[0].LastData()["status"], check.Equals, "Done")
+
+	st.Warnf("hello")
+	notices = st.Notices(&state.NoticeFilter{Types: []state.NoticeType{state.WarningNotice}})
+	c.Assert(notices, check.HasLen, 1)
+	c.Check(notices[0].Key(), check.Equals, "hello")
+}
+
+func (stateSuite) TestWaitNoticesExisting(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	st.AddNotice(state.SnapInstalledNotice, "foo", nil)
+	notices, err := st.WaitNotices(context.Background(), nil)
+	c.Assert(err, check.IsNil)
+	c.Check(notices, check.HasLen, 1)
+}
+
+func (stateSuite) TestWaitNoticesNew(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		st.Lock()
+		defer st.Unlock()
+		// not matching the filter
+		st.AddNotice(state.SnapRemovedNotice, "foo", nil)
+		st.AddNotice(state.SnapInstalledNotice, "foo", nil)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	notices, err := st.WaitNotices(ctx, &state.NoticeFilter{Types: []state.NoticeType{state.SnapInstalledNotice}})
+	c.Assert(err, check.IsNil)
+	c.Assert(notices, check.HasLen, 1)
+	c.Check(notices[0].Type(), check.Equals, state.SnapInstalledNotice)
+}
+
+func (stateSuite) TestWaitNoticesTimeout(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	notices, err := st.WaitNotices(ctx, nil)
+	c.Assert(err, check.Equals, context.DeadlineExceeded)
+	c.Check(notices, check.HasLen, 0)
+}
@@ -83,6 +83,9 @@ const (
 	// RestartSocket will restart the daemon so that it goes into
 	// socket activation mode.
 	RestartSocket
+	// StopDaemon will stop the daemon for good, as is done at the
+	// end of preseeding.
+	StopDaemon
 )
 
 // State represents an evolving system state that persists across restarts.
@@ -94,18 +97,28 @@ const (
 // The state is persisted on every unlock operation via the StateBackend
 // it was initialized with.
 type State struct {
+	// lockStart is when the lock was last acquired, in nanoseconds
+	// since the epoch, or zero if it's not held. It's kept first so
+	// that it's 64-bit aligned for atomic access on 32-bit systems.
+	lockStart int64
+
 	mu  sync.Mutex
 	muC int32
 
 	lastTaskId   int
 	lastChangeId int
 	lastLaneId   int
+	lastNoticeId int
 
 	backend  Backend
 	data     customData
 	changes  map[string]*Change
 	tasks    map[string]*Task
 	warnings map[string]*Warning
+	notices  map[string]*Notice
+
+	// noticeCond is used to wake up WaitNotices waiters
+	noticeCond *sync.Cond
 
 	modified bool
 
@@ -118,15 +131,18 @@ type State struct {
 
 // New returns a new empty state.
 func New(backend Backend) *State {
-	return &State{
+	s := &State{
 		backend:  backend,
 		data:     make(customData),
 		changes:  make(map[string]*Change),
 		tasks:    make(map[string]*Task),
 		warnings: make(map[string]*Warning),
+		notices:  make(map[string]*Notice),
 		modified: true,
 		cache:    make(map[interface{}]interface{}),
 	}
+	s.noticeCond = sync.NewCond(&s.mu)
+	return s
 }
 
 // Modified returns whether the state was modified since the last checkpoint.
@@ -137,7 +153,30 @@ func (s *State) Modified() bool {
 // Lock acquires the state lock.
 func (s *State) Lock() {
 	s.mu.Lock()
+	s.acquired()
+}
+
+// acquired must be called right after the state mutex is acquired.
+func (s *State) acquired() {
 	atomic.AddInt32(&s.muC, 1)
+	atomic.StoreInt64(&s.lockStart, time.Now().UnixNano())
+}
+
+// releasing must be called right before the state mutex is released.
+func (s *State) releasing() {
+	start := atomic.SwapInt64(&s.lockStart, 0)
+	lockHoldSeconds.Observe(time.Since(time.Unix(0, start)).Seconds())
+	atomic.AddInt32(&s.muC, -1)
+}
+
+// LockHeldFor returns for how long the state lock has been held, or
+// zero if it isn't. It can be called without holding the lock.
+func (s *State) LockHeldFor() time.Duration {
+	start := atomic.LoadInt64(&s.lockStart)
+	if start == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, start))
 }
 
 func (s *State) reading() {
@@ -154,7 +193,7 @@ func (s *State) writing() {
 }
 
 func (s *State) unlock() {
-	atomic.AddInt32(&s.muC, -1)
+	s.releasing()
 	s.mu.Unlock()
 }
 
@@ -163,10 +202,12 @@ type marshalledState struct {
 	Changes  map[string]*Change          `json:"changes"`
 	Tasks    map[string]*Task            `json:"tasks"`
 	Warnings []*Warning                  `json:"warnings,omitempty"`
+	Notices  []*Notice                   `json:"notices,omitempty"`
 
 	LastChangeId int `json:"last-change-id"`
 	LastTaskId   int `json:"last-task-id"`
 	LastLaneId   int `json:"last-lane-id"`
+	LastNoticeId int `json:"last-notice-id,omitempty"`
 }
 
 // MarshalJSON makes State a json.Marshaller
@@ -177,10 +218,12 @@ func (s *State) MarshalJSON() ([]byte, error) {
 		Changes:  s.changes,
 		Tasks:    s.tasks,
 		Warnings: s.flattenWarnings(),
+		Notices:  s.flattenNotices(),
 
 		LastTaskId:   s.lastTaskId,
 		LastChangeId: s.lastChangeId,
 		LastLaneId:   s.lastLaneId,
+		LastNoticeId: s.lastNoticeId,
 	})
 }
 
@@ -196,9 +239,11 @@ func (s *State) UnmarshalJSON(data []byte) error {
 	s.changes = unmarshalled.Changes
 	s.tasks = unmarshalled.Tasks
 	s.unflattenWarnings(unmarshalled.Warnings)
+	s.unflattenNotices(unmarshalled.Notices)
 	s.lastChangeId = unmarshalled.LastChangeId
 	s.lastTaskId = unmarshalled.LastTaskId
 	s.lastLaneId = unmarshalled.LastLaneId
+	s.lastNoticeId = unmarshalled.LastNoticeId
 	// backlink state again
 	for _, t := range s.tasks {
 		t.state = s
@@ -399,6 +444,19 @@ func (s *State) NewTask(kind, summary string) *Task {
 	return t
 }
 
+// DiscardTasks removes the given tasks, which must not be linked to a
+// change, from the state. It is used to throw away the tasks built
+// only to look at what a change would do.
+func (s *State) DiscardTasks(tasks []*Task) {
+	s.writing()
+	for _, t := range tasks {
+		if chg := t.Change(); chg != nil {
+			panic(fmt.Sprintf("internal error: cannot discard task %s linked to change %s", t.ID(), chg.ID()))
+		}
+		delete(s.tasks, t.ID())
+	}
+}
+
 // Tasks returns all tasks currently known to the state and linked to changes.
 func (s *State) Tasks() []*Task {
 	s.reading()
@@ -519,5 +577,6 @@ func ReadState(backend Backend, r io.Reader) (*State, error) {
 	s.backend = backend
 	s.modified = false
 	s.cache = make(map[interface{}]interface{})
+	s.noticeCond = sync.NewCond(&s.mu)
 	return s, err
 }
@@ -55,6 +55,18 @@ func (ss *stateSuite) TestLockUnlock(c *C) {
 	st.Unlock()
 }
 
+func (ss *stateSuite) TestLockHeldFor(c *C) {
+	st := state.New(nil)
+	c.Check(st.LockHeldFor(), Equals, time.Duration(0))
+
+	st.Lock()
+	time.Sleep(time.Millisecond)
+	c.Check(st.LockHeldFor() >= time.Millisecond, Equals, true)
+	st.Unlock()
+
+	c.Check(st.LockHeldFor(), Equals, time.Duration(0))
+}
+
 func (ss *stateSuite) TestGetAndSet(c *C) {
 	st := state.New(nil)
 	st.Lock()
@@ -373,6 +385,35 @@ func (ss *stateSuite) TestNewChangeAndCheckpoint(c *C) {
 	}
 }
 
+func (ss *stateSuite) TestScheduledChangeCheckpoint(c *C) {
+	b := new(fakeStateBackend)
+	st := state.New(b)
+	st.Lock()
+
+	chg := st.NewChange("refresh", "...")
+	chg.AddTask(st.NewTask("download", "1..."))
+	when := time.Now().Add(time.Hour).Round(time.Second)
+	chg.ScheduleAt(when)
+	chgID := chg.ID()
+
+	// implicit checkpoint
+	st.Unlock()
+
+	c.Assert(b.checkpoints, HasLen, 1)
+
+	st2, err := state.ReadState(nil, bytes.NewReader(b.checkpoints[0]))
+	c.Assert(err, IsNil)
+
+	st2.Lock()
+	defer st2.Unlock()
+
+	chg2 := st2.Change(chgID)
+	c.Assert(chg2, NotNil)
+	c.Check(chg2.ScheduledTime().Equal(when), Equals, true)
+	c.Check(chg2.Status(), Equals, state.ScheduledStatus)
+	c.Check(chg2.Tasks()[0].AtTime().Equal(when), Equals, true)
+}
+
 func (ss *stateSuite) TestNewChangeAndCheckpointTaskDerivedStatus(c *C) {
 	b := new(fakeStateBackend)
 	st := state.New(b)
@@ -680,6 +721,37 @@ func (ss *stateSuite) TestNewTaskHiddenUntilLinked(c *C) {
 	c.Check(st.Task(t1.ID()), IsNil)
 }
 
+func (ss *stateSuite) TestDiscardTasks(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	t1 := st.NewTask("download", "...")
+	t2 := st.NewTask("check", "...")
+	t2.WaitFor(t1)
+	c.Check(st.TaskCount(), Equals, 2)
+
+	st.DiscardTasks([]*state.Task{t1, t2})
+	c.Check(st.TaskCount(), Equals, 0)
+
+	// discarded task ids are not reused
+	t3 := st.NewTask("download", "...")
+	c.Check(t3.ID(), Equals, "3")
+}
+
+func (ss *stateSuite) TestDiscardTasksLinkedPanics(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	chg := st.NewChange("install", "...")
+	t1 := st.NewTask("download", "...")
+	chg.AddTask(t1)
+
+	c.Check(func() { st.DiscardTasks([]*state.Task{t1}) }, PanicMatches, `internal error: cannot discard task 1 linked to change 1`)
+	c.Check(st.Task(t1.ID()), NotNil)
+}
+
 func (ss *stateSuite) TestMethodEntrance(c *C) {
 	st := state.New(&fakeStateBackend{})
 
@@ -693,6 +765,7 @@ func (ss *stateSuite) TestMethodEntrance(c *C) {
 		func() { st.NewTask("download", "...") },
 		func() { st.UnmarshalJSON(nil) },
 		func() { st.NewLane() },
+		func() { st.DiscardTasks(nil) },
 		func() { st.Warnf("hello") },
 		func() { st.OkayWarnings(time.Time{}) },
 		func() { st.UnshowAllWarnings() },
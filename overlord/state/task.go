@@ -200,13 +200,20 @@ func (t *Task) Status() Status {
 func (t *Task) SetStatus(new Status) {
 	t.state.writing()
 	old := t.status
+	chg := t.Change()
+	var oldChgStatus Status
+	if chg != nil {
+		oldChgStatus = chg.Status()
+	}
 	t.status = new
 	if !old.Ready() && new.Ready() {
 		t.readyTime = timeNow()
 	}
-	chg := t.Change()
 	if chg != nil {
 		chg.taskStatusChanged(t, old, new)
+		if chg.Status() != oldChgStatus {
+			chg.addNotice()
+		}
 	}
 }
 
@@ -194,6 +194,7 @@ func (r *TaskRunner) run(t *Task) {
 		t0 := time.Now()
 		tomb.Kill(handler(t, tomb))
 		t1 := time.Now()
+		taskRunSeconds.Observe(t1.Sub(t0).Seconds(), t.Kind())
 
 		// Locks must be acquired in the same order everywhere.
 		r.mu.Lock()
@@ -358,6 +359,7 @@ func (r *TaskRunner) Ensure() error {
 
 	ensureTime := timeNow()
 	nextTaskTime := time.Time{}
+	waiting := 0
 ConsiderTasks:
 	for _, t := range r.state.Tasks() {
 		handlers := r.handlerPair(t)
@@ -391,6 +393,7 @@ ConsiderTasks:
 
 		if mustWait(t) {
 			// Dependencies still unhandled.
+			waiting++
 			continue
 		}
 
@@ -411,6 +414,7 @@ ConsiderTasks:
 			if nextTaskTime.IsZero() || nextTaskTime.After(tWhen) {
 				nextTaskTime = tWhen
 			}
+			waiting++
 			continue
 		}
 
@@ -419,6 +423,7 @@ ConsiderTasks:
 		for _, blocked := range r.blocked {
 			if blocked(t, running) {
 				r.someBlocked = true
+				waiting++
 				continue ConsiderTasks
 			}
 		}
@@ -429,6 +434,9 @@ ConsiderTasks:
 		running = append(running, t)
 	}
 
+	runningTasks.Set(float64(len(r.tombs)))
+	waitingTasks.Set(float64(waiting))
+
 	// schedule next Ensure no later than the next task time
 	if !nextTaskTime.IsZero() {
 		r.state.EnsureBefore(nextTaskTime.Sub(ensureTime))
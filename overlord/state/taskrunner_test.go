@@ -20,6 +20,7 @@
 package state_test
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"sort"
@@ -31,6 +32,7 @@ import (
 	. "gopkg.in/check.v1"
 	"gopkg.in/tomb.v2"
 
+	"github.com/snapcore/snapd/metrics"
 	"github.com/snapcore/snapd/overlord/state"
 )
 
@@ -371,6 +373,55 @@ func (ts *taskRunnerSuite) TestExternalAbort(c *C) {
 	ensureChange(c, r, sb, chg)
 }
 
+func (ts *taskRunnerSuite) TestMetrics(c *C) {
+	sb := &stateBackend{}
+	st := state.New(sb)
+	r := state.NewTaskRunner(st)
+	defer r.Stop()
+
+	ch := make(chan bool)
+	r.AddHandler("metrics-blocking", func(t *state.Task, tb *tomb.Tomb) error {
+		ch <- true
+		<-ch
+		return nil
+	}, nil)
+	r.AddHandler("metrics-after", func(t *state.Task, tb *tomb.Tomb) error {
+		return nil
+	}, nil)
+
+	st.Lock()
+	chg := st.NewChange("metrics-test", "...")
+	t1 := st.NewTask("metrics-blocking", "...")
+	t2 := st.NewTask("metrics-after", "...")
+	t2.WaitFor(t1)
+	chg.AddTask(t1)
+	chg.AddTask(t2)
+	st.Unlock()
+
+	metricsText := func() string {
+		var buf bytes.Buffer
+		c.Assert(metrics.WriteText(&buf), IsNil)
+		return buf.String()
+	}
+
+	r.Ensure()
+	<-ch
+	out := metricsText()
+	c.Check(out, Matches, "(?s).*\nsnapd_taskrunner_running_tasks 1\n.*")
+	c.Check(out, Matches, "(?s).*\nsnapd_taskrunner_waiting_tasks 1\n.*")
+
+	ch <- true
+	ensureChange(c, r, sb, chg)
+	// nothing left to run or wait for
+	r.Ensure()
+
+	out = metricsText()
+	c.Check(out, Matches, "(?s).*\nsnapd_taskrunner_running_tasks 0\n.*")
+	c.Check(out, Matches, "(?s).*\nsnapd_taskrunner_waiting_tasks 0\n.*")
+	c.Check(out, Matches, `(?s).*\nsnapd_task_run_seconds_count\{kind="metrics-blocking"\} 1\n.*`)
+	c.Check(out, Matches, `(?s).*\nsnapd_change_duration_seconds_count\{kind="metrics-test",status="Done"\} 1\n.*`)
+}
+
 func (ts *taskRunnerSuite) TestStopHandlerJustFinishing(c *C) {
 	sb := &stateBackend{}
 	st := state.New(sb)
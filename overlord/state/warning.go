@@ -204,6 +204,7 @@ func (s *State) addWarning(w Warning, t time.Time) {
 		s.warnings[w.message] = &w
 	}
 	s.warnings[w.message].lastAdded = t
+	s.AddNotice(WarningNotice, w.message, nil)
 }
 
 type byLastAdded []*Warning
@@ -21,13 +21,30 @@ package overlord
 
 import (
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/metrics"
 
 	"github.com/snapcore/snapd/overlord/state"
 )
 
+var (
+	ensureDurationSeconds = metrics.NewHistogram("snapd_ensure_duration_seconds",
+		"Time spent in the Ensure of each state manager.", metrics.DefBuckets, "manager")
+	ensureErrors = metrics.NewCounter("snapd_ensure_errors_total",
+		"Number of errors returned by the Ensure of each state manager.", "manager")
+	ensureLastTimestamp = metrics.NewGauge("snapd_ensure_last_timestamp_seconds",
+		"Time of the end of the last ensure pass over all the state managers, in seconds since the epoch.")
+)
+
+// managerName returns the name of the manager type, for metrics.
+func managerName(m StateManager) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", m), "*")
+}
+
 // StateManager is implemented by types responsible for observing
 // the system and manipulating it to reflect the desired state.
 type StateManager interface {
@@ -145,12 +162,16 @@ func (se *StateEngine) Ensure() error {
 	}
 	var errs []error
 	for _, m := range se.managers {
+		start := time.Now()
 		err := m.Ensure()
+		ensureDurationSeconds.Observe(time.Since(start).Seconds(), managerName(m))
 		if err != nil {
 			logger.Noticef("state ensure error: %v", err)
+			ensureErrors.Inc(managerName(m))
 			errs = append(errs, err)
 		}
 	}
+	ensureLastTimestamp.Set(float64(time.Now().Unix()))
 	if len(errs) != 0 {
 		return &ensureError{errs}
 	}
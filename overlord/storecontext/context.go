@@ -230,10 +230,21 @@ func (sc *storeContext) deviceSessionRequestParams(nonce string) (*DeviceSession
 }
 
 // ProxyStoreParams returns the id and URL of the proxy store if one is set. Returns the defaultURL otherwise and id = "".
+// If the core store.local-dir option is set a file URL pointing to that directory is returned instead.
 func (sc *storeContext) ProxyStoreParams(defaultURL *url.URL) (proxyStoreID string, proxySroreURL *url.URL, err error) {
 	sc.state.Lock()
 	defer sc.state.Unlock()
 
+	tr := config.NewTransaction(sc.state)
+	var localDir string
+	err = tr.Get("core", "store.local-dir", &localDir)
+	if err != nil && !config.IsNoOption(err) {
+		return "", nil, err
+	}
+	if localDir != "" {
+		return "", &url.URL{Scheme: "file", Path: localDir}, nil
+	}
+
 	sto, err := sc.proxyStoreer.ProxyStore()
 	if err != nil && err != state.ErrNoState {
 		return "", nil, err
@@ -408,6 +408,23 @@ func (s *storeCtxSuite) TestWithDeviceAssertions(c *C) {
 	c.Check(proxyStoreURL, DeepEquals, fooURL)
 }
 
+func (s *storeCtxSuite) TestProxyStoreParamsLocalDir(c *C) {
+	// having assertions in state, including a proxy store
+	storeCtx := storecontext.New(s.state, &testBackend{})
+
+	s.state.Lock()
+	tr := config.NewTransaction(s.state)
+	tr.Set("core", "store.local-dir", "/srv/snaps")
+	tr.Commit()
+	s.state.Unlock()
+
+	// the local directory takes precedence over the proxy store
+	proxyStoreID, proxyStoreURL, err := storeCtx.ProxyStoreParams(s.defURL)
+	c.Assert(err, IsNil)
+	c.Check(proxyStoreID, Equals, "")
+	c.Check(proxyStoreURL.String(), Equals, "file:///srv/snaps")
+}
+
 func (s *storeCtxSuite) TestWithDeviceAssertionsGenericClassicModel(c *C) {
 	model, err := asserts.Decode([]byte(exModel))
 	c.Assert(err, IsNil)
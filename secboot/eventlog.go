@@ -0,0 +1,186 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package secboot
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/snapcore/snapd/dirs"
+)
+
+// the event log of the firmware, in the crypto agile format of the TCG
+// PC Client Platform Firmware Profile specification
+var eventLogPath = "/sys/kernel/security/tpm0/binary_bios_measurements"
+
+const (
+	// grub logs the files it measures with this event type
+	evIPL = 0x0d
+
+	algSHA256 = 0x000b
+)
+
+var specIDEventSignature = []byte("Spec ID Event03\x00")
+
+// GrubMeasurement is a measurement grub made when booting.
+type GrubMeasurement struct {
+	// Path is the path of the measured file as logged by grub, e.g.
+	// "(loop)/kernel.img", it is empty for other events
+	Path string
+	// Digest is the sha256 digest extended into the PCR
+	Digest []byte
+}
+
+// GrubMeasurements returns the measurements made in GrubPCR when
+// booting the running system, in order, as recorded in the event log
+// of the firmware.
+func GrubMeasurements() ([]GrubMeasurement, error) {
+	f, err := os.Open(filepath.Join(dirs.GlobalRootDir, eventLogPath))
+	if err != nil {
+		return nil, fmt.Errorf("cannot open boot event log: %v", err)
+	}
+	defer f.Close()
+
+	var measurements []GrubMeasurement
+	err = readEventLog(bufio.NewReader(f), func(pcr, eventType uint32, digest, data []byte) {
+		if pcr != GrubPCR {
+			return
+		}
+		m := GrubMeasurement{Digest: digest}
+		if eventType == evIPL {
+			m.Path = strings.TrimRight(string(data), "\x00")
+		}
+		measurements = append(measurements, m)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot read boot event log: %v", err)
+	}
+	return measurements, nil
+}
+
+// readEventLog reads the event log, calling f with the sha256 digest of
+// each event.
+func readEventLog(r io.Reader, f func(pcr, eventType uint32, digest, data []byte)) error {
+	// the first event is in the SHA1 only format and describes the
+	// digests of the following ones
+	var header struct {
+		PCR       uint32
+		EventType uint32
+		Digest    [20]byte
+		EventSize uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+	specID := make([]byte, header.EventSize)
+	if _, err := io.ReadFull(r, specID); err != nil {
+		return err
+	}
+	digestSizes, err := parseSpecIDEvent(specID)
+	if err != nil {
+		return err
+	}
+
+	for {
+		var event struct {
+			PCR         uint32
+			EventType   uint32
+			DigestCount uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &event); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		var digest []byte
+		for i := uint32(0); i < event.DigestCount; i++ {
+			var alg uint16
+			if err := binary.Read(r, binary.LittleEndian, &alg); err != nil {
+				return err
+			}
+			size, ok := digestSizes[alg]
+			if !ok {
+				return fmt.Errorf("unknown digest algorithm 0x%04x", alg)
+			}
+			d := make([]byte, size)
+			if _, err := io.ReadFull(r, d); err != nil {
+				return err
+			}
+			if alg == algSHA256 {
+				digest = d
+			}
+		}
+		if digest == nil {
+			return fmt.Errorf("event without sha256 digest in PCR %d", event.PCR)
+		}
+		var size uint32
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return err
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+		f(event.PCR, event.EventType, digest, data)
+	}
+}
+
+// parseSpecIDEvent returns the digest sizes of the algorithms listed
+// in the Spec ID event.
+func parseSpecIDEvent(data []byte) (map[uint16]uint16, error) {
+	if !bytes.HasPrefix(data, specIDEventSignature) {
+		return nil, fmt.Errorf("unsupported event log format")
+	}
+	r := bytes.NewReader(data[len(specIDEventSignature):])
+	var spec struct {
+		PlatformClass uint32
+		VersionMinor  uint8
+		VersionMajor  uint8
+		Errata        uint8
+		UintnSize     uint8
+		NumAlgorithms uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &spec); err != nil {
+		return nil, fmt.Errorf("cannot parse Spec ID event: %v", err)
+	}
+	sizes := make(map[uint16]uint16, spec.NumAlgorithms)
+	for i := uint32(0); i < spec.NumAlgorithms; i++ {
+		var alg struct {
+			ID   uint16
+			Size uint16
+		}
+		if err := binary.Read(r, binary.LittleEndian, &alg); err != nil {
+			return nil, fmt.Errorf("cannot parse Spec ID event: %v", err)
+		}
+		sizes[alg.ID] = alg.Size
+	}
+	if sizes[algSHA256] != sha256.Size {
+		return nil, fmt.Errorf("event log has no sha256 digests")
+	}
+	return sizes, nil
+}
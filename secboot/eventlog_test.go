@@ -0,0 +1,150 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package secboot_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/secboot"
+)
+
+type eventLogSuite struct {
+	logPath string
+}
+
+var _ = Suite(&eventLogSuite{})
+
+func (s *eventLogSuite) SetUpTest(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	s.logPath = filepath.Join(dirs.GlobalRootDir, "/sys/kernel/security/tpm0/binary_bios_measurements")
+	c.Assert(os.MkdirAll(filepath.Dir(s.logPath), 0755), IsNil)
+}
+
+func (s *eventLogSuite) TearDownTest(c *C) {
+	dirs.SetRootDir("")
+}
+
+type testEvent struct {
+	pcr       uint32
+	eventType uint32
+	content   string
+	data      string
+}
+
+func le(buf *bytes.Buffer, v interface{}) {
+	binary.Write(buf, binary.LittleEndian, v)
+}
+
+// eventLog returns a crypto agile event log with sha1 and sha256
+// digests of the events content.
+func eventLog(events ...testEvent) []byte {
+	var specID bytes.Buffer
+	specID.WriteString("Spec ID Event03\x00")
+	// platform class
+	le(&specID, uint32(0))
+	// version 2.0, errata 0, uintn size
+	specID.Write([]byte{0, 2, 0, 2})
+	le(&specID, uint32(2))
+	le(&specID, []uint16{0x0004, 20, 0x000b, 32})
+	// no vendor info
+	specID.WriteByte(0)
+
+	var buf bytes.Buffer
+	// EV_NO_ACTION in PCR 0
+	le(&buf, []uint32{0, 3})
+	buf.Write(make([]byte, 20))
+	le(&buf, uint32(specID.Len()))
+	buf.Write(specID.Bytes())
+
+	for _, ev := range events {
+		le(&buf, []uint32{ev.pcr, ev.eventType, 2})
+		sha1Digest := sha1.Sum([]byte(ev.content))
+		le(&buf, uint16(0x0004))
+		buf.Write(sha1Digest[:])
+		sha256Digest := sha256.Sum256([]byte(ev.content))
+		le(&buf, uint16(0x000b))
+		buf.Write(sha256Digest[:])
+		le(&buf, uint32(len(ev.data)))
+		buf.WriteString(ev.data)
+	}
+	return buf.Bytes()
+}
+
+func digest(content string) []byte {
+	d := sha256.Sum256([]byte(content))
+	return d[:]
+}
+
+func (s *eventLogSuite) TestGrubMeasurements(c *C) {
+	log := eventLog(
+		// EV_EFI_BOOT_SERVICES_APPLICATION of shim and grub
+		testEvent{4, 0x80000003, "shim", "\x00\x00"},
+		testEvent{4, 0x80000003, "grub", "\x00\x00"},
+		// EV_IPL events of grub
+		testEvent{9, 0x0d, "grub.cfg content", "(hd0,gpt2)/EFI/ubuntu/grub.cfg\x00"},
+		testEvent{8, 0x0d, "grub_cmd: linux (loop)/kernel.img", "grub_cmd: linux (loop)/kernel.img\x00"},
+		testEvent{9, 0x0d, "kernel content", "(loop)/kernel.img\x00"},
+		testEvent{9, 0x05, "some action", "action"},
+		testEvent{9, 0x0d, "initrd content", "(loop)/initrd.img\x00"},
+	)
+	c.Assert(ioutil.WriteFile(s.logPath, log, 0644), IsNil)
+
+	measurements, err := secboot.GrubMeasurements()
+	c.Assert(err, IsNil)
+	c.Check(measurements, DeepEquals, []secboot.GrubMeasurement{
+		{Path: "(hd0,gpt2)/EFI/ubuntu/grub.cfg", Digest: digest("grub.cfg content")},
+		{Path: "(loop)/kernel.img", Digest: digest("kernel content")},
+		{Digest: digest("some action")},
+		{Path: "(loop)/initrd.img", Digest: digest("initrd content")},
+	})
+}
+
+func (s *eventLogSuite) TestGrubMeasurementsNoEventLog(c *C) {
+	_, err := secboot.GrubMeasurements()
+	c.Assert(err, ErrorMatches, "cannot open boot event log: .*: no such file or directory")
+}
+
+func (s *eventLogSuite) TestGrubMeasurementsBadEventLog(c *C) {
+	log := eventLog(testEvent{9, 0x0d, "kernel content", "(loop)/kernel.img\x00"})
+
+	for _, t := range []struct {
+		log      []byte
+		expected string
+	}{
+		// not crypto agile
+		{bytes.Replace(log, []byte("Spec ID Event03"), []byte("Spec ID Event02"), 1), "unsupported event log format"},
+		// truncated
+		{log[:len(log)-5], "unexpected EOF"},
+		{log[:10], "unexpected EOF"},
+	} {
+		c.Assert(ioutil.WriteFile(s.logPath, t.log, 0644), IsNil)
+		_, err := secboot.GrubMeasurements()
+		c.Check(err, ErrorMatches, "cannot read boot event log: "+t.expected)
+	}
+}
@@ -0,0 +1,58 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package secboot
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// MockKeyring mocks the user keyring of root with the given map of
+// key descriptions to payloads.
+func MockKeyring(keys map[string][]byte, perms map[string]uint32) (restore func()) {
+	oldAdd, oldSetperm, oldSearch, oldRead := keyctlAddKey, keyctlSetperm, keyctlSearch, keyctlRead
+	var descs []string
+	keyctlAddKey = func(keyType, desc string, payload []byte, ringid int) (int, error) {
+		if keyType != "user" || ringid != unix.KEY_SPEC_USER_KEYRING {
+			return 0, unix.EINVAL
+		}
+		keys[desc] = append([]byte(nil), payload...)
+		descs = append(descs, desc)
+		return len(descs), nil
+	}
+	keyctlSetperm = func(id int, perm uint32) error {
+		perms[descs[id-1]] = perm
+		return nil
+	}
+	keyctlSearch = func(ringid int, keyType, desc string, destRingid int) (int, error) {
+		if _, ok := keys[desc]; !ok || keyType != "user" || ringid != unix.KEY_SPEC_USER_KEYRING {
+			return 0, unix.ENOKEY
+		}
+		descs = append(descs, desc)
+		return len(descs), nil
+	}
+	keyctlRead = func(id int, buf []byte) (int, error) {
+		payload := keys[descs[id-1]]
+		copy(buf, payload)
+		return len(payload), nil
+	}
+	return func() {
+		keyctlAddKey, keyctlSetperm, keyctlSearch, keyctlRead = oldAdd, oldSetperm, oldSearch, oldRead
+	}
+}
@@ -0,0 +1,77 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package secboot
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// keyDescription is the description of the key of the encrypted data
+// partition in the user keyring of root.
+const keyDescription = "snapd:fde:ubuntu-data"
+
+// the key is only readable by root, whether it possesses it or not, as
+// systemd does not link the user keyring into the session keyring of
+// the services it starts
+const keyPerm = 0x3f000000 | // possessor: all
+	0x000b0000 // user: view, read, search
+
+var (
+	keyctlAddKey  = unix.AddKey
+	keyctlSetperm = unix.KeyctlSetperm
+	keyctlSearch  = unix.KeyctlSearch
+	keyctlRead    = func(id int, buf []byte) (int, error) {
+		return unix.KeyctlBuffer(unix.KEYCTL_READ, id, buf, 0)
+	}
+)
+
+// StoreKeyInKeyring keeps the unsealed key of the encrypted data
+// partition in the user keyring of root, for snapd to reseal it after
+// the key can no longer be unsealed during this boot.
+func StoreKeyInKeyring(key EncryptionKey) error {
+	id, err := keyctlAddKey("user", keyDescription, key[:], unix.KEY_SPEC_USER_KEYRING)
+	if err != nil {
+		return fmt.Errorf("cannot add key to the kernel keyring: %v", err)
+	}
+	if err := keyctlSetperm(id, keyPerm); err != nil {
+		return fmt.Errorf("cannot set permissions of key in the kernel keyring: %v", err)
+	}
+	return nil
+}
+
+// KeyFromKeyring returns the key of the encrypted data partition kept
+// in the kernel keyring by StoreKeyInKeyring.
+func KeyFromKeyring() (EncryptionKey, error) {
+	id, err := keyctlSearch(unix.KEY_SPEC_USER_KEYRING, "user", keyDescription, 0)
+	if err != nil {
+		return EncryptionKey{}, fmt.Errorf("cannot find key in the kernel keyring: %v", err)
+	}
+	var key EncryptionKey
+	n, err := keyctlRead(id, key[:])
+	if err != nil {
+		return EncryptionKey{}, fmt.Errorf("cannot read key from the kernel keyring: %v", err)
+	}
+	if n != len(key) {
+		return EncryptionKey{}, fmt.Errorf("unexpected size of key in the kernel keyring: %d bytes", n)
+	}
+	return key, nil
+}
@@ -0,0 +1,49 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package secboot_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/secboot"
+)
+
+func (s *secbootSuite) TestKeyring(c *C) {
+	keys := make(map[string][]byte)
+	perms := make(map[string]uint32)
+	restore := secboot.MockKeyring(keys, perms)
+	defer restore()
+
+	_, err := secboot.KeyFromKeyring()
+	c.Assert(err, ErrorMatches, "cannot find key in the kernel keyring: required key not available")
+
+	c.Assert(secboot.StoreKeyInKeyring(mockKey()), IsNil)
+	key := mockKey()
+	c.Check(keys, DeepEquals, map[string][]byte{"snapd:fde:ubuntu-data": key[:]})
+	c.Check(perms, DeepEquals, map[string]uint32{"snapd:fde:ubuntu-data": 0x3f0b0000})
+
+	key, err = secboot.KeyFromKeyring()
+	c.Assert(err, IsNil)
+	c.Check(key, DeepEquals, mockKey())
+
+	keys["snapd:fde:ubuntu-data"] = []byte("short")
+	_, err = secboot.KeyFromKeyring()
+	c.Assert(err, ErrorMatches, "unexpected size of key in the kernel keyring: 5 bytes")
+}
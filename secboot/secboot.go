@@ -0,0 +1,149 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package secboot implements the encryption of the data partition of
+// Ubuntu Core systems, with its key sealed to the TPM so that it can
+// only be unsealed by the expected boot chain.
+package secboot
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/snapcore/snapd/osutil"
+)
+
+// EncryptionKey is the key of an encrypted partition.
+type EncryptionKey [64]byte
+
+// NewEncryptionKey returns a new random encryption key.
+func NewEncryptionKey() (EncryptionKey, error) {
+	var key EncryptionKey
+	if _, err := rand.Read(key[:]); err != nil {
+		return EncryptionKey{}, fmt.Errorf("cannot create encryption key: %v", err)
+	}
+	return key, nil
+}
+
+// RecoveryKey is a key an encrypted partition can also be unlocked
+// with, by typing it, when its sealed key cannot be unsealed.
+type RecoveryKey [16]byte
+
+// NewRecoveryKey returns a new random recovery key.
+func NewRecoveryKey() (RecoveryKey, error) {
+	var rkey RecoveryKey
+	if _, err := rand.Read(rkey[:]); err != nil {
+		return RecoveryKey{}, fmt.Errorf("cannot create recovery key: %v", err)
+	}
+	return rkey, nil
+}
+
+// String returns the recovery key as 8 groups of 5 digits, which is
+// the passphrase of its key slot.
+func (rkey RecoveryKey) String() string {
+	var buf bytes.Buffer
+	for i := 0; i < len(rkey); i += 2 {
+		if i > 0 {
+			buf.WriteByte('-')
+		}
+		fmt.Fprintf(&buf, "%05d", binary.LittleEndian.Uint16(rkey[i:]))
+	}
+	return buf.String()
+}
+
+func runWithKey(key EncryptionKey, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = bytes.NewReader(key[:])
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return osutil.OutputErr(output, err)
+	}
+	return nil
+}
+
+// FormatEncryptedDevice creates a LUKS2 encrypted container with the
+// given label on the device node, using the given key.
+func FormatEncryptedDevice(key EncryptionKey, label, node string) error {
+	// the key is random, there is no need for a costly key derivation
+	err := runWithKey(key, "cryptsetup",
+		"-q", "luksFormat", "--type", "luks2",
+		"--key-file", "-",
+		"--cipher", "aes-xts-plain64", "--key-size", "512",
+		"--pbkdf", "argon2i", "--iter-time", "1",
+		"--label", label,
+		node)
+	if err != nil {
+		return fmt.Errorf("cannot format encrypted device %s: %v", node, err)
+	}
+	return nil
+}
+
+// UnlockEncryptedDevice opens the LUKS2 encrypted container on the
+// device node with the given key, making it available as
+// /dev/mapper/<name>.
+func UnlockEncryptedDevice(name, node string, key EncryptionKey) error {
+	err := runWithKey(key, "cryptsetup",
+		"open", "--type", "luks2",
+		"--key-file", "-",
+		node, name)
+	if err != nil {
+		return fmt.Errorf("cannot unlock encrypted device %s: %v", node, err)
+	}
+	return nil
+}
+
+// AddRecoveryKey adds a key slot to the LUKS2 encrypted container on
+// the device node, opened with the given key, such that the container
+// can also be opened typing the recovery key.
+func AddRecoveryKey(key EncryptionKey, rkey RecoveryKey, node string) error {
+	// the key is read from stdin and the recovery key from a pipe,
+	// so that neither is ever written to disk
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = w.Write([]byte(rkey.String()))
+	w.Close()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("cryptsetup",
+		"luksAddKey", "--key-file", "-",
+		node, "/dev/fd/3")
+	cmd.Stdin = bytes.NewReader(key[:])
+	cmd.ExtraFiles = []*os.File{r}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("cannot add recovery key to encrypted device %s: %v", node, osutil.OutputErr(output, err))
+	}
+	return nil
+}
+
+// LockEncryptedDevice closes the unlocked encrypted container
+// available as /dev/mapper/<name>.
+func LockEncryptedDevice(name string) error {
+	if output, err := exec.Command("cryptsetup", "close", name).CombinedOutput(); err != nil {
+		return fmt.Errorf("cannot lock encrypted device %s: %v", name, osutil.OutputErr(output, err))
+	}
+	return nil
+}
@@ -0,0 +1,435 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package secboot_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/secboot"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type secbootSuite struct {
+	testutil.BaseTest
+
+	// TCTI of the software TPM simulator to run tests against, if any
+	simulatorTCTI string
+}
+
+var _ = Suite(&secbootSuite{})
+
+func (s *secbootSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+
+	s.simulatorTCTI = os.Getenv("SNAPD_TPM_TCTI")
+	os.Unsetenv("SNAPD_TPM_TCTI")
+	s.AddCleanup(func() { os.Setenv("SNAPD_TPM_TCTI", s.simulatorTCTI) })
+}
+
+func mockKey() secboot.EncryptionKey {
+	var key secboot.EncryptionKey
+	for i := range key {
+		key[i] = byte(i)
+	}
+	return key
+}
+
+func (s *secbootSuite) TestNewEncryptionKey(c *C) {
+	key1, err := secboot.NewEncryptionKey()
+	c.Assert(err, IsNil)
+	key2, err := secboot.NewEncryptionKey()
+	c.Assert(err, IsNil)
+	c.Check(key1, Not(DeepEquals), key2)
+}
+
+func (s *secbootSuite) TestFormatEncryptedDevice(c *C) {
+	keyFile := filepath.Join(c.MkDir(), "key")
+	cmd := testutil.MockCommand(c, "cryptsetup", "cat > "+keyFile)
+	defer cmd.Restore()
+
+	err := secboot.FormatEncryptedDevice(mockKey(), "ubuntu-data-enc", "/dev/node4")
+	c.Assert(err, IsNil)
+	c.Check(cmd.Calls(), DeepEquals, [][]string{
+		{"cryptsetup", "-q", "luksFormat", "--type", "luks2", "--key-file", "-",
+			"--cipher", "aes-xts-plain64", "--key-size", "512", "--pbkdf", "argon2i", "--iter-time", "1",
+			"--label", "ubuntu-data-enc", "/dev/node4"},
+	})
+	key := mockKey()
+	c.Check(keyFile, testutil.FileEquals, key[:])
+}
+
+func (s *secbootSuite) TestFormatEncryptedDeviceError(c *C) {
+	cmd := testutil.MockCommand(c, "cryptsetup", "echo 'Device /dev/node4 does not exist'; exit 1")
+	defer cmd.Restore()
+
+	err := secboot.FormatEncryptedDevice(mockKey(), "ubuntu-data-enc", "/dev/node4")
+	c.Assert(err, ErrorMatches, "cannot format encrypted device /dev/node4: Device /dev/node4 does not exist")
+}
+
+func (s *secbootSuite) TestUnlockEncryptedDevice(c *C) {
+	keyFile := filepath.Join(c.MkDir(), "key")
+	cmd := testutil.MockCommand(c, "cryptsetup", "cat > "+keyFile)
+	defer cmd.Restore()
+
+	err := secboot.UnlockEncryptedDevice("ubuntu-data", "/dev/node4", mockKey())
+	c.Assert(err, IsNil)
+	c.Check(cmd.Calls(), DeepEquals, [][]string{
+		{"cryptsetup", "open", "--type", "luks2", "--key-file", "-", "/dev/node4", "ubuntu-data"},
+	})
+	key := mockKey()
+	c.Check(keyFile, testutil.FileEquals, key[:])
+}
+
+func (s *secbootSuite) TestUnlockEncryptedDeviceError(c *C) {
+	cmd := testutil.MockCommand(c, "cryptsetup", "echo 'No key available with this passphrase.'; exit 2")
+	defer cmd.Restore()
+
+	err := secboot.UnlockEncryptedDevice("ubuntu-data", "/dev/node4", mockKey())
+	c.Assert(err, ErrorMatches, "cannot unlock encrypted device /dev/node4: No key available with this passphrase.")
+}
+
+func (s *secbootSuite) TestRecoveryKey(c *C) {
+	rkey1, err := secboot.NewRecoveryKey()
+	c.Assert(err, IsNil)
+	rkey2, err := secboot.NewRecoveryKey()
+	c.Assert(err, IsNil)
+	c.Check(rkey1, Not(DeepEquals), rkey2)
+	c.Check(rkey1.String(), Matches, `[0-9]{5}(-[0-9]{5}){7}`)
+
+	rkey := secboot.RecoveryKey{0xe1, 0xf0, 0x1, 0x0, 0xff, 0xff}
+	c.Check(rkey.String(), Equals, "61665-00001-65535-00000-00000-00000-00000-00000")
+}
+
+func (s *secbootSuite) TestAddRecoveryKey(c *C) {
+	d := c.MkDir()
+	keyFile := filepath.Join(d, "key")
+	rkeyFile := filepath.Join(d, "rkey")
+	cmd := testutil.MockCommand(c, "cryptsetup", "cat > "+keyFile+"; cat /dev/fd/3 > "+rkeyFile)
+	defer cmd.Restore()
+
+	rkey := secboot.RecoveryKey{0xe1, 0xf0, 0x1}
+	err := secboot.AddRecoveryKey(mockKey(), rkey, "/dev/node4")
+	c.Assert(err, IsNil)
+	c.Check(cmd.Calls(), DeepEquals, [][]string{
+		{"cryptsetup", "luksAddKey", "--key-file", "-", "/dev/node4", "/dev/fd/3"},
+	})
+	key := mockKey()
+	c.Check(keyFile, testutil.FileEquals, key[:])
+	c.Check(rkeyFile, testutil.FileEquals, "61665-00001-00000-00000-00000-00000-00000-00000")
+}
+
+func (s *secbootSuite) TestAddRecoveryKeyError(c *C) {
+	cmd := testutil.MockCommand(c, "cryptsetup", "echo 'No key available with this passphrase.'; exit 2")
+	defer cmd.Restore()
+
+	err := secboot.AddRecoveryKey(mockKey(), secboot.RecoveryKey{}, "/dev/node4")
+	c.Assert(err, ErrorMatches, "cannot add recovery key to encrypted device /dev/node4: No key available with this passphrase.")
+}
+
+func (s *secbootSuite) TestLockEncryptedDevice(c *C) {
+	cmd := testutil.MockCommand(c, "cryptsetup", "")
+	defer cmd.Restore()
+
+	c.Assert(secboot.LockEncryptedDevice("ubuntu-data"), IsNil)
+	c.Check(cmd.Calls(), DeepEquals, [][]string{
+		{"cryptsetup", "close", "ubuntu-data"},
+	})
+}
+
+func (s *secbootSuite) TestLockEncryptedDeviceError(c *C) {
+	cmd := testutil.MockCommand(c, "cryptsetup", "echo 'Device ubuntu-data is still in use.'; exit 5")
+	defer cmd.Restore()
+
+	err := secboot.LockEncryptedDevice("ubuntu-data")
+	c.Assert(err, ErrorMatches, "cannot lock encrypted device ubuntu-data: Device ubuntu-data is still in use.")
+}
+
+func (s *secbootSuite) TestBootChainPCRValue(c *C) {
+	chain := secboot.MeasureBootChain([]byte("grub.cfg"), []byte("kernel.img"))
+	c.Assert(chain, HasLen, 2)
+
+	// same contents, same value
+	c.Check(chain.PCRValue(), DeepEquals, secboot.MeasureBootChain([]byte("grub.cfg"), []byte("kernel.img")).PCRValue())
+	// the order matters
+	c.Check(chain.PCRValue(), Not(DeepEquals), secboot.MeasureBootChain([]byte("kernel.img"), []byte("grub.cfg")).PCRValue())
+	// an empty chain leaves the PCR untouched
+	c.Check(secboot.BootChain(nil).PCRValue(), DeepEquals, make([]byte, 32))
+}
+
+var (
+	// the values the firmware measured in PCRs 4 and 7
+	bootManagerPCR      = bytes.Repeat([]byte{4}, 32)
+	secureBootPolicyPCR = bytes.Repeat([]byte{7}, 32)
+)
+
+// pcrValues returns the values of PCRs 4, 7 and 9, as held by the
+// pcrValueFile of mockTPMTools.
+func pcrValues(pcr4, pcr7 []byte, chain secboot.BootChain) []byte {
+	values := append(append([]byte(nil), pcr4...), pcr7...)
+	return append(values, chain.PCRValue()...)
+}
+
+// mockTPMTools mocks the tpm2-tools, the sealed objects hold the values
+// of PCRs 4, 7 and 9 they were sealed to followed by the key, unsealing
+// checks the PCR values against the ones in pcrValueFile. PCRs 4 and 7
+// of the running system are bootManagerPCR and secureBootPolicyPCR.
+func mockTPMTools(c *C, pcrValueFile string) *testutil.MockCmd {
+	c.Assert(ioutil.WriteFile(pcrValueFile, pcrValues(bootManagerPCR, secureBootPolicyPCR, nil), 0644), IsNil)
+
+	cmd := testutil.MockCommand(c, "tpm2_createprimary", `
+while [ $# -gt 0 ]; do [ "$1" = "-c" ] && touch "$2"; shift; done`)
+	cmd.Also("tpm2_createpolicy", `
+while [ $# -gt 0 ]; do
+    case "$1" in
+    -f) pcrs="$2";;
+    -L) policy="$2";;
+    esac
+    shift
+done
+cp "$pcrs" "$policy"`)
+	cmd.Also("tpm2_create", `
+while [ $# -gt 0 ]; do
+    case "$1" in
+    -L) policy="$2";;
+    -u) pub="$2";;
+    -r) priv="$2";;
+    esac
+    shift
+done
+cp "$policy" "$pub"
+cat > "$priv"`)
+	cmd.Also("tpm2_load", `
+while [ $# -gt 0 ]; do
+    case "$1" in
+    -u) pub="$2";;
+    -r) priv="$2";;
+    -c) ctx="$2";;
+    esac
+    shift
+done
+cat "$pub" "$priv" > "$ctx"`)
+	cmd.Also("tpm2_pcrread", `
+while [ $# -gt 0 ]; do
+    case "$1" in
+    -o) out="$2";;
+    sha256:*) selection="$1";;
+    esac
+    shift
+done
+[ "$selection" = "sha256:4,7" ] || { echo "unexpected selection $selection" >&2; exit 1; }
+head -c 64 "`+pcrValueFile+`" > "$out"`)
+	cmd.Also("tpm2_unseal", `
+ctx="$2"
+head -c 96 "$ctx" | cmp -s - "`+pcrValueFile+`" || { echo "ERROR: policy check failed" >&2; exit 1; }
+tail -c +97 "$ctx"`)
+	// extending PCR 9 only
+	cmd.Also("tpm2_pcrextend", `
+head -c 64 "`+pcrValueFile+`" > "`+pcrValueFile+`.new"
+echo "$1" >> "`+pcrValueFile+`.new"
+mv "`+pcrValueFile+`.new" "`+pcrValueFile+`"`)
+	return cmd
+}
+
+func (s *secbootSuite) TestSealUnsealKey(c *C) {
+	pcrValueFile := filepath.Join(c.MkDir(), "pcr")
+	cmd := mockTPMTools(c, pcrValueFile)
+	defer cmd.Restore()
+
+	dir := filepath.Join(c.MkDir(), "fde")
+	c.Check(secboot.HasSealedKey(dir), Equals, false)
+
+	chain1 := secboot.MeasureBootChain([]byte("grub.cfg"), []byte("kernel 1"))
+	chain2 := secboot.MeasureBootChain([]byte("grub.cfg"), []byte("kernel 2"))
+	err := secboot.SealKey(mockKey(), dir, chain1, chain2)
+	c.Assert(err, IsNil)
+	c.Check(secboot.HasSealedKey(dir), Equals, true)
+	c.Check(filepath.Join(dir, "sealed-key-0.pub"), testutil.FilePresent)
+	c.Check(filepath.Join(dir, "sealed-key-1.priv"), testutil.FilePresent)
+	c.Check(dir+".new", testutil.FileAbsent)
+
+	// sealed to PCRs 4 and 7 of the running system too
+	calls := cmd.Calls()
+	c.Assert(calls, HasLen, 6)
+	c.Check(calls[1], DeepEquals, []string{"tpm2_pcrread", "-Q", "-o", calls[1][3], "sha256:4,7"})
+	c.Check(calls[2][:5], DeepEquals, []string{"tpm2_createpolicy", "-Q", "--policy-pcr", "-l", "sha256:4,7,9"})
+	c.Check(filepath.Join(dir, "sealed-key-1.pub"), testutil.FileEquals, pcrValues(bootManagerPCR, secureBootPolicyPCR, chain2))
+
+	// booted with the second chain
+	c.Assert(ioutil.WriteFile(pcrValueFile, pcrValues(bootManagerPCR, secureBootPolicyPCR, chain2), 0644), IsNil)
+	cmd.ForgetCalls()
+	key, err := secboot.UnsealKey(dir)
+	c.Assert(err, IsNil)
+	c.Check(key, DeepEquals, mockKey())
+
+	calls = cmd.Calls()
+	c.Assert(calls, HasLen, 6)
+	c.Check(calls[0][0], Equals, "tpm2_createprimary")
+	c.Check(calls[1][0], Equals, "tpm2_load")
+	c.Check(calls[2][:4], DeepEquals, []string{"tpm2_unseal", "-c", calls[1][9], "-p"})
+	c.Check(calls[2][4], Equals, "pcr:sha256:4,7,9")
+	// the PCR is capped once the key was unsealed
+	c.Check(calls[5], DeepEquals, []string{"tpm2_pcrextend", "9:sha256=00e80b44732e7658167d8504f8939268a7df48626233bbf917b1b2fa73b04950"})
+
+	// so it cannot be unsealed again
+	_, err = secboot.UnsealKey(dir)
+	c.Assert(err, ErrorMatches, `(?s)cannot unseal key:
+- cannot unseal key 0: ERROR: policy check failed
+- cannot unseal key 1: ERROR: policy check failed`)
+
+	// booted with something else
+	c.Assert(ioutil.WriteFile(pcrValueFile, pcrValues(bootManagerPCR, secureBootPolicyPCR, secboot.MeasureBootChain([]byte("other"))), 0644), IsNil)
+	_, err = secboot.UnsealKey(dir)
+	c.Assert(err, ErrorMatches, `(?s)cannot unseal key:
+- cannot unseal key 0: ERROR: policy check failed
+- cannot unseal key 1: ERROR: policy check failed`)
+}
+
+func (s *secbootSuite) TestUnsealKeyReplayedChain(c *C) {
+	pcrValueFile := filepath.Join(c.MkDir(), "pcr")
+	cmd := mockTPMTools(c, pcrValueFile)
+	defer cmd.Restore()
+
+	dir := filepath.Join(c.MkDir(), "fde")
+	chain := secboot.MeasureBootChain([]byte("grub.cfg"), []byte("kernel.img"), []byte("initrd.img"))
+	c.Assert(secboot.SealKey(mockKey(), dir, chain), IsNil)
+
+	// other boot media replaying the measurements of the boot chain
+	// into PCR 9 cannot replay those of the firmware
+	for _, pcrs := range [][]byte{
+		pcrValues(bytes.Repeat([]byte{0x44}, 32), secureBootPolicyPCR, chain),
+		pcrValues(bootManagerPCR, bytes.Repeat([]byte{0x77}, 32), chain),
+	} {
+		c.Assert(ioutil.WriteFile(pcrValueFile, pcrs, 0644), IsNil)
+		_, err := secboot.UnsealKey(dir)
+		c.Check(err, ErrorMatches, `(?s)cannot unseal key:
+- cannot unseal key 0: ERROR: policy check failed`)
+	}
+
+	// only the genuine boot can
+	c.Assert(ioutil.WriteFile(pcrValueFile, pcrValues(bootManagerPCR, secureBootPolicyPCR, chain), 0644), IsNil)
+	key, err := secboot.UnsealKey(dir)
+	c.Assert(err, IsNil)
+	c.Check(key, DeepEquals, mockKey())
+}
+
+func (s *secbootSuite) TestSealKeyReadPCRsError(c *C) {
+	cmd := mockTPMTools(c, filepath.Join(c.MkDir(), "pcr"))
+	defer cmd.Restore()
+	cmd.Also("tpm2_pcrread", "echo 'ERROR: Esys_PCR_Read(0x902) - tcti:IO failure' >&2; exit 1")
+
+	dir := filepath.Join(c.MkDir(), "fde")
+	err := secboot.SealKey(mockKey(), dir, secboot.MeasureBootChain([]byte("kernel")))
+	c.Assert(err, ErrorMatches, `cannot read PCRs: ERROR: Esys_PCR_Read\(0x902\) - tcti:IO failure`)
+	c.Check(dir, testutil.FileAbsent)
+}
+
+func (s *secbootSuite) TestResealKeyReplaces(c *C) {
+	pcrValueFile := filepath.Join(c.MkDir(), "pcr")
+	cmd := mockTPMTools(c, pcrValueFile)
+	defer cmd.Restore()
+
+	dir := filepath.Join(c.MkDir(), "fde")
+	chain1 := secboot.MeasureBootChain([]byte("kernel 1"))
+	chain2 := secboot.MeasureBootChain([]byte("kernel 2"))
+	c.Assert(secboot.SealKey(mockKey(), dir, chain1, chain2), IsNil)
+	c.Assert(secboot.SealKey(mockKey(), dir, chain2), IsNil)
+
+	c.Check(filepath.Join(dir, "sealed-key-0.pub"), testutil.FilePresent)
+	c.Check(filepath.Join(dir, "sealed-key-1.pub"), testutil.FileAbsent)
+	c.Check(dir+".old", testutil.FileAbsent)
+}
+
+func (s *secbootSuite) TestSealKeyUsesTCTI(c *C) {
+	os.Setenv("SNAPD_TPM_TCTI", "swtpm:port=2321")
+	cmd := mockTPMTools(c, filepath.Join(c.MkDir(), "pcr"))
+	defer cmd.Restore()
+
+	err := secboot.SealKey(mockKey(), filepath.Join(c.MkDir(), "fde"), secboot.MeasureBootChain([]byte("kernel")))
+	c.Assert(err, IsNil)
+	for _, call := range cmd.Calls() {
+		c.Check(call[1:3], DeepEquals, []string{"--tcti", "swtpm:port=2321"})
+	}
+}
+
+func (s *secbootSuite) TestSealKeyError(c *C) {
+	cmd := testutil.MockCommand(c, "tpm2_createprimary", "echo 'ERROR: Esys_CreatePrimary(0x902) - tcti:IO failure' >&2; exit 1")
+	defer cmd.Restore()
+
+	dir := filepath.Join(c.MkDir(), "fde")
+	err := secboot.SealKey(mockKey(), dir, secboot.MeasureBootChain([]byte("kernel")))
+	c.Assert(err, ErrorMatches, "cannot create primary key: ERROR: Esys_CreatePrimary\\(0x902\\) - tcti:IO failure")
+	c.Check(dir, testutil.FileAbsent)
+	c.Check(dir+".new", testutil.FileAbsent)
+}
+
+func (s *secbootSuite) TestSealKeyNoChains(c *C) {
+	err := secboot.SealKey(mockKey(), c.MkDir())
+	c.Assert(err, ErrorMatches, "internal error: cannot seal key without boot chains")
+}
+
+func (s *secbootSuite) TestUnsealKeyCapError(c *C) {
+	pcrValueFile := filepath.Join(c.MkDir(), "pcr")
+	cmd := mockTPMTools(c, pcrValueFile)
+	defer cmd.Restore()
+	cmd.Also("tpm2_pcrextend", "echo 'ERROR: Esys_PCR_Extend(0x98e) - tpm:session(1):authorization failure' >&2; exit 1")
+
+	dir := filepath.Join(c.MkDir(), "fde")
+	chain := secboot.MeasureBootChain([]byte("kernel"))
+	c.Assert(secboot.SealKey(mockKey(), dir, chain), IsNil)
+	c.Assert(ioutil.WriteFile(pcrValueFile, pcrValues(bootManagerPCR, secureBootPolicyPCR, chain), 0644), IsNil)
+
+	// the key is not handed out if the PCR cannot be capped
+	_, err := secboot.UnsealKey(dir)
+	c.Assert(err, ErrorMatches, `cannot cap PCR 9: ERROR: Esys_PCR_Extend\(0x98e\) - tpm:session\(1\):authorization failure`)
+}
+
+func (s *secbootSuite) TestUnsealKeyNotSealed(c *C) {
+	dir := c.MkDir()
+	_, err := secboot.UnsealKey(dir)
+	c.Assert(err, ErrorMatches, "cannot find sealed key in "+dir)
+}
+
+// TestSimulatorRoundTrip seals and unseals a key with a real TPM, it
+// runs only when SNAPD_TPM_TCTI points to a software TPM simulator
+// (e.g. swtpm socket --tpm2 --server type=tcp,port=2321 ...) in which
+// PCR 9 was reset; unsealing caps it, so it must be reset again before
+// the next run. The key is sealed to whatever PCRs 4 and 7 hold.
+func (s *secbootSuite) TestSimulatorRoundTrip(c *C) {
+	if s.simulatorTCTI == "" {
+		c.Skip("SNAPD_TPM_TCTI is not set")
+	}
+	os.Setenv("SNAPD_TPM_TCTI", s.simulatorTCTI)
+
+	dir := filepath.Join(c.MkDir(), "fde")
+	// nothing was measured in the simulator
+	err := secboot.SealKey(mockKey(), dir, secboot.BootChain(nil))
+	c.Assert(err, IsNil)
+	key, err := secboot.UnsealKey(dir)
+	c.Assert(err, IsNil)
+	c.Check(key, DeepEquals, mockKey())
+}
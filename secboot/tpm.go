@@ -0,0 +1,277 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package secboot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/snapcore/snapd/osutil"
+)
+
+// The key is sealed with the tpm2-tools. When SNAPD_TPM_TCTI is set,
+// its value is used as the TCTI the tools use to reach the TPM, for
+// instance "swtpm:port=2321" for a software TPM simulator as used in
+// tests, otherwise the default TPM device is used.
+
+// The PCRs the key is sealed to.
+const (
+	// BootManagerPCR is where the firmware measures the images of the
+	// boot loaders it runs, shim and grub.
+	BootManagerPCR = 4
+	// SecureBootPolicyPCR is where the firmware measures the secure
+	// boot configuration.
+	SecureBootPolicyPCR = 7
+	// GrubPCR is where grub, with its tpm module, measures the files
+	// it reads.
+	GrubPCR = 9
+)
+
+// BootChain is the sequence of measurements grub makes in GrubPCR when
+// booting, in order.
+type BootChain [][]byte
+
+// MeasureBootChain returns the boot chain made of the given files
+// contents, in load order.
+func MeasureBootChain(contents ...[]byte) BootChain {
+	chain := make(BootChain, len(contents))
+	for i, content := range contents {
+		digest := sha256.Sum256(content)
+		chain[i] = digest[:]
+	}
+	return chain
+}
+
+// PCRValue returns the value of GrubPCR after booting with the boot
+// chain, each measurement extending the PCR from its initial zero value.
+func (chain BootChain) PCRValue() []byte {
+	pcr := make([]byte, sha256.Size)
+	for _, m := range chain {
+		h := sha256.New()
+		h.Write(pcr)
+		h.Write(m)
+		pcr = h.Sum(nil)
+	}
+	return pcr
+}
+
+// capMeasurement is extended into GrubPCR once the key was unsealed, so
+// that the key cannot be unsealed again until the next boot.
+var capMeasurement = sha256.Sum256([]byte("snapd: sealed key unsealed"))
+
+func tpmCommand(name string, args ...string) *exec.Cmd {
+	if tcti := os.Getenv("SNAPD_TPM_TCTI"); tcti != "" {
+		args = append([]string{"--tcti", tcti}, args...)
+	}
+	return exec.Command(name, args...)
+}
+
+func runTPM(stdin []byte, name string, args ...string) ([]byte, error) {
+	cmd := tpmCommand(name, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, osutil.OutputErr(stderr.Bytes(), err)
+	}
+	return output, nil
+}
+
+func createPrimary(workDir string) (string, error) {
+	primary := filepath.Join(workDir, "primary.ctx")
+	// the primary key is derived from the seed of the owner
+	// hierarchy, it is the same every time
+	if _, err := runTPM(nil, "tpm2_createprimary", "-Q", "-C", "o", "-g", "sha256", "-G", "ecc", "-c", primary); err != nil {
+		return "", fmt.Errorf("cannot create primary key: %v", err)
+	}
+	return primary, nil
+}
+
+func pcrSelection() string {
+	return fmt.Sprintf("sha256:%d,%d,%d", BootManagerPCR, SecureBootPolicyPCR, GrubPCR)
+}
+
+// readFirmwarePCRs returns the values of the PCRs the firmware measured
+// into when booting the running system: BootManagerPCR followed by
+// SecureBootPolicyPCR.
+func readFirmwarePCRs(workDir string) ([]byte, error) {
+	pcrsFile := filepath.Join(workDir, "firmware-pcrs.bin")
+	selection := fmt.Sprintf("sha256:%d,%d", BootManagerPCR, SecureBootPolicyPCR)
+	if _, err := runTPM(nil, "tpm2_pcrread", "-Q", "-o", pcrsFile, selection); err != nil {
+		return nil, fmt.Errorf("cannot read PCRs: %v", err)
+	}
+	pcrs, err := ioutil.ReadFile(pcrsFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(pcrs) != 2*sha256.Size {
+		return nil, fmt.Errorf("cannot read PCRs: unexpected size %d", len(pcrs))
+	}
+	return pcrs, nil
+}
+
+func sealedKeyFiles(dir string, i int) (pub, priv string) {
+	base := filepath.Join(dir, fmt.Sprintf("sealed-key-%d", i))
+	return base + ".pub", base + ".priv"
+}
+
+// SealKey seals the key to the TPM, such that it can be unsealed only
+// after booting with any of the given boot chains, with the firmware,
+// secure boot configuration and boot loader images of the running
+// system. Those are bound through BootManagerPCR and
+// SecureBootPolicyPCR, which cannot be replayed from the OS once the
+// firmware booted something else. The sealed key objects are written
+// to the given directory, replacing any previous ones.
+func SealKey(key EncryptionKey, dir string, chains ...BootChain) error {
+	if len(chains) == 0 {
+		return fmt.Errorf("internal error: cannot seal key without boot chains")
+	}
+
+	workDir, err := ioutil.TempDir("", "snapd-seal-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	newDir := dir + ".new"
+	if err := os.RemoveAll(newDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(newDir, 0700); err != nil {
+		return err
+	}
+	defer os.RemoveAll(newDir)
+
+	primary, err := createPrimary(workDir)
+	if err != nil {
+		return err
+	}
+	firmwarePCRs, err := readFirmwarePCRs(workDir)
+	if err != nil {
+		return err
+	}
+
+	for i, chain := range chains {
+		// the values in the order of the selection
+		pcrs := append(append([]byte(nil), firmwarePCRs...), chain.PCRValue()...)
+		pcrsFile := filepath.Join(workDir, "pcrs.bin")
+		if err := ioutil.WriteFile(pcrsFile, pcrs, 0600); err != nil {
+			return err
+		}
+		policy := filepath.Join(workDir, "policy.digest")
+		if _, err := runTPM(nil, "tpm2_createpolicy", "-Q", "--policy-pcr", "-l", pcrSelection(), "-f", pcrsFile, "-L", policy); err != nil {
+			return fmt.Errorf("cannot create PCR policy: %v", err)
+		}
+		pub, priv := sealedKeyFiles(newDir, i)
+		if _, err := runTPM(key[:], "tpm2_create", "-Q", "-C", primary, "-L", policy, "-i", "-", "-u", pub, "-r", priv); err != nil {
+			return fmt.Errorf("cannot seal key: %v", err)
+		}
+	}
+
+	// swap in the new sealed key objects
+	oldDir := dir + ".old"
+	if err := os.RemoveAll(oldDir); err != nil {
+		return err
+	}
+	if err := os.Rename(dir, oldDir); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(newDir, dir); err != nil {
+		return err
+	}
+	return os.RemoveAll(oldDir)
+}
+
+// HasSealedKey returns whether the directory holds sealed key objects.
+func HasSealedKey(dir string) bool {
+	pub, _ := sealedKeyFiles(dir, 0)
+	return osutil.FileExists(pub)
+}
+
+// capPCR extends GrubPCR, so that it no longer matches any of the boot
+// chains.
+func capPCR() error {
+	digest := fmt.Sprintf("%d:sha256=%x", GrubPCR, capMeasurement)
+	if _, err := runTPM(nil, "tpm2_pcrextend", digest); err != nil {
+		return fmt.Errorf("cannot cap PCR %d: %v", GrubPCR, err)
+	}
+	return nil
+}
+
+// UnsealKey unseals the key sealed with SealKey in the given directory,
+// which is only possible if the system booted with one of the boot
+// chains it was sealed to. GrubPCR is then capped, so the key cannot be
+// unsealed again until the next boot; the key is to be kept with
+// StoreKeyInKeyring for resealing it later.
+func UnsealKey(dir string) (EncryptionKey, error) {
+	if !HasSealedKey(dir) {
+		return EncryptionKey{}, fmt.Errorf("cannot find sealed key in %s", dir)
+	}
+
+	workDir, err := ioutil.TempDir("", "snapd-unseal-")
+	if err != nil {
+		return EncryptionKey{}, err
+	}
+	defer os.RemoveAll(workDir)
+
+	primary, err := createPrimary(workDir)
+	if err != nil {
+		return EncryptionKey{}, err
+	}
+
+	var errs []string
+	for i := 0; ; i++ {
+		pub, priv := sealedKeyFiles(dir, i)
+		if !osutil.FileExists(pub) {
+			break
+		}
+		keyCtx := filepath.Join(workDir, "key.ctx")
+		if _, err := runTPM(nil, "tpm2_load", "-Q", "-C", primary, "-u", pub, "-r", priv, "-c", keyCtx); err != nil {
+			errs = append(errs, fmt.Sprintf("cannot load sealed key %d: %v", i, err))
+			continue
+		}
+		output, err := runTPM(nil, "tpm2_unseal", "-c", keyCtx, "-p", "pcr:"+pcrSelection())
+		if err != nil {
+			// not sealed to the current boot chain
+			errs = append(errs, fmt.Sprintf("cannot unseal key %d: %v", i, err))
+			continue
+		}
+		var key EncryptionKey
+		if len(output) != len(key) {
+			errs = append(errs, fmt.Sprintf("unexpected size of unsealed key %d: %d bytes", i, len(output)))
+			continue
+		}
+		copy(key[:], output)
+		if err := capPCR(); err != nil {
+			return EncryptionKey{}, err
+		}
+		return key, nil
+	}
+	return EncryptionKey{}, fmt.Errorf("cannot unseal key:\n- %s", strings.Join(errs, "\n- "))
+}
@@ -0,0 +1,117 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package internal holds the seed metadata formats shared between
+// the seed reader and seedwriter.
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap/channel"
+	"github.com/snapcore/snapd/snap/naming"
+)
+
+var validSnapID = regexp.MustCompile("^[a-z0-9A-Z]{32}$")
+
+// Snap20 carries options for a model or extra snap in a Core 20
+// recovery system.
+type Snap20 struct {
+	Name string `yaml:"name"`
+	// SnapID is only recorded for extra snaps or model snaps the
+	// model does not give a snap-id for, to cross-reference them
+	SnapID string `yaml:"id,omitempty"`
+	// Unasserted has the filename for an unasserted local snap,
+	// to be found in the snaps directory of the system
+	Unasserted string `yaml:"unasserted,omitempty"`
+
+	Channel string `yaml:"channel,omitempty"`
+}
+
+// Options20 holds the options, as recorded in options.yaml, for a
+// Core 20 recovery system: extra snaps, unasserted snaps and
+// overridden channels.
+type Options20 struct {
+	Snaps []*Snap20 `yaml:"snaps"`
+}
+
+// ReadOptions20 reads and validates the given options.yaml file.
+func ReadOptions20(optionsFn string) (*Options20, error) {
+	errPrefix := "cannot read options yaml"
+
+	yamlData, err := ioutil.ReadFile(optionsFn)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", errPrefix, err)
+	}
+
+	var options Options20
+	if err := yaml.Unmarshal(yamlData, &options); err != nil {
+		return nil, fmt.Errorf("%s: cannot unmarshal %q: %s", errPrefix, yamlData, err)
+	}
+
+	seenNames := make(map[string]bool, len(options.Snaps))
+	// validate
+	for _, sn := range options.Snaps {
+		if sn == nil {
+			return nil, fmt.Errorf("%s: empty snaps element", errPrefix)
+		}
+		if err := naming.ValidateSnap(sn.Name); err != nil {
+			return nil, fmt.Errorf("%s: %v", errPrefix, err)
+		}
+		if sn.SnapID != "" && !validSnapID.MatchString(sn.SnapID) {
+			return nil, fmt.Errorf("%s: invalid snap-id %q for snap %q", errPrefix, sn.SnapID, sn.Name)
+		}
+		if sn.Channel != "" {
+			if _, err := channel.Parse(sn.Channel, ""); err != nil {
+				return nil, fmt.Errorf("%s: %v", errPrefix, err)
+			}
+		}
+		if sn.Unasserted != "" {
+			if sn.SnapID != "" {
+				return nil, fmt.Errorf("%s: unasserted snap %q cannot have a snap-id", errPrefix, sn.Name)
+			}
+			if strings.Contains(sn.Unasserted, "/") {
+				return nil, fmt.Errorf("%s: %q must be a filename, not a path", errPrefix, sn.Unasserted)
+			}
+		}
+
+		// make sure names are unique
+		if seenNames[sn.Name] {
+			return nil, fmt.Errorf("%s: snap name %q must be unique", errPrefix, sn.Name)
+		}
+		seenNames[sn.Name] = true
+	}
+
+	return &options, nil
+}
+
+// Write writes the options to the given file.
+func (options *Options20) Write(optionsFn string) error {
+	data, err := yaml.Marshal(options)
+	if err != nil {
+		return err
+	}
+	return osutil.AtomicWriteFile(optionsFn, data, 0644, 0)
+}
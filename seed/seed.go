@@ -22,6 +22,9 @@ package seed
 
 import (
 	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
 
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/snap"
@@ -91,8 +94,25 @@ type Seed interface {
 	ModeSnaps(mode string) ([]*Snap, error)
 }
 
+var validSystemLabel = regexp.MustCompile("^[a-zA-Z0-9](?:-?[a-zA-Z0-9])+$")
+
+// ValidateSystemLabel checks that the given label is valid for a
+// Core 20 recovery system.
+func ValidateSystemLabel(label string) error {
+	if !validSystemLabel.MatchString(label) {
+		return fmt.Errorf("invalid seed system label: %q", label)
+	}
+	return nil
+}
+
 // Open returns a Seed implementation for the seed at seedDir.
-// TODO: more parameters for the Core20 case
-func Open(seedDir string) (Seed, error) {
+// label if not empty is used to identify a Core 20 recovery system seed.
+func Open(seedDir, label string) (Seed, error) {
+	if label != "" {
+		if err := ValidateSystemLabel(label); err != nil {
+			return nil, err
+		}
+		return &seed20{seedDir: seedDir, systemDir: filepath.Join(seedDir, "systems", label)}, nil
+	}
 	return &seed16{seedDir: seedDir}, nil
 }
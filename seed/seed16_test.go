@@ -79,7 +79,7 @@ func (s *seed16Suite) SetUpTest(c *C) {
 	}, "")
 	assertstest.AddMany(s.StoreSigning, s.devAcct)
 
-	seed16, err := seed.Open(s.seedDir)
+	seed16, err := seed.Open(s.seedDir, "")
 	c.Assert(err, IsNil)
 	s.seed16 = seed16
 
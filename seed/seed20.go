@@ -0,0 +1,374 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package seed
+
+/* ATTN this should *not* use:
+
+* dirs package: it is passed an explicit directory to work on
+
+* release.OnClassic: it assumes classic based on the model classic
+  option; consistency between system and model can/must be enforced
+  elsewhere
+
+*/
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/seed/internal"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/timings"
+)
+
+// seed20 implements a Core 20 recovery system seed, that is a
+// systems/<label> directory carrying the model, the assertions and
+// the options of the system and referring to snaps in a snaps pool
+// shared by all the systems of the seed.
+type seed20 struct {
+	seedDir   string
+	systemDir string
+
+	db asserts.RODatabase
+
+	model *asserts.Model
+
+	snapDeclsByID map[string]*asserts.SnapDeclaration
+	snapRevsByID  map[string]*asserts.SnapRevision
+
+	snaps             []*Snap
+	essentialSnapsNum int
+	// modes of the non-essential snaps, in the same order
+	snapsModes [][]string
+}
+
+func (s *seed20) LoadAssertions(db asserts.RODatabase, commitTo func(*asserts.Batch) error) error {
+	if db == nil {
+		// a db was not provided, create an internal temporary one
+		var err error
+		db, commitTo, err = newMemAssertionsDB()
+		if err != nil {
+			return err
+		}
+	}
+
+	// collect snap-declarations and snap-revisions while loading
+	var declRefs, revRefs []*asserts.Ref
+	checkAssertion := func(ref *asserts.Ref) error {
+		switch ref.Type {
+		case asserts.ModelType:
+			return fmt.Errorf("system cannot have any model assertion but the one in the system model assertion file")
+		case asserts.SnapDeclarationType:
+			declRefs = append(declRefs, ref)
+		case asserts.SnapRevisionType:
+			revRefs = append(revRefs, ref)
+		}
+		return nil
+	}
+
+	batch, err := loadAssertions(filepath.Join(s.systemDir, "assertions"), checkAssertion)
+	if err != nil {
+		return err
+	}
+
+	refs, err := readAsserts(batch, filepath.Join(s.systemDir, "model"))
+	if err != nil {
+		return fmt.Errorf("cannot read system model assertion: %v", err)
+	}
+	if len(refs) != 1 || refs[0].Type != asserts.ModelType {
+		return fmt.Errorf("system model assertion file must contain exactly the model assertion")
+	}
+	modelRef := refs[0]
+
+	if err := commitTo(batch); err != nil {
+		return err
+	}
+
+	a, err := modelRef.Resolve(db.Find)
+	if err != nil {
+		return fmt.Errorf("internal error: cannot find just added assertion %v: %v", modelRef, err)
+	}
+	model := a.(*asserts.Model)
+	if model.Grade() == asserts.ModelGradeUnset {
+		return fmt.Errorf("system model assertion must have a grade")
+	}
+
+	s.snapDeclsByID = make(map[string]*asserts.SnapDeclaration, len(declRefs))
+	for _, declRef := range declRefs {
+		a, err := declRef.Resolve(db.Find)
+		if err != nil {
+			return fmt.Errorf("internal error: cannot find just added assertion %v: %v", declRef, err)
+		}
+		snapDecl := a.(*asserts.SnapDeclaration)
+		s.snapDeclsByID[snapDecl.SnapID()] = snapDecl
+	}
+
+	s.snapRevsByID = make(map[string]*asserts.SnapRevision, len(revRefs))
+	for _, revRef := range revRefs {
+		a, err := revRef.Resolve(db.Find)
+		if err != nil {
+			return fmt.Errorf("internal error: cannot find just added assertion %v: %v", revRef, err)
+		}
+		snapRevision := a.(*asserts.SnapRevision)
+		snapID := snapRevision.SnapID()
+		if s.snapRevsByID[snapID] != nil {
+			return fmt.Errorf("cannot have multiple snap-revisions for the same snap-id: %s", snapID)
+		}
+		s.snapRevsByID[snapID] = snapRevision
+	}
+
+	// remember db for later use
+	s.db = db
+	s.model = model
+
+	return nil
+}
+
+func (s *seed20) Model() (*asserts.Model, error) {
+	if s.model == nil {
+		return nil, fmt.Errorf("internal error: model assertion unset")
+	}
+	return s.model, nil
+}
+
+func (s *seed20) loadOptions() (map[string]*internal.Snap20, []*internal.Snap20, error) {
+	optionsFn := filepath.Join(s.systemDir, "options.yaml")
+	if !osutil.FileExists(optionsFn) {
+		return nil, nil, nil
+	}
+	if s.model.Grade() != asserts.ModelDangerous {
+		return nil, nil, fmt.Errorf("system with options can only have a model of grade dangerous")
+	}
+	options, err := internal.ReadOptions20(optionsFn)
+	if err != nil {
+		return nil, nil, err
+	}
+	byName := make(map[string]*internal.Snap20, len(options.Snaps))
+	for _, sn := range options.Snaps {
+		byName[sn.Name] = sn
+	}
+	return byName, options.Snaps, nil
+}
+
+// snapDeclByName finds the snap-declaration of the seed for the
+// snap with the given name, it is used when no snap-id is known.
+func (s *seed20) snapDeclByName(snapName string) *asserts.SnapDeclaration {
+	for _, snapDecl := range s.snapDeclsByID {
+		if snapDecl.SnapName() == snapName {
+			return snapDecl
+		}
+	}
+	return nil
+}
+
+func (s *seed20) assertedSnapPath(snapName, snapID string, tm timings.Measurer) (string, *snap.SideInfo, error) {
+	var snapDecl *asserts.SnapDeclaration
+	if snapID != "" {
+		snapDecl = s.snapDeclsByID[snapID]
+	} else {
+		snapDecl = s.snapDeclByName(snapName)
+	}
+	if snapDecl == nil {
+		return "", nil, fmt.Errorf("cannot find snap-declaration for snap %q in the system", snapName)
+	}
+	if snapDecl.SnapName() != snapName {
+		return "", nil, fmt.Errorf("cannot use snap-declaration for snap %q: it is for snap %q", snapName, snapDecl.SnapName())
+	}
+	snapID = snapDecl.SnapID()
+	snapRev := s.snapRevsByID[snapID]
+	if snapRev == nil {
+		return "", nil, fmt.Errorf("cannot find snap-revision for snap %q in the system", snapName)
+	}
+
+	snapRevision := snap.R(snapRev.SnapRevision())
+	path := filepath.Join(s.seedDir, "snaps", fmt.Sprintf("%s_%s.snap", snapName, snapRevision))
+
+	var snapSHA3_384 string
+	var snapSize uint64
+	var err error
+	timings.Run(tm, "derive-side-info", fmt.Sprintf("hash and derive side info for snap %q", snapName), func(nested timings.Measurer) {
+		snapSHA3_384, snapSize, err = asserts.SnapFileSHA3_384(path)
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot validate %q for snap %q: %v", path, snapName, err)
+	}
+	if snapSHA3_384 != snapRev.SnapSHA3_384() || snapSize != snapRev.SnapSize() {
+		return "", nil, fmt.Errorf("cannot validate %q for snap %q: it does not match the snap-revision in the system (broken or tampered)", path, snapName)
+	}
+
+	return path, &snap.SideInfo{
+		RealName: snapName,
+		SnapID:   snapID,
+		Revision: snapRevision,
+	}, nil
+}
+
+func (s *seed20) addSnap(snapName, snapID string, optSnap *internal.Snap20, defaultChannel string, tm timings.Measurer) (*Snap, error) {
+	channel := defaultChannel
+	if optSnap != nil && optSnap.Channel != "" {
+		channel = optSnap.Channel
+	}
+	seedSnap := &Snap{
+		Channel: channel,
+	}
+
+	if optSnap != nil && optSnap.Unasserted != "" {
+		path := filepath.Join(s.systemDir, "snaps", optSnap.Unasserted)
+		if !osutil.FileExists(path) {
+			return nil, fmt.Errorf("cannot find unasserted snap %q at %q", snapName, path)
+		}
+		seedSnap.Path = path
+		seedSnap.SideInfo = &snap.SideInfo{RealName: snapName}
+	} else {
+		if snapID == "" && optSnap != nil {
+			snapID = optSnap.SnapID
+		}
+		path, sideInfo, err := s.assertedSnapPath(snapName, snapID, tm)
+		if err != nil {
+			return nil, err
+		}
+		seedSnap.Path = path
+		seedSnap.SideInfo = sideInfo
+	}
+
+	// TODO: devmode for snaps in grade dangerous systems
+
+	s.snaps = append(s.snaps, seedSnap)
+
+	return seedSnap, nil
+}
+
+func (s *seed20) LoadMeta(tm timings.Measurer) error {
+	model, err := s.Model()
+	if err != nil {
+		return err
+	}
+
+	optSnaps, optSnapsList, err := s.loadOptions()
+	if err != nil {
+		return err
+	}
+
+	allSnaps := model.AllSnaps()
+	modelSnaps := make([]*asserts.ModelSnap, 0, len(allSnaps)+1)
+	// the snapd snap is always first, it is implicit if not
+	// mentioned by the model
+	hasSnapd := false
+	for _, modelSnap := range allSnaps {
+		if modelSnap.SnapName() == "snapd" {
+			hasSnapd = true
+			break
+		}
+	}
+	if !hasSnapd {
+		modelSnaps = append(modelSnaps, &asserts.ModelSnap{
+			Name:           "snapd",
+			SnapType:       "snapd",
+			Modes:          []string{"run", "ephemeral"},
+			DefaultChannel: "latest/stable",
+			Presence:       "required",
+		})
+	}
+	modelSnaps = append(modelSnaps, allSnaps...)
+
+	isEssential := func(modelSnap *asserts.ModelSnap) bool {
+		switch modelSnap.SnapType {
+		case "snapd", "kernel", "gadget":
+			return true
+		case "base":
+			return modelSnap.SnapName() == model.Base()
+		}
+		return false
+	}
+
+	added := make(map[string]bool, len(modelSnaps))
+	addModelSnap := func(modelSnap *asserts.ModelSnap) (*Snap, error) {
+		snapName := modelSnap.SnapName()
+		seedSnap, err := s.addSnap(snapName, modelSnap.SnapID, optSnaps[snapName], modelSnap.DefaultChannel, tm)
+		if err != nil {
+			return nil, err
+		}
+		seedSnap.Required = modelSnap.Presence != "optional"
+		added[snapName] = true
+		return seedSnap, nil
+	}
+
+	// add the essential snaps first
+	for _, modelSnap := range modelSnaps {
+		if !isEssential(modelSnap) {
+			continue
+		}
+		seedSnap, err := addModelSnap(modelSnap)
+		if err != nil {
+			return err
+		}
+		seedSnap.Essential = true
+		seedSnap.Required = true
+	}
+
+	s.essentialSnapsNum = len(s.snaps)
+
+	// the rest of the model snaps
+	for _, modelSnap := range modelSnaps {
+		if added[modelSnap.SnapName()] {
+			continue
+		}
+		if _, err := addModelSnap(modelSnap); err != nil {
+			return err
+		}
+		s.snapsModes = append(s.snapsModes, modelSnap.Modes)
+	}
+
+	// extra snaps from the options, available only in run mode
+	for _, optSnap := range optSnapsList {
+		if added[optSnap.Name] {
+			continue
+		}
+		if _, err := s.addSnap(optSnap.Name, "", optSnap, "latest/stable", tm); err != nil {
+			return err
+		}
+		s.snapsModes = append(s.snapsModes, []string{"run"})
+	}
+
+	return nil
+}
+
+func (s *seed20) UsesSnapdSnap() bool {
+	return true
+}
+
+func (s *seed20) EssentialSnaps() []*Snap {
+	return s.snaps[:s.essentialSnapsNum]
+}
+
+func (s *seed20) ModeSnaps(mode string) ([]*Snap, error) {
+	snaps := s.snaps[s.essentialSnapsNum:]
+	res := make([]*Snap, 0, len(snaps))
+	for i, sn := range snaps {
+		if !strutil.ListContains(s.snapsModes[i], mode) {
+			continue
+		}
+		res = append(res, sn)
+	}
+	return res, nil
+}
@@ -0,0 +1,503 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package seed_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/seed"
+	"github.com/snapcore/snapd/seed/seedtest"
+	"github.com/snapcore/snapd/seed/seedwriter"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/testutil"
+	"github.com/snapcore/snapd/timings"
+)
+
+type seed20Suite struct {
+	testutil.BaseTest
+
+	*seedtest.SeedSnaps
+
+	seedDir  string
+	snapRevs map[string]*asserts.SnapRevision
+
+	db *asserts.Database
+
+	perfTimings timings.Measurer
+}
+
+var _ = Suite(&seed20Suite{})
+
+var snapYaml20 = map[string]string{
+	"snapd": `name: snapd
+type: snapd
+version: 1.0
+`,
+	"core20": `name: core20
+type: base
+version: 1.0
+`,
+	"pc-kernel=20": `name: pc-kernel
+type: kernel
+version: 1.0
+`,
+	"pc=20": `name: pc
+type: gadget
+base: core20
+version: 1.0
+`,
+	"required20": `name: required20
+type: app
+base: core20
+version: 1.0
+`,
+	"optional20-a": `name: optional20-a
+type: app
+base: core20
+version: 1.0
+`,
+}
+
+func (s *seed20Suite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	s.AddCleanup(snap.MockSanitizePlugsSlots(func(snapInfo *snap.Info) {}))
+
+	s.SeedSnaps = &seedtest.SeedSnaps{}
+	s.SetupAssertSigning("canonical", s)
+	s.Brands.Register("my-brand", brandPrivKey, map[string]interface{}{
+		"verification": "verified",
+	})
+	assertstest.AddMany(s.StoreSigning, s.Brands.AccountsAndKeys("my-brand")...)
+
+	devAcct := assertstest.NewAccount(s.StoreSigning, "developer", map[string]interface{}{
+		"account-id": "developerid",
+	}, "")
+	assertstest.AddMany(s.StoreSigning, devAcct)
+
+	s.seedDir = c.MkDir()
+	s.snapRevs = make(map[string]*asserts.SnapRevision)
+
+	db, err := asserts.OpenDatabase(&asserts.DatabaseConfig{
+		Backstore: asserts.NewMemoryBackstore(),
+		Trusted:   s.StoreSigning.Trusted,
+	})
+	c.Assert(err, IsNil)
+	s.db = db
+
+	s.perfTimings = timings.New(nil)
+}
+
+func (s *seed20Suite) commitTo(b *asserts.Batch) error {
+	return b.CommitTo(s.db, nil)
+}
+
+func (s *seed20Suite) makeSnap(c *C, yamlKey, publisher string) {
+	if publisher == "" {
+		publisher = "canonical"
+	}
+	decl, rev := s.MakeAssertedSnap(c, snapYaml20[yamlKey], nil, snap.R(1), publisher)
+	assertstest.AddMany(s.StoreSigning, decl, rev)
+	s.snapRevs[decl.SnapName()] = rev
+}
+
+func (s *seed20Suite) makeCore20Snaps(c *C) {
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "required20", "developerid")
+}
+
+func (s *seed20Suite) makeCore20Model(grade string) *asserts.Model {
+	return s.Brands.Model("my-brand", "my-model", map[string]interface{}{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"grade":        grade,
+		"snaps": []interface{}{
+			map[string]interface{}{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]interface{}{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]interface{}{
+				"name": "required20",
+				"id":   s.AssertedSnapID("required20"),
+			}},
+	})
+}
+
+// writeSystem writes a recovery system into the seed using seedwriter
+// the same way prepare-image does.
+func (s *seed20Suite) writeSystem(c *C, model *asserts.Model, label string, optSnaps []*seedwriter.OptionsSnap) {
+	db, err := asserts.OpenDatabase(&asserts.DatabaseConfig{
+		Backstore: asserts.NewMemoryBackstore(),
+		Trusted:   s.StoreSigning.Trusted,
+	})
+	c.Assert(err, IsNil)
+
+	retrieve := func(ref *asserts.Ref) (asserts.Assertion, error) {
+		return ref.Resolve(s.StoreSigning.Find)
+	}
+	newFetcher := func(save func(asserts.Assertion) error) asserts.Fetcher {
+		save2 := func(a asserts.Assertion) error {
+			if err := db.Add(a); err != nil {
+				if _, ok := err.(*asserts.RevisionError); ok {
+					return nil
+				}
+				return err
+			}
+			return save(a)
+		}
+		return asserts.NewFetcher(db, retrieve, save2)
+	}
+
+	w, err := seedwriter.New(model, &seedwriter.Options{
+		SeedDir: s.seedDir,
+		Label:   label,
+	})
+	c.Assert(err, IsNil)
+
+	err = w.SetOptionsSnaps(optSnaps)
+	c.Assert(err, IsNil)
+
+	rf, err := w.Start(db, newFetcher)
+	c.Assert(err, IsNil)
+
+	localSnaps, err := w.LocalSnaps()
+	c.Assert(err, IsNil)
+
+	for _, sn := range localSnaps {
+		si, aRefs, err := seedwriter.DeriveSideInfo(sn.Path, rf, db)
+		if !asserts.IsNotFound(err) {
+			c.Assert(err, IsNil)
+		}
+		f, err := snap.Open(sn.Path)
+		c.Assert(err, IsNil)
+		info, err := snap.ReadInfoFromSnapFile(f, si)
+		c.Assert(err, IsNil)
+		err = w.SetInfo(sn, info)
+		c.Assert(err, IsNil)
+		sn.ARefs = aRefs
+	}
+
+	err = w.InfoDerived()
+	c.Assert(err, IsNil)
+
+	for {
+		snaps, err := w.SnapsToDownload()
+		c.Assert(err, IsNil)
+
+		for _, sn := range snaps {
+			name := sn.SnapName()
+			err := w.SetInfo(sn, s.AssertedSnapInfo(name))
+			c.Assert(err, IsNil)
+
+			prev := len(rf.Refs())
+			err = rf.Fetch(s.snapRevs[name].Ref())
+			c.Assert(err, IsNil)
+			sn.ARefs = rf.Refs()[prev:]
+
+			err = osutil.CopyFile(s.AssertedSnap(name), sn.Path, osutil.CopyFlagOverwrite)
+			c.Assert(err, IsNil)
+		}
+
+		complete, err := w.Downloaded()
+		c.Assert(err, IsNil)
+		if complete {
+			break
+		}
+	}
+
+	copySnap := func(name, src, dst string) error {
+		return osutil.CopyFile(src, dst, 0)
+	}
+	err = w.SeedSnaps(copySnap)
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+}
+
+func (s *seed20Suite) expectedPath(snapName string) string {
+	return filepath.Join(s.seedDir, "snaps", filepath.Base(s.AssertedSnapInfo(snapName).MountFile()))
+}
+
+func (s *seed20Suite) TestOpenInvalidLabel(c *C) {
+	_, err := seed.Open(s.seedDir, "foo_bar")
+	c.Check(err, ErrorMatches, `invalid seed system label: "foo_bar"`)
+}
+
+func (s *seed20Suite) TestLoadAssertionsNoSystem(c *C) {
+	seed20, err := seed.Open(s.seedDir, "20191018")
+	c.Assert(err, IsNil)
+
+	err = seed20.LoadAssertions(s.db, s.commitTo)
+	c.Check(err, Equals, seed.ErrNoAssertions)
+}
+
+func (s *seed20Suite) TestLoadMetaCore20(c *C) {
+	s.makeCore20Snaps(c)
+	model := s.makeCore20Model("signed")
+
+	s.writeSystem(c, model, "20191018", nil)
+
+	seed20, err := seed.Open(s.seedDir, "20191018")
+	c.Assert(err, IsNil)
+
+	err = seed20.LoadAssertions(s.db, s.commitTo)
+	c.Assert(err, IsNil)
+
+	seedModel, err := seed20.Model()
+	c.Assert(err, IsNil)
+	c.Check(seedModel.Model(), Equals, "my-model")
+	c.Check(seedModel.Grade(), Equals, asserts.ModelSigned)
+
+	err = seed20.LoadMeta(s.perfTimings)
+	c.Assert(err, IsNil)
+
+	c.Check(seed20.UsesSnapdSnap(), Equals, true)
+
+	essSnaps := seed20.EssentialSnaps()
+	c.Check(essSnaps, DeepEquals, []*seed.Snap{
+		{
+			Path:      s.expectedPath("snapd"),
+			SideInfo:  &s.AssertedSnapInfo("snapd").SideInfo,
+			Essential: true,
+			Required:  true,
+			Channel:   "latest/stable",
+		}, {
+			Path:      s.expectedPath("pc-kernel"),
+			SideInfo:  &s.AssertedSnapInfo("pc-kernel").SideInfo,
+			Essential: true,
+			Required:  true,
+			Channel:   "20",
+		}, {
+			Path:      s.expectedPath("core20"),
+			SideInfo:  &s.AssertedSnapInfo("core20").SideInfo,
+			Essential: true,
+			Required:  true,
+			Channel:   "latest/stable",
+		}, {
+			Path:      s.expectedPath("pc"),
+			SideInfo:  &s.AssertedSnapInfo("pc").SideInfo,
+			Essential: true,
+			Required:  true,
+			Channel:   "20",
+		},
+	})
+
+	runSnaps, err := seed20.ModeSnaps("run")
+	c.Assert(err, IsNil)
+	c.Check(runSnaps, DeepEquals, []*seed.Snap{
+		{
+			Path:     s.expectedPath("required20"),
+			SideInfo: &s.AssertedSnapInfo("required20").SideInfo,
+			Required: true,
+			Channel:  "latest/stable",
+		},
+	})
+
+	ephemeralSnaps, err := seed20.ModeSnaps("ephemeral")
+	c.Assert(err, IsNil)
+	c.Check(ephemeralSnaps, HasLen, 0)
+}
+
+func (s *seed20Suite) TestLoadMetaCore20DangerousOptions(c *C) {
+	s.makeCore20Snaps(c)
+	s.makeSnap(c, "optional20-a", "developerid")
+	model := s.makeCore20Model("dangerous")
+
+	localFn := snaptest.MakeTestSnapWithFiles(c, snapYaml20["required20"], nil)
+	s.writeSystem(c, model, "20191018", []*seedwriter.OptionsSnap{
+		{Name: "pc", Channel: "edge"},
+		{Path: localFn},
+		{Name: "optional20-a", Channel: "beta"},
+	})
+
+	seed20, err := seed.Open(s.seedDir, "20191018")
+	c.Assert(err, IsNil)
+
+	err = seed20.LoadAssertions(s.db, s.commitTo)
+	c.Assert(err, IsNil)
+
+	err = seed20.LoadMeta(s.perfTimings)
+	c.Assert(err, IsNil)
+
+	essSnaps := seed20.EssentialSnaps()
+	c.Assert(essSnaps, HasLen, 4)
+	c.Check(essSnaps[3], DeepEquals, &seed.Snap{
+		Path:      s.expectedPath("pc"),
+		SideInfo:  &s.AssertedSnapInfo("pc").SideInfo,
+		Essential: true,
+		Required:  true,
+		Channel:   "20/edge",
+	})
+
+	runSnaps, err := seed20.ModeSnaps("run")
+	c.Assert(err, IsNil)
+	c.Check(runSnaps, DeepEquals, []*seed.Snap{
+		{
+			Path:     filepath.Join(s.seedDir, "systems", "20191018", "snaps", "required20_x1.snap"),
+			SideInfo: &snap.SideInfo{RealName: "required20"},
+			Required: true,
+			Channel:  "latest/stable",
+		}, {
+			Path:     s.expectedPath("optional20-a"),
+			SideInfo: &s.AssertedSnapInfo("optional20-a").SideInfo,
+			Channel:  "latest/beta",
+		},
+	})
+}
+
+func (s *seed20Suite) TestLoadMetaCore20MultipleSystems(c *C) {
+	s.makeCore20Snaps(c)
+	model := s.makeCore20Model("signed")
+
+	s.writeSystem(c, model, "20191018", nil)
+	s.writeSystem(c, model, "20191122", nil)
+
+	r := seed.MockTrusted(s.StoreSigning.Trusted)
+	defer r()
+
+	for _, label := range []string{"20191018", "20191122"} {
+		seed20, err := seed.Open(s.seedDir, label)
+		c.Assert(err, IsNil)
+
+		// use a fresh internal database
+		err = seed20.LoadAssertions(nil, nil)
+		c.Assert(err, IsNil)
+
+		err = seed20.LoadMeta(s.perfTimings)
+		c.Assert(err, IsNil)
+
+		c.Check(seed20.EssentialSnaps(), HasLen, 4)
+		runSnaps, err := seed20.ModeSnaps("run")
+		c.Assert(err, IsNil)
+		c.Check(runSnaps, HasLen, 1)
+	}
+}
+
+func (s *seed20Suite) TestLoadAssertionsModelWithoutGrade(c *C) {
+	s.makeCore20Snaps(c)
+	s.writeSystem(c, s.makeCore20Model("signed"), "20191018", nil)
+
+	core18Model := s.Brands.Model("my-brand", "my-model", map[string]interface{}{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core18",
+		"gadget":       "pc=18",
+		"kernel":       "pc-kernel=18",
+	})
+	err := ioutil.WriteFile(filepath.Join(s.seedDir, "systems", "20191018", "model"), asserts.Encode(core18Model), 0644)
+	c.Assert(err, IsNil)
+
+	seed20, err := seed.Open(s.seedDir, "20191018")
+	c.Assert(err, IsNil)
+
+	err = seed20.LoadAssertions(s.db, s.commitTo)
+	c.Check(err, ErrorMatches, `system model assertion must have a grade`)
+}
+
+func (s *seed20Suite) TestLoadAssertionsExtraModel(c *C) {
+	s.makeCore20Snaps(c)
+	model := s.makeCore20Model("signed")
+	s.writeSystem(c, model, "20191018", nil)
+
+	err := ioutil.WriteFile(filepath.Join(s.seedDir, "systems", "20191018", "assertions", "model"), asserts.Encode(model), 0644)
+	c.Assert(err, IsNil)
+
+	seed20, err := seed.Open(s.seedDir, "20191018")
+	c.Assert(err, IsNil)
+
+	err = seed20.LoadAssertions(s.db, s.commitTo)
+	c.Check(err, ErrorMatches, `system cannot have any model assertion but the one in the system model assertion file`)
+}
+
+func (s *seed20Suite) TestLoadMetaCore20OptionsNotDangerous(c *C) {
+	s.makeCore20Snaps(c)
+	s.writeSystem(c, s.makeCore20Model("signed"), "20191018", nil)
+
+	err := ioutil.WriteFile(filepath.Join(s.seedDir, "systems", "20191018", "options.yaml"), []byte(`snaps:
+- name: pc
+  channel: 20/edge
+`), 0644)
+	c.Assert(err, IsNil)
+
+	seed20, err := seed.Open(s.seedDir, "20191018")
+	c.Assert(err, IsNil)
+
+	err = seed20.LoadAssertions(s.db, s.commitTo)
+	c.Assert(err, IsNil)
+
+	err = seed20.LoadMeta(s.perfTimings)
+	c.Check(err, ErrorMatches, `system with options can only have a model of grade dangerous`)
+}
+
+func (s *seed20Suite) TestLoadMetaCore20TamperedSnap(c *C) {
+	s.makeCore20Snaps(c)
+	s.writeSystem(c, s.makeCore20Model("signed"), "20191018", nil)
+
+	core20Path := s.expectedPath("core20")
+	err := ioutil.WriteFile(core20Path, []byte("tampered"), 0644)
+	c.Assert(err, IsNil)
+
+	seed20, err := seed.Open(s.seedDir, "20191018")
+	c.Assert(err, IsNil)
+
+	err = seed20.LoadAssertions(s.db, s.commitTo)
+	c.Assert(err, IsNil)
+
+	err = seed20.LoadMeta(s.perfTimings)
+	c.Check(err, ErrorMatches, fmt.Sprintf(`cannot validate %q for snap "core20": it does not match the snap-revision in the system \(broken or tampered\)`, core20Path))
+}
+
+func (s *seed20Suite) TestLoadMetaCore20MissingSnap(c *C) {
+	s.makeCore20Snaps(c)
+	s.writeSystem(c, s.makeCore20Model("signed"), "20191018", nil)
+
+	err := os.Remove(s.expectedPath("required20"))
+	c.Assert(err, IsNil)
+
+	seed20, err := seed.Open(s.seedDir, "20191018")
+	c.Assert(err, IsNil)
+
+	err = seed20.LoadAssertions(s.db, s.commitTo)
+	c.Assert(err, IsNil)
+
+	err = seed20.LoadMeta(s.perfTimings)
+	c.Check(err, ErrorMatches, `cannot validate ".*/snaps/required20_1.snap" for snap "required20": .*`)
+}
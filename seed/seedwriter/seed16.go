@@ -45,6 +45,11 @@ type policy16 struct {
 	needsCore16 []string
 }
 
+func (pol *policy16) allowsDangerousFeatures() error {
+	// Core 16/18 have allowed dangerous features without constraints
+	return nil
+}
+
 func (pol *policy16) checkDefaultChannel(channel.Channel) error {
 	// Core 16 has no constraints on the default channel
 	return nil
@@ -176,8 +181,8 @@ func (tr *tree16) snapsDir() string {
 	return tr.snapsDirPath
 }
 
-func (tr *tree16) localSnapPath(sn *SeedSnap) string {
-	return filepath.Join(tr.snapsDirPath, filepath.Base(sn.Info.MountFile()))
+func (tr *tree16) localSnapPath(sn *SeedSnap) (string, error) {
+	return filepath.Join(tr.snapsDirPath, filepath.Base(sn.Info.MountFile())), nil
 }
 
 func (tr *tree16) writeAssertions(db asserts.RODatabase, modelRefs []*asserts.Ref, snapsFromModel []*SeedSnap, extraSnaps []*SeedSnap) error {
@@ -0,0 +1,272 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package seedwriter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/seed/internal"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/channel"
+	"github.com/snapcore/snapd/snap/naming"
+)
+
+var errNotAllowedExceptForDangerous = errors.New("cannot override channels, add local snaps or extra snaps with a model of grade higher than dangerous")
+
+type policy20 struct {
+	model *asserts.Model
+	opts  *Options
+}
+
+func (pol *policy20) allowsDangerousFeatures() error {
+	if pol.model.Grade() == asserts.ModelDangerous {
+		return nil
+	}
+	return errNotAllowedExceptForDangerous
+}
+
+func (pol *policy20) checkDefaultChannel(channel.Channel) error {
+	return pol.allowsDangerousFeatures()
+}
+
+func (pol *policy20) checkSnapChannel(_ channel.Channel, whichSnap string) error {
+	return pol.allowsDangerousFeatures()
+}
+
+func (pol *policy20) systemSnap() *asserts.ModelSnap {
+	systemSnap := makeSystemSnap("snapd")
+	systemSnap.Modes = []string{"run", "ephemeral"}
+	systemSnap.DefaultChannel = "latest/stable"
+	return systemSnap
+}
+
+func (pol *policy20) modelSnapDefaultChannel() string {
+	// model snaps have always a default channel with Core 20 models
+	return "latest/stable"
+}
+
+func (pol *policy20) extraSnapDefaultChannel() string {
+	return "latest/stable"
+}
+
+func (pol *policy20) checkBase(info *snap.Info, availableSnaps *naming.SnapSet) error {
+	if info.GetType() == snap.TypeGadget && info.Base != pol.model.Base() {
+		return fmt.Errorf("cannot use gadget snap because its base %q is different from model base %q", info.Base, pol.model.Base())
+	}
+
+	base := info.Base
+	if base == "" {
+		if info.GetType() != snap.TypeGadget && info.GetType() != snap.TypeApp {
+			return nil
+		}
+		// core is never added implicitly with Core 20 models
+		base = "core"
+	}
+
+	// snap explicitly listed as not needing a base snap (e.g. a content-only snap)
+	if base == "none" {
+		return nil
+	}
+
+	if availableSnaps.Contains(naming.Snap(base)) {
+		return nil
+	}
+
+	return fmt.Errorf("cannot add snap %q without also adding its base %q explicitly", info.SnapName(), base)
+}
+
+func (pol *policy20) needsImplicitSnaps(*naming.SnapSet) (bool, error) {
+	// Core 20 requires all snaps, including bases, to be explicit
+	return false, nil
+}
+
+func (pol *policy20) implicitSnaps(*naming.SnapSet) []*asserts.ModelSnap {
+	return nil
+}
+
+func (pol *policy20) implicitExtraSnaps(*naming.SnapSet) []*OptionsSnap {
+	return nil
+}
+
+type tree20 struct {
+	opts *Options
+
+	snapsDirPath string
+	systemDir    string
+}
+
+func (tr *tree20) mkFixedDirs() error {
+	tr.snapsDirPath = filepath.Join(tr.opts.SeedDir, "snaps")
+	tr.systemDir = filepath.Join(tr.opts.SeedDir, "systems", tr.opts.Label)
+
+	if err := os.MkdirAll(tr.snapsDirPath, 0755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(tr.systemDir), 0755); err != nil {
+		return err
+	}
+	if err := os.Mkdir(tr.systemDir, 0755); err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("system %q already exists", tr.opts.Label)
+		}
+		return err
+	}
+	return nil
+}
+
+func (tr *tree20) snapsDir() string {
+	return tr.snapsDirPath
+}
+
+func (tr *tree20) localSnapPath(sn *SeedSnap) (string, error) {
+	if sn.Info.ID() != "" {
+		// asserted local snaps go into the shared snaps pool
+		return filepath.Join(tr.snapsDirPath, filepath.Base(sn.Info.MountFile())), nil
+	}
+	// unasserted snaps are kept with the system
+	sysSnapsDir := filepath.Join(tr.systemDir, "snaps")
+	if err := os.MkdirAll(sysSnapsDir, 0755); err != nil {
+		return "", err
+	}
+	return filepath.Join(sysSnapsDir, filepath.Base(sn.Info.MountFile())), nil
+}
+
+func (tr *tree20) writeAssertions(db asserts.RODatabase, modelRefs []*asserts.Ref, snapsFromModel []*SeedSnap, extraSnaps []*SeedSnap) error {
+	assertsDir := filepath.Join(tr.systemDir, "assertions")
+	if err := os.MkdirAll(assertsDir, 0755); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	writeByRefs := func(fname string, refs []*asserts.Ref) error {
+		f, err := os.OpenFile(filepath.Join(assertsDir, fname), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		enc := asserts.NewEncoder(f)
+		for _, aRef := range refs {
+			u := aRef.Unique()
+			if seen[u] {
+				continue
+			}
+			seen[u] = true
+			a, err := aRef.Resolve(db.Find)
+			if err != nil {
+				return fmt.Errorf("internal error: lost saved assertion")
+			}
+			if err := enc.Encode(a); err != nil {
+				return err
+			}
+		}
+		return f.Close()
+	}
+
+	var modelRef *asserts.Ref
+	modelEtcRefs := make([]*asserts.Ref, 0, len(modelRefs))
+	for _, aRef := range modelRefs {
+		if aRef.Type == asserts.ModelType {
+			modelRef = aRef
+			continue
+		}
+		modelEtcRefs = append(modelEtcRefs, aRef)
+	}
+
+	if modelRef != nil {
+		a, err := modelRef.Resolve(db.Find)
+		if err != nil {
+			return fmt.Errorf("internal error: lost saved assertion")
+		}
+		if err := osutil.AtomicWriteFile(filepath.Join(tr.systemDir, "model"), asserts.Encode(a), 0644, 0); err != nil {
+			return err
+		}
+	}
+
+	if err := writeByRefs("model-etc", modelEtcRefs); err != nil {
+		return err
+	}
+
+	var snapsRefs []*asserts.Ref
+	for _, sn := range snapsFromModel {
+		snapsRefs = append(snapsRefs, sn.ARefs...)
+	}
+	for _, sn := range extraSnaps {
+		snapsRefs = append(snapsRefs, sn.ARefs...)
+	}
+
+	return writeByRefs("snaps", snapsRefs)
+}
+
+func (tr *tree20) writeMeta(snapsFromModel []*SeedSnap, extraSnaps []*SeedSnap) error {
+	var optionsSnaps []*internal.Snap20
+
+	for _, sn := range snapsFromModel {
+		info := sn.Info
+		var optionsSnap internal.Snap20
+		record := false
+		if info.ID() == "" {
+			// unasserted local snap
+			optionsSnap.Unasserted = filepath.Base(sn.Path)
+			record = true
+		} else if sn.modelSnap.SnapID == "" {
+			// cross-reference
+			optionsSnap.SnapID = info.ID()
+		}
+		if sn.Channel != sn.modelSnap.DefaultChannel {
+			optionsSnap.Channel = sn.Channel
+			record = true
+		}
+		if record {
+			optionsSnap.Name = sn.SnapName()
+			optionsSnaps = append(optionsSnaps, &optionsSnap)
+		}
+	}
+
+	for _, sn := range extraSnaps {
+		info := sn.Info
+		optionsSnap := &internal.Snap20{
+			Name:    sn.SnapName(),
+			SnapID:  info.ID(),
+			Channel: sn.Channel,
+		}
+		if info.ID() == "" {
+			// unasserted local snap
+			optionsSnap.Unasserted = filepath.Base(sn.Path)
+		}
+		optionsSnaps = append(optionsSnaps, optionsSnap)
+	}
+
+	if len(optionsSnaps) == 0 {
+		// nothing to record
+		return nil
+	}
+
+	options20 := &internal.Options20{Snaps: optionsSnaps}
+	optionsFn := filepath.Join(tr.systemDir, "options.yaml")
+	if err := options20.Write(optionsFn); err != nil {
+		return fmt.Errorf("cannot write options.yaml: %v", err)
+	}
+	return nil
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/asserts/snapasserts"
 	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/seed"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/channel"
 	"github.com/snapcore/snapd/snap/naming"
@@ -37,8 +38,18 @@ import (
 type Options struct {
 	SeedDir string
 
+	// Label is the label of the recovery system to create, it is
+	// required for Core 20 models, which get a systems/<label>
+	// directory in the seed
+	Label string
+
 	DefaultChannel string
 
+	// ExtraAssertions are assertions to add to the seed besides the
+	// ones for the model and the snaps, e.g. a system-user assertion,
+	// their prerequisites are fetched as well
+	ExtraAssertions []asserts.Assertion
+
 	// TestSkipCopyUnverifiedModel is set to support naive tests
 	// using an unverified model, the resulting image is broken
 	TestSkipCopyUnverifiedModel bool
@@ -179,6 +190,8 @@ type Writer struct {
 }
 
 type policy interface {
+	allowsDangerousFeatures() error
+
 	checkDefaultChannel(channel.Channel) error
 	checkSnapChannel(ch channel.Channel, whichSnap string) error
 
@@ -200,7 +213,7 @@ type tree interface {
 	// XXX might need to differentiate for extra snaps
 	snapsDir() string
 
-	localSnapPath(*SeedSnap) string
+	localSnapPath(*SeedSnap) (string, error)
 
 	writeAssertions(db asserts.RODatabase, modelRefs []*asserts.Ref, snapsFromModel []*SeedSnap, extraSnaps []*SeedSnap) error
 
@@ -216,7 +229,6 @@ func New(model *asserts.Model, opts *Options) (*Writer, error) {
 	w := &Writer{
 		model: model,
 		opts:  opts,
-		tree:  &tree16{opts: opts},
 
 		expectedStep: setOptionsSnapsStep,
 
@@ -224,7 +236,26 @@ func New(model *asserts.Model, opts *Options) (*Writer, error) {
 		byRefLocalSnaps: naming.NewSnapSet(nil),
 	}
 
-	pol := &policy16{model: model, opts: opts, warningf: w.warningf}
+	var pol policy
+	if model.Grade() != asserts.ModelGradeUnset {
+		if err := seed.ValidateSystemLabel(opts.Label); err != nil {
+			return nil, err
+		}
+		w.tree = &tree20{opts: opts}
+		pol = &policy20{model: model, opts: opts}
+	} else {
+		if opts.Label != "" {
+			return nil, fmt.Errorf("cannot use a seed system label with a model without grade")
+		}
+		w.tree = &tree16{opts: opts}
+		pol = &policy16{model: model, opts: opts, warningf: w.warningf}
+	}
+
+	for _, a := range opts.ExtraAssertions {
+		if a.Type() == asserts.ModelType {
+			return nil, fmt.Errorf("cannot add a model assertion as extra assertion to the seed")
+		}
+	}
 
 	if opts.DefaultChannel != "" {
 		deflCh, err := channel.ParseVerbatim(opts.DefaultChannel, "_")
@@ -317,8 +348,6 @@ func (w *Writer) SetOptionsSnaps(optSnaps []*OptionsSnap) error {
 		return err
 	}
 
-	// XXX check with policy if local snaps are ok
-
 	for _, sn := range optSnaps {
 		var whichSnap string
 		local := false
@@ -341,6 +370,9 @@ func (w *Writer) SetOptionsSnaps(optSnaps []*OptionsSnap) error {
 			}
 			w.byNameOptSnaps.Add(sn)
 		} else {
+			if err := w.policy.allowsDangerousFeatures(); err != nil {
+				return err
+			}
 			if !strings.HasSuffix(sn.Path, ".snap") {
 				return fmt.Errorf("local option snap %q does not end in .snap", sn.Path)
 			}
@@ -421,6 +453,12 @@ func (w *Writer) Start(db asserts.RODatabase, newFetcher NewFetcherFunc) (RefAss
 		}
 	}
 
+	for _, a := range w.opts.ExtraAssertions {
+		if err := f.Save(a); err != nil {
+			return nil, fmt.Errorf("cannot fetch and check prerequisites for the extra %s assertion: %v", a.Type().Name, err)
+		}
+	}
+
 	w.modelRefs = f.Refs()
 
 	if err := w.tree.mkFixedDirs(); err != nil {
@@ -664,7 +702,6 @@ func (w *Writer) SnapsToDownload() (snaps []*SeedSnap, err error) {
 
 	switch w.toDownload {
 	case toDownloadModel:
-		// XXX check early if policy is ok with extra snaps
 		return w.modelSnapsToDownload(w.modSnaps())
 	case toDownloadImplicit:
 		return w.modelSnapsToDownload(w.policy.implicitSnaps(w.availableSnaps))
@@ -819,6 +856,9 @@ func (w *Writer) Downloaded() (complete bool, err error) {
 		fallthrough
 	case toDownloadImplicit:
 		if w.extraSnapsGuessNum > 0 {
+			if err := w.policy.allowsDangerousFeatures(); err != nil {
+				return false, err
+			}
 			w.toDownload = toDownloadExtra
 			w.expectedStep = snapsToDownloadStep
 			return false, nil
@@ -910,8 +950,11 @@ func (w *Writer) SeedSnaps(copySnap func(name, src, dst string) error) error {
 					return fmt.Errorf("internal error: before seedwriter.Writer.SeedSnaps snap file %q should exist", expectedPath)
 				}
 			} else {
-				dst := w.tree.localSnapPath(sn)
-				err := copySnap(info.SnapName(), sn.Path, dst)
+				dst, err := w.tree.localSnapPath(sn)
+				if err != nil {
+					return err
+				}
+				err = copySnap(info.SnapName(), sn.Path, dst)
 				if err != nil {
 					return err
 				}
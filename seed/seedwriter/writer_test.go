@@ -94,6 +94,13 @@ func (s *writerSuite) SetUpTest(c *C) {
 	}, "")
 	assertstest.AddMany(s.StoreSigning, s.devAcct)
 
+	s.snapRevs = make(map[string]*asserts.SnapRevision)
+	s.setupDB(c)
+}
+
+// setupDB sets up a fresh writing assertion database and fetching
+// as used by a writer.
+func (s *writerSuite) setupDB(c *C) {
 	db, err := asserts.OpenDatabase(&asserts.DatabaseConfig{
 		Backstore: asserts.NewMemoryBackstore(),
 		Trusted:   s.StoreSigning.Trusted,
@@ -120,7 +127,6 @@ func (s *writerSuite) SetUpTest(c *C) {
 	}
 	s.rf = seedwriter.MakeRefAssertsFetcher(s.newFetcher)
 
-	s.snapRevs = make(map[string]*asserts.SnapRevision)
 	s.aRefs = make(map[string][]*asserts.Ref)
 }
 
@@ -200,6 +206,29 @@ version: 1.0
 type: app
 base: core16
 version: 1.0
+`,
+	"core20": `name: core20
+type: base
+version: 1.0
+`,
+	"pc-kernel=20": `name: pc-kernel
+type: kernel
+version: 1.0
+`,
+	"pc=20": `name: pc
+type: gadget
+base: core20
+version: 1.0
+`,
+	"required20": `name: required20
+type: app
+base: core20
+version: 1.0
+`,
+	"optional20-a": `name: optional20-a
+type: app
+base: core20
+version: 1.0
 `,
 }
 
@@ -968,6 +997,92 @@ func (s *writerSuite) TestSeedSnapsWriteMetaCore18StoreAssertion(c *C) {
 	c.Check(p, testutil.FilePresent)
 }
 
+func (s *writerSuite) makeSystemUser(c *C, authorityID string) *asserts.SystemUser {
+	su, err := s.Brands.Signing(authorityID).Sign(asserts.SystemUserType, map[string]interface{}{
+		"authority-id": authorityID,
+		"brand-id":     "my-brand",
+		"email":        "foo@example.com",
+		"series":       []interface{}{"16"},
+		"models":       []interface{}{"my-model"},
+		"name":         "Foo",
+		"username":     "foo",
+		"password":     "$6$salt$hash",
+		"since":        time.Now().Format(time.RFC3339),
+		"until":        time.Now().Add(24 * 30 * time.Hour).Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	return su.(*asserts.SystemUser)
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaCore18ExtraAssertions(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]interface{}{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core18",
+		"gadget":       "pc=18",
+		"kernel":       "pc-kernel=18",
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+
+	s.opts.ExtraAssertions = []asserts.Assertion{s.makeSystemUser(c, "my-brand")}
+
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap)
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	err = w.SeedSnaps(nil)
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	// check the system-user assertion is in the seed
+	p := filepath.Join(s.opts.SeedDir, "assertions", "my-brand,foo@example.com.system-user")
+	c.Check(p, testutil.FilePresent)
+}
+
+func (s *writerSuite) TestExtraAssertionsNoModel(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]interface{}{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core18",
+		"gadget":       "pc=18",
+		"kernel":       "pc-kernel=18",
+	})
+
+	s.opts.ExtraAssertions = []asserts.Assertion{model}
+	_, err := seedwriter.New(model, s.opts)
+	c.Check(err, ErrorMatches, "cannot add a model assertion as extra assertion to the seed")
+}
+
+func (s *writerSuite) TestExtraAssertionsUnverifiable(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]interface{}{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core18",
+		"gadget":       "pc=18",
+		"kernel":       "pc-kernel=18",
+	})
+
+	// signed by an account whose key is unknown to the store
+	unknownPrivKey, _ := assertstest.GenerateKey(752)
+	s.Brands.Register("unknown", unknownPrivKey, nil)
+	s.opts.ExtraAssertions = []asserts.Assertion{s.makeSystemUser(c, "unknown")}
+
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.SetOptionsSnaps(nil)
+	c.Assert(err, IsNil)
+
+	_, err = w.Start(s.db, s.newFetcher)
+	c.Check(err, ErrorMatches, `cannot fetch and check prerequisites for the extra system-user assertion: .*`)
+}
+
 func (s *writerSuite) TestLocalSnaps(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]interface{}{
 		"display-name":   "my model",
@@ -1668,3 +1783,344 @@ func (s *writerSuite) TestSeedSnapsWriteMetaLocalExtraSnaps(c *C) {
 	c.Check(unassertedSnaps, HasLen, 1)
 	c.Check(naming.SameSnap(unassertedSnaps[0], naming.Snap("required")), Equals, true)
 }
+
+func (s *writerSuite) makeCore20Model(grade string) *asserts.Model {
+	return s.Brands.Model("my-brand", "my-model", map[string]interface{}{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core20",
+		"grade":        grade,
+		"snaps": []interface{}{
+			map[string]interface{}{
+				"name":            "pc-kernel",
+				"id":              s.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]interface{}{
+				"name":            "pc",
+				"id":              s.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+			map[string]interface{}{
+				"name": "required20",
+				"id":   s.AssertedSnapID("required20"),
+			}},
+	})
+}
+
+func (s *writerSuite) makeCore20Snaps(c *C) {
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core20", "")
+	s.makeSnap(c, "pc-kernel=20", "")
+	s.makeSnap(c, "pc=20", "")
+	s.makeSnap(c, "required20", "developerid")
+}
+
+func (s *writerSuite) TestNewCore20InvalidLabel(c *C) {
+	model := s.makeCore20Model("signed")
+
+	for _, label := range []string{"", "a", "-foo", "foo-", "foo--bar", "foo_bar", "foo/bar"} {
+		s.opts.Label = label
+		w, err := seedwriter.New(model, s.opts)
+		c.Check(w, IsNil)
+		c.Check(err, ErrorMatches, fmt.Sprintf(`invalid seed system label: %q`, label))
+	}
+}
+
+func (s *writerSuite) TestNewLabelWithoutGrade(c *C) {
+	model := s.Brands.Model("my-brand", "my-model", map[string]interface{}{
+		"display-name": "my model",
+		"architecture": "amd64",
+		"base":         "core18",
+		"gadget":       "pc=18",
+		"kernel":       "pc-kernel=18",
+	})
+
+	s.opts.Label = "20191003"
+	w, err := seedwriter.New(model, s.opts)
+	c.Check(w, IsNil)
+	c.Check(err, ErrorMatches, `cannot use a seed system label with a model without grade`)
+}
+
+func (s *writerSuite) TestCore20NonDangerousDisallowedOptions(c *C) {
+	model := s.makeCore20Model("signed")
+	s.opts.Label = "20191003"
+
+	const expectedErr = `cannot override channels, add local snaps or extra snaps with a model of grade higher than dangerous`
+
+	s.opts.DefaultChannel = "edge"
+	_, err := seedwriter.New(model, s.opts)
+	c.Check(err, ErrorMatches, expectedErr)
+	s.opts.DefaultChannel = ""
+
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "pc", Channel: "edge"}})
+	c.Check(err, ErrorMatches, expectedErr)
+
+	w, err = seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Path: s.makeLocalSnap(c, "required20")}})
+	c.Check(err, ErrorMatches, expectedErr)
+}
+
+func (s *writerSuite) TestCore20NonDangerousDisallowedExtraSnaps(c *C) {
+	model := s.makeCore20Model("signed")
+	s.opts.Label = "20191003"
+
+	s.makeCore20Snaps(c)
+
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{{Name: "optional20-a"}})
+	c.Assert(err, IsNil)
+
+	_, err = w.Start(s.db, s.newFetcher)
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 5)
+
+	for _, sn := range snaps {
+		s.fillDownloadedSnap(c, w, sn)
+	}
+
+	_, err = w.Downloaded()
+	c.Check(err, ErrorMatches, `cannot override channels, add local snaps or extra snaps with a model of grade higher than dangerous`)
+}
+
+func (s *writerSuite) TestCore20SystemAlreadyExists(c *C) {
+	model := s.makeCore20Model("signed")
+	s.opts.Label = "20191003"
+
+	err := os.MkdirAll(filepath.Join(s.opts.SeedDir, "systems", "20191003"), 0755)
+	c.Assert(err, IsNil)
+
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	_, err = w.Start(s.db, s.newFetcher)
+	c.Check(err, ErrorMatches, `system "20191003" already exists`)
+}
+
+func (s *writerSuite) TestSnapsToDownloadCore20(c *C) {
+	model := s.makeCore20Model("signed")
+	s.opts.Label = "20191003"
+
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	_, err = w.Start(s.db, s.newFetcher)
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 5)
+
+	for i, expected := range []struct {
+		name    string
+		channel string
+	}{
+		{"snapd", "latest/stable"},
+		{"pc-kernel", "20"},
+		{"core20", "latest/stable"},
+		{"pc", "20"},
+		{"required20", "latest/stable"},
+	} {
+		c.Check(naming.SameSnap(snaps[i], naming.Snap(expected.name)), Equals, true)
+		c.Check(snaps[i].Channel, Equals, expected.channel)
+	}
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaCore20(c *C) {
+	model := s.makeCore20Model("signed")
+	s.opts.Label = "20191003"
+
+	s.makeCore20Snaps(c)
+
+	complete, w, err := s.upToDownloaded(c, model, s.fillDownloadedSnap)
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	err = w.SeedSnaps(nil)
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	// check the files are in place in the shared snaps pool
+	for _, name := range []string{"snapd", "pc-kernel", "core20", "pc", "required20"} {
+		info := s.AssertedSnapInfo(name)
+		p := filepath.Join(s.opts.SeedDir, "snaps", filepath.Base(info.MountFile()))
+		c.Check(p, testutil.FilePresent)
+	}
+
+	l, err := ioutil.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 5)
+
+	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
+	c.Check(filepath.Join(systemDir, "model"), testutil.FileEquals, asserts.Encode(model))
+	// nothing to record as options
+	c.Check(filepath.Join(systemDir, "options.yaml"), testutil.FileAbsent)
+	c.Check(filepath.Join(systemDir, "snaps"), testutil.FileAbsent)
+
+	assertsDir := filepath.Join(systemDir, "assertions")
+	modelEtc := readAssertions(c, filepath.Join(assertsDir, "model-etc"))
+	modelEtcTypes := make(map[string]bool)
+	for _, a := range modelEtc {
+		modelEtcTypes[a.Type().Name] = true
+	}
+	c.Check(modelEtcTypes, DeepEquals, map[string]bool{
+		"account":     true,
+		"account-key": true,
+	})
+
+	snapAsserts := readAssertions(c, filepath.Join(assertsDir, "snaps"))
+	var decls, revs []string
+	for _, a := range snapAsserts {
+		switch a.Type() {
+		case asserts.SnapDeclarationType:
+			decls = append(decls, a.HeaderString("snap-name"))
+		case asserts.SnapRevisionType:
+			revs = append(revs, a.HeaderString("snap-id"))
+		}
+	}
+	c.Check(decls, DeepEquals, []string{"snapd", "pc-kernel", "core20", "pc", "required20"})
+	c.Check(revs, HasLen, 5)
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaCore20DangerousOptions(c *C) {
+	model := s.makeCore20Model("dangerous")
+	s.opts.Label = "20191003"
+
+	s.makeCore20Snaps(c)
+	s.makeSnap(c, "optional20-a", "developerid")
+	localFn := s.makeLocalSnap(c, "required20")
+
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	err = w.SetOptionsSnaps([]*seedwriter.OptionsSnap{
+		{Name: "pc", Channel: "edge"},
+		{Path: localFn},
+		{Name: "optional20-a"},
+	})
+	c.Assert(err, IsNil)
+
+	tf, err := w.Start(s.db, s.newFetcher)
+	c.Assert(err, IsNil)
+
+	localSnaps, err := w.LocalSnaps()
+	c.Assert(err, IsNil)
+	c.Assert(localSnaps, HasLen, 1)
+
+	for _, sn := range localSnaps {
+		_, _, err := seedwriter.DeriveSideInfo(sn.Path, tf, s.db)
+		c.Assert(asserts.IsNotFound(err), Equals, true)
+		f, err := snap.Open(sn.Path)
+		c.Assert(err, IsNil)
+		info, err := snap.ReadInfoFromSnapFile(f, nil)
+		c.Assert(err, IsNil)
+		w.SetInfo(sn, info)
+	}
+
+	err = w.InfoDerived()
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 4)
+
+	for _, sn := range snaps {
+		s.fillDownloadedSnap(c, w, sn)
+	}
+
+	complete, err := w.Downloaded()
+	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, false)
+
+	snaps, err = w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 1)
+	c.Check(naming.SameSnap(snaps[0], naming.Snap("optional20-a")), Equals, true)
+
+	s.fillDownloadedSnap(c, w, snaps[0])
+
+	complete, err = w.Downloaded()
+	c.Assert(err, IsNil)
+	c.Assert(complete, Equals, true)
+
+	copySnap := func(name, src, dst string) error {
+		return osutil.CopyFile(src, dst, 0)
+	}
+
+	err = w.SeedSnaps(copySnap)
+	c.Assert(err, IsNil)
+
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	systemDir := filepath.Join(s.opts.SeedDir, "systems", s.opts.Label)
+
+	// the unasserted snap is kept with the system
+	c.Check(filepath.Join(systemDir, "snaps", "required20_x1.snap"), testutil.FilePresent)
+	l, err := ioutil.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 5)
+
+	c.Check(filepath.Join(systemDir, "options.yaml"), testutil.FileEquals, fmt.Sprintf(`snaps:
+- name: pc
+  channel: 20/edge
+- name: required20
+  unasserted: required20_x1.snap
+- name: optional20-a
+  id: %s
+  channel: latest/stable
+`, s.AssertedSnapID("optional20-a")))
+}
+
+func (s *writerSuite) TestSeedSnapsWriteMetaCore20MultipleSystems(c *C) {
+	model := s.makeCore20Model("signed")
+
+	s.makeCore20Snaps(c)
+
+	fill := func(c *C, w *seedwriter.Writer, sn *seedwriter.SeedSnap) {
+		s.fillMetaDownloadedSnap(c, w, sn)
+		err := osutil.CopyFile(s.AssertedSnap(sn.SnapName()), sn.Path, osutil.CopyFlagOverwrite)
+		c.Assert(err, IsNil)
+	}
+
+	for _, label := range []string{"20191003", "20191122"} {
+		s.setupDB(c)
+		s.opts.Label = label
+
+		complete, w, err := s.upToDownloaded(c, model, fill)
+		c.Assert(err, IsNil)
+		c.Check(complete, Equals, true)
+
+		err = w.SeedSnaps(nil)
+		c.Assert(err, IsNil)
+
+		err = w.WriteMeta()
+		c.Assert(err, IsNil)
+	}
+
+	// the snaps pool is shared
+	l, err := ioutil.ReadDir(filepath.Join(s.opts.SeedDir, "snaps"))
+	c.Assert(err, IsNil)
+	c.Check(l, HasLen, 5)
+
+	l, err = ioutil.ReadDir(filepath.Join(s.opts.SeedDir, "systems"))
+	c.Assert(err, IsNil)
+	c.Assert(l, HasLen, 2)
+	for _, fi := range l {
+		systemDir := filepath.Join(s.opts.SeedDir, "systems", fi.Name())
+		c.Check(filepath.Join(systemDir, "model"), testutil.FileEquals, asserts.Encode(model))
+		c.Check(filepath.Join(systemDir, "assertions", "snaps"), testutil.FilePresent)
+	}
+}
@@ -58,13 +58,19 @@ func GuessAppsForBroken(info *Info) map[string]*AppInfo {
 	}
 
 	// guess the services next
-	matches, _ := filepath.Glob(filepath.Join(dirs.SnapServicesDir, fmt.Sprintf("snap.%s.*.service", name)))
-	for _, m := range matches {
-		appname := strings.Split(m, ".")[2]
-		out[appname] = &AppInfo{
-			Snap:   info,
-			Name:   appname,
-			Daemon: "simple",
+	for dir, scope := range map[string]DaemonScope{
+		dirs.SnapServicesDir:     "",
+		dirs.SnapUserServicesDir: UserDaemon,
+	} {
+		matches, _ := filepath.Glob(filepath.Join(dir, fmt.Sprintf("snap.%s.*.service", name)))
+		for _, m := range matches {
+			appname := strings.Split(filepath.Base(m), ".")[2]
+			out[appname] = &AppInfo{
+				Snap:        info,
+				Name:        appname,
+				Daemon:      "simple",
+				DaemonScope: scope,
+			}
 		}
 	}
 
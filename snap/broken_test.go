@@ -88,6 +88,17 @@ func (s *brokenSuite) TestGuessAppsForBrokenServices(c *C) {
 	c.Check(apps["baz"], DeepEquals, &snap.AppInfo{Snap: info, Name: "baz", Daemon: "simple"})
 }
 
+func (s *brokenSuite) TestGuessAppsForBrokenUserServices(c *C) {
+	touch(c, filepath.Join(dirs.SnapServicesDir, "snap.foo.foo.service"))
+	touch(c, filepath.Join(dirs.SnapUserServicesDir, "snap.foo.bar.service"))
+
+	info := &snap.Info{SuggestedName: "foo"}
+	apps := snap.GuessAppsForBroken(info)
+	c.Check(apps, HasLen, 2)
+	c.Check(apps["foo"], DeepEquals, &snap.AppInfo{Snap: info, Name: "foo", Daemon: "simple"})
+	c.Check(apps["bar"], DeepEquals, &snap.AppInfo{Snap: info, Name: "bar", Daemon: "simple", DaemonScope: snap.UserDaemon})
+}
+
 func (s *brokenSuite) TestForceRenamePlug(c *C) {
 	snapInfo := snaptest.MockInvalidInfo(c, `name: core
 version: 0
@@ -697,6 +697,26 @@ type TimerInfo struct {
 	Timer string
 }
 
+// DaemonScope is the type for the "daemon-scope:" of a snap app
+type DaemonScope string
+
+const (
+	// SystemDaemon is a service run by the system instance of systemd
+	SystemDaemon DaemonScope = "system"
+	// UserDaemon is a service run by the systemd instance of each
+	// logged in user
+	UserDaemon DaemonScope = "user"
+)
+
+func (ds DaemonScope) Validate() error {
+	switch ds {
+	case "", SystemDaemon, UserDaemon:
+		// valid
+		return nil
+	}
+	return fmt.Errorf(`"daemon-scope" field contains invalid value %q`, ds)
+}
+
 // StopModeType is the type for the "stop-mode:" of a snap app
 type StopModeType string
 
@@ -735,6 +755,7 @@ type AppInfo struct {
 	CommonID      string
 
 	Daemon          string
+	DaemonScope     DaemonScope
 	StopTimeout     timeout.Timeout
 	StartTimeout    timeout.Timeout
 	WatchdogTimeout timeout.Timeout
@@ -831,12 +852,12 @@ type SystemUsernameInfo struct {
 
 // File returns the path to the *.socket file
 func (socket *SocketInfo) File() string {
-	return filepath.Join(dirs.SnapServicesDir, socket.App.SecurityTag()+"."+socket.Name+".socket")
+	return filepath.Join(socket.App.serviceDir(), socket.App.SecurityTag()+"."+socket.Name+".socket")
 }
 
 // File returns the path to the *.timer file
 func (timer *TimerInfo) File() string {
-	return filepath.Join(dirs.SnapServicesDir, timer.App.SecurityTag()+".timer")
+	return filepath.Join(timer.App.serviceDir(), timer.App.SecurityTag()+".timer")
 }
 
 func (app *AppInfo) String() string {
@@ -904,9 +925,18 @@ func (app *AppInfo) ServiceName() string {
 	return app.SecurityTag() + ".service"
 }
 
+// serviceDir returns the directory holding the systemd units of the
+// daemon app, which depends on its daemon scope.
+func (app *AppInfo) serviceDir() string {
+	if app.IsUserService() {
+		return dirs.SnapUserServicesDir
+	}
+	return dirs.SnapServicesDir
+}
+
 // ServiceFile returns the systemd service file path for the daemon app.
 func (app *AppInfo) ServiceFile() string {
-	return filepath.Join(dirs.SnapServicesDir, app.ServiceName())
+	return filepath.Join(app.serviceDir(), app.ServiceName())
 }
 
 // Env returns the app specific environment overrides
@@ -924,6 +954,13 @@ func (app *AppInfo) IsService() bool {
 	return app.Daemon != ""
 }
 
+// IsUserService returns whether app represents a daemon/service that
+// runs in the systemd instance of each user, as opposed to the system
+// instance.
+func (app *AppInfo) IsUserService() bool {
+	return app.IsService() && app.DaemonScope == UserDaemon
+}
+
 // SecurityTag returns the hook-specific security tag.
 //
 // Security tags are used by various security subsystems as "profile names" and
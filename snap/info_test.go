@@ -1182,6 +1182,42 @@ apps:
 	c.Check(svc.ServiceFile(), Equals, dirs.GlobalRootDir+"/etc/systemd/system/snap.pans_instance.svc1.service")
 }
 
+func (s *infoSuite) TestAppInfoIsUserService(c *C) {
+	info, err := snap.InfoFromSnapYaml([]byte(`name: pans
+apps:
+  svc1:
+    daemon: simple
+    daemon-scope: user
+    sockets:
+      sock1:
+        listen-stream: $XDG_RUNTIME_DIR/sock1.socket
+  svc2:
+    daemon: simple
+    daemon-scope: system
+    timer: mon,10:00-12:00
+  svc3:
+    daemon: simple
+`))
+	c.Assert(err, IsNil)
+
+	svc := info.Apps["svc1"]
+	c.Check(svc.DaemonScope, Equals, snap.UserDaemon)
+	c.Check(svc.IsUserService(), Equals, true)
+	c.Check(svc.ServiceFile(), Equals, dirs.GlobalRootDir+"/etc/systemd/user/snap.pans.svc1.service")
+	c.Check(svc.Sockets["sock1"].File(), Equals, dirs.GlobalRootDir+"/etc/systemd/user/snap.pans.svc1.sock1.socket")
+
+	svc = info.Apps["svc2"]
+	c.Check(svc.DaemonScope, Equals, snap.SystemDaemon)
+	c.Check(svc.IsUserService(), Equals, false)
+	c.Check(svc.ServiceFile(), Equals, dirs.GlobalRootDir+"/etc/systemd/system/snap.pans.svc2.service")
+	c.Check(svc.Timer.File(), Equals, dirs.GlobalRootDir+"/etc/systemd/system/snap.pans.svc2.timer")
+
+	svc = info.Apps["svc3"]
+	c.Check(svc.DaemonScope, Equals, snap.DaemonScope(""))
+	c.Check(svc.IsUserService(), Equals, false)
+	c.Check(svc.ServiceFile(), Equals, dirs.GlobalRootDir+"/etc/systemd/system/snap.pans.svc3.service")
+}
+
 func (s *infoSuite) TestAppInfoStringer(c *C) {
 	info, err := snap.InfoFromSnapYaml([]byte(`name: asnap
 apps:
@@ -0,0 +1,107 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package quota defines quota groups, named sets of snaps whose
+// services share resource limits enforced via a systemd slice.
+package quota
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/snap/naming"
+)
+
+// MinMemoryLimit is the smallest memory limit that can be set on a
+// quota group, anything lower would not even let a service start.
+const MinMemoryLimit = 4 * 1024
+
+// validGroupName is like a snap name, but without the requirement of
+// having at least one letter.
+var validGroupName = regexp.MustCompile(`^[a-z0-9](?:-?[a-z0-9])*$`)
+
+// ValidateGroupName checks whether the given name is a valid quota
+// group name.
+func ValidateGroupName(name string) error {
+	if len(name) == 0 || len(name) > 40 || !validGroupName.MatchString(name) {
+		return fmt.Errorf("invalid quota group name %q", name)
+	}
+	return nil
+}
+
+// Group is a named set of snaps whose services share resource limits.
+type Group struct {
+	Name  string   `json:"name"`
+	Snaps []string `json:"snaps,omitempty"`
+
+	// MemoryLimit is the maximum memory in bytes, 0 meaning unlimited.
+	MemoryLimit uint64 `json:"memory-limit,omitempty"`
+	// CPUPercentage is the maximum CPU time as a percentage of a
+	// single CPU, 0 meaning unlimited. It can exceed 100 on systems
+	// with several CPUs.
+	CPUPercentage int `json:"cpu-percentage,omitempty"`
+	// TaskLimit is the maximum number of tasks (processes and
+	// threads), 0 meaning unlimited.
+	TaskLimit int `json:"task-limit,omitempty"`
+}
+
+// Validate checks that the group has a valid name, at least one
+// limit, sensible limit values and valid snap names.
+func (grp *Group) Validate() error {
+	if err := ValidateGroupName(grp.Name); err != nil {
+		return err
+	}
+	if grp.MemoryLimit == 0 && grp.CPUPercentage == 0 && grp.TaskLimit == 0 {
+		return fmt.Errorf("quota group %q must have at least one limit", grp.Name)
+	}
+	if grp.MemoryLimit != 0 && grp.MemoryLimit < MinMemoryLimit {
+		return fmt.Errorf("memory limit for quota group %q must be at least %d bytes", grp.Name, MinMemoryLimit)
+	}
+	if grp.CPUPercentage < 0 {
+		return fmt.Errorf("cpu percentage for quota group %q cannot be negative", grp.Name)
+	}
+	if grp.TaskLimit < 0 {
+		return fmt.Errorf("task limit for quota group %q cannot be negative", grp.Name)
+	}
+	seen := make(map[string]bool, len(grp.Snaps))
+	for _, snapName := range grp.Snaps {
+		if err := naming.ValidateInstance(snapName); err != nil {
+			return err
+		}
+		if seen[snapName] {
+			return fmt.Errorf("snap %q is listed more than once in quota group %q", snapName, grp.Name)
+		}
+		seen[snapName] = true
+	}
+	return nil
+}
+
+// SliceName returns the name of the systemd slice unit of the group.
+func (grp *Group) SliceName() string {
+	// a dash denotes nesting in slice names, so it must be escaped
+	return "snap." + strings.Replace(grp.Name, "-", `\x2d`, -1) + ".slice"
+}
+
+// SliceFile returns the path of the systemd slice unit of the group.
+func (grp *Group) SliceFile() string {
+	return filepath.Join(dirs.SnapServicesDir, grp.SliceName())
+}
@@ -0,0 +1,83 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package quota_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/snap/quota"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type quotaSuite struct{}
+
+var _ = Suite(&quotaSuite{})
+
+func (s *quotaSuite) TestValidateGroupName(c *C) {
+	for _, name := range []string{"a", "foo", "foo-bar", "0", "group1", "1-2-3"} {
+		c.Check(quota.ValidateGroupName(name), IsNil, Commentf("%q", name))
+	}
+	for _, name := range []string{"", "Foo", "-foo", "foo-", "foo--bar", "foo_bar", "foo.bar",
+		"this-is-a-very-long-group-name-that-is-over-forty-chars"} {
+		c.Check(quota.ValidateGroupName(name), ErrorMatches, `invalid quota group name ".*"`, Commentf("%q", name))
+	}
+}
+
+func (s *quotaSuite) TestValidate(c *C) {
+	for _, t := range []struct {
+		grp *quota.Group
+		err string
+	}{
+		{&quota.Group{Name: "foo", MemoryLimit: quota.MinMemoryLimit}, ""},
+		{&quota.Group{Name: "foo", CPUPercentage: 250}, ""},
+		{&quota.Group{Name: "foo", TaskLimit: 32, Snaps: []string{"bar", "baz_1"}}, ""},
+		{&quota.Group{Name: "Foo", TaskLimit: 32}, `invalid quota group name "Foo"`},
+		{&quota.Group{Name: "foo"}, `quota group "foo" must have at least one limit`},
+		{&quota.Group{Name: "foo", MemoryLimit: 1}, `memory limit for quota group "foo" must be at least 4096 bytes`},
+		{&quota.Group{Name: "foo", CPUPercentage: -1}, `cpu percentage for quota group "foo" cannot be negative`},
+		{&quota.Group{Name: "foo", TaskLimit: -1}, `task limit for quota group "foo" cannot be negative`},
+		{&quota.Group{Name: "foo", TaskLimit: 1, Snaps: []string{"Bar"}}, `invalid snap name: "Bar"`},
+		{&quota.Group{Name: "foo", TaskLimit: 1, Snaps: []string{"bar", "bar"}}, `snap "bar" is listed more than once in quota group "foo"`},
+	} {
+		err := t.grp.Validate()
+		if t.err == "" {
+			c.Check(err, IsNil, Commentf("%+v", t.grp))
+		} else {
+			c.Check(err, ErrorMatches, t.err, Commentf("%+v", t.grp))
+		}
+	}
+}
+
+func (s *quotaSuite) TestSliceName(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	defer dirs.SetRootDir("")
+
+	grp := &quota.Group{Name: "foo-bar"}
+	c.Check(grp.SliceName(), Equals, `snap.foo\x2dbar.slice`)
+	c.Check(grp.SliceFile(), Equals, filepath.Join(dirs.SnapServicesDir, `snap.foo\x2dbar.slice`))
+
+	grp = &quota.Group{Name: "foo"}
+	c.Check(grp.SliceName(), Equals, "snap.foo.slice")
+}
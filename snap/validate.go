@@ -201,6 +201,15 @@ func validateSocketAddrPath(socket *SocketInfo, fieldName string, path string) e
 		return fmt.Errorf("invalid %q: %q should be written as %q", fieldName, path, clean)
 	}
 
+	if socket.App != nil && socket.App.IsUserService() {
+		// user services can only listen on paths owned by the user
+		if !(strings.HasPrefix(path, "$SNAP_USER_DATA/") || strings.HasPrefix(path, "$SNAP_USER_COMMON/") || strings.HasPrefix(path, "$XDG_RUNTIME_DIR/")) {
+			return fmt.Errorf(
+				"invalid %q: must have a prefix of $SNAP_USER_DATA, $SNAP_USER_COMMON or $XDG_RUNTIME_DIR", fieldName)
+		}
+		return nil
+	}
+
 	if !(strings.HasPrefix(path, "$SNAP_DATA/") || strings.HasPrefix(path, "$SNAP_COMMON/") || strings.HasPrefix(path, "$XDG_RUNTIME_DIR/")) {
 		return fmt.Errorf(
 			"invalid %q: must have a prefix of $SNAP_DATA, $SNAP_COMMON or $XDG_RUNTIME_DIR", fieldName)
@@ -513,6 +522,10 @@ func validateAppOrderNames(app *AppInfo, dependencies []string) error {
 		if !other.IsService() {
 			return fmt.Errorf("before/after references a non-service application %q", dep)
 		}
+
+		if other.IsUserService() != app.IsUserService() {
+			return fmt.Errorf("before/after references service with different daemon-scope %q", dep)
+		}
 	}
 	return nil
 }
@@ -674,6 +687,14 @@ func ValidateApp(app *AppInfo) error {
 		return fmt.Errorf(`"refresh-mode" cannot be used for %q, only for services`, app.Name)
 	}
 
+	// validate daemon-scope
+	if err := app.DaemonScope.Validate(); err != nil {
+		return err
+	}
+	if app.DaemonScope != "" && app.Daemon == "" {
+		return fmt.Errorf(`"daemon-scope" cannot be used for %q, only for services`, app.Name)
+	}
+
 	return validateAppTimer(app)
 }
 
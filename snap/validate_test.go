@@ -278,6 +278,30 @@ func (s *ValidateSuite) TestValidateAppSocketsInvalidListenStreamPathPrefix(c *C
 	}
 }
 
+func (s *ValidateSuite) TestValidateAppSocketsUserServiceListenStreamPath(c *C) {
+	app := createSampleApp()
+	app.Daemon = "simple"
+	app.DaemonScope = UserDaemon
+	socket := app.Sockets["sock"]
+	for _, validAddress := range []string{
+		"$SNAP_USER_DATA/my.socket",
+		"$SNAP_USER_COMMON/my.socket",
+		"$XDG_RUNTIME_DIR/my.socket",
+	} {
+		socket.ListenStream = validAddress
+		c.Check(ValidateApp(app), IsNil)
+	}
+
+	for _, invalidAddress := range []string{
+		"$SNAP_DATA/my.socket",
+		"$SNAP_COMMON/my.socket",
+	} {
+		socket.ListenStream = invalidAddress
+		c.Check(ValidateApp(app), ErrorMatches,
+			`invalid definition of socket "sock": invalid "listen-stream": must have a prefix of \$SNAP_USER_DATA, \$SNAP_USER_COMMON or \$XDG_RUNTIME_DIR`)
+	}
+}
+
 func (s *ValidateSuite) TestValidateAppSocketsInvalidListenStreamAbstractSocket(c *C) {
 	app := createSampleApp()
 	invalidListenAddresses := []string{
@@ -409,6 +433,30 @@ func (s *ValidateSuite) TestAppStopMode(c *C) {
 	c.Check(err, ErrorMatches, `"stop-mode" cannot be used for "foo", only for services`)
 }
 
+func (s *ValidateSuite) TestAppDaemonScope(c *C) {
+	for _, t := range []struct {
+		daemonScope DaemonScope
+		ok          bool
+	}{
+		// good
+		{"", true},
+		{SystemDaemon, true},
+		{UserDaemon, true},
+		// bad
+		{"invalid-thing", false},
+	} {
+		if t.ok {
+			c.Check(ValidateApp(&AppInfo{Name: "foo", Daemon: "simple", DaemonScope: t.daemonScope}), IsNil)
+		} else {
+			c.Check(ValidateApp(&AppInfo{Name: "foo", Daemon: "simple", DaemonScope: t.daemonScope}), ErrorMatches, fmt.Sprintf(`"daemon-scope" field contains invalid value %q`, t.daemonScope))
+		}
+	}
+
+	// non-services cannot have a daemon-scope
+	err := ValidateApp(&AppInfo{Name: "foo", Daemon: "", DaemonScope: UserDaemon})
+	c.Check(err, ErrorMatches, `"daemon-scope" cannot be used for "foo", only for services`)
+}
+
 func (s *ValidateSuite) TestAppRefreshMode(c *C) {
 	// check services
 	for _, t := range []struct {
@@ -1085,6 +1133,16 @@ apps:
    daemon: forking
  zed:
    daemon: forking
+`)
+	// user and system services cannot be ordered against each other
+	fooUserAfterBar := []byte(`
+apps:
+ foo:
+   after: [bar]
+   daemon: simple
+   daemon-scope: user
+ bar:
+   daemon: simple
 `)
 	goodOrder1 := []byte(`
 apps:
@@ -1135,6 +1193,10 @@ apps:
 		name: "foo wants bar, bar not a daemon",
 		desc: fooBarNotADaemon,
 		err:  `invalid definition of application "foo": before/after references a non-service application "bar"`,
+	}, {
+		name: "foo user service after bar system service",
+		desc: fooUserAfterBar,
+		err:  `invalid definition of application "foo": before/after references service with different daemon-scope "bar"`,
 	}, {
 		name: "bad order 1",
 		desc: badOrder1,
@@ -0,0 +1,46 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package snapdenv presents common environment (and related) options
+// for snapd components.
+package snapdenv
+
+import (
+	"github.com/snapcore/snapd/osutil"
+)
+
+var mockPreseeding *bool
+
+// Preseeding returns whether snapd is preseeding, i.e. performing
+// a partial first boot updating only filesystem state inside a chroot.
+func Preseeding() bool {
+	if mockPreseeding != nil {
+		return *mockPreseeding
+	}
+	return osutil.GetenvBool("SNAPD_PRESEED")
+}
+
+// MockPreseeding fakes the preseeding environment for testing.
+func MockPreseeding(preseeding bool) (restore func()) {
+	old := mockPreseeding
+	mockPreseeding = &preseeding
+	return func() {
+		mockPreseeding = old
+	}
+}
@@ -0,0 +1,60 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapdenv_test
+
+import (
+	"os"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/snapdenv"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type snapdenvSuite struct{}
+
+var _ = Suite(&snapdenvSuite{})
+
+func (s *snapdenvSuite) TestPreseeding(c *C) {
+	oldPreseed := os.Getenv("SNAPD_PRESEED")
+	defer os.Setenv("SNAPD_PRESEED", oldPreseed)
+
+	os.Setenv("SNAPD_PRESEED", "1")
+	c.Check(snapdenv.Preseeding(), Equals, true)
+
+	os.Setenv("SNAPD_PRESEED", "0")
+	c.Check(snapdenv.Preseeding(), Equals, false)
+
+	os.Unsetenv("SNAPD_PRESEED")
+	c.Check(snapdenv.Preseeding(), Equals, false)
+}
+
+func (s *snapdenvSuite) TestMockPreseeding(c *C) {
+	oldPreseed := os.Getenv("SNAPD_PRESEED")
+	defer os.Setenv("SNAPD_PRESEED", oldPreseed)
+	os.Unsetenv("SNAPD_PRESEED")
+
+	restore := snapdenv.MockPreseeding(true)
+	c.Check(snapdenv.Preseeding(), Equals, true)
+	restore()
+	c.Check(snapdenv.Preseeding(), Equals, false)
+}
@@ -191,3 +191,11 @@ func MockRatelimitReader(f func(r io.Reader, bucket *ratelimit.Bucket) io.Reader
 		ratelimitReader = oldRatelimitReader
 	}
 }
+
+func MockReadLocalSnapInfo(f func(snapPath string, si *snap.SideInfo) (*snap.Info, error)) (restore func()) {
+	old := readLocalSnapInfo
+	readLocalSnapInfo = f
+	return func() {
+		readLocalSnapInfo = old
+	}
+}
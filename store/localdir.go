@@ -0,0 +1,598 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package store
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/progress"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
+)
+
+// localSnap is a snap file found in a local store directory together
+// with the data from its snap-revision and snap-declaration assertions.
+type localSnap struct {
+	path        string
+	name        string
+	snapID      string
+	revision    snap.Revision
+	size        int64
+	sha3_384    string
+	publisherID string
+}
+
+// localDirStore serves snaps and assertions out of a local directory,
+// as populated by snap download, allowing air-gapped devices to
+// install and refresh snaps. Every <basename>.snap file in the
+// directory must come with a <basename>.assert file holding its
+// supporting assertions; snaps without them are ignored.
+type localDirStore struct {
+	dir          string
+	series       string
+	architecture string
+
+	mu      sync.Mutex
+	modTime time.Time
+	loaded  bool
+	// snaps by snap-id, highest revision first
+	snaps   map[string][]*localSnap
+	snapIDs map[string]string
+	asserts map[string]asserts.Assertion
+}
+
+func newLocalDirStore(dir, series, architecture string) *localDirStore {
+	return &localDirStore{
+		dir:          dir,
+		series:       series,
+		architecture: architecture,
+	}
+}
+
+var readLocalSnapInfo = func(snapPath string, si *snap.SideInfo) (*snap.Info, error) {
+	snapf, err := snap.Open(snapPath)
+	if err != nil {
+		return nil, err
+	}
+	return snap.ReadInfoFromSnapFile(snapf, si)
+}
+
+func assertionKey(assertType *asserts.AssertionType, primaryKey []string) string {
+	return (&asserts.Ref{Type: assertType, PrimaryKey: primaryKey}).Unique()
+}
+
+// load (re)indexes the directory if it changed since it was last
+// looked at. It must be called with the lock held.
+func (ls *localDirStore) load() error {
+	fi, err := os.Stat(ls.dir)
+	if err != nil {
+		return fmt.Errorf("cannot use local store directory: %v", err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("cannot use local store directory: %q is not a directory", ls.dir)
+	}
+	if ls.loaded && fi.ModTime().Equal(ls.modTime) {
+		return nil
+	}
+
+	assertFiles, err := filepath.Glob(filepath.Join(ls.dir, "*.assert"))
+	if err != nil {
+		return err
+	}
+
+	assertsByKey := make(map[string]asserts.Assertion)
+	snapRevs := make(map[string][]*asserts.SnapRevision)
+	for _, assertFile := range assertFiles {
+		f, err := os.Open(assertFile)
+		if err != nil {
+			return err
+		}
+		dec := asserts.NewDecoder(f)
+		for {
+			a, err := dec.Decode()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				f.Close()
+				return fmt.Errorf("cannot read assertions from %q: %v", assertFile, err)
+			}
+			key := a.Ref().Unique()
+			if prev := assertsByKey[key]; prev == nil || prev.Revision() < a.Revision() {
+				assertsByKey[key] = a
+			}
+			if snapRev, ok := a.(*asserts.SnapRevision); ok {
+				snapRevs[assertFile] = append(snapRevs[assertFile], snapRev)
+			}
+		}
+		f.Close()
+	}
+
+	snaps := make(map[string][]*localSnap)
+	snapIDs := make(map[string]string)
+	for assertFile, revs := range snapRevs {
+		snapPath := strings.TrimSuffix(assertFile, ".assert") + ".snap"
+		snapFi, err := os.Stat(snapPath)
+		if err != nil {
+			logger.Debugf("cannot use assertions from %q in local store directory: %v", assertFile, err)
+			continue
+		}
+		for _, snapRev := range revs {
+			if uint64(snapFi.Size()) != snapRev.SnapSize() {
+				continue
+			}
+			declKey := assertionKey(asserts.SnapDeclarationType, []string{ls.series, snapRev.SnapID()})
+			decl, ok := assertsByKey[declKey].(*asserts.SnapDeclaration)
+			if !ok {
+				logger.Noticef("cannot use %q from local store directory: no snap-declaration for snap-id %q", snapPath, snapRev.SnapID())
+				break
+			}
+			if decl.SnapName() == "" {
+				// revoked name
+				break
+			}
+			// the assertion carries the digest base64 encoded,
+			// download info and the store API use hex
+			digest, err := base64.RawURLEncoding.DecodeString(snapRev.SnapSHA3_384())
+			if err != nil {
+				return fmt.Errorf("cannot decode snap-revision digest from %q: %v", assertFile, err)
+			}
+			lsnap := &localSnap{
+				path:        snapPath,
+				name:        decl.SnapName(),
+				snapID:      snapRev.SnapID(),
+				revision:    snap.R(snapRev.SnapRevision()),
+				size:        int64(snapRev.SnapSize()),
+				sha3_384:    hex.EncodeToString(digest),
+				publisherID: decl.PublisherID(),
+			}
+			snaps[lsnap.snapID] = append(snaps[lsnap.snapID], lsnap)
+			snapIDs[lsnap.name] = lsnap.snapID
+			break
+		}
+	}
+	for _, lsnaps := range snaps {
+		sort.Slice(lsnaps, func(i, j int) bool {
+			return lsnaps[i].revision.N > lsnaps[j].revision.N
+		})
+	}
+
+	ls.snaps = snaps
+	ls.snapIDs = snapIDs
+	ls.asserts = assertsByKey
+	ls.modTime = fi.ModTime()
+	ls.loaded = true
+	return nil
+}
+
+// info returns a fresh snap.Info for the given local snap, or nil if
+// it cannot be used on this architecture.
+func (ls *localDirStore) info(lsnap *localSnap) (*snap.Info, error) {
+	si := &snap.SideInfo{
+		RealName: lsnap.name,
+		SnapID:   lsnap.snapID,
+		Revision: lsnap.revision,
+	}
+	info, err := readLocalSnapInfo(lsnap.path, si)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read snap %q from local store directory: %v", lsnap.path, err)
+	}
+	if len(info.Architectures) != 0 && !strutil.ListContains(info.Architectures, "all") && !strutil.ListContains(info.Architectures, ls.architecture) {
+		return nil, nil
+	}
+
+	info.DownloadInfo = snap.DownloadInfo{
+		DownloadURL: (&url.URL{Scheme: "file", Path: lsnap.path}).String(),
+		Size:        lsnap.size,
+		Sha3_384:    lsnap.sha3_384,
+	}
+	info.Publisher = snap.StoreAccount{ID: lsnap.publisherID}
+	accKey := assertionKey(asserts.AccountType, []string{lsnap.publisherID})
+	if acct, ok := ls.asserts[accKey].(*asserts.Account); ok {
+		info.Publisher.Username = acct.Username()
+		info.Publisher.DisplayName = acct.DisplayName()
+		info.Publisher.Validation = acct.Validation()
+	}
+	return info, nil
+}
+
+// find returns the snap.Info for the given revision of the snap with
+// the given snap-id, or for its highest usable revision if revision is
+// unset. It must be called with the lock held.
+func (ls *localDirStore) find(snapID string, revision snap.Revision) (*snap.Info, error) {
+	for _, lsnap := range ls.snaps[snapID] {
+		if !revision.Unset() && lsnap.revision != revision {
+			continue
+		}
+		info, err := ls.info(lsnap)
+		if err != nil {
+			logger.Noticef("%v", err)
+			continue
+		}
+		if info != nil {
+			return info, nil
+		}
+	}
+	return nil, ErrSnapNotFound
+}
+
+func (ls *localDirStore) findByName(name string, revision snap.Revision) (*snap.Info, error) {
+	snapID, ok := ls.snapIDs[name]
+	if !ok {
+		return nil, ErrSnapNotFound
+	}
+	return ls.find(snapID, revision)
+}
+
+func (ls *localDirStore) byDigest(sha3_384 string) *localSnap {
+	for _, lsnaps := range ls.snaps {
+		for _, lsnap := range lsnaps {
+			if lsnap.sha3_384 == sha3_384 {
+				return lsnap
+			}
+		}
+	}
+	return nil
+}
+
+// names returns the names of the snaps in the directory, sorted.
+func (ls *localDirStore) names() []string {
+	names := make([]string, 0, len(ls.snapIDs))
+	for name := range ls.snapIDs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (ls *localDirStore) SnapInfo(snapSpec SnapSpec) (*snap.Info, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if err := ls.load(); err != nil {
+		return nil, err
+	}
+	return ls.findByName(snapSpec.Name, snap.Revision{})
+}
+
+func (ls *localDirStore) Find(search *Search) ([]*snap.Info, error) {
+	searchTerm := strings.TrimSpace(search.Query)
+	if strings.ContainsAny(searchTerm, `+=&|><!(){}[]^"~*?:\/`) {
+		return nil, ErrBadQuery
+	}
+	if search.Private || search.Section != "" {
+		// there are no private snaps nor sections in a local
+		// store directory
+		return nil, nil
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if err := ls.load(); err != nil {
+		return nil, err
+	}
+
+	lowerTerm := strings.ToLower(searchTerm)
+	var snaps []*snap.Info
+	for _, name := range ls.names() {
+		if search.Prefix && !strings.HasPrefix(name, searchTerm) {
+			continue
+		}
+		info, err := ls.findByName(name, snap.Revision{})
+		if err != nil {
+			continue
+		}
+		if search.CommonID != "" && !strutil.ListContains(info.CommonIDs, search.CommonID) {
+			continue
+		}
+		if !search.Prefix && lowerTerm != "" {
+			match := strings.Contains(name, lowerTerm) ||
+				strings.Contains(strings.ToLower(info.Title()), lowerTerm) ||
+				strings.Contains(strings.ToLower(info.Summary()), lowerTerm)
+			if !match {
+				continue
+			}
+		}
+		snaps = append(snaps, info)
+	}
+	return snaps, nil
+}
+
+func (ls *localDirStore) WriteCatalogs(names io.Writer, adder SnapAdder) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if err := ls.load(); err != nil {
+		return err
+	}
+
+	for _, name := range ls.names() {
+		info, err := ls.findByName(name, snap.Revision{})
+		if err != nil {
+			continue
+		}
+		fmt.Fprintln(names, name)
+		if len(info.Apps) == 0 {
+			continue
+		}
+		commands := make([]string, 0, len(info.Apps))
+		for appName := range info.Apps {
+			commands = append(commands, snap.JoinSnapApp(name, appName))
+		}
+		sort.Strings(commands)
+		if err := adder.AddSnap(name, info.Version, info.Summary(), commands); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ls *localDirStore) SnapAction(currentSnaps []*CurrentSnap, actions []*SnapAction) ([]*snap.Info, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if err := ls.load(); err != nil {
+		return nil, err
+	}
+
+	curSnaps := make(map[string]*CurrentSnap, len(currentSnaps))
+	for _, curSnap := range currentSnaps {
+		if curSnap.SnapID == "" || curSnap.InstanceName == "" || curSnap.Revision.Unset() {
+			return nil, fmt.Errorf("internal error: invalid current snap information")
+		}
+		curSnaps[curSnap.InstanceName] = curSnap
+	}
+
+	refreshErrors := make(map[string]error)
+	installErrors := make(map[string]error)
+	downloadErrors := make(map[string]error)
+
+	var snaps []*snap.Info
+	for _, a := range actions {
+		if !isValidAction(a.Action) {
+			return nil, fmt.Errorf("internal error: unsupported action %q", a.Action)
+		}
+		if a.InstanceName == "" {
+			return nil, fmt.Errorf("internal error: action without instance name")
+		}
+
+		var info *snap.Info
+		var err error
+		channel := a.Channel
+		switch a.Action {
+		case "refresh":
+			cur := curSnaps[a.InstanceName]
+			if cur == nil {
+				return nil, fmt.Errorf("internal error: refresh action for %q without current snap", a.InstanceName)
+			}
+			if channel == "" && a.Revision.Unset() {
+				channel = cur.TrackingChannel
+			}
+			info, err = ls.find(cur.SnapID, a.Revision)
+			if err == nil {
+				upToDate := info.Revision == cur.Revision || findRev(info.Revision, cur.Block)
+				if a.Revision.Unset() && info.Revision.N < cur.Revision.N {
+					upToDate = true
+				}
+				if upToDate {
+					err = ErrNoUpdateAvailable
+				}
+			}
+		default:
+			info, err = ls.findByName(snap.InstanceSnap(a.InstanceName), a.Revision)
+		}
+		if err == ErrSnapNotFound && !a.Revision.Unset() {
+			err = &RevisionNotAvailableError{
+				Action:  a.Action,
+				Channel: channel,
+			}
+		}
+		if err != nil {
+			switch a.Action {
+			case "refresh":
+				refreshErrors[a.InstanceName] = err
+			case "install":
+				installErrors[a.InstanceName] = err
+			case "download":
+				downloadErrors[a.InstanceName] = err
+			}
+			continue
+		}
+
+		info.Channel = channel
+		if a.Action != "download" {
+			_, info.InstanceKey = snap.SplitInstanceName(a.InstanceName)
+		}
+		snaps = append(snaps, info)
+	}
+
+	if len(refreshErrors)+len(installErrors)+len(downloadErrors) != 0 {
+		// normalize empty maps
+		if len(refreshErrors) == 0 {
+			refreshErrors = nil
+		}
+		if len(installErrors) == 0 {
+			installErrors = nil
+		}
+		if len(downloadErrors) == 0 {
+			downloadErrors = nil
+		}
+		return snaps, &SnapActionError{
+			NoResults: len(snaps) == 0,
+			Refresh:   refreshErrors,
+			Install:   installErrors,
+			Download:  downloadErrors,
+		}
+	}
+
+	return snaps, nil
+}
+
+func (ls *localDirStore) localSnapForDownload(name string, downloadInfo *snap.DownloadInfo) (*localSnap, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if err := ls.load(); err != nil {
+		return nil, err
+	}
+	lsnap := ls.byDigest(downloadInfo.Sha3_384)
+	if lsnap == nil {
+		return nil, fmt.Errorf("cannot find snap %q with sha3-384 %s in local store directory", name, downloadInfo.Sha3_384)
+	}
+	return lsnap, nil
+}
+
+func (ls *localDirStore) Download(name, targetPath string, downloadInfo *snap.DownloadInfo, pbar progress.Meter) (err error) {
+	lsnap, err := ls.localSnapForDownload(name, downloadInfo)
+	if err != nil {
+		return err
+	}
+
+	r, err := os.Open(lsnap.path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+		return err
+	}
+	partialPath := targetPath + ".partial"
+	w, err := os.OpenFile(partialPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := w.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(partialPath)
+		}
+	}()
+
+	h := crypto.SHA3_384.New()
+	if pbar == nil {
+		pbar = progress.Null
+	}
+	pbar.Start(name, float64(lsnap.size))
+	_, err = io.Copy(io.MultiWriter(w, h, pbar), r)
+	pbar.Finished()
+	if err != nil {
+		return err
+	}
+
+	actualSha3 := hex.EncodeToString(h.Sum(nil))
+	if actualSha3 != downloadInfo.Sha3_384 {
+		return HashError{name, actualSha3, downloadInfo.Sha3_384}
+	}
+	if err := w.Sync(); err != nil {
+		return err
+	}
+	return os.Rename(partialPath, targetPath)
+}
+
+func (ls *localDirStore) DownloadStream(name string, downloadInfo *snap.DownloadInfo) (io.ReadCloser, error) {
+	lsnap, err := ls.localSnapForDownload(name, downloadInfo)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(lsnap.path)
+}
+
+func (ls *localDirStore) Assertion(assertType *asserts.AssertionType, primaryKey []string) (asserts.Assertion, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if err := ls.load(); err != nil {
+		return nil, err
+	}
+
+	if a := ls.asserts[assertionKey(assertType, primaryKey)]; a != nil {
+		return a, nil
+	}
+	// best-effort
+	headers, _ := asserts.HeadersFromPrimaryKey(assertType, primaryKey)
+	return nil, &asserts.NotFoundError{
+		Type:    assertType,
+		Headers: headers,
+	}
+}
+
+// inSequence returns whether the assertion of a sequence forming type
+// is in the sequence with the given key.
+func inSequence(a asserts.Assertion, sequenceKey []string) bool {
+	key := a.Ref().PrimaryKey
+	if len(key) != len(sequenceKey)+1 {
+		return false
+	}
+	for i, k := range sequenceKey {
+		if key[i] != k {
+			return false
+		}
+	}
+	return true
+}
+
+func (ls *localDirStore) SeqFormingAssertion(assertType *asserts.AssertionType, sequenceKey []string) (asserts.Assertion, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if err := ls.load(); err != nil {
+		return nil, err
+	}
+
+	var latest asserts.SequenceMember
+	for _, a := range ls.asserts {
+		if a.Type() != assertType {
+			continue
+		}
+		if !inSequence(a, sequenceKey) {
+			continue
+		}
+		member := a.(asserts.SequenceMember)
+		if latest == nil || member.Sequence() > latest.Sequence() {
+			latest = member
+		}
+	}
+	if latest != nil {
+		return latest, nil
+	}
+	// best-effort
+	headers, _ := asserts.HeadersFromSequenceKey(assertType, sequenceKey)
+	return nil, &asserts.NotFoundError{
+		Type:    assertType,
+		Headers: headers,
+	}
+}
+
+func (ls *localDirStore) ConnectivityCheck() map[string]bool {
+	return map[string]bool{
+		ls.dir: osutil.IsDirectory(ls.dir),
+	}
+}
@@ -0,0 +1,412 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/progress"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/store"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type localDirSuite struct {
+	testutil.BaseTest
+
+	storeSigning *assertstest.StoreStack
+	dev1Acct     *asserts.Account
+
+	dir   string
+	store *store.Store
+}
+
+var _ = Suite(&localDirSuite{})
+
+var localSnapYamls = map[string]string{
+	"foo": `name: foo
+version: 1.0
+summary: Foo the snap
+apps:
+  foo:
+    command: bin/foo
+    common-id: org.example.Foo
+`,
+	"bar": `name: bar
+version: 2.0
+summary: Bar is a snap too
+`,
+	"other-arch": `name: other-arch
+version: 1.0
+architectures: [no-such-arch]
+`,
+}
+
+func (s *localDirSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	s.AddCleanup(snap.MockSanitizePlugsSlots(func(snapInfo *snap.Info) {}))
+
+	s.storeSigning = assertstest.NewStoreStack("can0nical", nil)
+	s.dev1Acct = assertstest.NewAccount(s.storeSigning, "developer1", map[string]interface{}{
+		"display-name": "Developer One",
+	}, "")
+
+	s.dir = c.MkDir()
+	s.store = store.New(&store.Config{
+		StoreBaseURL: &url.URL{Scheme: "file", Path: s.dir},
+	}, nil)
+
+	s.AddCleanup(store.MockReadLocalSnapInfo(func(snapPath string, si *snap.SideInfo) (*snap.Info, error) {
+		info, err := snap.InfoFromSnapYaml([]byte(localSnapYamls[si.RealName]))
+		if err != nil {
+			return nil, err
+		}
+		info.SideInfo = *si
+		return info, nil
+	}))
+
+	s.addSnap(c, "foo", "foo-id", 1)
+	s.addSnap(c, "foo", "foo-id", 3)
+	s.addSnap(c, "bar", "bar-id", 7)
+	s.addSnap(c, "other-arch", "other-arch-id", 1)
+}
+
+func (s *localDirSuite) addSnap(c *C, name, snapID string, revision int) {
+	basename := filepath.Join(s.dir, fmt.Sprintf("%s_%d", name, revision))
+	snapPath := basename + ".snap"
+	err := ioutil.WriteFile(snapPath, []byte(fmt.Sprintf("%s-%d", name, revision)), 0644)
+	c.Assert(err, IsNil)
+	digest, size, err := asserts.SnapFileSHA3_384(snapPath)
+	c.Assert(err, IsNil)
+
+	snapDecl, err := s.storeSigning.Sign(asserts.SnapDeclarationType, map[string]interface{}{
+		"series":       "16",
+		"snap-id":      snapID,
+		"snap-name":    name,
+		"publisher-id": s.dev1Acct.AccountID(),
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	snapRev, err := s.storeSigning.Sign(asserts.SnapRevisionType, map[string]interface{}{
+		"snap-sha3-384": digest,
+		"snap-size":     fmt.Sprintf("%d", size),
+		"snap-id":       snapID,
+		"snap-revision": fmt.Sprintf("%d", revision),
+		"developer-id":  s.dev1Acct.AccountID(),
+		"timestamp":     time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+
+	f, err := os.Create(basename + ".assert")
+	c.Assert(err, IsNil)
+	defer f.Close()
+	enc := asserts.NewEncoder(f)
+	for _, a := range []asserts.Assertion{s.storeSigning.StoreAccountKey(""), s.dev1Acct, snapDecl, snapRev} {
+		c.Assert(enc.Encode(a), IsNil)
+	}
+}
+
+func (s *localDirSuite) TestSnapInfo(c *C) {
+	info, err := s.store.SnapInfo(context.TODO(), store.SnapSpec{Name: "foo"}, nil)
+	c.Assert(err, IsNil)
+	c.Check(info.SnapName(), Equals, "foo")
+	c.Check(info.SnapID, Equals, "foo-id")
+	c.Check(info.Revision, Equals, snap.R(3))
+	c.Check(info.Version, Equals, "1.0")
+	c.Check(info.CommonIDs, DeepEquals, []string{"org.example.Foo"})
+	c.Check(info.Publisher, DeepEquals, snap.StoreAccount{
+		ID:          s.dev1Acct.AccountID(),
+		Username:    "developer1",
+		DisplayName: "Developer One",
+		Validation:  "unproven",
+	})
+	c.Check(info.DownloadURL, Equals, "file://"+filepath.Join(s.dir, "foo_3.snap"))
+	c.Check(info.Size, Equals, int64(len("foo-3")))
+
+	_, err = s.store.SnapInfo(context.TODO(), store.SnapSpec{Name: "baz"}, nil)
+	c.Check(err, Equals, store.ErrSnapNotFound)
+
+	// not for this architecture
+	_, err = s.store.SnapInfo(context.TODO(), store.SnapSpec{Name: "other-arch"}, nil)
+	c.Check(err, Equals, store.ErrSnapNotFound)
+}
+
+func (s *localDirSuite) TestSnapInfoNewSnapsAreNoticed(c *C) {
+	_, err := s.store.SnapInfo(context.TODO(), store.SnapSpec{Name: "baz"}, nil)
+	c.Check(err, Equals, store.ErrSnapNotFound)
+
+	localSnapYamls["baz"] = "name: baz\nversion: 1\n"
+	defer delete(localSnapYamls, "baz")
+	s.addSnap(c, "baz", "baz-id", 1)
+	// make sure the directory modification time changes
+	later := time.Now().Add(time.Minute)
+	c.Assert(os.Chtimes(s.dir, later, later), IsNil)
+
+	info, err := s.store.SnapInfo(context.TODO(), store.SnapSpec{Name: "baz"}, nil)
+	c.Assert(err, IsNil)
+	c.Check(info.SnapID, Equals, "baz-id")
+}
+
+func (s *localDirSuite) TestSnapInfoViaProxyStoreParams(c *C) {
+	dauthCtx := &testDauthContext{
+		c:             c,
+		proxyStoreID:  "foo",
+		proxyStoreURL: &url.URL{Scheme: "file", Path: s.dir},
+	}
+	sto := store.New(&store.Config{}, dauthCtx)
+
+	info, err := sto.SnapInfo(context.TODO(), store.SnapSpec{Name: "bar"}, nil)
+	c.Assert(err, IsNil)
+	c.Check(info.Revision, Equals, snap.R(7))
+}
+
+func (s *localDirSuite) TestFind(c *C) {
+	names := func(infos []*snap.Info) []string {
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.SnapName())
+		}
+		return names
+	}
+
+	infos, err := s.store.Find(context.TODO(), &store.Search{Query: "snap"}, nil)
+	c.Assert(err, IsNil)
+	c.Check(names(infos), DeepEquals, []string{"bar", "foo"})
+
+	infos, err = s.store.Find(context.TODO(), &store.Search{Query: "too"}, nil)
+	c.Assert(err, IsNil)
+	c.Check(names(infos), DeepEquals, []string{"bar"})
+
+	infos, err = s.store.Find(context.TODO(), &store.Search{Query: "fo", Prefix: true}, nil)
+	c.Assert(err, IsNil)
+	c.Check(names(infos), DeepEquals, []string{"foo"})
+
+	infos, err = s.store.Find(context.TODO(), &store.Search{CommonID: "org.example.Foo"}, nil)
+	c.Assert(err, IsNil)
+	c.Check(names(infos), DeepEquals, []string{"foo"})
+
+	infos, err = s.store.Find(context.TODO(), &store.Search{Query: "foo", Section: "games"}, nil)
+	c.Assert(err, IsNil)
+	c.Check(infos, HasLen, 0)
+
+	_, err = s.store.Find(context.TODO(), &store.Search{Query: "foo*"}, nil)
+	c.Check(err, Equals, store.ErrBadQuery)
+}
+
+func (s *localDirSuite) TestSnapActionInstall(c *C) {
+	infos, err := s.store.SnapAction(context.TODO(), nil, []*store.SnapAction{
+		{Action: "install", InstanceName: "foo_instance", Channel: "stable"},
+		{Action: "install", InstanceName: "bar", Revision: snap.R(7)},
+	}, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(infos, HasLen, 2)
+	c.Check(infos[0].InstanceName(), Equals, "foo_instance")
+	c.Check(infos[0].Revision, Equals, snap.R(3))
+	c.Check(infos[0].Channel, Equals, "stable")
+	c.Check(infos[1].InstanceName(), Equals, "bar")
+	c.Check(infos[1].Revision, Equals, snap.R(7))
+}
+
+func (s *localDirSuite) TestSnapActionInstallErrors(c *C) {
+	infos, err := s.store.SnapAction(context.TODO(), nil, []*store.SnapAction{
+		{Action: "install", InstanceName: "baz"},
+		{Action: "install", InstanceName: "foo", Revision: snap.R(2)},
+		{Action: "download", InstanceName: "bar"},
+	}, nil, nil)
+	c.Assert(infos, HasLen, 1)
+	c.Check(infos[0].SnapName(), Equals, "bar")
+	c.Check(err, DeepEquals, &store.SnapActionError{
+		Install: map[string]error{
+			"baz": store.ErrSnapNotFound,
+			"foo": &store.RevisionNotAvailableError{Action: "install"},
+		},
+	})
+}
+
+func (s *localDirSuite) TestSnapActionRefresh(c *C) {
+	current := []*store.CurrentSnap{
+		{InstanceName: "foo", SnapID: "foo-id", Revision: snap.R(1), TrackingChannel: "beta"},
+		{InstanceName: "bar", SnapID: "bar-id", Revision: snap.R(7)},
+	}
+	infos, err := s.store.SnapAction(context.TODO(), current, []*store.SnapAction{
+		{Action: "refresh", InstanceName: "foo", SnapID: "foo-id"},
+		{Action: "refresh", InstanceName: "bar", SnapID: "bar-id"},
+	}, nil, nil)
+	c.Assert(infos, HasLen, 1)
+	c.Check(infos[0].SnapName(), Equals, "foo")
+	c.Check(infos[0].Revision, Equals, snap.R(3))
+	c.Check(infos[0].Channel, Equals, "beta")
+	c.Check(err, DeepEquals, &store.SnapActionError{
+		Refresh: map[string]error{
+			"bar": store.ErrNoUpdateAvailable,
+		},
+	})
+}
+
+func (s *localDirSuite) TestSnapActionRefreshBlocked(c *C) {
+	current := []*store.CurrentSnap{
+		{InstanceName: "foo", SnapID: "foo-id", Revision: snap.R(1), Block: []snap.Revision{snap.R(3)}},
+	}
+	_, err := s.store.SnapAction(context.TODO(), current, []*store.SnapAction{
+		{Action: "refresh", InstanceName: "foo", SnapID: "foo-id"},
+	}, nil, nil)
+	c.Check(err, DeepEquals, &store.SnapActionError{
+		NoResults: true,
+		Refresh: map[string]error{
+			"foo": store.ErrNoUpdateAvailable,
+		},
+	})
+}
+
+func (s *localDirSuite) TestDownload(c *C) {
+	info, err := s.store.SnapInfo(context.TODO(), store.SnapSpec{Name: "foo"}, nil)
+	c.Assert(err, IsNil)
+
+	targetPath := filepath.Join(c.MkDir(), "sub", "foo.snap")
+	err = s.store.Download(context.TODO(), "foo", targetPath, &info.DownloadInfo, progress.Null, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(targetPath, testutil.FileEquals, "foo-3")
+	c.Check(targetPath+".partial", testutil.FileAbsent)
+
+	r, err := s.store.DownloadStream(context.TODO(), "foo", &info.DownloadInfo, nil)
+	c.Assert(err, IsNil)
+	defer r.Close()
+	content, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, "foo-3")
+}
+
+func (s *localDirSuite) TestDownloadUnknown(c *C) {
+	targetPath := filepath.Join(c.MkDir(), "foo.snap")
+	dlInfo := &snap.DownloadInfo{Sha3_384: "abcd"}
+	err := s.store.Download(context.TODO(), "foo", targetPath, dlInfo, progress.Null, nil, nil)
+	c.Check(err, ErrorMatches, `cannot find snap "foo" with sha3-384 abcd in local store directory`)
+	c.Check(targetPath, testutil.FileAbsent)
+}
+
+func (s *localDirSuite) TestDownloadHashMismatch(c *C) {
+	info, err := s.store.SnapInfo(context.TODO(), store.SnapSpec{Name: "foo"}, nil)
+	c.Assert(err, IsNil)
+	// the file got changed behind our back
+	err = ioutil.WriteFile(filepath.Join(s.dir, "foo_3.snap"), []byte("foo-X"), 0644)
+	c.Assert(err, IsNil)
+
+	targetPath := filepath.Join(c.MkDir(), "foo.snap")
+	err = s.store.Download(context.TODO(), "foo", targetPath, &info.DownloadInfo, progress.Null, nil, nil)
+	c.Check(err, FitsTypeOf, store.HashError{})
+	c.Check(targetPath, testutil.FileAbsent)
+	c.Check(targetPath+".partial", testutil.FileAbsent)
+}
+
+func (s *localDirSuite) TestAssertion(c *C) {
+	a, err := s.store.Assertion(asserts.SnapDeclarationType, []string{"16", "foo-id"}, nil)
+	c.Assert(err, IsNil)
+	c.Check(a.(*asserts.SnapDeclaration).SnapName(), Equals, "foo")
+
+	a, err = s.store.Assertion(asserts.AccountType, []string{s.dev1Acct.AccountID()}, nil)
+	c.Assert(err, IsNil)
+	c.Check(a.(*asserts.Account).Username(), Equals, "developer1")
+
+	_, err = s.store.Assertion(asserts.SnapDeclarationType, []string{"16", "baz-id"}, nil)
+	c.Check(asserts.IsNotFound(err), Equals, true)
+	c.Check(err, DeepEquals, &asserts.NotFoundError{
+		Type: asserts.SnapDeclarationType,
+		Headers: map[string]string{
+			"series":  "16",
+			"snap-id": "baz-id",
+		},
+	})
+}
+
+func (s *localDirSuite) TestSeqFormingAssertion(c *C) {
+	f, err := os.Create(filepath.Join(s.dir, "myset.assert"))
+	c.Assert(err, IsNil)
+	defer f.Close()
+	enc := asserts.NewEncoder(f)
+	for _, seq := range []string{"2", "1"} {
+		vs, err := s.storeSigning.Sign(asserts.ValidationSetType, map[string]interface{}{
+			"account-id": "can0nical",
+			"series":     "16",
+			"name":       "myset",
+			"sequence":   seq,
+			"snaps": []interface{}{
+				map[string]interface{}{"name": "foo", "id": "fooidididididididididididididid1"},
+			},
+			"timestamp": time.Now().Format(time.RFC3339),
+		}, nil, "")
+		c.Assert(err, IsNil)
+		c.Assert(enc.Encode(vs), IsNil)
+	}
+
+	a, err := s.store.SeqFormingAssertion(asserts.ValidationSetType, []string{"16", "can0nical", "myset"}, 0, nil)
+	c.Assert(err, IsNil)
+	c.Check(a.(*asserts.ValidationSet).Sequence(), Equals, 2)
+
+	a, err = s.store.SeqFormingAssertion(asserts.ValidationSetType, []string{"16", "can0nical", "myset"}, 1, nil)
+	c.Assert(err, IsNil)
+	c.Check(a.(*asserts.ValidationSet).Sequence(), Equals, 1)
+
+	_, err = s.store.SeqFormingAssertion(asserts.ValidationSetType, []string{"16", "can0nical", "other"}, 0, nil)
+	c.Check(err, DeepEquals, &asserts.NotFoundError{
+		Type: asserts.ValidationSetType,
+		Headers: map[string]string{
+			"series":     "16",
+			"account-id": "can0nical",
+			"name":       "other",
+		},
+	})
+}
+
+type testSnapAdder struct {
+	added map[string][]string
+}
+
+func (a *testSnapAdder) AddSnap(snapName, version, summary string, commands []string) error {
+	a.added[snapName] = commands
+	return nil
+}
+
+func (s *localDirSuite) TestWriteCatalogs(c *C) {
+	var names strings.Builder
+	adder := &testSnapAdder{added: make(map[string][]string)}
+	err := s.store.WriteCatalogs(context.TODO(), &names, adder)
+	c.Assert(err, IsNil)
+	c.Check(names.String(), Equals, "bar\nfoo\n")
+	c.Check(adder.added, DeepEquals, map[string][]string{
+		"foo": {"foo"},
+	})
+}
+
+func (s *localDirSuite) TestConnectivityCheck(c *C) {
+	status, err := s.store.ConnectivityCheck()
+	c.Assert(err, IsNil)
+	c.Check(status, DeepEquals, map[string]bool{s.dir: true})
+}
@@ -0,0 +1,103 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package store
+
+import (
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/snapcore/snapd/metrics"
+)
+
+var (
+	requestsTotal = metrics.NewCounter("snapd_store_requests_total",
+		"Number of requests made to the store, by endpoint and HTTP status code.", "endpoint", "code")
+	requestErrors = metrics.NewCounter("snapd_store_request_errors_total",
+		"Number of store requests that failed to get a response or got a server error, by endpoint.", "endpoint")
+	requestDurationSeconds = metrics.NewHistogram("snapd_store_request_duration_seconds",
+		"Time until the response headers of a store request are received, by endpoint.",
+		[]float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}, "endpoint")
+	downloadBytesTotal = metrics.NewCounter("snapd_store_download_bytes_total",
+		"Number of bytes downloaded from the store.")
+)
+
+// metricsEndpoints maps store endpoint paths to the endpoint label used
+// in the metrics; the label keeps the number of series bounded as the
+// actual paths carry snap names, ids and the like.
+var metricsEndpoints = []struct {
+	path  string
+	label string
+}{
+	{searchEndpPath, "search"},
+	{ordersEndpPath, "orders"},
+	{buyEndpPath, "buy"},
+	{customersMeEndpPath, "customers-me"},
+	{sectionsEndpPath, "sections"},
+	{commandsEndpPath, "commands"},
+	{snapActionEndpPath, "snap-action"},
+	{snapInfoEndpPath, "snap-info"},
+	{cohortsEndpPath, "cohorts"},
+	{assertionsPath, "assertions"},
+	{"api/v1/snaps/download", "download"},
+}
+
+func endpointLabel(u *url.URL) string {
+	for _, endp := range metricsEndpoints {
+		if strings.Contains(u.Path, "/"+endp.path) {
+			return endp.label
+		}
+	}
+	return "other"
+}
+
+// observeRequest records the outcome of a single store request.
+func observeRequest(endpoint string, statusCode int, seconds float64, err error) {
+	requestDurationSeconds.Observe(seconds, endpoint)
+	if err != nil {
+		requestsTotal.Inc(endpoint, "error")
+		requestErrors.Inc(endpoint)
+		return
+	}
+	requestsTotal.Inc(endpoint, strconv.Itoa(statusCode))
+	if statusCode >= 500 {
+		requestErrors.Inc(endpoint)
+	}
+}
+
+// countingWriter counts the bytes written through it as downloaded.
+type countingWriter struct{}
+
+func (countingWriter) Write(p []byte) (int, error) {
+	downloadBytesTotal.Add(float64(len(p)))
+	return len(p), nil
+}
+
+// countingReadCloser counts the bytes read through it as downloaded.
+type countingReadCloser struct {
+	io.ReadCloser
+}
+
+func (r countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	downloadBytesTotal.Add(float64(n))
+	return n, err
+}
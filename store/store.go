@@ -173,6 +173,9 @@ type Store struct {
 
 	cacher downloadCache
 	proxy  func(*http.Request) (*url.URL, error)
+
+	localMu sync.Mutex
+	local   *localDirStore
 }
 
 var ErrTooManyRequests = errors.New("too many requests")
@@ -432,6 +435,22 @@ func (s *Store) baseURL(defaultURL *url.URL) *url.URL {
 	return defaultURL
 }
 
+// localDir returns the store serving snaps and assertions from a local
+// directory if the store base URL is a file URL, or nil otherwise.
+func (s *Store) localDir() *localDirStore {
+	u := s.baseURL(s.cfg.StoreBaseURL)
+	if u == nil || u.Scheme != "file" {
+		return nil
+	}
+
+	s.localMu.Lock()
+	defer s.localMu.Unlock()
+	if s.local == nil || s.local.dir != u.Path {
+		s.local = newLocalDirStore(u.Path, s.series, s.architecture)
+	}
+	return s.local
+}
+
 func (s *Store) endpointURL(p string, query url.Values) *url.URL {
 	return endpointURL(s.baseURL(s.cfg.StoreBaseURL), p, query)
 }
@@ -823,10 +842,13 @@ func (s *Store) doRequest(ctx context.Context, client *http.Client, reqOptions *
 			req = req.WithContext(ctx)
 		}
 
+		start := time.Now()
 		resp, err := client.Do(req)
 		if err != nil {
+			observeRequest(endpointLabel(reqOptions.URL), 0, time.Since(start).Seconds(), err)
 			return nil, err
 		}
+		observeRequest(endpointLabel(reqOptions.URL), resp.StatusCode, time.Since(start).Seconds(), nil)
 
 		wwwAuth := resp.Header.Get("WWW-Authenticate")
 		if resp.StatusCode == 401 && authRefreshes < 4 {
@@ -1099,6 +1121,10 @@ type SnapSpec struct {
 
 // SnapInfo returns the snap.Info for the store-hosted snap matching the given spec, or an error.
 func (s *Store) SnapInfo(ctx context.Context, snapSpec SnapSpec, user *auth.UserState) (*snap.Info, error) {
+	if ls := s.localDir(); ls != nil {
+		return ls.SnapInfo(snapSpec)
+	}
+
 	query := url.Values{}
 	query.Set("fields", strings.Join(s.infoFields, ","))
 	query.Set("architecture", s.architecture)
@@ -1162,6 +1188,10 @@ func (s *Store) Find(ctx context.Context, search *Search, user *auth.UserState)
 		return nil, ErrUnauthenticated
 	}
 
+	if ls := s.localDir(); ls != nil {
+		return ls.Find(search)
+	}
+
 	searchTerm := strings.TrimSpace(search.Query)
 
 	// these characters might have special meaning on the search
@@ -1241,6 +1271,11 @@ func (s *Store) Find(ctx context.Context, search *Search, user *auth.UserState)
 
 // Sections retrieves the list of available store sections.
 func (s *Store) Sections(ctx context.Context, user *auth.UserState) ([]string, error) {
+	if s.localDir() != nil {
+		// a local store directory has no sections
+		return nil, nil
+	}
+
 	reqOptions := &requestOptions{
 		Method:         "GET",
 		URL:            s.endpointURL(sectionsEndpPath, nil),
@@ -1273,6 +1308,10 @@ func (s *Store) Sections(ctx context.Context, user *auth.UserState) ([]string, e
 // WriteCatalogs queries the "commands" endpoint and writes the
 // command names into the given io.Writer.
 func (s *Store) WriteCatalogs(ctx context.Context, names io.Writer, adder SnapAdder) error {
+	if ls := s.localDir(); ls != nil {
+		return ls.WriteCatalogs(names, adder)
+	}
+
 	u := *s.endpointURL(commandsEndpPath, nil)
 
 	q := u.Query()
@@ -1344,6 +1383,10 @@ type DownloadOptions struct {
 // The file is saved in temporary storage, and should be removed
 // after use to prevent the disk from running out of space.
 func (s *Store) Download(ctx context.Context, name string, targetPath string, downloadInfo *snap.DownloadInfo, pbar progress.Meter, user *auth.UserState, dlOpts *DownloadOptions) error {
+	if ls := s.localDir(); ls != nil {
+		return ls.Download(name, targetPath, downloadInfo, pbar)
+	}
+
 	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
 		return err
 	}
@@ -1555,7 +1598,7 @@ func downloadImpl(ctx context.Context, name, sha3_384, downloadURL string, user
 		}
 		dlSize = float64(resp.ContentLength)
 		pbar.Start(name, dlSize)
-		mw := io.MultiWriter(w, h, pbar)
+		mw := io.MultiWriter(w, h, pbar, countingWriter{})
 		var limiter io.Reader
 		limiter = resp.Body
 		if limit := dlOpts.RateLimit; limit > 0 {
@@ -1606,6 +1649,10 @@ func downloadImpl(ctx context.Context, name, sha3_384, downloadURL string, user
 
 // DownloadStream will copy the snap from the request to the io.Reader
 func (s *Store) DownloadStream(ctx context.Context, name string, downloadInfo *snap.DownloadInfo, user *auth.UserState) (io.ReadCloser, error) {
+	if ls := s.localDir(); ls != nil {
+		return ls.DownloadStream(name, downloadInfo)
+	}
+
 	if path := s.cacher.GetPath(downloadInfo.Sha3_384); path != "" {
 		logger.Debugf("Cache hit for SHA3_384 …%.5s.", downloadInfo.Sha3_384)
 		file, err := os.OpenFile(path, os.O_RDONLY, 0600)
@@ -1639,7 +1686,7 @@ func (s *Store) DownloadStream(ctx context.Context, name string, downloadInfo *s
 	if err != nil {
 		return nil, err
 	}
-	return resp.Body, nil
+	return countingReadCloser{resp.Body}, nil
 }
 
 var doDownloadReq = doDownloadReqImpl
@@ -1777,9 +1824,45 @@ type assertionSvcError struct {
 
 // Assertion retrivies the assertion for the given type and primary key.
 func (s *Store) Assertion(assertType *asserts.AssertionType, primaryKey []string, user *auth.UserState) (asserts.Assertion, error) {
+	if ls := s.localDir(); ls != nil {
+		return ls.Assertion(assertType, primaryKey)
+	}
+
+	v := url.Values{}
+	v.Set("max-format", strconv.Itoa(assertType.MaxSupportedFormat()))
+	// best-effort
+	headers, _ := asserts.HeadersFromPrimaryKey(assertType, primaryKey)
+	return s.fetchAssertion(assertType, primaryKey, v, headers, user)
+}
+
+// SeqFormingAssertion retrieves the assertion of the given sequence
+// forming type for the given sequence key, i.e. the primary key
+// without the sequence number, at the given sequence. If sequence is
+// 0 the latest assertion of the sequence is retrieved.
+func (s *Store) SeqFormingAssertion(assertType *asserts.AssertionType, sequenceKey []string, sequence int, user *auth.UserState) (asserts.Assertion, error) {
+	headers, err := asserts.HeadersFromSequenceKey(assertType, sequenceKey)
+	if err != nil {
+		return nil, fmt.Errorf("internal error: %v", err)
+	}
+	if sequence > 0 {
+		primaryKey := append(append([]string(nil), sequenceKey...), strconv.Itoa(sequence))
+		return s.Assertion(assertType, primaryKey, user)
+	}
+
+	if ls := s.localDir(); ls != nil {
+		return ls.SeqFormingAssertion(assertType, sequenceKey)
+	}
+
 	v := url.Values{}
 	v.Set("max-format", strconv.Itoa(assertType.MaxSupportedFormat()))
-	u := s.assertionsEndpointURL(path.Join(assertType.Name, path.Join(primaryKey...)), v)
+	v.Set("sequence", "latest")
+	return s.fetchAssertion(assertType, sequenceKey, v, headers, user)
+}
+
+// fetchAssertion retrieves the assertion at the given path under the
+// assertions endpoint, the not found error carries the given headers.
+func (s *Store) fetchAssertion(assertType *asserts.AssertionType, key []string, v url.Values, notFoundHeaders map[string]string, user *auth.UserState) (asserts.Assertion, error) {
+	u := s.assertionsEndpointURL(path.Join(assertType.Name, path.Join(key...)), v)
 
 	reqOptions := &requestOptions{
 		Method: "GET",
@@ -1806,11 +1889,9 @@ func (s *Store) Assertion(assertType *asserts.AssertionType, primaryKey []string
 					return fmt.Errorf("cannot decode assertion service error with HTTP status code %d: %v", resp.StatusCode, e)
 				}
 				if svcErr.Status == 404 {
-					// best-effort
-					headers, _ := asserts.HeadersFromPrimaryKey(assertType, primaryKey)
 					return &asserts.NotFoundError{
 						Type:    assertType,
-						Headers: headers,
+						Headers: notFoundHeaders,
 					}
 				}
 				return fmt.Errorf("assertion service error: [%s] %q", svcErr.Title, svcErr.Detail)
@@ -2141,6 +2222,10 @@ func (s *Store) SnapAction(ctx context.Context, currentSnaps []*CurrentSnap, act
 		return nil, &SnapActionError{NoResults: true}
 	}
 
+	if ls := s.localDir(); ls != nil {
+		return ls.SnapAction(currentSnaps, actions)
+	}
+
 	authRefreshes := 0
 	for {
 		snaps, err := s.snapAction(ctx, currentSnaps, actions, user, opts)
@@ -2532,6 +2617,10 @@ func (s *Store) snapConnCheck() ([]string, error) {
 }
 
 func (s *Store) ConnectivityCheck() (status map[string]bool, err error) {
+	if ls := s.localDir(); ls != nil {
+		return ls.ConnectivityCheck(), nil
+	}
+
 	status = make(map[string]bool)
 
 	checkers := []func() ([]string, error){
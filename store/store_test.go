@@ -47,10 +47,12 @@ import (
 	"github.com/snapcore/snapd/advisor"
 	"github.com/snapcore/snapd/arch"
 	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/httputil"
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/metrics"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/progress"
@@ -1189,6 +1191,32 @@ func (s *storeTestSuite) TestDoRequestSetsAuth(c *C) {
 	c.Check(string(responseData), Equals, "response-data")
 }
 
+func (s *storeTestSuite) TestDoRequestMetrics(c *C) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/v2/snaps/info/hello-world")
+		w.WriteHeader(503)
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	sto := store.New(&store.Config{}, nil)
+
+	endpoint, _ := url.Parse(mockServer.URL + "/v2/snaps/info/hello-world")
+	reqOptions := store.NewRequestOptions("GET", endpoint)
+
+	response, err := sto.DoRequest(s.ctx, sto.Client(), reqOptions, nil)
+	c.Assert(err, IsNil)
+	response.Body.Close()
+	c.Check(response.StatusCode, Equals, 503)
+
+	var buf bytes.Buffer
+	c.Assert(metrics.WriteText(&buf), IsNil)
+	out := buf.String()
+	c.Check(out, Matches, `(?s).*\nsnapd_store_requests_total\{endpoint="snap-info",code="503"\} [1-9][0-9]*\n.*`)
+	c.Check(out, Matches, `(?s).*\nsnapd_store_request_errors_total\{endpoint="snap-info"\} [1-9][0-9]*\n.*`)
+	c.Check(out, Matches, `(?s).*\nsnapd_store_request_duration_seconds_count\{endpoint="snap-info"\} [1-9][0-9]*\n.*`)
+}
+
 func (s *storeTestSuite) TestDoRequestDoesNotSetAuthForLocalOnlyUser(c *C) {
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		c.Check(r.UserAgent(), Equals, userAgent)
@@ -3597,6 +3625,77 @@ func (s *storeTestSuite) TestAssertion500(c *C) {
 	c.Assert(n, Equals, 5)
 }
 
+func (s *storeTestSuite) TestSeqFormingAssertionLatest(c *C) {
+	storeSigning := assertstest.NewStoreStack("can0nical", nil)
+	vs, err := storeSigning.Sign(asserts.ValidationSetType, map[string]interface{}{
+		"account-id": "can0nical",
+		"series":     "16",
+		"name":       "myset",
+		"sequence":   "3",
+		"snaps": []interface{}{
+			map[string]interface{}{"name": "foo", "id": "fooidididididididididididididid1"},
+		},
+		"timestamp": time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assertRequest(c, r, "GET", "/api/v1/snaps/assertions/.*")
+		c.Check(r.Header.Get("Accept"), Equals, "application/x.ubuntu.assertion")
+		c.Check(r.URL.Path, Matches, ".*/validation-set/16/can0nical/myset")
+		c.Check(r.URL.Query().Get("sequence"), Equals, "latest")
+		w.Write(asserts.Encode(vs))
+	}))
+
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	mockServerURL, _ := url.Parse(mockServer.URL)
+	cfg := store.Config{
+		AssertionsBaseURL: mockServerURL,
+	}
+	sto := store.New(&cfg, nil)
+
+	a, err := sto.SeqFormingAssertion(asserts.ValidationSetType, []string{"16", "can0nical", "myset"}, 0, nil)
+	c.Assert(err, IsNil)
+	c.Check(a.Type(), Equals, asserts.ValidationSetType)
+	c.Check(a.(*asserts.ValidationSet).Sequence(), Equals, 3)
+}
+
+func (s *storeTestSuite) TestSeqFormingAssertionAtSequence(c *C) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assertRequest(c, r, "GET", "/api/v1/snaps/assertions/.*")
+		c.Check(r.URL.Path, Matches, ".*/validation-set/16/can0nical/myset/2")
+		c.Check(r.URL.Query().Get("sequence"), Equals, "")
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(404)
+		io.WriteString(w, `{"status": 404,"title": "not found"}`)
+	}))
+
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	mockServerURL, _ := url.Parse(mockServer.URL)
+	cfg := store.Config{
+		AssertionsBaseURL: mockServerURL,
+	}
+	sto := store.New(&cfg, nil)
+
+	_, err := sto.SeqFormingAssertion(asserts.ValidationSetType, []string{"16", "can0nical", "myset"}, 2, nil)
+	c.Check(err, DeepEquals, &asserts.NotFoundError{
+		Type: asserts.ValidationSetType,
+		Headers: map[string]string{
+			"series":     "16",
+			"account-id": "can0nical",
+			"name":       "myset",
+			"sequence":   "2",
+		},
+	})
+
+	_, err = sto.SeqFormingAssertion(asserts.SnapDeclarationType, []string{"16"}, 0, nil)
+	c.Check(err, ErrorMatches, `internal error: "snap-declaration" assertions do not form sequences`)
+}
+
 func (s *storeTestSuite) TestSuggestedCurrency(c *C) {
 	suggestedCurrency := "GBP"
 
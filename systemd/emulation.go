@@ -0,0 +1,161 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package systemd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/snapcore/snapd/osutil"
+)
+
+type notImplementedError struct {
+	op string
+}
+
+func (e *notImplementedError) Error() string {
+	return fmt.Sprintf("%q is not implemented in emulation mode", e.op)
+}
+
+// emulation is a Systemd that manipulates the unit files and their
+// enablement under rootDir without talking to a running systemd, as
+// is the case when preseeding an image inside a chroot. The units are
+// picked up by systemd on the first boot of the image.
+type emulation struct {
+	rootDir string
+}
+
+// NewEmulationMode returns a Systemd that only operates on the files
+// under the given rootDir, for use when systemd is not running.
+func NewEmulationMode(rootDir string) Systemd {
+	if rootDir == "" {
+		rootDir = "/"
+	}
+	return &emulation{rootDir: rootDir}
+}
+
+// DaemonReload does nothing, units are loaded on boot.
+func (s *emulation) DaemonReload() error {
+	return nil
+}
+
+func (s *emulation) Enable(service string) error {
+	_, err := systemctlCmd("--root", s.rootDir, "enable", service)
+	return err
+}
+
+func (s *emulation) Disable(service string) error {
+	_, err := systemctlCmd("--root", s.rootDir, "disable", service)
+	return err
+}
+
+func (s *emulation) Mask(service string) error {
+	_, err := systemctlCmd("--root", s.rootDir, "mask", service)
+	return err
+}
+
+func (s *emulation) Unmask(service string) error {
+	_, err := systemctlCmd("--root", s.rootDir, "unmask", service)
+	return err
+}
+
+func (s *emulation) Start(service ...string) error {
+	return &notImplementedError{"Start"}
+}
+
+func (s *emulation) StartNoBlock(service ...string) error {
+	return &notImplementedError{"StartNoBlock"}
+}
+
+func (s *emulation) Stop(service string, timeout time.Duration) error {
+	return &notImplementedError{"Stop"}
+}
+
+func (s *emulation) Kill(service, signal, who string) error {
+	return &notImplementedError{"Kill"}
+}
+
+func (s *emulation) Restart(service string, timeout time.Duration) error {
+	return &notImplementedError{"Restart"}
+}
+
+func (s *emulation) Status(units ...string) ([]*UnitStatus, error) {
+	return nil, &notImplementedError{"Status"}
+}
+
+func (s *emulation) IsEnabled(service string) (bool, error) {
+	return false, &notImplementedError{"IsEnabled"}
+}
+
+func (s *emulation) IsActive(service string) (bool, error) {
+	return false, &notImplementedError{"IsActive"}
+}
+
+func (s *emulation) LogReader(services []string, n int, follow bool) (io.ReadCloser, error) {
+	return nil, &notImplementedError{"LogReader"}
+}
+
+func (s *emulation) CurrentMemoryUsage(unit string) (uint64, error) {
+	return 0, &notImplementedError{"CurrentMemoryUsage"}
+}
+
+func (s *emulation) CurrentTasksCount(unit string) (uint64, error) {
+	return 0, &notImplementedError{"CurrentTasksCount"}
+}
+
+func (s *emulation) CurrentCPUUsage(unit string) (uint64, error) {
+	return 0, &notImplementedError{"CurrentCPUUsage"}
+}
+
+func (s *emulation) SetProperties(unit string, properties ...string) error {
+	return &notImplementedError{"SetProperties"}
+}
+
+// AddMountUnitFile writes and enables the mount unit, and mounts the
+// filesystem directly as systemd would do when starting the unit.
+func (s *emulation) AddMountUnitFile(snapName, revision, what, where, fstype string) (string, error) {
+	mountUnitName, actualFsType, options, err := writeMountUnitFile(snapName, revision, what, where, fstype)
+	if err != nil {
+		return "", err
+	}
+
+	hostWhere := filepath.Join(s.rootDir, where)
+	if err := os.MkdirAll(hostWhere, 0755); err != nil {
+		return "", err
+	}
+	cmd := exec.Command("mount", "-t", actualFsType, filepath.Join(s.rootDir, what), hostWhere, "-o", strings.Join(options, ","))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("cannot mount %s (%s) at %s in preseed mode: %v", what, actualFsType, where, osutil.OutputErr(output, err))
+	}
+
+	if err := s.Enable(mountUnitName); err != nil {
+		return "", err
+	}
+	return mountUnitName, nil
+}
+
+func (s *emulation) RemoveMountUnitFile(baseDir string) error {
+	return &notImplementedError{"RemoveMountUnitFile"}
+}
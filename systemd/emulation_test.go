@@ -0,0 +1,137 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package systemd_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil/squashfs"
+	"github.com/snapcore/snapd/sandbox/selinux"
+	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type emulationSuite struct {
+	testutil.BaseTest
+
+	argses [][]string
+}
+
+var _ = Suite(&emulationSuite{})
+
+func (s *emulationSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+	c.Assert(os.MkdirAll(dirs.SnapServicesDir, 0755), IsNil)
+
+	s.argses = nil
+	s.AddCleanup(systemd.MockSystemctl(func(args ...string) ([]byte, error) {
+		s.argses = append(s.argses, args)
+		return nil, nil
+	}))
+	s.AddCleanup(selinux.MockIsEnabled(func() (bool, error) { return false, nil }))
+	s.AddCleanup(squashfs.MockNeedsFuse(false))
+}
+
+func (s *emulationSuite) TestEnableDisableMaskUnmask(c *C) {
+	sysd := systemd.NewEmulationMode(dirs.GlobalRootDir)
+
+	c.Assert(sysd.DaemonReload(), IsNil)
+	c.Assert(sysd.Enable("foo.service"), IsNil)
+	c.Assert(sysd.Disable("foo.service"), IsNil)
+	c.Assert(sysd.Mask("foo.service"), IsNil)
+	c.Assert(sysd.Unmask("foo.service"), IsNil)
+
+	c.Check(s.argses, DeepEquals, [][]string{
+		{"--root", dirs.GlobalRootDir, "enable", "foo.service"},
+		{"--root", dirs.GlobalRootDir, "disable", "foo.service"},
+		{"--root", dirs.GlobalRootDir, "mask", "foo.service"},
+		{"--root", dirs.GlobalRootDir, "unmask", "foo.service"},
+	})
+}
+
+func (s *emulationSuite) TestNotImplemented(c *C) {
+	sysd := systemd.NewEmulationMode(dirs.GlobalRootDir)
+
+	c.Check(sysd.Start("foo.service"), ErrorMatches, `"Start" is not implemented in emulation mode`)
+	c.Check(sysd.Stop("foo.service", time.Second), ErrorMatches, `"Stop" is not implemented in emulation mode`)
+	_, err := sysd.IsEnabled("foo.service")
+	c.Check(err, ErrorMatches, `"IsEnabled" is not implemented in emulation mode`)
+	c.Check(sysd.RemoveMountUnitFile("/snap/foo/1"), ErrorMatches, `"RemoveMountUnitFile" is not implemented in emulation mode`)
+	c.Check(s.argses, HasLen, 0)
+}
+
+func (s *emulationSuite) TestAddMountUnitFile(c *C) {
+	mockMount := testutil.MockCommand(c, "mount", "")
+	defer mockMount.Restore()
+
+	snapPath := "/var/lib/snapd/snaps/foo_42.snap"
+	makeMockFile(c, filepath.Join(dirs.GlobalRootDir, snapPath))
+
+	sysd := systemd.NewEmulationMode(dirs.GlobalRootDir)
+	mountUnitName, err := sysd.AddMountUnitFile("foo", "42", snapPath, "/snap/foo/42", "squashfs")
+	c.Assert(err, IsNil)
+	c.Check(mountUnitName, Equals, "snap-foo-42.mount")
+
+	c.Check(filepath.Join(dirs.SnapServicesDir, mountUnitName), testutil.FileEquals, fmt.Sprintf(`[Unit]
+Description=Mount unit for foo, revision 42
+Before=snapd.service
+
+[Mount]
+What=%s
+Where=/snap/foo/42
+Type=squashfs
+Options=nodev,ro,x-gdu.hide
+LazyUnmount=yes
+
+[Install]
+WantedBy=multi-user.target
+`, snapPath))
+
+	// mounted directly rather than through systemd
+	c.Check(mockMount.Calls(), DeepEquals, [][]string{
+		{"mount", "-t", "squashfs", filepath.Join(dirs.GlobalRootDir, snapPath), filepath.Join(dirs.GlobalRootDir, "/snap/foo/42"), "-o", "nodev,ro,x-gdu.hide"},
+	})
+	c.Check(filepath.Join(dirs.GlobalRootDir, "/snap/foo/42"), testutil.FilePresent)
+	c.Check(s.argses, DeepEquals, [][]string{
+		{"--root", dirs.GlobalRootDir, "enable", "snap-foo-42.mount"},
+	})
+}
+
+func (s *emulationSuite) TestAddMountUnitFileMountFails(c *C) {
+	mockMount := testutil.MockCommand(c, "mount", "echo boom; exit 1")
+	defer mockMount.Restore()
+
+	snapPath := "/var/lib/snapd/snaps/foo_42.snap"
+	makeMockFile(c, filepath.Join(dirs.GlobalRootDir, snapPath))
+
+	sysd := systemd.NewEmulationMode(dirs.GlobalRootDir)
+	_, err := sysd.AddMountUnitFile("foo", "42", snapPath, "/snap/foo/42", "squashfs")
+	c.Assert(err, ErrorMatches, `cannot mount /var/lib/snapd/snaps/foo_42.snap \(squashfs\) at /snap/foo/42 in preseed mode: boom`)
+	c.Check(s.argses, HasLen, 0)
+}
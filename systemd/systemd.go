@@ -177,6 +177,10 @@ type Systemd interface {
 	RemoveMountUnitFile(baseDir string) error
 	Mask(service string) error
 	Unmask(service string) error
+	CurrentMemoryUsage(unit string) (uint64, error)
+	CurrentTasksCount(unit string) (uint64, error)
+	CurrentCPUUsage(unit string) (uint64, error)
+	SetProperties(unit string, properties ...string) error
 }
 
 // A Log is a single entry in the systemd journal
@@ -194,6 +198,9 @@ const (
 
 	// the default target for systemd timer units that we generate
 	TimersTarget = "timers.target"
+
+	// the default target for systemd user service units that we generate
+	UserServicesTarget = "default.target"
 )
 
 type reporter interface {
@@ -462,9 +469,6 @@ func (s *systemd) Status(unitNames ...string) ([]*UnitStatus, error) {
 
 // IsEnabled checkes whether the given service is enabled
 func (s *systemd) IsEnabled(serviceName string) (bool, error) {
-	if s.mode == GlobalUserMode {
-		panic("cannot call is-enabled with GlobalUserMode")
-	}
 	_, err := s.systemctl("--root", s.rootDir, "is-enabled", serviceName)
 	if err == nil {
 		return true, nil
@@ -495,6 +499,60 @@ func (s *systemd) IsActive(serviceName string) (bool, error) {
 	return false, err
 }
 
+// CurrentMemoryUsage returns the memory in bytes currently used by
+// the processes of the given unit, which requires memory accounting
+// to be enabled for it.
+func (s *systemd) CurrentMemoryUsage(unit string) (uint64, error) {
+	return s.currentUsage(unit, "MemoryCurrent")
+}
+
+// CurrentTasksCount returns the number of tasks currently in the given
+// unit, which requires tasks accounting to be enabled for it.
+func (s *systemd) CurrentTasksCount(unit string) (uint64, error) {
+	return s.currentUsage(unit, "TasksCurrent")
+}
+
+// CurrentCPUUsage returns the CPU time in nanoseconds used so far by
+// the processes of the given unit, which requires CPU accounting to be
+// enabled for it.
+func (s *systemd) CurrentCPUUsage(unit string) (uint64, error) {
+	return s.currentUsage(unit, "CPUUsageNSec")
+}
+
+func (s *systemd) currentUsage(unit, property string) (uint64, error) {
+	if s.mode == GlobalUserMode {
+		panic("cannot call show with GlobalUserMode")
+	}
+	out, err := s.systemctl("show", "--property="+property, unit)
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(out))
+	if !strings.HasPrefix(value, property+"=") {
+		return 0, fmt.Errorf("cannot get %s of unit %q: unexpected output %q", property, unit, value)
+	}
+	value = value[len(property)+1:]
+	if value == "[not set]" {
+		return 0, fmt.Errorf("cannot get %s of unit %q: accounting is not enabled", property, unit)
+	}
+	usage, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse %s of unit %q: %v", property, unit, err)
+	}
+	return usage, nil
+}
+
+// SetProperties changes the given properties of the given running
+// unit. The change only lasts until the next reboot, the unit file
+// is expected to carry the same properties.
+func (s *systemd) SetProperties(unit string, properties ...string) error {
+	if s.mode == GlobalUserMode {
+		panic("cannot call set-property with GlobalUserMode")
+	}
+	_, err := s.systemctl(append([]string{"set-property", "--runtime", unit}, properties...)...)
+	return err
+}
+
 // Stop the given service, and wait until it has stopped.
 func (s *systemd) Stop(serviceName string, timeout time.Duration) error {
 	if s.mode == GlobalUserMode {
@@ -640,16 +698,15 @@ func MountUnitPath(baseDir string) string {
 	return filepath.Join(dirs.SnapServicesDir, escapedPath+".mount")
 }
 
-// AddMountUnitFile adds/enables/starts a mount unit.
-func (s *systemd) AddMountUnitFile(snapName, revision, what, where, fstype string) (string, error) {
-	daemonReloadLock.Lock()
-	defer daemonReloadLock.Unlock()
-
-	options := []string{"nodev"}
+// writeMountUnitFile writes the mount unit for the given mount, returning
+// the name of the unit as well as the actual filesystem type and options
+// used.
+func writeMountUnitFile(snapName, revision, what, where, fstype string) (mountUnitName, actualFsType string, options []string, err error) {
+	options = []string{"nodev"}
 	if fstype == "squashfs" {
 		newFsType, newOptions, err := squashfs.FsType()
 		if err != nil {
-			return "", err
+			return "", "", nil, err
 		}
 		options = append(options, newOptions...)
 		fstype = newFsType
@@ -680,7 +737,18 @@ WantedBy=multi-user.target
 `, snapName, revision, what, where, fstype, strings.Join(options, ","))
 
 	mu := MountUnitPath(where)
-	mountUnitName, err := filepath.Base(mu), osutil.AtomicWriteFile(mu, []byte(c), 0644, 0)
+	if err := osutil.AtomicWriteFile(mu, []byte(c), 0644, 0); err != nil {
+		return "", "", nil, err
+	}
+	return filepath.Base(mu), fstype, options, nil
+}
+
+// AddMountUnitFile adds/enables/starts a mount unit.
+func (s *systemd) AddMountUnitFile(snapName, revision, what, where, fstype string) (string, error) {
+	daemonReloadLock.Lock()
+	defer daemonReloadLock.Unlock()
+
+	mountUnitName, _, _, err := writeMountUnitFile(snapName, revision, what, where, fstype)
 	if err != nil {
 		return "", err
 	}
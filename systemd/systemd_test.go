@@ -21,6 +21,7 @@ package systemd_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -738,6 +739,59 @@ func (s *SystemdTestSuite) TestIsActiveErr(c *C) {
 	c.Assert(err, ErrorMatches, ".* failed with exit status 1: random-failure\n")
 }
 
+func (s *SystemdTestSuite) TestCurrentMemoryUsage(c *C) {
+	s.outs = [][]byte{
+		[]byte("MemoryCurrent=1024\n"),
+		[]byte("MemoryCurrent=[not set]\n"),
+		[]byte("MemoryCurrent=blah\n"),
+		[]byte("\n"),
+	}
+
+	sysd := New("xyzzy", SystemMode, s.rep)
+	mem, err := sysd.CurrentMemoryUsage("snap.foo.slice")
+	c.Assert(err, IsNil)
+	c.Check(mem, Equals, uint64(1024))
+	c.Check(s.argses, DeepEquals, [][]string{{"show", "--property=MemoryCurrent", "snap.foo.slice"}})
+
+	_, err = sysd.CurrentMemoryUsage("snap.foo.slice")
+	c.Check(err, ErrorMatches, `cannot get MemoryCurrent of unit "snap.foo.slice": accounting is not enabled`)
+	_, err = sysd.CurrentMemoryUsage("snap.foo.slice")
+	c.Check(err, ErrorMatches, `cannot parse MemoryCurrent of unit "snap.foo.slice": .*`)
+	_, err = sysd.CurrentMemoryUsage("snap.foo.slice")
+	c.Check(err, ErrorMatches, `cannot get MemoryCurrent of unit "snap.foo.slice": unexpected output ""`)
+}
+
+func (s *SystemdTestSuite) TestSetProperties(c *C) {
+	err := New("xyzzy", SystemMode, s.rep).SetProperties("snap.foo.slice", "MemoryMax=1024", "TasksMax=infinity")
+	c.Assert(err, IsNil)
+	c.Check(s.argses, DeepEquals, [][]string{{"set-property", "--runtime", "snap.foo.slice", "MemoryMax=1024", "TasksMax=infinity"}})
+}
+
+func (s *SystemdTestSuite) TestCurrentTasksCount(c *C) {
+	s.outs = [][]byte{[]byte("TasksCurrent=12\n")}
+
+	tasks, err := New("xyzzy", SystemMode, s.rep).CurrentTasksCount("snap.foo.slice")
+	c.Assert(err, IsNil)
+	c.Check(tasks, Equals, uint64(12))
+	c.Check(s.argses, DeepEquals, [][]string{{"show", "--property=TasksCurrent", "snap.foo.slice"}})
+}
+
+func (s *SystemdTestSuite) TestCurrentCPUUsage(c *C) {
+	s.outs = [][]byte{[]byte("CPUUsageNSec=1500000000\n")}
+
+	cpu, err := New("xyzzy", SystemMode, s.rep).CurrentCPUUsage("snap.foo.slice")
+	c.Assert(err, IsNil)
+	c.Check(cpu, Equals, uint64(1500000000))
+	c.Check(s.argses, DeepEquals, [][]string{{"show", "--property=CPUUsageNSec", "snap.foo.slice"}})
+}
+
+func (s *SystemdTestSuite) TestCurrentUsageError(c *C) {
+	s.errors = []error{errors.New("mock failure")}
+
+	_, err := New("xyzzy", SystemMode, s.rep).CurrentTasksCount("snap.foo.slice")
+	c.Check(err, ErrorMatches, "mock failure")
+}
+
 func makeMockMountUnit(c *C, mountDir string) string {
 	mountUnit := MountUnitPath(dirs.StripRootDir(mountDir))
 	err := ioutil.WriteFile(mountUnit, nil, 0644)
@@ -818,6 +872,10 @@ func (s *SystemdTestSuite) TestGlobalUserMode(c *C) {
 	c.Check(s.argses[2], DeepEquals, []string{"--user", "--global", "--root", rootDir, "mask", "foo"})
 	c.Assert(sysd.Unmask("foo"), IsNil)
 	c.Check(s.argses[3], DeepEquals, []string{"--user", "--global", "--root", rootDir, "unmask", "foo"})
+	enabled, err := sysd.IsEnabled("foo")
+	c.Assert(err, IsNil)
+	c.Check(enabled, Equals, true)
+	c.Check(s.argses[4], DeepEquals, []string{"--user", "--global", "--root", rootDir, "is-enabled", "foo"})
 
 	// Commands that don't make sense for GlobalUserMode panic
 	c.Check(sysd.DaemonReload, Panics, "cannot call daemon-reload with GlobalUserMode")
@@ -827,6 +885,5 @@ func (s *SystemdTestSuite) TestGlobalUserMode(c *C) {
 	c.Check(func() { sysd.Restart("foo", 0) }, Panics, "cannot call restart with GlobalUserMode")
 	c.Check(func() { sysd.Kill("foo", "HUP", "") }, Panics, "cannot call kill with GlobalUserMode")
 	c.Check(func() { sysd.Status("foo") }, Panics, "cannot call status with GlobalUserMode")
-	c.Check(func() { sysd.IsEnabled("foo") }, Panics, "cannot call is-enabled with GlobalUserMode")
 	c.Check(func() { sysd.IsActive("foo") }, Panics, "cannot call is-active with GlobalUserMode")
 }
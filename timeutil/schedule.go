@@ -436,6 +436,22 @@ func Next(schedule []*Schedule, last time.Time, maxDuration time.Duration) time.
 
 }
 
+// NextWindow returns the earliest window of the schedule that has not
+// ended yet, which may be a window that is already open.
+func NextWindow(schedule []*Schedule) ScheduleWindow {
+	// look a day back so that a window that is open now is found too
+	last := timeNow().Add(-24 * time.Hour)
+
+	var window ScheduleWindow
+	for _, sched := range schedule {
+		next := sched.Next(last)
+		if window.IsZero() || next.Start.Before(window.Start) {
+			window = next
+		}
+	}
+	return window
+}
+
 var weekdayMap = map[string]time.Weekday{
 	"sun": time.Sunday,
 	"mon": time.Monday,
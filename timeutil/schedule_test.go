@@ -789,6 +789,64 @@ func (ts *timeutilSuite) TestScheduleNext(c *C) {
 	}
 }
 
+func (ts *timeutilSuite) TestNextWindow(c *C) {
+	const shortForm = "2006-01-02 15:04"
+
+	for _, t := range []struct {
+		schedule string
+		now      string
+		start    string
+		end      string
+	}{
+		{
+			// mon 9:00, before the window
+			schedule: "mon,10:00-12:00",
+			now:      "2017-02-06 9:00",
+			start:    "2017-02-06 10:00",
+			end:      "2017-02-06 12:00",
+		}, {
+			// mon 11:00, the window is open
+			schedule: "mon,10:00-12:00",
+			now:      "2017-02-06 11:00",
+			start:    "2017-02-06 10:00",
+			end:      "2017-02-06 12:00",
+		}, {
+			// mon 13:00, the window is gone for this week
+			schedule: "mon,10:00-12:00",
+			now:      "2017-02-06 13:00",
+			start:    "2017-02-13 10:00",
+			end:      "2017-02-13 12:00",
+		}, {
+			schedule: "9:00-11:00,,20:00-22:00",
+			now:      "2017-02-06 12:00",
+			start:    "2017-02-06 20:00",
+			end:      "2017-02-06 22:00",
+		}, {
+			// the window opened the day before
+			schedule: "23:00-01:00",
+			now:      "2017-02-07 0:30",
+			start:    "2017-02-06 23:00",
+			end:      "2017-02-07 01:00",
+		},
+	} {
+		sched, err := timeutil.ParseSchedule(t.schedule)
+		c.Assert(err, IsNil)
+
+		now, err := time.ParseInLocation(shortForm, t.now, time.Local)
+		c.Assert(err, IsNil)
+		restore := timeutil.MockTimeNow(func() time.Time { return now })
+		window := timeutil.NextWindow(sched)
+		restore()
+
+		start, err := time.ParseInLocation(shortForm, t.start, time.Local)
+		c.Assert(err, IsNil)
+		end, err := time.ParseInLocation(shortForm, t.end, time.Local)
+		c.Assert(err, IsNil)
+		c.Check(window.Start.Equal(start), Equals, true, Commentf("%s at %s: %s", t.schedule, t.now, window.Start))
+		c.Check(window.End.Equal(end), Equals, true, Commentf("%s at %s: %s", t.schedule, t.now, window.End))
+	}
+}
+
 func (ts *timeutilSuite) TestScheduleIncludes(c *C) {
 	const shortForm = "2006-01-02 15:04:05"
 
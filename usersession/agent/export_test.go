@@ -21,10 +21,12 @@ package agent
 
 import (
 	"syscall"
+	"time"
 )
 
 var (
-	SessionInfoCmd = sessionInfoCmd
+	SessionInfoCmd    = sessionInfoCmd
+	ServiceControlCmd = serviceControlCmd
 )
 
 func MockUcred(ucred *syscall.Ucred, err error) (restore func()) {
@@ -36,3 +38,11 @@ func MockUcred(ucred *syscall.Ucred, err error) (restore func()) {
 		sysGetsockoptUcred = old
 	}
 }
+
+func MockServiceStopTimeout(t time.Duration) (restore func()) {
+	old := serviceStopTimeout
+	serviceStopTimeout = t
+	return func() {
+		serviceStopTimeout = old
+	}
+}
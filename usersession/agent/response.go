@@ -93,7 +93,8 @@ func (r *resp) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
 type errorKind string
 
 const (
-	errorKindLoginRequired = errorKind("login-required")
+	errorKindLoginRequired  = errorKind("login-required")
+	errorKindServiceControl = errorKind("service-control")
 )
 
 type errorValue interface{}
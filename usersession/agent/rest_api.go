@@ -20,12 +20,22 @@
 package agent
 
 import (
+	"encoding/json"
+	"mime"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/usersession/client"
 )
 
 var restApi = []*Command{
 	rootCmd,
 	sessionInfoCmd,
+	serviceControlCmd,
 }
 
 var (
@@ -38,6 +48,11 @@ var (
 		Path: "/v1/session-info",
 		GET:  sessionInfo,
 	}
+
+	serviceControlCmd = &Command{
+		Path: "/v1/service-control",
+		POST: postServiceControl,
+	}
 )
 
 func sessionInfo(c *Command, r *http.Request) Response {
@@ -46,3 +61,158 @@ func sessionInfo(c *Command, r *http.Request) Response {
 	}
 	return SyncResponse(m)
 }
+
+// how long to wait for a user service to stop or restart
+var serviceStopTimeout = 30 * time.Second
+
+type dummyReporter struct{}
+
+func (dummyReporter) Notify(string) {}
+
+func validateSnapServices(services []string) Response {
+	for _, service := range services {
+		// only the units of snap services, including the sockets
+		// and timers activating them, can be controlled through
+		// the agent
+		if !strings.HasPrefix(service, "snap.") || !isServiceUnit(service) {
+			return BadRequest("cannot control non-snap service %q", service)
+		}
+	}
+	return nil
+}
+
+func isServiceUnit(unit string) bool {
+	for _, suffix := range []string{".service", ".socket", ".timer"} {
+		if strings.HasSuffix(unit, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func serviceControlError(msg string, value map[string]interface{}) Response {
+	return &resp{
+		Type:   ResponseTypeError,
+		Status: 500,
+		Result: &errorResult{
+			Message: msg,
+			Kind:    errorKindServiceControl,
+			Value:   value,
+		},
+	}
+}
+
+func serviceDaemonReload(inst *client.ServiceInstruction, sysd systemd.Systemd) Response {
+	if len(inst.Services) != 0 {
+		return BadRequest("daemon-reload should not be called with any services")
+	}
+	if err := sysd.DaemonReload(); err != nil {
+		return InternalError("cannot reload daemon: %v", err)
+	}
+	return SyncResponse(nil)
+}
+
+func serviceStart(inst *client.ServiceInstruction, sysd systemd.Systemd) Response {
+	if rsp := validateSnapServices(inst.Services); rsp != nil {
+		return rsp
+	}
+
+	startErrors := make(map[string]string)
+	var started []string
+	for _, service := range inst.Services {
+		if err := sysd.Start(service); err != nil {
+			startErrors[service] = err.Error()
+			break
+		}
+		started = append(started, service)
+	}
+	if len(startErrors) == 0 {
+		return SyncResponse(nil)
+	}
+
+	// undo what we started
+	stopErrors := make(map[string]string)
+	for i := len(started) - 1; i >= 0; i-- {
+		service := started[i]
+		if err := sysd.Stop(service, serviceStopTimeout); err != nil {
+			stopErrors[service] = err.Error()
+		}
+	}
+	return serviceControlError("some user services failed to start", map[string]interface{}{
+		"start-errors": startErrors,
+		"stop-errors":  stopErrors,
+	})
+}
+
+func serviceStop(inst *client.ServiceInstruction, sysd systemd.Systemd) Response {
+	if rsp := validateSnapServices(inst.Services); rsp != nil {
+		return rsp
+	}
+
+	stopErrors := make(map[string]string)
+	for _, service := range inst.Services {
+		if err := sysd.Stop(service, serviceStopTimeout); err != nil {
+			stopErrors[service] = err.Error()
+		}
+	}
+	if len(stopErrors) == 0 {
+		return SyncResponse(nil)
+	}
+	return serviceControlError("some user services failed to stop", map[string]interface{}{
+		"stop-errors": stopErrors,
+	})
+}
+
+func serviceRestart(inst *client.ServiceInstruction, sysd systemd.Systemd) Response {
+	if rsp := validateSnapServices(inst.Services); rsp != nil {
+		return rsp
+	}
+
+	restartErrors := make(map[string]string)
+	for _, service := range inst.Services {
+		if err := sysd.Restart(service, serviceStopTimeout); err != nil {
+			restartErrors[service] = err.Error()
+		}
+	}
+	if len(restartErrors) == 0 {
+		return SyncResponse(nil)
+	}
+	return serviceControlError("some user services failed to restart", map[string]interface{}{
+		"restart-errors": restartErrors,
+	})
+}
+
+var serviceInstructionDispTable = map[string]func(*client.ServiceInstruction, systemd.Systemd) Response{
+	"daemon-reload": serviceDaemonReload,
+	"start":         serviceStart,
+	"stop":          serviceStop,
+	"restart":       serviceRestart,
+}
+
+// systemdLock prevents several systemd actions from being carried
+// out simultaneously
+var systemdLock sync.Mutex
+
+func postServiceControl(c *Command, r *http.Request) Response {
+	contentType := r.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "application/json" {
+		return BadRequest("unknown content type: %s", contentType)
+	}
+
+	var inst client.ServiceInstruction
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&inst); err != nil {
+		return BadRequest("cannot decode request body into service instruction: %v", err)
+	}
+	impl := serviceInstructionDispTable[inst.Action]
+	if impl == nil {
+		return BadRequest("unknown action %q", inst.Action)
+	}
+
+	systemdLock.Lock()
+	defer systemdLock.Unlock()
+
+	sysd := systemd.New(dirs.GlobalRootDir, systemd.UserMode, dummyReporter{})
+	return impl(&inst, sysd)
+}
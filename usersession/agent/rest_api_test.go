@@ -20,29 +20,50 @@
 package agent_test
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
+	"time"
 
 	. "gopkg.in/check.v1"
 
 	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/testutil"
 	"github.com/snapcore/snapd/usersession/agent"
 )
 
-type restSuite struct{}
+type restSuite struct {
+	testutil.BaseTest
+	sysdLog [][]string
+}
 
 var _ = Suite(&restSuite{})
 
 func (s *restSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
 	dirs.SetRootDir(c.MkDir())
 	xdgRuntimeDir := fmt.Sprintf("%s/%d", dirs.XdgRuntimeDirBase, os.Getuid())
 	c.Assert(os.MkdirAll(xdgRuntimeDir, 0700), IsNil)
+
+	s.sysdLog = nil
+	s.AddCleanup(systemd.MockSystemctl(func(cmd ...string) ([]byte, error) {
+		s.sysdLog = append(s.sysdLog, cmd)
+		if len(cmd) > 1 && cmd[1] == "show" {
+			return []byte("ActiveState=inactive\n"), nil
+		}
+		return nil, nil
+	}))
+	s.AddCleanup(agent.MockServiceStopTimeout(time.Second))
 }
 
 func (s *restSuite) TearDownTest(c *C) {
 	dirs.SetRootDir("")
+	s.BaseTest.TearDownTest(c)
 }
 
 type resp struct {
@@ -74,3 +95,164 @@ func (s *restSuite) TestSessionInfo(c *C) {
 		"version": "42b1",
 	})
 }
+
+func (s *restSuite) serviceControl(c *C, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("POST", "/v1/service-control", bytes.NewBufferString(body))
+	c.Assert(err, IsNil)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	agent.ServiceControlCmd.POST(agent.ServiceControlCmd, req).ServeHTTP(rec, req)
+	return rec
+}
+
+func (s *restSuite) TestServiceControl(c *C) {
+	// the agent.ServiceControl end point only supports POST requests
+	c.Check(agent.ServiceControlCmd.GET, IsNil)
+	c.Check(agent.ServiceControlCmd.PUT, IsNil)
+	c.Check(agent.ServiceControlCmd.DELETE, IsNil)
+	c.Assert(agent.ServiceControlCmd.POST, NotNil)
+
+	c.Check(agent.ServiceControlCmd.Path, Equals, "/v1/service-control")
+}
+
+func (s *restSuite) TestServiceControlDaemonReload(c *C) {
+	rec := s.serviceControl(c, `{"action": "daemon-reload"}`)
+	c.Check(rec.Code, Equals, 200)
+
+	var rsp resp
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &rsp), IsNil)
+	c.Check(rsp.Type, Equals, agent.ResponseTypeSync)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "daemon-reload"},
+	})
+}
+
+func (s *restSuite) TestServiceControlStart(c *C) {
+	rec := s.serviceControl(c, `{"action": "start", "services": ["snap.foo.service", "snap.bar.service"]}`)
+	c.Check(rec.Code, Equals, 200)
+
+	var rsp resp
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &rsp), IsNil)
+	c.Check(rsp.Type, Equals, agent.ResponseTypeSync)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "start", "snap.foo.service"},
+		{"--user", "start", "snap.bar.service"},
+	})
+}
+
+func (s *restSuite) TestServiceControlStartSocket(c *C) {
+	rec := s.serviceControl(c, `{"action": "start", "services": ["snap.foo.svc.sock.socket"]}`)
+	c.Check(rec.Code, Equals, 200)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "start", "snap.foo.svc.sock.socket"},
+	})
+}
+
+func (s *restSuite) TestServiceControlStartTimer(c *C) {
+	rec := s.serviceControl(c, `{"action": "start", "services": ["snap.foo.svc.timer"]}`)
+	c.Check(rec.Code, Equals, 200)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "start", "snap.foo.svc.timer"},
+	})
+}
+
+func (s *restSuite) TestServiceControlStartFailureStopsStarted(c *C) {
+	s.AddCleanup(systemd.MockSystemctl(func(cmd ...string) ([]byte, error) {
+		s.sysdLog = append(s.sysdLog, cmd)
+		switch {
+		case cmd[1] == "start" && cmd[2] == "snap.bar.service":
+			return nil, fmt.Errorf("bar failed")
+		case cmd[1] == "show":
+			return []byte("ActiveState=inactive\n"), nil
+		}
+		return nil, nil
+	}))
+
+	rec := s.serviceControl(c, `{"action": "start", "services": ["snap.foo.service", "snap.bar.service", "snap.baz.service"]}`)
+	c.Check(rec.Code, Equals, 500)
+
+	var rsp resp
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &rsp), IsNil)
+	c.Check(rsp.Type, Equals, agent.ResponseTypeError)
+	c.Check(rsp.Result, DeepEquals, map[string]interface{}{
+		"message": "some user services failed to start",
+		"kind":    "service-control",
+		"value": map[string]interface{}{
+			"start-errors": map[string]interface{}{
+				"snap.bar.service": "bar failed",
+			},
+			"stop-errors": map[string]interface{}{},
+		},
+	})
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "start", "snap.foo.service"},
+		{"--user", "start", "snap.bar.service"},
+		{"--user", "stop", "snap.foo.service"},
+		{"--user", "show", "--property=ActiveState", "snap.foo.service"},
+	})
+}
+
+func (s *restSuite) TestServiceControlStop(c *C) {
+	rec := s.serviceControl(c, `{"action": "stop", "services": ["snap.foo.service"]}`)
+	c.Check(rec.Code, Equals, 200)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "stop", "snap.foo.service"},
+		{"--user", "show", "--property=ActiveState", "snap.foo.service"},
+	})
+}
+
+func (s *restSuite) TestServiceControlStopSocketAndTimer(c *C) {
+	rec := s.serviceControl(c, `{"action": "stop", "services": ["snap.foo.svc.sock.socket", "snap.foo.svc.timer", "snap.foo.svc.service"]}`)
+	c.Check(rec.Code, Equals, 200)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "stop", "snap.foo.svc.sock.socket"},
+		{"--user", "show", "--property=ActiveState", "snap.foo.svc.sock.socket"},
+		{"--user", "stop", "snap.foo.svc.timer"},
+		{"--user", "show", "--property=ActiveState", "snap.foo.svc.timer"},
+		{"--user", "stop", "snap.foo.svc.service"},
+		{"--user", "show", "--property=ActiveState", "snap.foo.svc.service"},
+	})
+}
+
+func (s *restSuite) TestServiceControlRestart(c *C) {
+	rec := s.serviceControl(c, `{"action": "restart", "services": ["snap.foo.service"]}`)
+	c.Check(rec.Code, Equals, 200)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "stop", "snap.foo.service"},
+		{"--user", "show", "--property=ActiveState", "snap.foo.service"},
+		{"--user", "start", "snap.foo.service"},
+	})
+}
+
+func (s *restSuite) TestServiceControlBadRequest(c *C) {
+	for _, t := range []struct {
+		body string
+		err  string
+	}{
+		{`}`, `cannot decode request body into service instruction: .*`},
+		{`{"action": "dance"}`, `unknown action "dance"`},
+		{`{"action": "daemon-reload", "services": ["snap.foo.service"]}`, `daemon-reload should not be called with any services`},
+		{`{"action": "start", "services": ["ssh.service"]}`, `cannot control non-snap service "ssh.service"`},
+		{`{"action": "stop", "services": ["ssh.socket"]}`, `cannot control non-snap service "ssh.socket"`},
+		{`{"action": "stop", "services": ["snap.foo.mount"]}`, `cannot control non-snap service "snap.foo.mount"`},
+	} {
+		rec := s.serviceControl(c, t.body)
+		c.Check(rec.Code, Equals, 400, Commentf("%s", t.body))
+
+		var rsp resp
+		c.Assert(json.Unmarshal(rec.Body.Bytes(), &rsp), IsNil)
+		c.Check(rsp.Type, Equals, agent.ResponseTypeError)
+		c.Check(rsp.Result.(map[string]interface{})["message"], Matches, t.err)
+	}
+	c.Check(s.sysdLog, HasLen, 0)
+}
+
+func (s *restSuite) TestServiceControlBadContentType(c *C) {
+	req, err := http.NewRequest("POST", "/v1/service-control", strings.NewReader(`{"action": "daemon-reload"}`))
+	c.Assert(err, IsNil)
+	req.Header.Set("Content-Type", "text/plain")
+	rec := httptest.NewRecorder()
+	agent.ServiceControlCmd.POST(agent.ServiceControlCmd, req).ServeHTTP(rec, req)
+	c.Check(rec.Code, Equals, 400)
+	c.Check(s.sysdLog, HasLen, 0)
+}
@@ -0,0 +1,261 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package client talks to the session agents of all the users logged
+// into the system, on behalf of snapd.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/snapcore/snapd/dirs"
+)
+
+const agentSocketName = "snapd-session-agent.socket"
+
+// dialSessionAgent connects to a user's session agent. The host part
+// of the address is the uid of the user.
+func dialSessionAgent(network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	if _, err := strconv.Atoi(host); err != nil {
+		return nil, fmt.Errorf("invalid session agent address %q", address)
+	}
+	socket := filepath.Join(dirs.XdgRuntimeDirBase, host, agentSocketName)
+	return net.Dial("unix", socket)
+}
+
+// Client talks to the session agents of the logged in users.
+type Client struct {
+	doer *http.Client
+}
+
+// New returns a new session agent client.
+func New() *Client {
+	transport := &http.Transport{Dial: dialSessionAgent, DisableKeepAlives: true}
+	return &Client{
+		doer: &http.Client{Transport: transport},
+	}
+}
+
+// Error is an error as returned by a session agent.
+type Error struct {
+	Kind    string      `json:"kind"`
+	Message string      `json:"message"`
+	Value   interface{} `json:"value"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+type response struct {
+	uid        int
+	statusCode int
+	err        error
+
+	Type   string          `json:"type"`
+	Result json.RawMessage `json:"result"`
+}
+
+func (resp *response) checkError() {
+	if resp.Type != "error" {
+		return
+	}
+	var resultErr Error
+	err := json.Unmarshal(resp.Result, &resultErr)
+	if err != nil || resultErr.Message == "" {
+		resp.err = fmt.Errorf("server error: %q", http.StatusText(resp.statusCode))
+	} else {
+		resp.err = &resultErr
+	}
+}
+
+// doMany issues the given request to the session agents of all the
+// users that have one running, concurrently. The responses are
+// returned ordered by uid.
+func (client *Client) doMany(ctx context.Context, method, urlpath string, query url.Values, headers map[string]string, body []byte) ([]*response, error) {
+	sockets, err := filepath.Glob(filepath.Join(dirs.XdgRuntimeDirBase, "*", agentSocketName))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		responses []*response
+	)
+	for _, socket := range sockets {
+		uidStr := filepath.Base(filepath.Dir(socket))
+		uid, err := strconv.Atoi(uidStr)
+		if err != nil {
+			// not a XDG runtime dir of the form /run/user/<uid>
+			continue
+		}
+
+		wg.Add(1)
+		go func(uid int, uidStr string) {
+			defer wg.Done()
+			resp := &response{uid: uid}
+			defer func() {
+				mu.Lock()
+				defer mu.Unlock()
+				responses = append(responses, resp)
+			}()
+
+			u := url.URL{
+				Scheme:   "http",
+				Host:     uidStr,
+				Path:     urlpath,
+				RawQuery: query.Encode(),
+			}
+			req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+			if err != nil {
+				resp.err = fmt.Errorf("internal error: %v", err)
+				return
+			}
+			req = req.WithContext(ctx)
+			for key, value := range headers {
+				req.Header.Set(key, value)
+			}
+			httpResp, err := client.doer.Do(req)
+			if err != nil {
+				resp.err = err
+				return
+			}
+			defer httpResp.Body.Close()
+			resp.statusCode = httpResp.StatusCode
+			if err := json.NewDecoder(httpResp.Body).Decode(resp); err != nil {
+				resp.err = fmt.Errorf("cannot decode session agent response: %v", err)
+				return
+			}
+			resp.checkError()
+		}(uid, uidStr)
+	}
+	wg.Wait()
+
+	sort.Slice(responses, func(i, j int) bool { return responses[i].uid < responses[j].uid })
+	return responses, nil
+}
+
+// ServiceInstruction is the body of a service control request to a
+// session agent.
+type ServiceInstruction struct {
+	Action   string   `json:"action"`
+	Services []string `json:"services,omitempty"`
+}
+
+// ServiceFailure is a failure to control a user service of a given
+// user.
+type ServiceFailure struct {
+	Uid     int
+	Service string
+	Error   string
+}
+
+func makeServiceFailures(uid int, failures map[string]interface{}) []ServiceFailure {
+	names := make([]string, 0, len(failures))
+	for service := range failures {
+		names = append(names, service)
+	}
+	sort.Strings(names)
+
+	var result []ServiceFailure
+	for _, service := range names {
+		errMsg, _ := failures[service].(string)
+		result = append(result, ServiceFailure{
+			Uid:     uid,
+			Service: service,
+			Error:   errMsg,
+		})
+	}
+	return result
+}
+
+func (client *Client) serviceControlCall(ctx context.Context, action string, services []string) (failures map[string][]ServiceFailure, err error) {
+	headers := map[string]string{"Content-Type": "application/json"}
+	reqBody, err := json.Marshal(&ServiceInstruction{
+		Action:   action,
+		Services: services,
+	})
+	if err != nil {
+		return nil, err
+	}
+	responses, err := client.doMany(ctx, "POST", "/v1/service-control", nil, headers, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	failures = make(map[string][]ServiceFailure)
+	for _, resp := range responses {
+		if agentErr, ok := resp.err.(*Error); ok && agentErr.Kind == "service-control" {
+			if errorValue, ok := agentErr.Value.(map[string]interface{}); ok {
+				for kind, v := range errorValue {
+					serviceErrors, _ := v.(map[string]interface{})
+					failures[kind] = append(failures[kind], makeServiceFailures(resp.uid, serviceErrors)...)
+				}
+			}
+		}
+		if resp.err != nil && err == nil {
+			err = fmt.Errorf("cannot %s user services of uid %d: %v", action, resp.uid, resp.err)
+		}
+	}
+	return failures, err
+}
+
+// ServicesDaemonReload asks the systemd user instances of all the
+// logged in users to reload their configuration.
+func (client *Client) ServicesDaemonReload(ctx context.Context) error {
+	_, err := client.serviceControlCall(ctx, "daemon-reload", nil)
+	return err
+}
+
+// ServicesStart starts the given user services for all the logged in
+// users. If a service fails to start for a user, the services already
+// started for that user are stopped again.
+func (client *Client) ServicesStart(ctx context.Context, services []string) (startFailures, stopFailures []ServiceFailure, err error) {
+	failures, err := client.serviceControlCall(ctx, "start", services)
+	return failures["start-errors"], failures["stop-errors"], err
+}
+
+// ServicesStop stops the given user services for all the logged in
+// users.
+func (client *Client) ServicesStop(ctx context.Context, services []string) (stopFailures []ServiceFailure, err error) {
+	failures, err := client.serviceControlCall(ctx, "stop", services)
+	return failures["stop-errors"], err
+}
+
+// ServicesRestart restarts the given user services for all the logged
+// in users.
+func (client *Client) ServicesRestart(ctx context.Context, services []string) (restartFailures []ServiceFailure, err error) {
+	failures, err := client.serviceControlCall(ctx, "restart", services)
+	return failures["restart-errors"], err
+}
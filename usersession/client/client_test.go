@@ -0,0 +1,224 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/usersession/client"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type clientSuite struct {
+	cli *client.Client
+
+	server  *http.Server
+	handler http.Handler
+
+	mu       sync.Mutex
+	requests []map[string]interface{}
+}
+
+var _ = Suite(&clientSuite{})
+
+func (s *clientSuite) SetUpTest(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	s.cli = client.New()
+	s.requests = nil
+
+	s.handler = nil
+	s.server = &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, Equals, "POST")
+		c.Check(r.URL.Path, Equals, "/v1/service-control")
+		c.Check(r.Header.Get("Content-Type"), Equals, "application/json")
+		var body map[string]interface{}
+		c.Check(json.NewDecoder(r.Body).Decode(&body), IsNil)
+		s.mu.Lock()
+		s.requests = append(s.requests, body)
+		s.mu.Unlock()
+		s.handler.ServeHTTP(w, r)
+	})}
+}
+
+func (s *clientSuite) TearDownTest(c *C) {
+	s.server.Close()
+	dirs.SetRootDir("")
+}
+
+// serveAgents starts serving session agent requests for the given
+// uids
+func (s *clientSuite) serveAgents(c *C, uids ...int) {
+	for _, uid := range uids {
+		sock := filepath.Join(dirs.XdgRuntimeDirBase, fmt.Sprint(uid), "snapd-session-agent.socket")
+		c.Assert(os.MkdirAll(filepath.Dir(sock), 0700), IsNil)
+		l, err := net.Listen("unix", sock)
+		c.Assert(err, IsNil)
+		go s.server.Serve(l)
+	}
+}
+
+func (s *clientSuite) TestNoAgents(c *C) {
+	// directories that aren't XDG runtime dirs are ignored
+	c.Assert(os.MkdirAll(filepath.Join(dirs.XdgRuntimeDirBase, "not-a-uid"), 0700), IsNil)
+
+	err := s.cli.ServicesDaemonReload(context.Background())
+	c.Check(err, IsNil)
+	c.Check(s.requests, HasLen, 0)
+}
+
+func (s *clientSuite) TestServicesDaemonReload(c *C) {
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"type": "sync", "result": null}`))
+	})
+	s.serveAgents(c, 42, 1000)
+
+	err := s.cli.ServicesDaemonReload(context.Background())
+	c.Check(err, IsNil)
+	c.Check(s.requests, DeepEquals, []map[string]interface{}{
+		{"action": "daemon-reload"},
+		{"action": "daemon-reload"},
+	})
+}
+
+func (s *clientSuite) TestServicesDaemonReloadError(c *C) {
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(500)
+		w.Write([]byte(`{"type": "error", "result": {"message": "something failed"}}`))
+	})
+	s.serveAgents(c, 42)
+
+	err := s.cli.ServicesDaemonReload(context.Background())
+	c.Check(err, ErrorMatches, "cannot daemon-reload user services of uid 42: something failed")
+}
+
+func (s *clientSuite) TestServicesStart(c *C) {
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"type": "sync", "result": null}`))
+	})
+	s.serveAgents(c, 42)
+
+	startFailures, stopFailures, err := s.cli.ServicesStart(context.Background(), []string{"snap.foo.service", "snap.bar.service"})
+	c.Check(err, IsNil)
+	c.Check(startFailures, HasLen, 0)
+	c.Check(stopFailures, HasLen, 0)
+	c.Check(s.requests, DeepEquals, []map[string]interface{}{{
+		"action":   "start",
+		"services": []interface{}{"snap.foo.service", "snap.bar.service"},
+	}})
+}
+
+func (s *clientSuite) TestServicesStartFailure(c *C) {
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(500)
+		w.Write([]byte(`{
+  "type": "error",
+  "result": {
+    "kind": "service-control",
+    "message": "some user services failed to start",
+    "value": {
+      "start-errors": {"snap.bar.service": "failed to start"},
+      "stop-errors": {"snap.foo.service": "failed to stop"}
+    }
+  }
+}`))
+	})
+	s.serveAgents(c, 42, 1000)
+
+	startFailures, stopFailures, err := s.cli.ServicesStart(context.Background(), []string{"snap.foo.service", "snap.bar.service"})
+	c.Check(err, ErrorMatches, "cannot start user services of uid 42: some user services failed to start")
+	c.Check(startFailures, DeepEquals, []client.ServiceFailure{
+		{Uid: 42, Service: "snap.bar.service", Error: "failed to start"},
+		{Uid: 1000, Service: "snap.bar.service", Error: "failed to start"},
+	})
+	c.Check(stopFailures, DeepEquals, []client.ServiceFailure{
+		{Uid: 42, Service: "snap.foo.service", Error: "failed to stop"},
+		{Uid: 1000, Service: "snap.foo.service", Error: "failed to stop"},
+	})
+}
+
+func (s *clientSuite) TestServicesStopFailure(c *C) {
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(500)
+		w.Write([]byte(`{
+  "type": "error",
+  "result": {
+    "kind": "service-control",
+    "message": "some user services failed to stop",
+    "value": {
+      "stop-errors": {"snap.foo.service": "failed to stop"}
+    }
+  }
+}`))
+	})
+	s.serveAgents(c, 42)
+
+	stopFailures, err := s.cli.ServicesStop(context.Background(), []string{"snap.foo.service"})
+	c.Check(err, ErrorMatches, "cannot stop user services of uid 42: some user services failed to stop")
+	c.Check(stopFailures, DeepEquals, []client.ServiceFailure{
+		{Uid: 42, Service: "snap.foo.service", Error: "failed to stop"},
+	})
+	c.Check(s.requests, DeepEquals, []map[string]interface{}{{
+		"action":   "stop",
+		"services": []interface{}{"snap.foo.service"},
+	}})
+}
+
+func (s *clientSuite) TestServicesRestart(c *C) {
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"type": "sync", "result": null}`))
+	})
+	s.serveAgents(c, 42)
+
+	restartFailures, err := s.cli.ServicesRestart(context.Background(), []string{"snap.foo.service"})
+	c.Check(err, IsNil)
+	c.Check(restartFailures, HasLen, 0)
+	c.Check(s.requests, DeepEquals, []map[string]interface{}{{
+		"action":   "restart",
+		"services": []interface{}{"snap.foo.service"},
+	}})
+}
+
+func (s *clientSuite) TestBadResponse(c *C) {
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`garbage`))
+	})
+	s.serveAgents(c, 42)
+
+	_, err := s.cli.ServicesRestart(context.Background(), []string{"snap.foo.service"})
+	c.Check(err, ErrorMatches, "cannot restart user services of uid 42: cannot decode session agent response: .*")
+}
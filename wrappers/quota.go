@@ -0,0 +1,163 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package wrappers
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/quota"
+)
+
+// quotaDropInName is the name of the drop-in placing a service of a
+// snap into the slice of its quota group.
+const quotaDropInName = "snap-quota.conf"
+
+func generateQuotaGroupSliceFile(grp *quota.Group) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `[Unit]
+# Auto-generated, DO NOT EDIT
+Description=Slice for snap quota group %s
+Before=slices.target
+X-Snappy=yes
+
+[Slice]
+`, grp.Name)
+	// accounting is always enabled so that the current usage of the
+	// group can be reported, even for resources without a limit
+	fmt.Fprintln(&buf, "MemoryAccounting=true")
+	if grp.MemoryLimit != 0 {
+		// MemoryMax is for cgroup v2, MemoryLimit for cgroup v1
+		fmt.Fprintf(&buf, "MemoryMax=%d\n", grp.MemoryLimit)
+		fmt.Fprintf(&buf, "MemoryLimit=%d\n", grp.MemoryLimit)
+	}
+	fmt.Fprintln(&buf, "CPUAccounting=true")
+	if grp.CPUPercentage != 0 {
+		fmt.Fprintf(&buf, "CPUQuota=%d%%\n", grp.CPUPercentage)
+	}
+	fmt.Fprintln(&buf, "TasksAccounting=true")
+	if grp.TaskLimit != 0 {
+		fmt.Fprintf(&buf, "TasksMax=%d\n", grp.TaskLimit)
+	}
+	return buf.Bytes()
+}
+
+// QuotaGroupSliceLimits returns the limits of the given quota group as
+// properties of its slice, to apply them to the slice while it runs.
+// The limits the group does not have are reset.
+func QuotaGroupSliceLimits(grp *quota.Group) []string {
+	mem, cpu, tasks := "infinity", "", "infinity"
+	if grp.MemoryLimit != 0 {
+		mem = strconv.FormatUint(grp.MemoryLimit, 10)
+	}
+	if grp.CPUPercentage != 0 {
+		cpu = fmt.Sprintf("%d%%", grp.CPUPercentage)
+	}
+	if grp.TaskLimit != 0 {
+		tasks = strconv.Itoa(grp.TaskLimit)
+	}
+	return []string{
+		"MemoryMax=" + mem,
+		"MemoryLimit=" + mem,
+		"CPUQuota=" + cpu,
+		"TasksMax=" + tasks,
+	}
+}
+
+// EnsureQuotaGroupSlice writes the systemd slice unit for the given
+// quota group, reporting whether it changed. The caller is expected
+// to reload systemd if it did.
+func EnsureQuotaGroupSlice(grp *quota.Group) (changed bool, err error) {
+	path := grp.SliceFile()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+	content := &osutil.MemoryFileState{Content: generateQuotaGroupSliceFile(grp), Mode: 0644}
+	if err := osutil.EnsureFileState(path, content); err != nil {
+		if err == osutil.ErrSameState {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// RemoveQuotaGroupSlice removes the systemd slice unit for the given
+// quota group. The caller is expected to reload systemd afterwards.
+func RemoveQuotaGroupSlice(grp *quota.Group) error {
+	if err := os.Remove(grp.SliceFile()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func quotaDropInFile(app *snap.AppInfo) string {
+	return filepath.Join(app.ServiceFile()+".d", quotaDropInName)
+}
+
+func generateQuotaDropInFile(grp *quota.Group) []byte {
+	return []byte(fmt.Sprintf(`[Service]
+# Auto-generated, DO NOT EDIT
+Slice=%s
+`, grp.SliceName()))
+}
+
+// EnsureSnapServicesQuotaGroup places the services of the given snap
+// into the slice of the given quota group, or takes them out of any
+// slice if the group is nil, reporting whether anything changed. The
+// caller is expected to reload systemd if it did; running services
+// only move to the new slice once restarted.
+func EnsureSnapServicesQuotaGroup(s *snap.Info, grp *quota.Group) (changed bool, err error) {
+	for _, app := range s.Services() {
+		if app.IsUserService() {
+			// quota group slices only exist in the system instance
+			continue
+		}
+		path := quotaDropInFile(app)
+		if grp == nil {
+			err := os.Remove(path)
+			if err == nil {
+				changed = true
+				// the drop-in directory is ours only if empty
+				os.Remove(filepath.Dir(path))
+			} else if !os.IsNotExist(err) {
+				return changed, err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return changed, err
+		}
+		content := &osutil.MemoryFileState{Content: generateQuotaDropInFile(grp), Mode: 0644}
+		if err := osutil.EnsureFileState(path, content); err != nil {
+			if err == osutil.ErrSameState {
+				continue
+			}
+			return changed, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
@@ -0,0 +1,167 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package wrappers_test
+
+import (
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/progress"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/quota"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/testutil"
+	"github.com/snapcore/snapd/wrappers"
+)
+
+type quotaTestSuite struct {
+	testutil.BaseTest
+}
+
+var _ = Suite(&quotaTestSuite{})
+
+func (s *quotaTestSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+	s.AddCleanup(systemd.MockSystemctl(func(cmd ...string) ([]byte, error) {
+		return []byte("ActiveState=inactive\n"), nil
+	}))
+}
+
+func (s *quotaTestSuite) TestEnsureQuotaGroupSlice(c *C) {
+	grp := &quota.Group{Name: "foo-bar", MemoryLimit: 1024 * 1024, CPUPercentage: 50, TaskLimit: 32}
+	sliceFile := filepath.Join(dirs.SnapServicesDir, `snap.foo\x2dbar.slice`)
+
+	changed, err := wrappers.EnsureQuotaGroupSlice(grp)
+	c.Assert(err, IsNil)
+	c.Check(changed, Equals, true)
+	c.Check(sliceFile, testutil.FileEquals, `[Unit]
+# Auto-generated, DO NOT EDIT
+Description=Slice for snap quota group foo-bar
+Before=slices.target
+X-Snappy=yes
+
+[Slice]
+MemoryAccounting=true
+MemoryMax=1048576
+MemoryLimit=1048576
+CPUAccounting=true
+CPUQuota=50%
+TasksAccounting=true
+TasksMax=32
+`)
+
+	// nothing to do the second time around
+	changed, err = wrappers.EnsureQuotaGroupSlice(grp)
+	c.Assert(err, IsNil)
+	c.Check(changed, Equals, false)
+
+	// limits that are unset are left out
+	grp.MemoryLimit = 0
+	grp.TaskLimit = 0
+	changed, err = wrappers.EnsureQuotaGroupSlice(grp)
+	c.Assert(err, IsNil)
+	c.Check(changed, Equals, true)
+	c.Check(sliceFile, testutil.FileEquals, `[Unit]
+# Auto-generated, DO NOT EDIT
+Description=Slice for snap quota group foo-bar
+Before=slices.target
+X-Snappy=yes
+
+[Slice]
+MemoryAccounting=true
+CPUAccounting=true
+CPUQuota=50%
+TasksAccounting=true
+`)
+
+	c.Assert(wrappers.RemoveQuotaGroupSlice(grp), IsNil)
+	c.Check(osutil.FileExists(sliceFile), Equals, false)
+	// removing it again is fine
+	c.Assert(wrappers.RemoveQuotaGroupSlice(grp), IsNil)
+}
+
+func (s *quotaTestSuite) TestQuotaGroupSliceLimits(c *C) {
+	grp := &quota.Group{Name: "foo", MemoryLimit: 1024 * 1024, CPUPercentage: 50, TaskLimit: 32}
+	c.Check(wrappers.QuotaGroupSliceLimits(grp), DeepEquals, []string{
+		"MemoryMax=1048576",
+		"MemoryLimit=1048576",
+		"CPUQuota=50%",
+		"TasksMax=32",
+	})
+
+	// limits that are unset are reset
+	grp = &quota.Group{Name: "foo", CPUPercentage: 200}
+	c.Check(wrappers.QuotaGroupSliceLimits(grp), DeepEquals, []string{
+		"MemoryMax=infinity",
+		"MemoryLimit=infinity",
+		"CPUQuota=200%",
+		"TasksMax=infinity",
+	})
+	grp = &quota.Group{Name: "foo", TaskLimit: 8}
+	c.Check(wrappers.QuotaGroupSliceLimits(grp)[2], Equals, "CPUQuota=")
+}
+
+func (s *quotaTestSuite) TestEnsureSnapServicesQuotaGroup(c *C) {
+	info := snaptest.MockSnap(c, packageHello, &snap.SideInfo{Revision: snap.R(12)})
+	grp := &quota.Group{Name: "foo", TaskLimit: 32}
+	dropIn := filepath.Join(dirs.SnapServicesDir, "snap.hello-snap.svc1.service.d", "snap-quota.conf")
+
+	changed, err := wrappers.EnsureSnapServicesQuotaGroup(info, grp)
+	c.Assert(err, IsNil)
+	c.Check(changed, Equals, true)
+	c.Check(dropIn, testutil.FileEquals, `[Service]
+# Auto-generated, DO NOT EDIT
+Slice=snap.foo.slice
+`)
+
+	changed, err = wrappers.EnsureSnapServicesQuotaGroup(info, grp)
+	c.Assert(err, IsNil)
+	c.Check(changed, Equals, false)
+
+	changed, err = wrappers.EnsureSnapServicesQuotaGroup(info, nil)
+	c.Assert(err, IsNil)
+	c.Check(changed, Equals, true)
+	c.Check(osutil.FileExists(dropIn), Equals, false)
+	c.Check(osutil.IsDirectory(filepath.Dir(dropIn)), Equals, false)
+
+	changed, err = wrappers.EnsureSnapServicesQuotaGroup(info, nil)
+	c.Assert(err, IsNil)
+	c.Check(changed, Equals, false)
+}
+
+func (s *quotaTestSuite) TestRemoveSnapServicesRemovesQuotaDropIn(c *C) {
+	info := snaptest.MockSnap(c, packageHello, &snap.SideInfo{Revision: snap.R(12)})
+	dropIn := filepath.Join(dirs.SnapServicesDir, "snap.hello-snap.svc1.service.d", "snap-quota.conf")
+
+	c.Assert(wrappers.AddSnapServices(info, nil, progress.Null), IsNil)
+	_, err := wrappers.EnsureSnapServicesQuotaGroup(info, &quota.Group{Name: "foo", TaskLimit: 32})
+	c.Assert(err, IsNil)
+	c.Assert(osutil.FileExists(dropIn), Equals, true)
+
+	c.Assert(wrappers.RemoveSnapServices(info, progress.Null), IsNil)
+	c.Check(osutil.FileExists(dropIn), Equals, false)
+	c.Check(osutil.IsDirectory(filepath.Dir(dropIn)), Equals, false)
+}
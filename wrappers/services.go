@@ -21,6 +21,7 @@ package wrappers
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"math/rand"
 	"os"
@@ -34,11 +35,13 @@ import (
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/osutil/sys"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snapdenv"
 	"github.com/snapcore/snapd/strutil"
 	"github.com/snapcore/snapd/systemd"
 	"github.com/snapcore/snapd/timeout"
 	"github.com/snapcore/snapd/timeutil"
 	"github.com/snapcore/snapd/timings"
+	"github.com/snapcore/snapd/usersession/client"
 )
 
 type interacter interface {
@@ -56,6 +59,52 @@ func serviceStopTimeout(app *snap.AppInfo) time.Duration {
 	return time.Duration(tout)
 }
 
+// userServiceControlTimeout is how long to wait for the session agents
+// to carry out a user service control request
+var userServiceControlTimeout = time.Duration(timeout.DefaultTimeout)
+
+func userDaemonReload() error {
+	cli := client.New()
+	ctx, cancel := context.WithTimeout(context.Background(), userServiceControlTimeout)
+	defer cancel()
+	return cli.ServicesDaemonReload(ctx)
+}
+
+func notifyServiceFailures(inter interacter, action string, failures []client.ServiceFailure) {
+	for _, f := range failures {
+		inter.Notify(fmt.Sprintf("Could not %s %s for uid %d: %s", action, f.Service, f.Uid, f.Error))
+	}
+}
+
+// appUnitNames returns the names of the sockets, timer and service
+// units of the given service, in the order they need to be stopped.
+func appUnitNames(app *snap.AppInfo) []string {
+	names := make([]string, 0, len(app.Sockets)+2)
+	for _, socket := range app.Sockets {
+		names = append(names, filepath.Base(socket.File()))
+	}
+	if app.Timer != nil {
+		names = append(names, filepath.Base(app.Timer.File()))
+	}
+	return append(names, app.ServiceName())
+}
+
+func stopUserServices(apps []*snap.AppInfo, inter interacter) error {
+	var units []string
+	for _, app := range apps {
+		units = append(units, appUnitNames(app)...)
+	}
+	if len(units) == 0 {
+		return nil
+	}
+	cli := client.New()
+	ctx, cancel := context.WithTimeout(context.Background(), userServiceControlTimeout)
+	defer cancel()
+	stopFailures, err := cli.ServicesStop(ctx, units)
+	notifyServiceFailures(inter, "stop", stopFailures)
+	return err
+}
+
 func generateSnapServiceFile(app *snap.AppInfo) ([]byte, error) {
 	if err := snap.ValidateApp(app); err != nil {
 		return nil, err
@@ -104,20 +153,31 @@ func stopService(sysd systemd.Systemd, app *snap.AppInfo, inter interacter) erro
 // are services. Service units will be started in the order provided by the
 // caller.
 func StartServices(apps []*snap.AppInfo, inter interacter, tm timings.Measurer) (err error) {
-	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, inter)
+	systemSysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, inter)
+	userGlobalSysd := systemd.New(dirs.GlobalRootDir, systemd.GlobalUserMode, inter)
 
 	services := make([]string, 0, len(apps))
+	var userServices []string
 	for _, app := range apps {
 		// they're *supposed* to be all services, but checking doesn't hurt
 		if !app.IsService() {
 			continue
 		}
 
+		sysd := systemSysd
+		if app.IsUserService() {
+			sysd = userGlobalSysd
+		}
+
 		defer func(app *snap.AppInfo) {
 			if err == nil {
 				return
 			}
-			if e := stopService(sysd, app, inter); e != nil {
+			if app.IsUserService() {
+				if e := stopUserServices([]*snap.AppInfo{app}, inter); e != nil {
+					inter.Notify(fmt.Sprintf("While trying to stop previously started user service %q: %v", app.ServiceName(), e))
+				}
+			} else if e := stopService(sysd, app, inter); e != nil {
 				inter.Notify(fmt.Sprintf("While trying to stop previously started service %q: %v", app.ServiceName(), e))
 			}
 			for _, socket := range app.Sockets {
@@ -134,12 +194,43 @@ func StartServices(apps []*snap.AppInfo, inter interacter, tm timings.Measurer)
 			}
 		}(app)
 
+		if app.IsUserService() {
+			// user services are started in the session of every
+			// logged in user, through their session agent
+			for _, socket := range app.Sockets {
+				socketService := filepath.Base(socket.File())
+				if err := sysd.Enable(socketService); err != nil {
+					return err
+				}
+				userServices = append(userServices, socketService)
+			}
+			if app.Timer != nil {
+				timerService := filepath.Base(app.Timer.File())
+				if err := sysd.Enable(timerService); err != nil {
+					return err
+				}
+				userServices = append(userServices, timerService)
+			}
+			if len(app.Sockets) == 0 && app.Timer == nil {
+				// as for system services, don't start disabled
+				// ones, user services are enabled globally
+				isEnabled, err := userGlobalSysd.IsEnabled(app.ServiceName())
+				if err != nil {
+					return err
+				}
+				if isEnabled {
+					userServices = append(userServices, app.ServiceName())
+				}
+			}
+			continue
+		}
+
 		if len(app.Sockets) == 0 && app.Timer == nil {
 			// check if the service is disabled, if so don't start it up
 			// this could happen for example if the service was disabled in
 			// the install hook by snapctl or if the service was disabled in
 			// the previous installation
-			isEnabled, err := sysd.IsEnabled(app.ServiceName())
+			isEnabled, err := systemSysd.IsEnabled(app.ServiceName())
 			if err != nil {
 				return err
 			}
@@ -157,7 +248,7 @@ func StartServices(apps []*snap.AppInfo, inter interacter, tm timings.Measurer)
 			}
 
 			timings.Run(tm, "start-socket-service", fmt.Sprintf("start socket service %q", socketService), func(nested timings.Measurer) {
-				err = sysd.Start(socketService)
+				err = systemSysd.Start(socketService)
 			})
 			if err != nil {
 				return err
@@ -172,7 +263,7 @@ func StartServices(apps []*snap.AppInfo, inter interacter, tm timings.Measurer)
 			}
 
 			timings.Run(tm, "start-timer-service", fmt.Sprintf("start timer service %q", timerService), func(nested timings.Measurer) {
-				err = sysd.Start(timerService)
+				err = systemSysd.Start(timerService)
 			})
 			if err != nil {
 				return err
@@ -188,7 +279,23 @@ func StartServices(apps []*snap.AppInfo, inter interacter, tm timings.Measurer)
 		// https://github.com/systemd/systemd/issues/8102
 		// https://lists.freedesktop.org/archives/systemd-devel/2018-January/040152.html
 		timings.Run(tm, "start-service", fmt.Sprintf("start service %q", srv), func(nested timings.Measurer) {
-			err = sysd.Start(srv)
+			err = systemSysd.Start(srv)
+		})
+		if err != nil {
+			// cleanup was set up by iterating over apps
+			return err
+		}
+	}
+
+	if len(userServices) != 0 {
+		timings.Run(tm, "start-user-services", "start user services", func(nested timings.Measurer) {
+			cli := client.New()
+			ctx, cancel := context.WithTimeout(context.Background(), userServiceControlTimeout)
+			defer cancel()
+			var startFailures, stopFailures []client.ServiceFailure
+			startFailures, stopFailures, err = cli.ServicesStart(ctx, userServices)
+			notifyServiceFailures(inter, "start", startFailures)
+			notifyServiceFailures(inter, "stop", stopFailures)
 		})
 		if err != nil {
 			// cleanup was set up by iterating over apps
@@ -216,15 +323,27 @@ func AddSnapServices(s *snap.Info, disabledSvcs []string, inter interacter) (err
 		}
 	}
 
-	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, inter)
+	var systemSysd systemd.Systemd
+	if snapdenv.Preseeding() {
+		systemSysd = systemd.NewEmulationMode(dirs.GlobalRootDir)
+	} else {
+		systemSysd = systemd.New(dirs.GlobalRootDir, systemd.SystemMode, inter)
+	}
+	userGlobalSysd := systemd.New(dirs.GlobalRootDir, systemd.GlobalUserMode, inter)
 	var written []string
-	var enabled []string
+	var enabled, userEnabled []string
+	var systemReload, userReload bool
 	defer func() {
 		if err == nil {
 			return
 		}
 		for _, s := range enabled {
-			if e := sysd.Disable(s); e != nil {
+			if e := systemSysd.Disable(s); e != nil {
+				inter.Notify(fmt.Sprintf("while trying to disable %s due to previous failure: %v", s, e))
+			}
+		}
+		for _, s := range userEnabled {
+			if e := userGlobalSysd.Disable(s); e != nil {
 				inter.Notify(fmt.Sprintf("while trying to disable %s due to previous failure: %v", s, e))
 			}
 		}
@@ -233,11 +352,16 @@ func AddSnapServices(s *snap.Info, disabledSvcs []string, inter interacter) (err
 				inter.Notify(fmt.Sprintf("while trying to remove %s due to previous failure: %v", s, e))
 			}
 		}
-		if len(written) > 0 {
-			if e := sysd.DaemonReload(); e != nil {
+		if systemReload {
+			if e := systemSysd.DaemonReload(); e != nil {
 				inter.Notify(fmt.Sprintf("while trying to perform systemd daemon-reload due to previous failure: %v", e))
 			}
 		}
+		if userReload {
+			if e := userDaemonReload(); e != nil {
+				inter.Notify(fmt.Sprintf("while trying to perform user systemd daemon-reload due to previous failure: %v", e))
+			}
+		}
 	}()
 
 	for _, app := range s.Apps {
@@ -255,6 +379,11 @@ func AddSnapServices(s *snap.Info, disabledSvcs []string, inter interacter) (err
 			return err
 		}
 		written = append(written, svcFilePath)
+		if app.IsUserService() {
+			userReload = true
+		} else {
+			systemReload = true
+		}
 
 		// Generate systemd .socket files if needed
 		socketFiles, err := generateSnapSocketFiles(app)
@@ -295,14 +424,26 @@ func AddSnapServices(s *snap.Info, disabledSvcs []string, inter interacter) (err
 			continue
 		}
 
-		if err := sysd.Enable(svcName); err != nil {
+		if app.IsUserService() {
+			if err := userGlobalSysd.Enable(svcName); err != nil {
+				return err
+			}
+			userEnabled = append(userEnabled, svcName)
+			continue
+		}
+		if err := systemSysd.Enable(svcName); err != nil {
 			return err
 		}
 		enabled = append(enabled, svcName)
 	}
 
-	if len(written) > 0 {
-		if err := sysd.DaemonReload(); err != nil {
+	if systemReload {
+		if err := systemSysd.DaemonReload(); err != nil {
+			return err
+		}
+	}
+	if userReload {
+		if err := userDaemonReload(); err != nil {
 			return err
 		}
 	}
@@ -315,6 +456,7 @@ func StopServices(apps []*snap.AppInfo, reason snap.ServiceStopReason, inter int
 	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, inter)
 
 	logger.Debugf("StopServices called for %q, reason: %v", apps, reason)
+	var userApps []*snap.AppInfo
 	for _, app := range apps {
 		// Handle the case where service file doesn't exist and don't try to stop it as it will fail.
 		// This can happen with snap try when snap.yaml is modified on the fly and a daemon line is added.
@@ -332,6 +474,12 @@ func StopServices(apps []*snap.AppInfo, reason snap.ServiceStopReason, inter int
 			}
 		}
 
+		if app.IsUserService() {
+			// stopped together below, through the session agents
+			userApps = append(userApps, app)
+			continue
+		}
+
 		var err error
 		timings.Run(tm, "stop-service", fmt.Sprintf("stop service %q", app.ServiceName()), func(nested timings.Measurer) {
 			err = stopService(sysd, app, inter)
@@ -352,11 +500,49 @@ func StopServices(apps []*snap.AppInfo, reason snap.ServiceStopReason, inter int
 		}
 	}
 
+	if len(userApps) != 0 {
+		var err error
+		timings.Run(tm, "stop-user-services", "stop user services", func(nested timings.Measurer) {
+			err = stopUserServices(userApps, inter)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RestartActiveServices restarts those of the given services that are
+// currently active, leaving the others alone.
+func RestartActiveServices(svcs []*snap.AppInfo, inter interacter) error {
+	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, inter)
+
+	for _, app := range svcs {
+		if !app.IsService() || !osutil.FileExists(app.ServiceFile()) {
+			continue
+		}
+		if app.IsUserService() {
+			// the system instance knows nothing about user services
+			continue
+		}
+		active, err := sysd.IsActive(app.ServiceName())
+		if err != nil {
+			return err
+		}
+		if !active {
+			continue
+		}
+		if err := sysd.Restart(app.ServiceName(), serviceStopTimeout(app)); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // ServicesEnableState returns a map of service names from the given snap,
-// together with their enable/disable status.
+// together with their enable/disable status. User services are not
+// included as their state is per user.
 func ServicesEnableState(s *snap.Info, inter interacter) (map[string]bool, error) {
 	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, inter)
 
@@ -364,7 +550,7 @@ func ServicesEnableState(s *snap.Info, inter interacter) (map[string]bool, error
 	// systemd state of the snaps
 	snapSvcsState := make(map[string]bool, len(s.Apps))
 	for name, app := range s.Apps {
-		if !app.IsService() {
+		if !app.IsService() || app.IsUserService() {
 			continue
 		}
 		state, err := sysd.IsEnabled(app.ServiceName())
@@ -378,14 +564,22 @@ func ServicesEnableState(s *snap.Info, inter interacter) (map[string]bool, error
 
 // RemoveSnapServices disables and removes service units for the applications from the snap which are services.
 func RemoveSnapServices(s *snap.Info, inter interacter) error {
-	sysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, inter)
-	nservices := 0
+	systemSysd := systemd.New(dirs.GlobalRootDir, systemd.SystemMode, inter)
+	userGlobalSysd := systemd.New(dirs.GlobalRootDir, systemd.GlobalUserMode, inter)
+	nservices, nuserServices := 0, 0
 
 	for _, app := range s.Apps {
 		if !app.IsService() || !osutil.FileExists(app.ServiceFile()) {
 			continue
 		}
-		nservices++
+
+		sysd := systemSysd
+		if app.IsUserService() {
+			sysd = userGlobalSysd
+			nuserServices++
+		} else {
+			nservices++
+		}
 
 		serviceName := filepath.Base(app.ServiceFile())
 
@@ -422,11 +616,22 @@ func RemoveSnapServices(s *snap.Info, inter interacter) error {
 			logger.Noticef("Failed to remove service file for %q: %v", serviceName, err)
 		}
 
+		dropIn := quotaDropInFile(app)
+		if err := os.Remove(dropIn); err != nil && !os.IsNotExist(err) {
+			logger.Noticef("Failed to remove quota drop-in file for %q: %v", serviceName, err)
+		}
+		// only removed if empty, i.e. if it held nothing but ours
+		os.Remove(filepath.Dir(dropIn))
 	}
 
 	// only reload if we actually had services
 	if nservices > 0 {
-		if err := sysd.DaemonReload(); err != nil {
+		if err := systemSysd.DaemonReload(); err != nil {
+			return err
+		}
+	}
+	if nuserServices > 0 {
+		if err := userDaemonReload(); err != nil {
 			return err
 		}
 	}
@@ -449,9 +654,15 @@ func genServiceFile(appInfo *snap.AppInfo) []byte {
 	serviceTemplate := `[Unit]
 # Auto-generated, DO NOT EDIT
 Description=Service for snap application {{.App.Snap.InstanceName}}.{{.App.Name}}
+{{- if .MountUnit}}
 Requires={{.MountUnit}}
+{{- end}}
+{{- if .PrerequisiteTarget}}
 Wants={{.PrerequisiteTarget}}
-After={{.MountUnit}} {{.PrerequisiteTarget}}{{if .After}} {{ stringsJoin .After " " }}{{end}}
+{{- end}}
+{{- if .After}}
+After={{ stringsJoin .After " " }}
+{{- end}}
 {{- if .Before}}
 Before={{ stringsJoin .Before " "}}
 {{- end}}
@@ -464,7 +675,7 @@ Restart={{.Restart}}
 {{- if .App.RestartDelay}}
 RestartSec={{.App.RestartDelay.Seconds}}
 {{- end}}
-WorkingDirectory={{.App.Snap.DataDir}}
+WorkingDirectory={{.WorkingDir}}
 {{- if .App.StopCommand}}
 ExecStop={{.App.LauncherStopCommand}}
 {{- end}}
@@ -538,6 +749,7 @@ WantedBy={{.ServicesTarget}}
 		ServicesTarget     string
 		PrerequisiteTarget string
 		MountUnit          string
+		WorkingDir         string
 		Remain             string
 		KillMode           string
 		KillSignal         string
@@ -555,6 +767,7 @@ WantedBy={{.ServicesTarget}}
 		ServicesTarget:     systemd.ServicesTarget,
 		PrerequisiteTarget: systemd.PrerequisiteTarget,
 		MountUnit:          filepath.Base(systemd.MountUnitPath(appInfo.Snap.MountDir())),
+		WorkingDir:         appInfo.Snap.DataDir(),
 		Remain:             remain,
 		KillMode:           killMode,
 		KillSignal:         appInfo.StopMode.KillSignal(),
@@ -565,6 +778,15 @@ WantedBy={{.ServicesTarget}}
 		// systemd runs as PID 1 so %h will not work.
 		Home: "/root",
 	}
+	if appInfo.IsUserService() {
+		// the systemd user instance cannot depend on system units
+		wrapperData.ServicesTarget = systemd.UserServicesTarget
+		wrapperData.PrerequisiteTarget = ""
+		wrapperData.MountUnit = ""
+		wrapperData.WorkingDir = appInfo.Snap.UserDataDir("%h")
+	} else {
+		wrapperData.After = append([]string{wrapperData.MountUnit, wrapperData.PrerequisiteTarget}, wrapperData.After...)
+	}
 
 	if err := t.Execute(&templateOut, wrapperData); err != nil {
 		// this can never happen, except we forget a variable
@@ -578,8 +800,10 @@ func genServiceSocketFile(appInfo *snap.AppInfo, socketName string) []byte {
 	socketTemplate := `[Unit]
 # Auto-generated, DO NOT EDIT
 Description=Socket {{.SocketName}} for snap application {{.App.Snap.InstanceName}}.{{.App.Name}}
+{{- if .MountUnit}}
 Requires={{.MountUnit}}
 After={{.MountUnit}}
+{{- end}}
 X-Snappy=yes
 
 [Socket]
@@ -615,6 +839,9 @@ WantedBy={{.SocketsTarget}}
 		SocketInfo:      socket,
 		ListenStream:    listenStream,
 	}
+	if appInfo.IsUserService() {
+		wrapperData.MountUnit = ""
+	}
 
 	if err := t.Execute(&templateOut, wrapperData); err != nil {
 		// this can never happen, except we forget a variable
@@ -638,6 +865,13 @@ func generateSnapSocketFiles(app *snap.AppInfo) (*map[string][]byte, error) {
 
 func renderListenStream(socket *snap.SocketInfo) string {
 	snap := socket.App.Snap
+	if socket.App.IsUserService() {
+		// expanded by the systemd user instance: %h is the home
+		// directory and %t the runtime directory of the user
+		listenStream := strings.Replace(socket.ListenStream, "$SNAP_USER_DATA", snap.UserDataDir("%h"), -1)
+		listenStream = strings.Replace(listenStream, "$SNAP_USER_COMMON", snap.UserCommonDataDir("%h"), -1)
+		return strings.Replace(listenStream, "$XDG_RUNTIME_DIR", fmt.Sprintf("%%t/snap.%s", snap.InstanceName()), -1)
+	}
 	listenStream := strings.Replace(socket.ListenStream, "$SNAP_DATA", snap.DataDir(), -1)
 	// TODO: when we support User/Group in the generated systemd unit,
 	// adjust this accordingly
@@ -651,8 +885,10 @@ func generateSnapTimerFile(app *snap.AppInfo) ([]byte, error) {
 	timerTemplate := `[Unit]
 # Auto-generated, DO NOT EDIT
 Description=Timer {{.TimerName}} for snap application {{.App.Snap.InstanceName}}.{{.App.Name}}
+{{- if .MountUnit}}
 Requires={{.MountUnit}}
 After={{.MountUnit}}
+{{- end}}
 X-Snappy=yes
 
 [Timer]
@@ -687,6 +923,9 @@ WantedBy={{.TimersTarget}}
 		MountUnit:       filepath.Base(systemd.MountUnitPath(app.Snap.MountDir())),
 		Schedules:       schedules,
 	}
+	if app.IsUserService() {
+		wrapperData.MountUnit = ""
+	}
 
 	if err := t.Execute(&templateOut, wrapperData); err != nil {
 		// this can never happen, except we forget a variable
@@ -132,6 +132,48 @@ apps:
 	c.Check(string(generatedWrapper), Equals, expectedAppService)
 }
 
+func (s *servicesWrapperGenSuite) TestGenerateSnapUserServiceFile(c *C) {
+	yamlText := `
+name: snap
+version: 1.0
+apps:
+    app:
+        command: bin/start
+        stop-command: bin/stop
+        reload-command: bin/reload
+        post-stop-command: bin/stop --post
+        stop-timeout: 10s
+        daemon: simple
+        daemon-scope: user
+`
+	info, err := snap.InfoFromSnapYaml([]byte(yamlText))
+	c.Assert(err, IsNil)
+	info.Revision = snap.R(44)
+	app := info.Apps["app"]
+
+	generatedWrapper, err := wrappers.GenerateSnapServiceFile(app)
+	c.Assert(err, IsNil)
+	c.Check(string(generatedWrapper), Equals, `[Unit]
+# Auto-generated, DO NOT EDIT
+Description=Service for snap application snap.app
+X-Snappy=yes
+
+[Service]
+ExecStart=/usr/bin/snap run snap.app
+SyslogIdentifier=snap.app
+Restart=on-failure
+WorkingDirectory=%h/snap/snap/44
+ExecStop=/usr/bin/snap run --command=stop snap.app
+ExecReload=/usr/bin/snap run --command=reload snap.app
+ExecStopPost=/usr/bin/snap run --command=post-stop snap.app
+TimeoutStopSec=10
+Type=simple
+
+[Install]
+WantedBy=default.target
+`)
+}
+
 func (s *servicesWrapperGenSuite) TestGenerateSnapServiceFileWithStartTimeout(c *C) {
 	yamlText := `
 name: snap
@@ -351,6 +393,68 @@ WantedBy=sockets.target
 	})
 }
 
+func (s *servicesWrapperGenSuite) TestGenerateSnapUserServiceWithSockets(c *C) {
+	si := &snap.Info{
+		SuggestedName: "some-snap",
+		Version:       "1.0",
+		SideInfo:      snap.SideInfo{Revision: snap.R(44)},
+	}
+	service := &snap.AppInfo{
+		Snap:        si,
+		Name:        "app",
+		Command:     "bin/foo start",
+		Daemon:      "simple",
+		DaemonScope: snap.UserDaemon,
+		Plugs:       map[string]*snap.PlugInfo{"network-bind": {}},
+		Sockets: map[string]*snap.SocketInfo{
+			"sock1": {
+				Name:         "sock1",
+				ListenStream: "$SNAP_USER_DATA/sock1.socket",
+			},
+			"sock2": {
+				Name:         "sock2",
+				ListenStream: "$XDG_RUNTIME_DIR/sock2.socket",
+			},
+		},
+	}
+	service.Sockets["sock1"].App = service
+	service.Sockets["sock2"].App = service
+
+	sock1Path := filepath.Join(dirs.SnapUserServicesDir, "snap.some-snap.app.sock1.socket")
+	sock2Path := filepath.Join(dirs.SnapUserServicesDir, "snap.some-snap.app.sock2.socket")
+
+	generatedSockets, err := wrappers.GenerateSnapSocketFiles(service)
+	c.Assert(err, IsNil)
+	c.Assert(*generatedSockets, DeepEquals, map[string][]byte{
+		sock1Path: []byte(`[Unit]
+# Auto-generated, DO NOT EDIT
+Description=Socket sock1 for snap application some-snap.app
+X-Snappy=yes
+
+[Socket]
+Service=snap.some-snap.app.service
+FileDescriptorName=sock1
+ListenStream=%h/snap/some-snap/44/sock1.socket
+
+[Install]
+WantedBy=sockets.target
+`),
+		sock2Path: []byte(`[Unit]
+# Auto-generated, DO NOT EDIT
+Description=Socket sock2 for snap application some-snap.app
+X-Snappy=yes
+
+[Socket]
+Service=snap.some-snap.app.service
+FileDescriptorName=sock2
+ListenStream=%t/snap.some-snap/sock2.socket
+
+[Install]
+WantedBy=sockets.target
+`),
+	})
+}
+
 func (s *servicesWrapperGenSuite) TestServiceAfterBefore(c *C) {
 	const expectedServiceFmt = `[Unit]
 # Auto-generated, DO NOT EDIT
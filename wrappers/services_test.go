@@ -22,6 +22,7 @@ package wrappers_test
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
@@ -36,10 +37,12 @@ import (
 	"github.com/snapcore/snapd/progress"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/snapdenv"
 	"github.com/snapcore/snapd/strutil"
 	"github.com/snapcore/snapd/systemd"
 	"github.com/snapcore/snapd/testutil"
 	"github.com/snapcore/snapd/timings"
+	"github.com/snapcore/snapd/usersession/agent"
 	"github.com/snapcore/snapd/wrappers"
 )
 
@@ -114,6 +117,222 @@ func (s *servicesTestSuite) TestAddSnapServicesAndRemove(c *C) {
 	c.Check(s.sysdLog[1], DeepEquals, []string{"daemon-reload"})
 }
 
+func (s *servicesTestSuite) TestAddSnapServicesPreseeding(c *C) {
+	restore := snapdenv.MockPreseeding(true)
+	defer restore()
+
+	info := snaptest.MockSnap(c, packageHello, &snap.SideInfo{Revision: snap.R(12)})
+	svcFile := filepath.Join(s.tempdir, "/etc/systemd/system/snap.hello-snap.svc1.service")
+
+	err := wrappers.AddSnapServices(info, nil, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(svcFile, testutil.FilePresent)
+	// no daemon-reload, systemd is not running
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--root", dirs.GlobalRootDir, "enable", filepath.Base(svcFile)},
+	})
+}
+
+const packageHelloUser = `name: hello-snap
+version: 1.10
+apps:
+ svc1:
+  command: bin/hello
+  daemon: simple
+  daemon-scope: user
+`
+
+// startAgent runs a session agent for the current user, so that user
+// services can be controlled through it
+func (s *servicesTestSuite) startAgent(c *C) (stop func()) {
+	xdgRuntimeDir := fmt.Sprintf("%s/%d", dirs.XdgRuntimeDirBase, os.Getuid())
+	c.Assert(os.MkdirAll(xdgRuntimeDir, 0700), IsNil)
+	a, err := agent.New()
+	c.Assert(err, IsNil)
+	a.Start()
+	return func() {
+		c.Check(a.Stop(), IsNil)
+	}
+}
+
+func (s *servicesTestSuite) TestAddSnapUserServicesAndRemove(c *C) {
+	defer s.startAgent(c)()
+
+	info := snaptest.MockSnap(c, packageHelloUser, &snap.SideInfo{Revision: snap.R(12)})
+	svcFile := filepath.Join(s.tempdir, "/etc/systemd/user/snap.hello-snap.svc1.service")
+
+	err := wrappers.AddSnapServices(info, nil, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "--global", "--root", dirs.GlobalRootDir, "enable", filepath.Base(svcFile)},
+		{"--user", "daemon-reload"},
+	})
+
+	content, err := ioutil.ReadFile(svcFile)
+	c.Assert(err, IsNil)
+	c.Check(string(content), Matches, "(?ms).*^WantedBy=default.target$.*")
+	c.Check(string(content), Not(Matches), "(?ms).*^Requires=.*")
+
+	s.sysdLog = nil
+	err = wrappers.StartServices(info.Services(), progress.Null, s.perfTimings)
+	c.Assert(err, IsNil)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "--global", "--root", dirs.GlobalRootDir, "is-enabled", filepath.Base(svcFile)},
+		{"--user", "start", filepath.Base(svcFile)},
+	})
+
+	s.sysdLog = nil
+	err = wrappers.StopServices(info.Services(), snap.StopReasonRemove, progress.Null, s.perfTimings)
+	c.Assert(err, IsNil)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "stop", filepath.Base(svcFile)},
+		{"--user", "show", "--property=ActiveState", filepath.Base(svcFile)},
+	})
+
+	s.sysdLog = nil
+	err = wrappers.RemoveSnapServices(info, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(osutil.FileExists(svcFile), Equals, false)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "--global", "--root", dirs.GlobalRootDir, "disable", filepath.Base(svcFile)},
+		{"--user", "daemon-reload"},
+	})
+}
+
+func (s *servicesTestSuite) TestUserServicesNoAgents(c *C) {
+	// without any user logged in there is nothing to reload or start
+	info := snaptest.MockSnap(c, packageHelloUser, &snap.SideInfo{Revision: snap.R(12)})
+	svcFile := filepath.Join(s.tempdir, "/etc/systemd/user/snap.hello-snap.svc1.service")
+
+	err := wrappers.AddSnapServices(info, nil, progress.Null)
+	c.Assert(err, IsNil)
+	err = wrappers.StartServices(info.Services(), progress.Null, s.perfTimings)
+	c.Assert(err, IsNil)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "--global", "--root", dirs.GlobalRootDir, "enable", filepath.Base(svcFile)},
+		{"--user", "--global", "--root", dirs.GlobalRootDir, "is-enabled", filepath.Base(svcFile)},
+	})
+
+	// user services are not part of the system enable state
+	state, err := wrappers.ServicesEnableState(info, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(state, HasLen, 0)
+}
+
+func (s *servicesTestSuite) TestStartUserServicesFailure(c *C) {
+	defer s.startAgent(c)()
+
+	info := snaptest.MockSnap(c, packageHelloUser, &snap.SideInfo{Revision: snap.R(12)})
+	svcFile := filepath.Join(s.tempdir, "/etc/systemd/user/snap.hello-snap.svc1.service")
+
+	s.systemctlRestorer()
+	s.systemctlRestorer = systemd.MockSystemctl(func(cmd ...string) ([]byte, error) {
+		s.sysdLog = append(s.sysdLog, cmd)
+		if cmd[1] == "start" {
+			return nil, fmt.Errorf("failed")
+		}
+		return []byte("ActiveState=inactive\n"), nil
+	})
+
+	err := wrappers.StartServices(info.Services(), progress.Null, s.perfTimings)
+	c.Assert(err, ErrorMatches, "cannot start user services of uid [0-9]+: some user services failed to start")
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "--global", "--root", dirs.GlobalRootDir, "is-enabled", filepath.Base(svcFile)},
+		{"--user", "start", filepath.Base(svcFile)},
+		// undo
+		{"--user", "stop", filepath.Base(svcFile)},
+		{"--user", "show", "--property=ActiveState", filepath.Base(svcFile)},
+	})
+}
+
+func (s *servicesTestSuite) TestStartUserServicesSkipsDisabled(c *C) {
+	info := snaptest.MockSnap(c, packageHelloUser, &snap.SideInfo{Revision: snap.R(12)})
+	svcFile := "snap.hello-snap.svc1.service"
+
+	s.systemctlRestorer()
+	r := testutil.MockCommand(c, "systemctl", `#!/bin/sh
+	if [ "$1" = "--user" ] && [ "$2" = "--global" ] && [ "$3" = "--root" ]; then
+	    shift 4
+	fi
+
+	case "$1" in
+	    is-enabled)
+	        echo "disabled"
+	        exit 1
+	        ;;
+	    *)
+	        echo "unexpected op $*"
+	        exit 2
+	esac
+	`)
+	defer r.Restore()
+
+	// nothing is started, so no session agent is contacted
+	err := wrappers.StartServices(info.Services(), progress.Null, s.perfTimings)
+	c.Assert(err, IsNil)
+	c.Check(r.Calls(), DeepEquals, [][]string{
+		{"systemctl", "--user", "--global", "--root", s.tempdir, "is-enabled", svcFile},
+	})
+}
+
+const packageHelloUserSocketTimer = `name: hello-snap
+version: 1.10
+apps:
+ svc1:
+  command: bin/hello
+  daemon: simple
+  daemon-scope: user
+  plugs: [network-bind]
+  sockets:
+    sock1:
+      listen-stream: $SNAP_USER_COMMON/sock1.socket
+ svc2:
+  command: bin/hello
+  daemon: simple
+  daemon-scope: user
+  timer: 10:00-12:00
+`
+
+func (s *servicesTestSuite) TestStartUserServicesSocketAndTimer(c *C) {
+	defer s.startAgent(c)()
+
+	info := snaptest.MockSnap(c, packageHelloUserSocketTimer, &snap.SideInfo{Revision: snap.R(12)})
+	apps := []*snap.AppInfo{info.Apps["svc1"], info.Apps["svc2"]}
+
+	err := wrappers.StartServices(apps, progress.Null, s.perfTimings)
+	c.Assert(err, IsNil)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--user", "--global", "--root", dirs.GlobalRootDir, "enable", "snap.hello-snap.svc1.sock1.socket"},
+		{"--user", "--global", "--root", dirs.GlobalRootDir, "enable", "snap.hello-snap.svc2.timer"},
+		// started through the session agent
+		{"--user", "start", "snap.hello-snap.svc1.sock1.socket"},
+		{"--user", "start", "snap.hello-snap.svc2.timer"},
+	})
+}
+
+func (s *servicesTestSuite) TestRestartActiveServices(c *C) {
+	info := snaptest.MockSnap(c, packageHello, &snap.SideInfo{Revision: snap.R(12)})
+	svcFile := filepath.Join(s.tempdir, "/etc/systemd/system/snap.hello-snap.svc1.service")
+
+	// no service file, nothing to restart
+	err := wrappers.RestartActiveServices(info.Services(), progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(s.sysdLog, HasLen, 0)
+
+	err = wrappers.AddSnapServices(info, nil, progress.Null)
+	c.Assert(err, IsNil)
+
+	s.sysdLog = nil
+	err = wrappers.RestartActiveServices(info.Services(), progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"--root", dirs.GlobalRootDir, "is-active", filepath.Base(svcFile)},
+		{"stop", filepath.Base(svcFile)},
+		{"show", "--property=ActiveState", filepath.Base(svcFile)},
+		{"start", filepath.Base(svcFile)},
+	})
+}
+
 var snapdYaml = `name: snapd
 version: 1.0
 type: snapd